@@ -5,37 +5,133 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/grafana"
+	"github.com/milkywaybrain/cryptogalaxy/internal/importer"
 	"github.com/milkywaybrain/cryptogalaxy/internal/initializer"
+	"github.com/milkywaybrain/cryptogalaxy/internal/scaffold"
 )
 
 func main() {
 
+	// Subcommand for generating grafana dashboard and datasource provisioning files.
+	if len(os.Args) > 1 && os.Args[1] == "grafana-export" {
+		grafanaExport(os.Args[2:])
+		return
+	}
+
+	// Subcommand for importing historical data from external datasets.
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		importData(os.Args[2:])
+		return
+	}
+
+	// Subcommand for generating new exchange module scaffolding.
+	if len(os.Args) > 2 && os.Args[1] == "gen" && os.Args[2] == "exchange" {
+		genExchange(os.Args[3:])
+		return
+	}
+
 	// Load config file values.
 	// Default path for file is ./config.json.
 	cfgPath := flag.String("config", "./config.json", "configuration JSON file path")
 	flag.Parse()
-	cfgFile, err := os.Open(*cfgPath)
+	cfg, ok := loadConfig(*cfgPath)
+	if !ok {
+		return
+	}
+
+	// Start the app.
+	err := initializer.Start(context.Background(), cfg)
 	if err != nil {
-		fmt.Println("Not able to find config file :", *cfgPath)
-		fmt.Println("exiting the app")
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, "exiting the app")
+	}
+}
+
+// grafanaExport writes grafana dashboard and datasource files for the configured app.
+func grafanaExport(args []string) {
+	fs := flag.NewFlagSet("grafana-export", flag.ExitOnError)
+	cfgPath := fs.String("config", "./config.json", "configuration JSON file path")
+	outDir := fs.String("out", "./grafana", "output directory for dashboard and datasource files")
+	_ = fs.Parse(args)
+	cfg, ok := loadConfig(*cfgPath)
+	if !ok {
 		return
 	}
-	var cfg config.Config
-	if err = jsoniter.NewDecoder(cfgFile).Decode(&cfg); err != nil {
-		fmt.Println("Not able to parse JSON from config file :", *cfgPath)
-		fmt.Println("exiting the app")
+	if err := grafana.Export(cfg, *outDir); err != nil {
+		fmt.Println("Not able to export grafana files :", err)
 		return
 	}
-	cfgFile.Close()
+	fmt.Println("Grafana files exported to :", *outDir)
+}
 
-	// Start the app.
-	err = initializer.Start(context.Background(), &cfg)
+// importData imports historical trades from the dataset file to the given storages.
+func importData(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	cfgPath := fs.String("config", "./config.json", "configuration JSON file path")
+	source := fs.String("source", importer.SourceBinanceVision, "dataset source, binance-vision or kaiko")
+	file := fs.String("file", "", "dataset file path, csv or zip")
+	channel := fs.String("channel", "trade", "channel of the data, trade or agg_trade")
+	exchange := fs.String("exchange", "", "exchange name to store the data with")
+	market := fs.String("market", "", "market name to store the data with")
+	storages := fs.String("storages", "mysql", "comma separated storages to import the data to")
+	_ = fs.Parse(args)
+	cfg, ok := loadConfig(*cfgPath)
+	if !ok {
+		return
+	}
+	opts := importer.Options{
+		Source:   *source,
+		File:     *file,
+		Channel:  *channel,
+		Exchange: *exchange,
+		Market:   *market,
+		Storages: strings.Split(*storages, ","),
+	}
+	count, err := importer.Import(context.Background(), cfg, opts)
+	if err != nil {
+		fmt.Println("Not able to import data :", err)
+		fmt.Println("Imported records before the error :", count)
+		return
+	}
+	fmt.Println("Imported records :", count)
+}
+
+// genExchange creates a new exchange module from the template and registers it in the app.
+func genExchange(args []string) {
+	fs := flag.NewFlagSet("gen exchange", flag.ExitOnError)
+	name := fs.String("name", "", "exchange name, e.g. coinbase-pro")
+	dir := fs.String("dir", ".", "repository root directory")
+	_ = fs.Parse(args)
+	files, err := scaffold.GenerateExchange(*dir, *name)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Println("Not able to generate exchange module :", err)
+		return
+	}
+	for _, f := range files {
+		fmt.Println("Generated :", f)
+	}
+}
+
+// loadConfig reads and parses the config file.
+func loadConfig(cfgPath string) (*config.Config, bool) {
+	cfgFile, err := os.Open(cfgPath)
+	if err != nil {
+		fmt.Println("Not able to find config file :", cfgPath)
+		fmt.Println("exiting the app")
+		return nil, false
+	}
+	defer cfgFile.Close()
+	var cfg config.Config
+	if err = jsoniter.NewDecoder(cfgFile).Decode(&cfg); err != nil {
+		fmt.Println("Not able to parse JSON from config file :", cfgPath)
 		fmt.Println("exiting the app")
+		return nil, false
 	}
+	return &cfg, true
 }
@@ -3,15 +3,31 @@ module github.com/milkywaybrain/cryptogalaxy
 go 1.16
 
 require (
+	cloud.google.com/go/bigquery v1.28.0
+	github.com/Azure/azure-event-hubs-go/v3 v3.3.16
+	github.com/ClickHouse/clickhouse-go v1.5.4
+	github.com/aws/aws-sdk-go v1.42.27
+	github.com/eclipse/paho.mqtt.golang v1.3.5
 	github.com/elastic/go-elasticsearch/v7 v7.13.1
 	github.com/go-sql-driver/mysql v1.6.0
-	github.com/gobwas/httphead v0.1.0 // indirect
+	github.com/go-zeromq/zmq4 v0.13.0
+	github.com/gobwas/httphead v0.1.0
 	github.com/gobwas/pool v0.2.1 // indirect
 	github.com/gobwas/ws v1.0.4
+	github.com/gocql/gocql v1.0.0
+	github.com/golang/snappy v0.0.4
 	github.com/json-iterator/go v1.1.11
-	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
-	github.com/modern-go/reflect2 v1.0.1 // indirect
+	github.com/lib/pq v1.10.9
+	github.com/opensearch-project/opensearch-go v1.1.0
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.11.0
 	github.com/rs/zerolog v1.22.0
+	github.com/snowflakedb/gosnowflake v1.6.3
+	github.com/xitongsys/parquet-go v1.6.2
+	golang.org/x/net v0.0.0-20211216030914-fe4d6282115f
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	google.golang.org/api v0.67.0
+	google.golang.org/grpc v1.44.0
+	google.golang.org/protobuf v1.27.1
+	modernc.org/sqlite v1.14.8
 )
@@ -0,0 +1,294 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Alert types.
+const (
+	TypeMove      = "price_move"
+	TypeDeviation = "price_deviation"
+	TypeArbitrage = "arbitrage_spread"
+	TypeCandle    = "candle_divergence"
+)
+
+// Alert is the JSON body posted to the webhook.
+type Alert struct {
+	Type             string    `json:"type"`
+	Exchange         string    `json:"exchange"`
+	Market           string    `json:"market"`
+	Price            float64   `json:"price"`
+	ReferencePrice   float64   `json:"reference_price"`
+	ChangePercent    float64   `json:"change_percent"`
+	WindowSec        int       `json:"window_sec,omitempty"`
+	CompareExchange  string    `json:"compare_exchange,omitempty"`
+	CompareMarket    string    `json:"compare_market,omitempty"`
+	Interval         string    `json:"interval,omitempty"`
+	Field            string    `json:"field,omitempty"`
+	ThresholdPercent float64   `json:"threshold_percent"`
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// market identifies an exchange market in the rules.
+type market struct {
+	exchange string
+	id       string
+}
+
+// pricePoint is the last price of the market in a second.
+type pricePoint struct {
+	second int64
+	price  float64
+}
+
+// rule holds the config and the state of a single alert rule.
+type rule struct {
+	cfg           config.AlertRule
+	market        market
+	compare       market
+	window        time.Duration
+	prices        []pricePoint
+	last          float64
+	lastAt        time.Time
+	compareLast   float64
+	compareLastAt time.Time
+	lastAlert     map[string]time.Time
+}
+
+var alerter struct {
+	cfg      *config.Alert
+	cooldown time.Duration
+	rules    map[market][]*rule
+	mu       sync.Mutex
+	queue    chan Alert
+}
+
+// Init prepares the alert rules from the config.
+// Rules are set once before starting the exchanges, prices are observed afterwards from all the exchange goroutines.
+func Init(cfg *config.Alert) {
+	alerter.cfg = cfg
+	alerter.cooldown = time.Duration(cfg.CooldownSec) * time.Second
+	if alerter.cooldown == 0 {
+		alerter.cooldown = 5 * time.Minute
+	}
+	alerter.rules = make(map[market][]*rule)
+	alerter.queue = make(chan Alert, 100)
+	for _, rc := range cfg.Rules {
+		r := rule{
+			cfg:       rc,
+			market:    market{exchange: rc.Exchange, id: strings.ToUpper(rc.Market)},
+			window:    time.Duration(rc.WindowSec) * time.Second,
+			lastAlert: make(map[string]time.Time),
+		}
+		if r.window == 0 {
+			r.window = time.Minute
+		}
+		alerter.rules[r.market] = append(alerter.rules[r.market], &r)
+		if rc.CompareExchange != "" {
+			r.compare = market{exchange: rc.CompareExchange, id: strings.ToUpper(rc.Market)}
+			if rc.CompareMarket != "" {
+				r.compare.id = strings.ToUpper(rc.CompareMarket)
+			}
+			alerter.rules[r.compare] = append(alerter.rules[r.compare], &r)
+		}
+	}
+}
+
+// Observe checks the price of the market against the alert rules and queues the alerts to be posted.
+// It never blocks, if the queue is full because of a slow webhook, the alert is dropped.
+func Observe(exchange string, mktID string, price float64, timestamp time.Time) {
+	if alerter.rules == nil {
+		return
+	}
+	key := market{exchange: exchange, id: strings.ToUpper(mktID)}
+	rules, ok := alerter.rules[key]
+	if !ok {
+		return
+	}
+
+	alerter.mu.Lock()
+	var alerts []Alert
+	for _, r := range rules {
+		if key == r.market {
+			alerts = append(alerts, r.observe(price, timestamp)...)
+		} else {
+			alerts = append(alerts, r.observeCompare(price, timestamp)...)
+		}
+	}
+	alerter.mu.Unlock()
+
+	for _, a := range alerts {
+		enqueue(a)
+	}
+}
+
+// Send queues the alert raised outside of the alert rules, e.g. by the arbitrage monitor, to be posted.
+// It does nothing if the alerts are not enabled.
+func Send(a Alert) {
+	if alerter.queue == nil {
+		return
+	}
+	enqueue(a)
+}
+
+// enqueue adds the alert to the queue without blocking, if the queue is full because of a slow webhook,
+// the alert is dropped.
+func enqueue(a Alert) {
+	select {
+	case alerter.queue <- a:
+	default:
+		log.Error().Str("type", a.Type).Str("exchange", a.Exchange).Str("market", a.Market).Msg("alert queue is full, dropping alert")
+	}
+}
+
+// observe updates the rule market price and checks for both the move and the deviation.
+func (r *rule) observe(price float64, timestamp time.Time) []Alert {
+	r.last = price
+	r.lastAt = timestamp
+	var alerts []Alert
+
+	if r.cfg.MovePercent > 0 {
+
+		// Only the last price of every second is kept, so that the window size is bounded for high volume markets.
+		second := timestamp.Unix()
+		if n := len(r.prices); n > 0 && r.prices[n-1].second == second {
+			r.prices[n-1].price = price
+		} else {
+			r.prices = append(r.prices, pricePoint{second: second, price: price})
+		}
+		from := timestamp.Add(-r.window).Unix()
+		i := 0
+		for i < len(r.prices) && r.prices[i].second < from {
+			i++
+		}
+		r.prices = r.prices[i:]
+
+		// Move is measured from the farthest price within the window.
+		var ref, change float64
+		for _, p := range r.prices {
+			if p.price <= 0 {
+				continue
+			}
+			c := (price - p.price) / p.price * 100
+			if math.Abs(c) > math.Abs(change) {
+				ref, change = p.price, c
+			}
+		}
+		if math.Abs(change) > r.cfg.MovePercent && r.allow(TypeMove, timestamp) {
+			alerts = append(alerts, Alert{
+				Type:             TypeMove,
+				Exchange:         r.cfg.Exchange,
+				Market:           r.cfg.Market,
+				Price:            price,
+				ReferencePrice:   ref,
+				ChangePercent:    change,
+				WindowSec:        int(r.window / time.Second),
+				ThresholdPercent: r.cfg.MovePercent,
+				Timestamp:        timestamp,
+			})
+		}
+	}
+
+	if a, ok := r.deviation(timestamp); ok {
+		alerts = append(alerts, a)
+	}
+	return alerts
+}
+
+// observeCompare updates the compare market price and checks for the deviation.
+func (r *rule) observeCompare(price float64, timestamp time.Time) []Alert {
+	r.compareLast = price
+	r.compareLastAt = timestamp
+	if a, ok := r.deviation(timestamp); ok {
+		return []Alert{a}
+	}
+	return nil
+}
+
+// deviation checks the rule market price against the compare market one.
+// Both the prices should be received within the window, otherwise a stale price may be compared.
+func (r *rule) deviation(timestamp time.Time) (Alert, bool) {
+	if r.cfg.DeviationPercent <= 0 || r.last <= 0 || r.compareLast <= 0 {
+		return Alert{}, false
+	}
+	if timestamp.Sub(r.lastAt) > r.window || timestamp.Sub(r.compareLastAt) > r.window {
+		return Alert{}, false
+	}
+	change := (r.last - r.compareLast) / r.compareLast * 100
+	if math.Abs(change) <= r.cfg.DeviationPercent || !r.allow(TypeDeviation, timestamp) {
+		return Alert{}, false
+	}
+	return Alert{
+		Type:             TypeDeviation,
+		Exchange:         r.cfg.Exchange,
+		Market:           r.cfg.Market,
+		Price:            r.last,
+		ReferencePrice:   r.compareLast,
+		ChangePercent:    change,
+		CompareExchange:  r.compare.exchange,
+		CompareMarket:    r.compare.id,
+		ThresholdPercent: r.cfg.DeviationPercent,
+		Timestamp:        timestamp,
+	}, true
+}
+
+// allow tells whether the alert of the type can be sent now considering the cooldown.
+func (r *rule) allow(typ string, timestamp time.Time) bool {
+	if last, ok := r.lastAlert[typ]; ok && timestamp.Sub(last) < alerter.cooldown {
+		return false
+	}
+	r.lastAlert[typ] = timestamp
+	return true
+}
+
+// Serve posts the queued alerts to the webhook till the app context is canceled.
+// Failed posts are only logged, so that an unavailable webhook never stops the data collection.
+func Serve(appCtx context.Context) error {
+	client := &http.Client{Timeout: time.Duration(alerter.cfg.ReqTimeoutSec) * time.Second}
+	for {
+		select {
+		case a := <-alerter.queue:
+			if err := post(appCtx, client, &a); err != nil {
+				if errors.Is(err, appCtx.Err()) {
+					return err
+				}
+				log.Error().Stack().Err(errors.WithStack(err)).Str("type", a.Type).Str("exchange", a.Exchange).Str("market", a.Market).Msg("alert webhook post failed")
+			}
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+	}
+}
+
+// post sends the alert to the webhook as JSON.
+func post(ctx context.Context, client *http.Client, a *Alert) error {
+	body, err := jsoniter.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", alerter.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("webhook response code : %v, status : %v", resp.StatusCode, resp.Status)
+	}
+	return nil
+}
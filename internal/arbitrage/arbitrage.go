@@ -0,0 +1,212 @@
+package arbitrage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// market identifies the canonical market across the exchanges.
+type market struct {
+	base  string
+	quote string
+}
+
+// price is the last price of the market in an exchange.
+type price struct {
+	value     float64
+	timestamp time.Time
+}
+
+// rule holds the config and the state of a single spread check.
+type rule struct {
+	cfg       config.ArbitrageRule
+	exchanges map[string]bool
+	prices    map[string]price
+	lastAt    time.Time
+}
+
+var monitor struct {
+	maxAge   time.Duration
+	cooldown time.Duration
+	rules    map[market][]*rule
+	mu       sync.Mutex
+	queue    chan storage.ArbitrageSpread
+	ter      *storage.Terminal
+	mysql    *storage.MySQL
+	es       *storage.ElasticSearch
+	uds      *storage.UDS
+}
+
+// Init prepares the spread rules from the config.
+// Rules are set once before starting the exchanges, prices are observed afterwards from all the exchange goroutines.
+// Storages should already be initialized.
+func Init(cfg *config.Arbitrage) {
+	monitor.maxAge = time.Duration(cfg.MaxAgeSec) * time.Second
+	if monitor.maxAge == 0 {
+		monitor.maxAge = 10 * time.Second
+	}
+	monitor.cooldown = time.Duration(cfg.CooldownSec) * time.Second
+	if monitor.cooldown == 0 {
+		monitor.cooldown = time.Minute
+	}
+	monitor.rules = make(map[market][]*rule)
+	monitor.queue = make(chan storage.ArbitrageSpread, 100)
+	for _, rc := range cfg.Rules {
+		r := rule{
+			cfg:       rc,
+			exchanges: make(map[string]bool, len(rc.Exchanges)),
+			prices:    make(map[string]price, len(rc.Exchanges)),
+		}
+		for _, exch := range rc.Exchanges {
+			r.exchanges[exch] = true
+		}
+		key := market{base: strings.ToUpper(rc.Base), quote: strings.ToUpper(rc.Quote)}
+		monitor.rules[key] = append(monitor.rules[key], &r)
+	}
+	for _, str := range cfg.Storages {
+		switch str {
+		case "terminal":
+			monitor.ter = storage.GetTerminal()
+		case "mysql":
+			monitor.mysql = storage.GetMySQL()
+		case "elastic_search":
+			monitor.es = storage.GetElasticSearch()
+		case "uds":
+			monitor.uds = storage.GetUDS()
+		}
+	}
+}
+
+// Observe records the price of the market in the exchange and checks the spread against the other exchanges
+// of the rules. Spread records are queued to be committed without blocking, if the queue is full because of
+// a slow storage, the record is dropped.
+func Observe(exchange string, base string, quote string, value float64, timestamp time.Time) {
+	if monitor.rules == nil || value <= 0 {
+		return
+	}
+	rules, ok := monitor.rules[market{base: base, quote: quote}]
+	if !ok {
+		return
+	}
+
+	monitor.mu.Lock()
+	var spreads []storage.ArbitrageSpread
+	for _, r := range rules {
+		if !r.exchanges[exchange] {
+			continue
+		}
+		r.prices[exchange] = price{value: value, timestamp: timestamp}
+		if s, ok := r.spread(timestamp); ok {
+			spreads = append(spreads, s)
+		}
+	}
+	monitor.mu.Unlock()
+
+	for _, s := range spreads {
+		select {
+		case monitor.queue <- s:
+		default:
+			log.Error().Str("base", s.Base).Str("quote", s.Quote).Msg("arbitrage queue is full, dropping spread")
+		}
+	}
+}
+
+// spread finds the lowest and the highest of the recent prices across the exchanges and
+// tells whether the spread between them exceeds the threshold.
+// A price older than the max age is not compared, as it may no longer be available.
+func (r *rule) spread(timestamp time.Time) (storage.ArbitrageSpread, bool) {
+	if timestamp.Sub(r.lastAt) < monitor.cooldown {
+		return storage.ArbitrageSpread{}, false
+	}
+	var buyExch, sellExch string
+	var buy, sell float64
+	for exch, p := range r.prices {
+		if timestamp.Sub(p.timestamp) > monitor.maxAge {
+			continue
+		}
+		if buyExch == "" || p.value < buy {
+			buyExch, buy = exch, p.value
+		}
+		if sellExch == "" || p.value > sell {
+			sellExch, sell = exch, p.value
+		}
+	}
+	if buyExch == "" || buyExch == sellExch {
+		return storage.ArbitrageSpread{}, false
+	}
+	spread := (sell - buy) / buy * 100
+	if spread <= r.cfg.ThresholdPercent {
+		return storage.ArbitrageSpread{}, false
+	}
+	r.lastAt = timestamp
+	s := storage.ArbitrageSpread{
+		Base:          strings.ToUpper(r.cfg.Base),
+		Quote:         strings.ToUpper(r.cfg.Quote),
+		BuyExchange:   buyExch,
+		BuyPrice:      buy,
+		SellExchange:  sellExch,
+		SellPrice:     sell,
+		SpreadPercent: spread,
+		Timestamp:     timestamp,
+	}
+	if r.cfg.Alert {
+		alert.Send(alert.Alert{
+			Type:             alert.TypeArbitrage,
+			Exchange:         buyExch,
+			Market:           fmt.Sprintf("%s/%s", s.Base, s.Quote),
+			Price:            sell,
+			ReferencePrice:   buy,
+			ChangePercent:    spread,
+			CompareExchange:  sellExch,
+			ThresholdPercent: r.cfg.ThresholdPercent,
+			Timestamp:        timestamp,
+		})
+	}
+	return s, true
+}
+
+// Serve commits the queued spread records to the configured storages till the app context is canceled.
+// Any commit error is returned, which makes the app to exit in the same way as for the exchange storages.
+func Serve(appCtx context.Context) error {
+	for {
+		select {
+		case s := <-monitor.queue:
+			if err := commit(appCtx, []storage.ArbitrageSpread{s}); err != nil {
+				return errors.Wrapf(err, "commit %s/%s spread", s.Base, s.Quote)
+			}
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+	}
+}
+
+func commit(ctx context.Context, data []storage.ArbitrageSpread) error {
+	if monitor.ter != nil {
+		monitor.ter.CommitArbitrageSpreads(data)
+	}
+	if monitor.mysql != nil {
+		if err := monitor.mysql.CommitArbitrageSpreads(ctx, data); err != nil {
+			return err
+		}
+	}
+	if monitor.es != nil {
+		if err := monitor.es.CommitArbitrageSpreads(ctx, data); err != nil {
+			return err
+		}
+	}
+	if monitor.uds != nil {
+		if err := monitor.uds.CommitArbitrageSpreads(ctx, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -58,6 +58,8 @@ const (
 	GeminiWebsocketURL = "wss://api.gemini.com/v2/marketdata"
 	// GeminiRESTBaseURL is the gemini exchange base REST url.
 	GeminiRESTBaseURL = "https://api.gemini.com/v1/"
+	// CoinGeckoRESTBaseURL is the coingecko base REST url.
+	CoinGeckoRESTBaseURL = "https://api.coingecko.com/api/v3/"
 )
 
 // Config contains config values for the app.
@@ -66,85 +68,530 @@ type Config struct {
 	Exchanges  []Exchange `json:"exchanges"`
 	Connection Connection `json:"connection"`
 	Log        Log        `json:"log"`
+	Metrics    Metrics    `json:"metrics"`
+	Alert      Alert      `json:"alert"`
+	FX         FX         `json:"fx"`
+	CoinGecko  CoinGecko  `json:"coingecko"`
+	Arbitrage  Arbitrage  `json:"arbitrage"`
+	RawArchive RawArchive `json:"raw_archive"`
 }
 
 // Exchange contains config values for different exchanges.
 type Exchange struct {
-	Name    string   `json:"name"`
-	Markets []Market `json:"markets"`
-	Retry   Retry    `json:"retry"`
+	Name      string            `json:"name"`
+	Markets   []Market          `json:"markets"`
+	Retry     Retry             `json:"retry"`
+	Websocket ExchangeWS        `json:"websocket"`
+	REST      ExchangeREST      `json:"rest"`
+	Proxy     Proxy             `json:"proxy"`
+	TLS       TLS               `json:"tls"`
+	Headers   map[string]string `json:"headers"`
+	Endpoints ExchangeEndpoints `json:"endpoints"`
+}
+
+// ExchangeEndpoints contains the alternative endpoints of an exchange, to fail over on the failure of the default ones.
+type ExchangeEndpoints struct {
+	Websocket []string `json:"websocket"`
+	REST      []string `json:"rest"`
+}
+
+// ExchangeWS contains config values for the websocket connections of an exchange.
+type ExchangeWS struct {
+	PerMessageDeflate bool   `json:"permessage_deflate"`
+	ReconnectAttempts int    `json:"reconnect_attempts"`
+	ReconnectGapSec   int    `json:"reconnect_gap_sec"`
+	MaxSubscriptions  int    `json:"max_subscriptions"`
+	MessagesPer10Sec  int    `json:"messages_per_10_sec"`
+	ReadTimeoutSec    int    `json:"read_timeout_sec"`
+	MaxMessageSizeKB  int    `json:"max_message_size_kb"`
+	FrameDecoder      string `json:"frame_decoder"`
+}
+
+// ExchangeREST contains config values for the REST API requests of an exchange.
+type ExchangeREST struct {
+	RequestsPerSec        float64 `json:"requests_per_sec"`
+	MaxConcurrentRequests int     `json:"max_concurrent_requests"`
+	JitterPercent         int     `json:"jitter_percent"`
 }
 
 // Market contains config values for different markets.
 type Market struct {
-	ID         string `json:"id"`
-	Info       []Info `json:"info"`
-	CommitName string `json:"commit_name"`
+	ID           string        `json:"id"`
+	Info         []Info        `json:"info"`
+	CommitName   string        `json:"commit_name"`
+	USDReference *USDReference `json:"usd_reference"`
+	Base         string        `json:"base"`
+	Quote        string        `json:"quote"`
+}
+
+// USDReference contains config values of the reference market used for converting the market prices to USD.
+type USDReference struct {
+	Exchange string `json:"exchange"`
+	Market   string `json:"market"`
+	Invert   bool   `json:"invert"`
 }
 
 // Info contains config values for different market channels.
 type Info struct {
-	Channel          string   `json:"channel"`
-	Connector        string   `json:"connector"`
-	WsConsiderIntSec int      `json:"websocket_consider_interval_sec"`
-	RESTPingIntSec   int      `json:"rest_ping_interval_sec"`
-	Storages         []string `json:"storages"`
+	Channel           string            `json:"channel"`
+	Connector         string            `json:"connector"`
+	WsConsiderIntSec  int               `json:"websocket_consider_interval_sec"`
+	RESTPingIntSec    int               `json:"rest_ping_interval_sec"`
+	Storages          []string          `json:"storages"`
+	StrConsiderIntSec map[string]int    `json:"storage_consider_interval_sec"`
+	CandleIntervals   []string          `json:"candle_intervals"`
+	CandleValidation  *CandleValidation `json:"candle_validation"`
+	AvgPriceWindows   []string          `json:"avg_price_windows"`
+	BookLevels        []int             `json:"book_levels"`
+	StatsIntervalSec  int               `json:"stats_interval_sec"`
+	TickFilter        *TickFilter       `json:"tick_filter"`
+	TradeFilter       *TradeFilter      `json:"trade_filter"`
+}
+
+// CandleValidation contains config values for validating the candles built from the trades
+// against the klines of the exchange.
+type CandleValidation struct {
+	TolerancePercent       float64 `json:"tolerance_percent"`
+	VolumeTolerancePercent float64 `json:"volume_tolerance_percent"`
+	DelaySec               int     `json:"delay_sec"`
+}
+
+// TradeFilter contains config values for excluding noise trades from storages.
+type TradeFilter struct {
+	MinSize  float64 `json:"min_size"`
+	Side     string  `json:"side"`
+	MinPrice float64 `json:"min_price"`
+	MaxPrice float64 `json:"max_price"`
+}
+
+// TickFilter contains config values for detecting bad ticker and trade prices.
+type TickFilter struct {
+	DeviationPercent float64 `json:"deviation_percent"`
+	Window           int     `json:"window"`
+	Action           string  `json:"action"`
 }
 
 // Retry contains config values for retry process.
 type Retry struct {
-	Number   int `json:"number"`
-	GapSec   int `json:"gap_sec"`
-	ResetSec int `json:"reset_sec"`
+	Number            int     `json:"number"`
+	GapSec            int     `json:"gap_sec"`
+	ResetSec          int     `json:"reset_sec"`
+	BackoffMultiplier float64 `json:"backoff_multiplier"`
+	MaxGapSec         int     `json:"max_gap_sec"`
+	JitterPercent     int     `json:"jitter_percent"`
+	QuarantineSec     int     `json:"quarantine_sec"`
+	NotifyURL         string  `json:"notify_url"`
 }
 
 // Connection contains config values for different API and storage connections.
 type Connection struct {
-	WS       WS       `json:"websocket"`
-	REST     REST     `json:"rest"`
-	Terminal Terminal `json:"terminal"`
-	MySQL    MySQL    `json:"mysql"`
-	ES       ES       `json:"elastic_search"`
+	WS            WS                           `json:"websocket"`
+	REST          REST                         `json:"rest"`
+	Proxy         Proxy                        `json:"proxy"`
+	TLS           TLS                          `json:"tls"`
+	Headers       map[string]string            `json:"headers"`
+	Terminal      Terminal                     `json:"terminal"`
+	MySQL         MySQL                        `json:"mysql"`
+	ES            ES                           `json:"elastic_search"`
+	UDS           UDS                          `json:"uds"`
+	Timescale     Timescale                    `json:"timescale"`
+	ClickHouse    ClickHouse                   `json:"clickhouse"`
+	QuestDB       QuestDB                      `json:"questdb"`
+	Redis         Redis                        `json:"redis"`
+	SQLite        SQLite                       `json:"sqlite"`
+	Parquet       Parquet                      `json:"parquet"`
+	File          File                         `json:"file"`
+	S3            S3                           `json:"s3"`
+	BigQuery      BigQuery                     `json:"bigquery"`
+	Kinesis       Kinesis                      `json:"kinesis"`
+	MQTT          MQTT                         `json:"mqtt"`
+	Cassandra     Cassandra                    `json:"cassandra"`
+	TDengine      TDengine                     `json:"tdengine"`
+	RemoteWrite   RemoteWrite                  `json:"remote_write"`
+	EventHubs     EventHubs                    `json:"event_hubs"`
+	Snowflake     Snowflake                    `json:"snowflake"`
+	Delta         Delta                        `json:"delta"`
+	RedisTS       RedisTimeSeries              `json:"redis_timeseries"`
+	CrateDB       CrateDB                      `json:"cratedb"`
+	OpenSearch    OpenSearch                   `json:"opensearch"`
+	Timestream    Timestream                   `json:"timestream"`
+	GRPC          GRPC                         `json:"grpc"`
+	ZeroMQ        ZeroMQ                       `json:"zeromq"`
+	WSServer      WSServer                     `json:"ws_server"`
+	Plugins       []Plugin                     `json:"plugins"`
+	Retry         map[string]StorageRetry      `json:"storage_retry"`
+	FlushIntSec   map[string]int               `json:"storage_flush_interval_sec"`
+	CommitWorkers map[string]int               `json:"storage_commit_workers"`
+	Ordered       map[string]bool              `json:"storage_ordered_commits"`
+	Backpressure  map[string]string            `json:"storage_backpressure"`
+	ChannelBuf    map[string]int               `json:"storage_channel_buffer"`
+	Failover      map[string]StorageFailover   `json:"storage_failover"`
+	WAL           map[string]StorageWAL        `json:"storage_wal"`
+	Retention     map[string]StorageRetention  `json:"storage_retention"`
+	Compaction    map[string]StorageCompaction `json:"storage_compaction"`
 }
 
 // WS contains config values for websocket connection.
 type WS struct {
-	ConnTimeoutSec int `json:"conn_timeout_sec"`
-	ReadTimeoutSec int `json:"read_timeout_sec"`
+	ConnTimeoutSec   int `json:"conn_timeout_sec"`
+	ReadTimeoutSec   int `json:"read_timeout_sec"`
+	MaxMessageSizeKB int `json:"max_message_size_kb"`
+}
+
+// Proxy contains config values for connecting to the exchanges through a proxy.
+type Proxy struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// TLS contains config values for the TLS of the exchange connections.
+type TLS struct {
+	CACertFile string   `json:"ca_cert_file"`
+	MinVersion string   `json:"min_version"`
+	PinnedKeys []string `json:"pinned_keys"`
 }
 
 // REST contains config values for REST API connection.
 type REST struct {
-	ReqTimeoutSec       int `json:"request_timeout_sec"`
-	MaxIdleConns        int `json:"max_idle_conns"`
-	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host"`
+	ReqTimeoutSec            int  `json:"request_timeout_sec"`
+	MaxIdleConns             int  `json:"max_idle_conns"`
+	MaxIdleConnsPerHost      int  `json:"max_idle_conns_per_host"`
+	DialTimeoutSec           int  `json:"dial_timeout_sec"`
+	TLSHandshakeTimeoutSec   int  `json:"tls_handshake_timeout_sec"`
+	ResponseHeaderTimeoutSec int  `json:"response_header_timeout_sec"`
+	IdleConnTimeoutSec       int  `json:"idle_conn_timeout_sec"`
+	KeepAliveSec             int  `json:"keep_alive_sec"`
+	DisableKeepAlives        bool `json:"disable_keep_alives"`
+	DisableHTTP2             bool `json:"disable_http2"`
+	BreakerFailures          int  `json:"breaker_failures"`
+	BreakerOpenSec           int  `json:"breaker_open_sec"`
 }
 
 // Terminal contains config values for terminal display.
 type Terminal struct {
-	TickerCommitBuf int `json:"ticker_commit_buffer"`
-	TradeCommitBuf  int `json:"trade_commit_buffer"`
+	Format                 string `json:"format"`
+	TUI                    bool   `json:"tui"`
+	TUIRefreshIntSec       int    `json:"tui_refresh_interval_sec"`
+	TickerCommitBuf        int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf         int    `json:"trade_commit_buffer"`
+	MarkPriceCommitBuf     int    `json:"mark_price_commit_buffer"`
+	BBOCommitBuf           int    `json:"bbo_commit_buffer"`
+	BlockTradeCommitBuf    int    `json:"block_trade_commit_buffer"`
+	TradingStatusCommitBuf int    `json:"trading_status_commit_buffer"`
+	AggTradeCommitBuf      int    `json:"agg_trade_commit_buffer"`
+	OrderFlowCommitBuf     int    `json:"orderflow_commit_buffer"`
+	InstrumentCommitBuf    int    `json:"instrument_commit_buffer"`
+	CandleCommitBuf        int    `json:"candle_commit_buffer"`
+	AvgPriceCommitBuf      int    `json:"avg_price_commit_buffer"`
+	BookMetricCommitBuf    int    `json:"book_metric_commit_buffer"`
+	MarketStatsCommitBuf   int    `json:"market_stats_commit_buffer"`
 }
 
 // MySQL contains config values for mysql.
 type MySQL struct {
-	User               string `josn:"user"`
+	User                   string   `josn:"user"`
+	Password               string   `json:"password"`
+	URL                    string   `json:"URL"`
+	Schema                 string   `json:"schema"`
+	CreateSchema           bool     `json:"create_schema"`
+	Names                  Names    `json:"names"`
+	ReqTimeoutSec          int      `json:"request_timeout_sec"`
+	ConnMaxLifetimeSec     int      `json:"conn_max_lifetime_sec"`
+	ConnMaxIdleTimeSec     int      `json:"conn_max_idle_time_sec"`
+	MaxOpenConns           int      `json:"max_open_conns"`
+	MaxIdleConns           int      `json:"max_idle_conns"`
+	TLS                    bool     `json:"tls"`
+	CACertFile             string   `json:"ca_cert_file"`
+	CertFile               string   `json:"cert_file"`
+	KeyFile                string   `json:"key_file"`
+	ServerName             string   `json:"server_name"`
+	InsecureSkipVerify     bool     `json:"insecure_skip_verify"`
+	MinTLSVersion          string   `json:"min_tls_version"`
+	PinnedKeys             []string `json:"pinned_keys"`
+	TimestampPrecision     string   `json:"timestamp_precision"`
+	Timezone               string   `json:"timezone"`
+	Migrate                bool     `json:"migrate"`
+	Partition              string   `json:"partition"`
+	PartitionAhead         int      `json:"partition_ahead"`
+	PartitionRetention     int      `json:"partition_retention"`
+	TickerCommitBuf        int      `json:"ticker_commit_buffer"`
+	TradeCommitBuf         int      `json:"trade_commit_buffer"`
+	MarkPriceCommitBuf     int      `json:"mark_price_commit_buffer"`
+	BBOCommitBuf           int      `json:"bbo_commit_buffer"`
+	BlockTradeCommitBuf    int      `json:"block_trade_commit_buffer"`
+	TradingStatusCommitBuf int      `json:"trading_status_commit_buffer"`
+	AggTradeCommitBuf      int      `json:"agg_trade_commit_buffer"`
+	InstrumentCommitBuf    int      `json:"instrument_commit_buffer"`
+	CandleCommitBuf        int      `json:"candle_commit_buffer"`
+	AvgPriceCommitBuf      int      `json:"avg_price_commit_buffer"`
+	BookMetricCommitBuf    int      `json:"book_metric_commit_buffer"`
+	MarketStatsCommitBuf   int      `json:"market_stats_commit_buffer"`
+}
+
+// Timescale contains config values for timescale database.
+type Timescale struct {
+	User               string `json:"user"`
 	Password           string `json:"password"`
 	URL                string `json:"URL"`
 	Schema             string `json:"schema"`
+	SSLMode            string `json:"sslmode"`
 	ReqTimeoutSec      int    `json:"request_timeout_sec"`
 	ConnMaxLifetimeSec int    `json:"conn_max_lifetime_sec"`
 	MaxOpenConns       int    `json:"max_open_conns"`
 	MaxIdleConns       int    `json:"max_idle_conns"`
+	ChunkIntervalHours int    `json:"chunk_interval_hours"`
+	CompressAfterHours int    `json:"compress_after_hours"`
 	TickerCommitBuf    int    `json:"ticker_commit_buffer"`
 	TradeCommitBuf     int    `json:"trade_commit_buffer"`
 }
 
-// ES contains config values for elastic search.
-type ES struct {
+// ClickHouse contains config values for clickhouse.
+type ClickHouse struct {
+	User               string `json:"user"`
+	Password           string `json:"password"`
+	URL                string `json:"URL"`
+	Schema             string `json:"schema"`
+	Compress           bool   `json:"compress"`
+	ReqTimeoutSec      int    `json:"request_timeout_sec"`
+	ConnMaxLifetimeSec int    `json:"conn_max_lifetime_sec"`
+	MaxOpenConns       int    `json:"max_open_conns"`
+	MaxIdleConns       int    `json:"max_idle_conns"`
+	TickerCommitBuf    int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf     int    `json:"trade_commit_buffer"`
+}
+
+// QuestDB contains config values for questdb.
+type QuestDB struct {
+	URL             string `json:"URL"`
+	ReqTimeoutSec   int    `json:"request_timeout_sec"`
+	TickerCommitBuf int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf  int    `json:"trade_commit_buffer"`
+}
+
+// Redis contains config values for redis streams.
+type Redis struct {
+	URL             string `json:"URL"`
+	User            string `json:"user"`
+	Password        string `json:"password"`
+	DB              int    `json:"db"`
+	TickerStream    string `json:"ticker_stream"`
+	TradeStream     string `json:"trade_stream"`
+	MaxLen          int64  `json:"max_len"`
+	BatchEntry      bool   `json:"batch_entry"`
+	ReqTimeoutSec   int    `json:"request_timeout_sec"`
+	TickerCommitBuf int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf  int    `json:"trade_commit_buffer"`
+}
+
+// RedisTimeSeries contains config values for redis time series.
+type RedisTimeSeries struct {
+	URL             string   `json:"URL"`
+	User            string   `json:"user"`
+	Password        string   `json:"password"`
+	DB              int      `json:"db"`
+	KeyPrefix       string   `json:"key_prefix"`
+	Fields          []string `json:"fields"`
+	RetentionSec    int      `json:"retention_sec"`
+	ReqTimeoutSec   int      `json:"request_timeout_sec"`
+	TickerCommitBuf int      `json:"ticker_commit_buffer"`
+}
+
+// SQLite contains config values for sqlite.
+type SQLite struct {
+	FilePath        string `json:"file_path"`
+	Synchronous     string `json:"synchronous"`
+	ReqTimeoutSec   int    `json:"request_timeout_sec"`
+	TickerCommitBuf int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf  int    `json:"trade_commit_buffer"`
+}
+
+// Parquet contains config values for parquet files.
+type Parquet struct {
+	Dir               string `json:"dir"`
+	RotateIntervalMin int    `json:"rotate_interval_min"`
+	MaxFileSizeMB     int    `json:"max_file_size_mb"`
+	Compression       string `json:"compression"`
+	TickerCommitBuf   int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf    int    `json:"trade_commit_buffer"`
+}
+
+// File contains config values for CSV and JSONL files.
+type File struct {
+	Dir               string `json:"dir"`
+	Format            string `json:"format"`
+	Layout            string `json:"layout"`
+	RotateIntervalMin int    `json:"rotate_interval_min"`
+	MaxFileSizeMB     int    `json:"max_file_size_mb"`
+	Gzip              bool   `json:"gzip"`
+	TickerCommitBuf   int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf    int    `json:"trade_commit_buffer"`
+}
+
+// S3 contains config values for s3 compatible object storage.
+type S3 struct {
+	Bucket            string `json:"bucket"`
+	Region            string `json:"region"`
+	Endpoint          string `json:"endpoint"`
+	AccessKeyID       string `json:"access_key_id"`
+	SecretAccessKey   string `json:"secret_access_key"`
+	ForcePathStyle    bool   `json:"force_path_style"`
+	Prefix            string `json:"prefix"`
+	Layout            string `json:"layout"`
+	Format            string `json:"format"`
+	UploadIntervalMin int    `json:"upload_interval_min"`
+	MaxObjectSizeMB   int    `json:"max_object_size_mb"`
+	PartSizeMB        int    `json:"part_size_mb"`
+	MaxRetries        int    `json:"max_retries"`
+	ReqTimeoutSec     int    `json:"request_timeout_sec"`
+	TickerCommitBuf   int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf    int    `json:"trade_commit_buffer"`
+}
+
+// BigQuery contains config values for bigquery.
+type BigQuery struct {
+	ProjectID       string `json:"project_id"`
+	Dataset         string `json:"dataset"`
+	CredentialsFile string `json:"credentials_file"`
+	TickerTable     string `json:"ticker_table"`
+	TradeTable      string `json:"trade_table"`
+	ReqTimeoutSec   int    `json:"request_timeout_sec"`
+	TickerCommitBuf int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf  int    `json:"trade_commit_buffer"`
+}
+
+// Kinesis contains config values for kinesis data stream.
+type Kinesis struct {
+	StreamName      string `json:"stream_name"`
+	Region          string `json:"region"`
+	Endpoint        string `json:"endpoint"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	Aggregate       bool   `json:"aggregate"`
+	MaxRetries      int    `json:"max_retries"`
+	ReqTimeoutSec   int    `json:"request_timeout_sec"`
+	TickerCommitBuf int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf  int    `json:"trade_commit_buffer"`
+}
+
+// MQTT contains config values for mqtt broker.
+type MQTT struct {
+	URL             string `json:"URL"`
+	ClientID        string `json:"client_id"`
+	Username        string `json:"username"`
+	Password        string `json:"password"`
+	Topic           string `json:"topic"`
+	QoS             byte   `json:"qos"`
+	Retain          bool   `json:"retain"`
+	ReqTimeoutSec   int    `json:"request_timeout_sec"`
+	TickerCommitBuf int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf  int    `json:"trade_commit_buffer"`
+}
+
+// Cassandra contains config values for cassandra or scylladb.
+type Cassandra struct {
+	Hosts           []string `json:"hosts"`
+	Keyspace        string   `json:"keyspace"`
+	Username        string   `json:"username"`
+	Password        string   `json:"password"`
+	Consistency     string   `json:"consistency"`
+	LocalDC         string   `json:"local_dc"`
+	Bucket          string   `json:"bucket"`
+	ReqTimeoutSec   int      `json:"request_timeout_sec"`
+	TickerCommitBuf int      `json:"ticker_commit_buffer"`
+	TradeCommitBuf  int      `json:"trade_commit_buffer"`
+}
+
+// TDengine contains config values for tdengine.
+type TDengine struct {
+	URL             string `json:"URL"`
+	User            string `json:"user"`
+	Password        string `json:"password"`
+	Database        string `json:"database"`
+	ReqTimeoutSec   int    `json:"request_timeout_sec"`
+	TickerCommitBuf int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf  int    `json:"trade_commit_buffer"`
+}
+
+// RemoteWrite contains config values for prometheus remote write.
+type RemoteWrite struct {
+	URL             string            `json:"URL"`
+	Username        string            `json:"username"`
+	Password        string            `json:"password"`
+	BearerToken     string            `json:"bearer_token"`
+	MetricPrefix    string            `json:"metric_prefix"`
+	Labels          map[string]string `json:"labels"`
+	MaxRetries      int               `json:"max_retries"`
+	ReqTimeoutSec   int               `json:"request_timeout_sec"`
+	TickerCommitBuf int               `json:"ticker_commit_buffer"`
+}
+
+// EventHubs contains config values for azure event hubs.
+type EventHubs struct {
+	ConnectionString string `json:"connection_string"`
+	HubName          string `json:"hub_name"`
+	WebSocket        bool   `json:"websocket"`
+	MaxRetries       int    `json:"max_retries"`
+	ReqTimeoutSec    int    `json:"request_timeout_sec"`
+	TickerCommitBuf  int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf   int    `json:"trade_commit_buffer"`
+}
+
+// Snowflake contains config values for snowflake.
+type Snowflake struct {
+	Account         string `json:"account"`
+	User            string `json:"user"`
+	Password        string `json:"password"`
+	Database        string `json:"database"`
+	Schema          string `json:"schema"`
+	Warehouse       string `json:"warehouse"`
+	Role            string `json:"role"`
+	ReqTimeoutSec   int    `json:"request_timeout_sec"`
+	TickerCommitBuf int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf  int    `json:"trade_commit_buffer"`
+}
+
+// Delta contains config values for delta lake tables on s3 compatible storage.
+type Delta struct {
+	Bucket            string `json:"bucket"`
+	Region            string `json:"region"`
+	Endpoint          string `json:"endpoint"`
+	AccessKeyID       string `json:"access_key_id"`
+	SecretAccessKey   string `json:"secret_access_key"`
+	ForcePathStyle    bool   `json:"force_path_style"`
+	Path              string `json:"path"`
+	CommitIntervalMin int    `json:"commit_interval_min"`
+	MaxRetries        int    `json:"max_retries"`
+	ReqTimeoutSec     int    `json:"request_timeout_sec"`
+	TickerCommitBuf   int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf    int    `json:"trade_commit_buffer"`
+}
+
+// CrateDB contains config values for cratedb.
+type CrateDB struct {
+	User               string `json:"user"`
+	Password           string `json:"password"`
+	URL                string `json:"URL"`
+	Schema             string `json:"schema"`
+	SSLMode            string `json:"sslmode"`
+	Partition          string `json:"partition"`
+	Shards             int    `json:"shards"`
+	Replicas           string `json:"replicas"`
+	ReqTimeoutSec      int    `json:"request_timeout_sec"`
+	ConnMaxLifetimeSec int    `json:"conn_max_lifetime_sec"`
+	MaxOpenConns       int    `json:"max_open_conns"`
+	MaxIdleConns       int    `json:"max_idle_conns"`
+	TickerCommitBuf    int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf     int    `json:"trade_commit_buffer"`
+}
+
+// OpenSearch contains config values for opensearch.
+type OpenSearch struct {
 	Addresses           []string `json:"addresses"`
 	Username            string   `json:"username"`
 	Password            string   `json:"password"`
+	AWSSigV4            bool     `json:"aws_sigv4"`
+	AWSRegion           string   `json:"aws_region"`
 	IndexName           string   `json:"index_name"`
 	ReqTimeoutSec       int      `json:"request_timeout_sec"`
 	MaxIdleConns        int      `json:"max_idle_conns"`
@@ -153,8 +600,250 @@ type ES struct {
 	TradeCommitBuf      int      `json:"trade_commit_buffer"`
 }
 
+// Timestream contains config values for amazon timestream.
+type Timestream struct {
+	Database              string `json:"database"`
+	Region                string `json:"region"`
+	AccessKeyID           string `json:"access_key_id"`
+	SecretAccessKey       string `json:"secret_access_key"`
+	MemoryRetentionHours  int    `json:"memory_retention_hours"`
+	MagneticRetentionDays int    `json:"magnetic_retention_days"`
+	MaxRetries            int    `json:"max_retries"`
+	ReqTimeoutSec         int    `json:"request_timeout_sec"`
+	TickerCommitBuf       int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf        int    `json:"trade_commit_buffer"`
+}
+
+// GRPC contains config values for grpc stream.
+type GRPC struct {
+	Address            string            `json:"address"`
+	Method             string            `json:"method"`
+	Metadata           map[string]string `json:"metadata"`
+	TLS                bool              `json:"tls"`
+	CACertFile         string            `json:"ca_cert_file"`
+	ServerName         string            `json:"server_name"`
+	InsecureSkipVerify bool              `json:"insecure_skip_verify"`
+	MinTLSVersion      string            `json:"min_tls_version"`
+	PinnedKeys         []string          `json:"pinned_keys"`
+	ReqTimeoutSec      int               `json:"request_timeout_sec"`
+	TickerCommitBuf    int               `json:"ticker_commit_buffer"`
+	TradeCommitBuf     int               `json:"trade_commit_buffer"`
+}
+
+// ZeroMQ contains config values for zeromq publisher.
+type ZeroMQ struct {
+	Endpoint        string `json:"endpoint"`
+	Connect         bool   `json:"connect"`
+	TopicPrefix     string `json:"topic_prefix"`
+	ReqTimeoutSec   int    `json:"request_timeout_sec"`
+	TickerCommitBuf int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf  int    `json:"trade_commit_buffer"`
+}
+
+// WSServer contains config values for websocket broadcast server.
+type WSServer struct {
+	Address         string `json:"address"`
+	Path            string `json:"path"`
+	MaxClients      int    `json:"max_clients"`
+	WriteTimeoutSec int    `json:"write_timeout_sec"`
+	TickerCommitBuf int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf  int    `json:"trade_commit_buffer"`
+}
+
+// Plugin contains config values for external storage plugin.
+type Plugin struct {
+	Name            string   `json:"name"`
+	Path            string   `json:"path"`
+	Args            []string `json:"args"`
+	Address         string   `json:"address"`
+	StartTimeoutSec int      `json:"start_timeout_sec"`
+	ReqTimeoutSec   int      `json:"request_timeout_sec"`
+	TickerCommitBuf int      `json:"ticker_commit_buffer"`
+	TradeCommitBuf  int      `json:"trade_commit_buffer"`
+}
+
+// StorageRetry contains config values for retrying the failed ticker and trade commits of a storage.
+type StorageRetry struct {
+	Number            int     `json:"number"`
+	GapSec            int     `json:"gap_sec"`
+	BackoffMultiplier float64 `json:"backoff_multiplier"`
+	MaxGapSec         int     `json:"max_gap_sec"`
+	DeadLetterDir     string  `json:"dead_letter_dir"`
+}
+
+// StorageWAL contains config values for spooling the failed ticker and trade commits of a storage to disk.
+type StorageWAL struct {
+	Dir          string `json:"dir"`
+	ReplayIntSec int    `json:"replay_interval_sec"`
+	MaxSizeMB    int    `json:"max_size_mb"`
+}
+
+// StorageFailover contains config values for the fallback storage of a storage.
+type StorageFailover struct {
+	Storage     string `json:"storage"`
+	CheckIntSec int    `json:"check_interval_sec"`
+}
+
+// StorageRetention contains config values for deleting the old data of a storage.
+// Max age is keyed by the channel.
+type StorageRetention struct {
+	IntervalMin int            `json:"interval_min"`
+	MaxAgeHours map[string]int `json:"max_age_hours"`
+}
+
+// StorageCompaction contains config values for compacting the old raw data of a storage into minute candles.
+type StorageCompaction struct {
+	IntervalMin int      `json:"interval_min"`
+	AfterDays   int      `json:"after_days"`
+	Channels    []string `json:"channels"`
+	DeleteRaw   bool     `json:"delete_raw"`
+}
+
+// Names contains the table (index in case of elastic search) and field names overriding the default ones of a storage,
+// keyed by the default names, so that the data can be written to an existing schema.
+type Names struct {
+	Tables map[string]string `json:"tables"`
+	Fields map[string]string `json:"fields"`
+}
+
+// ES contains config values for elastic search.
+type ES struct {
+	Addresses              []string `json:"addresses"`
+	CloudID                string   `json:"cloud_id"`
+	Username               string   `json:"username"`
+	Password               string   `json:"password"`
+	APIKey                 string   `json:"api_key"`
+	CACertFile             string   `json:"ca_cert_file"`
+	CertFile               string   `json:"cert_file"`
+	KeyFile                string   `json:"key_file"`
+	InsecureSkipVerify     bool     `json:"insecure_skip_verify"`
+	MinTLSVersion          string   `json:"min_tls_version"`
+	PinnedKeys             []string `json:"pinned_keys"`
+	AWSSigV4               bool     `json:"aws_sigv4"`
+	AWSRegion              string   `json:"aws_region"`
+	IndexName              string   `json:"index_name"`
+	Names                  Names    `json:"names"`
+	IndexSuffix            string   `json:"index_suffix"`
+	CreateIndices          bool     `json:"create_indices"`
+	ILMDeleteAfterDays     int      `json:"ilm_delete_after_days"`
+	DeterministicIDs       bool     `json:"deterministic_ids"`
+	ReqTimeoutSec          int      `json:"request_timeout_sec"`
+	MaxIdleConns           int      `json:"max_idle_conns"`
+	MaxIdleConnsPerHost    int      `json:"max_idle_conns_per_host"`
+	Compress               bool     `json:"compress"`
+	BulkWorkers            int      `json:"bulk_workers"`
+	BulkFlushSizeKB        int      `json:"bulk_flush_size_kb"`
+	TickerCommitBuf        int      `json:"ticker_commit_buffer"`
+	TradeCommitBuf         int      `json:"trade_commit_buffer"`
+	MarkPriceCommitBuf     int      `json:"mark_price_commit_buffer"`
+	BBOCommitBuf           int      `json:"bbo_commit_buffer"`
+	BlockTradeCommitBuf    int      `json:"block_trade_commit_buffer"`
+	TradingStatusCommitBuf int      `json:"trading_status_commit_buffer"`
+	AggTradeCommitBuf      int      `json:"agg_trade_commit_buffer"`
+	OrderFlowCommitBuf     int      `json:"orderflow_commit_buffer"`
+	InstrumentCommitBuf    int      `json:"instrument_commit_buffer"`
+	CandleCommitBuf        int      `json:"candle_commit_buffer"`
+	AvgPriceCommitBuf      int      `json:"avg_price_commit_buffer"`
+	BookMetricCommitBuf    int      `json:"book_metric_commit_buffer"`
+	MarketStatsCommitBuf   int      `json:"market_stats_commit_buffer"`
+}
+
+// UDS contains config values for unix domain socket output.
+type UDS struct {
+	SocketPath             string `json:"socket_path"`
+	WriteTimeoutSec        int    `json:"write_timeout_sec"`
+	TickerCommitBuf        int    `json:"ticker_commit_buffer"`
+	TradeCommitBuf         int    `json:"trade_commit_buffer"`
+	MarkPriceCommitBuf     int    `json:"mark_price_commit_buffer"`
+	BBOCommitBuf           int    `json:"bbo_commit_buffer"`
+	BlockTradeCommitBuf    int    `json:"block_trade_commit_buffer"`
+	TradingStatusCommitBuf int    `json:"trading_status_commit_buffer"`
+	AggTradeCommitBuf      int    `json:"agg_trade_commit_buffer"`
+	OrderFlowCommitBuf     int    `json:"orderflow_commit_buffer"`
+	InstrumentCommitBuf    int    `json:"instrument_commit_buffer"`
+	CandleCommitBuf        int    `json:"candle_commit_buffer"`
+	AvgPriceCommitBuf      int    `json:"avg_price_commit_buffer"`
+	BookMetricCommitBuf    int    `json:"book_metric_commit_buffer"`
+	MarketStatsCommitBuf   int    `json:"market_stats_commit_buffer"`
+}
+
 // Log contains config values for logging.
 type Log struct {
 	Level    string `json:"level"`
 	FilePath string `json:"file_path"`
 }
+
+// FX contains config values for fetching fiat exchange rates.
+type FX struct {
+	Enabled       bool     `json:"enabled"`
+	URL           string   `json:"url"`
+	Currencies    []string `json:"currencies"`
+	RefreshIntSec int      `json:"refresh_interval_sec"`
+	Storages      []string `json:"storages"`
+	Retry         Retry    `json:"retry"`
+}
+
+// CoinGecko contains config values for fetching coin reference data.
+type CoinGecko struct {
+	Enabled       bool              `json:"enabled"`
+	URL           string            `json:"url"`
+	Coins         map[string]string `json:"coins"`
+	RefreshIntSec int               `json:"refresh_interval_sec"`
+	Storages      []string          `json:"storages"`
+	Retry         Retry             `json:"retry"`
+}
+
+// Alert contains config values for posting price anomaly alerts to a webhook.
+type Alert struct {
+	Enabled       bool        `json:"enabled"`
+	WebhookURL    string      `json:"webhook_url"`
+	ReqTimeoutSec int         `json:"request_timeout_sec"`
+	CooldownSec   int         `json:"cooldown_sec"`
+	Rules         []AlertRule `json:"rules"`
+}
+
+// AlertRule contains config values of a single price anomaly check.
+type AlertRule struct {
+	Exchange         string  `json:"exchange"`
+	Market           string  `json:"market"`
+	MovePercent      float64 `json:"move_percent"`
+	WindowSec        int     `json:"window_sec"`
+	CompareExchange  string  `json:"compare_exchange"`
+	CompareMarket    string  `json:"compare_market"`
+	DeviationPercent float64 `json:"deviation_percent"`
+}
+
+// Arbitrage contains config values for monitoring the spread of the same market across exchanges.
+type Arbitrage struct {
+	Enabled     bool            `json:"enabled"`
+	MaxAgeSec   int             `json:"max_price_age_sec"`
+	CooldownSec int             `json:"cooldown_sec"`
+	Storages    []string        `json:"storages"`
+	Rules       []ArbitrageRule `json:"rules"`
+}
+
+// ArbitrageRule contains config values of a single market spread check.
+type ArbitrageRule struct {
+	Base             string   `json:"base"`
+	Quote            string   `json:"quote"`
+	Exchanges        []string `json:"exchanges"`
+	ThresholdPercent float64  `json:"threshold_percent"`
+	Alert            bool     `json:"alert"`
+}
+
+// Metrics contains config values for exposing app metrics.
+type Metrics struct {
+	Enabled bool   `json:"enabled"`
+	Address string `json:"address"`
+	Path    string `json:"path"`
+	Latency bool   `json:"latency"`
+}
+
+// RawArchive contains config values for archiving raw websocket frames.
+type RawArchive struct {
+	Enabled           bool   `json:"enabled"`
+	Dir               string `json:"dir"`
+	RotateIntervalMin int    `json:"rotate_interval_min"`
+	MaxFileSizeMB     int    `json:"max_file_size_mb"`
+	FlushIntervalSec  int    `json:"flush_interval_sec"`
+}
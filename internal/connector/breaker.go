@@ -0,0 +1,173 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Default values, if not configured.
+const (
+	restBreakerFailures = 5
+	restBreakerOpenSec  = 60
+	restRetryBackoff    = time.Second
+)
+
+// restBreakerCfg is the number of consecutive failures opening the circuit breakers and the time they stay open.
+// It is set only while starting the app, so it is not guarded for concurrent access.
+var restBreakerCfg = struct {
+	failures int
+	open     time.Duration
+}{restBreakerFailures, restBreakerOpenSec * time.Second}
+
+// restBreakers holds the circuit breaker of each REST host, which is created on its first request.
+var restBreakers = struct {
+	sync.Mutex
+	m map[string]*restBreaker
+}{m: make(map[string]*restBreaker)}
+
+// breakerOf returns the circuit breaker of the host.
+func breakerOf(host string) *restBreaker {
+	restBreakers.Lock()
+	defer restBreakers.Unlock()
+	b, ok := restBreakers.m[host]
+	if !ok {
+		b = &restBreaker{host: host, reset: make(chan struct{})}
+		restBreakers.m[host] = b
+	}
+	return b
+}
+
+// restBreaker holds back the requests to a REST host which is throttling or failing,
+// instead of failing them, so that the exchange is not restarted and the polling is slowed down till the host recovers.
+// Requests are held back for the Retry-After time of the response, if any,
+// otherwise for a backoff time doubling on each consecutive failure.
+// After the configured number of consecutive failures, the circuit is opened
+// and the requests are held back for the open time, after which only one request probes the host
+// and the circuit is closed on its success.
+type restBreaker struct {
+	host     string
+	mu       sync.Mutex
+	failures int
+	open     bool
+	until    time.Time
+	reset    chan struct{}
+}
+
+// wait blocks till a request is allowed by the breaker, or the context is done.
+func (b *restBreaker) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		delay := time.Until(b.until)
+		if delay <= 0 {
+			if b.open {
+				// Only this request probes the host, others are held back for one more open time unless it succeeds.
+				b.until = time.Now().Add(restBreakerCfg.open)
+			}
+			b.mu.Unlock()
+			return nil
+		}
+		reset := b.reset
+		b.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-reset:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// success closes the circuit, letting all the held back requests through.
+func (b *restBreaker) success() {
+	b.mu.Lock()
+	if b.failures == 0 {
+		b.mu.Unlock()
+		return
+	}
+	wasOpen := b.open
+	b.failures = 0
+	b.open = false
+	b.until = time.Time{}
+	close(b.reset)
+	b.reset = make(chan struct{})
+	b.mu.Unlock()
+	if wasOpen {
+		metrics.RESTCircuitOpen.WithLabelValues(b.host).Set(0)
+		log.Info().Str("host", b.host).Msg("REST circuit breaker closed")
+	}
+}
+
+// failure holds back the requests after the error, if it is a throttling or server side one,
+// and tells whether the request should be retried.
+// Response of any other status closes the circuit, as the host is answering the requests.
+func (b *restBreaker) failure(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	if !breakerFailure(statusErr.Code) {
+		b.success()
+		return false
+	}
+	metrics.RESTBackoffs.WithLabelValues(b.host, strconv.Itoa(statusErr.Code)).Inc()
+
+	b.mu.Lock()
+	b.failures++
+	opened := false
+	delay := restBreakerCfg.open
+	if b.failures >= restBreakerCfg.failures {
+		opened = !b.open
+		b.open = true
+	} else if backoff := restRetryBackoff << (b.failures - 1); backoff < delay {
+		delay = backoff
+	}
+	if statusErr.RetryAfter > delay {
+		delay = statusErr.RetryAfter
+	}
+	b.until = time.Now().Add(delay)
+	failures := b.failures
+	b.mu.Unlock()
+
+	if opened {
+		metrics.RESTCircuitOpen.WithLabelValues(b.host).Set(1)
+		log.Warn().Str("host", b.host).Int("failures", failures).Err(err).Dur("open", delay).Msg("REST circuit breaker opened")
+	} else {
+		log.Warn().Str("host", b.host).Int("failures", failures).Err(err).Dur("backoff", delay).Msg("REST request backed off")
+	}
+	return true
+}
+
+// breakerFailure tells whether the status code is of throttling,
+// 429 Too Many Requests or 418 as used by some exchanges for a ban after the repeated ones,
+// or of a server side error.
+func breakerFailure(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusTeapot || code >= http.StatusInternalServerError
+}
+
+// retryAfter parses the Retry-After header value, which is either the seconds or the http date to retry after.
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(value); err == nil {
+		if sec < 0 {
+			return 0
+		}
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestRetryAfter tests the parsing of the Retry-After header, in seconds or as an http date.
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"empty", "", 0, 0},
+		{"seconds", "120", 120 * time.Second, 120 * time.Second},
+		{"zero seconds", "0", 0, 0},
+		{"negative seconds", "-5", 0, 0},
+		{"http date", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{"past http date", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), -2 * time.Minute, 0},
+		{"invalid", "soon", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Log("ERROR : "+tt.name+" : retry after", got, "expected between", tt.min, "and", tt.max)
+			t.Error("FAILURE : retry after header")
+		}
+	}
+}
+
+// TestRestBreaker tests the backoff of the REST requests to the host on the failure status codes,
+// the opening of the breaker after the consecutive failures and the release on success.
+func TestRestBreaker(t *testing.T) {
+	codes := map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusBadRequest:          false,
+		http.StatusNotFound:            false,
+		http.StatusTeapot:              true,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusServiceUnavailable:  true,
+	}
+	for code, want := range codes {
+		if got := breakerFailure(code); got != want {
+			t.Log("ERROR : status code", code, "breaker failure", got, "expected", want)
+			t.Error("FAILURE : rest breaker")
+		}
+	}
+
+	badGateway := &StatusError{Code: http.StatusBadGateway}
+	tooMany := &StatusError{Code: http.StatusTooManyRequests}
+	tests := []struct {
+		name string
+		errs []error
+
+		// Expected state after the last error.
+		retry    bool
+		failures int
+		open     bool
+		delay    time.Duration
+	}{
+		{"not a status error", []error{errors.New("connection reset")}, false, 0, false, 0},
+		{"client error", []error{&StatusError{Code: http.StatusBadRequest}}, false, 0, false, 0},
+		{"first failure", []error{&StatusError{Code: http.StatusServiceUnavailable}}, true, 1, false, restRetryBackoff},
+		{"backoff doubles", []error{tooMany, tooMany, tooMany}, true, 3, false, 4 * restRetryBackoff},
+		{
+			"retry after longer than backoff",
+			[]error{&StatusError{Code: http.StatusTooManyRequests, RetryAfter: 30 * time.Second}},
+			true, 1, false, 30 * time.Second,
+		},
+		{
+			"opens after consecutive failures",
+			[]error{badGateway, badGateway, badGateway, badGateway, badGateway},
+			true, 5, true, restBreakerOpenSec * time.Second,
+		},
+		{"client error closes", []error{badGateway, badGateway, &StatusError{Code: http.StatusNotFound}}, false, 0, false, 0},
+	}
+	for _, tt := range tests {
+		b := &restBreaker{host: "test", reset: make(chan struct{})}
+		var retry bool
+		start := time.Now()
+		for _, err := range tt.errs {
+			retry = b.failure(err)
+		}
+		if retry != tt.retry || b.failures != tt.failures || b.open != tt.open {
+			t.Log("ERROR : "+tt.name+" : retry", retry, "failures", b.failures, "open", b.open,
+				"expected", tt.retry, tt.failures, tt.open)
+			t.Error("FAILURE : rest breaker")
+		}
+		if tt.delay > 0 {
+			if delay := b.until.Sub(start); delay < tt.delay || delay > tt.delay+time.Second {
+				t.Log("ERROR : "+tt.name+" : held back for", delay, "expected", tt.delay)
+				t.Error("FAILURE : rest breaker")
+			}
+		} else if !b.until.IsZero() {
+			t.Log("ERROR : " + tt.name + " : held back without failure")
+			t.Error("FAILURE : rest breaker")
+		}
+	}
+
+	b := &restBreaker{host: "test", reset: make(chan struct{})}
+	b.failure(&StatusError{Code: http.StatusTooManyRequests, RetryAfter: time.Hour})
+	done := make(chan error)
+	go func() {
+		done <- b.wait(context.Background())
+	}()
+	b.success()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Log("ERROR : " + err.Error())
+			t.FailNow()
+		}
+	case <-time.After(time.Second):
+		t.Log("ERROR : held back request is not released by the success")
+		t.Error("FAILURE : rest breaker")
+	}
+}
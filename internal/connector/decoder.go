@@ -0,0 +1,84 @@
+package connector
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// FrameDecoder decodes a binary websocket message of the exchange to the one handled by its reader, usually JSON.
+// Decoded message should not be larger than the max size, to protect from the pathological or malicious ones.
+type FrameDecoder func(data []byte, maxSize int64) ([]byte, error)
+
+// wsFrameDecoder is the decoder of the binary messages used if not configured for the exchange,
+// as huobi sends gzip compressed messages.
+const wsFrameDecoder = "gzip"
+
+// frameDecoders holds the decoders by their config name.
+// They are registered only while starting the app, so the map is not guarded for concurrent access.
+var frameDecoders = map[string]FrameDecoder{
+	"gzip": func(data []byte, maxSize int64) ([]byte, error) {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return readDecoded(reader, maxSize)
+	},
+	"deflate": func(data []byte, maxSize int64) ([]byte, error) {
+		reader := flate.NewReader(bytes.NewReader(data))
+		defer reader.Close()
+		return readDecoded(reader, maxSize)
+	},
+	"zlib": func(data []byte, maxSize int64) ([]byte, error) {
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return readDecoded(reader, maxSize)
+	},
+
+	// Binary messages having the JSON as it is, same as the text ones.
+	"text": func(data []byte, _ int64) ([]byte, error) {
+		return data, nil
+	},
+}
+
+// RegisterFrameDecoder adds the decoder under its config name,
+// so that it can be configured for the exchanges sending the binary messages in some other format.
+// It should be called before any websocket connection is made.
+func RegisterFrameDecoder(name string, decoder FrameDecoder) {
+	frameDecoders[name] = decoder
+}
+
+// IsFrameDecoder tells whether the decoder of the name is registered.
+func IsFrameDecoder(name string) bool {
+	_, ok := frameDecoders[name]
+	return ok
+}
+
+// exchangeFrameDecoder returns the decoder configured for the exchange, or the default one.
+func exchangeFrameDecoder(exchName string) FrameDecoder {
+	if exchCfg := wsExchanges[exchName]; exchCfg != nil && exchCfg.FrameDecoder != "" {
+		if decoder, ok := frameDecoders[exchCfg.FrameDecoder]; ok {
+			return decoder
+		}
+	}
+	return frameDecoders[wsFrameDecoder]
+}
+
+// readDecoded reads the decoded message, failing if it is larger than the max size.
+func readDecoded(reader io.Reader, maxSize int64) ([]byte, error) {
+	result, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(result)) > maxSize {
+		return nil, fmt.Errorf("decompressed websocket message larger than max size of %d bytes", maxSize)
+	}
+	return result, nil
+}
@@ -0,0 +1,109 @@
+package connector
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// TestFrameDecoders tests the decoding of the websocket frames compressed by the exchanges,
+// within the max size of the decoded frame, and the frame decoder set for the exchange.
+func TestFrameDecoders(t *testing.T) {
+	msg := `{"ch":"market.btcusdt.trade.detail","tick":{"data":[{"price":50000.5}]}}`
+	gzipWriter := func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }
+	deflateWriter := func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.DefaultCompression) }
+	zlibWriter := func(w io.Writer) (io.WriteCloser, error) { return zlib.NewWriter(w), nil }
+	tests := []struct {
+		name    string
+		decoder string
+		data    string
+
+		// Writer compresses the data, it is sent as it is if not set.
+		writer  func(w io.Writer) (io.WriteCloser, error)
+		maxSize int64
+		wantErr bool
+	}{
+		{"gzip", "gzip", msg, gzipWriter, 1024, false},
+		{"deflate", "deflate", msg, deflateWriter, 1024, false},
+		{"zlib", "zlib", msg, zlibWriter, 1024, false},
+		{"text", "text", msg, nil, 1024, false},
+		{"exact max size", "gzip", msg, gzipWriter, int64(len(msg)), false},
+		{"larger than max size", "gzip", msg, gzipWriter, int64(len(msg)) - 1, true},
+		{"compression bomb", "gzip", strings.Repeat("0", 1<<20), gzipWriter, 1024, true},
+		{"not gzip", "gzip", msg, nil, 1024, true},
+		{"not zlib", "zlib", msg, nil, 1024, true},
+	}
+	for _, tt := range tests {
+		data := []byte(tt.data)
+		if tt.writer != nil {
+			var buf bytes.Buffer
+			w, err := tt.writer(&buf)
+			if err != nil {
+				t.Log("ERROR : " + err.Error())
+				t.FailNow()
+			}
+			if _, err = w.Write(data); err != nil {
+				t.Log("ERROR : " + err.Error())
+				t.FailNow()
+			}
+			if err = w.Close(); err != nil {
+				t.Log("ERROR : " + err.Error())
+				t.FailNow()
+			}
+			data = buf.Bytes()
+		}
+		got, err := frameDecoders[tt.decoder](data, tt.maxSize)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && string(got) != tt.data) {
+			t.Log("ERROR : "+tt.name+" : decoded", string(got), "with error", err, ", expected error", tt.wantErr)
+			t.Error("FAILURE : frame decoder")
+		}
+	}
+
+	RegisterFrameDecoder("test-upper", func(data []byte, _ int64) ([]byte, error) {
+		return bytes.ToUpper(data), nil
+	})
+	SetExchangeWS("test-custom", &config.ExchangeWS{FrameDecoder: "test-upper"})
+	SetExchangeWS("test-unknown", &config.ExchangeWS{FrameDecoder: "test-missing"})
+	defer func() {
+		delete(frameDecoders, "test-upper")
+		delete(wsExchanges, "test-custom")
+		delete(wsExchanges, "test-unknown")
+	}()
+	if !IsFrameDecoder("test-upper") || IsFrameDecoder("test-missing") {
+		t.Log("ERROR : registered frame decoders are not matched")
+		t.Error("FAILURE : frame decoder")
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte("abc")); err != nil {
+		t.Log("ERROR : " + err.Error())
+		t.FailNow()
+	}
+	if err := w.Close(); err != nil {
+		t.Log("ERROR : " + err.Error())
+		t.FailNow()
+	}
+	exchanges := []struct {
+		exchange string
+		data     []byte
+		want     string
+	}{
+		{"test-default", buf.Bytes(), "abc"},
+		{"test-custom", []byte("abc"), "ABC"},
+		{"test-unknown", buf.Bytes(), "abc"},
+	}
+	for _, tt := range exchanges {
+		got, err := exchangeFrameDecoder(tt.exchange)(tt.data, 1024)
+		if err != nil || string(got) != tt.want {
+			t.Log("ERROR : "+tt.exchange+" : decoded", string(got), "with error", err, ", expected", tt.want)
+			t.Error("FAILURE : exchange frame decoder")
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package connector
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strconv"
+
+	"github.com/gobwas/httphead"
+)
+
+// wsDeflateExtension is the name of the permessage-deflate (RFC 7692) websocket extension.
+const wsDeflateExtension = "permessage-deflate"
+
+// Limits of the server_max_window_bits parameter of permessage-deflate.
+const (
+	wsDeflateMinWindowBits = 8
+	wsDeflateMaxWindowBits = 15
+)
+
+// wsDeflateOffers are the permessage-deflate extension offers of the websocket handshake.
+// Server may add client_no_context_takeover, server_no_context_takeover and server_max_window_bits
+// to the offer it accepts, and the dialer accepts only the extensions equal to one of the offers,
+// so all the variants are offered, the plain one being first so that it is the one accepted by the server.
+// Messages sent by the app are never compressed, so the parameters of the client side do not matter.
+var wsDeflateOffers = deflateOffers()
+
+// deflateOffers returns all the variants of the permessage-deflate offer which the server may reply with.
+func deflateOffers() []httphead.Option {
+	windowBits := []string{""}
+	for bits := wsDeflateMinWindowBits; bits <= wsDeflateMaxWindowBits; bits++ {
+		windowBits = append(windowBits, strconv.Itoa(bits))
+	}
+	var offers []httphead.Option
+	for _, bits := range windowBits {
+		for _, serverNoContext := range []bool{false, true} {
+			for _, clientNoContext := range []bool{false, true} {
+				params := make(map[string]string)
+				if bits != "" {
+					params["server_max_window_bits"] = bits
+				}
+				if serverNoContext {
+					params["server_no_context_takeover"] = ""
+				}
+				if clientNoContext {
+					params["client_no_context_takeover"] = ""
+				}
+				offers = append(offers, httphead.NewOption(wsDeflateExtension, params))
+			}
+		}
+	}
+	return offers
+}
+
+// newWsInflater returns the inflater for the extensions negotiated in the handshake,
+// nil if permessage-deflate is not one of them.
+// Parameters agreed by the server decide whether the earlier messages are kept as the dictionary
+// and the size of the window.
+func newWsInflater(extensions []httphead.Option) *wsInflater {
+	for _, ext := range extensions {
+		if string(ext.Name) != wsDeflateExtension {
+			continue
+		}
+		f := &wsInflater{window: wsDeflateWindow}
+		if _, ok := ext.Parameters.Get("server_no_context_takeover"); ok {
+			f.noContext = true
+		}
+		if value, ok := ext.Parameters.Get("server_max_window_bits"); ok {
+			if bits, err := strconv.Atoi(string(value)); err == nil && bits >= wsDeflateMinWindowBits && bits <= wsDeflateMaxWindowBits {
+				f.window = 1 << bits
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// wsDeflateTail is appended to the compressed message, as the empty block ending each message is removed by the server,
+// followed by a final empty block, so that the reader ends at the end of the message.
+var wsDeflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+// wsDeflateWindow is the max size of the sliding window of deflate, used if the server does not agree on a smaller one.
+const wsDeflateWindow = 32768
+
+// wsInflater decompresses the permessage-deflate messages of a connection.
+// Unless the server agreed on server_no_context_takeover, it can refer to the earlier messages,
+// which are kept as the dictionary of the next message, up to the size of the window.
+// It is used only by the reader of the connection.
+type wsInflater struct {
+	reader    io.ReadCloser
+	dict      []byte
+	window    int
+	noContext bool
+}
+
+// inflate returns the decompressed message, failing if it is larger than the max size.
+func (f *wsInflater) inflate(data []byte, maxSize int64) ([]byte, error) {
+	src := io.MultiReader(bytes.NewReader(data), bytes.NewReader(wsDeflateTail))
+	if f.reader == nil {
+		f.reader = flate.NewReaderDict(src, f.dict)
+	} else if err := f.reader.(flate.Resetter).Reset(src, f.dict); err != nil {
+		return nil, err
+	}
+	result, err := readDecoded(f.reader, maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.noContext {
+		return result, nil
+	}
+	f.dict = append(f.dict, result...)
+	if len(f.dict) > f.window {
+		f.dict = append(f.dict[:0], f.dict[len(f.dict)-f.window:]...)
+	}
+	return result, nil
+}
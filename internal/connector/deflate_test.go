@@ -0,0 +1,165 @@
+package connector
+
+import (
+	"bytes"
+	"compress/flate"
+	"strings"
+	"testing"
+
+	"github.com/gobwas/httphead"
+)
+
+// deflateMessages compresses the messages as a permessage-deflate server does,
+// flushing each one and removing the empty block ending it.
+// Server keeps the context across the messages, unless noContext.
+func deflateMessages(t *testing.T, messages []string, noContext bool) [][]byte {
+	var (
+		buf bytes.Buffer
+		out [][]byte
+	)
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		t.Log("ERROR : " + err.Error())
+		t.FailNow()
+	}
+	for _, msg := range messages {
+		if noContext {
+			w.Reset(&buf)
+		}
+		if _, err = w.Write([]byte(msg)); err != nil {
+			t.Log("ERROR : " + err.Error())
+			t.FailNow()
+		}
+		if err = w.Flush(); err != nil {
+			t.Log("ERROR : " + err.Error())
+			t.FailNow()
+		}
+		data := bytes.TrimSuffix(buf.Bytes(), []byte{0x00, 0x00, 0xff, 0xff})
+		out = append(out, append([]byte(nil), data...))
+		buf.Reset()
+	}
+	return out
+}
+
+// TestWsInflater tests the inflation of the messages, with and without the context takeover,
+// the window size of the kept dictionary and the max size of the inflated message.
+func TestWsInflater(t *testing.T) {
+	repeated := strings.Repeat(`{"channel":"trade","market":"BTC-USD","price":"50000.5"}`, 20)
+	tests := []struct {
+		name      string
+		messages  []string
+		noContext bool
+	}{
+		{"single message", []string{repeated}, false},
+		{"context takeover", []string{repeated, repeated, repeated}, false},
+		{"no context takeover", []string{repeated, repeated}, true},
+		{"empty message", []string{""}, false},
+	}
+	for _, tt := range tests {
+		f := &wsInflater{window: wsDeflateWindow, noContext: tt.noContext}
+		for i, data := range deflateMessages(t, tt.messages, tt.noContext) {
+			got, err := f.inflate(data, 1<<20)
+			if err != nil {
+				t.Log("ERROR : "+tt.name+" : message", i, ":", err.Error())
+				t.Error("FAILURE : permessage-deflate inflate")
+				break
+			}
+			if string(got) != tt.messages[i] {
+				t.Log("ERROR : "+tt.name+" : message", i, "inflated to", string(got))
+				t.Error("FAILURE : permessage-deflate inflate")
+				break
+			}
+		}
+		if tt.noContext && len(f.dict) > 0 {
+			t.Log("ERROR : " + tt.name + " : dictionary kept without context takeover")
+			t.Error("FAILURE : permessage-deflate inflate")
+		}
+	}
+
+	f := &wsInflater{window: 1024}
+	for _, data := range deflateMessages(t, []string{strings.Repeat("a", 4096)}, false) {
+		if _, err := f.inflate(data, 1<<20); err != nil {
+			t.Log("ERROR : " + err.Error())
+			t.FailNow()
+		}
+	}
+	if len(f.dict) != 1024 {
+		t.Log("ERROR : dictionary of", len(f.dict), "bytes kept with window of 1024 bytes")
+		t.Error("FAILURE : permessage-deflate inflate")
+	}
+
+	f = &wsInflater{window: wsDeflateWindow}
+	data := deflateMessages(t, []string{strings.Repeat("a", 2048)}, false)[0]
+	if _, err := f.inflate(data, 1024); err == nil {
+		t.Log("ERROR : message larger than the max size inflated without error")
+		t.Error("FAILURE : permessage-deflate inflate")
+	}
+}
+
+// TestNewWsInflater tests the parameters of the permessage-deflate extension agreed by the server.
+func TestNewWsInflater(t *testing.T) {
+	tests := []struct {
+		name       string
+		extensions []httphead.Option
+		want       *wsInflater
+	}{
+		{"not negotiated", nil, nil},
+		{"other extension", []httphead.Option{httphead.NewOption("x-webkit-deflate-frame", nil)}, nil},
+		{
+			"plain",
+			[]httphead.Option{httphead.NewOption(wsDeflateExtension, nil)},
+			&wsInflater{window: wsDeflateWindow},
+		},
+		{
+			"server no context takeover",
+			[]httphead.Option{httphead.NewOption(wsDeflateExtension, map[string]string{"server_no_context_takeover": "", "client_no_context_takeover": ""})},
+			&wsInflater{window: wsDeflateWindow, noContext: true},
+		},
+		{
+			"server max window bits",
+			[]httphead.Option{httphead.NewOption(wsDeflateExtension, map[string]string{"server_max_window_bits": "10"})},
+			&wsInflater{window: 1024},
+		},
+		{
+			"invalid server max window bits",
+			[]httphead.Option{httphead.NewOption(wsDeflateExtension, map[string]string{"server_max_window_bits": "20"})},
+			&wsInflater{window: wsDeflateWindow},
+		},
+	}
+	for _, tt := range tests {
+		got := newWsInflater(tt.extensions)
+		if (got == nil) != (tt.want == nil) || (got != nil && (got.window != tt.want.window || got.noContext != tt.want.noContext)) {
+			t.Logf("ERROR : %s : inflater %+v, expected %+v", tt.name, got, tt.want)
+			t.Error("FAILURE : permessage-deflate negotiation")
+		}
+	}
+
+	offers := deflateOffers()
+	if len(offers) == 0 || !offers[0].Equal(httphead.NewOption(wsDeflateExtension, nil)) {
+		t.Log("ERROR : plain permessage-deflate offer is not the first one")
+		t.FailNow()
+	}
+
+	// Replies of the server which should be accepted by the dialer.
+	replies := []map[string]string{
+		{"client_no_context_takeover": ""},
+		{"server_no_context_takeover": ""},
+		{"server_no_context_takeover": "", "client_no_context_takeover": ""},
+		{"server_max_window_bits": "8"},
+		{"server_max_window_bits": "15", "server_no_context_takeover": "", "client_no_context_takeover": ""},
+	}
+	for _, params := range replies {
+		reply := httphead.NewOption(wsDeflateExtension, params)
+		found := false
+		for _, offer := range offers {
+			if offer.Equal(reply) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Log("ERROR : reply", reply.String(), "is not one of the offers")
+			t.Error("FAILURE : permessage-deflate negotiation")
+		}
+	}
+}
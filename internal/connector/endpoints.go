@@ -0,0 +1,164 @@
+package connector
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Default values, if not configured.
+const (
+	endpointDownSec    = 30
+	endpointMaxDownSec = 300
+)
+
+// wsEndpoints and restEndpoints hold the endpoints of the exchanges having alternative ones.
+// They are set only while starting the app, before any connection is made,
+// so the maps are not guarded for concurrent access.
+var (
+	wsEndpoints   = make(map[string]*endpointSet)
+	restEndpoints = make(map[string]*endpointSet)
+)
+
+// SetEndpoints sets the alternative websocket and REST endpoints of the exchange,
+// e.g. regional mirrors or backup domains, to which the connections fail over on the failure of the default one.
+// Only the scheme and host of the endpoints are used, the path and query of the connections are kept.
+func SetEndpoints(exchName string, cfg *config.ExchangeEndpoints) error {
+	wsHosts, err := endpointHosts(cfg.Websocket, "ws", "wss")
+	if err != nil {
+		return err
+	}
+	if len(wsHosts) > 0 {
+		wsEndpoints[exchName] = &endpointSet{exchName: exchName, connType: "websocket", alternates: wsHosts}
+	}
+	restHosts, err := endpointHosts(cfg.REST, "http", "https")
+	if err != nil {
+		return err
+	}
+	if len(restHosts) > 0 {
+		restEndpoints[exchName] = &endpointSet{exchName: exchName, connType: "rest", alternates: restHosts}
+	}
+	return nil
+}
+
+// endpointHosts parses the endpoint urls, which should have one of the given schemes and a host.
+func endpointHosts(urls []string, schemes ...string) ([]*url.URL, error) {
+	hosts := make([]*url.URL, 0, len(urls))
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != schemes[0] && u.Scheme != schemes[1] {
+			return nil, fmt.Errorf("endpoint %s scheme should be either %s or %s", raw, schemes[0], schemes[1])
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("endpoint %s should have host", raw)
+		}
+		hosts = append(hosts, &url.URL{Scheme: u.Scheme, Host: u.Host})
+	}
+	return hosts, nil
+}
+
+// endpointSet is the default endpoint of a connection along with the alternative ones,
+// and the health of each of them, shared by all the connections of the exchange.
+type endpointSet struct {
+	exchName   string
+	connType   string
+	alternates []*url.URL
+	mu         sync.Mutex
+	health     map[string]*endpointHealth
+}
+
+// endpointHealth is the number of consecutive failures of the endpoint and the time till it is considered down.
+type endpointHealth struct {
+	failures  int
+	downUntil time.Time
+}
+
+// candidates returns the url on each of the endpoints, in the order to be tried.
+// Default endpoint is tried first, then the alternative ones in the configured order,
+// except the ones down after a recent failure, which are tried at last.
+func (s *endpointSet) candidates(u *url.URL) []*url.URL {
+	urls := make([]*url.URL, 0, len(s.alternates)+1)
+	urls = append(urls, u)
+	for _, alt := range s.alternates {
+		if alt.Host == u.Host && alt.Scheme == u.Scheme {
+			continue
+		}
+		c := *u
+		c.Scheme = alt.Scheme
+		c.Host = alt.Host
+		urls = append(urls, &c)
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sort.SliceStable(urls, func(i, j int) bool {
+		return !s.isDown(urls[i], now) && s.isDown(urls[j], now)
+	})
+	return urls
+}
+
+// isDown tells whether the endpoint of the url is down, which is till the time after its recent failure.
+func (s *endpointSet) isDown(u *url.URL, now time.Time) bool {
+	h := s.health[u.Host]
+	return h != nil && now.Before(h.downUntil)
+}
+
+// success marks the endpoint of the url as up.
+func (s *endpointSet) success(u *url.URL) {
+	s.mu.Lock()
+	h := s.health[u.Host]
+	recovered := h != nil && h.failures > 0
+	delete(s.health, u.Host)
+	s.mu.Unlock()
+	metrics.EndpointUp.WithLabelValues(s.exchName, s.connType, u.Host).Set(1)
+	if recovered {
+		log.Info().Str("exchange", s.exchName).Str("type", s.connType).Str("endpoint", u.Host).Msg("endpoint is up again")
+	}
+}
+
+// failure marks the endpoint of the url as down, for a time doubling on each consecutive failure.
+func (s *endpointSet) failure(u *url.URL, err error) {
+	s.mu.Lock()
+	if s.health == nil {
+		s.health = make(map[string]*endpointHealth)
+	}
+	h := s.health[u.Host]
+	if h == nil {
+		h = &endpointHealth{}
+		s.health[u.Host] = h
+	}
+	h.failures++
+	downSec := endpointMaxDownSec
+	if h.failures < 5 {
+		downSec = endpointDownSec << (h.failures - 1)
+		if downSec > endpointMaxDownSec {
+			downSec = endpointMaxDownSec
+		}
+	}
+	h.downUntil = time.Now().Add(time.Duration(downSec) * time.Second)
+	failures := h.failures
+	s.mu.Unlock()
+	metrics.EndpointUp.WithLabelValues(s.exchName, s.connType, u.Host).Set(0)
+	log.Warn().Str("exchange", s.exchName).Str("type", s.connType).Str("endpoint", u.Host).Int("failures", failures).Err(err).Msg("endpoint failed, failing over")
+}
+
+// endpointFailure tells whether the REST error is of the endpoint than of the request,
+// i.e. a network error or a server side one, so that the request is failed over to another endpoint.
+func endpointFailure(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= http.StatusInternalServerError
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package connector
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// headers holds the custom http headers of the exchanges, with the global ones against the empty name.
+// It is set only while starting the app, before any connection is made,
+// so it is not guarded for concurrent access.
+var headers = make(map[string]http.Header)
+
+// SetHeaders sets the custom http headers sent on the REST requests and the websocket handshake of the exchange,
+// or the global ones for all the exchanges if the name is empty, e.g. User-Agent.
+// Headers of the exchange take precedence over the global ones with the same name.
+// Headers managed by the connections themselves, like Host or the websocket handshake ones, are not allowed.
+func SetHeaders(exchName string, cfg map[string]string) error {
+	if len(cfg) == 0 {
+		return nil
+	}
+	h := make(http.Header, len(cfg))
+	for name, value := range cfg {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("header name %q is not valid", name)
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("header %s value is not valid", name)
+		}
+		canonical := http.CanonicalHeaderKey(name)
+		switch {
+		case canonical == "Host", canonical == "Connection", canonical == "Upgrade", strings.HasPrefix(canonical, "Sec-Websocket-"):
+			return fmt.Errorf("header %s is set by the connection, it can not be configured", canonical)
+		}
+		h.Set(canonical, value)
+	}
+	headers[exchName] = h
+	return nil
+}
+
+// exchangeHeaders returns the custom headers of the exchange merged over the global ones.
+// It returns nil if there is not any.
+func exchangeHeaders(exchName string) http.Header {
+	global, exch := headers[""], headers[exchName]
+	if exchName == "" || exch == nil {
+		return global
+	}
+	if global == nil {
+		return exch
+	}
+	h := global.Clone()
+	for name, values := range exch {
+		h[name] = values
+	}
+	return h
+}
@@ -0,0 +1,101 @@
+package connector
+
+import (
+	"net/url"
+	"time"
+)
+
+// Default values, if not configured.
+const tradeCursorMaxPages = 10
+
+// TradeCursor keeps the position of the last trade received from the REST trade endpoint of a market,
+// so that each poll walks forward from it page by page, instead of getting only the latest page,
+// which misses the trades if the poll interval is big and duplicates them if it is small.
+//
+// Exchanges page the trades by the id or time of the last one, which is set by the Position function
+// to the query parameter. Endpoints returning only the latest trades are polled without any parameter,
+// still skipping the trades already received.
+type TradeCursor struct {
+	// Param is the query parameter of the position, empty if the endpoint is not paged.
+	Param string
+
+	// Position returns the value of the Param from the id and time of the last trade.
+	Position func(id string, t time.Time) string
+
+	// Forward are the query parameters set along with the position, e.g. for the ascending order.
+	Forward map[string]string
+
+	// Limit is the page size, a page having less trades is the latest one.
+	Limit int
+
+	last  tradePosition
+	next  tradePosition
+	pages int
+}
+
+// tradePosition is the time of the last trade along with the ids of all the trades at that time,
+// as the trades of the same time are not ordered by all the exchanges.
+type tradePosition struct {
+	id   string
+	time time.Time
+	ids  map[string]bool
+}
+
+// Query sets the position of the last trade to the query of the next page,
+// if the endpoint is paged and any trade is received before.
+func (c *TradeCursor) Query(q url.Values) {
+	if c.Param == "" || c.last.ids == nil {
+		return
+	}
+	q.Set(c.Param, c.Position(c.last.id, c.last.time))
+	for k, v := range c.Forward {
+		q.Set(k, v)
+	}
+}
+
+// New returns whether the trade is not received before, which is when it is newer than the last trade
+// or at the same time but with a different id. New trades are kept to move the cursor after the page.
+func (c *TradeCursor) New(id string, t time.Time) bool {
+	if c.last.ids != nil && (t.Before(c.last.time) || t.Equal(c.last.time) && c.last.ids[id]) {
+		return false
+	}
+	c.next.add(id, t)
+	return true
+}
+
+// Next moves the cursor to the last trade of the page having the given number of trades
+// and returns whether the next page is to be requested in the same poll.
+// It is so only if the endpoint is paged, the page is full and the cursor had a position before the page,
+// as the first poll gets only the latest page, not the whole history.
+// At most 10 pages are requested in a poll, the rest are left for the next one.
+func (c *TradeCursor) Next(count int) bool {
+	positioned := c.last.ids != nil
+	if c.next.ids != nil {
+		for id := range c.next.ids {
+			c.last.add(id, c.next.time)
+		}
+		c.next = tradePosition{}
+	}
+	c.pages++
+	if c.Param == "" || !positioned || count < c.Limit || c.pages >= tradeCursorMaxPages {
+		c.pages = 0
+		return false
+	}
+	return true
+}
+
+// add moves the position to the trade, if it is not older.
+// Among the trades at the same time, the one with the greater numeric id is considered the last.
+func (p *tradePosition) add(id string, t time.Time) {
+	switch {
+	case p.ids == nil || t.After(p.time):
+		p.id = id
+		p.time = t
+		p.ids = map[string]bool{id: true}
+	case t.Equal(p.time):
+		p.ids[id] = true
+		if len(id) > len(p.id) || len(id) == len(p.id) && id > p.id {
+			p.id = id
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package connector
+
+import (
+	"math/rand"
+	"time"
+)
+
+// PollTicker is the ticker of the REST polling of a market channel.
+// Each tick is delayed by a random jitter, if configured for the exchange, so that the requests of the markets
+// polling at the same interval are spread over it instead of bursting at the same instant.
+// Same as time.Ticker, ticks are dropped if the poll takes longer than the interval.
+type PollTicker struct {
+	C      <-chan time.Time
+	ticker *time.Ticker
+	done   chan struct{}
+}
+
+// NewPollTicker returns the poll ticker of the exchange, ticking at the interval.
+// Jitter of each tick is up to the configured percent of the interval.
+func NewPollTicker(exchName string, interval time.Duration) *PollTicker {
+	t := &PollTicker{ticker: time.NewTicker(interval)}
+	exchCfg := restExchangeCfgs[exchName]
+	if exchCfg == nil || exchCfg.JitterPercent <= 0 {
+		t.C = t.ticker.C
+		return t
+	}
+	maxJitter := int64(interval) * int64(exchCfg.JitterPercent) / 100
+	if maxJitter <= 0 {
+		t.C = t.ticker.C
+		return t
+	}
+	c := make(chan time.Time, 1)
+	t.C = c
+	t.done = make(chan struct{})
+	go t.jitter(c, maxJitter)
+	return t
+}
+
+// jitter delays each tick of the ticker by a random duration less than the max jitter.
+func (t *PollTicker) jitter(c chan<- time.Time, maxJitter int64) {
+	for {
+		select {
+		case tick := <-t.ticker.C:
+			timer := time.NewTimer(time.Duration(rand.Int63n(maxJitter)))
+			select {
+			case <-timer.C:
+			case <-t.done:
+				timer.Stop()
+				return
+			}
+			select {
+			case c <- tick:
+			default:
+			}
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// Stop turns off the ticker.
+func (t *PollTicker) Stop() {
+	t.ticker.Stop()
+	if t.done != nil {
+		close(t.done)
+	}
+}
@@ -0,0 +1,137 @@
+package connector
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"golang.org/x/net/proxy"
+)
+
+// proxies holds the proxy url of the exchanges, with the global one against the empty name.
+// It is set only while starting the app, before any connection is made,
+// so it is not guarded for concurrent access.
+var proxies = make(map[string]*url.URL)
+
+// SetProxy sets the proxy through which the websocket and REST connections of the exchange are made,
+// or the global one for all the exchanges without their own if the name is empty.
+// Username and password, if configured, take precedence over the ones in the url.
+// It does nothing if the url is empty.
+func SetProxy(exchName string, cfg *config.Proxy) error {
+	if cfg.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("proxy scheme should be one of http, https or socks5, not %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("proxy url %s should have host", cfg.URL)
+	}
+	if cfg.Username != "" {
+		u.User = url.UserPassword(cfg.Username, cfg.Password)
+	}
+	proxies[exchName] = u
+	return nil
+}
+
+// proxyURL returns the proxy of the exchange, or the global one if it does not have its own.
+// It returns nil if there is not any.
+func proxyURL(exchName string) *url.URL {
+	if u, ok := proxies[exchName]; ok {
+		return u
+	}
+	return proxies[""]
+}
+
+// proxyDial returns the function dialing the tcp connections through the proxy.
+// Websocket handshake (and TLS for wss) is done over the connection tunneled by it.
+func proxyDial(u *url.URL) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	if u.Scheme == "socks5" {
+		dialer, err := proxy.FromURL(u, &net.Dialer{})
+		if err != nil {
+			return nil, err
+		}
+		return dialer.(proxy.ContextDialer).DialContext, nil
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialHTTPProxy(ctx, u, addr)
+	}, nil
+}
+
+// dialHTTPProxy tunnels a connection to the address through the http proxy by the CONNECT method.
+func dialHTTPProxy(ctx context.Context, u *url.URL, addr string) (net.Conn, error) {
+	proxyAddr := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "https" {
+			proxyAddr = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			proxyAddr = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Proxy does not send anything after the response till the tunnel is used,
+	// so the connection can be read directly after it.
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy connect to %s, code : %v, status : %v", addr, resp.StatusCode, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		conn.Close()
+		return nil, fmt.Errorf("proxy connect to %s, unexpected data after the response", addr)
+	}
+	if err = conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
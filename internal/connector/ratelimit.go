@@ -0,0 +1,60 @@
+package connector
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket allowing the given number of events per interval.
+// Bucket starts full and holds at most the same number of tokens,
+// so after an idle time, that many events are allowed at once.
+type rateLimiter struct {
+	mu       sync.Mutex
+	tokens   float64
+	capacity float64
+	perSec   float64
+	last     time.Time
+}
+
+func newRateLimiter(events float64, interval time.Duration) *rateLimiter {
+	return &rateLimiter{
+		tokens:   events,
+		capacity: events,
+		perSec:   events / interval.Seconds(),
+		last:     time.Now(),
+	}
+}
+
+// wait blocks till an event is allowed by taking a token from the bucket, or the context is done.
+// Callers waiting together are allowed one after the other, in the order of reserving the tokens.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.perSec
+	if l.tokens > l.capacity {
+		l.tokens = l.capacity
+	}
+	l.last = now
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.perSec * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,57 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestRateLimiter tests that the waits beyond the bucket are paced at the rate of the limiter,
+// and that the token reserved by a cancelled wait is given back.
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name     string
+		events   float64
+		interval time.Duration
+		waits    int
+		min      time.Duration
+		max      time.Duration
+	}{
+		{"full bucket at once", 5, time.Second, 5, 0, 50 * time.Millisecond},
+		{"one more than bucket", 5, time.Second, 6, 150 * time.Millisecond, 300 * time.Millisecond},
+		{"two more than bucket", 10, time.Second, 12, 150 * time.Millisecond, 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		l := newRateLimiter(tt.events, tt.interval)
+		start := time.Now()
+		for i := 0; i < tt.waits; i++ {
+			if err := l.wait(context.Background()); err != nil {
+				t.Log("ERROR : " + err.Error())
+				t.FailNow()
+			}
+		}
+		if elapsed := time.Since(start); elapsed < tt.min || elapsed > tt.max {
+			t.Log("ERROR : "+tt.name+" :", tt.waits, "waits took", elapsed, "expected between", tt.min, "and", tt.max)
+			t.Error("FAILURE : rate limiter")
+		}
+	}
+
+	l := newRateLimiter(1, time.Hour)
+	if err := l.wait(context.Background()); err != nil {
+		t.Log("ERROR : " + err.Error())
+		t.FailNow()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx); err == nil {
+		t.Log("ERROR : wait on an empty bucket succeeded without context error")
+		t.Error("FAILURE : rate limiter")
+	}
+	l.mu.Lock()
+	tokens := l.tokens
+	l.mu.Unlock()
+	if tokens < -0.01 || tokens > 0.01 {
+		t.Log("ERROR : tokens after cancelled wait", tokens, "expected 0")
+		t.Error("FAILURE : rate limiter")
+	}
+}
@@ -2,62 +2,312 @@ package connector
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"sync"
 	"time"
 
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // REST is for REST connection.
 type REST struct {
 	HTTPClient *http.Client
+	limiter    *rateLimiter
+	sem        chan struct{}
+	header     http.Header
+	endpoints  *endpointSet
+}
+
+// StatusError is the error of a REST API response with a status code other than 200.
+// RetryAfter is the time to retry after, as asked by the Retry-After header of the response, if any.
+type StatusError struct {
+	Code       int
+	Status     string
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("code : %v, status : %v", e.Code, e.Status)
 }
 
 var rest REST
 
+// Default values of the transport, same as the http.DefaultTransport, if not configured.
+const (
+	restDialTimeout = 30 * time.Second
+	restKeepAlive   = 30 * time.Second
+)
+
+// restExchanges holds the REST connections of the exchanges having their own proxy, TLS, rate limit, headers or endpoints.
+// It is set only while starting the app, so it is not guarded for concurrent access.
+var restExchanges = make(map[string]*REST)
+
+// restExchangeCfgs holds the REST config of the exchanges, set only while starting the app.
+var restExchangeCfgs = make(map[string]*config.ExchangeREST)
+
+// SetExchangeREST sets the REST config of the exchange.
+// It should be called before InitREST.
+func SetExchangeREST(exchName string, cfg *config.ExchangeREST) {
+	restExchangeCfgs[exchName] = cfg
+}
+
 // InitREST initializes http client with configured values.
+// Separate connections are initialized for the exchanges having their own proxy, TLS, rate limit, headers or endpoints,
+// sharing the common http client if they do not have their own proxy or TLS.
 func InitREST(cfg *config.REST) *REST {
 	if rest.HTTPClient == nil {
-		t := http.DefaultTransport.(*http.Transport).Clone()
-		t.MaxIdleConns = cfg.MaxIdleConns
-		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
-		rest = REST{
-			HTTPClient: &http.Client{
-				Timeout:   time.Duration(cfg.ReqTimeoutSec) * time.Second,
-				Transport: t,
-			},
+		rest = REST{HTTPClient: newHTTPClient(cfg, proxies[""], tlsConfigs[""]), header: headers[""]}
+		if cfg.BreakerFailures > 0 {
+			restBreakerCfg.failures = cfg.BreakerFailures
+		}
+		if cfg.BreakerOpenSec > 0 {
+			restBreakerCfg.open = time.Duration(cfg.BreakerOpenSec) * time.Second
+		}
+		for exchName := range proxies {
+			if exchName != "" {
+				initExchangeREST(cfg, exchName)
+			}
+		}
+		for exchName := range tlsConfigs {
+			if exchName != "" {
+				initExchangeREST(cfg, exchName)
+			}
+		}
+		for exchName := range restExchangeCfgs {
+			initExchangeREST(cfg, exchName)
+		}
+		for exchName := range headers {
+			if exchName != "" {
+				initExchangeREST(cfg, exchName)
+			}
+		}
+		for exchName := range restEndpoints {
+			initExchangeREST(cfg, exchName)
 		}
 	}
 	return &rest
 }
 
-// GetREST returns already initialized http client.
-func GetREST() (*REST, error) {
+// initExchangeREST initializes the REST connection of the exchange, if it has its own proxy, TLS, rate limit, headers or endpoints.
+func initExchangeREST(cfg *config.REST, exchName string) {
+	if _, ok := restExchanges[exchName]; ok {
+		return
+	}
+	_, ownProxy := proxies[exchName]
+	_, ownTLS := tlsConfigs[exchName]
+	exchCfg := restExchangeCfgs[exchName]
+	limited := exchCfg != nil && (exchCfg.RequestsPerSec > 0 || exchCfg.MaxConcurrentRequests > 0)
+	_, ownHeaders := headers[exchName]
+	endpoints := restEndpoints[exchName]
+	if !ownProxy && !ownTLS && !limited && !ownHeaders && endpoints == nil {
+		return
+	}
+	exchREST := REST{HTTPClient: rest.HTTPClient, header: exchangeHeaders(exchName), endpoints: endpoints}
+	if ownProxy || ownTLS {
+		exchREST.HTTPClient = newHTTPClient(cfg, proxyURL(exchName), exchangeTLS(exchName))
+	}
+	if limited && exchCfg.RequestsPerSec > 0 {
+		exchREST.limiter = newRateLimiter(exchCfg.RequestsPerSec, time.Second)
+	}
+	if limited && exchCfg.MaxConcurrentRequests > 0 {
+		exchREST.sem = make(chan struct{}, exchCfg.MaxConcurrentRequests)
+	}
+	restExchanges[exchName] = &exchREST
+}
+
+// newHTTPClient returns the http client with configured values, which makes the requests through the proxy, if any.
+// Without any, the proxy from the environment is used, same as the default client.
+// TLS config, if any, is used for the https requests.
+// Transport values not configured are the same as the default client.
+func newHTTPClient(cfg *config.REST, proxy *url.URL, tlsCfg *tls.Config) *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = cfg.MaxIdleConns
+	t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	dialer := &net.Dialer{
+		Timeout:   restDialTimeout,
+		KeepAlive: restKeepAlive,
+	}
+	if cfg.DialTimeoutSec > 0 {
+		dialer.Timeout = time.Duration(cfg.DialTimeoutSec) * time.Second
+	}
+	switch {
+	case cfg.KeepAliveSec > 0:
+		dialer.KeepAlive = time.Duration(cfg.KeepAliveSec) * time.Second
+	case cfg.KeepAliveSec < 0:
+		dialer.KeepAlive = -1
+	}
+	t.DialContext = dialer.DialContext
+	if cfg.TLSHandshakeTimeoutSec > 0 {
+		t.TLSHandshakeTimeout = time.Duration(cfg.TLSHandshakeTimeoutSec) * time.Second
+	}
+	if cfg.ResponseHeaderTimeoutSec > 0 {
+		t.ResponseHeaderTimeout = time.Duration(cfg.ResponseHeaderTimeoutSec) * time.Second
+	}
+	if cfg.IdleConnTimeoutSec > 0 {
+		t.IdleConnTimeout = time.Duration(cfg.IdleConnTimeoutSec) * time.Second
+	}
+	t.DisableKeepAlives = cfg.DisableKeepAlives
+	if cfg.DisableHTTP2 {
+		// HTTP/2 is not negotiated with a non nil empty map, as documented in net/http.
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	if proxy != nil {
+		t.Proxy = http.ProxyURL(proxy)
+	}
+	if tlsCfg != nil {
+		t.TLSClientConfig = tlsCfg.Clone()
+	}
+	return &http.Client{
+		Timeout:   time.Duration(cfg.ReqTimeoutSec) * time.Second,
+		Transport: t,
+	}
+}
+
+// GetREST returns already initialized http client of the exchange,
+// which is the common one if the exchange does not have its own.
+func GetREST(exchName string) (*REST, error) {
 	if rest.HTTPClient == nil {
 		return nil, errors.New("REST connection is not yet prepared")
 	}
+	if exchREST, ok := restExchanges[exchName]; ok {
+		return exchREST, nil
+	}
 	return &rest, nil
 }
 
-// Request creates a new request object for http operation.
+// Request creates a new request object for http operation, along with the custom headers of the exchange, if any.
 func (r *REST) Request(appCtx context.Context, method, url string) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(appCtx, method, url, nil)
 	if err != nil {
 		return nil, err
 	}
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
 	return req, nil
 }
 
 // Do makes GET http call to exchange.
+// Response body bytes read by the caller are accounted in the metrics against the request host and path.
+// If the exchange has a rate limit, it waits till the request is allowed by it.
+// If the exchange has a cap of concurrent requests, it waits till a request in progress is done,
+// which is till its response body is closed.
+// If the exchange has alternative endpoints, the request is failed over to them on a network or server side error.
+// On a throttling or server side error, the request is retried after the backoff of the host's circuit breaker,
+// so the caller is blocked meanwhile and its polling ticker drops the ticks, instead of getting an error.
 func (r *REST) Do(req *http.Request) (*http.Response, error) {
+	breaker := breakerOf(req.URL.Host)
+	for {
+		if err := breaker.wait(req.Context()); err != nil {
+			return nil, err
+		}
+		resp, err := r.limit(req)
+		if err == nil {
+			breaker.success()
+			return resp, nil
+		}
+		if req.Context().Err() != nil || !breaker.failure(err) {
+			return nil, err
+		}
+	}
+}
+
+// limit makes the http call once allowed by the rate limit and the concurrent requests cap of the exchange, if any.
+func (r *REST) limit(req *http.Request) (*http.Response, error) {
+	if r.limiter != nil {
+		if err := r.limiter.wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	if r.sem == nil {
+		return r.failover(req)
+	}
+	select {
+	case r.sem <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	resp, err := r.failover(req)
+	if err != nil {
+		<-r.sem
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, sem: r.sem}
+	return resp, nil
+}
+
+// failover makes the http call to the default endpoint, and to the alternative ones on its failure.
+func (r *REST) failover(req *http.Request) (*http.Response, error) {
+	if r.endpoints == nil {
+		return r.do(req)
+	}
+	var err error
+	for _, u := range r.endpoints.candidates(req.URL) {
+		endpointReq := req
+		if u.Host != req.URL.Host || u.Scheme != req.URL.Scheme {
+			endpointReq = req.Clone(req.Context())
+			endpointReq.URL = u
+			endpointReq.Host = ""
+		}
+		resp, doErr := r.do(endpointReq)
+		if doErr == nil {
+			r.endpoints.success(u)
+			return resp, nil
+		}
+		if req.Context().Err() != nil || !endpointFailure(doErr) {
+			return nil, doErr
+		}
+		r.endpoints.failure(u, doErr)
+		err = doErr
+	}
+	return nil, err
+}
+
+// do makes the http call, failing on a status code other than 200.
+func (r *REST) do(req *http.Request) (*http.Response, error) {
 	resp, err := r.HTTPClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("code : %v, status : %v", resp.StatusCode, resp.Status)
+		resp.Body.Close()
+		return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status, RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}
 	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, received: metrics.RESTReceivedBytes.WithLabelValues(req.URL.Host, req.URL.Path)}
 	return resp, nil
 }
+
+// countingBody counts the bytes read from the http response body.
+type countingBody struct {
+	io.ReadCloser
+	received prometheus.Counter
+}
+
+func (c *countingBody) Read(b []byte) (int, error) {
+	n, err := c.ReadCloser.Read(b)
+	c.received.Add(float64(n))
+	return n, err
+}
+
+// releasingBody releases the concurrent request slot of the exchange once the http response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	sem  chan struct{}
+	once sync.Once
+}
+
+func (r *releasingBody) Close() error {
+	r.once.Do(func() {
+		<-r.sem
+	})
+	return r.ReadCloser.Close()
+}
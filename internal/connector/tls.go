@@ -0,0 +1,44 @@
+package connector
+
+import (
+	"crypto/tls"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/tlsconfig"
+)
+
+// tlsConfigs holds the TLS config of the exchanges, with the global one against the empty name.
+// It is set only while starting the app, before any connection is made,
+// so it is not guarded for concurrent access.
+var tlsConfigs = make(map[string]*tls.Config)
+
+// SetTLS sets the TLS config of the websocket and REST connections of the exchange,
+// or the global one for all the exchanges without their own if the name is empty.
+// It does nothing if none of the values are configured.
+func SetTLS(exchName string, cfg *config.TLS) error {
+	if cfg.CACertFile == "" && cfg.MinVersion == "" && len(cfg.PinnedKeys) == 0 {
+		return nil
+	}
+	tlsCfg := &tls.Config{}
+	if cfg.CACertFile != "" {
+		pool, err := tlsconfig.CAPool(cfg.CACertFile)
+		if err != nil {
+			return err
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if err := tlsconfig.Apply(tlsCfg, cfg.MinVersion, cfg.PinnedKeys); err != nil {
+		return err
+	}
+	tlsConfigs[exchName] = tlsCfg
+	return nil
+}
+
+// exchangeTLS returns the TLS config of the exchange, or the global one if it does not have its own.
+// It returns nil if there is not any, for the default one.
+func exchangeTLS(exchName string) *tls.Config {
+	if tlsCfg, ok := tlsConfigs[exchName]; ok {
+		return tlsCfg
+	}
+	return tlsConfigs[""]
+}
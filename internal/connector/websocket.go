@@ -1,78 +1,356 @@
 package connector
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"net/url"
 	"time"
 
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/metrics"
+	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
 )
 
 // Websocket is for websocket connection.
 type Websocket struct {
-	Conn net.Conn
-	Cfg  *config.WS
+	Conn     net.Conn
+	Cfg      *config.WS
+	exchName string
+	connURL  string
+	archive  *storage.RawArchive
+	decoder  FrameDecoder
+	appCtx   context.Context
+	conn     *wsConn
+	limiter  *rateLimiter
+}
+
+// wsExchanges holds the websocket config of the exchanges.
+// It is set only while starting the app, before any exchange is started,
+// so it is not guarded for concurrent access.
+var wsExchanges = make(map[string]*config.ExchangeWS)
+
+// SetExchangeWS sets the websocket config of the exchange, applied to all of its connections.
+func SetExchangeWS(exchName string, cfg *config.ExchangeWS) {
+	wsExchanges[exchName] = cfg
+}
+
+// Default values, if not configured.
+const wsMaxMessageSizeKB = 16384
+
+// wsMessageLimits are the limits of the messages sent on a websocket connection of the exchanges,
+// used if not configured. Subscriptions replayed on a reconnect are paced only by them.
+// Kucoin allows 100 messages per 10 sec. As the rate limiter allows a full bucket at once,
+// only half of it is used, leaving some for the ping messages.
+// Binance allows 5 and coinbase-pro 100 messages per sec, so they are limited to 3 and 90 messages per 2 sec,
+// same as their subscriptions are paced while connecting.
+var wsMessageLimits = map[string]struct {
+	messages int
+	interval time.Duration
+}{
+	"kucoin":       {45, 10 * time.Second},
+	"binance":      {3, 2 * time.Second},
+	"coinbase-pro": {90, 2 * time.Second},
+}
+
+// countingConn counts the bytes read from the underlying connection.
+type countingConn struct {
+	net.Conn
+	received prometheus.Counter
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.received.Add(float64(n))
+	return n, err
 }
 
 // NewWebsocket creates a new websocket connection for the exchange.
-func NewWebsocket(appCtx context.Context, cfg *config.WS, url string) (Websocket, error) {
+// Bytes received on the connection are accounted in the metrics against the exchange and url (without query).
+// Received frames are also archived, if raw archiving is enabled.
+// Connection is made through the proxy of the exchange, if any, with its TLS config,
+// sending its custom headers on the handshake.
+func NewWebsocket(appCtx context.Context, cfg *config.WS, exchName string, wsURL string) (Websocket, error) {
+	connURL := wsURL
+	if u, err := url.Parse(wsURL); err == nil {
+		u.RawQuery = ""
+		connURL = u.String()
+	}
+	websocket := Websocket{Cfg: cfg, exchName: exchName, connURL: connURL, archive: storage.GetRawArchive(), decoder: exchangeFrameDecoder(exchName), appCtx: appCtx}
+	conn, inflater, err := websocket.dial(wsURL)
+	if err != nil {
+		return Websocket{}, err
+	}
+	websocket.conn = &wsConn{conn: conn, inflater: inflater, url: wsURL}
+	websocket.Conn = websocket.conn
+	limit := wsMessageLimits[exchName]
+	if exchCfg := wsExchanges[exchName]; exchCfg != nil && exchCfg.MessagesPer10Sec > 0 {
+		limit.messages = exchCfg.MessagesPer10Sec
+		limit.interval = 10 * time.Second
+	}
+	if limit.messages > 0 {
+		websocket.limiter = newRateLimiter(float64(limit.messages), limit.interval)
+	}
+	return websocket, nil
+}
+
+// dial makes a new connection to the websocket url, along with the inflater if permessage-deflate is negotiated.
+// If the exchange has alternative endpoints, they are tried one after the other on a failure.
+func (w *Websocket) dial(wsURL string) (net.Conn, *wsInflater, error) {
+	endpoints := wsEndpoints[w.exchName]
+	if endpoints == nil {
+		return w.dialURL(wsURL)
+	}
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, endpointURL := range endpoints.candidates(u) {
+		conn, inflater, dialErr := w.dialURL(endpointURL.String())
+		if dialErr == nil {
+			endpoints.success(endpointURL)
+			return conn, inflater, nil
+		}
+		if w.appCtx.Err() != nil {
+			return nil, nil, dialErr
+		}
+		endpoints.failure(endpointURL, dialErr)
+		err = dialErr
+	}
+	return nil, nil, err
+}
+
+// dialURL makes a new connection to the websocket url, within the connection timeout.
+func (w *Websocket) dialURL(wsURL string) (net.Conn, *wsInflater, error) {
 	var ctx context.Context
-	if cfg.ConnTimeoutSec > 0 {
-		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(cfg.ConnTimeoutSec)*time.Second)
+	if w.Cfg.ConnTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(w.appCtx, time.Duration(w.Cfg.ConnTimeoutSec)*time.Second)
 		ctx = timeoutCtx
 		defer cancel()
 	} else {
 		ctx = context.Background()
 	}
-	conn, _, _, err := ws.Dial(ctx, url)
+	var dialer ws.Dialer
+	exchCfg := wsExchanges[w.exchName]
+	if exchCfg != nil && exchCfg.PerMessageDeflate {
+		dialer.Extensions = wsDeflateOffers
+	}
+	dialer.TLSConfig = exchangeTLS(w.exchName)
+	if h := exchangeHeaders(w.exchName); h != nil {
+		dialer.Header = ws.HandshakeHeaderHTTP(h)
+	}
+	if u := proxyURL(w.exchName); u != nil {
+		netDial, err := proxyDial(u)
+		if err != nil {
+			return nil, nil, err
+		}
+		dialer.NetDial = netDial
+	}
+	conn, _, hs, err := dialer.Dial(ctx, wsURL)
 	if err != nil {
-		return Websocket{}, err
+		return nil, nil, err
 	}
-	websocket := Websocket{Conn: conn, Cfg: cfg}
-	return websocket, nil
+	conn = &countingConn{Conn: conn, received: metrics.WsReceivedBytes.WithLabelValues(w.exchName, w.connURL)}
+	return conn, newWsInflater(hs.Extensions), nil
 }
 
 // Write writes data frame on websocket connection.
 func (w *Websocket) Write(data []byte) error {
-	err := wsutil.WriteClientText(w.Conn, data)
+	return w.write(w.conn.current(), data)
+}
+
+// Subscribe writes the channel subscription frame on websocket connection.
+// Frame is also kept to be written again after an in place reconnect, if enabled for the exchange.
+func (w *Websocket) Subscribe(data []byte) error {
+	return w.write(w.conn.subscribe(data), data)
+}
+
+// write writes the data frame on the connection, once allowed by the rate limit of the exchange, if any.
+// If the connection is broken while it can be reconnected in place, the frame is dropped
+// and the connection is closed, so that the reader reconnects it.
+func (w *Websocket) write(conn net.Conn, data []byte) error {
+	if err := w.waitLimit(); err != nil {
+		return err
+	}
+	err := wsutil.WriteClientText(conn, data)
 	if err != nil {
+		if w.reconnectAttempts() > 0 && !w.conn.isClosed() {
+			_ = conn.Close()
+			return nil
+		}
 		return err
 	}
 	return nil
 }
 
+// waitLimit waits till a message is allowed by the rate limit of the exchange, if any.
+// If the app context is cancelled meanwhile, the connection is going to be closed, so the same error is returned.
+func (w *Websocket) waitLimit() error {
+	if w.limiter == nil {
+		return nil
+	}
+	if err := w.limiter.wait(w.appCtx); err != nil {
+		return net.ErrClosed
+	}
+	return nil
+}
+
 // Read reads data frame from websocket connection.
-// It also handles gzip compressed binary data frame.
+// Binary data frame is decoded by the frame decoder of the exchange, gzip decompressed if not configured.
+// If the connection is broken, it is reconnected in place, if enabled for the exchange.
 func (w *Websocket) Read() ([]byte, error) {
-	if w.Cfg.ReadTimeoutSec > 0 {
-		err := w.Conn.SetReadDeadline(time.Now().Add(time.Duration(w.Cfg.ReadTimeoutSec) * time.Second))
-		if err != nil {
-			return nil, err
-		}
-	}
-	data, dataType, err := wsutil.ReadServerData(w.Conn)
+	data, dataType, err := w.readMessage()
 	if err != nil {
 		return nil, err
 	}
+	receivedAt := time.Now()
+	if data, err = w.decode(data, dataType); err != nil {
+		return nil, err
+	}
+	if err = w.archiveFrame(receivedAt, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// decode decodes the binary message by the frame decoder of the exchange, text message is returned as it is.
+func (w *Websocket) decode(data []byte, dataType ws.OpCode) ([]byte, error) {
 	if dataType != ws.OpBinary {
 		return data, nil
 	}
+	return w.decoder(data, w.maxMessageSize())
+}
 
-	// If the server sends compressed binary data, then we need to decompress it.
-	buf := bytes.NewBuffer(data)
-	reader, err := gzip.NewReader(buf)
-	if err != nil {
-		return nil, err
+// readMessage reads the next message.
+// On any error of the connection, including no frame received within the read timeout,
+// it is reconnected and read again, if enabled for the exchange.
+// If the connection is renewed meanwhile, the next message is read from the new one.
+func (w *Websocket) readMessage() ([]byte, ws.OpCode, error) {
+	for {
+		conn, inflater, gen := w.conn.reading()
+		data, dataType, err := w.readData(conn, inflater)
+		if err == nil {
+			return data, dataType, nil
+		}
+		if w.conn.generation() != gen && !w.conn.isClosed() {
+			continue
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && !w.conn.isClosed() {
+			metrics.WsStaleConns.WithLabelValues(w.exchName, w.connURL).Inc()
+			err = fmt.Errorf("websocket connection stale, no frame received for %v : %w", w.readTimeout(), err)
+		}
+		if w.reconnectAttempts() == 0 || w.conn.isClosed() {
+			return nil, 0, err
+		}
+		if err = w.reconnect(err); err != nil {
+			return nil, 0, err
+		}
 	}
-	defer reader.Close()
-	result, err := io.ReadAll(reader)
-	if err != nil {
-		return nil, err
+}
+
+// readTimeout returns the read timeout of the exchange, or the common one if it does not have its own.
+func (w *Websocket) readTimeout() time.Duration {
+	sec := w.Cfg.ReadTimeoutSec
+	if exchCfg := wsExchanges[w.exchName]; exchCfg != nil && exchCfg.ReadTimeoutSec > 0 {
+		sec = exchCfg.ReadTimeoutSec
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// maxMessageSize returns the max size of a message in bytes, of the exchange or the common one if it does not have its own.
+func (w *Websocket) maxMessageSize() int64 {
+	kb := wsMaxMessageSizeKB
+	if w.Cfg.MaxMessageSizeKB > 0 {
+		kb = w.Cfg.MaxMessageSizeKB
+	}
+	if exchCfg := wsExchanges[w.exchName]; exchCfg != nil && exchCfg.MaxMessageSizeKB > 0 {
+		kb = exchCfg.MaxMessageSizeKB
+	}
+	return int64(kb) * 1024
+}
+
+// readData reads the next text or binary message from the connection, same as wsutil.ReadServerData.
+// Message compressed by permessage-deflate, which is marked by the rsv1 bit of its first frame,
+// is decompressed by the inflater of the connection.
+// Control frames in between are handled by replying to them.
+// Read deadline, if any, is extended on each frame, so that the pings of the exchange on a quiet market
+// keep the connection alive, while a silently dead one fails within the timeout instead of blocking forever.
+// Messages larger than the max size are dropped without reading them into memory as a whole.
+// Compressed ones fail the connection instead, as the later messages may refer to the dropped one.
+func (w *Websocket) readData(conn net.Conn, inflater *wsInflater) ([]byte, ws.OpCode, error) {
+	timeout := w.readTimeout()
+	maxSize := w.maxMessageSize()
+	controlHandler := wsutil.ControlFrameHandler(conn, ws.StateClientSide)
+	rd := wsutil.Reader{
+		Source: conn,
+		State:  ws.StateClientSide,
+
+		// Rsv1 bit is not allowed by the header check without the extension.
+		SkipHeaderCheck: inflater != nil,
+		CheckUTF8:       inflater == nil,
+		OnIntermediate:  controlHandler,
+	}
+	for {
+		if timeout > 0 {
+			if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+				return nil, 0, err
+			}
+		}
+		hdr, err := rd.NextFrame()
+		if err != nil {
+			return nil, 0, err
+		}
+		if hdr.OpCode.IsControl() {
+			if err = controlHandler(hdr, &rd); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		if hdr.OpCode&(ws.OpText|ws.OpBinary) == 0 {
+			if err = rd.Discard(); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		if hdr.Length <= maxSize {
+			data, err := io.ReadAll(io.LimitReader(&rd, maxSize+1))
+			if err != nil {
+				return nil, 0, err
+			}
+			if int64(len(data)) <= maxSize {
+				if !hdr.Rsv1() {
+					return data, hdr.OpCode, nil
+				}
+				if inflater == nil {
+					return nil, 0, errors.New("compressed websocket frame received without permessage-deflate negotiated")
+				}
+				data, err = inflater.inflate(data, maxSize)
+				return data, hdr.OpCode, err
+			}
+		}
+		metrics.WsOversizedMessages.WithLabelValues(w.exchName, w.connURL).Inc()
+		if hdr.Rsv1() {
+			return nil, 0, fmt.Errorf("compressed websocket message larger than max size of %d bytes", maxSize)
+		}
+		log.Warn().Str("exchange", w.exchName).Str("url", w.connURL).Int64("max_size", maxSize).Msg("websocket message larger than max size, dropped")
+		if err = rd.Discard(); err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// archiveFrame writes the frame to the raw archive, if enabled.
+// Compressed frames are archived after decompression, as the archive files are compressed anyway.
+func (w *Websocket) archiveFrame(receivedAt time.Time, data []byte) error {
+	if w.archive == nil {
+		return nil
 	}
-	return result, nil
+	return w.archive.Write(w.exchName, w.connURL, receivedAt, data)
 }
@@ -0,0 +1,247 @@
+package connector
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws/wsutil"
+	"github.com/milkywaybrain/cryptogalaxy/internal/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// Default values, if not configured.
+const wsReconnectGapSec = 1
+
+// wsConn is the connection of the websocket, whose underlying connection is replaced on an in place reconnect or renewal,
+// so that the exchange functions holding it need not know about the reconnect.
+// Along with the underlying connection, its inflater, url and generation, which is incremented on each replace, are kept.
+// Subscription frames written on it are kept, to be written again on the new connection.
+type wsConn struct {
+	mu       sync.Mutex
+	conn     net.Conn
+	inflater *wsInflater
+	url      string
+	gen      uint64
+	closed   bool
+	subs     [][]byte
+}
+
+// current returns the underlying connection.
+func (c *wsConn) current() net.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+// reading returns the underlying connection to read the next message from, along with its inflater and generation.
+func (c *wsConn) reading() (net.Conn, *wsInflater, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn, c.inflater, c.gen
+}
+
+// generation returns the number of times the underlying connection is replaced.
+func (c *wsConn) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// currentURL returns the url of the underlying connection.
+func (c *wsConn) currentURL() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.url
+}
+
+// subscriptions returns the subscription frames kept so far.
+func (c *wsConn) subscriptions() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]byte(nil), c.subs...)
+}
+
+// subscribe keeps the subscription frame and returns the underlying connection to write it on.
+// Both are done together, so that the frame is either written again by a reconnect, or written on the new connection.
+func (c *wsConn) subscribe(frame []byte) net.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subs = append(c.subs, append([]byte(nil), frame...))
+	return c.conn
+}
+
+// replace replaces the underlying connection with the new one to the url and returns the subscription frames to be written on it.
+// It fails if the connection is already closed by the exchange.
+func (c *wsConn) replace(conn net.Conn, inflater *wsInflater, url string) ([][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		_ = conn.Close()
+		return nil, net.ErrClosed
+	}
+	_ = c.conn.Close()
+	c.conn = conn
+	c.inflater = inflater
+	c.url = url
+	c.gen++
+	return append([][]byte(nil), c.subs...), nil
+}
+
+// isClosed returns whether the connection is closed by the exchange.
+func (c *wsConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	return c.current().Read(b)
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	return c.current().Write(b)
+}
+
+// Close closes the underlying connection, after which it is never reconnected.
+func (c *wsConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return c.conn.Close()
+}
+
+func (c *wsConn) LocalAddr() net.Addr {
+	return c.current().LocalAddr()
+}
+
+func (c *wsConn) RemoteAddr() net.Addr {
+	return c.current().RemoteAddr()
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	return c.current().SetDeadline(t)
+}
+
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.current().SetReadDeadline(t)
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return c.current().SetWriteDeadline(t)
+}
+
+// reconnectAttempts returns the number of in place reconnect attempts of the exchange, 0 if not enabled.
+func (w *Websocket) reconnectAttempts() int {
+	if exchCfg := wsExchanges[w.exchName]; exchCfg != nil {
+		return exchCfg.ReconnectAttempts
+	}
+	return 0
+}
+
+// reconnect dials the websocket url again and writes all the subscription frames on the new connection,
+// after the connection is broken by the given error.
+// It is tried for the configured number of attempts with the gap in between,
+// and the last error is returned if all of them fail, so that the exchange is restarted as usual.
+func (w *Websocket) reconnect(cause error) error {
+	gapSec := wsReconnectGapSec
+	if exchCfg := wsExchanges[w.exchName]; exchCfg != nil && exchCfg.ReconnectGapSec > 0 {
+		gapSec = exchCfg.ReconnectGapSec
+	}
+	err := cause
+	for attempt := 1; attempt <= w.reconnectAttempts(); attempt++ {
+		log.Warn().Str("exchange", w.exchName).Str("url", w.connURL).Int("attempt", attempt).Err(err).Msg("websocket connection broken, reconnecting")
+		select {
+		case <-time.After(time.Duration(gapSec) * time.Second):
+		case <-w.appCtx.Done():
+			return net.ErrClosed
+		}
+		wsURL := w.conn.currentURL()
+		conn, inflater, dialErr := w.dial(wsURL)
+		if dialErr != nil {
+			err = dialErr
+			continue
+		}
+		subs, replaceErr := w.conn.replace(conn, inflater, wsURL)
+		if replaceErr != nil {
+			return replaceErr
+		}
+		if err = w.resubscribe(conn, subs); err != nil {
+			continue
+		}
+		metrics.WsReconnects.WithLabelValues(w.exchName, w.connURL).Inc()
+		log.Info().Str("exchange", w.exchName).Str("url", w.connURL).Int("subscriptions", len(subs)).Msg("websocket reconnected")
+		return nil
+	}
+	return err
+}
+
+// Renew replaces the connection with a new one to the websocket url, e.g. with a new token of the exchange
+// before the one of the current connection expires.
+// First message of the new connection is passed to the welcome func, if any, to check the handshake of the exchange.
+// All the subscription frames are written on the new connection before replacing the current one,
+// so that no message is missed in between, and the reader continues reading from the new connection.
+// On a failure, the current connection is kept as it is.
+func (w *Websocket) Renew(wsURL string, welcome func(frame []byte) error) error {
+	conn, inflater, err := w.dial(wsURL)
+	if err != nil {
+		return err
+	}
+	if welcome != nil {
+		if err = w.welcome(conn, inflater, welcome); err != nil {
+			_ = conn.Close()
+			return err
+		}
+	}
+	subs := w.conn.subscriptions()
+	if err = w.resubscribe(conn, subs); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	allSubs, err := w.conn.replace(conn, inflater, wsURL)
+	if err != nil {
+		return err
+	}
+
+	// Frames subscribed while renewing are written on the new connection after replacing.
+	if err = w.resubscribe(conn, allSubs[len(subs):]); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	log.Info().Str("exchange", w.exchName).Str("url", w.connURL).Int("subscriptions", len(allSubs)).Msg("websocket connection renewed")
+	return nil
+}
+
+// welcome reads the first message of the new connection, within the connection timeout, and passes it to the welcome func.
+func (w *Websocket) welcome(conn net.Conn, inflater *wsInflater, welcome func(frame []byte) error) error {
+	if w.Cfg.ConnTimeoutSec > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(time.Duration(w.Cfg.ConnTimeoutSec) * time.Second)); err != nil {
+			return err
+		}
+	}
+	data, dataType, err := w.readData(conn, inflater)
+	if err != nil {
+		return err
+	}
+	if data, err = w.decode(data, dataType); err != nil {
+		return err
+	}
+	if err = welcome(data); err != nil {
+		return err
+	}
+	return conn.SetReadDeadline(time.Time{})
+}
+
+// resubscribe writes the subscription frames on the new connection, paced only by the rate limit of the exchange,
+// so that a slow subscription earlier, e.g. while waiting for the REST data, does not slow down the reconnect.
+func (w *Websocket) resubscribe(conn net.Conn, subs [][]byte) error {
+	for _, frame := range subs {
+		if err := w.waitLimit(); err != nil {
+			return err
+		}
+		if err := wsutil.WriteClientText(conn, frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
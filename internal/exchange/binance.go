@@ -2,7 +2,6 @@ package exchange
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -12,9 +11,12 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/arbitrage"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
 	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -22,60 +24,20 @@ import (
 
 // StartBinance is for starting binance exchange functions.
 func StartBinance(appCtx context.Context, markets []config.Market, retry *config.Retry, connCfg *config.Connection) error {
-
-	// If any error occurs or connection is lost, retry the exchange functions with a time gap till it reaches
-	// a configured number of retry.
-	// Retry counter will be reset back to zero if the elapsed time since the last retry is greater than the configured one.
-	var retryCount int
-	lastRetryTime := time.Now()
-
-	for {
-		err := newBinance(appCtx, markets, connCfg)
-		if err != nil {
-			log.Error().Err(err).Str("exchange", "binance").Msg("error occurred")
-			if retry.Number == 0 {
-				return errors.New("not able to connect binance exchange. please check the log for details")
-			}
-			if retry.ResetSec == 0 || time.Since(lastRetryTime).Seconds() < float64(retry.ResetSec) {
-				retryCount++
-			} else {
-				retryCount = 1
-			}
-			lastRetryTime = time.Now()
-			if retryCount > retry.Number {
-				return fmt.Errorf("not able to connect binance exchange even after %v retry. please check the log for details", retry.Number)
-			}
-
-			log.Error().Str("exchange", "binance").Int("retry", retryCount).Msg(fmt.Sprintf("retrying functions in %v seconds", retry.GapSec))
-			tick := time.NewTicker(time.Duration(retry.GapSec) * time.Second)
-			select {
-			case <-tick.C:
-				tick.Stop()
-
-			// Return, if there is any error from another exchange.
-			case <-appCtx.Done():
-				log.Error().Str("exchange", "binance").Msg("ctx canceled, return from StartBinance")
-				return appCtx.Err()
-			}
-		}
-	}
+	return supervisor.Run(appCtx, "binance", retry, func() error {
+		return newBinance(appCtx, markets, connCfg)
+	})
 }
 
 type binance struct {
-	ws             connector.Websocket
-	rest           *connector.REST
-	connCfg        *config.Connection
-	cfgMap         map[cfgLookupKey]cfgLookupVal
-	channelIds     map[int][2]string
-	ter            *storage.Terminal
-	es             *storage.ElasticSearch
-	mysql          *storage.MySQL
-	wsTerTickers   chan []storage.Ticker
-	wsTerTrades    chan []storage.Trade
-	wsMysqlTickers chan []storage.Ticker
-	wsMysqlTrades  chan []storage.Trade
-	wsEsTickers    chan []storage.Ticker
-	wsEsTrades     chan []storage.Trade
+	ws          connector.Websocket
+	rest        *connector.REST
+	connCfg     *config.Connection
+	cfgMap      map[cfgLookupKey]cfgLookupVal
+	strs        strCommits
+	marketStats *marketStats
+	candleCheck *candleCheck
+	channelIds  map[int][2]string
 }
 
 type wsSubBinance struct {
@@ -85,31 +47,73 @@ type wsSubBinance struct {
 }
 
 type wsRespBinance struct {
-	Event         string `json:"e"`
-	Symbol        string `json:"s"`
-	TradeID       uint64 `json:"t"`
-	Maker         bool   `json:"m"`
-	Qty           string `json:"q"`
-	TickerPrice   string `json:"c"`
-	TradePrice    string `json:"p"`
-	TickerTime    int64  `json:"E"`
-	TradeTime     int64  `json:"T"`
-	Code          int    `json:"code"`
-	Msg           string `json:"msg"`
-	ID            int    `json:"id"`
+	Event         string      `json:"e"`
+	Symbol        string      `json:"s"`
+	TradeID       uint64      `json:"t"`
+	Maker         bool        `json:"m"`
+	Qty           string      `json:"q"`
+	UpdateID      uint64      `json:"u"`
+	TickerPrice   string      `json:"c"`
+	BestBid       interface{} `json:"b"`
+	BestAsk       interface{} `json:"a"`
+	BestBidQty    string      `json:"B"`
+	BestAskQty    string      `json:"A"`
+	Volume        string      `json:"v"`
+	High          string      `json:"h"`
+	Low           interface{} `json:"l"`
+	TradePrice    string      `json:"p"`
+	TickerTime    int64       `json:"E"`
+	TradeTime     int64       `json:"T"`
+	Code          int         `json:"code"`
+	Msg           string      `json:"msg"`
+	ID            int         `json:"id"`
 	mktCommitName string
 
-	// This field value is not used but still need to present
-	// because otherwise json decoder does case-insensitive match with "m" and "M".
-	IsBestMatch bool `json:"M"`
+	// These field values are not used but still need to present
+	// because otherwise json decoder does case-insensitive match with "m" and "M", "c" and "C" and so on.
+	IsBestMatch  bool   `json:"M"`
+	LastTradeID  int64  `json:"L"`
+	CloseTime    int64  `json:"C"`
+	LastQty      string `json:"Q"`
+	PriceChgPcnt string `json:"P"`
 }
 
 type restRespBinance struct {
-	TradeID uint64 `json:"id"`
-	Maker   bool   `json:"isBuyerMaker"`
-	Qty     string `json:"qty"`
-	Price   string `json:"price"`
-	Time    int64  `json:"time"`
+	TradeID   uint64              `json:"id"`
+	Maker     bool                `json:"isBuyerMaker"`
+	Qty       string              `json:"qty"`
+	Price     string              `json:"price"`
+	LastPrice string              `json:"lastPrice"`
+	BidPrice  string              `json:"bidPrice"`
+	AskPrice  string              `json:"askPrice"`
+	BidQty    string              `json:"bidQty"`
+	AskQty    string              `json:"askQty"`
+	Volume    string              `json:"volume"`
+	HighPrice string              `json:"highPrice"`
+	LowPrice  string              `json:"lowPrice"`
+	Time      int64               `json:"time"`
+	Status    string              `json:"status"`
+	Symbols   []restRespBinance   `json:"symbols"`
+	Filters   []restFilterBinance `json:"filters"`
+
+	// Aggregated trade fields.
+	AggTradeID  uint64 `json:"a"`
+	AggQty      string `json:"q"`
+	AggPrice    string `json:"p"`
+	AggTime     int64  `json:"T"`
+	AggMaker    bool   `json:"m"`
+	IsBestMatch bool   `json:"M"`
+}
+
+type restBookRespBinance struct {
+	Bids [][]string `json:"bids"`
+	Asks [][]string `json:"asks"`
+}
+
+type restFilterBinance struct {
+	FilterType string `json:"filterType"`
+	TickSize   string `json:"tickSize"`
+	StepSize   string `json:"stepSize"`
 }
 
 func newBinance(appCtx context.Context, markets []config.Market, connCfg *config.Connection) error {
@@ -123,6 +127,7 @@ func newBinance(appCtx context.Context, markets []config.Market, connCfg *config
 	if err != nil {
 		return err
 	}
+	b.marketStats = newMarketStats("binance", b.cfgMap)
 
 	var (
 		wsCount   int
@@ -149,30 +154,28 @@ func newBinance(appCtx context.Context, markets []config.Market, connCfg *config
 						return b.readWs(ctx)
 					})
 
-					if b.ter != nil {
-						binanceErrGroup.Go(func() error {
-							return b.wsTickersToTerminal(ctx)
-						})
+					if b.marketStats != nil {
 						binanceErrGroup.Go(func() error {
-							return b.wsTradesToTerminal(ctx)
+							return b.marketStats.run(ctx)
 						})
 					}
 
-					if b.mysql != nil {
+					for _, str := range b.strs {
+						str := str
 						binanceErrGroup.Go(func() error {
-							return b.wsTickersToMySQL(ctx)
+							return str.wsTickers(ctx)
 						})
 						binanceErrGroup.Go(func() error {
-							return b.wsTradesToMySQL(ctx)
+							return str.wsTrades(ctx)
 						})
-					}
-
-					if b.es != nil {
 						binanceErrGroup.Go(func() error {
-							return b.wsTickersToES(ctx)
+							return str.wsRecords(ctx)
 						})
+					}
+
+					if b.candleCheck != nil {
 						binanceErrGroup.Go(func() error {
-							return b.wsTradesToES(ctx)
+							return b.candleCheck.run(ctx)
 						})
 					}
 				}
@@ -233,6 +236,7 @@ func (b *binance) cfgLookup(markets []config.Market) error {
 
 	// Configurations flat map is prepared for easy lookup later in the app.
 	b.cfgMap = make(map[cfgLookupKey]cfgLookupVal)
+	b.strs = make(strCommits)
 	b.channelIds = make(map[int][2]string)
 	for _, market := range markets {
 		var mktCommitName string
@@ -245,31 +249,21 @@ func (b *binance) cfgLookup(markets []config.Market) error {
 			key := cfgLookupKey{market: market.ID, channel: info.Channel}
 			val := cfgLookupVal{}
 			val.wsConsiderIntSec = info.WsConsiderIntSec
-			for _, str := range info.Storages {
-				switch str {
-				case "terminal":
-					val.terStr = true
-					if b.ter == nil {
-						b.ter = storage.GetTerminal()
-						b.wsTerTickers = make(chan []storage.Ticker, 1)
-						b.wsTerTrades = make(chan []storage.Trade, 1)
-					}
-				case "mysql":
-					val.mysqlStr = true
-					if b.mysql == nil {
-						b.mysql = storage.GetMySQL()
-						b.wsMysqlTickers = make(chan []storage.Ticker, 1)
-						b.wsMysqlTrades = make(chan []storage.Trade, 1)
-					}
-				case "elastic_search":
-					val.esStr = true
-					if b.es == nil {
-						b.es = storage.GetElasticSearch()
-						b.wsEsTickers = make(chan []storage.Ticker, 1)
-						b.wsEsTrades = make(chan []storage.Trade, 1)
-					}
+			val.strConsiderIntSec = info.StrConsiderIntSec
+			val.strs = b.strs.lookup(info.Storages)
+			val.candleIntervals = candleIntervals(info.CandleIntervals)
+			if info.CandleValidation != nil {
+				val.candleValidation = info.CandleValidation
+				if b.candleCheck == nil {
+					b.candleCheck = newCandleCheck("binance")
 				}
 			}
+			val.avgPriceWindows = candleIntervals(info.AvgPriceWindows)
+			val.statsInterval = time.Duration(info.StatsIntervalSec) * time.Second
+			val.tickFilter = newTickFilter(info.TickFilter)
+			val.base, val.quote = marketAssets(market)
+			val.tradeFilter = info.TradeFilter
+			val.bookLevels = bookLevels(info.BookLevels)
 
 			// Channel id is used to identify channel in subscribe success message of websocket server.
 			id++
@@ -284,7 +278,7 @@ func (b *binance) cfgLookup(markets []config.Market) error {
 }
 
 func (b *binance) connectWs(ctx context.Context) error {
-	ws, err := connector.NewWebsocket(ctx, &b.connCfg.WS, config.BinanceWebsocketURL)
+	ws, err := connector.NewWebsocket(ctx, &b.connCfg.WS, "binance", config.BinanceWebsocketURL)
 	if err != nil {
 		if !errors.Is(err, ctx.Err()) {
 			logErrStack(err)
@@ -309,8 +303,11 @@ func (b *binance) closeWsConnOnError(ctx context.Context) error {
 
 // subWsChannel sends channel subscription requests to the websocket server.
 func (b *binance) subWsChannel(market string, channel string, id int) error {
-	if channel == "ticker" {
-		channel = "miniTicker"
+	switch channel {
+	case "bbo":
+		channel = "bookTicker"
+	case "agg_trade":
+		channel = "aggTrade"
 	}
 	channel = strings.ToLower(market) + "@" + channel
 	sub := wsSubBinance{
@@ -323,7 +320,7 @@ func (b *binance) subWsChannel(market string, channel string, id int) error {
 		logErrStack(err)
 		return err
 	}
-	err = b.ws.Write(frame)
+	err = b.ws.Subscribe(frame)
 	if err != nil {
 		if errors.Is(err, net.ErrClosed) {
 			err = errors.New("context canceled")
@@ -344,14 +341,7 @@ func (b *binance) readWs(ctx context.Context) error {
 		cfgLookup[k] = v
 	}
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, b.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, b.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, b.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, b.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, b.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, b.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	for {
 		select {
@@ -379,8 +369,16 @@ func (b *binance) readWs(ctx context.Context) error {
 				return err
 			}
 
-			if wr.Event == "24hrMiniTicker" {
+			switch wr.Event {
+			case "24hrTicker":
 				wr.Event = "ticker"
+			case "aggTrade":
+				wr.Event = "agg_trade"
+			}
+
+			// Book ticker frame does not have an event type, so it is identified by the order book update id.
+			if wr.Event == "" && wr.UpdateID != 0 {
+				wr.Event = "bbo"
 			}
 
 			if wr.ID != 0 {
@@ -394,7 +392,7 @@ func (b *binance) readWs(ctx context.Context) error {
 
 			// Consider frame only in configured interval, otherwise ignore it.
 			switch wr.Event {
-			case "ticker", "trade":
+			case "ticker", "trade", "bbo", "agg_trade":
 				key := cfgLookupKey{market: wr.Symbol, channel: wr.Event}
 				val := cfgLookup[key]
 				if val.wsConsiderIntSec == 0 || time.Since(val.wsLastUpdated).Seconds() >= float64(val.wsConsiderIntSec) {
@@ -437,49 +435,100 @@ func (b *binance) processWs(ctx context.Context, wr *wsRespBinance, cd *commitDa
 		}
 		ticker.Price = price
 
+		// Best bid and ask are sent as string in ticker, but same keys are numeric order ids in trade.
+		bestBid, _ := wr.BestBid.(string)
+		ticker.BestBid, err = strconv.ParseFloat(bestBid, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		bestAsk, _ := wr.BestAsk.(string)
+		ticker.BestAsk, err = strconv.ParseFloat(bestAsk, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		ticker.Volume, err = strconv.ParseFloat(wr.Volume, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		ticker.High, err = strconv.ParseFloat(wr.High, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		// Aggregated trade frame has last trade id in the same key as low, so it is decoded as an interface.
+		low, _ := wr.Low.(string)
+		ticker.Low, err = strconv.ParseFloat(low, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
 		// Time sent is in milliseconds.
 		ticker.Timestamp = time.Unix(0, wr.TickerTime*int64(time.Millisecond)).UTC()
 
 		key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 		val := b.cfgMap[key]
-		if val.terStr {
-			cd.terTickersCount++
-			cd.terTickers = append(cd.terTickers, ticker)
-			if cd.terTickersCount == b.connCfg.Terminal.TickerCommitBuf {
-				select {
-				case b.wsTerTickers <- cd.terTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTickersCount = 0
-				cd.terTickers = nil
-			}
+		ticker.Base = val.base
+		ticker.Quote = val.quote
+		if cd.filterTicker(&ticker, key, val.tickFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTickersCount++
-			cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-			if cd.mysqlTickersCount == b.connCfg.MySQL.TickerCommitBuf {
-				select {
-				case b.wsMysqlTickers <- cd.mysqlTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTickersCount = 0
-				cd.mysqlTickers = nil
-			}
+		if !ticker.IsBadTick {
+			ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+			alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+			arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 		}
-		if val.esStr {
-			cd.esTickersCount++
-			cd.esTickers = append(cd.esTickers, ticker)
-			if cd.esTickersCount == b.connCfg.ES.TickerCommitBuf {
-				select {
-				case b.wsEsTickers <- cd.esTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTickersCount = 0
-				cd.esTickers = nil
-			}
+		if err := cd.wsTicker(ctx, key, &val, ticker); err != nil {
+			return err
+		}
+	case "bbo":
+		bbo := storage.BBO{}
+		bbo.Exchange = "binance"
+		bbo.MktID = wr.Symbol
+		bbo.MktCommitName = wr.mktCommitName
+
+		// Best bid and ask prices are sent as string in book ticker.
+		var err error
+		bidPrice, _ := wr.BestBid.(string)
+		bbo.BidPrice, err = strconv.ParseFloat(bidPrice, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		bbo.BidSize, err = strconv.ParseFloat(wr.BestBidQty, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		askPrice, _ := wr.BestAsk.(string)
+		bbo.AskPrice, err = strconv.ParseFloat(askPrice, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		bbo.AskSize, err = strconv.ParseFloat(wr.BestAskQty, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		// Time is not sent in book ticker.
+		bbo.Timestamp = time.Now().UTC()
+
+		key := cfgLookupKey{market: bbo.MktID, channel: "bbo"}
+		val := b.cfgMap[key]
+		if err := cd.wsRecord(ctx, key, &val, "bbo", bbo); err != nil {
+			return err
 		}
 	case "trade":
 		trade := storage.Trade{}
@@ -493,6 +542,7 @@ func (b *binance) processWs(ctx context.Context, wr *wsRespBinance, cd *commitDa
 		} else {
 			trade.Side = "sell"
 		}
+		trade.IsBuyerMaker = wr.Maker
 
 		size, err := strconv.ParseFloat(wr.Qty, 64)
 		if err != nil {
@@ -513,141 +563,87 @@ func (b *binance) processWs(ctx context.Context, wr *wsRespBinance, cd *commitDa
 
 		key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 		val := b.cfgMap[key]
-		if val.terStr {
-			cd.terTradesCount++
-			cd.terTrades = append(cd.terTrades, trade)
-			if cd.terTradesCount == b.connCfg.Terminal.TradeCommitBuf {
-				select {
-				case b.wsTerTrades <- cd.terTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTradesCount = 0
-				cd.terTrades = nil
-			}
+		if filterTradeRules(&trade, val.tradeFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTradesCount++
-			cd.mysqlTrades = append(cd.mysqlTrades, trade)
-			if cd.mysqlTradesCount == b.connCfg.MySQL.TradeCommitBuf {
-				select {
-				case b.wsMysqlTrades <- cd.mysqlTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTradesCount = 0
-				cd.mysqlTrades = nil
-			}
+		trade.Base = val.base
+		trade.Quote = val.quote
+		if cd.filterTrade(&trade, key, val.tickFilter) {
+			return nil
 		}
-		if val.esStr {
-			cd.esTradesCount++
-			cd.esTrades = append(cd.esTrades, trade)
-			if cd.esTradesCount == b.connCfg.ES.TradeCommitBuf {
-				select {
-				case b.wsEsTrades <- cd.esTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTradesCount = 0
-				cd.esTrades = nil
-			}
-		}
-	}
-	return nil
-}
-
-func (b *binance) wsTickersToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsTerTickers:
-			b.ter.CommitTickers(data)
-		case <-ctx.Done():
-			return ctx.Err()
+		if !trade.IsBadTick {
+			trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+			alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+			arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
 		}
-	}
-}
-
-func (b *binance) wsTradesToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsTerTrades:
-			b.ter.CommitTrades(data)
-		case <-ctx.Done():
-			return ctx.Err()
+		if err := cd.wsTrade(ctx, key, &val, trade); err != nil {
+			return err
 		}
-	}
-}
 
-func (b *binance) wsTickersToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsMysqlTickers:
-			err := b.mysql.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Candles are built from the trades, if configured.
+		for _, candle := range cd.addCandleTrade(trade, val.candleIntervals) {
+			if err := cd.wsAggregate(ctx, &val, "candle", candle); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
+			b.candleCheck.add(candle, val.candleValidation)
 		}
-	}
-}
 
-func (b *binance) wsTradesToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsMysqlTrades:
-			err := b.mysql.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Rolling average prices are calculated from the trades, if configured.
+		for _, avgPrice := range cd.addAvgPriceTrade(trade, val.avgPriceWindows) {
+			if err := cd.wsAggregate(ctx, &val, "avg_price", avgPrice); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	}
-}
 
-func (b *binance) wsTickersToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsEsTickers:
-			err := b.es.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+		// Market stats are aggregated from the trades, if configured.
+		if err := b.marketStats.add(ctx, trade); err != nil {
+			return err
 		}
-	}
-}
+	case "agg_trade":
+		trade := storage.Trade{}
+		trade.Exchange = "binance"
+		trade.MktID = wr.Symbol
+		trade.MktCommitName = wr.mktCommitName
 
-func (b *binance) wsTradesToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsEsTrades:
-			err := b.es.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+		// Aggregate trade id comes in the same key as best ask of book ticker.
+		aggTradeID, _ := wr.BestAsk.(float64)
+		trade.TradeID = strconv.FormatFloat(aggTradeID, 'f', 0, 64)
+
+		if wr.Maker {
+			trade.Side = "buy"
+		} else {
+			trade.Side = "sell"
+		}
+		trade.IsBuyerMaker = wr.Maker
+
+		size, err := strconv.ParseFloat(wr.Qty, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		trade.Size = size
+
+		price, err := strconv.ParseFloat(wr.TradePrice, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		trade.Price = price
+
+		// Time sent is in milliseconds.
+		trade.Timestamp = time.Unix(0, wr.TradeTime*int64(time.Millisecond)).UTC()
+
+		key := cfgLookupKey{market: trade.MktID, channel: "agg_trade"}
+		val := b.cfgMap[key]
+		if err := cd.wsRecord(ctx, key, &val, "agg_trade", trade); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 func (b *binance) connectRest() error {
-	rest, err := connector.GetREST()
+	rest, err := connector.GetREST("binance")
 	if err != nil {
 		logErrStack(err)
 		return err
@@ -663,23 +659,29 @@ func (b *binance) connectRest() error {
 // then sends it to different storage systems for commit through go channels.
 func (b *binance) processREST(ctx context.Context, mktID string, mktCommitName string, channel string, interval int) error {
 	var (
-		req *http.Request
-		q   url.Values
-		err error
+		req            *http.Request
+		q              url.Values
+		cursor         connector.TradeCursor
+		err            error
+		lastStatus     string
+		lastInstrument storage.Instrument
 	)
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, b.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, b.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, b.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, b.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, b.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, b.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	switch channel {
 	case "ticker":
-		req, err = b.rest.Request(ctx, "GET", config.BinanceRESTBaseURL+"ticker/price")
+		req, err = b.rest.Request(ctx, "GET", config.BinanceRESTBaseURL+"ticker/24hr")
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
+		q = req.URL.Query()
+		q.Add("symbol", mktID)
+	case "bbo":
+		req, err = b.rest.Request(ctx, "GET", config.BinanceRESTBaseURL+"ticker/bookTicker")
 		if err != nil {
 			if !errors.Is(err, ctx.Err()) {
 				logErrStack(err)
@@ -700,13 +702,63 @@ func (b *binance) processREST(ctx context.Context, mktID string, mktCommitName s
 		q.Add("symbol", mktID)
 
 		// Querying for 100 trades.
-		// If the configured interval gap is big, then maybe it will not return all the trades
-		// and if the gap is too small, maybe it will return duplicate ones.
+		// Only the latest trades are returned by the endpoint, so the ones received in the earlier poll are skipped.
+		// If the configured interval gap is big, then maybe it will not return all the trades.
 		// Better to use websocket.
 		q.Add("limit", strconv.Itoa(100))
+	case "agg_trade":
+		req, err = b.rest.Request(ctx, "GET", config.BinanceRESTBaseURL+"aggTrades")
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
+		q = req.URL.Query()
+		q.Add("symbol", mktID)
+
+		// Querying for 100 aggregated trades, walking forward from the id of the last one received in the earlier poll.
+		q.Add("limit", strconv.Itoa(100))
+		cursor = connector.TradeCursor{
+			Param:    "fromId",
+			Position: func(id string, _ time.Time) string { return id },
+			Limit:    100,
+		}
+	case "trading_status", "instrument":
+		req, err = b.rest.Request(ctx, "GET", config.BinanceRESTBaseURL+"exchangeInfo")
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
+		q = req.URL.Query()
+		q.Add("symbol", mktID)
+	case "book_metric":
+		req, err = b.rest.Request(ctx, "GET", config.BinanceRESTBaseURL+"depth")
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
+		q = req.URL.Query()
+		q.Add("symbol", mktID)
+
+		// Only few limit values are supported, so querying for the smallest one
+		// which covers all the configured levels.
+		depth := maxBookLevel(b.cfgMap[cfgLookupKey{market: mktID, channel: "book_metric"}].bookLevels)
+		limit := 100
+		for _, l := range []int{5, 10, 20, 50} {
+			if depth <= l {
+				limit = l
+				break
+			}
+		}
+		q.Add("limit", strconv.Itoa(limit))
 	}
 
-	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	tick := connector.NewPollTicker("binance", time.Duration(interval)*time.Second)
 	defer tick.Stop()
 	for {
 		select {
@@ -731,7 +783,37 @@ func (b *binance) processREST(ctx context.Context, mktID string, mktCommitName s
 				}
 				resp.Body.Close()
 
-				price, err := strconv.ParseFloat(rr.Price, 64)
+				price, err := strconv.ParseFloat(rr.LastPrice, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				bestBid, err := strconv.ParseFloat(rr.BidPrice, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				bestAsk, err := strconv.ParseFloat(rr.AskPrice, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				volume, err := strconv.ParseFloat(rr.Volume, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				high, err := strconv.ParseFloat(rr.HighPrice, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				low, err := strconv.ParseFloat(rr.LowPrice, 64)
 				if err != nil {
 					logErrStack(err)
 					return err
@@ -742,49 +824,86 @@ func (b *binance) processREST(ctx context.Context, mktID string, mktCommitName s
 					MktID:         mktID,
 					MktCommitName: mktCommitName,
 					Price:         price,
+					BestBid:       bestBid,
+					BestAsk:       bestAsk,
+					Volume:        volume,
+					High:          high,
+					Low:           low,
 					Timestamp:     time.Now().UTC(),
 				}
 
 				key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 				val := b.cfgMap[key]
-				if val.terStr {
-					cd.terTickersCount++
-					cd.terTickers = append(cd.terTickers, ticker)
-					if cd.terTickersCount == b.connCfg.Terminal.TickerCommitBuf {
-						b.ter.CommitTickers(cd.terTickers)
-						cd.terTickersCount = 0
-						cd.terTickers = nil
-					}
+				ticker.Base = val.base
+				ticker.Quote = val.quote
+				if cd.filterTicker(&ticker, key, val.tickFilter) {
+					continue
 				}
-				if val.mysqlStr {
-					cd.mysqlTickersCount++
-					cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-					if cd.mysqlTickersCount == b.connCfg.MySQL.TickerCommitBuf {
-						err := b.mysql.CommitTickers(ctx, cd.mysqlTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.mysqlTickersCount = 0
-						cd.mysqlTickers = nil
-					}
+				if !ticker.IsBadTick {
+					ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+					alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+					arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 				}
-				if val.esStr {
-					cd.esTickersCount++
-					cd.esTickers = append(cd.esTickers, ticker)
-					if cd.esTickersCount == b.connCfg.ES.TickerCommitBuf {
-						err := b.es.CommitTickers(ctx, cd.esTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.esTickersCount = 0
-						cd.esTickers = nil
+				if err := cd.restTicker(ctx, &val, ticker); err != nil {
+					return err
+				}
+			case "bbo":
+				req.URL.RawQuery = q.Encode()
+				resp, err := b.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
 					}
+					return err
+				}
+
+				rr := restRespBinance{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				bidPrice, err := strconv.ParseFloat(rr.BidPrice, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				bidSize, err := strconv.ParseFloat(rr.BidQty, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				askPrice, err := strconv.ParseFloat(rr.AskPrice, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				askSize, err := strconv.ParseFloat(rr.AskQty, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				bbo := storage.BBO{
+					Exchange:      "binance",
+					MktID:         mktID,
+					MktCommitName: mktCommitName,
+					BidPrice:      bidPrice,
+					BidSize:       bidSize,
+					AskPrice:      askPrice,
+					AskSize:       askSize,
+					Timestamp:     time.Now().UTC(),
+				}
+
+				key := cfgLookupKey{market: bbo.MktID, channel: "bbo"}
+				val := b.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "bbo", bbo); err != nil {
+					return err
 				}
 			case "trade":
 				req.URL.RawQuery = q.Encode()
@@ -836,49 +955,276 @@ func (b *binance) processREST(ctx context.Context, mktID string, mktCommitName s
 						Side:          side,
 						Size:          size,
 						Price:         price,
+						IsBuyerMaker:  r.Maker,
 						Timestamp:     timestamp,
 					}
 
+					if !cursor.New(restTradeKey(&trade), trade.Timestamp) {
+						continue
+					}
+
 					key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 					val := b.cfgMap[key]
-					if val.terStr {
-						cd.terTradesCount++
-						cd.terTrades = append(cd.terTrades, trade)
-						if cd.terTradesCount == b.connCfg.Terminal.TradeCommitBuf {
-							b.ter.CommitTrades(cd.terTrades)
-							cd.terTradesCount = 0
-							cd.terTrades = nil
-						}
+					if filterTradeRules(&trade, val.tradeFilter) {
+						continue
+					}
+					trade.Base = val.base
+					trade.Quote = val.quote
+					if cd.filterTrade(&trade, key, val.tickFilter) {
+						continue
+					}
+					if !trade.IsBadTick {
+						trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+						alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+						arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
+					}
+					if err := cd.restTrade(ctx, &val, trade); err != nil {
+						return err
 					}
-					if val.mysqlStr {
-						cd.mysqlTradesCount++
-						cd.mysqlTrades = append(cd.mysqlTrades, trade)
-						if cd.mysqlTradesCount == b.connCfg.MySQL.TradeCommitBuf {
-							err := b.mysql.CommitTrades(ctx, cd.mysqlTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.mysqlTradesCount = 0
-							cd.mysqlTrades = nil
+				}
+				cursor.Next(len(rr))
+			case "agg_trade":
+				for more := true; more; {
+					cursor.Query(q)
+					req.URL.RawQuery = q.Encode()
+					resp, err := b.rest.Do(req)
+					if err != nil {
+						if !errors.Is(err, ctx.Err()) {
+							logErrStack(err)
 						}
+						return err
+					}
+
+					rr := []restRespBinance{}
+					if err := jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+						logErrStack(err)
+						resp.Body.Close()
+						return err
 					}
-					if val.esStr {
-						cd.esTradesCount++
-						cd.esTrades = append(cd.esTrades, trade)
-						if cd.esTradesCount == b.connCfg.ES.TradeCommitBuf {
-							err := b.es.CommitTrades(ctx, cd.esTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.esTradesCount = 0
-							cd.esTrades = nil
+					resp.Body.Close()
+
+					for i := range rr {
+						r := rr[i]
+						var side string
+						if r.AggMaker {
+							side = "buy"
+						} else {
+							side = "sell"
+						}
+
+						size, err := strconv.ParseFloat(r.AggQty, 64)
+						if err != nil {
+							logErrStack(err)
+							return err
 						}
+
+						price, err := strconv.ParseFloat(r.AggPrice, 64)
+						if err != nil {
+							logErrStack(err)
+							return err
+						}
+
+						// Time sent is in milliseconds.
+						timestamp := time.Unix(0, r.AggTime*int64(time.Millisecond)).UTC()
+
+						trade := storage.Trade{
+							Exchange:      "binance",
+							MktID:         mktID,
+							MktCommitName: mktCommitName,
+							TradeID:       strconv.FormatUint(r.AggTradeID, 10),
+							Side:          side,
+							Size:          size,
+							Price:         price,
+							IsBuyerMaker:  r.AggMaker,
+							Timestamp:     timestamp,
+						}
+
+						if !cursor.New(restTradeKey(&trade), trade.Timestamp) {
+							continue
+						}
+
+						key := cfgLookupKey{market: trade.MktID, channel: "agg_trade"}
+						val := b.cfgMap[key]
+						if err := cd.restRecord(ctx, &val, "agg_trade", trade); err != nil {
+							return err
+						}
+					}
+					more = cursor.Next(len(rr))
+				}
+			case "trading_status":
+				req.URL.RawQuery = q.Encode()
+				resp, err := b.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
+					}
+					return err
+				}
+
+				rr := restRespBinance{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				if len(rr.Symbols) == 0 {
+					err = errors.New("market info is not returned by exchange")
+					logErrStack(err)
+					return err
+				}
+
+				// Exchange specific status values are converted to a common format.
+				var status string
+				switch rr.Symbols[0].Status {
+				case "TRADING":
+					status = "trading"
+				case "HALT":
+					status = "halted"
+				case "AUCTION_MATCH":
+					status = "auction"
+				default:
+					status = strings.ToLower(rr.Symbols[0].Status)
+				}
+
+				// Only the changes are stored, first one being the status at the start.
+				if status == lastStatus {
+					continue
+				}
+				lastStatus = status
+
+				tradingStatus := storage.TradingStatus{
+					Exchange:      "binance",
+					MktID:         mktID,
+					MktCommitName: mktCommitName,
+					Status:        status,
+					Timestamp:     time.Now().UTC(),
+				}
+
+				key := cfgLookupKey{market: tradingStatus.MktID, channel: "trading_status"}
+				val := b.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "trading_status", tradingStatus); err != nil {
+					return err
+				}
+			case "instrument":
+				req.URL.RawQuery = q.Encode()
+				resp, err := b.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
+					}
+					return err
+				}
+
+				rr := restRespBinance{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				if len(rr.Symbols) == 0 {
+					err = errors.New("market info is not returned by exchange")
+					logErrStack(err)
+					return err
+				}
+
+				var tickSize, lotSize float64
+				for _, filter := range rr.Symbols[0].Filters {
+					switch filter.FilterType {
+					case "PRICE_FILTER":
+						tickSize, err = strconv.ParseFloat(filter.TickSize, 64)
+					case "LOT_SIZE":
+						lotSize, err = strconv.ParseFloat(filter.StepSize, 64)
+					}
+					if err != nil {
+						logErrStack(err)
+						return err
+					}
+				}
+
+				// Exchange specific status values are converted to a common format.
+				var status string
+				switch rr.Symbols[0].Status {
+				case "TRADING":
+					status = "trading"
+				case "HALT":
+					status = "halted"
+				case "AUCTION_MATCH":
+					status = "auction"
+				default:
+					status = strings.ToLower(rr.Symbols[0].Status)
+				}
+
+				instrument := storage.Instrument{
+					Exchange:       "binance",
+					MktID:          mktID,
+					MktCommitName:  mktCommitName,
+					TickSize:       tickSize,
+					LotSize:        lotSize,
+					PricePrecision: precision(tickSize),
+					SizePrecision:  precision(lotSize),
+					Status:         status,
+				}
+
+				// Only the changes are stored, first one being the metadata at the start.
+				if instrument == lastInstrument {
+					continue
+				}
+				lastInstrument = instrument
+				instrument.Timestamp = time.Now().UTC()
+
+				key := cfgLookupKey{market: instrument.MktID, channel: "instrument"}
+				val := b.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "instrument", instrument); err != nil {
+					return err
+				}
+			case "book_metric":
+				req.URL.RawQuery = q.Encode()
+				resp, err := b.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
+					}
+					return err
+				}
+
+				rr := restBookRespBinance{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				key := cfgLookupKey{market: mktID, channel: "book_metric"}
+				val := b.cfgMap[key]
+				depth := maxBookLevel(val.bookLevels)
+
+				bids, err := parseBookSide(rr.Bids, depth)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				asks, err := parseBookSide(rr.Asks, depth)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				base := storage.BookMetric{
+					Exchange:      "binance",
+					MktID:         mktID,
+					MktCommitName: mktCommitName,
+					Timestamp:     time.Now().UTC(),
+				}
+
+				for _, bookMetric := range bookMetrics(base, bids, asks, val.bookLevels) {
+					if err := cd.restRecord(ctx, &val, "book_metric", bookMetric); err != nil {
+						return err
 					}
 				}
 			}
@@ -3,7 +3,6 @@ package exchange
 import (
 	"bytes"
 	"context"
-	"fmt"
 	"io"
 	"math"
 	"net"
@@ -15,9 +14,12 @@ import (
 	"unicode"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/arbitrage"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
 	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -25,59 +27,18 @@ import (
 
 // StartBitfinex is for starting bitfinex exchange functions.
 func StartBitfinex(appCtx context.Context, markets []config.Market, retry *config.Retry, connCfg *config.Connection) error {
-
-	// If any error occurs or connection is lost, retry the exchange functions with a time gap till it reaches
-	// a configured number of retry.
-	// Retry counter will be reset back to zero if the elapsed time since the last retry is greater than the configured one.
-	var retryCount int
-	lastRetryTime := time.Now()
-
-	for {
-		err := newBitfinex(appCtx, markets, connCfg)
-		if err != nil {
-			log.Error().Err(err).Str("exchange", "bitfinex").Msg("error occurred")
-			if retry.Number == 0 {
-				return errors.New("not able to connect bitfinex exchange. please check the log for details")
-			}
-			if retry.ResetSec == 0 || time.Since(lastRetryTime).Seconds() < float64(retry.ResetSec) {
-				retryCount++
-			} else {
-				retryCount = 1
-			}
-			lastRetryTime = time.Now()
-			if retryCount > retry.Number {
-				return fmt.Errorf("not able to connect bitfinex exchange even after %v retry. please check the log for details", retry.Number)
-			}
-
-			log.Error().Str("exchange", "bitfinex").Int("retry", retryCount).Msg(fmt.Sprintf("retrying functions in %v seconds", retry.GapSec))
-			tick := time.NewTicker(time.Duration(retry.GapSec) * time.Second)
-			select {
-			case <-tick.C:
-				tick.Stop()
-
-			// Return, if there is any error from another exchange.
-			case <-appCtx.Done():
-				log.Error().Str("exchange", "bitfinex").Msg("ctx canceled, return from StartBitfinex")
-				return appCtx.Err()
-			}
-		}
-	}
+	return supervisor.Run(appCtx, "bitfinex", retry, func() error {
+		return newBitfinex(appCtx, markets, connCfg)
+	})
 }
 
 type bitfinex struct {
-	ws             connector.Websocket
-	rest           *connector.REST
-	connCfg        *config.Connection
-	cfgMap         map[cfgLookupKey]cfgLookupVal
-	ter            *storage.Terminal
-	es             *storage.ElasticSearch
-	mysql          *storage.MySQL
-	wsTerTickers   chan []storage.Ticker
-	wsTerTrades    chan []storage.Trade
-	wsMysqlTickers chan []storage.Ticker
-	wsMysqlTrades  chan []storage.Trade
-	wsEsTickers    chan []storage.Ticker
-	wsEsTrades     chan []storage.Trade
+	ws          connector.Websocket
+	rest        *connector.REST
+	connCfg     *config.Connection
+	cfgMap      map[cfgLookupKey]cfgLookupVal
+	strs        strCommits
+	marketStats *marketStats
 }
 
 type respBitfinex []interface{}
@@ -113,6 +74,7 @@ func newBitfinex(appCtx context.Context, markets []config.Market, connCfg *confi
 	if err != nil {
 		return err
 	}
+	b.marketStats = newMarketStats("bitfinex", b.cfgMap)
 
 	var (
 		wsCount   int
@@ -138,30 +100,22 @@ func newBitfinex(appCtx context.Context, markets []config.Market, connCfg *confi
 						return b.readWs(ctx)
 					})
 
-					if b.ter != nil {
+					if b.marketStats != nil {
 						bitfinexErrGroup.Go(func() error {
-							return b.wsTickersToTerminal(ctx)
-						})
-						bitfinexErrGroup.Go(func() error {
-							return b.wsTradesToTerminal(ctx)
+							return b.marketStats.run(ctx)
 						})
 					}
 
-					if b.mysql != nil {
+					for _, str := range b.strs {
+						str := str
 						bitfinexErrGroup.Go(func() error {
-							return b.wsTickersToMySQL(ctx)
+							return str.wsTickers(ctx)
 						})
 						bitfinexErrGroup.Go(func() error {
-							return b.wsTradesToMySQL(ctx)
-						})
-					}
-
-					if b.es != nil {
-						bitfinexErrGroup.Go(func() error {
-							return b.wsTickersToES(ctx)
+							return str.wsTrades(ctx)
 						})
 						bitfinexErrGroup.Go(func() error {
-							return b.wsTradesToES(ctx)
+							return str.wsRecords(ctx)
 						})
 					}
 				}
@@ -208,6 +162,7 @@ func (b *bitfinex) cfgLookup(markets []config.Market) error {
 
 	// Configurations flat map is prepared for easy lookup later in the app.
 	b.cfgMap = make(map[cfgLookupKey]cfgLookupVal)
+	b.strs = make(strCommits)
 	for _, market := range markets {
 		var mktCommitName string
 		if market.CommitName != "" {
@@ -219,31 +174,14 @@ func (b *bitfinex) cfgLookup(markets []config.Market) error {
 			key := cfgLookupKey{market: market.ID, channel: info.Channel}
 			val := cfgLookupVal{}
 			val.wsConsiderIntSec = info.WsConsiderIntSec
-			for _, str := range info.Storages {
-				switch str {
-				case "terminal":
-					val.terStr = true
-					if b.ter == nil {
-						b.ter = storage.GetTerminal()
-						b.wsTerTickers = make(chan []storage.Ticker, 1)
-						b.wsTerTrades = make(chan []storage.Trade, 1)
-					}
-				case "mysql":
-					val.mysqlStr = true
-					if b.mysql == nil {
-						b.mysql = storage.GetMySQL()
-						b.wsMysqlTickers = make(chan []storage.Ticker, 1)
-						b.wsMysqlTrades = make(chan []storage.Trade, 1)
-					}
-				case "elastic_search":
-					val.esStr = true
-					if b.es == nil {
-						b.es = storage.GetElasticSearch()
-						b.wsEsTickers = make(chan []storage.Ticker, 1)
-						b.wsEsTrades = make(chan []storage.Trade, 1)
-					}
-				}
-			}
+			val.strConsiderIntSec = info.StrConsiderIntSec
+			val.strs = b.strs.lookup(info.Storages)
+			val.candleIntervals = candleIntervals(info.CandleIntervals)
+			val.avgPriceWindows = candleIntervals(info.AvgPriceWindows)
+			val.statsInterval = time.Duration(info.StatsIntervalSec) * time.Second
+			val.tickFilter = newTickFilter(info.TickFilter)
+			val.base, val.quote = marketAssets(market)
+			val.tradeFilter = info.TradeFilter
 			val.mktCommitName = mktCommitName
 			b.cfgMap[key] = val
 		}
@@ -252,7 +190,7 @@ func (b *bitfinex) cfgLookup(markets []config.Market) error {
 }
 
 func (b *bitfinex) connectWs(ctx context.Context) error {
-	ws, err := connector.NewWebsocket(ctx, &b.connCfg.WS, config.BitfinexWebsocketURL)
+	ws, err := connector.NewWebsocket(ctx, &b.connCfg.WS, "bitfinex", config.BitfinexWebsocketURL)
 	if err != nil {
 		if !errors.Is(err, ctx.Err()) {
 			logErrStack(err)
@@ -290,7 +228,7 @@ func (b *bitfinex) subWsChannel(market string, channel string) error {
 		logErrStack(err)
 		return err
 	}
-	err = b.ws.Write(frame)
+	err = b.ws.Subscribe(frame)
 	if err != nil {
 		if errors.Is(err, net.ErrClosed) {
 			err = errors.New("context canceled")
@@ -312,14 +250,7 @@ func (b *bitfinex) readWs(ctx context.Context) error {
 		cfgLookup[k] = v
 	}
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, b.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, b.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, b.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, b.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, b.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, b.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	for {
 		select {
@@ -455,49 +386,53 @@ func (b *bitfinex) processWs(ctx context.Context, wr *wsRespInfoBitfinex, cd *co
 			log.Error().Str("exchange", "bitfinex").Str("func", "processWs").Interface("price", wr.respBitfinex[6]).Msg("")
 			return errors.New("cannot convert ticker data field price to float")
 		}
+		if bestBid, ok := wr.respBitfinex[0].(float64); ok {
+			ticker.BestBid = bestBid
+		} else {
+			log.Error().Str("exchange", "bitfinex").Str("func", "processWs").Interface("best_bid", wr.respBitfinex[0]).Msg("")
+			return errors.New("cannot convert ticker data field best bid to float")
+		}
+		if bestAsk, ok := wr.respBitfinex[2].(float64); ok {
+			ticker.BestAsk = bestAsk
+		} else {
+			log.Error().Str("exchange", "bitfinex").Str("func", "processWs").Interface("best_ask", wr.respBitfinex[2]).Msg("")
+			return errors.New("cannot convert ticker data field best ask to float")
+		}
+		if volume, ok := wr.respBitfinex[7].(float64); ok {
+			ticker.Volume = volume
+		} else {
+			log.Error().Str("exchange", "bitfinex").Str("func", "processWs").Interface("volume", wr.respBitfinex[7]).Msg("")
+			return errors.New("cannot convert ticker data field volume to float")
+		}
+		if high, ok := wr.respBitfinex[8].(float64); ok {
+			ticker.High = high
+		} else {
+			log.Error().Str("exchange", "bitfinex").Str("func", "processWs").Interface("high", wr.respBitfinex[8]).Msg("")
+			return errors.New("cannot convert ticker data field high to float")
+		}
+		if low, ok := wr.respBitfinex[9].(float64); ok {
+			ticker.Low = low
+		} else {
+			log.Error().Str("exchange", "bitfinex").Str("func", "processWs").Interface("low", wr.respBitfinex[9]).Msg("")
+			return errors.New("cannot convert ticker data field low to float")
+		}
 
 		ticker.Timestamp = time.Now().UTC()
 
 		key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 		val := b.cfgMap[key]
-		if val.terStr {
-			cd.terTickersCount++
-			cd.terTickers = append(cd.terTickers, ticker)
-			if cd.terTickersCount == b.connCfg.Terminal.TickerCommitBuf {
-				select {
-				case b.wsTerTickers <- cd.terTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTickersCount = 0
-				cd.terTickers = nil
-			}
+		ticker.Base = val.base
+		ticker.Quote = val.quote
+		if cd.filterTicker(&ticker, key, val.tickFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTickersCount++
-			cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-			if cd.mysqlTickersCount == b.connCfg.MySQL.TickerCommitBuf {
-				select {
-				case b.wsMysqlTickers <- cd.mysqlTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTickersCount = 0
-				cd.mysqlTickers = nil
-			}
+		if !ticker.IsBadTick {
+			ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+			alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+			arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 		}
-		if val.esStr {
-			cd.esTickersCount++
-			cd.esTickers = append(cd.esTickers, ticker)
-			if cd.esTickersCount == b.connCfg.ES.TickerCommitBuf {
-				select {
-				case b.wsEsTickers <- cd.esTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTickersCount = 0
-				cd.esTickers = nil
-			}
+		if err := cd.wsTicker(ctx, key, &val, ticker); err != nil {
+			return err
 		}
 	case "trade":
 		trade := storage.Trade{}
@@ -543,141 +478,47 @@ func (b *bitfinex) processWs(ctx context.Context, wr *wsRespInfoBitfinex, cd *co
 
 		key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 		val := b.cfgMap[key]
-		if val.terStr {
-			cd.terTradesCount++
-			cd.terTrades = append(cd.terTrades, trade)
-			if cd.terTradesCount == b.connCfg.Terminal.TradeCommitBuf {
-				select {
-				case b.wsTerTrades <- cd.terTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTradesCount = 0
-				cd.terTrades = nil
-			}
+		if filterTradeRules(&trade, val.tradeFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTradesCount++
-			cd.mysqlTrades = append(cd.mysqlTrades, trade)
-			if cd.mysqlTradesCount == b.connCfg.MySQL.TradeCommitBuf {
-				select {
-				case b.wsMysqlTrades <- cd.mysqlTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTradesCount = 0
-				cd.mysqlTrades = nil
-			}
+		trade.Base = val.base
+		trade.Quote = val.quote
+		if cd.filterTrade(&trade, key, val.tickFilter) {
+			return nil
 		}
-		if val.esStr {
-			cd.esTradesCount++
-			cd.esTrades = append(cd.esTrades, trade)
-			if cd.esTradesCount == b.connCfg.ES.TradeCommitBuf {
-				select {
-				case b.wsEsTrades <- cd.esTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTradesCount = 0
-				cd.esTrades = nil
-			}
-		}
-	}
-	return nil
-}
-
-func (b *bitfinex) wsTickersToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsTerTickers:
-			b.ter.CommitTickers(data)
-		case <-ctx.Done():
-			return ctx.Err()
+		if !trade.IsBadTick {
+			trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+			alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+			arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
 		}
-	}
-}
-
-func (b *bitfinex) wsTradesToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsTerTrades:
-			b.ter.CommitTrades(data)
-		case <-ctx.Done():
-			return ctx.Err()
+		if err := cd.wsTrade(ctx, key, &val, trade); err != nil {
+			return err
 		}
-	}
-}
 
-func (b *bitfinex) wsTickersToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsMysqlTickers:
-			err := b.mysql.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Candles are built from the trades, if configured.
+		for _, candle := range cd.addCandleTrade(trade, val.candleIntervals) {
+			if err := cd.wsAggregate(ctx, &val, "candle", candle); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	}
-}
 
-func (b *bitfinex) wsTradesToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsMysqlTrades:
-			err := b.mysql.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Rolling average prices are calculated from the trades, if configured.
+		for _, avgPrice := range cd.addAvgPriceTrade(trade, val.avgPriceWindows) {
+			if err := cd.wsAggregate(ctx, &val, "avg_price", avgPrice); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	}
-}
 
-func (b *bitfinex) wsTickersToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsEsTickers:
-			err := b.es.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
-
-func (b *bitfinex) wsTradesToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsEsTrades:
-			err := b.es.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+		// Market stats are aggregated from the trades, if configured.
+		if err := b.marketStats.add(ctx, trade); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 func (b *bitfinex) connectRest() error {
-	rest, err := connector.GetREST()
+	rest, err := connector.GetREST("bitfinex")
 	if err != nil {
 		logErrStack(err)
 		return err
@@ -693,20 +534,14 @@ func (b *bitfinex) connectRest() error {
 // then sends it to different storage systems for commit through go channels.
 func (b *bitfinex) processREST(ctx context.Context, mktID string, mktCommitName string, channel string, interval int) error {
 	var (
-		req  *http.Request
-		q    url.Values
-		err  error
-		side string
+		req    *http.Request
+		q      url.Values
+		cursor connector.TradeCursor
+		err    error
+		side   string
 	)
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, b.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, b.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, b.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, b.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, b.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, b.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	switch channel {
 	case "ticker":
@@ -727,13 +562,20 @@ func (b *bitfinex) processREST(ctx context.Context, mktID string, mktCommitName
 		}
 		q = req.URL.Query()
 
-		// Querying for 100 trades, which is a max allowed for a request by the exchange.
-		// If the configured interval gap is big, then maybe it will not return all the trades.
-		// Better to use websocket.
+		// Querying for 100 trades, which is a max allowed for a request by the exchange,
+		// walking forward in ascending order from the time of the last one received in the earlier poll.
 		q.Add("limit", strconv.Itoa(100))
+		cursor = connector.TradeCursor{
+			Param: "start",
+			Position: func(_ string, t time.Time) string {
+				return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+			},
+			Forward: map[string]string{"sort": "1"},
+			Limit:   100,
+		}
 	}
 
-	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	tick := connector.NewPollTicker("bitfinex", time.Duration(interval)*time.Second)
 	defer tick.Stop()
 	for {
 		select {
@@ -764,161 +606,150 @@ func (b *bitfinex) processREST(ctx context.Context, mktID string, mktCommitName
 					log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("price", rr[6]).Msg("")
 					return errors.New("cannot convert ticker data field price to float")
 				}
+				bestBid, ok := rr[0].(float64)
+				if !ok {
+					log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("best_bid", rr[0]).Msg("")
+					return errors.New("cannot convert ticker data field best bid to float")
+				}
+				bestAsk, ok := rr[2].(float64)
+				if !ok {
+					log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("best_ask", rr[2]).Msg("")
+					return errors.New("cannot convert ticker data field best ask to float")
+				}
+				volume, ok := rr[7].(float64)
+				if !ok {
+					log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("volume", rr[7]).Msg("")
+					return errors.New("cannot convert ticker data field volume to float")
+				}
+				high, ok := rr[8].(float64)
+				if !ok {
+					log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("high", rr[8]).Msg("")
+					return errors.New("cannot convert ticker data field high to float")
+				}
+				low, ok := rr[9].(float64)
+				if !ok {
+					log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("low", rr[9]).Msg("")
+					return errors.New("cannot convert ticker data field low to float")
+				}
 
 				ticker := storage.Ticker{
 					Exchange:      "bitfinex",
 					MktID:         mktID,
 					MktCommitName: mktCommitName,
 					Price:         price,
+					BestBid:       bestBid,
+					BestAsk:       bestAsk,
+					Volume:        volume,
+					High:          high,
+					Low:           low,
 					Timestamp:     time.Now().UTC(),
 				}
 
 				key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 				val := b.cfgMap[key]
-				if val.terStr {
-					cd.terTickersCount++
-					cd.terTickers = append(cd.terTickers, ticker)
-					if cd.terTickersCount == b.connCfg.Terminal.TickerCommitBuf {
-						b.ter.CommitTickers(cd.terTickers)
-						cd.terTickersCount = 0
-						cd.terTickers = nil
-					}
+				ticker.Base = val.base
+				ticker.Quote = val.quote
+				if cd.filterTicker(&ticker, key, val.tickFilter) {
+					continue
 				}
-				if val.mysqlStr {
-					cd.mysqlTickersCount++
-					cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-					if cd.mysqlTickersCount == b.connCfg.MySQL.TickerCommitBuf {
-						err := b.mysql.CommitTickers(ctx, cd.mysqlTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.mysqlTickersCount = 0
-						cd.mysqlTickers = nil
-					}
+				if !ticker.IsBadTick {
+					ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+					alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+					arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 				}
-				if val.esStr {
-					cd.esTickersCount++
-					cd.esTickers = append(cd.esTickers, ticker)
-					if cd.esTickersCount == b.connCfg.ES.TickerCommitBuf {
-						err := b.es.CommitTickers(ctx, cd.esTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.esTickersCount = 0
-						cd.esTickers = nil
-					}
+				if err := cd.restTicker(ctx, &val, ticker); err != nil {
+					return err
 				}
 			case "trade":
 				q.Del("start")
-				req.URL.RawQuery = q.Encode()
-				resp, err := b.rest.Do(req)
-				if err != nil {
-					if !errors.Is(err, ctx.Err()) {
-						logErrStack(err)
+				for more := true; more; {
+					cursor.Query(q)
+					req.URL.RawQuery = q.Encode()
+					resp, err := b.rest.Do(req)
+					if err != nil {
+						if !errors.Is(err, ctx.Err()) {
+							logErrStack(err)
+						}
+						return err
 					}
-					return err
-				}
 
-				rr := []respBitfinex{}
-				if err := jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
-					logErrStack(err)
+					rr := []respBitfinex{}
+					if err := jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+						logErrStack(err)
+						resp.Body.Close()
+						return err
+					}
 					resp.Body.Close()
-					return err
-				}
-				resp.Body.Close()
 
-				// All the values sent are an array value, needed to access it by it's position.
-				// (Sent array has different data type values so the interface is used.)
-				for i := range rr {
-					r := rr[i]
-					tradeID, ok := r[0].(float64)
-					if !ok {
-						log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("trade id", r[0]).Msg("")
-						return errors.New("cannot convert trade data field trade id to float")
-					}
+					// All the values sent are an array value, needed to access it by it's position.
+					// (Sent array has different data type values so the interface is used.)
+					for i := range rr {
+						r := rr[i]
+						tradeID, ok := r[0].(float64)
+						if !ok {
+							log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("trade id", r[0]).Msg("")
+							return errors.New("cannot convert trade data field trade id to float")
+						}
 
-					size, ok := r[2].(float64)
-					if !ok {
-						log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("size", r[2]).Msg("")
-						return errors.New("cannot convert trade data field size to float")
-					}
-					if size > 0 {
-						side = "buy"
-					} else {
-						side = "sell"
-					}
-					size = math.Abs(size)
+						size, ok := r[2].(float64)
+						if !ok {
+							log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("size", r[2]).Msg("")
+							return errors.New("cannot convert trade data field size to float")
+						}
+						if size > 0 {
+							side = "buy"
+						} else {
+							side = "sell"
+						}
+						size = math.Abs(size)
 
-					price, ok := r[3].(float64)
-					if !ok {
-						log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("price", r[3]).Msg("")
-						return errors.New("cannot convert trade data field price to float")
-					}
+						price, ok := r[3].(float64)
+						if !ok {
+							log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("price", r[3]).Msg("")
+							return errors.New("cannot convert trade data field price to float")
+						}
 
-					timestamp, ok := r[1].(float64)
-					if !ok {
-						log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("timestamp", r[1]).Msg("")
-						return errors.New("cannot convert trade data field timestamp to float")
-					}
+						timestamp, ok := r[1].(float64)
+						if !ok {
+							log.Error().Str("exchange", "bitfinex").Str("func", "processREST").Interface("timestamp", r[1]).Msg("")
+							return errors.New("cannot convert trade data field timestamp to float")
+						}
 
-					trade := storage.Trade{
-						Exchange:      "bitfinex",
-						MktID:         mktID,
-						MktCommitName: mktCommitName,
-						TradeID:       strconv.FormatFloat(tradeID, 'f', 0, 64),
-						Side:          side,
-						Size:          size,
-						Price:         price,
-						Timestamp:     time.Unix(0, int64(timestamp)*int64(time.Millisecond)).UTC(),
-					}
+						trade := storage.Trade{
+							Exchange:      "bitfinex",
+							MktID:         mktID,
+							MktCommitName: mktCommitName,
+							TradeID:       strconv.FormatFloat(tradeID, 'f', 0, 64),
+							Side:          side,
+							Size:          size,
+							Price:         price,
+							Timestamp:     time.Unix(0, int64(timestamp)*int64(time.Millisecond)).UTC(),
+						}
 
-					key := cfgLookupKey{market: trade.MktID, channel: "trade"}
-					val := b.cfgMap[key]
-					if val.terStr {
-						cd.terTradesCount++
-						cd.terTrades = append(cd.terTrades, trade)
-						if cd.terTradesCount == b.connCfg.Terminal.TradeCommitBuf {
-							b.ter.CommitTrades(cd.terTrades)
-							cd.terTradesCount = 0
-							cd.terTrades = nil
+						if !cursor.New(restTradeKey(&trade), trade.Timestamp) {
+							continue
 						}
-					}
-					if val.mysqlStr {
-						cd.mysqlTradesCount++
-						cd.mysqlTrades = append(cd.mysqlTrades, trade)
-						if cd.mysqlTradesCount == b.connCfg.MySQL.TradeCommitBuf {
-							err := b.mysql.CommitTrades(ctx, cd.mysqlTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.mysqlTradesCount = 0
-							cd.mysqlTrades = nil
+
+						key := cfgLookupKey{market: trade.MktID, channel: "trade"}
+						val := b.cfgMap[key]
+						if filterTradeRules(&trade, val.tradeFilter) {
+							continue
 						}
-					}
-					if val.esStr {
-						cd.esTradesCount++
-						cd.esTrades = append(cd.esTrades, trade)
-						if cd.esTradesCount == b.connCfg.ES.TradeCommitBuf {
-							err := b.es.CommitTrades(ctx, cd.esTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.esTradesCount = 0
-							cd.esTrades = nil
+						trade.Base = val.base
+						trade.Quote = val.quote
+						if cd.filterTrade(&trade, key, val.tickFilter) {
+							continue
+						}
+						if !trade.IsBadTick {
+							trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+							alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+							arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
+						}
+						if err := cd.restTrade(ctx, &val, trade); err != nil {
+							return err
 						}
 					}
+					more = cursor.Next(len(rr))
 				}
 			}
 
@@ -2,8 +2,8 @@ package exchange
 
 import (
 	"context"
-	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
@@ -12,9 +12,12 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/arbitrage"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
 	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -22,60 +25,19 @@ import (
 
 // StartBitstamp is for starting bitstamp exchange functions.
 func StartBitstamp(appCtx context.Context, markets []config.Market, retry *config.Retry, connCfg *config.Connection) error {
-
-	// If any error occurs or connection is lost, retry the exchange functions with a time gap till it reaches
-	// a configured number of retry.
-	// Retry counter will be reset back to zero if the elapsed time since the last retry is greater than the configured one.
-	var retryCount int
-	lastRetryTime := time.Now()
-
-	for {
-		err := newBitstamp(appCtx, markets, connCfg)
-		if err != nil {
-			log.Error().Err(err).Str("exchange", "bitstamp").Msg("error occurred")
-			if retry.Number == 0 {
-				return errors.New("not able to connect bitstamp exchange. please check the log for details")
-			}
-			if retry.ResetSec == 0 || time.Since(lastRetryTime).Seconds() < float64(retry.ResetSec) {
-				retryCount++
-			} else {
-				retryCount = 1
-			}
-			lastRetryTime = time.Now()
-			if retryCount > retry.Number {
-				return fmt.Errorf("not able to connect bitstamp exchange even after %v retry. please check the log for details", retry.Number)
-			}
-
-			log.Error().Str("exchange", "bitstamp").Int("retry", retryCount).Msg(fmt.Sprintf("retrying functions in %v seconds", retry.GapSec))
-			tick := time.NewTicker(time.Duration(retry.GapSec) * time.Second)
-			select {
-			case <-tick.C:
-				tick.Stop()
-
-			// Return, if there is any error from another exchange.
-			case <-appCtx.Done():
-				log.Error().Str("exchange", "bitstamp").Msg("ctx canceled, return from StartBitstamp")
-				return appCtx.Err()
-			}
-		}
-	}
+	return supervisor.Run(appCtx, "bitstamp", retry, func() error {
+		return newBitstamp(appCtx, markets, connCfg)
+	})
 }
 
 type bitstamp struct {
-	ws             connector.Websocket
-	rest           *connector.REST
-	connCfg        *config.Connection
-	cfgMap         map[cfgLookupKey]cfgLookupVal
-	channelIds     map[int][2]string
-	ter            *storage.Terminal
-	es             *storage.ElasticSearch
-	mysql          *storage.MySQL
-	wsTerTickers   chan []storage.Ticker
-	wsTerTrades    chan []storage.Trade
-	wsMysqlTickers chan []storage.Ticker
-	wsMysqlTrades  chan []storage.Trade
-	wsEsTickers    chan []storage.Ticker
-	wsEsTrades     chan []storage.Trade
+	ws          connector.Websocket
+	rest        *connector.REST
+	connCfg     *config.Connection
+	cfgMap      map[cfgLookupKey]cfgLookupVal
+	strs        strCommits
+	marketStats *marketStats
+	channelIds  map[int][2]string
 }
 
 type wsRespBitstamp struct {
@@ -100,10 +62,22 @@ type restRespBitstamp struct {
 	Type        string `json:"type"`
 	Amount      string `json:"amount"`
 	TickerPrice string `json:"last"`
+	Bid         string `json:"bid"`
+	Ask         string `json:"ask"`
+	Volume      string `json:"volume"`
+	High        string `json:"high"`
+	Low         string `json:"low"`
 	TradePrice  string `json:"price"`
 	Timestamp   string `json:"date"`
 }
 
+type restInstrumentRespBitstamp struct {
+	URLSymbol       string `json:"url_symbol"`
+	BaseDecimals    int    `json:"base_decimals"`
+	CounterDecimals int    `json:"counter_decimals"`
+	Trading         string `json:"trading"`
+}
+
 func newBitstamp(appCtx context.Context, markets []config.Market, connCfg *config.Connection) error {
 
 	// If any exchange function fails, force all the other functions to stop and return.
@@ -115,6 +89,7 @@ func newBitstamp(appCtx context.Context, markets []config.Market, connCfg *confi
 	if err != nil {
 		return err
 	}
+	b.marketStats = newMarketStats("bitstamp", b.cfgMap)
 
 	var (
 		wsCount   int
@@ -141,30 +116,22 @@ func newBitstamp(appCtx context.Context, markets []config.Market, connCfg *confi
 						return b.readWs(ctx)
 					})
 
-					if b.ter != nil {
-						bitstampErrGroup.Go(func() error {
-							return b.wsTickersToTerminal(ctx)
-						})
+					if b.marketStats != nil {
 						bitstampErrGroup.Go(func() error {
-							return b.wsTradesToTerminal(ctx)
+							return b.marketStats.run(ctx)
 						})
 					}
 
-					if b.mysql != nil {
+					for _, str := range b.strs {
+						str := str
 						bitstampErrGroup.Go(func() error {
-							return b.wsTickersToMySQL(ctx)
+							return str.wsTickers(ctx)
 						})
 						bitstampErrGroup.Go(func() error {
-							return b.wsTradesToMySQL(ctx)
+							return str.wsTrades(ctx)
 						})
-					}
-
-					if b.es != nil {
 						bitstampErrGroup.Go(func() error {
-							return b.wsTickersToES(ctx)
-						})
-						bitstampErrGroup.Go(func() error {
-							return b.wsTradesToES(ctx)
+							return str.wsRecords(ctx)
 						})
 					}
 				}
@@ -218,6 +185,7 @@ func (b *bitstamp) cfgLookup(markets []config.Market) error {
 
 	// Configurations flat map is prepared for easy lookup later in the app.
 	b.cfgMap = make(map[cfgLookupKey]cfgLookupVal)
+	b.strs = make(strCommits)
 	b.channelIds = make(map[int][2]string)
 	for _, market := range markets {
 		var mktCommitName string
@@ -230,31 +198,14 @@ func (b *bitstamp) cfgLookup(markets []config.Market) error {
 			key := cfgLookupKey{market: market.ID, channel: info.Channel}
 			val := cfgLookupVal{}
 			val.wsConsiderIntSec = info.WsConsiderIntSec
-			for _, str := range info.Storages {
-				switch str {
-				case "terminal":
-					val.terStr = true
-					if b.ter == nil {
-						b.ter = storage.GetTerminal()
-						b.wsTerTickers = make(chan []storage.Ticker, 1)
-						b.wsTerTrades = make(chan []storage.Trade, 1)
-					}
-				case "mysql":
-					val.mysqlStr = true
-					if b.mysql == nil {
-						b.mysql = storage.GetMySQL()
-						b.wsMysqlTickers = make(chan []storage.Ticker, 1)
-						b.wsMysqlTrades = make(chan []storage.Trade, 1)
-					}
-				case "elastic_search":
-					val.esStr = true
-					if b.es == nil {
-						b.es = storage.GetElasticSearch()
-						b.wsEsTickers = make(chan []storage.Ticker, 1)
-						b.wsEsTrades = make(chan []storage.Trade, 1)
-					}
-				}
-			}
+			val.strConsiderIntSec = info.StrConsiderIntSec
+			val.strs = b.strs.lookup(info.Storages)
+			val.candleIntervals = candleIntervals(info.CandleIntervals)
+			val.avgPriceWindows = candleIntervals(info.AvgPriceWindows)
+			val.statsInterval = time.Duration(info.StatsIntervalSec) * time.Second
+			val.tickFilter = newTickFilter(info.TickFilter)
+			val.base, val.quote = marketAssets(market)
+			val.tradeFilter = info.TradeFilter
 			val.mktCommitName = mktCommitName
 			b.cfgMap[key] = val
 		}
@@ -263,7 +214,7 @@ func (b *bitstamp) cfgLookup(markets []config.Market) error {
 }
 
 func (b *bitstamp) connectWs(ctx context.Context) error {
-	ws, err := connector.NewWebsocket(ctx, &b.connCfg.WS, config.BitstampWebsocketURL)
+	ws, err := connector.NewWebsocket(ctx, &b.connCfg.WS, "bitstamp", config.BitstampWebsocketURL)
 	if err != nil {
 		if !errors.Is(err, ctx.Err()) {
 			logErrStack(err)
@@ -297,7 +248,7 @@ func (b *bitstamp) subWsChannel(market string) error {
 		logErrStack(err)
 		return err
 	}
-	err = b.ws.Write(frame)
+	err = b.ws.Subscribe(frame)
 	if err != nil {
 		if errors.Is(err, net.ErrClosed) {
 			err = errors.New("context canceled")
@@ -318,14 +269,7 @@ func (b *bitstamp) readWs(ctx context.Context) error {
 		cfgLookup[k] = v
 	}
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, b.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, b.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, b.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, b.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, b.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, b.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	for {
 		select {
@@ -433,44 +377,18 @@ func (b *bitstamp) processWs(ctx context.Context, wr *wsRespBitstamp, cd *commit
 
 		key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 		val := b.cfgMap[key]
-		if val.terStr {
-			cd.terTickersCount++
-			cd.terTickers = append(cd.terTickers, ticker)
-			if cd.terTickersCount == b.connCfg.Terminal.TickerCommitBuf {
-				select {
-				case b.wsTerTickers <- cd.terTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTickersCount = 0
-				cd.terTickers = nil
-			}
+		ticker.Base = val.base
+		ticker.Quote = val.quote
+		if cd.filterTicker(&ticker, key, val.tickFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTickersCount++
-			cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-			if cd.mysqlTickersCount == b.connCfg.MySQL.TickerCommitBuf {
-				select {
-				case b.wsMysqlTickers <- cd.mysqlTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTickersCount = 0
-				cd.mysqlTickers = nil
-			}
+		if !ticker.IsBadTick {
+			ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+			alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+			arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 		}
-		if val.esStr {
-			cd.esTickersCount++
-			cd.esTickers = append(cd.esTickers, ticker)
-			if cd.esTickersCount == b.connCfg.ES.TickerCommitBuf {
-				select {
-				case b.wsEsTickers <- cd.esTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTickersCount = 0
-				cd.esTickers = nil
-			}
+		if err := cd.wsTicker(ctx, key, &val, ticker); err != nil {
+			return err
 		}
 	case "trade":
 		trade := storage.Trade{}
@@ -498,141 +416,47 @@ func (b *bitstamp) processWs(ctx context.Context, wr *wsRespBitstamp, cd *commit
 
 		key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 		val := b.cfgMap[key]
-		if val.terStr {
-			cd.terTradesCount++
-			cd.terTrades = append(cd.terTrades, trade)
-			if cd.terTradesCount == b.connCfg.Terminal.TradeCommitBuf {
-				select {
-				case b.wsTerTrades <- cd.terTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTradesCount = 0
-				cd.terTrades = nil
-			}
-		}
-		if val.mysqlStr {
-			cd.mysqlTradesCount++
-			cd.mysqlTrades = append(cd.mysqlTrades, trade)
-			if cd.mysqlTradesCount == b.connCfg.MySQL.TradeCommitBuf {
-				select {
-				case b.wsMysqlTrades <- cd.mysqlTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTradesCount = 0
-				cd.mysqlTrades = nil
-			}
+		if filterTradeRules(&trade, val.tradeFilter) {
+			return nil
 		}
-		if val.esStr {
-			cd.esTradesCount++
-			cd.esTrades = append(cd.esTrades, trade)
-			if cd.esTradesCount == b.connCfg.ES.TradeCommitBuf {
-				select {
-				case b.wsEsTrades <- cd.esTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTradesCount = 0
-				cd.esTrades = nil
-			}
-		}
-	}
-	return nil
-}
-
-func (b *bitstamp) wsTickersToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsTerTickers:
-			b.ter.CommitTickers(data)
-		case <-ctx.Done():
-			return ctx.Err()
+		trade.Base = val.base
+		trade.Quote = val.quote
+		if cd.filterTrade(&trade, key, val.tickFilter) {
+			return nil
 		}
-	}
-}
-
-func (b *bitstamp) wsTradesToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsTerTrades:
-			b.ter.CommitTrades(data)
-		case <-ctx.Done():
-			return ctx.Err()
+		if !trade.IsBadTick {
+			trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+			alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+			arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
 		}
-	}
-}
-
-func (b *bitstamp) wsTickersToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsMysqlTickers:
-			err := b.mysql.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+		if err := cd.wsTrade(ctx, key, &val, trade); err != nil {
+			return err
 		}
-	}
-}
 
-func (b *bitstamp) wsTradesToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsMysqlTrades:
-			err := b.mysql.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Candles are built from the trades, if configured.
+		for _, candle := range cd.addCandleTrade(trade, val.candleIntervals) {
+			if err := cd.wsAggregate(ctx, &val, "candle", candle); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	}
-}
 
-func (b *bitstamp) wsTickersToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsEsTickers:
-			err := b.es.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Rolling average prices are calculated from the trades, if configured.
+		for _, avgPrice := range cd.addAvgPriceTrade(trade, val.avgPriceWindows) {
+			if err := cd.wsAggregate(ctx, &val, "avg_price", avgPrice); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	}
-}
 
-func (b *bitstamp) wsTradesToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsEsTrades:
-			err := b.es.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+		// Market stats are aggregated from the trades, if configured.
+		if err := b.marketStats.add(ctx, trade); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 func (b *bitstamp) connectRest() error {
-	rest, err := connector.GetREST()
+	rest, err := connector.GetREST("bitstamp")
 	if err != nil {
 		logErrStack(err)
 		return err
@@ -648,19 +472,14 @@ func (b *bitstamp) connectRest() error {
 // then sends it to different storage systems for commit through go channels.
 func (b *bitstamp) processREST(ctx context.Context, mktID string, mktCommitName string, channel string, interval int) error {
 	var (
-		req *http.Request
-		q   url.Values
-		err error
+		req            *http.Request
+		q              url.Values
+		cursor         connector.TradeCursor
+		err            error
+		lastInstrument storage.Instrument
 	)
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, b.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, b.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, b.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, b.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, b.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, b.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	switch channel {
 	case "ticker":
@@ -682,13 +501,21 @@ func (b *bitstamp) processREST(ctx context.Context, mktID string, mktCommitName
 		q = req.URL.Query()
 
 		// Querying for last 1 minute trades.
-		// If the configured interval gap is big, then maybe it will not return all the trades
-		// and if the gap is too small, maybe it will return duplicate ones.
+		// Only the latest trades are returned by the endpoint, so the ones received in the earlier poll are skipped.
+		// If the configured interval gap is big, then maybe it will not return all the trades.
 		// Better to use websocket.
 		q.Add("time", "minute")
+	case "instrument":
+		req, err = b.rest.Request(ctx, "GET", config.BitstampRESTBaseURL+"trading-pairs-info/")
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
 	}
 
-	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	tick := connector.NewPollTicker("bitstamp", time.Duration(interval)*time.Second)
 	defer tick.Stop()
 	for {
 		select {
@@ -718,54 +545,63 @@ func (b *bitstamp) processREST(ctx context.Context, mktID string, mktCommitName
 					return err
 				}
 
+				bestBid, err := strconv.ParseFloat(rr.Bid, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				bestAsk, err := strconv.ParseFloat(rr.Ask, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				volume, err := strconv.ParseFloat(rr.Volume, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				high, err := strconv.ParseFloat(rr.High, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				low, err := strconv.ParseFloat(rr.Low, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
 				ticker := storage.Ticker{
 					Exchange:      "bitstamp",
 					MktID:         mktID,
 					MktCommitName: mktCommitName,
 					Price:         price,
+					BestBid:       bestBid,
+					BestAsk:       bestAsk,
+					Volume:        volume,
+					High:          high,
+					Low:           low,
 					Timestamp:     time.Now().UTC(),
 				}
 
 				key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 				val := b.cfgMap[key]
-				if val.terStr {
-					cd.terTickersCount++
-					cd.terTickers = append(cd.terTickers, ticker)
-					if cd.terTickersCount == b.connCfg.Terminal.TickerCommitBuf {
-						b.ter.CommitTickers(cd.terTickers)
-						cd.terTickersCount = 0
-						cd.terTickers = nil
-					}
+				ticker.Base = val.base
+				ticker.Quote = val.quote
+				if cd.filterTicker(&ticker, key, val.tickFilter) {
+					continue
 				}
-				if val.mysqlStr {
-					cd.mysqlTickersCount++
-					cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-					if cd.mysqlTickersCount == b.connCfg.MySQL.TickerCommitBuf {
-						err := b.mysql.CommitTickers(ctx, cd.mysqlTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.mysqlTickersCount = 0
-						cd.mysqlTickers = nil
-					}
+				if !ticker.IsBadTick {
+					ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+					alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+					arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 				}
-				if val.esStr {
-					cd.esTickersCount++
-					cd.esTickers = append(cd.esTickers, ticker)
-					if cd.esTickersCount == b.connCfg.ES.TickerCommitBuf {
-						err := b.es.CommitTickers(ctx, cd.esTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.esTickersCount = 0
-						cd.esTickers = nil
-					}
+				if err := cd.restTicker(ctx, &val, ticker); err != nil {
+					return err
 				}
 			case "trade":
 				req.URL.RawQuery = q.Encode()
@@ -824,48 +660,95 @@ func (b *bitstamp) processREST(ctx context.Context, mktID string, mktCommitName
 						Timestamp:     time.Unix(timestamp, 0).UTC(),
 					}
 
+					if !cursor.New(restTradeKey(&trade), trade.Timestamp) {
+						continue
+					}
+
 					key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 					val := b.cfgMap[key]
-					if val.terStr {
-						cd.terTradesCount++
-						cd.terTrades = append(cd.terTrades, trade)
-						if cd.terTradesCount == b.connCfg.Terminal.TradeCommitBuf {
-							b.ter.CommitTrades(cd.terTrades)
-							cd.terTradesCount = 0
-							cd.terTrades = nil
-						}
+					if filterTradeRules(&trade, val.tradeFilter) {
+						continue
 					}
-					if val.mysqlStr {
-						cd.mysqlTradesCount++
-						cd.mysqlTrades = append(cd.mysqlTrades, trade)
-						if cd.mysqlTradesCount == b.connCfg.MySQL.TradeCommitBuf {
-							err := b.mysql.CommitTrades(ctx, cd.mysqlTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.mysqlTradesCount = 0
-							cd.mysqlTrades = nil
-						}
+					trade.Base = val.base
+					trade.Quote = val.quote
+					if cd.filterTrade(&trade, key, val.tickFilter) {
+						continue
 					}
-					if val.esStr {
-						cd.esTradesCount++
-						cd.esTrades = append(cd.esTrades, trade)
-						if cd.esTradesCount == b.connCfg.ES.TradeCommitBuf {
-							err := b.es.CommitTrades(ctx, cd.esTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.esTradesCount = 0
-							cd.esTrades = nil
-						}
+					if !trade.IsBadTick {
+						trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+						alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+						arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
+					}
+					if err := cd.restTrade(ctx, &val, trade); err != nil {
+						return err
+					}
+				}
+				cursor.Next(len(rr))
+			case "instrument":
+				resp, err := b.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
+					}
+					return err
+				}
+
+				rr := []restInstrumentRespBitstamp{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				// Exchange returns all the markets, so the configured one is picked.
+				var pair restInstrumentRespBitstamp
+				found := false
+				for _, p := range rr {
+					if p.URLSymbol == mktID {
+						pair = p
+						found = true
+						break
 					}
 				}
+				if !found {
+					err = errors.New("market info is not returned by exchange")
+					logErrStack(err)
+					return err
+				}
+
+				status := strings.ToLower(pair.Trading)
+				switch pair.Trading {
+				case "Enabled":
+					status = "trading"
+				case "Disabled":
+					status = "halted"
+				}
+
+				// Exchange gives only the decimals, so increments are derived from it.
+				instrument := storage.Instrument{
+					Exchange:       "bitstamp",
+					MktID:          mktID,
+					MktCommitName:  mktCommitName,
+					TickSize:       math.Pow10(-pair.CounterDecimals),
+					LotSize:        math.Pow10(-pair.BaseDecimals),
+					PricePrecision: pair.CounterDecimals,
+					SizePrecision:  pair.BaseDecimals,
+					Status:         status,
+				}
+
+				// Only the changes are stored, first one being the metadata at the start.
+				if instrument == lastInstrument {
+					continue
+				}
+				lastInstrument = instrument
+				instrument.Timestamp = time.Now().UTC()
+
+				key := cfgLookupKey{market: instrument.MktID, channel: "instrument"}
+				val := b.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "instrument", instrument); err != nil {
+					return err
+				}
 			}
 
 		// Return, if there is any error from another function or exchange.
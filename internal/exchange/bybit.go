@@ -2,7 +2,6 @@ package exchange
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -12,9 +11,12 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/arbitrage"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
 	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -22,43 +24,9 @@ import (
 
 // StartBybit is for starting bybit exchange functions.
 func StartBybit(appCtx context.Context, markets []config.Market, retry *config.Retry, connCfg *config.Connection) error {
-
-	// If any error occurs or connection is lost, retry the exchange functions with a time gap till it reaches
-	// a configured number of retry.
-	// Retry counter will be reset back to zero if the elapsed time since the last retry is greater than the configured one.
-	var retryCount int
-	lastRetryTime := time.Now()
-
-	for {
-		err := newBybit(appCtx, markets, connCfg)
-		if err != nil {
-			log.Error().Err(err).Str("exchange", "bybit").Msg("error occurred")
-			if retry.Number == 0 {
-				return errors.New("not able to connect bybit exchange. please check the log for details")
-			}
-			if retry.ResetSec == 0 || time.Since(lastRetryTime).Seconds() < float64(retry.ResetSec) {
-				retryCount++
-			} else {
-				retryCount = 1
-			}
-			lastRetryTime = time.Now()
-			if retryCount > retry.Number {
-				return fmt.Errorf("not able to connect bybit exchange even after %v retry. please check the log for details", retry.Number)
-			}
-
-			log.Error().Str("exchange", "bybit").Int("retry", retryCount).Msg(fmt.Sprintf("retrying functions in %v seconds", retry.GapSec))
-			tick := time.NewTicker(time.Duration(retry.GapSec) * time.Second)
-			select {
-			case <-tick.C:
-				tick.Stop()
-
-			// Return, if there is any error from another exchange.
-			case <-appCtx.Done():
-				log.Error().Str("exchange", "bybit").Msg("ctx canceled, return from StartBybit")
-				return appCtx.Err()
-			}
-		}
-	}
+	return supervisor.Run(appCtx, "bybit", retry, func() error {
+		return newBybit(appCtx, markets, connCfg)
+	})
 }
 
 type bybit struct {
@@ -66,16 +34,11 @@ type bybit struct {
 	rest           *connector.REST
 	connCfg        *config.Connection
 	cfgMap         map[cfgLookupKey]cfgLookupVal
+	strs           strCommits
+	marketStats    *marketStats
 	channelIds     map[int][2]string
-	ter            *storage.Terminal
-	es             *storage.ElasticSearch
-	mysql          *storage.MySQL
-	wsTerTickers   chan []storage.Ticker
-	wsTerTrades    chan []storage.Trade
-	wsMysqlTickers chan []storage.Ticker
-	wsMysqlTrades  chan []storage.Trade
-	wsEsTickers    chan []storage.Ticker
-	wsEsTrades     chan []storage.Trade
+	lastMarkPrices map[string]storage.MarkPrice
+	lastTickers    map[string]storage.Ticker
 }
 
 type wsSubBybit struct {
@@ -102,6 +65,12 @@ type wsRespDataBybit struct {
 	Side        string  `json:"side"`
 	Size        float64 `json:"size"`
 	TickerPrice string  `json:"index_price_e4"`
+	MarkPrice   string  `json:"mark_price_e4"`
+	BestBid     string  `json:"bid1_price_e4"`
+	BestAsk     string  `json:"ask1_price_e4"`
+	High        string  `json:"high_price_24h_e4"`
+	Low         string  `json:"low_price_24h_e4"`
+	Volume      string  `json:"volume_24h_e8"`
 	TradePrice  string  `json:"price"`
 	Time        string  `json:"trade_time_ms"`
 }
@@ -114,10 +83,37 @@ type restRespDataBybit struct {
 	Side        string    `json:"side"`
 	Size        float64   `json:"qty"`
 	TickerPrice string    `json:"last_price"`
+	MarkPrice   string    `json:"mark_price"`
+	IndexPrice  string    `json:"index_price"`
+	BestBid     string    `json:"bid_price"`
+	BestAsk     string    `json:"ask_price"`
+	High        string    `json:"high_price_24h"`
+	Low         string    `json:"low_price_24h"`
+	Volume      float64   `json:"volume_24h"`
 	TradePrice  float64   `json:"price"`
 	Time        time.Time `json:"time"`
 }
 
+type restInstrumentRespBybit struct {
+	Result []restInstrumentResultBybit `json:"result"`
+}
+
+type restInstrumentResultBybit struct {
+	Name          string                 `json:"name"`
+	Status        string                 `json:"status"`
+	PriceScale    int                    `json:"price_scale"`
+	PriceFilter   restPriceFilterBybit   `json:"price_filter"`
+	LotSizeFilter restLotSizeFilterBybit `json:"lot_size_filter"`
+}
+
+type restPriceFilterBybit struct {
+	TickSize string `json:"tick_size"`
+}
+
+type restLotSizeFilterBybit struct {
+	QtyStep float64 `json:"qty_step"`
+}
+
 func newBybit(appCtx context.Context, markets []config.Market, connCfg *config.Connection) error {
 
 	// If any exchange function fails, force all the other functions to stop and return.
@@ -129,12 +125,17 @@ func newBybit(appCtx context.Context, markets []config.Market, connCfg *config.C
 	if err != nil {
 		return err
 	}
+	b.marketStats = newMarketStats("bybit", b.cfgMap)
 
 	var (
 		wsCount   int
 		restCount int
 	)
 
+	// Ticker and mark price data are received through the same instrument info websocket channel,
+	// so subscribe to it only once per market.
+	instrumentSubs := make(map[string]bool)
+
 	for _, market := range markets {
 		for _, info := range market.Info {
 			switch info.Connector {
@@ -158,34 +159,34 @@ func newBybit(appCtx context.Context, markets []config.Market, connCfg *config.C
 						return b.readWs(ctx)
 					})
 
-					if b.ter != nil {
-						bybitErrGroup.Go(func() error {
-							return b.wsTickersToTerminal(ctx)
-						})
+					if b.marketStats != nil {
 						bybitErrGroup.Go(func() error {
-							return b.wsTradesToTerminal(ctx)
+							return b.marketStats.run(ctx)
 						})
 					}
 
-					if b.mysql != nil {
+					for _, str := range b.strs {
+						str := str
 						bybitErrGroup.Go(func() error {
-							return b.wsTickersToMySQL(ctx)
+							return str.wsTickers(ctx)
 						})
 						bybitErrGroup.Go(func() error {
-							return b.wsTradesToMySQL(ctx)
-						})
-					}
-
-					if b.es != nil {
-						bybitErrGroup.Go(func() error {
-							return b.wsTickersToES(ctx)
+							return str.wsTrades(ctx)
 						})
 						bybitErrGroup.Go(func() error {
-							return b.wsTradesToES(ctx)
+							return str.wsRecords(ctx)
 						})
 					}
 				}
 
+				if info.Channel == "ticker" || info.Channel == "mark_price" {
+					if instrumentSubs[market.ID] {
+						wsCount++
+						continue
+					}
+					instrumentSubs[market.ID] = true
+				}
+
 				err = b.subWsChannel(market.ID, info.Channel)
 				if err != nil {
 					return err
@@ -228,7 +229,10 @@ func (b *bybit) cfgLookup(markets []config.Market) error {
 
 	// Configurations flat map is prepared for easy lookup later in the app.
 	b.cfgMap = make(map[cfgLookupKey]cfgLookupVal)
+	b.strs = make(strCommits)
 	b.channelIds = make(map[int][2]string)
+	b.lastMarkPrices = make(map[string]storage.MarkPrice)
+	b.lastTickers = make(map[string]storage.Ticker)
 	for _, market := range markets {
 		var mktCommitName string
 		if market.CommitName != "" {
@@ -240,31 +244,14 @@ func (b *bybit) cfgLookup(markets []config.Market) error {
 			key := cfgLookupKey{market: market.ID, channel: info.Channel}
 			val := cfgLookupVal{}
 			val.wsConsiderIntSec = info.WsConsiderIntSec
-			for _, str := range info.Storages {
-				switch str {
-				case "terminal":
-					val.terStr = true
-					if b.ter == nil {
-						b.ter = storage.GetTerminal()
-						b.wsTerTickers = make(chan []storage.Ticker, 1)
-						b.wsTerTrades = make(chan []storage.Trade, 1)
-					}
-				case "mysql":
-					val.mysqlStr = true
-					if b.mysql == nil {
-						b.mysql = storage.GetMySQL()
-						b.wsMysqlTickers = make(chan []storage.Ticker, 1)
-						b.wsMysqlTrades = make(chan []storage.Trade, 1)
-					}
-				case "elastic_search":
-					val.esStr = true
-					if b.es == nil {
-						b.es = storage.GetElasticSearch()
-						b.wsEsTickers = make(chan []storage.Ticker, 1)
-						b.wsEsTrades = make(chan []storage.Trade, 1)
-					}
-				}
-			}
+			val.strConsiderIntSec = info.StrConsiderIntSec
+			val.strs = b.strs.lookup(info.Storages)
+			val.candleIntervals = candleIntervals(info.CandleIntervals)
+			val.avgPriceWindows = candleIntervals(info.AvgPriceWindows)
+			val.statsInterval = time.Duration(info.StatsIntervalSec) * time.Second
+			val.tickFilter = newTickFilter(info.TickFilter)
+			val.base, val.quote = marketAssets(market)
+			val.tradeFilter = info.TradeFilter
 			val.mktCommitName = mktCommitName
 			b.cfgMap[key] = val
 		}
@@ -273,7 +260,7 @@ func (b *bybit) cfgLookup(markets []config.Market) error {
 }
 
 func (b *bybit) connectWs(ctx context.Context) error {
-	ws, err := connector.NewWebsocket(ctx, &b.connCfg.WS, config.BybitWebsocketURL)
+	ws, err := connector.NewWebsocket(ctx, &b.connCfg.WS, "bybit", config.BybitWebsocketURL)
 	if err != nil {
 		if !errors.Is(err, ctx.Err()) {
 			logErrStack(err)
@@ -320,7 +307,7 @@ func (b *bybit) pingWs(ctx context.Context) error {
 
 // subWsChannel sends channel subscription requests to the websocket server.
 func (b *bybit) subWsChannel(market string, channel string) error {
-	if channel == "ticker" {
+	if channel == "ticker" || channel == "mark_price" {
 		channel = "instrument_info.100ms." + market
 	} else {
 		channel = "trade." + market
@@ -334,7 +321,7 @@ func (b *bybit) subWsChannel(market string, channel string) error {
 		logErrStack(err)
 		return err
 	}
-	err = b.ws.Write(frame)
+	err = b.ws.Subscribe(frame)
 	if err != nil {
 		if errors.Is(err, net.ErrClosed) {
 			err = errors.New("context canceled")
@@ -355,14 +342,7 @@ func (b *bybit) readWs(ctx context.Context) error {
 		cfgLookup[k] = v
 	}
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, b.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, b.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, b.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, b.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, b.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, b.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	for {
 		select {
@@ -395,7 +375,7 @@ func (b *bybit) readWs(ctx context.Context) error {
 				} else {
 					s := strings.Split(wr.Request.Args[0], ".")
 					if s[0] == "instrument_info" {
-						wr.Topic = "ticker"
+						wr.Topic = "instrument_info"
 						wr.mktID = s[2]
 					} else {
 						wr.Topic = "trade"
@@ -412,19 +392,24 @@ func (b *bybit) readWs(ctx context.Context) error {
 			}
 
 			s := strings.Split(wr.Topic, ".")
+			var channels []string
 			if s[0] == "instrument_info" {
-				wr.Topic = "ticker"
+				channels = []string{"ticker", "mark_price"}
 				wr.mktID = s[2]
 			} else {
-				wr.Topic = "trade"
+				channels = []string{"trade"}
 				wr.mktID = s[1]
 			}
 
-			// Consider frame only in configured interval, otherwise ignore it.
-			switch wr.Topic {
-			case "ticker", "trade":
-				key := cfgLookupKey{market: wr.mktID, channel: wr.Topic}
-				val := cfgLookup[key]
+			// Same frame may be needed for both ticker and mark price channels.
+			for _, channel := range channels {
+
+				// Consider frame only in configured interval, otherwise ignore it.
+				key := cfgLookupKey{market: wr.mktID, channel: channel}
+				val, ok := cfgLookup[key]
+				if !ok {
+					continue
+				}
 				if val.wsConsiderIntSec == 0 || time.Since(val.wsLastUpdated).Seconds() >= float64(val.wsConsiderIntSec) {
 					val.wsLastUpdated = time.Now()
 					wr.mktCommitName = val.mktCommitName
@@ -432,6 +417,7 @@ func (b *bybit) readWs(ctx context.Context) error {
 				} else {
 					continue
 				}
+				wr.Topic = channel
 
 				err := b.processWs(ctx, &wr, &cd)
 				if err != nil {
@@ -453,71 +439,151 @@ func (b *bybit) readWs(ctx context.Context) error {
 func (b *bybit) processWs(ctx context.Context, wr *wsRespBybit, cd *commitData) error {
 	switch wr.Topic {
 	case "ticker":
-		ticker := storage.Ticker{}
-		ticker.Exchange = "bybit"
-		ticker.MktID = wr.mktID
-		ticker.MktCommitName = wr.mktCommitName
 
-		// Received data is an object for ticker and an array for trade.
+		// Received data is an object for snapshot and an update array for delta.
+		// Delta contains only the changed values, so the rest is taken from the last known one.
 		data := wsRespUpdateBybit{}
 		if err := jsoniter.Unmarshal(wr.Data, &data); err != nil {
 			logErrStack(err)
 			return err
 		}
-		if len(data.Update) < 1 || data.Update[0].TickerPrice == "" {
-			return nil
+		if len(data.Update) < 1 {
+			snapshot := wsRespDataBybit{}
+			if err := jsoniter.Unmarshal(wr.Data, &snapshot); err != nil {
+				logErrStack(err)
+				return err
+			}
+			data.Update = append(data.Update, snapshot)
 		}
 
-		// Price sent is in scientific notation e4 string format.
-		price, err := strconv.ParseFloat(data.Update[0].TickerPrice, 64)
-		if err != nil {
-			logErrStack(err)
-			return err
+		ticker := b.lastTickers[wr.mktID]
+		ticker.Exchange = "bybit"
+		ticker.MktID = wr.mktID
+		ticker.MktCommitName = wr.mktCommitName
+
+		// Prices sent are in scientific notation e4 string format and volume in e8.
+		if data.Update[0].TickerPrice != "" {
+			val, err := strconv.ParseFloat(data.Update[0].TickerPrice, 64)
+			if err != nil {
+				logErrStack(err)
+				return err
+			}
+			ticker.Price = val / 10000
+		}
+		if data.Update[0].BestBid != "" {
+			val, err := strconv.ParseFloat(data.Update[0].BestBid, 64)
+			if err != nil {
+				logErrStack(err)
+				return err
+			}
+			ticker.BestBid = val / 10000
+		}
+		if data.Update[0].BestAsk != "" {
+			val, err := strconv.ParseFloat(data.Update[0].BestAsk, 64)
+			if err != nil {
+				logErrStack(err)
+				return err
+			}
+			ticker.BestAsk = val / 10000
+		}
+		if data.Update[0].High != "" {
+			val, err := strconv.ParseFloat(data.Update[0].High, 64)
+			if err != nil {
+				logErrStack(err)
+				return err
+			}
+			ticker.High = val / 10000
+		}
+		if data.Update[0].Low != "" {
+			val, err := strconv.ParseFloat(data.Update[0].Low, 64)
+			if err != nil {
+				logErrStack(err)
+				return err
+			}
+			ticker.Low = val / 10000
+		}
+		if data.Update[0].Volume != "" {
+			val, err := strconv.ParseFloat(data.Update[0].Volume, 64)
+			if err != nil {
+				logErrStack(err)
+				return err
+			}
+			ticker.Volume = val / 100000000
+		}
+		b.lastTickers[wr.mktID] = ticker
+		if data.Update[0].TickerPrice == "" {
+			return nil
 		}
-		ticker.Price = price / 10000
 
 		ticker.Timestamp = time.Now().UTC()
 
 		key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 		val := b.cfgMap[key]
-		if val.terStr {
-			cd.terTickersCount++
-			cd.terTickers = append(cd.terTickers, ticker)
-			if cd.terTickersCount == b.connCfg.Terminal.TickerCommitBuf {
-				select {
-				case b.wsTerTickers <- cd.terTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTickersCount = 0
-				cd.terTickers = nil
+		ticker.Base = val.base
+		ticker.Quote = val.quote
+		if cd.filterTicker(&ticker, key, val.tickFilter) {
+			return nil
+		}
+		if !ticker.IsBadTick {
+			ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+			alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+			arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
+		}
+		if err := cd.wsTicker(ctx, key, &val, ticker); err != nil {
+			return err
+		}
+	case "mark_price":
+
+		// Received data is an object for snapshot and an update array for delta.
+		// Delta contains only the changed values, so the rest is taken from the last known one.
+		data := wsRespUpdateBybit{}
+		if err := jsoniter.Unmarshal(wr.Data, &data); err != nil {
+			logErrStack(err)
+			return err
+		}
+		if len(data.Update) < 1 {
+			snapshot := wsRespDataBybit{}
+			if err := jsoniter.Unmarshal(wr.Data, &snapshot); err != nil {
+				logErrStack(err)
+				return err
 			}
+			data.Update = append(data.Update, snapshot)
 		}
-		if val.mysqlStr {
-			cd.mysqlTickersCount++
-			cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-			if cd.mysqlTickersCount == b.connCfg.MySQL.TickerCommitBuf {
-				select {
-				case b.wsMysqlTickers <- cd.mysqlTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTickersCount = 0
-				cd.mysqlTickers = nil
+
+		markPrice := b.lastMarkPrices[wr.mktID]
+		markPrice.Exchange = "bybit"
+		markPrice.MktID = wr.mktID
+		markPrice.MktCommitName = wr.mktCommitName
+
+		// Price sent is in scientific notation e4 string format.
+		if data.Update[0].MarkPrice != "" {
+			price, err := strconv.ParseFloat(data.Update[0].MarkPrice, 64)
+			if err != nil {
+				logErrStack(err)
+				return err
 			}
+			markPrice.MarkPrice = price / 10000
 		}
-		if val.esStr {
-			cd.esTickersCount++
-			cd.esTickers = append(cd.esTickers, ticker)
-			if cd.esTickersCount == b.connCfg.ES.TickerCommitBuf {
-				select {
-				case b.wsEsTickers <- cd.esTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTickersCount = 0
-				cd.esTickers = nil
+		if data.Update[0].TickerPrice != "" {
+			price, err := strconv.ParseFloat(data.Update[0].TickerPrice, 64)
+			if err != nil {
+				logErrStack(err)
+				return err
 			}
+			markPrice.IndexPrice = price / 10000
+		}
+		b.lastMarkPrices[wr.mktID] = markPrice
+		if markPrice.MarkPrice == 0 || markPrice.IndexPrice == 0 {
+			return nil
+		}
+		markPrice.Basis = markPrice.MarkPrice - markPrice.IndexPrice
+
+		markPrice.Timestamp = time.Now().UTC()
+
+		key := cfgLookupKey{market: markPrice.MktID, channel: "mark_price"}
+		val := b.cfgMap[key]
+		if err := cd.wsRecord(ctx, key, &val, "mark_price", markPrice); err != nil {
+			return err
 		}
 	case "trade":
 
@@ -534,10 +600,12 @@ func (b *bybit) processWs(ctx context.Context, wr *wsRespBybit, cd *commitData)
 			trade.MktCommitName = wr.mktCommitName
 			trade.TradeID = data.TradeID
 
+			// Side sent is of the taker, so buyer is the maker for a sell.
 			if data.Side == "Buy" {
 				trade.Side = "buy"
 			} else {
 				trade.Side = "sell"
+				trade.IsBuyerMaker = true
 			}
 
 			trade.Size = data.Size
@@ -559,142 +627,48 @@ func (b *bybit) processWs(ctx context.Context, wr *wsRespBybit, cd *commitData)
 
 			key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 			val := b.cfgMap[key]
-			if val.terStr {
-				cd.terTradesCount++
-				cd.terTrades = append(cd.terTrades, trade)
-				if cd.terTradesCount == b.connCfg.Terminal.TradeCommitBuf {
-					select {
-					case b.wsTerTrades <- cd.terTrades:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-					cd.terTradesCount = 0
-					cd.terTrades = nil
-				}
-			}
-			if val.mysqlStr {
-				cd.mysqlTradesCount++
-				cd.mysqlTrades = append(cd.mysqlTrades, trade)
-				if cd.mysqlTradesCount == b.connCfg.MySQL.TradeCommitBuf {
-					select {
-					case b.wsMysqlTrades <- cd.mysqlTrades:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-					cd.mysqlTradesCount = 0
-					cd.mysqlTrades = nil
-				}
-			}
-			if val.esStr {
-				cd.esTradesCount++
-				cd.esTrades = append(cd.esTrades, trade)
-				if cd.esTradesCount == b.connCfg.ES.TradeCommitBuf {
-					select {
-					case b.wsEsTrades <- cd.esTrades:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-					cd.esTradesCount = 0
-					cd.esTrades = nil
-				}
+			if filterTradeRules(&trade, val.tradeFilter) {
+				continue
 			}
-		}
-	}
-	return nil
-}
-
-func (b *bybit) wsTickersToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsTerTickers:
-			b.ter.CommitTickers(data)
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
-
-func (b *bybit) wsTradesToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsTerTrades:
-			b.ter.CommitTrades(data)
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
-
-func (b *bybit) wsTickersToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsMysqlTickers:
-			err := b.mysql.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+			trade.Base = val.base
+			trade.Quote = val.quote
+			if cd.filterTrade(&trade, key, val.tickFilter) {
+				continue
+			}
+			if !trade.IsBadTick {
+				trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+				alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+				arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
+			}
+			if err := cd.wsTrade(ctx, key, &val, trade); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
 
-func (b *bybit) wsTradesToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsMysqlTrades:
-			err := b.mysql.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
+			// Candles are built from the trades, if configured.
+			for _, candle := range cd.addCandleTrade(trade, val.candleIntervals) {
+				if err := cd.wsAggregate(ctx, &val, "candle", candle); err != nil {
+					return err
 				}
-				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
 
-func (b *bybit) wsTickersToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsEsTickers:
-			err := b.es.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
+			// Rolling average prices are calculated from the trades, if configured.
+			for _, avgPrice := range cd.addAvgPriceTrade(trade, val.avgPriceWindows) {
+				if err := cd.wsAggregate(ctx, &val, "avg_price", avgPrice); err != nil {
+					return err
 				}
-				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
 
-func (b *bybit) wsTradesToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-b.wsEsTrades:
-			err := b.es.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+			// Market stats are aggregated from the trades, if configured.
+			if err := b.marketStats.add(ctx, trade); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
 	}
+	return nil
 }
 
 func (b *bybit) connectRest() error {
-	rest, err := connector.GetREST()
+	rest, err := connector.GetREST("bybit")
 	if err != nil {
 		logErrStack(err)
 		return err
@@ -710,22 +684,17 @@ func (b *bybit) connectRest() error {
 // then sends it to different storage systems for commit through go channels.
 func (b *bybit) processREST(ctx context.Context, mktID string, mktCommitName string, channel string, interval int) error {
 	var (
-		req *http.Request
-		q   url.Values
-		err error
+		req            *http.Request
+		q              url.Values
+		cursor         connector.TradeCursor
+		err            error
+		lastInstrument storage.Instrument
 	)
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, b.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, b.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, b.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, b.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, b.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, b.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	switch channel {
-	case "ticker":
+	case "ticker", "mark_price":
 		req, err = b.rest.Request(ctx, "GET", config.BybitRESTBaseURL+"v2/public/tickers")
 		if err != nil {
 			if !errors.Is(err, ctx.Err()) {
@@ -747,13 +716,21 @@ func (b *bybit) processREST(ctx context.Context, mktID string, mktCommitName str
 		q.Add("symbol", mktID)
 
 		// Querying for 100 trades.
-		// If the configured interval gap is big, then maybe it will not return all the trades
-		// and if the gap is too small, maybe it will return duplicate ones.
+		// Only the latest trades are returned by the endpoint, so the ones received in the earlier poll are skipped.
+		// If the configured interval gap is big, then maybe it will not return all the trades.
 		// Better to use websocket.
 		q.Add("limit", strconv.Itoa(100))
+	case "instrument":
+		req, err = b.rest.Request(ctx, "GET", config.BybitRESTBaseURL+"v2/public/symbols")
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
 	}
 
-	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	tick := connector.NewPollTicker("bybit", time.Duration(interval)*time.Second)
 	defer tick.Stop()
 	for {
 		select {
@@ -786,54 +763,104 @@ func (b *bybit) processREST(ctx context.Context, mktID string, mktCommitName str
 					return err
 				}
 
+				bestBid, err := strconv.ParseFloat(r.BestBid, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				bestAsk, err := strconv.ParseFloat(r.BestAsk, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				high, err := strconv.ParseFloat(r.High, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				low, err := strconv.ParseFloat(r.Low, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
 				ticker := storage.Ticker{
 					Exchange:      "bybit",
 					MktID:         mktID,
 					MktCommitName: mktCommitName,
 					Price:         price,
+					BestBid:       bestBid,
+					BestAsk:       bestAsk,
+					High:          high,
+					Low:           low,
+					Volume:        r.Volume,
 					Timestamp:     time.Now().UTC(),
 				}
 
 				key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 				val := b.cfgMap[key]
-				if val.terStr {
-					cd.terTickersCount++
-					cd.terTickers = append(cd.terTickers, ticker)
-					if cd.terTickersCount == b.connCfg.Terminal.TickerCommitBuf {
-						b.ter.CommitTickers(cd.terTickers)
-						cd.terTickersCount = 0
-						cd.terTickers = nil
-					}
+				ticker.Base = val.base
+				ticker.Quote = val.quote
+				if cd.filterTicker(&ticker, key, val.tickFilter) {
+					continue
 				}
-				if val.mysqlStr {
-					cd.mysqlTickersCount++
-					cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-					if cd.mysqlTickersCount == b.connCfg.MySQL.TickerCommitBuf {
-						err := b.mysql.CommitTickers(ctx, cd.mysqlTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.mysqlTickersCount = 0
-						cd.mysqlTickers = nil
-					}
+				if !ticker.IsBadTick {
+					ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+					alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+					arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 				}
-				if val.esStr {
-					cd.esTickersCount++
-					cd.esTickers = append(cd.esTickers, ticker)
-					if cd.esTickersCount == b.connCfg.ES.TickerCommitBuf {
-						err := b.es.CommitTickers(ctx, cd.esTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.esTickersCount = 0
-						cd.esTickers = nil
+				if err := cd.restTicker(ctx, &val, ticker); err != nil {
+					return err
+				}
+			case "mark_price":
+				req.URL.RawQuery = q.Encode()
+				resp, err := b.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
 					}
+					return err
+				}
+
+				rr := restRespBybit{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				r := rr.Result[0]
+
+				markPriceVal, err := strconv.ParseFloat(r.MarkPrice, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				indexPrice, err := strconv.ParseFloat(r.IndexPrice, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				markPrice := storage.MarkPrice{
+					Exchange:      "bybit",
+					MktID:         mktID,
+					MktCommitName: mktCommitName,
+					MarkPrice:     markPriceVal,
+					IndexPrice:    indexPrice,
+					Basis:         markPriceVal - indexPrice,
+					Timestamp:     time.Now().UTC(),
+				}
+
+				key := cfgLookupKey{market: markPrice.MktID, channel: "mark_price"}
+				val := b.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "mark_price", markPrice); err != nil {
+					return err
 				}
 			case "trade":
 				req.URL.RawQuery = q.Encode()
@@ -869,51 +896,101 @@ func (b *bybit) processREST(ctx context.Context, mktID string, mktCommitName str
 						Side:          side,
 						Size:          r.Size,
 						Price:         r.TradePrice,
+						IsBuyerMaker:  side == "sell",
 						Timestamp:     r.Time,
 					}
 
+					if !cursor.New(restTradeKey(&trade), trade.Timestamp) {
+						continue
+					}
+
 					key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 					val := b.cfgMap[key]
-					if val.terStr {
-						cd.terTradesCount++
-						cd.terTrades = append(cd.terTrades, trade)
-						if cd.terTradesCount == b.connCfg.Terminal.TradeCommitBuf {
-							b.ter.CommitTrades(cd.terTrades)
-							cd.terTradesCount = 0
-							cd.terTrades = nil
-						}
+					if filterTradeRules(&trade, val.tradeFilter) {
+						continue
 					}
-					if val.mysqlStr {
-						cd.mysqlTradesCount++
-						cd.mysqlTrades = append(cd.mysqlTrades, trade)
-						if cd.mysqlTradesCount == b.connCfg.MySQL.TradeCommitBuf {
-							err := b.mysql.CommitTrades(ctx, cd.mysqlTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.mysqlTradesCount = 0
-							cd.mysqlTrades = nil
-						}
+					trade.Base = val.base
+					trade.Quote = val.quote
+					if cd.filterTrade(&trade, key, val.tickFilter) {
+						continue
 					}
-					if val.esStr {
-						cd.esTradesCount++
-						cd.esTrades = append(cd.esTrades, trade)
-						if cd.esTradesCount == b.connCfg.ES.TradeCommitBuf {
-							err := b.es.CommitTrades(ctx, cd.esTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.esTradesCount = 0
-							cd.esTrades = nil
-						}
+					if !trade.IsBadTick {
+						trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+						alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+						arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
+					}
+					if err := cd.restTrade(ctx, &val, trade); err != nil {
+						return err
 					}
 				}
+				cursor.Next(len(rr.Result))
+			case "instrument":
+				resp, err := b.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
+					}
+					return err
+				}
+
+				rr := restInstrumentRespBybit{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				// Exchange returns all the markets, so the configured one is picked.
+				var symbol restInstrumentResultBybit
+				found := false
+				for _, s := range rr.Result {
+					if s.Name == mktID {
+						symbol = s
+						found = true
+						break
+					}
+				}
+				if !found {
+					err = errors.New("market info is not returned by exchange")
+					logErrStack(err)
+					return err
+				}
+
+				tickSize, err := strconv.ParseFloat(symbol.PriceFilter.TickSize, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				status := strings.ToLower(symbol.Status)
+				if symbol.Status == "Trading" {
+					status = "trading"
+				}
+
+				instrument := storage.Instrument{
+					Exchange:       "bybit",
+					MktID:          mktID,
+					MktCommitName:  mktCommitName,
+					TickSize:       tickSize,
+					LotSize:        symbol.LotSizeFilter.QtyStep,
+					PricePrecision: symbol.PriceScale,
+					SizePrecision:  precision(symbol.LotSizeFilter.QtyStep),
+					Status:         status,
+				}
+
+				// Only the changes are stored, first one being the metadata at the start.
+				if instrument == lastInstrument {
+					continue
+				}
+				lastInstrument = instrument
+				instrument.Timestamp = time.Now().UTC()
+
+				key := cfgLookupKey{market: instrument.MktID, channel: "instrument"}
+				val := b.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "instrument", instrument); err != nil {
+					return err
+				}
 			}
 
 		// Return, if there is any error from another function or exchange.
@@ -0,0 +1,328 @@
+package exchange
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
+	"github.com/milkywaybrain/cryptogalaxy/internal/metrics"
+	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Default values, if not configured.
+const (
+	candleCheckDelaySec = 10
+	candleCheckQueue    = 1000
+)
+
+// klineFetcher fetches the kline of the market for the candle interval starting at the time
+// through the REST API of the exchange.
+// It returns false if the exchange has no kline for the interval, e.g. the interval is not supported by it.
+type klineFetcher func(ctx context.Context, rest *connector.REST, mktID string, interval time.Duration, start time.Time) (storage.Candle, bool, error)
+
+// klineFetchers are the kline fetchers of the exchanges supporting the candle validation.
+var klineFetchers = map[string]klineFetcher{
+	"binance": binanceKline,
+	"kucoin":  kucoinKline,
+}
+
+// CandleValidationSupported tells whether the candles built from the trades of the exchange can be validated.
+func CandleValidationSupported(exchName string) bool {
+	_, ok := klineFetchers[exchName]
+	return ok
+}
+
+// candleCheck validates the candles built from the trades of an exchange against the klines of the exchange,
+// so that the trades missed by the app, e.g. during a reconnect, show up as a divergence.
+// Candles are queued by the websocket reader and validated by a separate go routine,
+// once the kline of the exchange is expected to be final.
+type candleCheck struct {
+	exchange string
+	fetch    klineFetcher
+	queue    chan candleCheckReq
+}
+
+// candleCheckReq is a completed candle queued for validation.
+type candleCheckReq struct {
+	candle   storage.Candle
+	interval time.Duration
+	cfg      *config.CandleValidation
+}
+
+// newCandleCheck returns the candle validator of the exchange, nil if it is not supported.
+func newCandleCheck(exchName string) *candleCheck {
+	fetch, ok := klineFetchers[exchName]
+	if !ok {
+		return nil
+	}
+	return &candleCheck{
+		exchange: exchName,
+		fetch:    fetch,
+		queue:    make(chan candleCheckReq, candleCheckQueue),
+	}
+}
+
+// add queues the completed candle for validation, if it is configured for the market.
+// It never blocks the websocket reader, if the queue is full because of a slow REST API, the candle is not validated.
+func (c *candleCheck) add(candle storage.Candle, cfg *config.CandleValidation) {
+	if c == nil || cfg == nil {
+		return
+	}
+	interval, err := time.ParseDuration(candle.Interval)
+	if err != nil {
+		return
+	}
+	select {
+	case c.queue <- candleCheckReq{candle: candle, interval: interval, cfg: cfg}:
+	default:
+		log.Debug().Str("exchange", c.exchange).Str("market", candle.MktID).Msg("candle validation queue is full, skipping candle")
+	}
+}
+
+// run validates the queued candles till the context is cancelled.
+// Each candle is validated after the configured delay from the end of its interval,
+// as the exchanges take a while to include all the trades in the kline.
+// Failures of the kline requests are only logged, they do not stop the exchange.
+func (c *candleCheck) run(ctx context.Context) error {
+	rest, err := connector.GetREST(c.exchange)
+	if err != nil {
+		logErrStack(err)
+		return err
+	}
+	for {
+		select {
+		case req := <-c.queue:
+			delay := time.Duration(req.cfg.DelaySec) * time.Second
+			if delay == 0 {
+				delay = candleCheckDelaySec * time.Second
+			}
+			if wait := time.Until(req.candle.Timestamp.Add(req.interval + delay)); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				}
+			}
+			if err := c.validate(ctx, rest, req); err != nil {
+				if errors.Is(err, ctx.Err()) {
+					return err
+				}
+				log.Error().Err(err).Str("exchange", c.exchange).Str("market", req.candle.MktID).Str("interval", req.candle.Interval).Msg("candle validation failed")
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// validate compares the candle with the kline of the exchange, counting the result in the metrics
+// and raising an alert for each field diverging more than the configured tolerance.
+func (c *candleCheck) validate(ctx context.Context, rest *connector.REST, req candleCheckReq) error {
+	candle := req.candle
+	kline, ok, err := c.fetch(ctx, rest, candle.MktID, req.interval, candle.Timestamp)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		metrics.CandleValidations.WithLabelValues(c.exchange, candle.MktCommitName, candle.Interval, "missing").Inc()
+		return nil
+	}
+	fields := []struct {
+		name      string
+		value     float64
+		expected  float64
+		tolerance float64
+	}{
+		{"open", candle.Open, kline.Open, req.cfg.TolerancePercent},
+		{"high", candle.High, kline.High, req.cfg.TolerancePercent},
+		{"low", candle.Low, kline.Low, req.cfg.TolerancePercent},
+		{"close", candle.Close, kline.Close, req.cfg.TolerancePercent},
+		{"volume", candle.Volume, kline.Volume, req.cfg.VolumeTolerancePercent},
+	}
+	result := "match"
+	for _, f := range fields {
+		diff := divergence(f.value, f.expected)
+		if diff <= f.tolerance {
+			continue
+		}
+		result = "divergence"
+		log.Warn().Str("exchange", c.exchange).Str("market", candle.MktCommitName).Str("interval", candle.Interval).Time("start", candle.Timestamp).
+			Str("field", f.name).Float64("value", f.value).Float64("kline", f.expected).Float64("divergence_percent", diff).Msg("candle diverges from exchange kline")
+		alert.Send(alert.Alert{
+			Type:             alert.TypeCandle,
+			Exchange:         c.exchange,
+			Market:           candle.MktCommitName,
+			Price:            f.value,
+			ReferencePrice:   f.expected,
+			ChangePercent:    diff,
+			Interval:         candle.Interval,
+			Field:            f.name,
+			ThresholdPercent: f.tolerance,
+			Timestamp:        candle.Timestamp,
+		})
+	}
+	metrics.CandleValidations.WithLabelValues(c.exchange, candle.MktCommitName, candle.Interval, result).Inc()
+	return nil
+}
+
+// divergence returns the difference of the value from the expected one, in percentage of the expected one.
+func divergence(value float64, expected float64) float64 {
+	if expected == 0 {
+		if value == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return math.Abs(value-expected) / math.Abs(expected) * 100
+}
+
+// binanceKlineIntervals are the kline intervals of binance by the candle interval.
+var binanceKlineIntervals = map[time.Duration]string{
+	time.Second:      "1s",
+	time.Minute:      "1m",
+	3 * time.Minute:  "3m",
+	5 * time.Minute:  "5m",
+	15 * time.Minute: "15m",
+	30 * time.Minute: "30m",
+	time.Hour:        "1h",
+	2 * time.Hour:    "2h",
+	4 * time.Hour:    "4h",
+	6 * time.Hour:    "6h",
+	8 * time.Hour:    "8h",
+	12 * time.Hour:   "12h",
+	24 * time.Hour:   "1d",
+}
+
+// binanceKline fetches the kline of the market from binance.
+// Each kline is an array of open time in milliseconds, open, high, low, close, volume, close time and so on.
+func binanceKline(ctx context.Context, rest *connector.REST, mktID string, interval time.Duration, start time.Time) (storage.Candle, bool, error) {
+	klineInterval, ok := binanceKlineIntervals[interval]
+	if !ok {
+		return storage.Candle{}, false, nil
+	}
+	req, err := rest.Request(ctx, "GET", config.BinanceRESTBaseURL+"klines")
+	if err != nil {
+		return storage.Candle{}, false, err
+	}
+	q := req.URL.Query()
+	q.Add("symbol", mktID)
+	q.Add("interval", klineInterval)
+	q.Add("startTime", strconv.FormatInt(start.UnixNano()/int64(time.Millisecond), 10))
+	q.Add("limit", "1")
+	req.URL.RawQuery = q.Encode()
+
+	var klines [][]interface{}
+	if err = getKlines(rest, req, &klines); err != nil {
+		return storage.Candle{}, false, err
+	}
+	if len(klines) == 0 || len(klines[0]) < 6 {
+		return storage.Candle{}, false, nil
+	}
+	openTime, ok := klines[0][0].(float64)
+	if !ok || int64(openTime) != start.UnixNano()/int64(time.Millisecond) {
+		return storage.Candle{}, false, nil
+	}
+	return parseKline(klines[0][1], klines[0][2], klines[0][3], klines[0][4], klines[0][5])
+}
+
+// kucoinKlineIntervals are the kline types of kucoin by the candle interval.
+var kucoinKlineIntervals = map[time.Duration]string{
+	time.Minute:      "1min",
+	3 * time.Minute:  "3min",
+	5 * time.Minute:  "5min",
+	15 * time.Minute: "15min",
+	30 * time.Minute: "30min",
+	time.Hour:        "1hour",
+	2 * time.Hour:    "2hour",
+	4 * time.Hour:    "4hour",
+	6 * time.Hour:    "6hour",
+	8 * time.Hour:    "8hour",
+	12 * time.Hour:   "12hour",
+	24 * time.Hour:   "1day",
+}
+
+// kucoinKline fetches the kline of the market from kucoin.
+// Each kline is an array of start time in seconds, open, close, high, low, volume and turnover, all as strings.
+func kucoinKline(ctx context.Context, rest *connector.REST, mktID string, interval time.Duration, start time.Time) (storage.Candle, bool, error) {
+	klineType, ok := kucoinKlineIntervals[interval]
+	if !ok {
+		return storage.Candle{}, false, nil
+	}
+	req, err := rest.Request(ctx, "GET", config.KucoinRESTBaseURL+"market/candles")
+	if err != nil {
+		return storage.Candle{}, false, err
+	}
+	q := req.URL.Query()
+	q.Add("symbol", mktID)
+	q.Add("type", klineType)
+	q.Add("startAt", strconv.FormatInt(start.Unix(), 10))
+	q.Add("endAt", strconv.FormatInt(start.Add(interval).Unix(), 10))
+	req.URL.RawQuery = q.Encode()
+
+	var resp struct {
+		Data [][]interface{} `json:"data"`
+	}
+	if err = getKlines(rest, req, &resp); err != nil {
+		return storage.Candle{}, false, err
+	}
+
+	// Klines are returned latest first, so the one of the interval is searched by its start time.
+	for _, kline := range resp.Data {
+		if len(kline) < 6 || kline[0] != strconv.FormatInt(start.Unix(), 10) {
+			continue
+		}
+		return parseKline(kline[1], kline[3], kline[4], kline[2], kline[5])
+	}
+	return storage.Candle{}, false, nil
+}
+
+// getKlines makes the kline request and decodes its response.
+func getKlines(rest *connector.REST, req *http.Request, v interface{}) error {
+	resp, err := rest.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("kline request failed with status %s", resp.Status)
+	}
+	return jsoniter.NewDecoder(resp.Body).Decode(v)
+}
+
+// parseKline parses the open, high, low, close and volume of a kline, which are sent as strings.
+func parseKline(open, high, low, close, volume interface{}) (storage.Candle, bool, error) {
+	var (
+		candle storage.Candle
+		err    error
+	)
+	values := []struct {
+		value interface{}
+		field *float64
+	}{
+		{open, &candle.Open},
+		{high, &candle.High},
+		{low, &candle.Low},
+		{close, &candle.Close},
+		{volume, &candle.Volume},
+	}
+	for _, v := range values {
+		s, ok := v.value.(string)
+		if !ok {
+			return candle, false, errors.New("kline value is not a string")
+		}
+		if *v.field, err = strconv.ParseFloat(s, 64); err != nil {
+			return candle, false, err
+		}
+	}
+	return candle, true, nil
+}
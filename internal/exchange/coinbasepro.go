@@ -2,7 +2,6 @@ package exchange
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -11,9 +10,12 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/arbitrage"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
 	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -21,59 +23,19 @@ import (
 
 // StartCoinbasePro is for starting coinbase-pro exchange functions.
 func StartCoinbasePro(appCtx context.Context, markets []config.Market, retry *config.Retry, connCfg *config.Connection) error {
-
-	// If any error occurs or connection is lost, retry the exchange functions with a time gap till it reaches
-	// a configured number of retry.
-	// Retry counter will be reset back to zero if the elapsed time since the last retry is greater than the configured one.
-	var retryCount int
-	lastRetryTime := time.Now()
-
-	for {
-		err := newCoinbasePro(appCtx, markets, connCfg)
-		if err != nil {
-			log.Error().Err(err).Str("exchange", "coinbase-pro").Msg("error occurred")
-			if retry.Number == 0 {
-				return errors.New("not able to connect coinbase-pro exchange. please check the log for details")
-			}
-			if retry.ResetSec == 0 || time.Since(lastRetryTime).Seconds() < float64(retry.ResetSec) {
-				retryCount++
-			} else {
-				retryCount = 1
-			}
-			lastRetryTime = time.Now()
-			if retryCount > retry.Number {
-				return fmt.Errorf("not able to connect coinbase-pro exchange even after %v retry. please check the log for details", retry.Number)
-			}
-
-			log.Error().Str("exchange", "coinbase-pro").Int("retry", retryCount).Msg(fmt.Sprintf("retrying functions in %v seconds", retry.GapSec))
-			tick := time.NewTicker(time.Duration(retry.GapSec) * time.Second)
-			select {
-			case <-tick.C:
-				tick.Stop()
-
-			// Return, if there is any error from another exchange.
-			case <-appCtx.Done():
-				log.Error().Str("exchange", "coinbase-pro").Msg("ctx canceled, return from StartCoinbasePro")
-				return appCtx.Err()
-			}
-		}
-	}
+	return supervisor.Run(appCtx, "coinbase-pro", retry, func() error {
+		return newCoinbasePro(appCtx, markets, connCfg)
+	})
 }
 
 type coinbasePro struct {
-	ws             connector.Websocket
-	rest           *connector.REST
-	connCfg        *config.Connection
-	cfgMap         map[cfgLookupKey]cfgLookupVal
-	ter            *storage.Terminal
-	es             *storage.ElasticSearch
-	mysql          *storage.MySQL
-	wsTerTickers   chan []storage.Ticker
-	wsTerTrades    chan []storage.Trade
-	wsMysqlTickers chan []storage.Ticker
-	wsMysqlTrades  chan []storage.Trade
-	wsEsTickers    chan []storage.Ticker
-	wsEsTrades     chan []storage.Trade
+	ws            connector.Websocket
+	rest          *connector.REST
+	connCfg       *config.Connection
+	cfgMap        map[cfgLookupKey]cfgLookupVal
+	strs          strCommits
+	marketStats   *marketStats
+	orderFlowSeqs map[string]uint64
 }
 
 type wsSubCoinPro struct {
@@ -87,16 +49,38 @@ type wsSubChanCoinPro struct {
 }
 
 type respCoinPro struct {
-	Type          string             `json:"type"`
-	ProductID     string             `json:"product_id"`
-	TradeID       uint64             `json:"trade_id"`
-	Side          string             `json:"side"`
-	Size          string             `json:"size"`
-	Price         string             `json:"price"`
-	Time          string             `json:"time"`
-	Message       string             `json:"message"`
-	Channels      []wsSubChanCoinPro `json:"channels"`
-	mktCommitName string
+	Type            string             `json:"type"`
+	ProductID       string             `json:"product_id"`
+	TradeID         uint64             `json:"trade_id"`
+	Side            string             `json:"side"`
+	Size            string             `json:"size"`
+	Price           string             `json:"price"`
+	BestBid         string             `json:"best_bid"`
+	BestAsk         string             `json:"best_ask"`
+	Volume24h       string             `json:"volume_24h"`
+	High24h         string             `json:"high_24h"`
+	Low24h          string             `json:"low_24h"`
+	Bid             string             `json:"bid"`
+	Ask             string             `json:"ask"`
+	Volume          string             `json:"volume"`
+	Time            string             `json:"time"`
+	Message         string             `json:"message"`
+	Channels        []wsSubChanCoinPro `json:"channels"`
+	OrderID         string             `json:"order_id"`
+	MakerOrderID    string             `json:"maker_order_id"`
+	TakerOrderID    string             `json:"taker_order_id"`
+	RemainingSize   string             `json:"remaining_size"`
+	NewSize         string             `json:"new_size"`
+	Reason          string             `json:"reason"`
+	Sequence        uint64             `json:"sequence"`
+	Status          string             `json:"status"`
+	TradingDisabled bool               `json:"trading_disabled"`
+	CancelOnly      bool               `json:"cancel_only"`
+	PostOnly        bool               `json:"post_only"`
+	LimitOnly       bool               `json:"limit_only"`
+	QuoteIncrement  string             `json:"quote_increment"`
+	BaseIncrement   string             `json:"base_increment"`
+	mktCommitName   string
 }
 
 func newCoinbasePro(appCtx context.Context, markets []config.Market, connCfg *config.Connection) error {
@@ -104,12 +88,13 @@ func newCoinbasePro(appCtx context.Context, markets []config.Market, connCfg *co
 	// If any exchange function fails, force all the other functions to stop and return.
 	coinbaseProErrGroup, ctx := errgroup.WithContext(appCtx)
 
-	c := coinbasePro{connCfg: connCfg}
+	c := coinbasePro{connCfg: connCfg, orderFlowSeqs: make(map[string]uint64)}
 
 	err := c.cfgLookup(markets)
 	if err != nil {
 		return err
 	}
+	c.marketStats = newMarketStats("coinbase-pro", c.cfgMap)
 
 	var (
 		wsCount   int
@@ -136,30 +121,22 @@ func newCoinbasePro(appCtx context.Context, markets []config.Market, connCfg *co
 						return c.readWs(ctx)
 					})
 
-					if c.ter != nil {
-						coinbaseProErrGroup.Go(func() error {
-							return c.wsTickersToTerminal(ctx)
-						})
+					if c.marketStats != nil {
 						coinbaseProErrGroup.Go(func() error {
-							return c.wsTradesToTerminal(ctx)
+							return c.marketStats.run(ctx)
 						})
 					}
 
-					if c.mysql != nil {
-						coinbaseProErrGroup.Go(func() error {
-							return c.wsTickersToMySQL(ctx)
-						})
+					for _, str := range c.strs {
+						str := str
 						coinbaseProErrGroup.Go(func() error {
-							return c.wsTradesToMySQL(ctx)
+							return str.wsTickers(ctx)
 						})
-					}
-
-					if c.es != nil {
 						coinbaseProErrGroup.Go(func() error {
-							return c.wsTickersToES(ctx)
+							return str.wsTrades(ctx)
 						})
 						coinbaseProErrGroup.Go(func() error {
-							return c.wsTradesToES(ctx)
+							return str.wsRecords(ctx)
 						})
 					}
 				}
@@ -216,6 +193,7 @@ func (c *coinbasePro) cfgLookup(markets []config.Market) error {
 
 	// Configurations flat map is prepared for easy lookup later in the app.
 	c.cfgMap = make(map[cfgLookupKey]cfgLookupVal)
+	c.strs = make(strCommits)
 	for _, market := range markets {
 		var marketCommitName string
 		if market.CommitName != "" {
@@ -227,31 +205,14 @@ func (c *coinbasePro) cfgLookup(markets []config.Market) error {
 			key := cfgLookupKey{market: market.ID, channel: info.Channel}
 			val := cfgLookupVal{}
 			val.wsConsiderIntSec = info.WsConsiderIntSec
-			for _, str := range info.Storages {
-				switch str {
-				case "terminal":
-					val.terStr = true
-					if c.ter == nil {
-						c.ter = storage.GetTerminal()
-						c.wsTerTickers = make(chan []storage.Ticker, 1)
-						c.wsTerTrades = make(chan []storage.Trade, 1)
-					}
-				case "mysql":
-					val.mysqlStr = true
-					if c.mysql == nil {
-						c.mysql = storage.GetMySQL()
-						c.wsMysqlTickers = make(chan []storage.Ticker, 1)
-						c.wsMysqlTrades = make(chan []storage.Trade, 1)
-					}
-				case "elastic_search":
-					val.esStr = true
-					if c.es == nil {
-						c.es = storage.GetElasticSearch()
-						c.wsEsTickers = make(chan []storage.Ticker, 1)
-						c.wsEsTrades = make(chan []storage.Trade, 1)
-					}
-				}
-			}
+			val.strConsiderIntSec = info.StrConsiderIntSec
+			val.strs = c.strs.lookup(info.Storages)
+			val.candleIntervals = candleIntervals(info.CandleIntervals)
+			val.avgPriceWindows = candleIntervals(info.AvgPriceWindows)
+			val.statsInterval = time.Duration(info.StatsIntervalSec) * time.Second
+			val.tickFilter = newTickFilter(info.TickFilter)
+			val.base, val.quote = marketAssets(market)
+			val.tradeFilter = info.TradeFilter
 			val.mktCommitName = marketCommitName
 			c.cfgMap[key] = val
 		}
@@ -260,7 +221,7 @@ func (c *coinbasePro) cfgLookup(markets []config.Market) error {
 }
 
 func (c *coinbasePro) connectWs(ctx context.Context) error {
-	ws, err := connector.NewWebsocket(ctx, &c.connCfg.WS, config.CoinbaseProWebsocketURL)
+	ws, err := connector.NewWebsocket(ctx, &c.connCfg.WS, "coinbase-pro", config.CoinbaseProWebsocketURL)
 	if err != nil {
 		if !errors.Is(err, ctx.Err()) {
 			logErrStack(err)
@@ -285,8 +246,11 @@ func (c *coinbasePro) closeWsConnOnError(ctx context.Context) error {
 
 // subWsChannel sends channel subscription requests to the websocket server.
 func (c *coinbasePro) subWsChannel(market string, channel string) error {
-	if channel == "trade" {
+	switch channel {
+	case "trade":
 		channel = "matches"
+	case "orderflow":
+		channel = "full"
 	}
 	channels := make([]wsSubChanCoinPro, 1)
 	channels[0].Name = channel
@@ -300,7 +264,7 @@ func (c *coinbasePro) subWsChannel(market string, channel string) error {
 		logErrStack(err)
 		return err
 	}
-	err = c.ws.Write(frame)
+	err = c.ws.Subscribe(frame)
 	if err != nil {
 		if errors.Is(err, net.ErrClosed) {
 			err = errors.New("context canceled")
@@ -321,14 +285,7 @@ func (c *coinbasePro) readWs(ctx context.Context) error {
 		cfgLookup[k] = v
 	}
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, c.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, c.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, c.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, c.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, c.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, c.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	for {
 		select {
@@ -360,6 +317,20 @@ func (c *coinbasePro) readWs(ctx context.Context) error {
 				wr.Type = "trade"
 			}
 
+			// Order flow events are always considered irrespective of the interval,
+			// as missing any of them makes it impossible to rebuild the order book.
+			switch wr.Type {
+			case "received", "open", "done", "change", "trade":
+				key := cfgLookupKey{market: wr.ProductID, channel: "orderflow"}
+				if val, ok := cfgLookup[key]; ok {
+					wr.mktCommitName = val.mktCommitName
+					err := c.processOrderFlowWs(ctx, &wr, &cd)
+					if err != nil {
+						return err
+					}
+				}
+			}
+
 			switch wr.Type {
 			case "error":
 				log.Error().Str("exchange", "coinbase-pro").Str("func", "readWs").Str("msg", wr.Message).Msg("")
@@ -369,6 +340,8 @@ func (c *coinbasePro) readWs(ctx context.Context) error {
 					for _, market := range channel.ProductIds {
 						if channel.Name == "matches" {
 							log.Debug().Str("exchange", "coinbase-pro").Str("func", "readWs").Str("market", market).Str("channel", "trade").Msg("channel subscribed (this message may be duplicate as server sends list of all subscriptions on each channel subscribe)")
+						} else if channel.Name == "full" {
+							log.Debug().Str("exchange", "coinbase-pro").Str("func", "readWs").Str("market", market).Str("channel", "orderflow").Msg("channel subscribed (this message may be duplicate as server sends list of all subscriptions on each channel subscribe)")
 						} else {
 							log.Debug().Str("exchange", "coinbase-pro").Str("func", "readWs").Str("market", market).Str("channel", channel.Name).Msg("channel subscribed (this message may be duplicate as server sends list of all subscriptions on each channel subscribe)")
 						}
@@ -419,6 +392,36 @@ func (c *coinbasePro) processWs(ctx context.Context, wr *respCoinPro, cd *commit
 		}
 		ticker.Price = price
 
+		ticker.BestBid, err = strconv.ParseFloat(wr.BestBid, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		ticker.BestAsk, err = strconv.ParseFloat(wr.BestAsk, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		ticker.Volume, err = strconv.ParseFloat(wr.Volume24h, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		ticker.High, err = strconv.ParseFloat(wr.High24h, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		ticker.Low, err = strconv.ParseFloat(wr.Low24h, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
 		// Time sent is in string format.
 		timestamp, err := time.Parse(time.RFC3339Nano, wr.Time)
 		if err != nil {
@@ -429,44 +432,18 @@ func (c *coinbasePro) processWs(ctx context.Context, wr *respCoinPro, cd *commit
 
 		key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 		val := c.cfgMap[key]
-		if val.terStr {
-			cd.terTickersCount++
-			cd.terTickers = append(cd.terTickers, ticker)
-			if cd.terTickersCount == c.connCfg.Terminal.TickerCommitBuf {
-				select {
-				case c.wsTerTickers <- cd.terTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTickersCount = 0
-				cd.terTickers = nil
-			}
+		ticker.Base = val.base
+		ticker.Quote = val.quote
+		if cd.filterTicker(&ticker, key, val.tickFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTickersCount++
-			cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-			if cd.mysqlTickersCount == c.connCfg.MySQL.TickerCommitBuf {
-				select {
-				case c.wsMysqlTickers <- cd.mysqlTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTickersCount = 0
-				cd.mysqlTickers = nil
-			}
+		if !ticker.IsBadTick {
+			ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+			alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+			arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 		}
-		if val.esStr {
-			cd.esTickersCount++
-			cd.esTickers = append(cd.esTickers, ticker)
-			if cd.esTickersCount == c.connCfg.ES.TickerCommitBuf {
-				select {
-				case c.wsEsTickers <- cd.esTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTickersCount = 0
-				cd.esTickers = nil
-			}
+		if err := cd.wsTicker(ctx, key, &val, ticker); err != nil {
+			return err
 		}
 	case "trade":
 		trade := storage.Trade{}
@@ -500,141 +477,118 @@ func (c *coinbasePro) processWs(ctx context.Context, wr *respCoinPro, cd *commit
 
 		key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 		val := c.cfgMap[key]
-		if val.terStr {
-			cd.terTradesCount++
-			cd.terTrades = append(cd.terTrades, trade)
-			if cd.terTradesCount == c.connCfg.Terminal.TradeCommitBuf {
-				select {
-				case c.wsTerTrades <- cd.terTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTradesCount = 0
-				cd.terTrades = nil
-			}
+		if filterTradeRules(&trade, val.tradeFilter) {
+			return nil
+		}
+		trade.Base = val.base
+		trade.Quote = val.quote
+		if cd.filterTrade(&trade, key, val.tickFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTradesCount++
-			cd.mysqlTrades = append(cd.mysqlTrades, trade)
-			if cd.mysqlTradesCount == c.connCfg.MySQL.TradeCommitBuf {
-				select {
-				case c.wsMysqlTrades <- cd.mysqlTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTradesCount = 0
-				cd.mysqlTrades = nil
+		if !trade.IsBadTick {
+			trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+			alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+			arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
+		}
+		if err := cd.wsTrade(ctx, key, &val, trade); err != nil {
+			return err
+		}
+
+		// Candles are built from the trades, if configured.
+		for _, candle := range cd.addCandleTrade(trade, val.candleIntervals) {
+			if err := cd.wsAggregate(ctx, &val, "candle", candle); err != nil {
+				return err
 			}
 		}
-		if val.esStr {
-			cd.esTradesCount++
-			cd.esTrades = append(cd.esTrades, trade)
-			if cd.esTradesCount == c.connCfg.ES.TradeCommitBuf {
-				select {
-				case c.wsEsTrades <- cd.esTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTradesCount = 0
-				cd.esTrades = nil
+
+		// Rolling average prices are calculated from the trades, if configured.
+		for _, avgPrice := range cd.addAvgPriceTrade(trade, val.avgPriceWindows) {
+			if err := cd.wsAggregate(ctx, &val, "avg_price", avgPrice); err != nil {
+				return err
 			}
 		}
-	}
-	return nil
-}
 
-func (c *coinbasePro) wsTickersToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-c.wsTerTickers:
-			c.ter.CommitTickers(data)
-		case <-ctx.Done():
-			return ctx.Err()
+		// Market stats are aggregated from the trades, if configured.
+		if err := c.marketStats.add(ctx, trade); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-func (c *coinbasePro) wsTradesToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-c.wsTerTrades:
-			c.ter.CommitTrades(data)
-		case <-ctx.Done():
-			return ctx.Err()
-		}
+// processOrderFlowWs receives full channel order events,
+// transforms it to a common order flow store format,
+// buffers the same in memory and
+// then sends it to different storage systems for commit through go channels.
+func (c *coinbasePro) processOrderFlowWs(ctx context.Context, wr *respCoinPro, cd *commitData) error {
+
+	// Match message is sent for both full and matches channels, so the already processed sequence is ignored.
+	if wr.Sequence <= c.orderFlowSeqs[wr.ProductID] {
+		return nil
+	}
+	c.orderFlowSeqs[wr.ProductID] = wr.Sequence
+
+	orderFlow := storage.OrderFlow{}
+	orderFlow.Exchange = "coinbase-pro"
+	orderFlow.MktID = wr.ProductID
+	orderFlow.MktCommitName = wr.mktCommitName
+	orderFlow.Event = wr.Type
+	orderFlow.OrderID = wr.OrderID
+	orderFlow.Side = wr.Side
+	orderFlow.Reason = wr.Reason
+	orderFlow.Sequence = wr.Sequence
+
+	// Size is sent in different keys based on the event type.
+	var size string
+	switch wr.Type {
+	case "received":
+		size = wr.Size
+	case "open", "done":
+		size = wr.RemainingSize
+	case "change":
+		size = wr.NewSize
+	case "trade":
+		orderFlow.Event = "match"
+		orderFlow.OrderID = wr.MakerOrderID
+		orderFlow.TakerOrderID = wr.TakerOrderID
+		orderFlow.TradeID = strconv.FormatUint(wr.TradeID, 10)
+		size = wr.Size
 	}
-}
 
-func (c *coinbasePro) wsTickersToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-c.wsMysqlTickers:
-			err := c.mysql.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+	// Market orders do not have price and done message of a fully filled order does not have remaining size.
+	var err error
+	if size != "" {
+		orderFlow.Size, err = strconv.ParseFloat(size, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
 		}
 	}
-}
-
-func (c *coinbasePro) wsTradesToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-c.wsMysqlTrades:
-			err := c.mysql.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+	if wr.Price != "" {
+		orderFlow.Price, err = strconv.ParseFloat(wr.Price, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
 		}
 	}
-}
 
-func (c *coinbasePro) wsTickersToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-c.wsEsTickers:
-			err := c.es.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
+	timestamp, err := time.Parse(time.RFC3339Nano, wr.Time)
+	if err != nil {
+		logErrStack(err)
+		return err
 	}
-}
+	orderFlow.Timestamp = timestamp
 
-func (c *coinbasePro) wsTradesToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-c.wsEsTrades:
-			err := c.es.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
+	key := cfgLookupKey{market: orderFlow.MktID, channel: "orderflow"}
+	val := c.cfgMap[key]
+	if err := cd.wsAggregate(ctx, &val, "orderflow", orderFlow); err != nil {
+		return err
 	}
+	return nil
 }
 
 func (c *coinbasePro) connectRest() error {
-	rest, err := connector.GetREST()
+	rest, err := connector.GetREST("coinbase-pro")
 	if err != nil {
 		logErrStack(err)
 		return err
@@ -650,19 +604,15 @@ func (c *coinbasePro) connectRest() error {
 // then sends it to different storage systems for commit through go channels.
 func (c *coinbasePro) processREST(ctx context.Context, mktID string, mktCommitName string, channel string, interval int) error {
 	var (
-		req *http.Request
-		q   url.Values
-		err error
+		req            *http.Request
+		q              url.Values
+		cursor         connector.TradeCursor
+		err            error
+		lastStatus     string
+		lastInstrument storage.Instrument
 	)
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, c.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, c.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, c.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, c.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, c.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, c.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	switch channel {
 	case "ticker":
@@ -683,15 +633,25 @@ func (c *coinbasePro) processREST(ctx context.Context, mktID string, mktCommitNa
 		}
 		q = req.URL.Query()
 
-		// Querying for 100 trades, which is a max allowed for a request by the exchange.
-		// If the configured interval gap is big, then maybe it will not return all the trades
-		// and if the gap is too small, maybe it will return duplicate ones.
-		// Cursor pagination is not implemented.
-		// Better to use websocket.
+		// Querying for 100 trades, which is a max allowed for a request by the exchange,
+		// walking forward from the id of the last one received in the earlier poll, which is the cursor of the exchange.
 		q.Add("limit", strconv.Itoa(100))
+		cursor = connector.TradeCursor{
+			Param:    "before",
+			Position: func(id string, _ time.Time) string { return id },
+			Limit:    100,
+		}
+	case "trading_status", "instrument":
+		req, err = c.rest.Request(ctx, "GET", config.CoinbaseProRESTBaseURL+"products/"+mktID)
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
 	}
 
-	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	tick := connector.NewPollTicker("coinbase-pro", time.Duration(interval)*time.Second)
 	defer tick.Stop()
 	for {
 		select {
@@ -721,57 +681,129 @@ func (c *coinbasePro) processREST(ctx context.Context, mktID string, mktCommitNa
 					return err
 				}
 
+				bestBid, err := strconv.ParseFloat(rr.Bid, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				bestAsk, err := strconv.ParseFloat(rr.Ask, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				volume, err := strconv.ParseFloat(rr.Volume, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
 				ticker := storage.Ticker{
 					Exchange:      "coinbase-pro",
 					MktID:         mktID,
 					MktCommitName: mktCommitName,
 					Price:         price,
+					BestBid:       bestBid,
+					BestAsk:       bestAsk,
+					Volume:        volume,
 					Timestamp:     time.Now().UTC(),
 				}
 
 				key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 				val := c.cfgMap[key]
-				if val.terStr {
-					cd.terTickersCount++
-					cd.terTickers = append(cd.terTickers, ticker)
-					if cd.terTickersCount == c.connCfg.Terminal.TickerCommitBuf {
-						c.ter.CommitTickers(cd.terTickers)
-						cd.terTickersCount = 0
-						cd.terTickers = nil
-					}
+				ticker.Base = val.base
+				ticker.Quote = val.quote
+				if cd.filterTicker(&ticker, key, val.tickFilter) {
+					continue
 				}
-				if val.mysqlStr {
-					cd.mysqlTickersCount++
-					cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-					if cd.mysqlTickersCount == c.connCfg.MySQL.TickerCommitBuf {
-						err := c.mysql.CommitTickers(ctx, cd.mysqlTickers)
+				if !ticker.IsBadTick {
+					ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+					alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+					arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
+				}
+				if err := cd.restTicker(ctx, &val, ticker); err != nil {
+					return err
+				}
+			case "trade":
+				for more := true; more; {
+					cursor.Query(q)
+					req.URL.RawQuery = q.Encode()
+					resp, err := c.rest.Do(req)
+					if err != nil {
+						if !errors.Is(err, ctx.Err()) {
+							logErrStack(err)
+						}
+						return err
+					}
+
+					rr := []respCoinPro{}
+					if err := jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+						logErrStack(err)
+						resp.Body.Close()
+						return err
+					}
+					resp.Body.Close()
+
+					for i := range rr {
+						r := rr[i]
+
+						size, err := strconv.ParseFloat(r.Size, 64)
 						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
+							logErrStack(err)
 							return err
 						}
-						cd.mysqlTickersCount = 0
-						cd.mysqlTickers = nil
-					}
-				}
-				if val.esStr {
-					cd.esTickersCount++
-					cd.esTickers = append(cd.esTickers, ticker)
-					if cd.esTickersCount == c.connCfg.ES.TickerCommitBuf {
-						err := c.es.CommitTickers(ctx, cd.esTickers)
+
+						price, err := strconv.ParseFloat(r.Price, 64)
+						if err != nil {
+							logErrStack(err)
+							return err
+						}
+
+						// Time sent is in string format.
+						timestamp, err := time.Parse(time.RFC3339Nano, r.Time)
 						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
+							logErrStack(err)
+							return err
+						}
+
+						trade := storage.Trade{
+							Exchange:      "coinbase-pro",
+							MktID:         mktID,
+							MktCommitName: mktCommitName,
+							TradeID:       strconv.FormatUint(r.TradeID, 10),
+							Side:          r.Side,
+							Size:          size,
+							Price:         price,
+							Timestamp:     timestamp,
+						}
+
+						if !cursor.New(restTradeKey(&trade), trade.Timestamp) {
+							continue
+						}
+
+						key := cfgLookupKey{market: trade.MktID, channel: "trade"}
+						val := c.cfgMap[key]
+						if filterTradeRules(&trade, val.tradeFilter) {
+							continue
+						}
+						trade.Base = val.base
+						trade.Quote = val.quote
+						if cd.filterTrade(&trade, key, val.tickFilter) {
+							continue
+						}
+						if !trade.IsBadTick {
+							trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+							alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+							arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
+						}
+						if err := cd.restTrade(ctx, &val, trade); err != nil {
 							return err
 						}
-						cd.esTickersCount = 0
-						cd.esTickers = nil
 					}
+					more = cursor.Next(len(rr))
 				}
-			case "trade":
-				req.URL.RawQuery = q.Encode()
+			case "trading_status":
 				resp, err := c.rest.Do(req)
 				if err != nil {
 					if !errors.Is(err, ctx.Err()) {
@@ -780,88 +812,114 @@ func (c *coinbasePro) processREST(ctx context.Context, mktID string, mktCommitNa
 					return err
 				}
 
-				rr := []respCoinPro{}
-				if err := jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+				rr := respCoinPro{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
 					logErrStack(err)
 					resp.Body.Close()
 					return err
 				}
 				resp.Body.Close()
 
-				for i := range rr {
-					r := rr[i]
+				// Exchange specific status values are converted to a common format.
+				status := "trading"
+				switch {
+				case rr.Status != "online":
+					status = rr.Status
+				case rr.TradingDisabled:
+					status = "halted"
+				case rr.CancelOnly:
+					status = "cancel_only"
+				case rr.PostOnly:
+					status = "post_only"
+				case rr.LimitOnly:
+					status = "limit_only"
+				}
 
-					size, err := strconv.ParseFloat(r.Size, 64)
-					if err != nil {
-						logErrStack(err)
-						return err
-					}
+				// Only the changes are stored, first one being the status at the start.
+				if status == lastStatus {
+					continue
+				}
+				lastStatus = status
 
-					price, err := strconv.ParseFloat(r.Price, 64)
-					if err != nil {
-						logErrStack(err)
-						return err
-					}
+				tradingStatus := storage.TradingStatus{
+					Exchange:      "coinbase-pro",
+					MktID:         mktID,
+					MktCommitName: mktCommitName,
+					Status:        status,
+					Timestamp:     time.Now().UTC(),
+				}
 
-					// Time sent is in string format.
-					timestamp, err := time.Parse(time.RFC3339Nano, r.Time)
-					if err != nil {
+				key := cfgLookupKey{market: tradingStatus.MktID, channel: "trading_status"}
+				val := c.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "trading_status", tradingStatus); err != nil {
+					return err
+				}
+			case "instrument":
+				resp, err := c.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
 						logErrStack(err)
-						return err
 					}
+					return err
+				}
 
-					trade := storage.Trade{
-						Exchange:      "coinbase-pro",
-						MktID:         mktID,
-						MktCommitName: mktCommitName,
-						TradeID:       strconv.FormatUint(r.TradeID, 10),
-						Side:          r.Side,
-						Size:          size,
-						Price:         price,
-						Timestamp:     timestamp,
-					}
+				rr := respCoinPro{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
 
-					key := cfgLookupKey{market: trade.MktID, channel: "trade"}
-					val := c.cfgMap[key]
-					if val.terStr {
-						cd.terTradesCount++
-						cd.terTrades = append(cd.terTrades, trade)
-						if cd.terTradesCount == c.connCfg.Terminal.TradeCommitBuf {
-							c.ter.CommitTrades(cd.terTrades)
-							cd.terTradesCount = 0
-							cd.terTrades = nil
-						}
-					}
-					if val.mysqlStr {
-						cd.mysqlTradesCount++
-						cd.mysqlTrades = append(cd.mysqlTrades, trade)
-						if cd.mysqlTradesCount == c.connCfg.MySQL.TradeCommitBuf {
-							err := c.mysql.CommitTrades(ctx, cd.mysqlTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.mysqlTradesCount = 0
-							cd.mysqlTrades = nil
-						}
-					}
-					if val.esStr {
-						cd.esTradesCount++
-						cd.esTrades = append(cd.esTrades, trade)
-						if cd.esTradesCount == c.connCfg.ES.TradeCommitBuf {
-							err := c.es.CommitTrades(ctx, cd.esTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.esTradesCount = 0
-							cd.esTrades = nil
-						}
-					}
+				tickSize, err := strconv.ParseFloat(rr.QuoteIncrement, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				lotSize, err := strconv.ParseFloat(rr.BaseIncrement, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				// Exchange specific status values are converted to a common format.
+				status := "trading"
+				switch {
+				case rr.Status != "online":
+					status = rr.Status
+				case rr.TradingDisabled:
+					status = "halted"
+				case rr.CancelOnly:
+					status = "cancel_only"
+				case rr.PostOnly:
+					status = "post_only"
+				case rr.LimitOnly:
+					status = "limit_only"
+				}
+
+				instrument := storage.Instrument{
+					Exchange:       "coinbase-pro",
+					MktID:          mktID,
+					MktCommitName:  mktCommitName,
+					TickSize:       tickSize,
+					LotSize:        lotSize,
+					PricePrecision: precision(tickSize),
+					SizePrecision:  precision(lotSize),
+					Status:         status,
+				}
+
+				// Only the changes are stored, first one being the metadata at the start.
+				if instrument == lastInstrument {
+					continue
+				}
+				lastInstrument = instrument
+				instrument.Timestamp = time.Now().UTC()
+
+				key := cfgLookupKey{market: instrument.MktID, channel: "instrument"}
+				val := c.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "instrument", instrument); err != nil {
+					return err
 				}
 			}
 
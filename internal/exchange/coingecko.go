@@ -0,0 +1,173 @@
+package exchange
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
+	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// coinGecko is for fetching coin reference data.
+type coinGecko struct {
+	cfg   *config.CoinGecko
+	rest  *connector.REST
+	bases map[string]string
+	ter   *storage.Terminal
+	mysql *storage.MySQL
+	es    *storage.ElasticSearch
+	uds   *storage.UDS
+}
+
+type restRespCoinGecko struct {
+	ID                string  `json:"id"`
+	MarketCap         float64 `json:"market_cap"`
+	MarketCapRank     int     `json:"market_cap_rank"`
+	CirculatingSupply float64 `json:"circulating_supply"`
+}
+
+// StartCoinGecko is entry point for fetching coin reference data from CoinGecko.
+// Data is committed to the configured storages with the base asset of the markets,
+// so that it can be joined with the ticker and trade data.
+// If any error occurs, the function is retried in the same way as for the exchanges.
+func StartCoinGecko(appCtx context.Context, cfg *config.CoinGecko) error {
+	return supervisor.Run(appCtx, "coingecko", &cfg.Retry, func() error {
+		return newCoinGecko(appCtx, cfg)
+	})
+}
+
+func newCoinGecko(appCtx context.Context, cfg *config.CoinGecko) error {
+	rest, err := connector.GetREST("coingecko")
+	if err != nil {
+		logErrStack(err)
+		return err
+	}
+	c := coinGecko{cfg: cfg, rest: rest, bases: make(map[string]string, len(cfg.Coins))}
+	for base, id := range cfg.Coins {
+		c.bases[id] = strings.ToUpper(base)
+	}
+	for _, str := range cfg.Storages {
+		switch str {
+		case "terminal":
+			c.ter = storage.GetTerminal()
+		case "mysql":
+			c.mysql = storage.GetMySQL()
+		case "elastic_search":
+			c.es = storage.GetElasticSearch()
+		case "uds":
+			c.uds = storage.GetUDS()
+		}
+	}
+	log.Info().Str("exchange", "coingecko").Msg("REST connection setup is done")
+
+	if err = c.fetch(appCtx); err != nil {
+		return err
+	}
+	tick := time.NewTicker(time.Duration(cfg.RefreshIntSec) * time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if err = c.fetch(appCtx); err != nil {
+				return err
+			}
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+	}
+}
+
+// fetch queries the coin markets API for all the configured coins in one request
+// and commits the data to the storages.
+func (c *coinGecko) fetch(ctx context.Context) error {
+	req, err := c.rest.Request(ctx, "GET", c.cfg.URL+"coins/markets")
+	if err != nil {
+		if !errors.Is(err, ctx.Err()) {
+			logErrStack(err)
+		}
+		return err
+	}
+	ids := make([]string, 0, len(c.bases))
+	for id := range c.bases {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	q := req.URL.Query()
+	q.Add("vs_currency", "usd")
+	q.Add("ids", strings.Join(ids, ","))
+	q.Add("per_page", strconv.Itoa(len(ids)))
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := c.rest.Do(req)
+	if err != nil {
+		if !errors.Is(err, ctx.Err()) {
+			logErrStack(err)
+		}
+		return err
+	}
+
+	rr := []restRespCoinGecko{}
+	if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+		logErrStack(err)
+		resp.Body.Close()
+		return err
+	}
+	resp.Body.Close()
+
+	timestamp := time.Now().UTC()
+	infos := make([]storage.CoinInfo, 0, len(rr))
+	for _, r := range rr {
+		base, ok := c.bases[r.ID]
+		if !ok {
+			continue
+		}
+		infos = append(infos, storage.CoinInfo{
+			Base:              base,
+			CoinID:            r.ID,
+			MarketCap:         r.MarketCap,
+			Rank:              r.MarketCapRank,
+			CirculatingSupply: r.CirculatingSupply,
+			Timestamp:         timestamp,
+		})
+	}
+	if len(infos) == 0 {
+		return nil
+	}
+
+	if c.ter != nil {
+		c.ter.CommitCoinInfos(infos)
+	}
+	if c.mysql != nil {
+		if err = c.mysql.CommitCoinInfos(ctx, infos); err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
+	}
+	if c.es != nil {
+		if err = c.es.CommitCoinInfos(ctx, infos); err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
+	}
+	if c.uds != nil {
+		if err = c.uds.CommitCoinInfos(ctx, infos); err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package exchange
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+)
+
+// orderStorage records the order in which the batches are committed, by the price of their records.
+type orderStorage struct {
+	mu        sync.Mutex
+	committed []float64
+}
+
+func (s *orderStorage) CommitTickers(_ context.Context, data []storage.Ticker) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range data {
+		s.committed = append(s.committed, data[i].Price)
+	}
+	return nil
+}
+
+func (s *orderStorage) CommitTrades(_ context.Context, data []storage.Trade) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range data {
+		s.committed = append(s.committed, data[i].Price)
+	}
+	return nil
+}
+
+func (s *orderStorage) CommitBBOs(_ context.Context, data []storage.BBO) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range data {
+		s.committed = append(s.committed, data[i].BidPrice)
+	}
+	return nil
+}
+
+// TestFlushOrder tests that the flush commits all the full buffers waiting in the go channel
+// before the partially filled one, and that it leaves the buffer while a full one is still being sent.
+func TestFlushOrder(t *testing.T) {
+	ctx := context.Background()
+	for _, sending := range []int{0, 1} {
+		str := &orderStorage{}
+		sc := &strCommit{
+			Registered: &storage.Registered{Name: "order", Storage: str, ChannelBuf: 3},
+			shards: []*commitShard{{
+				tickers: make(chan []storage.Ticker, 3),
+				trades:  make(chan []storage.Trade, 3),
+			}},
+			workers:    1,
+			records:    make(chan recordBatch, 3),
+			recordBufs: make(map[string][]interface{}),
+		}
+		shard := sc.shards[0]
+		shard.tickers <- []storage.Ticker{{Price: 1}, {Price: 2}}
+		shard.tickers <- []storage.Ticker{{Price: 3}, {Price: 4}}
+		shard.tickerBuf = []storage.Ticker{{Price: 5}}
+		shard.tickersSending = sending
+		shard.trades <- []storage.Trade{{Price: 1}, {Price: 2}}
+		shard.trades <- []storage.Trade{{Price: 3}, {Price: 4}}
+		shard.tradeBuf = []storage.Trade{{Price: 5}}
+		shard.tradesSending = sending
+		sc.records <- recordBatch{channel: "bbo", data: []interface{}{storage.BBO{BidPrice: 1}, storage.BBO{BidPrice: 2}}}
+		sc.records <- recordBatch{channel: "bbo", data: []interface{}{storage.BBO{BidPrice: 3}, storage.BBO{BidPrice: 4}}}
+		sc.recordBufs["bbo"] = []interface{}{storage.BBO{BidPrice: 5}}
+		sc.sending = sending
+
+		want := []float64{1, 2, 3, 4, 5}
+		if sending > 0 {
+			want = nil
+		}
+		flushes := []struct {
+			channel string
+			flush   func() error
+		}{
+			{"ticker", func() error { return sc.flushTickers(ctx, shard) }},
+			{"trade", func() error { return sc.flushTrades(ctx, shard) }},
+			{"bbo", func() error { return sc.flushRecords(ctx) }},
+		}
+		for _, f := range flushes {
+			str.committed = nil
+			if err := f.flush(); err != nil {
+				t.Log("ERROR : " + err.Error())
+				t.FailNow()
+			}
+			if !reflect.DeepEqual(str.committed, want) {
+				t.Log("ERROR : "+f.channel+" flush with sending", sending, ": committed", str.committed, "expected", want)
+				t.Error("FAILURE : flush order")
+			}
+		}
+		if sending > 0 && (len(shard.tickers) != 2 || len(shard.tickerBuf) != 1 || len(shard.trades) != 2 || len(shard.tradeBuf) != 1 ||
+			len(sc.records) != 2 || len(sc.recordBufs["bbo"]) != 1) {
+			t.Log("ERROR : flush with a buffer being sent did not leave the buffers as they were")
+			t.Error("FAILURE : flush order")
+		}
+	}
+}
@@ -1,11 +1,22 @@
 package exchange
 
 import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/metrics"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
 )
 
 // cfgLookupKey is a key in the config lookup map.
@@ -16,31 +27,1382 @@ type cfgLookupKey struct {
 
 // cfgLookupVal is a value in the config lookup map.
 type cfgLookupVal struct {
-	wsConsiderIntSec int
-	wsLastUpdated    time.Time
-	terStr           bool
-	mysqlStr         bool
-	esStr            bool
-	id               int
-	mktCommitName    string
+	wsConsiderIntSec  int
+	wsLastUpdated     time.Time
+	strConsiderIntSec map[string]int
+	strs              []*strCommit
+	id                int
+	mktCommitName     string
+	candleIntervals   []time.Duration
+	candleValidation  *config.CandleValidation
+	avgPriceWindows   []time.Duration
+	bookLevels        []int
+	statsInterval     time.Duration
+	tickFilter        *tickFilter
+	base              string
+	quote             string
+	tradeFilter       *config.TradeFilter
 }
 
+// tickFilter holds the sanity filter config of ticker or trade channel of the market.
+type tickFilter struct {
+	deviation float64
+	window    int
+	drop      bool
+}
+
+// commitData buffers records before they are sent for commit.
+// It is owned by a single reader goroutine, so records of a market keep their arrival order till they are sent for commit.
+// After that, websocket tickers and trades of a market are committed in order by a storage with a single commit worker,
+// or with ordered commits where each market is always committed by the same worker, and the other websocket records
+// by a single go routine of each storage. REST records are committed right away by the reader goroutine.
+// Order is not kept for the batches dropped by the backpressure policy, or written to the dead-letter directory.
 type commitData struct {
-	terTickersCount   int
-	terTradesCount    int
-	mysqlTickersCount int
-	mysqlTradesCount  int
-	esTickersCount    int
-	esTradesCount     int
-	terTickers        []storage.Ticker
-	terTrades         []storage.Trade
-	mysqlTickers      []storage.Ticker
-	mysqlTrades       []storage.Trade
-	esTickers         []storage.Ticker
-	esTrades          []storage.Trade
+	tickers         map[string][]storage.Ticker
+	trades          map[string][]storage.Trade
+	tickersAt       map[string]time.Time
+	tradesAt        map[string]time.Time
+	records         map[strRecordKey][]interface{}
+	recordsAt       map[strRecordKey]time.Time
+	openCandles     map[candleKey]*storage.Candle
+	avgPriceWindows map[avgPriceKey]*avgPriceWindow
+	tickPrices      map[cfgLookupKey][]float64
+	strLastUpdated  map[strConsiderKey]time.Time
+	badTicks        map[cfgLookupKey]int64
+}
+
+// strRecordKey is a key in the REST record buffer map.
+type strRecordKey struct {
+	storage string
+	channel string
+}
+
+// strConsiderKey is a key in the storage last updated map.
+type strConsiderKey struct {
+	key     cfgLookupKey
+	storage string
+}
+
+// considerStr tells whether the websocket record of the market channel should be committed to the storage,
+// considering the configured per storage interval on top of the websocket consider interval.
+// So the same subscription can feed every record to one storage and only a sample of them to another one.
+func (cd *commitData) considerStr(key cfgLookupKey, storage string, intervalSec int) bool {
+	if intervalSec == 0 {
+		return true
+	}
+	if cd.strLastUpdated == nil {
+		cd.strLastUpdated = make(map[strConsiderKey]time.Time)
+	}
+	k := strConsiderKey{key: key, storage: storage}
+	if time.Since(cd.strLastUpdated[k]).Seconds() < float64(intervalSec) {
+		return false
+	}
+	cd.strLastUpdated[k] = time.Now()
+	return true
+}
+
+// strCommit is a registered storage along with the go channels through which
+// the buffered websocket data of an exchange is sent for commit.
+// Websocket data is buffered here, instead of in the commit data of the connection,
+// so that it can also be flushed at the flush interval of the storage by the commit go routine.
+// Tickers and trades are sent through the commit shard of their market, consumed by the commit workers of the storage.
+// With ordered commits, there is a shard for each worker, otherwise all the workers consume a single shard.
+// Record channels other than ticker and trade, like bbo or candle, share a go channel and a buffer map by channel name,
+// and they are committed only if the storage implements the committer of the record type.
+// Sending counts the full record buffers taken out of the map but not yet sent through the go channel.
+type strCommit struct {
+	*storage.Registered
+	shards     []*commitShard
+	workers    int
+	records    chan recordBatch
+	mu         sync.Mutex
+	recordBufs map[string][]interface{}
+	sending    int
+}
+
+// commitShard holds the go channels and buffers of the tickers and trades, which are committed by the workers of the shard.
+// Sending counts the full buffers taken out of the shard but not yet sent through its go channels,
+// so that the flush does not commit the newer partially filled buffer before them.
+type commitShard struct {
+	tickers        chan []storage.Ticker
+	trades         chan []storage.Trade
+	mu             sync.Mutex
+	tickerBuf      []storage.Ticker
+	tradeBuf       []storage.Trade
+	tickersSending int
+	tradesSending  int
+}
+
+// shard returns the commit shard of the market, by the FNV-1a hash of its id.
+func (str *strCommit) shard(market string) *commitShard {
+	if len(str.shards) == 1 {
+		return str.shards[0]
+	}
+	hash := uint32(2166136261)
+	for i := 0; i < len(market); i++ {
+		hash ^= uint32(market[i])
+		hash *= 16777619
+	}
+	return str.shards[hash%uint32(len(str.shards))]
+}
+
+// recordBatch is a batch of buffered records of a channel other than ticker and trade.
+type recordBatch struct {
+	channel string
+	data    []interface{}
+}
+
+// strCommits are the registered storages of an exchange by the storage name.
+type strCommits map[string]*strCommit
+
+// lookup returns the registered ones of the storages configured for a market channel.
+// Storages are shared by all the market channels of the exchange, so their go channels are created only once.
+func (s strCommits) lookup(names []string) []*strCommit {
+	var strs []*strCommit
+	for _, name := range names {
+		str, ok := s[name]
+		if !ok {
+			reg := storage.Lookup(name)
+			if reg == nil {
+				continue
+			}
+			size := reg.ChannelBuf
+			if size == 0 {
+				size = 1
+			}
+			shards, workers := 1, reg.CommitWorkers
+			if workers == 0 {
+				workers = 1
+			}
+			if reg.Ordered {
+				shards, workers = workers, 1
+			}
+			str = &strCommit{
+				Registered: reg,
+				shards:     make([]*commitShard, shards),
+				workers:    workers,
+				records:    make(chan recordBatch, size),
+				recordBufs: make(map[string][]interface{}),
+			}
+			for i := range str.shards {
+				str.shards[i] = &commitShard{
+					tickers: make(chan []storage.Ticker, size),
+					trades:  make(chan []storage.Trade, size),
+				}
+			}
+			s[name] = str
+		}
+		strs = append(strs, str)
+	}
+	return strs
+}
+
+// wsTickers commits the tickers received through the go channels till the context is cancelled,
+// by the commit workers of each shard of the storage, so that a slow commit does not hold back the next batches.
+// With more than one worker of a shard, its batches may be committed out of order.
+func (str *strCommit) wsTickers(ctx context.Context) error {
+	if len(str.shards) == 1 && str.workers == 1 {
+		return str.wsTickerWorker(ctx, str.shards[0], true)
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	for _, shard := range str.shards {
+		for i := 0; i < str.workers; i++ {
+			shard, flusher := shard, i == 0
+			g.Go(func() error {
+				return str.wsTickerWorker(ctx, shard, flusher)
+			})
+		}
+	}
+	return g.Wait()
+}
+
+// wsTickerWorker commits the tickers of the shard received through its go channel till the context is cancelled.
+// If the storage has a flush interval, the flusher worker of the shard also commits its partially filled buffer at every interval.
+func (str *strCommit) wsTickerWorker(ctx context.Context, shard *commitShard, flusher bool) error {
+	var flush <-chan time.Time
+	if flusher && str.FlushIntSec > 0 {
+		ticker := time.NewTicker(time.Duration(str.FlushIntSec) * time.Second)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+	for {
+		select {
+		case data := <-shard.tickers:
+			if err := str.commitTickers(ctx, data); err != nil {
+				return err
+			}
+		case <-flush:
+			if err := str.flushTickers(ctx, shard); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// wsTrades commits the trades received through the go channels till the context is cancelled,
+// by the commit workers of each shard of the storage, so that a slow commit does not hold back the next batches.
+// With more than one worker of a shard, its batches may be committed out of order.
+func (str *strCommit) wsTrades(ctx context.Context) error {
+	if len(str.shards) == 1 && str.workers == 1 {
+		return str.wsTradeWorker(ctx, str.shards[0], true)
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	for _, shard := range str.shards {
+		for i := 0; i < str.workers; i++ {
+			shard, flusher := shard, i == 0
+			g.Go(func() error {
+				return str.wsTradeWorker(ctx, shard, flusher)
+			})
+		}
+	}
+	return g.Wait()
+}
+
+// wsTradeWorker commits the trades of the shard received through its go channel till the context is cancelled.
+// If the storage has a flush interval, the flusher worker of the shard also commits its partially filled buffer at every interval.
+func (str *strCommit) wsTradeWorker(ctx context.Context, shard *commitShard, flusher bool) error {
+	var flush <-chan time.Time
+	if flusher && str.FlushIntSec > 0 {
+		ticker := time.NewTicker(time.Duration(str.FlushIntSec) * time.Second)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+	for {
+		select {
+		case data := <-shard.trades:
+			if err := str.commitTrades(ctx, data); err != nil {
+				return err
+			}
+		case <-flush:
+			if err := str.flushTrades(ctx, shard); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// flushTickers commits the partially filled ticker buffer of the shard, after the full ones waiting in its go channel,
+// which are older. Buffer is left for the next flush while a full one taken before it is still being sent,
+// as that one would otherwise be committed after the newer buffer.
+func (str *strCommit) flushTickers(ctx context.Context, shard *commitShard) error {
+	shard.mu.Lock()
+	if shard.tickersSending > 0 {
+		shard.mu.Unlock()
+		return nil
+	}
+	data := shard.tickerBuf
+	shard.tickerBuf = nil
+
+	// Buffers sent after this point are newer, so only the ones already waiting are committed first.
+	waiting := len(shard.tickers)
+	shard.mu.Unlock()
+	for ; waiting > 0; waiting-- {
+		select {
+		case old := <-shard.tickers:
+			if err := str.commitTickers(ctx, old); err != nil {
+				return err
+			}
+		default:
+			waiting = 1
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return str.commitTickers(ctx, data)
+}
+
+// sendTickers sends the buffered tickers for commit as per the backpressure policy of the storage,
+// when the previous batches are still waiting for commit.
+func (str *strCommit) sendTickers(ctx context.Context, shard *commitShard, data []storage.Ticker) error {
+	switch str.Backpressure {
+	case "drop_newest":
+		select {
+		case shard.tickers <- data:
+		default:
+			str.dropped("ticker", data[0].Exchange, len(data))
+		}
+		return nil
+	case "drop_oldest":
+		for {
+			select {
+			case shard.tickers <- data:
+				return nil
+			default:
+			}
+
+			// Batch may have been taken by the commit worker in between, then the send is just tried again.
+			select {
+			case old := <-shard.tickers:
+				str.dropped("ticker", old[0].Exchange, len(old))
+			default:
+			}
+		}
+	default:
+		select {
+		case shard.tickers <- data:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// dropped counts the records dropped by the backpressure policy of the storage.
+func (str *strCommit) dropped(channel string, exchange string, count int) {
+	metrics.DroppedRecords.WithLabelValues(str.Name, exchange, channel).Add(float64(count))
+	log.Debug().Str("storage", str.Name).Str("exchange", exchange).Str("channel", channel).Int("count", count).Msg("records dropped by backpressure policy")
+}
+
+// commitTickers commits the tickers to the storage, retrying on failure as per the retry policy of the storage.
+// Once the retries are exhausted, the batch is committed to the fallback storage, if configured.
+// Otherwise it is spooled to the WAL, if enabled, to be replayed later,
+// or it is written to the dead-letter directory, if configured, or the error is returned.
+func (str *strCommit) commitTickers(ctx context.Context, data []storage.Ticker) error {
+	walPending := str.WAL != nil && str.WAL.Pending()
+	if str.Failover != nil && str.Failover.Active(walPending) {
+		return str.failoverTickers(ctx, data)
+	}
+
+	// Batches are spooled behind the ones yet to be replayed, to keep the order.
+	if walPending {
+		return str.spoolTickers(data, nil)
+	}
+	err := str.retry(ctx, func() error {
+		return str.Storage.CommitTickers(ctx, data)
+	})
+	if err == nil {
+		if str.Failover != nil && str.Failover.Recover() {
+			log.Info().Str("storage", str.Name).Msg("switched back from fallback storage")
+		}
+		return nil
+	}
+	if errors.Is(err, ctx.Err()) {
+		return err
+	}
+	logErrStack(err)
+	if str.Failover != nil {
+		if str.Failover.Fail() {
+			log.Error().Str("storage", str.Name).Str("fallback", str.Failover.Fallback.Name).Msg("switched to fallback storage")
+		}
+		return str.failoverTickers(ctx, data)
+	}
+	if str.WAL != nil {
+		return str.spoolTickers(data, err)
+	}
+	return str.deadLetterTickers(data, err)
+}
+
+// failoverTickers commits the tickers to the fallback storage.
+// Batch is also spooled to the WAL, if enabled, so that it is replayed to the primary storage once it is back.
+// If the fallback fails as well, the batch is handled same as without it.
+func (str *strCommit) failoverTickers(ctx context.Context, data []storage.Ticker) error {
+	err := str.Failover.Fallback.Storage.CommitTickers(ctx, data)
+	if err != nil {
+		if errors.Is(err, ctx.Err()) {
+			return err
+		}
+		logErrStack(err)
+	}
+	if str.WAL != nil {
+		return str.spoolTickers(data, err)
+	}
+	if err != nil {
+		return str.deadLetterTickers(data, err)
+	}
+	return nil
+}
+
+// spoolTickers writes the tickers to the WAL.
+// If the WAL is full, the batch is handled same as without WAL.
+func (str *strCommit) spoolTickers(data []storage.Ticker, commitErr error) error {
+	err := str.WAL.AppendTickers(data)
+	if err == nil {
+		return nil
+	}
+	logErrStack(err)
+	if commitErr == nil {
+		commitErr = err
+	}
+	return str.deadLetterTickers(data, commitErr)
+}
+
+// deadLetterTickers writes the failed tickers to the dead-letter directory, if configured,
+// otherwise the commit error is returned.
+func (str *strCommit) deadLetterTickers(data []storage.Ticker, err error) error {
+	if str.DeadLetter == nil {
+		return err
+	}
+	if dlErr := str.DeadLetter.WriteTickers(str.Name, err, data); dlErr != nil {
+		logErrStack(dlErr)
+		return dlErr
+	}
+	log.Error().Str("storage", str.Name).Int("tickers", len(data)).Msg("ticker batch written to dead-letter")
+	return nil
+}
+
+// flushTrades commits the partially filled trade buffer of the shard, after the full ones waiting in its go channel,
+// which are older. Buffer is left for the next flush while a full one taken before it is still being sent,
+// as that one would otherwise be committed after the newer buffer.
+func (str *strCommit) flushTrades(ctx context.Context, shard *commitShard) error {
+	shard.mu.Lock()
+	if shard.tradesSending > 0 {
+		shard.mu.Unlock()
+		return nil
+	}
+	data := shard.tradeBuf
+	shard.tradeBuf = nil
+
+	// Buffers sent after this point are newer, so only the ones already waiting are committed first.
+	waiting := len(shard.trades)
+	shard.mu.Unlock()
+	for ; waiting > 0; waiting-- {
+		select {
+		case old := <-shard.trades:
+			if err := str.commitTrades(ctx, old); err != nil {
+				return err
+			}
+		default:
+			waiting = 1
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return str.commitTrades(ctx, data)
+}
+
+// sendTrades sends the buffered trades for commit as per the backpressure policy of the storage,
+// when the previous batches are still waiting for commit.
+func (str *strCommit) sendTrades(ctx context.Context, shard *commitShard, data []storage.Trade) error {
+	switch str.Backpressure {
+	case "drop_newest":
+		select {
+		case shard.trades <- data:
+		default:
+			str.dropped("trade", data[0].Exchange, len(data))
+		}
+		return nil
+	case "drop_oldest":
+		for {
+			select {
+			case shard.trades <- data:
+				return nil
+			default:
+			}
+
+			// Batch may have been taken by the commit worker in between, then the send is just tried again.
+			select {
+			case old := <-shard.trades:
+				str.dropped("trade", old[0].Exchange, len(old))
+			default:
+			}
+		}
+	default:
+		select {
+		case shard.trades <- data:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// commitTrades commits the trades to the storage, retrying on failure as per the retry policy of the storage.
+// Once the retries are exhausted, the batch is committed to the fallback storage, if configured.
+// Otherwise it is spooled to the WAL, if enabled, to be replayed later,
+// or it is written to the dead-letter directory, if configured, or the error is returned.
+func (str *strCommit) commitTrades(ctx context.Context, data []storage.Trade) error {
+	walPending := str.WAL != nil && str.WAL.Pending()
+	if str.Failover != nil && str.Failover.Active(walPending) {
+		return str.failoverTrades(ctx, data)
+	}
+
+	// Batches are spooled behind the ones yet to be replayed, to keep the order.
+	if walPending {
+		return str.spoolTrades(data, nil)
+	}
+	err := str.retry(ctx, func() error {
+		return str.Storage.CommitTrades(ctx, data)
+	})
+	if err == nil {
+		str.observeCommit(str.Name, data)
+		if str.Failover != nil && str.Failover.Recover() {
+			log.Info().Str("storage", str.Name).Msg("switched back from fallback storage")
+		}
+		return nil
+	}
+	if errors.Is(err, ctx.Err()) {
+		return err
+	}
+	logErrStack(err)
+	if str.Failover != nil {
+		if str.Failover.Fail() {
+			log.Error().Str("storage", str.Name).Str("fallback", str.Failover.Fallback.Name).Msg("switched to fallback storage")
+		}
+		return str.failoverTrades(ctx, data)
+	}
+	if str.WAL != nil {
+		return str.spoolTrades(data, err)
+	}
+	return str.deadLetterTrades(data, err)
+}
+
+// observeCommit observes the commit latency of the trades committed to the storage.
+// Trades replayed later from the WAL are not observed, as their latency is of the outage than of the pipeline.
+func (str *strCommit) observeCommit(name string, data []storage.Trade) {
+	now := time.Now()
+	for i := range data {
+		metrics.ObserveTradeCommit(name, data[i].Exchange, data[i].MktCommitName, data[i].Timestamp, now)
+	}
+}
+
+// failoverTrades commits the trades to the fallback storage.
+// Batch is also spooled to the WAL, if enabled, so that it is replayed to the primary storage once it is back.
+// If the fallback fails as well, the batch is handled same as without it.
+func (str *strCommit) failoverTrades(ctx context.Context, data []storage.Trade) error {
+	err := str.Failover.Fallback.Storage.CommitTrades(ctx, data)
+	if err != nil {
+		if errors.Is(err, ctx.Err()) {
+			return err
+		}
+		logErrStack(err)
+	} else {
+		str.observeCommit(str.Failover.Fallback.Name, data)
+	}
+	if str.WAL != nil {
+		return str.spoolTrades(data, err)
+	}
+	if err != nil {
+		return str.deadLetterTrades(data, err)
+	}
+	return nil
+}
+
+// spoolTrades writes the trades to the WAL.
+// If the WAL is full, the batch is handled same as without WAL.
+func (str *strCommit) spoolTrades(data []storage.Trade, commitErr error) error {
+	err := str.WAL.AppendTrades(data)
+	if err == nil {
+		return nil
+	}
+	logErrStack(err)
+	if commitErr == nil {
+		commitErr = err
+	}
+	return str.deadLetterTrades(data, commitErr)
+}
+
+// deadLetterTrades writes the failed trades to the dead-letter directory, if configured,
+// otherwise the commit error is returned.
+func (str *strCommit) deadLetterTrades(data []storage.Trade, err error) error {
+	if str.DeadLetter == nil {
+		return err
+	}
+	if dlErr := str.DeadLetter.WriteTrades(str.Name, err, data); dlErr != nil {
+		logErrStack(dlErr)
+		return dlErr
+	}
+	log.Error().Str("storage", str.Name).Int("trades", len(data)).Msg("trade batch written to dead-letter")
+	return nil
+}
+
+// wsRecords commits the records of the other channels received through the go channel till the context is cancelled.
+// They are committed by a single go routine, as their volume is low compared to the tickers and trades.
+// If the storage has a flush interval, the partially filled buffers are also committed at every interval.
+func (str *strCommit) wsRecords(ctx context.Context) error {
+	var flush <-chan time.Time
+	if str.FlushIntSec > 0 {
+		ticker := time.NewTicker(time.Duration(str.FlushIntSec) * time.Second)
+		defer ticker.Stop()
+		flush = ticker.C
+	}
+	for {
+		select {
+		case batch := <-str.records:
+			if err := str.commitRecords(ctx, batch); err != nil {
+				return err
+			}
+		case <-flush:
+			if err := str.flushRecords(ctx); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// flushRecords commits the partially filled record buffers, after the full ones waiting in the go channel,
+// which are older. Buffers are left for the next flush while a full one taken before them is still being sent.
+func (str *strCommit) flushRecords(ctx context.Context) error {
+	str.mu.Lock()
+	if str.sending > 0 {
+		str.mu.Unlock()
+		return nil
+	}
+	var batches []recordBatch
+	for channel, data := range str.recordBufs {
+		if len(data) > 0 {
+			batches = append(batches, recordBatch{channel: channel, data: data})
+			str.recordBufs[channel] = nil
+		}
+	}
+
+	// Buffers sent after this point are newer, so only the ones already waiting are committed first.
+	waiting := len(str.records)
+	str.mu.Unlock()
+	for ; waiting > 0; waiting-- {
+		select {
+		case batch := <-str.records:
+			if err := str.commitRecords(ctx, batch); err != nil {
+				return err
+			}
+		default:
+			waiting = 1
+		}
+	}
+	for _, batch := range batches {
+		if err := str.commitRecords(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bufferRecord buffers the websocket record of the channel
+// and sends the buffer for commit, once it reaches the commit buffer size of the channel.
+func (str *strCommit) bufferRecord(ctx context.Context, channel string, record interface{}) error {
+	str.mu.Lock()
+	str.recordBufs[channel] = append(str.recordBufs[channel], record)
+	var data []interface{}
+	if len(str.recordBufs[channel]) >= str.RecordCommitBuf(channel) {
+		data = str.recordBufs[channel]
+		str.recordBufs[channel] = nil
+		str.sending++
+	}
+	str.mu.Unlock()
+	if data == nil {
+		return nil
+	}
+	err := str.sendRecords(ctx, recordBatch{channel: channel, data: data})
+	str.mu.Lock()
+	str.sending--
+	str.mu.Unlock()
+	return err
+}
+
+// sendRecords sends the buffered records for commit as per the backpressure policy of the storage,
+// when the previous batches are still waiting for commit.
+func (str *strCommit) sendRecords(ctx context.Context, batch recordBatch) error {
+	switch str.Backpressure {
+	case "drop_newest":
+		select {
+		case str.records <- batch:
+		default:
+			str.dropped(batch.channel, recordExchange(batch.data[0]), len(batch.data))
+		}
+		return nil
+	case "drop_oldest":
+		for {
+			select {
+			case str.records <- batch:
+				return nil
+			default:
+			}
+
+			// Batch may have been taken by the commit go routine in between, then the send is just tried again.
+			select {
+			case old := <-str.records:
+				str.dropped(old.channel, recordExchange(old.data[0]), len(old.data))
+			default:
+			}
+		}
+	default:
+		select {
+		case str.records <- batch:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// commitRecords commits the records to the storage, retrying on failure as per the retry policy of the storage.
+// Once the retries are exhausted, the batch is committed to the fallback storage, if configured,
+// otherwise it is written to the dead-letter directory, if configured, or the error is returned.
+// Records are not spooled to the WAL, which keeps only the tickers and trades.
+func (str *strCommit) commitRecords(ctx context.Context, batch recordBatch) error {
+	if str.Failover != nil && str.Failover.Active(false) {
+		return str.failoverRecords(ctx, batch)
+	}
+	err := str.retry(ctx, func() error {
+		return storage.CommitRecords(ctx, str.Storage, batch.channel, batch.data)
+	})
+	if err == nil {
+		if str.Failover != nil && str.Failover.Recover() {
+			log.Info().Str("storage", str.Name).Msg("switched back from fallback storage")
+		}
+		return nil
+	}
+	if errors.Is(err, ctx.Err()) {
+		return err
+	}
+	logErrStack(err)
+	if str.Failover != nil {
+		if str.Failover.Fail() {
+			log.Error().Str("storage", str.Name).Str("fallback", str.Failover.Fallback.Name).Msg("switched to fallback storage")
+		}
+		return str.failoverRecords(ctx, batch)
+	}
+	return str.deadLetterRecords(batch, err)
+}
+
+// failoverRecords commits the records to the fallback storage, if it implements the committer of the record type.
+// If the fallback fails as well, the batch is handled same as without it.
+func (str *strCommit) failoverRecords(ctx context.Context, batch recordBatch) error {
+	err := storage.CommitRecords(ctx, str.Failover.Fallback.Storage, batch.channel, batch.data)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, ctx.Err()) {
+		return err
+	}
+	logErrStack(err)
+	return str.deadLetterRecords(batch, err)
+}
+
+// deadLetterRecords writes the failed records to the dead-letter directory, if configured,
+// otherwise the commit error is returned.
+func (str *strCommit) deadLetterRecords(batch recordBatch, err error) error {
+	if str.DeadLetter == nil {
+		return err
+	}
+	if dlErr := str.DeadLetter.WriteRecords(str.Name, batch.channel, err, batch.data); dlErr != nil {
+		logErrStack(dlErr)
+		return dlErr
+	}
+	log.Error().Str("storage", str.Name).Str("channel", batch.channel).Int("records", len(batch.data)).Msg("record batch written to dead-letter")
+	return nil
+}
+
+// recordExchange returns the exchange of the record, for the dropped records metric.
+func recordExchange(record interface{}) string {
+	switch r := record.(type) {
+	case storage.MarkPrice:
+		return r.Exchange
+	case storage.BBO:
+		return r.Exchange
+	case storage.Trade:
+		return r.Exchange
+	case storage.TradingStatus:
+		return r.Exchange
+	case storage.OrderFlow:
+		return r.Exchange
+	case storage.Instrument:
+		return r.Exchange
+	case storage.Candle:
+		return r.Exchange
+	case storage.AvgPrice:
+		return r.Exchange
+	case storage.BookMetric:
+		return r.Exchange
+	case storage.MarketStats:
+		return r.Exchange
+	}
+	return ""
+}
+
+// retry calls the commit function till it succeeds or the retries of the storage are exhausted,
+// waiting for an exponentially growing gap between the calls.
+func (str *strCommit) retry(ctx context.Context, commit func() error) error {
+	err := commit()
+	if err == nil || str.Retry == nil {
+		return err
+	}
+	retry := config.Retry{
+		GapSec:            str.Retry.GapSec,
+		BackoffMultiplier: str.Retry.BackoffMultiplier,
+		MaxGapSec:         str.Retry.MaxGapSec,
+	}
+	for i := 1; i <= str.Retry.Number; i++ {
+		if errors.Is(err, ctx.Err()) {
+			return err
+		}
+		gap := supervisor.Gap(&retry, i)
+		log.Error().Err(err).Str("storage", str.Name).Int("retry", i).Msg(fmt.Sprintf("retrying commit in %v seconds", gap.Seconds()))
+		timer := time.NewTimer(gap)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		if err = commit(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// wsTicker buffers the websocket ticker for each storage of the market channel, in the commit shard of the market,
+// and sends the buffer for commit, once it reaches the commit buffer size of the storage.
+func (cd *commitData) wsTicker(ctx context.Context, key cfgLookupKey, val *cfgLookupVal, ticker storage.Ticker) error {
+	for _, str := range val.strs {
+		if !cd.considerStr(key, str.Name, val.strConsiderIntSec[str.Name]) {
+			continue
+		}
+		shard := str.shard(ticker.MktID)
+		shard.mu.Lock()
+		shard.tickerBuf = append(shard.tickerBuf, ticker)
+		var data []storage.Ticker
+		if len(shard.tickerBuf) >= str.TickerCommitBuf {
+			data = shard.tickerBuf
+			shard.tickerBuf = nil
+			shard.tickersSending++
+		}
+		shard.mu.Unlock()
+		if data != nil {
+			err := str.sendTickers(ctx, shard, data)
+			shard.mu.Lock()
+			shard.tickersSending--
+			shard.mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// wsTrade buffers the websocket trade for each storage of the market channel, in the commit shard of the market,
+// and sends the buffer for commit, once it reaches the commit buffer size of the storage.
+// Receive latency of the trade is observed, if enabled.
+func (cd *commitData) wsTrade(ctx context.Context, key cfgLookupKey, val *cfgLookupVal, trade storage.Trade) error {
+	metrics.ObserveTradeReceive(trade.Exchange, trade.MktCommitName, trade.Timestamp)
+	for _, str := range val.strs {
+		if !cd.considerStr(key, str.Name, val.strConsiderIntSec[str.Name]) {
+			continue
+		}
+		shard := str.shard(trade.MktID)
+		shard.mu.Lock()
+		shard.tradeBuf = append(shard.tradeBuf, trade)
+		var data []storage.Trade
+		if len(shard.tradeBuf) >= str.TradeCommitBuf {
+			data = shard.tradeBuf
+			shard.tradeBuf = nil
+			shard.tradesSending++
+		}
+		shard.mu.Unlock()
+		if data != nil {
+			err := str.sendTrades(ctx, shard, data)
+			shard.mu.Lock()
+			shard.tradesSending--
+			shard.mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restTicker buffers the REST ticker for each storage of the market channel
+// and commits the buffer right away, once it reaches the commit buffer size of the storage
+// or its first ticker is older than the flush interval of the storage.
+func (cd *commitData) restTicker(ctx context.Context, val *cfgLookupVal, ticker storage.Ticker) error {
+	if cd.tickers == nil {
+		cd.tickers = make(map[string][]storage.Ticker)
+		cd.tickersAt = make(map[string]time.Time)
+	}
+	for _, str := range val.strs {
+		if len(cd.tickers[str.Name]) == 0 {
+			cd.tickersAt[str.Name] = time.Now()
+		}
+		cd.tickers[str.Name] = append(cd.tickers[str.Name], ticker)
+		if len(cd.tickers[str.Name]) >= str.TickerCommitBuf || (str.FlushIntSec > 0 && time.Since(cd.tickersAt[str.Name]) >= time.Duration(str.FlushIntSec)*time.Second) {
+			if err := str.commitTickers(ctx, cd.tickers[str.Name]); err != nil {
+				return err
+			}
+			cd.tickers[str.Name] = nil
+		}
+	}
+	return nil
+}
+
+// restTrade buffers the REST trade for each storage of the market channel
+// and commits the buffer right away, once it reaches the commit buffer size of the storage
+// or its first trade is older than the flush interval of the storage.
+// Receive latency of the trade is observed, if enabled.
+func (cd *commitData) restTrade(ctx context.Context, val *cfgLookupVal, trade storage.Trade) error {
+	metrics.ObserveTradeReceive(trade.Exchange, trade.MktCommitName, trade.Timestamp)
+	if cd.trades == nil {
+		cd.trades = make(map[string][]storage.Trade)
+		cd.tradesAt = make(map[string]time.Time)
+	}
+	for _, str := range val.strs {
+		if len(cd.trades[str.Name]) == 0 {
+			cd.tradesAt[str.Name] = time.Now()
+		}
+		cd.trades[str.Name] = append(cd.trades[str.Name], trade)
+		if len(cd.trades[str.Name]) >= str.TradeCommitBuf || (str.FlushIntSec > 0 && time.Since(cd.tradesAt[str.Name]) >= time.Duration(str.FlushIntSec)*time.Second) {
+			if err := str.commitTrades(ctx, cd.trades[str.Name]); err != nil {
+				return err
+			}
+			cd.trades[str.Name] = nil
+		}
+	}
+	return nil
+}
+
+// wsRecord buffers the websocket record of a channel other than ticker and trade
+// for each storage of the market channel implementing the committer of the record type,
+// and sends the buffer for commit, once it reaches the commit buffer size of the channel.
+func (cd *commitData) wsRecord(ctx context.Context, key cfgLookupKey, val *cfgLookupVal, channel string, record interface{}) error {
+	for _, str := range val.strs {
+		if !storage.CommitsRecords(str.Storage, channel) || !cd.considerStr(key, str.Name, val.strConsiderIntSec[str.Name]) {
+			continue
+		}
+		if err := str.bufferRecord(ctx, channel, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wsAggregate is same as wsRecord, for the records aggregated from the websocket trades, like candles.
+// They are not sampled by the per storage consider interval, as each of them already summarizes all the trades.
+func (cd *commitData) wsAggregate(ctx context.Context, val *cfgLookupVal, channel string, record interface{}) error {
+	for _, str := range val.strs {
+		if !storage.CommitsRecords(str.Storage, channel) {
+			continue
+		}
+		if err := str.bufferRecord(ctx, channel, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restRecord buffers the REST record of a channel other than ticker and trade
+// for each storage of the market channel implementing the committer of the record type,
+// and commits the buffer right away, once it reaches the commit buffer size of the channel
+// or its first record is older than the flush interval of the storage.
+func (cd *commitData) restRecord(ctx context.Context, val *cfgLookupVal, channel string, record interface{}) error {
+	if cd.records == nil {
+		cd.records = make(map[strRecordKey][]interface{})
+		cd.recordsAt = make(map[strRecordKey]time.Time)
+	}
+	for _, str := range val.strs {
+		if !storage.CommitsRecords(str.Storage, channel) {
+			continue
+		}
+		k := strRecordKey{storage: str.Name, channel: channel}
+		if len(cd.records[k]) == 0 {
+			cd.recordsAt[k] = time.Now()
+		}
+		cd.records[k] = append(cd.records[k], record)
+		if len(cd.records[k]) >= str.RecordCommitBuf(channel) || (str.FlushIntSec > 0 && time.Since(cd.recordsAt[k]) >= time.Duration(str.FlushIntSec)*time.Second) {
+			if err := str.commitRecords(ctx, recordBatch{channel: channel, data: cd.records[k]}); err != nil {
+				return err
+			}
+			cd.records[k] = nil
+		}
+	}
+	return nil
+}
+
+// candleKey is a key in the open candles map.
+type candleKey struct {
+	market   string
+	interval time.Duration
+}
+
+// candleIntervals converts configured candle intervals of the trade channel to durations.
+// Values are already validated while starting the app.
+func candleIntervals(intervals []string) []time.Duration {
+	var durations []time.Duration
+	for _, interval := range intervals {
+		d, err := time.ParseDuration(interval)
+		if err == nil {
+			durations = append(durations, d)
+		}
+	}
+	return durations
+}
+
+// addCandleTrade updates the open candles of the trade market with the trade
+// and returns the candles which are completed by it.
+// A candle is completed by the first trade of the next interval, so candles are not built for intervals
+// without any trade and late trades of an already completed candle are ignored.
+func (cd *commitData) addCandleTrade(trade storage.Trade, intervals []time.Duration) []storage.Candle {
+	if cd.openCandles == nil {
+		cd.openCandles = make(map[candleKey]*storage.Candle)
+	}
+	var completed []storage.Candle
+	for _, interval := range intervals {
+		start := trade.Timestamp.Truncate(interval)
+		key := candleKey{market: trade.MktID, interval: interval}
+		candle, ok := cd.openCandles[key]
+		if ok {
+			if start.Before(candle.Timestamp) {
+				continue
+			}
+			if start.Equal(candle.Timestamp) {
+				if trade.Price > candle.High {
+					candle.High = trade.Price
+				}
+				if trade.Price < candle.Low {
+					candle.Low = trade.Price
+				}
+				candle.Close = trade.Price
+				candle.Volume += trade.Size
+				continue
+			}
+			completed = append(completed, *candle)
+		}
+		cd.openCandles[key] = &storage.Candle{
+			Exchange:      trade.Exchange,
+			MktID:         trade.MktID,
+			MktCommitName: trade.MktCommitName,
+			Interval:      intervalName(interval),
+			Open:          trade.Price,
+			High:          trade.Price,
+			Low:           trade.Price,
+			Close:         trade.Price,
+			Volume:        trade.Size,
+			Timestamp:     start.UTC(),
+		}
+	}
+	return completed
+}
+
+// intervalName returns the short name of the candle interval or average price window, e.g. 5m for 5 minutes.
+func intervalName(interval time.Duration) string {
+	switch {
+	case interval%time.Hour == 0:
+		return strconv.Itoa(int(interval/time.Hour)) + "h"
+	case interval%time.Minute == 0:
+		return strconv.Itoa(int(interval/time.Minute)) + "m"
+	default:
+		return strconv.Itoa(int(interval/time.Second)) + "s"
+	}
+}
+
+// avgPriceKey is a key in the average price windows map.
+type avgPriceKey struct {
+	market string
+	window time.Duration
+}
+
+// avgPriceWindow holds the trades of a market within the rolling window
+// along with the last one before it, which gives the price at the window start for TWAP.
+type avgPriceWindow struct {
+	trades   []avgPriceTrade
+	lastEmit time.Time
+}
+
+type avgPriceTrade struct {
+	price     float64
+	size      float64
+	timestamp time.Time
+}
+
+// addAvgPriceTrade adds the trade to the rolling windows of the trade market
+// and returns VWAP and TWAP of the windows.
+// Values are returned at most once a second per window, with the first trade of the second,
+// and late trades which are older than the last one are ignored.
+func (cd *commitData) addAvgPriceTrade(trade storage.Trade, windows []time.Duration) []storage.AvgPrice {
+	if cd.avgPriceWindows == nil {
+		cd.avgPriceWindows = make(map[avgPriceKey]*avgPriceWindow)
+	}
+	var avgPrices []storage.AvgPrice
+	for _, window := range windows {
+		key := avgPriceKey{market: trade.MktID, window: window}
+		w, ok := cd.avgPriceWindows[key]
+		if !ok {
+			w = &avgPriceWindow{}
+			cd.avgPriceWindows[key] = w
+		}
+		if n := len(w.trades); n > 0 && trade.Timestamp.Before(w.trades[n-1].timestamp) {
+			continue
+		}
+		w.trades = append(w.trades, avgPriceTrade{price: trade.Price, size: trade.Size, timestamp: trade.Timestamp})
+
+		// Trades which went out of the window are removed.
+		start := trade.Timestamp.Add(-window)
+		i := 0
+		for i+1 < len(w.trades) && !w.trades[i+1].timestamp.After(start) {
+			i++
+		}
+		w.trades = w.trades[i:]
+
+		second := trade.Timestamp.Truncate(time.Second)
+		if !second.After(w.lastEmit) {
+			continue
+		}
+		w.lastEmit = second
+
+		// Price of each trade is weighted by its size for VWAP and
+		// by the time till the next trade (within the window) for TWAP.
+		var pv, v, pt, t float64
+		for j, tr := range w.trades {
+			if tr.timestamp.After(start) {
+				pv += tr.price * tr.size
+				v += tr.size
+			}
+			from := tr.timestamp
+			if from.Before(start) {
+				from = start
+			}
+			to := trade.Timestamp
+			if j+1 < len(w.trades) {
+				to = w.trades[j+1].timestamp
+			}
+			if d := to.Sub(from).Seconds(); d > 0 {
+				pt += tr.price * d
+				t += d
+			}
+		}
+		avgPrice := storage.AvgPrice{
+			Exchange:      trade.Exchange,
+			MktID:         trade.MktID,
+			MktCommitName: trade.MktCommitName,
+			Window:        intervalName(window),
+			VWAP:          trade.Price,
+			TWAP:          trade.Price,
+			Timestamp:     trade.Timestamp,
+		}
+		if v > 0 {
+			avgPrice.VWAP = pv / v
+		}
+		if t > 0 {
+			avgPrice.TWAP = pt / t
+		}
+		avgPrices = append(avgPrices, avgPrice)
+	}
+	return avgPrices
+}
+
+// quoteAssets are the common quote assets used to split the market symbols without a separator,
+// longer ones first so that USDT is matched before USD.
+var quoteAssets = []string{
+	"USDT", "USDC", "BUSD", "TUSD", "USDP", "DAI", "PAX", "UST",
+	"EUR", "USD", "GBP", "JPY", "TRY", "AUD", "BRL", "RUB", "KRW",
+	"BTC", "ETH", "BNB", "TRX", "XRP", "DOT", "SOL",
+}
+
+// marketAssets returns base and quote assets of the market in upper case.
+// Symbols with a separator, e.g. BTC/USD, BTC-USD, BTC_USDT, TESTBTC:TESTUSD, are split on it and
+// the other ones, e.g. BTCUSDT, btcusd, are split on the known quote asset suffix.
+// Base and quote given in the market config override the parsed ones, for symbols which are ambiguous.
+func marketAssets(market config.Market) (string, string) {
+	var base, quote string
+	symbol := strings.ToUpper(market.ID)
+	if i := strings.IndexAny(symbol, "/-_:"); i != -1 {
+		base, quote = symbol[:i], symbol[i+1:]
+	} else {
+		for _, q := range quoteAssets {
+			if len(symbol) > len(q) && strings.HasSuffix(symbol, q) {
+				base, quote = symbol[:len(symbol)-len(q)], q
+				break
+			}
+		}
+	}
+	if market.Base != "" {
+		base = strings.ToUpper(market.Base)
+	}
+	if market.Quote != "" {
+		quote = strings.ToUpper(market.Quote)
+	}
+	return base, quote
+}
+
+// newTickFilter converts configured tick filter of the market channel, nil if not configured.
+// Values are already validated while starting the app.
+func newTickFilter(cfg *config.TickFilter) *tickFilter {
+	if cfg == nil {
+		return nil
+	}
+	filter := tickFilter{
+		deviation: cfg.DeviationPercent / 100,
+		window:    cfg.Window,
+		drop:      cfg.Action == "drop",
+	}
+	if filter.window == 0 {
+		filter.window = 20
+	}
+	return &filter
+}
+
+// filterTicker checks the ticker with the configured tick filter.
+// It returns true if the ticker should be dropped, otherwise bad ticker is flagged.
+func (cd *commitData) filterTicker(ticker *storage.Ticker, key cfgLookupKey, filter *tickFilter) bool {
+	if filter == nil {
+		return false
+	}
+	ticker.IsBadTick = cd.badTick(ticker.Exchange, key, filter, ticker.Price, ticker.Price <= 0)
+	return ticker.IsBadTick && filter.drop
+}
+
+// filterTrade checks the trade with the configured tick filter.
+// It returns true if the trade should be dropped, otherwise bad trade is flagged.
+func (cd *commitData) filterTrade(trade *storage.Trade, key cfgLookupKey, filter *tickFilter) bool {
+	if filter == nil {
+		return false
+	}
+	trade.IsBadTick = cd.badTick(trade.Exchange, key, filter, trade.Price, trade.Price <= 0 || trade.Size <= 0)
+	return trade.IsBadTick && filter.drop
+}
+
+// badTick tells whether the price is invalid or deviates more than the configured percentage
+// from the median of the last good prices of the market channel.
+// Deviation is checked only after the window is filled and bad prices are never added to it,
+// so that a single bad print does not move the median.
+func (cd *commitData) badTick(exchange string, key cfgLookupKey, filter *tickFilter, price float64, invalid bool) bool {
+	if cd.tickPrices == nil {
+		cd.tickPrices = make(map[cfgLookupKey][]float64)
+		cd.badTicks = make(map[cfgLookupKey]int64)
+	}
+	prices := cd.tickPrices[key]
+	bad := invalid
+	if !bad && filter.deviation > 0 && len(prices) == filter.window {
+		sorted := append([]float64(nil), prices...)
+		sort.Float64s(sorted)
+		median := sorted[len(sorted)/2]
+		if len(sorted)%2 == 0 {
+			median = (sorted[len(sorted)/2-1] + median) / 2
+		}
+		bad = math.Abs(price-median) > median*filter.deviation
+	}
+	if bad {
+		cd.badTicks[key]++
+		log.Warn().Str("exchange", exchange).Str("market", key.market).Str("channel", key.channel).Float64("price", price).Bool("dropped", filter.drop).Int64("count", cd.badTicks[key]).Msg("bad tick detected")
+		return true
+	}
+	if len(prices) == filter.window {
+		prices = prices[1:]
+	}
+	cd.tickPrices[key] = append(prices, price)
+	return false
+}
+
+// filterTradeRules tells whether the trade should be excluded from storages by the configured trade filter.
+// Excluded trades are counted in the app metrics with the reason.
+func filterTradeRules(trade *storage.Trade, filter *config.TradeFilter) bool {
+	if filter == nil {
+		return false
+	}
+	var reason string
+	switch {
+	case trade.Size < filter.MinSize:
+		reason = "size"
+	case filter.Side != "" && trade.Side != filter.Side:
+		reason = "side"
+	case trade.Price < filter.MinPrice || (filter.MaxPrice > 0 && trade.Price > filter.MaxPrice):
+		reason = "price"
+	default:
+		return false
+	}
+	metrics.FilteredTrades.WithLabelValues(trade.Exchange, trade.MktCommitName, reason).Inc()
+	return true
+}
+
+// bookLevels returns configured order book levels of the book metric channel, top of the book by default.
+func bookLevels(levels []int) []int {
+	if len(levels) == 0 {
+		return []int{1}
+	}
+	return levels
+}
+
+// maxBookLevel returns the deepest of the order book levels.
+func maxBookLevel(levels []int) int {
+	max := 0
+	for _, level := range levels {
+		if level > max {
+			max = level
+		}
+	}
+	return max
+}
+
+// parseBookSide converts price, size pairs of one side of the order book received from exchange,
+// sorted from the best price, up to the given number of levels.
+func parseBookSide(side [][]string, levels int) ([][2]float64, error) {
+	if len(side) > levels {
+		side = side[:levels]
+	}
+	out := make([][2]float64, 0, len(side))
+	for _, pair := range side {
+		if len(pair) < 2 {
+			return nil, errors.New("order book level should have price and size")
+		}
+		price, err := strconv.ParseFloat(pair[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseFloat(pair[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, [2]float64{price, size})
+	}
+	return out, nil
+}
+
+// bookMetrics calculates bid-ask spread, mid price and depth imbalance of the order book for each of the levels.
+// Depth is the sum of sizes up to the level and imbalance is (bid depth - ask depth) / (bid depth + ask depth),
+// so it ranges from -1 for asks only to 1 for bids only.
+// If the book is shallower than the level, all the available levels are considered.
+func bookMetrics(base storage.BookMetric, bids [][2]float64, asks [][2]float64, levels []int) []storage.BookMetric {
+	if len(bids) == 0 || len(asks) == 0 {
+		return nil
+	}
+	base.Spread = asks[0][0] - bids[0][0]
+	base.MidPrice = (asks[0][0] + bids[0][0]) / 2
+	metrics := make([]storage.BookMetric, 0, len(levels))
+	for _, level := range levels {
+		bookMetric := base
+		bookMetric.Levels = level
+		for i := 0; i < level && i < len(bids); i++ {
+			bookMetric.BidDepth += bids[i][1]
+		}
+		for i := 0; i < level && i < len(asks); i++ {
+			bookMetric.AskDepth += asks[i][1]
+		}
+		if total := bookMetric.BidDepth + bookMetric.AskDepth; total > 0 {
+			bookMetric.Imbalance = (bookMetric.BidDepth - bookMetric.AskDepth) / total
+		}
+		metrics = append(metrics, bookMetric)
+	}
+	return metrics
+}
+
+// precision returns the number of decimal places of the increment value, e.g. 2 for 0.01.
+func precision(increment float64) int {
+	s := strconv.FormatFloat(increment, 'f', -1, 64)
+	if i := strings.IndexByte(s, '.'); i != -1 {
+		return len(s) - i - 1
+	}
+	return 0
 }
 
 // logErrStack logs error with stack trace.
 func logErrStack(err error) {
 	log.Error().Stack().Err(errors.WithStack(err)).Msg("")
 }
+
+// restTradeKey returns the key of the trade received through REST, to skip the ones already received.
+// Trade id is used if sent by the exchange, otherwise the timestamp and the details of the trade,
+// so that the key identifies the trade by itself, not only among the trades at the same time.
+func restTradeKey(trade *storage.Trade) string {
+	if trade.TradeID != "" {
+		return trade.TradeID
+	}
+	return strconv.FormatInt(trade.Timestamp.UnixNano(), 10) + "|" + trade.Side + "|" + strconv.FormatFloat(trade.Size, 'f', -1, 64) + "|" + strconv.FormatFloat(trade.Price, 'f', -1, 64)
+}
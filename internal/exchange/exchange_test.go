@@ -0,0 +1,215 @@
+package exchange
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+)
+
+var testStart = time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+
+// testTrade returns a trade of the BTC-USDT market, the given time after the test start.
+func testTrade(after time.Duration, side string, size, price float64) storage.Trade {
+	return storage.Trade{
+		Exchange:      "test",
+		MktID:         "BTC-USDT",
+		MktCommitName: "BTC/USDT",
+		Side:          side,
+		Size:          size,
+		Price:         price,
+		Timestamp:     testStart.Add(after),
+	}
+}
+
+// TestAddCandleTrade tests the candles built from the trades, completed by the first trade of a later interval.
+func TestAddCandleTrade(t *testing.T) {
+	intervals := map[time.Duration]string{
+		30 * time.Second: "30s",
+		90 * time.Second: "90s",
+		time.Minute:      "1m",
+		15 * time.Minute: "15m",
+		time.Hour:        "1h",
+		24 * time.Hour:   "24h",
+	}
+	for interval, want := range intervals {
+		if got := intervalName(interval); got != want {
+			t.Log("ERROR : interval", interval, "named", got, "expected", want)
+			t.Error("FAILURE : candle interval name")
+		}
+	}
+
+	candle := func(interval string, start time.Duration, open, high, low, close, volume float64) storage.Candle {
+		return storage.Candle{
+			Exchange:      "test",
+			MktID:         "BTC-USDT",
+			MktCommitName: "BTC/USDT",
+			Interval:      interval,
+			Open:          open,
+			High:          high,
+			Low:           low,
+			Close:         close,
+			Volume:        volume,
+			Timestamp:     testStart.Add(start),
+		}
+	}
+	tests := []struct {
+		name      string
+		intervals []time.Duration
+		trades    []storage.Trade
+		want      []storage.Candle
+	}{
+		{
+			name:      "open candle not completed",
+			intervals: []time.Duration{time.Minute},
+			trades: []storage.Trade{
+				testTrade(time.Second, "buy", 1, 100),
+				testTrade(30*time.Second, "sell", 2, 105),
+			},
+		},
+		{
+			name:      "completed by next interval",
+			intervals: []time.Duration{time.Minute},
+			trades: []storage.Trade{
+				testTrade(time.Second, "buy", 1, 100),
+				testTrade(10*time.Second, "sell", 2, 105),
+				testTrade(20*time.Second, "buy", 0.5, 95),
+				testTrade(30*time.Second, "buy", 1, 102),
+				testTrade(time.Minute, "buy", 1, 103),
+			},
+			want: []storage.Candle{candle("1m", 0, 100, 105, 95, 102, 4.5)},
+		},
+		{
+			name:      "no candle for interval without trade",
+			intervals: []time.Duration{time.Minute},
+			trades: []storage.Trade{
+				testTrade(time.Second, "buy", 1, 100),
+				testTrade(3*time.Minute, "buy", 1, 103),
+				testTrade(4*time.Minute, "buy", 1, 104),
+			},
+			want: []storage.Candle{
+				candle("1m", 0, 100, 100, 100, 100, 1),
+				candle("1m", 3*time.Minute, 103, 103, 103, 103, 1),
+			},
+		},
+		{
+			name:      "late trade ignored",
+			intervals: []time.Duration{time.Minute},
+			trades: []storage.Trade{
+				testTrade(time.Minute+time.Second, "buy", 1, 100),
+				testTrade(59*time.Second, "buy", 1, 200),
+				testTrade(2*time.Minute, "buy", 1, 101),
+			},
+			want: []storage.Candle{candle("1m", time.Minute, 100, 100, 100, 100, 1)},
+		},
+		{
+			name:      "multiple intervals",
+			intervals: []time.Duration{time.Minute, 5 * time.Minute},
+			trades: []storage.Trade{
+				testTrade(time.Second, "buy", 1, 100),
+				testTrade(time.Minute, "buy", 2, 110),
+				testTrade(5*time.Minute, "buy", 1, 90),
+			},
+			want: []storage.Candle{
+				candle("1m", 0, 100, 100, 100, 100, 1),
+				candle("1m", time.Minute, 110, 110, 110, 110, 2),
+				candle("5m", 0, 100, 110, 100, 110, 3),
+			},
+		},
+	}
+	for _, tt := range tests {
+		cd := commitData{}
+		var got []storage.Candle
+		for _, trade := range tt.trades {
+			got = append(got, cd.addCandleTrade(trade, tt.intervals)...)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Logf("ERROR : %s : completed candles %+v, expected %+v", tt.name, got, tt.want)
+			t.Error("FAILURE : candles from trades")
+		}
+	}
+}
+
+// TestAddAvgPriceTrade tests the volume and time weighted average prices of the trades in the window,
+// stored at most once a second.
+func TestAddAvgPriceTrade(t *testing.T) {
+	type avgPrice struct {
+		after time.Duration
+		vwap  float64
+		twap  float64
+	}
+	tests := []struct {
+		name   string
+		window time.Duration
+		trades []storage.Trade
+		want   []avgPrice
+	}{
+		{
+			name:   "single trade",
+			window: time.Minute,
+			trades: []storage.Trade{testTrade(0, "buy", 1, 100)},
+			want:   []avgPrice{{0, 100, 100}},
+		},
+		{
+			name:   "weighted by size and time",
+			window: time.Minute,
+			trades: []storage.Trade{
+				testTrade(0, "buy", 1, 100),
+				testTrade(3*time.Second, "buy", 3, 110),
+				testTrade(4*time.Second, "sell", 1, 120),
+			},
+			want: []avgPrice{{0, 100, 100}, {3 * time.Second, 107.5, 100}, {4 * time.Second, 110, 102.5}},
+		},
+		{
+			name:   "once a second",
+			window: time.Minute,
+			trades: []storage.Trade{
+				testTrade(0, "buy", 1, 100),
+				testTrade(100*time.Millisecond, "buy", 1, 200),
+				testTrade(time.Second, "buy", 2, 300),
+			},
+			want: []avgPrice{{0, 100, 100}, {time.Second, 225, 190}},
+		},
+		{
+			name:   "trades out of window",
+			window: 2 * time.Second,
+			trades: []storage.Trade{
+				testTrade(0, "buy", 1, 100),
+				testTrade(time.Second, "buy", 1, 200),
+				testTrade(5*time.Second, "buy", 1, 300),
+			},
+			want: []avgPrice{{0, 100, 100}, {time.Second, 150, 100}, {5 * time.Second, 300, 200}},
+		},
+		{
+			name:   "late trade ignored",
+			window: time.Minute,
+			trades: []storage.Trade{
+				testTrade(2*time.Second, "buy", 1, 100),
+				testTrade(time.Second, "buy", 1, 200),
+				testTrade(4*time.Second, "buy", 1, 300),
+			},
+			want: []avgPrice{{2 * time.Second, 100, 100}, {4 * time.Second, 200, 100}},
+		},
+	}
+	for _, tt := range tests {
+		cd := commitData{}
+		var got []storage.AvgPrice
+		for _, trade := range tt.trades {
+			got = append(got, cd.addAvgPriceTrade(trade, []time.Duration{tt.window})...)
+		}
+		if len(got) != len(tt.want) {
+			t.Logf("ERROR : %s : average prices %+v, expected %+v", tt.name, got, tt.want)
+			t.Error("FAILURE : average prices from trades")
+			continue
+		}
+		for i, want := range tt.want {
+			if !got[i].Timestamp.Equal(testStart.Add(want.after)) || math.Abs(got[i].VWAP-want.vwap) > 1e-9 ||
+				math.Abs(got[i].TWAP-want.twap) > 1e-9 || got[i].Window != intervalName(tt.window) {
+				t.Logf("ERROR : %s : average price %d %+v, expected %+v", tt.name, i, got[i], want)
+				t.Error("FAILURE : average prices from trades")
+			}
+		}
+	}
+}
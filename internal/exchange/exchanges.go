@@ -0,0 +1,147 @@
+package exchange
+
+import (
+	"context"
+	"sort"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// Exchange is a market data exchange module of the app along with its capabilities,
+// so that the initializer can validate the config and start it without knowing the module.
+type Exchange struct {
+	// Start receives the data of the markets from the exchange till the app context is cancelled.
+	Start func(appCtx context.Context, markets []config.Market, retry *config.Retry, connCfg *config.Connection) error
+
+	// Channels are the connectors supporting each of the channels other than ticker and trade,
+	// which are supported through both the websocket and REST connectors by all the exchanges.
+	Channels map[string][]string
+
+	// RESTForWebsocket tells whether the websocket server details are fetched through the REST API.
+	RESTForWebsocket bool
+}
+
+// exchanges holds the exchange modules by their config name.
+// They are registered only while starting the app, so the map is not guarded for concurrent access.
+var exchanges = map[string]Exchange{
+	"ftx": {
+		Start: StartFtx,
+		Channels: map[string][]string{
+			"mark_price": {"rest"},
+			"instrument": {"rest"},
+		},
+	},
+	"coinbase-pro": {
+		Start: StartCoinbasePro,
+		Channels: map[string][]string{
+			"orderflow":      {"websocket"},
+			"trading_status": {"rest"},
+			"instrument":     {"rest"},
+		},
+	},
+	"binance": {
+		Start: StartBinance,
+		Channels: map[string][]string{
+			"bbo":            {"websocket"},
+			"agg_trade":      {"websocket"},
+			"trading_status": {"rest"},
+			"instrument":     {"rest"},
+			"book_metric":    {"rest"},
+		},
+	},
+	"bitfinex": {
+		Start: StartBitfinex,
+	},
+	"hbtc": {
+		Start: StartHbtc,
+		Channels: map[string][]string{
+			"instrument": {"rest"},
+		},
+	},
+	"huobi": {
+		Start: StartHuobi,
+		Channels: map[string][]string{
+			"instrument": {"rest"},
+		},
+	},
+	"gateio": {
+		Start: StartGateio,
+		Channels: map[string][]string{
+			"instrument": {"rest"},
+		},
+	},
+	"kucoin": {
+		Start: StartKucoin,
+		Channels: map[string][]string{
+			"bbo":         {"websocket", "rest"},
+			"instrument":  {"rest"},
+			"book_metric": {"rest"},
+		},
+		RESTForWebsocket: true,
+	},
+	"bitstamp": {
+		Start: StartBitstamp,
+		Channels: map[string][]string{
+			"instrument": {"rest"},
+		},
+	},
+	"bybit": {
+		Start: StartBybit,
+		Channels: map[string][]string{
+			"mark_price": {"websocket", "rest"},
+			"instrument": {"rest"},
+		},
+	},
+	"probit": {
+		Start: StartProbit,
+		Channels: map[string][]string{
+			"instrument": {"rest"},
+		},
+	},
+	"gemini": {
+		Start: StartGemini,
+		Channels: map[string][]string{
+			"block_trade":    {"rest"},
+			"trading_status": {"rest"},
+			"instrument":     {"rest"},
+		},
+	},
+}
+
+// RegisterExchange adds the exchange module under its config name.
+// It should be called before the config is validated.
+func RegisterExchange(name string, exch Exchange) {
+	exchanges[name] = exch
+}
+
+// GetExchange returns the exchange module of the config name.
+func GetExchange(name string) (Exchange, bool) {
+	exch, ok := exchanges[name]
+	return exch, ok
+}
+
+// Supports tells whether the exchange supports the channel through the connector.
+func (e Exchange) Supports(channel string, connector string) bool {
+	if channel == "ticker" || channel == "trade" {
+		return true
+	}
+	for _, c := range e.Channels[channel] {
+		if c == connector {
+			return true
+		}
+	}
+	return false
+}
+
+// ChannelExchanges returns the names of the exchanges supporting the channel through the connector, sorted,
+// to tell the user which exchanges can be configured for it.
+func ChannelExchanges(channel string, connector string) []string {
+	var names []string
+	for name, exch := range exchanges {
+		if exch.Supports(channel, connector) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
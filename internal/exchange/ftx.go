@@ -2,7 +2,6 @@ package exchange
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"math"
 	"net"
@@ -12,9 +11,12 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/arbitrage"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
 	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -22,59 +24,18 @@ import (
 
 // StartFtx is for starting ftx exchange functions.
 func StartFtx(appCtx context.Context, markets []config.Market, retry *config.Retry, connCfg *config.Connection) error {
-
-	// If any error occurs or connection is lost, retry the exchange functions with a time gap till it reaches
-	// a configured number of retry.
-	// Retry counter will be reset back to zero if the elapsed time since the last retry is greater than the configured one.
-	var retryCount int
-	lastRetryTime := time.Now()
-
-	for {
-		err := newFtx(appCtx, markets, connCfg)
-		if err != nil {
-			log.Error().Err(err).Str("exchange", "ftx").Msg("error occurred")
-			if retry.Number == 0 {
-				return errors.New("not able to connect ftx exchange. please check the log for details")
-			}
-			if retry.ResetSec == 0 || time.Since(lastRetryTime).Seconds() < float64(retry.ResetSec) {
-				retryCount++
-			} else {
-				retryCount = 1
-			}
-			lastRetryTime = time.Now()
-			if retryCount > retry.Number {
-				return fmt.Errorf("not able to connect ftx exchange even after %v retry. please check the log for details", retry.Number)
-			}
-
-			log.Error().Str("exchange", "ftx").Int("retry", retryCount).Msg(fmt.Sprintf("retrying functions in %v seconds", retry.GapSec))
-			tick := time.NewTicker(time.Duration(retry.GapSec) * time.Second)
-			select {
-			case <-tick.C:
-				tick.Stop()
-
-			// Return, if there is any error from another exchange.
-			case <-appCtx.Done():
-				log.Error().Str("exchange", "ftx").Msg("ctx canceled, return from StartFtx")
-				return appCtx.Err()
-			}
-		}
-	}
+	return supervisor.Run(appCtx, "ftx", retry, func() error {
+		return newFtx(appCtx, markets, connCfg)
+	})
 }
 
 type ftx struct {
-	ws             connector.Websocket
-	rest           *connector.REST
-	connCfg        *config.Connection
-	cfgMap         map[cfgLookupKey]cfgLookupVal
-	ter            *storage.Terminal
-	es             *storage.ElasticSearch
-	mysql          *storage.MySQL
-	wsTerTickers   chan []storage.Ticker
-	wsTerTrades    chan []storage.Trade
-	wsMysqlTickers chan []storage.Ticker
-	wsMysqlTrades  chan []storage.Trade
-	wsEsTickers    chan []storage.Ticker
-	wsEsTrades     chan []storage.Trade
+	ws          connector.Websocket
+	rest        *connector.REST
+	connCfg     *config.Connection
+	cfgMap      map[cfgLookupKey]cfgLookupVal
+	strs        strCommits
+	marketStats *marketStats
 }
 
 type wsRespFtx struct {
@@ -89,6 +50,8 @@ type wsRespFtx struct {
 
 type wsTickerRespDataFtx struct {
 	Last float64 `json:"last"`
+	Bid  float64 `json:"bid"`
+	Ask  float64 `json:"ask"`
 	Time float64 `json:"time"`
 }
 
@@ -104,6 +67,17 @@ type restTickerRespFtx struct {
 	Result  restRespResultFtx `json:"result"`
 }
 
+type restInstrumentRespFtx struct {
+	Success bool                        `json:"success"`
+	Result  restInstrumentRespResultFtx `json:"result"`
+}
+
+type restInstrumentRespResultFtx struct {
+	Enabled        bool    `json:"enabled"`
+	PriceIncrement float64 `json:"priceIncrement"`
+	SizeIncrement  float64 `json:"sizeIncrement"`
+}
+
 type restTradeRespFtx struct {
 	Success bool                `json:"success"`
 	Result  []restRespResultFtx `json:"result"`
@@ -111,6 +85,12 @@ type restTradeRespFtx struct {
 
 type restRespResultFtx struct {
 	Last  float64 `json:"last"`
+	Bid   float64 `json:"bid"`
+	Ask   float64 `json:"ask"`
+	High  float64 `json:"priceHigh24h"`
+	Low   float64 `json:"priceLow24h"`
+	Mark  float64 `json:"mark"`
+	Index float64 `json:"index"`
 	Side  string  `json:"side"`
 	Size  float64 `json:"size"`
 	Price float64 `json:"price"`
@@ -128,6 +108,7 @@ func newFtx(appCtx context.Context, markets []config.Market, connCfg *config.Con
 	if err != nil {
 		return err
 	}
+	f.marketStats = newMarketStats("ftx", f.cfgMap)
 
 	var (
 		wsCount   int
@@ -157,30 +138,22 @@ func newFtx(appCtx context.Context, markets []config.Market, connCfg *config.Con
 						return f.readWs(ctx)
 					})
 
-					if f.ter != nil {
+					if f.marketStats != nil {
 						ftxErrGroup.Go(func() error {
-							return f.wsTickersToTerminal(ctx)
-						})
-						ftxErrGroup.Go(func() error {
-							return f.wsTradesToTerminal(ctx)
+							return f.marketStats.run(ctx)
 						})
 					}
 
-					if f.mysql != nil {
-						ftxErrGroup.Go(func() error {
-							return f.wsTickersToMySQL(ctx)
-						})
+					for _, str := range f.strs {
+						str := str
 						ftxErrGroup.Go(func() error {
-							return f.wsTradesToMySQL(ctx)
+							return str.wsTickers(ctx)
 						})
-					}
-
-					if f.es != nil {
 						ftxErrGroup.Go(func() error {
-							return f.wsTickersToES(ctx)
+							return str.wsTrades(ctx)
 						})
 						ftxErrGroup.Go(func() error {
-							return f.wsTradesToES(ctx)
+							return str.wsRecords(ctx)
 						})
 					}
 				}
@@ -228,6 +201,7 @@ func (f *ftx) cfgLookup(markets []config.Market) error {
 
 	// Configurations flat map is prepared for easy lookup later in the app.
 	f.cfgMap = make(map[cfgLookupKey]cfgLookupVal)
+	f.strs = make(strCommits)
 	for _, market := range markets {
 		var marketCommitName string
 		if market.CommitName != "" {
@@ -239,31 +213,14 @@ func (f *ftx) cfgLookup(markets []config.Market) error {
 			key := cfgLookupKey{market: market.ID, channel: info.Channel}
 			val := cfgLookupVal{}
 			val.wsConsiderIntSec = info.WsConsiderIntSec
-			for _, str := range info.Storages {
-				switch str {
-				case "terminal":
-					val.terStr = true
-					if f.ter == nil {
-						f.ter = storage.GetTerminal()
-						f.wsTerTickers = make(chan []storage.Ticker, 1)
-						f.wsTerTrades = make(chan []storage.Trade, 1)
-					}
-				case "mysql":
-					val.mysqlStr = true
-					if f.mysql == nil {
-						f.mysql = storage.GetMySQL()
-						f.wsMysqlTickers = make(chan []storage.Ticker, 1)
-						f.wsMysqlTrades = make(chan []storage.Trade, 1)
-					}
-				case "elastic_search":
-					val.esStr = true
-					if f.es == nil {
-						f.es = storage.GetElasticSearch()
-						f.wsEsTickers = make(chan []storage.Ticker, 1)
-						f.wsEsTrades = make(chan []storage.Trade, 1)
-					}
-				}
-			}
+			val.strConsiderIntSec = info.StrConsiderIntSec
+			val.strs = f.strs.lookup(info.Storages)
+			val.candleIntervals = candleIntervals(info.CandleIntervals)
+			val.avgPriceWindows = candleIntervals(info.AvgPriceWindows)
+			val.statsInterval = time.Duration(info.StatsIntervalSec) * time.Second
+			val.tickFilter = newTickFilter(info.TickFilter)
+			val.base, val.quote = marketAssets(market)
+			val.tradeFilter = info.TradeFilter
 			val.mktCommitName = marketCommitName
 			f.cfgMap[key] = val
 		}
@@ -272,7 +229,7 @@ func (f *ftx) cfgLookup(markets []config.Market) error {
 }
 
 func (f *ftx) connectWs(ctx context.Context) error {
-	ws, err := connector.NewWebsocket(ctx, &f.connCfg.WS, config.FtxWebsocketURL)
+	ws, err := connector.NewWebsocket(ctx, &f.connCfg.WS, "ftx", config.FtxWebsocketURL)
 	if err != nil {
 		if !errors.Is(err, ctx.Err()) {
 			logErrStack(err)
@@ -331,7 +288,7 @@ func (f *ftx) subWsChannel(market string, channel string) error {
 		logErrStack(err)
 		return err
 	}
-	err = f.ws.Write(frame)
+	err = f.ws.Subscribe(frame)
 	if err != nil {
 		if errors.Is(err, net.ErrClosed) {
 			err = errors.New("context canceled")
@@ -352,14 +309,7 @@ func (f *ftx) readWs(ctx context.Context) error {
 		cfgLookup[k] = v
 	}
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, f.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, f.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, f.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, f.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, f.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, f.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	for {
 		select {
@@ -449,6 +399,8 @@ func (f *ftx) processWs(ctx context.Context, wr *wsRespFtx, cd *commitData) erro
 		}
 
 		ticker.Price = data.Last
+		ticker.BestBid = data.Bid
+		ticker.BestAsk = data.Ask
 
 		// Time sent is in fractional seconds.
 		intPart, fracPart := math.Modf(data.Time)
@@ -456,44 +408,18 @@ func (f *ftx) processWs(ctx context.Context, wr *wsRespFtx, cd *commitData) erro
 
 		key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 		val := f.cfgMap[key]
-		if val.terStr {
-			cd.terTickersCount++
-			cd.terTickers = append(cd.terTickers, ticker)
-			if cd.terTickersCount == f.connCfg.Terminal.TickerCommitBuf {
-				select {
-				case f.wsTerTickers <- cd.terTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTickersCount = 0
-				cd.terTickers = nil
-			}
+		ticker.Base = val.base
+		ticker.Quote = val.quote
+		if cd.filterTicker(&ticker, key, val.tickFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTickersCount++
-			cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-			if cd.mysqlTickersCount == f.connCfg.MySQL.TickerCommitBuf {
-				select {
-				case f.wsMysqlTickers <- cd.mysqlTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTickersCount = 0
-				cd.mysqlTickers = nil
-			}
+		if !ticker.IsBadTick {
+			ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+			alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+			arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 		}
-		if val.esStr {
-			cd.esTickersCount++
-			cd.esTickers = append(cd.esTickers, ticker)
-			if cd.esTickersCount == f.connCfg.ES.TickerCommitBuf {
-				select {
-				case f.wsEsTickers <- cd.esTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTickersCount = 0
-				cd.esTickers = nil
-			}
+		if err := cd.wsTicker(ctx, key, &val, ticker); err != nil {
+			return err
 		}
 	case "trade":
 
@@ -522,142 +448,48 @@ func (f *ftx) processWs(ctx context.Context, wr *wsRespFtx, cd *commitData) erro
 
 			key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 			val := f.cfgMap[key]
-			if val.terStr {
-				cd.terTradesCount++
-				cd.terTrades = append(cd.terTrades, trade)
-				if cd.terTradesCount == f.connCfg.Terminal.TradeCommitBuf {
-					select {
-					case f.wsTerTrades <- cd.terTrades:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-					cd.terTradesCount = 0
-					cd.terTrades = nil
-				}
+			if filterTradeRules(&trade, val.tradeFilter) {
+				continue
 			}
-			if val.mysqlStr {
-				cd.mysqlTradesCount++
-				cd.mysqlTrades = append(cd.mysqlTrades, trade)
-				if cd.mysqlTradesCount == f.connCfg.MySQL.TradeCommitBuf {
-					select {
-					case f.wsMysqlTrades <- cd.mysqlTrades:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-					cd.mysqlTradesCount = 0
-					cd.mysqlTrades = nil
-				}
+			trade.Base = val.base
+			trade.Quote = val.quote
+			if cd.filterTrade(&trade, key, val.tickFilter) {
+				continue
 			}
-			if val.esStr {
-				cd.esTradesCount++
-				cd.esTrades = append(cd.esTrades, trade)
-				if cd.esTradesCount == f.connCfg.ES.TradeCommitBuf {
-					select {
-					case f.wsEsTrades <- cd.esTrades:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-					cd.esTradesCount = 0
-					cd.esTrades = nil
-				}
+			if !trade.IsBadTick {
+				trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+				alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+				arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
 			}
-		}
-	}
-	return nil
-}
-
-func (f *ftx) wsTickersToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-f.wsTerTickers:
-			f.ter.CommitTickers(data)
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
-
-func (f *ftx) wsTradesToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-f.wsTerTrades:
-			f.ter.CommitTrades(data)
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
-
-func (f *ftx) wsTickersToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-f.wsMysqlTickers:
-			err := f.mysql.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+			if err := cd.wsTrade(ctx, key, &val, trade); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
 
-func (f *ftx) wsTradesToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-f.wsMysqlTrades:
-			err := f.mysql.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
+			// Candles are built from the trades, if configured.
+			for _, candle := range cd.addCandleTrade(trade, val.candleIntervals) {
+				if err := cd.wsAggregate(ctx, &val, "candle", candle); err != nil {
+					return err
 				}
-				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
 
-func (f *ftx) wsTickersToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-f.wsEsTickers:
-			err := f.es.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
+			// Rolling average prices are calculated from the trades, if configured.
+			for _, avgPrice := range cd.addAvgPriceTrade(trade, val.avgPriceWindows) {
+				if err := cd.wsAggregate(ctx, &val, "avg_price", avgPrice); err != nil {
+					return err
 				}
-				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
 
-func (f *ftx) wsTradesToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-f.wsEsTrades:
-			err := f.es.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+			// Market stats are aggregated from the trades, if configured.
+			if err := f.marketStats.add(ctx, trade); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
 	}
+	return nil
 }
 
 func (f *ftx) connectRest() error {
-	rest, err := connector.GetREST()
+	rest, err := connector.GetREST("ftx")
 	if err != nil {
 		logErrStack(err)
 		return err
@@ -673,19 +505,14 @@ func (f *ftx) connectRest() error {
 // then sends it to different storage systems for commit through go channels.
 func (f *ftx) processREST(ctx context.Context, mktID string, mktCommitName string, channel string, interval int) error {
 	var (
-		req *http.Request
-		q   url.Values
-		err error
+		req            *http.Request
+		q              url.Values
+		cursor         connector.TradeCursor
+		err            error
+		lastInstrument storage.Instrument
 	)
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, f.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, f.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, f.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, f.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, f.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, f.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	switch channel {
 	case "ticker":
@@ -696,6 +523,16 @@ func (f *ftx) processREST(ctx context.Context, mktID string, mktCommitName strin
 			}
 			return err
 		}
+	case "mark_price":
+
+		// Mark and index prices are only available for future markets.
+		req, err = f.rest.Request(ctx, "GET", config.FtxRESTBaseURL+"futures/"+mktID)
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
 	case "trade":
 		req, err = f.rest.Request(ctx, "GET", config.FtxRESTBaseURL+"markets/"+mktID+"/trades")
 		if err != nil {
@@ -707,12 +544,21 @@ func (f *ftx) processREST(ctx context.Context, mktID string, mktCommitName strin
 		q = req.URL.Query()
 
 		// Querying for 100 trades, which is a max allowed for a request by the exchange.
+		// Only the latest trades are returned by the endpoint, so the ones received in the earlier poll are skipped.
 		// If the configured interval gap is big, then maybe it will not return all the trades.
 		// Better to use websocket.
 		q.Add("limit", strconv.Itoa(100))
+	case "instrument":
+		req, err = f.rest.Request(ctx, "GET", config.FtxRESTBaseURL+"markets/"+mktID)
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
 	}
 
-	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	tick := connector.NewPollTicker("ftx", time.Duration(interval)*time.Second)
 	defer tick.Stop()
 	for {
 		select {
@@ -742,49 +588,60 @@ func (f *ftx) processREST(ctx context.Context, mktID string, mktCommitName strin
 					MktID:         mktID,
 					MktCommitName: mktCommitName,
 					Price:         r.Last,
+					BestBid:       r.Bid,
+					BestAsk:       r.Ask,
+					High:          r.High,
+					Low:           r.Low,
 					Timestamp:     time.Now().UTC(),
 				}
 
 				key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 				val := f.cfgMap[key]
-				if val.terStr {
-					cd.terTickersCount++
-					cd.terTickers = append(cd.terTickers, ticker)
-					if cd.terTickersCount == f.connCfg.Terminal.TickerCommitBuf {
-						f.ter.CommitTickers(cd.terTickers)
-						cd.terTickersCount = 0
-						cd.terTickers = nil
-					}
+				ticker.Base = val.base
+				ticker.Quote = val.quote
+				if cd.filterTicker(&ticker, key, val.tickFilter) {
+					continue
 				}
-				if val.mysqlStr {
-					cd.mysqlTickersCount++
-					cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-					if cd.mysqlTickersCount == f.connCfg.MySQL.TickerCommitBuf {
-						err := f.mysql.CommitTickers(ctx, cd.mysqlTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.mysqlTickersCount = 0
-						cd.mysqlTickers = nil
-					}
+				if !ticker.IsBadTick {
+					ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+					alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+					arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
+				}
+				if err := cd.restTicker(ctx, &val, ticker); err != nil {
+					return err
 				}
-				if val.esStr {
-					cd.esTickersCount++
-					cd.esTickers = append(cd.esTickers, ticker)
-					if cd.esTickersCount == f.connCfg.ES.TickerCommitBuf {
-						err := f.es.CommitTickers(ctx, cd.esTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.esTickersCount = 0
-						cd.esTickers = nil
+			case "mark_price":
+				resp, err := f.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
 					}
+					return err
+				}
+
+				rr := restTickerRespFtx{}
+				if err := jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				r := rr.Result
+				markPrice := storage.MarkPrice{
+					Exchange:      "ftx",
+					MktID:         mktID,
+					MktCommitName: mktCommitName,
+					MarkPrice:     r.Mark,
+					IndexPrice:    r.Index,
+					Basis:         r.Mark - r.Index,
+					Timestamp:     time.Now().UTC(),
+				}
+
+				key := cfgLookupKey{market: markPrice.MktID, channel: "mark_price"}
+				val := f.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "mark_price", markPrice); err != nil {
+					return err
 				}
 			case "trade":
 				q.Del("start")
@@ -825,47 +682,74 @@ func (f *ftx) processREST(ctx context.Context, mktID string, mktCommitName strin
 						Timestamp:     timestamp,
 					}
 
+					if !cursor.New(restTradeKey(&trade), trade.Timestamp) {
+						continue
+					}
+
 					key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 					val := f.cfgMap[key]
-					if val.terStr {
-						cd.terTradesCount++
-						cd.terTrades = append(cd.terTrades, trade)
-						if cd.terTradesCount == f.connCfg.Terminal.TradeCommitBuf {
-							f.ter.CommitTrades(cd.terTrades)
-							cd.terTradesCount = 0
-							cd.terTrades = nil
-						}
+					if filterTradeRules(&trade, val.tradeFilter) {
+						continue
+					}
+					trade.Base = val.base
+					trade.Quote = val.quote
+					if cd.filterTrade(&trade, key, val.tickFilter) {
+						continue
 					}
-					if val.mysqlStr {
-						cd.mysqlTradesCount++
-						cd.mysqlTrades = append(cd.mysqlTrades, trade)
-						if cd.mysqlTradesCount == f.connCfg.MySQL.TradeCommitBuf {
-							err := f.mysql.CommitTrades(ctx, cd.mysqlTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.mysqlTradesCount = 0
-							cd.mysqlTrades = nil
-						}
+					if !trade.IsBadTick {
+						trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+						alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+						arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
+					}
+					if err := cd.restTrade(ctx, &val, trade); err != nil {
+						return err
 					}
-					if val.esStr {
-						cd.esTradesCount++
-						cd.esTrades = append(cd.esTrades, trade)
-						if cd.esTradesCount == f.connCfg.ES.TradeCommitBuf {
-							err := f.es.CommitTrades(ctx, cd.esTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.esTradesCount = 0
-							cd.esTrades = nil
-						}
+				}
+				cursor.Next(len(rr.Result))
+			case "instrument":
+				resp, err := f.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
 					}
+					return err
+				}
+
+				rr := restInstrumentRespFtx{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				status := "halted"
+				if rr.Result.Enabled {
+					status = "trading"
+				}
+
+				instrument := storage.Instrument{
+					Exchange:       "ftx",
+					MktID:          mktID,
+					MktCommitName:  mktCommitName,
+					TickSize:       rr.Result.PriceIncrement,
+					LotSize:        rr.Result.SizeIncrement,
+					PricePrecision: precision(rr.Result.PriceIncrement),
+					SizePrecision:  precision(rr.Result.SizeIncrement),
+					Status:         status,
+				}
+
+				// Only the changes are stored, first one being the metadata at the start.
+				if instrument == lastInstrument {
+					continue
+				}
+				lastInstrument = instrument
+				instrument.Timestamp = time.Now().UTC()
+
+				key := cfgLookupKey{market: instrument.MktID, channel: "instrument"}
+				val := f.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "instrument", instrument); err != nil {
+					return err
 				}
 			}
 
@@ -0,0 +1,156 @@
+package exchange
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
+	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// fxExchange is the name used for the fx rates in the USD references and the storages.
+const fxExchange = "fx"
+
+// fx is for fetching fiat exchange rates.
+type fx struct {
+	cfg   *config.FX
+	rest  *connector.REST
+	ter   *storage.Terminal
+	mysql *storage.MySQL
+	es    *storage.ElasticSearch
+	uds   *storage.UDS
+}
+
+// restRespFX is the response of the fx rates API, rates are the units of the currencies per one USD.
+type restRespFX struct {
+	Rates map[string]float64 `json:"rates"`
+}
+
+// StartFX is entry point for fetching fiat exchange rates.
+// Rates are fed to the USD references, so that the prices of the markets quoted in fiat currencies
+// other than USD can be normalized, and also committed to the configured storages.
+// If any error occurs, the function is retried in the same way as for the exchanges.
+func StartFX(appCtx context.Context, cfg *config.FX) error {
+	return supervisor.Run(appCtx, fxExchange, &cfg.Retry, func() error {
+		return newFX(appCtx, cfg)
+	})
+}
+
+func newFX(appCtx context.Context, cfg *config.FX) error {
+	rest, err := connector.GetREST(fxExchange)
+	if err != nil {
+		logErrStack(err)
+		return err
+	}
+	f := fx{cfg: cfg, rest: rest}
+	for _, str := range cfg.Storages {
+		switch str {
+		case "terminal":
+			f.ter = storage.GetTerminal()
+		case "mysql":
+			f.mysql = storage.GetMySQL()
+		case "elastic_search":
+			f.es = storage.GetElasticSearch()
+		case "uds":
+			f.uds = storage.GetUDS()
+		}
+	}
+	log.Info().Str("exchange", fxExchange).Msg("REST connection setup is done")
+
+	// Rates are fetched once immediately, so that the USD prices are available from the start.
+	if err = f.fetch(appCtx); err != nil {
+		return err
+	}
+	tick := time.NewTicker(time.Duration(cfg.RefreshIntSec) * time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if err = f.fetch(appCtx); err != nil {
+				return err
+			}
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+	}
+}
+
+// fetch queries the rates API, updates the USD references and commits the rates to the storages.
+func (f *fx) fetch(ctx context.Context) error {
+	req, err := f.rest.Request(ctx, "GET", f.cfg.URL)
+	if err != nil {
+		if !errors.Is(err, ctx.Err()) {
+			logErrStack(err)
+		}
+		return err
+	}
+	resp, err := f.rest.Do(req)
+	if err != nil {
+		if !errors.Is(err, ctx.Err()) {
+			logErrStack(err)
+		}
+		return err
+	}
+
+	rr := restRespFX{}
+	if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+		logErrStack(err)
+		resp.Body.Close()
+		return err
+	}
+	resp.Body.Close()
+
+	timestamp := time.Now().UTC()
+	rates := make([]storage.FXRate, 0, len(f.cfg.Currencies))
+	for _, cur := range f.cfg.Currencies {
+		cur = strings.ToUpper(cur)
+		perUSD, ok := rr.Rates[cur]
+		if !ok || perUSD <= 0 {
+			err = errors.Errorf("fx rate of %s is not found in the response", cur)
+			logErrStack(err)
+			return err
+		}
+		rate := 1 / perUSD
+		usdPrice(fxExchange, cur, rate)
+		rates = append(rates, storage.FXRate{
+			Currency:  cur,
+			Rate:      rate,
+			Timestamp: timestamp,
+		})
+	}
+
+	if f.ter != nil {
+		f.ter.CommitFXRates(rates)
+	}
+	if f.mysql != nil {
+		if err = f.mysql.CommitFXRates(ctx, rates); err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
+	}
+	if f.es != nil {
+		if err = f.es.CommitFXRates(ctx, rates); err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
+	}
+	if f.uds != nil {
+		if err = f.uds.CommitFXRates(ctx, rates); err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
+	}
+	return nil
+}
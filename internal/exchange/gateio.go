@@ -2,7 +2,6 @@ package exchange
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"math"
 	"net"
@@ -12,9 +11,12 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/arbitrage"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
 	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -22,60 +24,19 @@ import (
 
 // StartGateio is for starting gateio exchange functions.
 func StartGateio(appCtx context.Context, markets []config.Market, retry *config.Retry, connCfg *config.Connection) error {
-
-	// If any error occurs or connection is lost, retry the exchange functions with a time gap till it reaches
-	// a configured number of retry.
-	// Retry counter will be reset back to zero if the elapsed time since the last retry is greater than the configured one.
-	var retryCount int
-	lastRetryTime := time.Now()
-
-	for {
-		err := newGateio(appCtx, markets, connCfg)
-		if err != nil {
-			log.Error().Err(err).Str("exchange", "gateio").Msg("error occurred")
-			if retry.Number == 0 {
-				return errors.New("not able to connect gateio exchange. please check the log for details")
-			}
-			if retry.ResetSec == 0 || time.Since(lastRetryTime).Seconds() < float64(retry.ResetSec) {
-				retryCount++
-			} else {
-				retryCount = 1
-			}
-			lastRetryTime = time.Now()
-			if retryCount > retry.Number {
-				return fmt.Errorf("not able to connect gateio exchange even after %v retry. please check the log for details", retry.Number)
-			}
-
-			log.Error().Str("exchange", "gateio").Int("retry", retryCount).Msg(fmt.Sprintf("retrying functions in %v seconds", retry.GapSec))
-			tick := time.NewTicker(time.Duration(retry.GapSec) * time.Second)
-			select {
-			case <-tick.C:
-				tick.Stop()
-
-			// Return, if there is any error from another exchange.
-			case <-appCtx.Done():
-				log.Error().Str("exchange", "gateio").Msg("ctx canceled, return from StartGateio")
-				return appCtx.Err()
-			}
-		}
-	}
+	return supervisor.Run(appCtx, "gateio", retry, func() error {
+		return newGateio(appCtx, markets, connCfg)
+	})
 }
 
 type gateio struct {
-	ws             connector.Websocket
-	rest           *connector.REST
-	connCfg        *config.Connection
-	cfgMap         map[cfgLookupKey]cfgLookupVal
-	channelIds     map[int][2]string
-	ter            *storage.Terminal
-	es             *storage.ElasticSearch
-	mysql          *storage.MySQL
-	wsTerTickers   chan []storage.Ticker
-	wsTerTrades    chan []storage.Trade
-	wsMysqlTickers chan []storage.Ticker
-	wsMysqlTrades  chan []storage.Trade
-	wsEsTickers    chan []storage.Ticker
-	wsEsTrades     chan []storage.Trade
+	ws          connector.Websocket
+	rest        *connector.REST
+	connCfg     *config.Connection
+	cfgMap      map[cfgLookupKey]cfgLookupVal
+	strs        strCommits
+	marketStats *marketStats
+	channelIds  map[int][2]string
 }
 
 type wsSubGateio struct {
@@ -106,11 +67,23 @@ type respGateio struct {
 	Side         string      `json:"side"`
 	Amount       string      `json:"amount"`
 	TickerPrice  string      `json:"last"`
+	HighestBid   string      `json:"highest_bid"`
+	LowestAsk    string      `json:"lowest_ask"`
+	BaseVolume   string      `json:"base_volume"`
+	High24h      string      `json:"high_24h"`
+	Low24h       string      `json:"low_24h"`
 	TradePrice   string      `json:"price"`
 	CreateTimeMs string      `json:"create_time_ms"`
 	Status       string      `json:"status"`
 }
 
+type restInstrumentRespGateio struct {
+	ID              string `json:"id"`
+	Precision       int    `json:"precision"`
+	AmountPrecision int    `json:"amount_precision"`
+	TradeStatus     string `json:"trade_status"`
+}
+
 func newGateio(appCtx context.Context, markets []config.Market, connCfg *config.Connection) error {
 
 	// If any exchange function fails, force all the other functions to stop and return.
@@ -122,6 +95,7 @@ func newGateio(appCtx context.Context, markets []config.Market, connCfg *config.
 	if err != nil {
 		return err
 	}
+	g.marketStats = newMarketStats("gateio", g.cfgMap)
 
 	var (
 		wsCount   int
@@ -147,30 +121,22 @@ func newGateio(appCtx context.Context, markets []config.Market, connCfg *config.
 						return g.readWs(ctx)
 					})
 
-					if g.ter != nil {
+					if g.marketStats != nil {
 						gateioErrGroup.Go(func() error {
-							return g.wsTickersToTerminal(ctx)
-						})
-						gateioErrGroup.Go(func() error {
-							return g.wsTradesToTerminal(ctx)
+							return g.marketStats.run(ctx)
 						})
 					}
 
-					if g.mysql != nil {
+					for _, str := range g.strs {
+						str := str
 						gateioErrGroup.Go(func() error {
-							return g.wsTickersToMySQL(ctx)
+							return str.wsTickers(ctx)
 						})
 						gateioErrGroup.Go(func() error {
-							return g.wsTradesToMySQL(ctx)
+							return str.wsTrades(ctx)
 						})
-					}
-
-					if g.es != nil {
 						gateioErrGroup.Go(func() error {
-							return g.wsTickersToES(ctx)
-						})
-						gateioErrGroup.Go(func() error {
-							return g.wsTradesToES(ctx)
+							return str.wsRecords(ctx)
 						})
 					}
 				}
@@ -221,6 +187,7 @@ func (g *gateio) cfgLookup(markets []config.Market) error {
 
 	// Configurations flat map is prepared for easy lookup later in the app.
 	g.cfgMap = make(map[cfgLookupKey]cfgLookupVal)
+	g.strs = make(strCommits)
 	g.channelIds = make(map[int][2]string)
 	for _, market := range markets {
 		var marketCommitName string
@@ -233,31 +200,14 @@ func (g *gateio) cfgLookup(markets []config.Market) error {
 			key := cfgLookupKey{market: market.ID, channel: info.Channel}
 			val := cfgLookupVal{}
 			val.wsConsiderIntSec = info.WsConsiderIntSec
-			for _, str := range info.Storages {
-				switch str {
-				case "terminal":
-					val.terStr = true
-					if g.ter == nil {
-						g.ter = storage.GetTerminal()
-						g.wsTerTickers = make(chan []storage.Ticker, 1)
-						g.wsTerTrades = make(chan []storage.Trade, 1)
-					}
-				case "mysql":
-					val.mysqlStr = true
-					if g.mysql == nil {
-						g.mysql = storage.GetMySQL()
-						g.wsMysqlTickers = make(chan []storage.Ticker, 1)
-						g.wsMysqlTrades = make(chan []storage.Trade, 1)
-					}
-				case "elastic_search":
-					val.esStr = true
-					if g.es == nil {
-						g.es = storage.GetElasticSearch()
-						g.wsEsTickers = make(chan []storage.Ticker, 1)
-						g.wsEsTrades = make(chan []storage.Trade, 1)
-					}
-				}
-			}
+			val.strConsiderIntSec = info.StrConsiderIntSec
+			val.strs = g.strs.lookup(info.Storages)
+			val.candleIntervals = candleIntervals(info.CandleIntervals)
+			val.avgPriceWindows = candleIntervals(info.AvgPriceWindows)
+			val.statsInterval = time.Duration(info.StatsIntervalSec) * time.Second
+			val.tickFilter = newTickFilter(info.TickFilter)
+			val.base, val.quote = marketAssets(market)
+			val.tradeFilter = info.TradeFilter
 
 			// Channel id is used to identify channel in subscribe success message of websocket server.
 			id++
@@ -272,7 +222,7 @@ func (g *gateio) cfgLookup(markets []config.Market) error {
 }
 
 func (g *gateio) connectWs(ctx context.Context) error {
-	ws, err := connector.NewWebsocket(ctx, &g.connCfg.WS, config.GateioWebsocketURL)
+	ws, err := connector.NewWebsocket(ctx, &g.connCfg.WS, "gateio", config.GateioWebsocketURL)
 	if err != nil {
 		if !errors.Is(err, ctx.Err()) {
 			logErrStack(err)
@@ -315,7 +265,7 @@ func (g *gateio) subWsChannel(market string, channel string, id int) error {
 		logErrStack(err)
 		return err
 	}
-	err = g.ws.Write(frame)
+	err = g.ws.Subscribe(frame)
 	if err != nil {
 		if errors.Is(err, net.ErrClosed) {
 			err = errors.New("context canceled")
@@ -336,14 +286,7 @@ func (g *gateio) readWs(ctx context.Context) error {
 		cfgLookup[k] = v
 	}
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, g.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, g.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, g.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, g.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, g.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, g.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	for {
 		select {
@@ -437,49 +380,53 @@ func (g *gateio) processWs(ctx context.Context, wr *wsRespGateio, cd *commitData
 		}
 		ticker.Price = price
 
+		ticker.BestBid, err = strconv.ParseFloat(wr.Result.HighestBid, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		ticker.BestAsk, err = strconv.ParseFloat(wr.Result.LowestAsk, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		ticker.Volume, err = strconv.ParseFloat(wr.Result.BaseVolume, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		ticker.High, err = strconv.ParseFloat(wr.Result.High24h, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
+		ticker.Low, err = strconv.ParseFloat(wr.Result.Low24h, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+
 		// Time sent is in seconds.
 		ticker.Timestamp = time.Unix(wr.TickerTime, 0).UTC()
 
 		key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 		val := g.cfgMap[key]
-		if val.terStr {
-			cd.terTickersCount++
-			cd.terTickers = append(cd.terTickers, ticker)
-			if cd.terTickersCount == g.connCfg.Terminal.TickerCommitBuf {
-				select {
-				case g.wsTerTickers <- cd.terTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTickersCount = 0
-				cd.terTickers = nil
-			}
+		ticker.Base = val.base
+		ticker.Quote = val.quote
+		if cd.filterTicker(&ticker, key, val.tickFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTickersCount++
-			cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-			if cd.mysqlTickersCount == g.connCfg.MySQL.TickerCommitBuf {
-				select {
-				case g.wsMysqlTickers <- cd.mysqlTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTickersCount = 0
-				cd.mysqlTickers = nil
-			}
+		if !ticker.IsBadTick {
+			ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+			alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+			arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 		}
-		if val.esStr {
-			cd.esTickersCount++
-			cd.esTickers = append(cd.esTickers, ticker)
-			if cd.esTickersCount == g.connCfg.ES.TickerCommitBuf {
-				select {
-				case g.wsEsTickers <- cd.esTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTickersCount = 0
-				cd.esTickers = nil
-			}
+		if err := cd.wsTicker(ctx, key, &val, ticker); err != nil {
+			return err
 		}
 	case "trade":
 		trade := storage.Trade{}
@@ -522,141 +469,47 @@ func (g *gateio) processWs(ctx context.Context, wr *wsRespGateio, cd *commitData
 
 		key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 		val := g.cfgMap[key]
-		if val.terStr {
-			cd.terTradesCount++
-			cd.terTrades = append(cd.terTrades, trade)
-			if cd.terTradesCount == g.connCfg.Terminal.TradeCommitBuf {
-				select {
-				case g.wsTerTrades <- cd.terTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTradesCount = 0
-				cd.terTrades = nil
-			}
-		}
-		if val.mysqlStr {
-			cd.mysqlTradesCount++
-			cd.mysqlTrades = append(cd.mysqlTrades, trade)
-			if cd.mysqlTradesCount == g.connCfg.MySQL.TradeCommitBuf {
-				select {
-				case g.wsMysqlTrades <- cd.mysqlTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTradesCount = 0
-				cd.mysqlTrades = nil
-			}
+		if filterTradeRules(&trade, val.tradeFilter) {
+			return nil
 		}
-		if val.esStr {
-			cd.esTradesCount++
-			cd.esTrades = append(cd.esTrades, trade)
-			if cd.esTradesCount == g.connCfg.ES.TradeCommitBuf {
-				select {
-				case g.wsEsTrades <- cd.esTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTradesCount = 0
-				cd.esTrades = nil
-			}
+		trade.Base = val.base
+		trade.Quote = val.quote
+		if cd.filterTrade(&trade, key, val.tickFilter) {
+			return nil
 		}
-	}
-	return nil
-}
-
-func (g *gateio) wsTickersToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-g.wsTerTickers:
-			g.ter.CommitTickers(data)
-		case <-ctx.Done():
-			return ctx.Err()
+		if !trade.IsBadTick {
+			trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+			alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+			arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
 		}
-	}
-}
-
-func (g *gateio) wsTradesToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-g.wsTerTrades:
-			g.ter.CommitTrades(data)
-		case <-ctx.Done():
-			return ctx.Err()
+		if err := cd.wsTrade(ctx, key, &val, trade); err != nil {
+			return err
 		}
-	}
-}
 
-func (g *gateio) wsTickersToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-g.wsMysqlTickers:
-			err := g.mysql.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Candles are built from the trades, if configured.
+		for _, candle := range cd.addCandleTrade(trade, val.candleIntervals) {
+			if err := cd.wsAggregate(ctx, &val, "candle", candle); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	}
-}
 
-func (g *gateio) wsTradesToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-g.wsMysqlTrades:
-			err := g.mysql.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Rolling average prices are calculated from the trades, if configured.
+		for _, avgPrice := range cd.addAvgPriceTrade(trade, val.avgPriceWindows) {
+			if err := cd.wsAggregate(ctx, &val, "avg_price", avgPrice); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	}
-}
 
-func (g *gateio) wsTickersToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-g.wsEsTickers:
-			err := g.es.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
-
-func (g *gateio) wsTradesToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-g.wsEsTrades:
-			err := g.es.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+		// Market stats are aggregated from the trades, if configured.
+		if err := g.marketStats.add(ctx, trade); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 func (g *gateio) connectRest() error {
-	rest, err := connector.GetREST()
+	rest, err := connector.GetREST("gateio")
 	if err != nil {
 		logErrStack(err)
 		return err
@@ -672,19 +525,14 @@ func (g *gateio) connectRest() error {
 // then sends it to different storage systems for commit through go channels.
 func (g *gateio) processREST(ctx context.Context, mktID string, mktCommitName string, channel string, interval int) error {
 	var (
-		req *http.Request
-		q   url.Values
-		err error
+		req            *http.Request
+		q              url.Values
+		cursor         connector.TradeCursor
+		err            error
+		lastInstrument storage.Instrument
 	)
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, g.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, g.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, g.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, g.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, g.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, g.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	switch channel {
 	case "ticker":
@@ -708,14 +556,25 @@ func (g *gateio) processREST(ctx context.Context, mktID string, mktCommitName st
 		q = req.URL.Query()
 		q.Add("currency_pair", mktID)
 
-		// Querying for 100 trades.
-		// If the configured interval gap is big, then maybe it will not return all the trades
-		// and if the gap is too small, maybe it will return duplicate ones.
-		// Better to use websocket.
+		// Querying for 100 trades, walking forward in ascending order from the id of the last one received in the earlier poll.
 		q.Add("limit", strconv.Itoa(100))
+		cursor = connector.TradeCursor{
+			Param:    "last_id",
+			Position: func(id string, _ time.Time) string { return id },
+			Forward:  map[string]string{"reverse": "false"},
+			Limit:    100,
+		}
+	case "instrument":
+		req, err = g.rest.Request(ctx, "GET", config.GateioRESTBaseURL+"spot/currency_pairs/"+mktID)
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
 	}
 
-	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	tick := connector.NewPollTicker("gateio", time.Duration(interval)*time.Second)
 	defer tick.Stop()
 	for {
 		select {
@@ -748,57 +607,152 @@ func (g *gateio) processREST(ctx context.Context, mktID string, mktCommitName st
 					return err
 				}
 
+				bestBid, err := strconv.ParseFloat(rr.HighestBid, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				bestAsk, err := strconv.ParseFloat(rr.LowestAsk, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				volume, err := strconv.ParseFloat(rr.BaseVolume, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				high, err := strconv.ParseFloat(rr.High24h, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				low, err := strconv.ParseFloat(rr.Low24h, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
 				ticker := storage.Ticker{
 					Exchange:      "gateio",
 					MktID:         mktID,
 					MktCommitName: mktCommitName,
 					Price:         price,
+					BestBid:       bestBid,
+					BestAsk:       bestAsk,
+					Volume:        volume,
+					High:          high,
+					Low:           low,
 					Timestamp:     time.Now().UTC(),
 				}
 
 				key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 				val := g.cfgMap[key]
-				if val.terStr {
-					cd.terTickersCount++
-					cd.terTickers = append(cd.terTickers, ticker)
-					if cd.terTickersCount == g.connCfg.Terminal.TickerCommitBuf {
-						g.ter.CommitTickers(cd.terTickers)
-						cd.terTickersCount = 0
-						cd.terTickers = nil
-					}
+				ticker.Base = val.base
+				ticker.Quote = val.quote
+				if cd.filterTicker(&ticker, key, val.tickFilter) {
+					continue
+				}
+				if !ticker.IsBadTick {
+					ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+					alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+					arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 				}
-				if val.mysqlStr {
-					cd.mysqlTickersCount++
-					cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-					if cd.mysqlTickersCount == g.connCfg.MySQL.TickerCommitBuf {
-						err := g.mysql.CommitTickers(ctx, cd.mysqlTickers)
+				if err := cd.restTicker(ctx, &val, ticker); err != nil {
+					return err
+				}
+			case "trade":
+				for more := true; more; {
+					cursor.Query(q)
+					req.URL.RawQuery = q.Encode()
+					resp, err := g.rest.Do(req)
+					if err != nil {
+						if !errors.Is(err, ctx.Err()) {
+							logErrStack(err)
+						}
+						return err
+					}
+
+					rr := []respGateio{}
+					if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+						logErrStack(err)
+						resp.Body.Close()
+						return err
+					}
+					resp.Body.Close()
+
+					for i := range rr {
+						r := rr[i]
+
+						// Trade ID sent is in int format for websocket, string format for REST.
+						tradeID, ok := r.TradeID.(string)
+						if !ok {
+							log.Error().Str("exchange", "gateio").Str("func", "processREST").Interface("trade id", r.TradeID).Msg("")
+							return errors.New("cannot convert trade data field trade id to string")
+						}
+
+						size, err := strconv.ParseFloat(r.Amount, 64)
 						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
+							logErrStack(err)
 							return err
 						}
-						cd.mysqlTickersCount = 0
-						cd.mysqlTickers = nil
-					}
-				}
-				if val.esStr {
-					cd.esTickersCount++
-					cd.esTickers = append(cd.esTickers, ticker)
-					if cd.esTickersCount == g.connCfg.ES.TickerCommitBuf {
-						err := g.es.CommitTickers(ctx, cd.esTickers)
+
+						price, err := strconv.ParseFloat(r.TradePrice, 64)
+						if err != nil {
+							logErrStack(err)
+							return err
+						}
+
+						// Time sent is in fractional seconds string format.
+						timeFloat, err := strconv.ParseFloat(r.CreateTimeMs, 64)
 						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
+							logErrStack(err)
+							return err
+						}
+						intPart, _ := math.Modf(timeFloat)
+						timestamp := time.Unix(0, int64(intPart)*int64(time.Millisecond)).UTC()
+
+						trade := storage.Trade{
+							Exchange:      "gateio",
+							MktID:         mktID,
+							MktCommitName: mktCommitName,
+							TradeID:       tradeID,
+							Side:          r.Side,
+							Size:          size,
+							Price:         price,
+							Timestamp:     timestamp,
+						}
+
+						if !cursor.New(restTradeKey(&trade), trade.Timestamp) {
+							continue
+						}
+
+						key := cfgLookupKey{market: trade.MktID, channel: "trade"}
+						val := g.cfgMap[key]
+						if filterTradeRules(&trade, val.tradeFilter) {
+							continue
+						}
+						trade.Base = val.base
+						trade.Quote = val.quote
+						if cd.filterTrade(&trade, key, val.tickFilter) {
+							continue
+						}
+						if !trade.IsBadTick {
+							trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+							alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+							arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
+						}
+						if err := cd.restTrade(ctx, &val, trade); err != nil {
 							return err
 						}
-						cd.esTickersCount = 0
-						cd.esTickers = nil
 					}
+					more = cursor.Next(len(rr))
 				}
-			case "trade":
-				req.URL.RawQuery = q.Encode()
+			case "instrument":
 				resp, err := g.rest.Do(req)
 				if err != nil {
 					if !errors.Is(err, ctx.Err()) {
@@ -807,7 +761,7 @@ func (g *gateio) processREST(ctx context.Context, mktID string, mktCommitName st
 					return err
 				}
 
-				rr := []respGateio{}
+				rr := restInstrumentRespGateio{}
 				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
 					logErrStack(err)
 					resp.Body.Close()
@@ -815,89 +769,44 @@ func (g *gateio) processREST(ctx context.Context, mktID string, mktCommitName st
 				}
 				resp.Body.Close()
 
-				for i := range rr {
-					r := rr[i]
-
-					// Trade ID sent is in int format for websocket, string format for REST.
-					tradeID, ok := r.TradeID.(string)
-					if !ok {
-						log.Error().Str("exchange", "gateio").Str("func", "processREST").Interface("trade id", r.TradeID).Msg("")
-						return errors.New("cannot convert trade data field trade id to string")
-					}
-
-					size, err := strconv.ParseFloat(r.Amount, 64)
-					if err != nil {
-						logErrStack(err)
-						return err
-					}
+				// Exchange specific status values are converted to a common format.
+				var status string
+				switch rr.TradeStatus {
+				case "tradable":
+					status = "trading"
+				case "untradable":
+					status = "halted"
+				case "buyable":
+					status = "buy_only"
+				case "sellable":
+					status = "sell_only"
+				default:
+					status = rr.TradeStatus
+				}
 
-					price, err := strconv.ParseFloat(r.TradePrice, 64)
-					if err != nil {
-						logErrStack(err)
-						return err
-					}
+				// Exchange gives only the precision, so increments are derived from it.
+				instrument := storage.Instrument{
+					Exchange:       "gateio",
+					MktID:          mktID,
+					MktCommitName:  mktCommitName,
+					TickSize:       math.Pow10(-rr.Precision),
+					LotSize:        math.Pow10(-rr.AmountPrecision),
+					PricePrecision: rr.Precision,
+					SizePrecision:  rr.AmountPrecision,
+					Status:         status,
+				}
 
-					// Time sent is in fractional seconds string format.
-					timeFloat, err := strconv.ParseFloat(r.CreateTimeMs, 64)
-					if err != nil {
-						logErrStack(err)
-						return err
-					}
-					intPart, _ := math.Modf(timeFloat)
-					timestamp := time.Unix(0, int64(intPart)*int64(time.Millisecond)).UTC()
-
-					trade := storage.Trade{
-						Exchange:      "gateio",
-						MktID:         mktID,
-						MktCommitName: mktCommitName,
-						TradeID:       tradeID,
-						Side:          r.Side,
-						Size:          size,
-						Price:         price,
-						Timestamp:     timestamp,
-					}
+				// Only the changes are stored, first one being the metadata at the start.
+				if instrument == lastInstrument {
+					continue
+				}
+				lastInstrument = instrument
+				instrument.Timestamp = time.Now().UTC()
 
-					key := cfgLookupKey{market: trade.MktID, channel: "trade"}
-					val := g.cfgMap[key]
-					if val.terStr {
-						cd.terTradesCount++
-						cd.terTrades = append(cd.terTrades, trade)
-						if cd.terTradesCount == g.connCfg.Terminal.TradeCommitBuf {
-							g.ter.CommitTrades(cd.terTrades)
-							cd.terTradesCount = 0
-							cd.terTrades = nil
-						}
-					}
-					if val.mysqlStr {
-						cd.mysqlTradesCount++
-						cd.mysqlTrades = append(cd.mysqlTrades, trade)
-						if cd.mysqlTradesCount == g.connCfg.MySQL.TradeCommitBuf {
-							err := g.mysql.CommitTrades(ctx, cd.mysqlTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.mysqlTradesCount = 0
-							cd.mysqlTrades = nil
-						}
-					}
-					if val.esStr {
-						cd.esTradesCount++
-						cd.esTrades = append(cd.esTrades, trade)
-						if cd.esTradesCount == g.connCfg.ES.TradeCommitBuf {
-							err := g.es.CommitTrades(ctx, cd.esTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.esTradesCount = 0
-							cd.esTrades = nil
-						}
-					}
+				key := cfgLookupKey{market: instrument.MktID, channel: "instrument"}
+				val := g.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "instrument", instrument); err != nil {
+					return err
 				}
 			}
 
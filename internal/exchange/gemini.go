@@ -2,7 +2,6 @@ package exchange
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -12,9 +11,12 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/arbitrage"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
 	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -22,59 +24,18 @@ import (
 
 // StartGemini is for starting gemini exchange functions.
 func StartGemini(appCtx context.Context, markets []config.Market, retry *config.Retry, connCfg *config.Connection) error {
-
-	// If any error occurs or connection is lost, retry the exchange functions with a time gap till it reaches
-	// a configured number of retry.
-	// Retry counter will be reset back to zero if the elapsed time since the last retry is greater than the configured one.
-	var retryCount int
-	lastRetryTime := time.Now()
-
-	for {
-		err := newGemini(appCtx, markets, connCfg)
-		if err != nil {
-			log.Error().Err(err).Str("exchange", "gemini").Msg("error occurred")
-			if retry.Number == 0 {
-				return errors.New("not able to connect gemini exchange. please check the log for details")
-			}
-			if retry.ResetSec == 0 || time.Since(lastRetryTime).Seconds() < float64(retry.ResetSec) {
-				retryCount++
-			} else {
-				retryCount = 1
-			}
-			lastRetryTime = time.Now()
-			if retryCount > retry.Number {
-				return fmt.Errorf("not able to connect gemini exchange even after %v retry. please check the log for details", retry.Number)
-			}
-
-			log.Error().Str("exchange", "gemini").Int("retry", retryCount).Msg(fmt.Sprintf("retrying functions in %v seconds", retry.GapSec))
-			tick := time.NewTicker(time.Duration(retry.GapSec) * time.Second)
-			select {
-			case <-tick.C:
-				tick.Stop()
-
-			// Return, if there is any error from another exchange.
-			case <-appCtx.Done():
-				log.Error().Str("exchange", "gemini").Msg("ctx canceled, return from StartGemini")
-				return appCtx.Err()
-			}
-		}
-	}
+	return supervisor.Run(appCtx, "gemini", retry, func() error {
+		return newGemini(appCtx, markets, connCfg)
+	})
 }
 
 type gemini struct {
-	ws             connector.Websocket
-	rest           *connector.REST
-	connCfg        *config.Connection
-	cfgMap         map[cfgLookupKey]cfgLookupVal
-	ter            *storage.Terminal
-	es             *storage.ElasticSearch
-	mysql          *storage.MySQL
-	wsTerTickers   chan []storage.Ticker
-	wsTerTrades    chan []storage.Trade
-	wsMysqlTickers chan []storage.Ticker
-	wsMysqlTrades  chan []storage.Trade
-	wsEsTickers    chan []storage.Ticker
-	wsEsTrades     chan []storage.Trade
+	ws          connector.Websocket
+	rest        *connector.REST
+	connCfg     *config.Connection
+	cfgMap      map[cfgLookupKey]cfgLookupVal
+	strs        strCommits
+	marketStats *marketStats
 }
 
 type wsSubGemini struct {
@@ -99,13 +60,18 @@ type wsRespGemini struct {
 }
 
 type restRespGemini struct {
-	Symbol      string `json:"symbol"`
-	TradeID     uint64 `json:"tid"`
-	Type        string `json:"type"`
-	Amount      string `json:"amount"`
-	Price       string `json:"price"`
-	Timestamp   int64  `json:"timestampms"`
-	TickerPrice string `json:"last"`
+	Symbol         string  `json:"symbol"`
+	TradeID        uint64  `json:"tid"`
+	Type           string  `json:"type"`
+	Amount         string  `json:"amount"`
+	Price          string  `json:"price"`
+	Timestamp      int64   `json:"timestampms"`
+	TickerPrice    string  `json:"last"`
+	Bid            string  `json:"bid"`
+	Ask            string  `json:"ask"`
+	Status         string  `json:"status"`
+	TickSize       float64 `json:"tick_size"`
+	QuoteIncrement float64 `json:"quote_increment"`
 }
 
 func newGemini(appCtx context.Context, markets []config.Market, connCfg *config.Connection) error {
@@ -119,6 +85,7 @@ func newGemini(appCtx context.Context, markets []config.Market, connCfg *config.
 	if err != nil {
 		return err
 	}
+	g.marketStats = newMarketStats("gemini", g.cfgMap)
 
 	var (
 		wsCount   int
@@ -145,30 +112,22 @@ func newGemini(appCtx context.Context, markets []config.Market, connCfg *config.
 						return g.readWs(ctx)
 					})
 
-					if g.ter != nil {
-						geminiErrGroup.Go(func() error {
-							return g.wsTickersToTerminal(ctx)
-						})
+					if g.marketStats != nil {
 						geminiErrGroup.Go(func() error {
-							return g.wsTradesToTerminal(ctx)
+							return g.marketStats.run(ctx)
 						})
 					}
 
-					if g.mysql != nil {
+					for _, str := range g.strs {
+						str := str
 						geminiErrGroup.Go(func() error {
-							return g.wsTickersToMySQL(ctx)
+							return str.wsTickers(ctx)
 						})
 						geminiErrGroup.Go(func() error {
-							return g.wsTradesToMySQL(ctx)
+							return str.wsTrades(ctx)
 						})
-					}
-
-					if g.es != nil {
 						geminiErrGroup.Go(func() error {
-							return g.wsTickersToES(ctx)
-						})
-						geminiErrGroup.Go(func() error {
-							return g.wsTradesToES(ctx)
+							return str.wsRecords(ctx)
 						})
 					}
 				}
@@ -222,6 +181,7 @@ func (g *gemini) cfgLookup(markets []config.Market) error {
 
 	// Configurations flat map is prepared for easy lookup later in the app.
 	g.cfgMap = make(map[cfgLookupKey]cfgLookupVal)
+	g.strs = make(strCommits)
 	for _, market := range markets {
 		var marketCommitName string
 		if market.CommitName != "" {
@@ -237,31 +197,14 @@ func (g *gemini) cfgLookup(markets []config.Market) error {
 			key := cfgLookupKey{market: marketID, channel: info.Channel}
 			val := cfgLookupVal{}
 			val.wsConsiderIntSec = info.WsConsiderIntSec
-			for _, str := range info.Storages {
-				switch str {
-				case "terminal":
-					val.terStr = true
-					if g.ter == nil {
-						g.ter = storage.GetTerminal()
-						g.wsTerTickers = make(chan []storage.Ticker, 1)
-						g.wsTerTrades = make(chan []storage.Trade, 1)
-					}
-				case "mysql":
-					val.mysqlStr = true
-					if g.mysql == nil {
-						g.mysql = storage.GetMySQL()
-						g.wsMysqlTickers = make(chan []storage.Ticker, 1)
-						g.wsMysqlTrades = make(chan []storage.Trade, 1)
-					}
-				case "elastic_search":
-					val.esStr = true
-					if g.es == nil {
-						g.es = storage.GetElasticSearch()
-						g.wsEsTickers = make(chan []storage.Ticker, 1)
-						g.wsEsTrades = make(chan []storage.Trade, 1)
-					}
-				}
-			}
+			val.strConsiderIntSec = info.StrConsiderIntSec
+			val.strs = g.strs.lookup(info.Storages)
+			val.candleIntervals = candleIntervals(info.CandleIntervals)
+			val.avgPriceWindows = candleIntervals(info.AvgPriceWindows)
+			val.statsInterval = time.Duration(info.StatsIntervalSec) * time.Second
+			val.tickFilter = newTickFilter(info.TickFilter)
+			val.base, val.quote = marketAssets(market)
+			val.tradeFilter = info.TradeFilter
 			val.mktCommitName = marketCommitName
 			g.cfgMap[key] = val
 		}
@@ -270,7 +213,7 @@ func (g *gemini) cfgLookup(markets []config.Market) error {
 }
 
 func (g *gemini) connectWs(ctx context.Context) error {
-	ws, err := connector.NewWebsocket(ctx, &g.connCfg.WS, config.GeminiWebsocketURL)
+	ws, err := connector.NewWebsocket(ctx, &g.connCfg.WS, "gemini", config.GeminiWebsocketURL)
 	if err != nil {
 		if !errors.Is(err, ctx.Err()) {
 			logErrStack(err)
@@ -307,7 +250,7 @@ func (g *gemini) subWsChannel(market string) error {
 		logErrStack(err)
 		return err
 	}
-	err = g.ws.Write(frame)
+	err = g.ws.Subscribe(frame)
 	if err != nil {
 		if errors.Is(err, net.ErrClosed) {
 			err = errors.New("context canceled")
@@ -328,14 +271,7 @@ func (g *gemini) readWs(ctx context.Context) error {
 		cfgLookup[k] = v
 	}
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, g.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, g.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, g.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, g.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, g.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, g.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	log.Debug().Str("exchange", "gemini").Str("func", "readWs").Msg("unlike other exchanges gemini does not send channel subscribed success message")
 
@@ -435,44 +371,18 @@ func (g *gemini) processWs(ctx context.Context, wr *wsRespGemini, cd *commitData
 
 		key := cfgLookupKey{market: strings.ToUpper(ticker.MktID), channel: "ticker"}
 		val := g.cfgMap[key]
-		if val.terStr {
-			cd.terTickersCount++
-			cd.terTickers = append(cd.terTickers, ticker)
-			if cd.terTickersCount == g.connCfg.Terminal.TickerCommitBuf {
-				select {
-				case g.wsTerTickers <- cd.terTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTickersCount = 0
-				cd.terTickers = nil
-			}
+		ticker.Base = val.base
+		ticker.Quote = val.quote
+		if cd.filterTicker(&ticker, key, val.tickFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTickersCount++
-			cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-			if cd.mysqlTickersCount == g.connCfg.MySQL.TickerCommitBuf {
-				select {
-				case g.wsMysqlTickers <- cd.mysqlTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTickersCount = 0
-				cd.mysqlTickers = nil
-			}
+		if !ticker.IsBadTick {
+			ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+			alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+			arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 		}
-		if val.esStr {
-			cd.esTickersCount++
-			cd.esTickers = append(cd.esTickers, ticker)
-			if cd.esTickersCount == g.connCfg.ES.TickerCommitBuf {
-				select {
-				case g.wsEsTickers <- cd.esTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTickersCount = 0
-				cd.esTickers = nil
-			}
+		if err := cd.wsTicker(ctx, key, &val, ticker); err != nil {
+			return err
 		}
 	case "trade":
 		trade := storage.Trade{}
@@ -501,141 +411,47 @@ func (g *gemini) processWs(ctx context.Context, wr *wsRespGemini, cd *commitData
 
 		key := cfgLookupKey{market: strings.ToUpper(trade.MktID), channel: "trade"}
 		val := g.cfgMap[key]
-		if val.terStr {
-			cd.terTradesCount++
-			cd.terTrades = append(cd.terTrades, trade)
-			if cd.terTradesCount == g.connCfg.Terminal.TradeCommitBuf {
-				select {
-				case g.wsTerTrades <- cd.terTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTradesCount = 0
-				cd.terTrades = nil
-			}
+		if filterTradeRules(&trade, val.tradeFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTradesCount++
-			cd.mysqlTrades = append(cd.mysqlTrades, trade)
-			if cd.mysqlTradesCount == g.connCfg.MySQL.TradeCommitBuf {
-				select {
-				case g.wsMysqlTrades <- cd.mysqlTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTradesCount = 0
-				cd.mysqlTrades = nil
-			}
+		trade.Base = val.base
+		trade.Quote = val.quote
+		if cd.filterTrade(&trade, key, val.tickFilter) {
+			return nil
 		}
-		if val.esStr {
-			cd.esTradesCount++
-			cd.esTrades = append(cd.esTrades, trade)
-			if cd.esTradesCount == g.connCfg.ES.TradeCommitBuf {
-				select {
-				case g.wsEsTrades <- cd.esTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTradesCount = 0
-				cd.esTrades = nil
-			}
+		if !trade.IsBadTick {
+			trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+			alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+			arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
 		}
-	}
-	return nil
-}
-
-func (g *gemini) wsTickersToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-g.wsTerTickers:
-			g.ter.CommitTickers(data)
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
-
-func (g *gemini) wsTradesToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-g.wsTerTrades:
-			g.ter.CommitTrades(data)
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
-
-func (g *gemini) wsTickersToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-g.wsMysqlTickers:
-			err := g.mysql.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+		if err := cd.wsTrade(ctx, key, &val, trade); err != nil {
+			return err
 		}
-	}
-}
 
-func (g *gemini) wsTradesToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-g.wsMysqlTrades:
-			err := g.mysql.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Candles are built from the trades, if configured.
+		for _, candle := range cd.addCandleTrade(trade, val.candleIntervals) {
+			if err := cd.wsAggregate(ctx, &val, "candle", candle); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	}
-}
 
-func (g *gemini) wsTickersToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-g.wsEsTickers:
-			err := g.es.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Rolling average prices are calculated from the trades, if configured.
+		for _, avgPrice := range cd.addAvgPriceTrade(trade, val.avgPriceWindows) {
+			if err := cd.wsAggregate(ctx, &val, "avg_price", avgPrice); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	}
-}
 
-func (g *gemini) wsTradesToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-g.wsEsTrades:
-			err := g.es.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+		// Market stats are aggregated from the trades, if configured.
+		if err := g.marketStats.add(ctx, trade); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 func (g *gemini) connectRest() error {
-	rest, err := connector.GetREST()
+	rest, err := connector.GetREST("gemini")
 	if err != nil {
 		logErrStack(err)
 		return err
@@ -651,19 +467,15 @@ func (g *gemini) connectRest() error {
 // then sends it to different storage systems for commit through go channels.
 func (g *gemini) processREST(ctx context.Context, mktID string, mktCommitName string, channel string, interval int) error {
 	var (
-		req *http.Request
-		q   url.Values
-		err error
+		req            *http.Request
+		q              url.Values
+		cursor         connector.TradeCursor
+		err            error
+		lastStatus     string
+		lastInstrument storage.Instrument
 	)
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, g.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, g.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, g.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, g.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, g.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, g.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	switch channel {
 	case "ticker":
@@ -674,7 +486,7 @@ func (g *gemini) processREST(ctx context.Context, mktID string, mktCommitName st
 			}
 			return err
 		}
-	case "trade":
+	case "trade", "block_trade":
 		req, err = g.rest.Request(ctx, "GET", config.GeminiRESTBaseURL+"trades/"+mktID)
 		if err != nil {
 			if !errors.Is(err, ctx.Err()) {
@@ -684,15 +496,24 @@ func (g *gemini) processREST(ctx context.Context, mktID string, mktCommitName st
 		}
 		q = req.URL.Query()
 
-		// Querying for 100 trades.
-		// If the configured interval gap is big, then maybe it will not return all the trades
-		// and if the gap is too small, maybe it will return duplicate ones.
-		// Cursor pagination is not implemented.
-		// Better to use websocket.
+		// Querying for 100 trades, walking forward from the id of the last one received in the earlier poll.
 		q.Add("limit_trades", strconv.Itoa(100))
+		cursor = connector.TradeCursor{
+			Param:    "since_tid",
+			Position: func(id string, _ time.Time) string { return id },
+			Limit:    100,
+		}
+	case "trading_status", "instrument":
+		req, err = g.rest.Request(ctx, "GET", config.GeminiRESTBaseURL+"symbols/details/"+mktID)
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
 	}
 
-	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	tick := connector.NewPollTicker("gemini", time.Duration(interval)*time.Second)
 	defer tick.Stop()
 	for {
 		select {
@@ -722,57 +543,136 @@ func (g *gemini) processREST(ctx context.Context, mktID string, mktCommitName st
 					return err
 				}
 
+				bestBid, err := strconv.ParseFloat(rr.Bid, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				bestAsk, err := strconv.ParseFloat(rr.Ask, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
 				ticker := storage.Ticker{
 					Exchange:      "gemini",
 					MktID:         mktID,
 					MktCommitName: mktCommitName,
 					Price:         price,
+					BestBid:       bestBid,
+					BestAsk:       bestAsk,
 					Timestamp:     time.Now().UTC(),
 				}
 
 				key := cfgLookupKey{market: strings.ToUpper(ticker.MktID), channel: "ticker"}
 				val := g.cfgMap[key]
-				if val.terStr {
-					cd.terTickersCount++
-					cd.terTickers = append(cd.terTickers, ticker)
-					if cd.terTickersCount == g.connCfg.Terminal.TickerCommitBuf {
-						g.ter.CommitTickers(cd.terTickers)
-						cd.terTickersCount = 0
-						cd.terTickers = nil
-					}
+				ticker.Base = val.base
+				ticker.Quote = val.quote
+				if cd.filterTicker(&ticker, key, val.tickFilter) {
+					continue
+				}
+				if !ticker.IsBadTick {
+					ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+					alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+					arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
+				}
+				if err := cd.restTicker(ctx, &val, ticker); err != nil {
+					return err
 				}
-				if val.mysqlStr {
-					cd.mysqlTickersCount++
-					cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-					if cd.mysqlTickersCount == g.connCfg.MySQL.TickerCommitBuf {
-						err := g.mysql.CommitTickers(ctx, cd.mysqlTickers)
+			case "trade", "block_trade":
+				for more := true; more; {
+					cursor.Query(q)
+					req.URL.RawQuery = q.Encode()
+					resp, err := g.rest.Do(req)
+					if err != nil {
+						if !errors.Is(err, ctx.Err()) {
+							logErrStack(err)
+						}
+						return err
+					}
+
+					rr := []restRespGemini{}
+					if err := jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+						logErrStack(err)
+						resp.Body.Close()
+						return err
+					}
+					resp.Body.Close()
+
+					for i := range rr {
+						r := rr[i]
+
+						// Time sent is in milliseconds.
+						timestamp := time.Unix(0, r.Timestamp*int64(time.Millisecond)).UTC()
+
+						// Trades of both the types are tracked by the cursor, as they are paged together.
+						if !cursor.New(strconv.FormatUint(r.TradeID, 10), timestamp) {
+							continue
+						}
+
+						// Block trades are sent along with the regular ones, so they are separated by the type
+						// and not mixed with each other.
+						if (r.Type == "block") != (channel == "block_trade") {
+							continue
+						}
+
+						size, err := strconv.ParseFloat(r.Amount, 64)
 						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
+							logErrStack(err)
 							return err
 						}
-						cd.mysqlTickersCount = 0
-						cd.mysqlTickers = nil
-					}
-				}
-				if val.esStr {
-					cd.esTickersCount++
-					cd.esTickers = append(cd.esTickers, ticker)
-					if cd.esTickersCount == g.connCfg.ES.TickerCommitBuf {
-						err := g.es.CommitTickers(ctx, cd.esTickers)
+
+						price, err := strconv.ParseFloat(r.Price, 64)
 						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
+							logErrStack(err)
+							return err
+						}
+
+						trade := storage.Trade{
+							Exchange:      "gemini",
+							MktID:         mktID,
+							MktCommitName: mktCommitName,
+							TradeID:       strconv.FormatUint(r.TradeID, 10),
+							Side:          r.Type,
+							Size:          size,
+							Price:         price,
+							Timestamp:     timestamp,
+						}
+
+						// Block trades do not have a taker side.
+						if channel == "block_trade" {
+							trade.Side = ""
+							key := cfgLookupKey{market: strings.ToUpper(trade.MktID), channel: "block_trade"}
+							val := g.cfgMap[key]
+							if err := cd.restRecord(ctx, &val, "block_trade", trade); err != nil {
+								return err
 							}
+							continue
+						}
+
+						key := cfgLookupKey{market: strings.ToUpper(trade.MktID), channel: "trade"}
+						val := g.cfgMap[key]
+						if filterTradeRules(&trade, val.tradeFilter) {
+							continue
+						}
+						trade.Base = val.base
+						trade.Quote = val.quote
+						if cd.filterTrade(&trade, key, val.tickFilter) {
+							continue
+						}
+						if !trade.IsBadTick {
+							trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+							alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+							arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
+						}
+						if err := cd.restTrade(ctx, &val, trade); err != nil {
 							return err
 						}
-						cd.esTickersCount = 0
-						cd.esTickers = nil
 					}
+					more = cursor.Next(len(rr))
 				}
-			case "trade":
-				req.URL.RawQuery = q.Encode()
+			case "trading_status":
 				resp, err := g.rest.Do(req)
 				if err != nil {
 					if !errors.Is(err, ctx.Err()) {
@@ -781,84 +681,95 @@ func (g *gemini) processREST(ctx context.Context, mktID string, mktCommitName st
 					return err
 				}
 
-				rr := []restRespGemini{}
-				if err := jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+				rr := restRespGemini{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
 					logErrStack(err)
 					resp.Body.Close()
 					return err
 				}
 				resp.Body.Close()
 
-				for i := range rr {
-					r := rr[i]
+				// Exchange specific status values are converted to a common format.
+				var status string
+				switch rr.Status {
+				case "open":
+					status = "trading"
+				case "closed":
+					status = "halted"
+				default:
+					status = rr.Status
+				}
 
-					size, err := strconv.ParseFloat(r.Amount, 64)
-					if err != nil {
-						logErrStack(err)
-						return err
-					}
+				// Only the changes are stored, first one being the status at the start.
+				if status == lastStatus {
+					continue
+				}
+				lastStatus = status
 
-					price, err := strconv.ParseFloat(r.Price, 64)
-					if err != nil {
+				tradingStatus := storage.TradingStatus{
+					Exchange:      "gemini",
+					MktID:         mktID,
+					MktCommitName: mktCommitName,
+					Status:        status,
+					Timestamp:     time.Now().UTC(),
+				}
+
+				key := cfgLookupKey{market: strings.ToUpper(tradingStatus.MktID), channel: "trading_status"}
+				val := g.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "trading_status", tradingStatus); err != nil {
+					return err
+				}
+			case "instrument":
+				resp, err := g.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
 						logErrStack(err)
-						return err
 					}
+					return err
+				}
 
-					// Time sent is in milliseconds.
-					timestamp := time.Unix(0, r.Timestamp*int64(time.Millisecond)).UTC()
-
-					trade := storage.Trade{
-						Exchange:      "gemini",
-						MktID:         mktID,
-						MktCommitName: mktCommitName,
-						TradeID:       strconv.FormatUint(r.TradeID, 10),
-						Side:          r.Type,
-						Size:          size,
-						Price:         price,
-						Timestamp:     timestamp,
-					}
+				rr := restRespGemini{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
 
-					key := cfgLookupKey{market: strings.ToUpper(trade.MktID), channel: "trade"}
-					val := g.cfgMap[key]
-					if val.terStr {
-						cd.terTradesCount++
-						cd.terTrades = append(cd.terTrades, trade)
-						if cd.terTradesCount == g.connCfg.Terminal.TradeCommitBuf {
-							g.ter.CommitTrades(cd.terTrades)
-							cd.terTradesCount = 0
-							cd.terTrades = nil
-						}
-					}
-					if val.mysqlStr {
-						cd.mysqlTradesCount++
-						cd.mysqlTrades = append(cd.mysqlTrades, trade)
-						if cd.mysqlTradesCount == g.connCfg.MySQL.TradeCommitBuf {
-							err := g.mysql.CommitTrades(ctx, cd.mysqlTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.mysqlTradesCount = 0
-							cd.mysqlTrades = nil
-						}
-					}
-					if val.esStr {
-						cd.esTradesCount++
-						cd.esTrades = append(cd.esTrades, trade)
-						if cd.esTradesCount == g.connCfg.ES.TradeCommitBuf {
-							err := g.es.CommitTrades(ctx, cd.esTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.esTradesCount = 0
-							cd.esTrades = nil
-						}
-					}
+				// Exchange specific status values are converted to a common format.
+				var status string
+				switch rr.Status {
+				case "open":
+					status = "trading"
+				case "closed":
+					status = "halted"
+				default:
+					status = rr.Status
+				}
+
+				// Tick size of the exchange is the order quantity increment and quote increment is the price one.
+				instrument := storage.Instrument{
+					Exchange:       "gemini",
+					MktID:          mktID,
+					MktCommitName:  mktCommitName,
+					TickSize:       rr.QuoteIncrement,
+					LotSize:        rr.TickSize,
+					PricePrecision: precision(rr.QuoteIncrement),
+					SizePrecision:  precision(rr.TickSize),
+					Status:         status,
+				}
+
+				// Only the changes are stored, first one being the metadata at the start.
+				if instrument == lastInstrument {
+					continue
+				}
+				lastInstrument = instrument
+				instrument.Timestamp = time.Now().UTC()
+
+				key := cfgLookupKey{market: strings.ToUpper(instrument.MktID), channel: "instrument"}
+				val := g.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "instrument", instrument); err != nil {
+					return err
 				}
 			}
 
@@ -2,18 +2,21 @@ package exchange
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/arbitrage"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
 	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -21,59 +24,18 @@ import (
 
 // StartHbtc is for starting hbtc exchange functions.
 func StartHbtc(appCtx context.Context, markets []config.Market, retry *config.Retry, connCfg *config.Connection) error {
-
-	// If any error occurs or connection is lost, retry the exchange functions with a time gap till it reaches
-	// a configured number of retry.
-	// Retry counter will be reset back to zero if the elapsed time since the last retry is greater than the configured one.
-	var retryCount int
-	lastRetryTime := time.Now()
-
-	for {
-		err := newHbtc(appCtx, markets, connCfg)
-		if err != nil {
-			log.Error().Err(err).Str("exchange", "hbtc").Msg("error occurred")
-			if retry.Number == 0 {
-				return errors.New("not able to connect hbtc exchange. please check the log for details")
-			}
-			if retry.ResetSec == 0 || time.Since(lastRetryTime).Seconds() < float64(retry.ResetSec) {
-				retryCount++
-			} else {
-				retryCount = 1
-			}
-			lastRetryTime = time.Now()
-			if retryCount > retry.Number {
-				return fmt.Errorf("not able to connect hbtc exchange even after %v retry. please check the log for details", retry.Number)
-			}
-
-			log.Error().Str("exchange", "hbtc").Int("retry", retryCount).Msg(fmt.Sprintf("retrying functions in %v seconds", retry.GapSec))
-			tick := time.NewTicker(time.Duration(retry.GapSec) * time.Second)
-			select {
-			case <-tick.C:
-				tick.Stop()
-
-			// Return, if there is any error from another exchange.
-			case <-appCtx.Done():
-				log.Error().Str("exchange", "hbtc").Msg("ctx canceled, return from StartHbtc")
-				return appCtx.Err()
-			}
-		}
-	}
+	return supervisor.Run(appCtx, "hbtc", retry, func() error {
+		return newHbtc(appCtx, markets, connCfg)
+	})
 }
 
 type hbtc struct {
-	ws             connector.Websocket
-	rest           *connector.REST
-	connCfg        *config.Connection
-	cfgMap         map[cfgLookupKey]cfgLookupVal
-	ter            *storage.Terminal
-	es             *storage.ElasticSearch
-	mysql          *storage.MySQL
-	wsTerTickers   chan []storage.Ticker
-	wsTerTrades    chan []storage.Trade
-	wsMysqlTickers chan []storage.Ticker
-	wsMysqlTrades  chan []storage.Trade
-	wsEsTickers    chan []storage.Ticker
-	wsEsTrades     chan []storage.Trade
+	ws          connector.Websocket
+	rest        *connector.REST
+	connCfg     *config.Connection
+	cfgMap      map[cfgLookupKey]cfgLookupVal
+	strs        strCommits
+	marketStats *marketStats
 }
 
 type wsSubHbtc struct {
@@ -100,6 +62,9 @@ type wsRespHbtc struct {
 type wsRespDataHbtc struct {
 	Qty         string              `json:"q"`
 	TickerPrice string              `json:"c"`
+	High        string              `json:"h"`
+	Low         string              `json:"l"`
+	Volume      string              `json:"v"`
 	TradePrice  string              `json:"p"`
 	Time        int64               `json:"t"`
 	Maker       jsoniter.RawMessage `json:"m"`
@@ -112,6 +77,31 @@ type restRespHbtc struct {
 	Time  int64  `json:"time"`
 }
 
+type restRespTickerHbtc struct {
+	Price   string `json:"lastPrice"`
+	BestBid string `json:"bestBidPrice"`
+	BestAsk string `json:"bestAskPrice"`
+	Volume  string `json:"volume"`
+	High    string `json:"highPrice"`
+	Low     string `json:"lowPrice"`
+}
+
+type restInstrumentRespHbtc struct {
+	Symbols []restInstrumentSymbolHbtc `json:"symbols"`
+}
+
+type restInstrumentSymbolHbtc struct {
+	Symbol  string           `json:"symbol"`
+	Status  string           `json:"status"`
+	Filters []restFilterHbtc `json:"filters"`
+}
+
+type restFilterHbtc struct {
+	FilterType string `json:"filterType"`
+	TickSize   string `json:"tickSize"`
+	StepSize   string `json:"stepSize"`
+}
+
 func newHbtc(appCtx context.Context, markets []config.Market, connCfg *config.Connection) error {
 
 	// If any exchange function fails, force all the other functions to stop and return.
@@ -123,6 +113,7 @@ func newHbtc(appCtx context.Context, markets []config.Market, connCfg *config.Co
 	if err != nil {
 		return err
 	}
+	h.marketStats = newMarketStats("hbtc", h.cfgMap)
 
 	var (
 		wsCount   int
@@ -152,30 +143,22 @@ func newHbtc(appCtx context.Context, markets []config.Market, connCfg *config.Co
 						return h.readWs(ctx)
 					})
 
-					if h.ter != nil {
-						hbtcErrGroup.Go(func() error {
-							return h.wsTickersToTerminal(ctx)
-						})
+					if h.marketStats != nil {
 						hbtcErrGroup.Go(func() error {
-							return h.wsTradesToTerminal(ctx)
+							return h.marketStats.run(ctx)
 						})
 					}
 
-					if h.mysql != nil {
+					for _, str := range h.strs {
+						str := str
 						hbtcErrGroup.Go(func() error {
-							return h.wsTickersToMySQL(ctx)
+							return str.wsTickers(ctx)
 						})
 						hbtcErrGroup.Go(func() error {
-							return h.wsTradesToMySQL(ctx)
+							return str.wsTrades(ctx)
 						})
-					}
-
-					if h.es != nil {
 						hbtcErrGroup.Go(func() error {
-							return h.wsTickersToES(ctx)
-						})
-						hbtcErrGroup.Go(func() error {
-							return h.wsTradesToES(ctx)
+							return str.wsRecords(ctx)
 						})
 					}
 				}
@@ -223,6 +206,7 @@ func (h *hbtc) cfgLookup(markets []config.Market) error {
 
 	// Configurations flat map is prepared for easy lookup later in the app.
 	h.cfgMap = make(map[cfgLookupKey]cfgLookupVal)
+	h.strs = make(strCommits)
 	for _, market := range markets {
 		var mktCommitName string
 		if market.CommitName != "" {
@@ -234,31 +218,14 @@ func (h *hbtc) cfgLookup(markets []config.Market) error {
 			key := cfgLookupKey{market: market.ID, channel: info.Channel}
 			val := cfgLookupVal{}
 			val.wsConsiderIntSec = info.WsConsiderIntSec
-			for _, str := range info.Storages {
-				switch str {
-				case "terminal":
-					val.terStr = true
-					if h.ter == nil {
-						h.ter = storage.GetTerminal()
-						h.wsTerTickers = make(chan []storage.Ticker, 1)
-						h.wsTerTrades = make(chan []storage.Trade, 1)
-					}
-				case "mysql":
-					val.mysqlStr = true
-					if h.mysql == nil {
-						h.mysql = storage.GetMySQL()
-						h.wsMysqlTickers = make(chan []storage.Ticker, 1)
-						h.wsMysqlTrades = make(chan []storage.Trade, 1)
-					}
-				case "elastic_search":
-					val.esStr = true
-					if h.es == nil {
-						h.es = storage.GetElasticSearch()
-						h.wsEsTickers = make(chan []storage.Ticker, 1)
-						h.wsEsTrades = make(chan []storage.Trade, 1)
-					}
-				}
-			}
+			val.strConsiderIntSec = info.StrConsiderIntSec
+			val.strs = h.strs.lookup(info.Storages)
+			val.candleIntervals = candleIntervals(info.CandleIntervals)
+			val.avgPriceWindows = candleIntervals(info.AvgPriceWindows)
+			val.statsInterval = time.Duration(info.StatsIntervalSec) * time.Second
+			val.tickFilter = newTickFilter(info.TickFilter)
+			val.base, val.quote = marketAssets(market)
+			val.tradeFilter = info.TradeFilter
 			val.mktCommitName = mktCommitName
 			h.cfgMap[key] = val
 		}
@@ -267,7 +234,7 @@ func (h *hbtc) cfgLookup(markets []config.Market) error {
 }
 
 func (h *hbtc) connectWs(ctx context.Context) error {
-	ws, err := connector.NewWebsocket(ctx, &h.connCfg.WS, config.HbtcWebsocketURL)
+	ws, err := connector.NewWebsocket(ctx, &h.connCfg.WS, "hbtc", config.HbtcWebsocketURL)
 	if err != nil {
 		if !errors.Is(err, ctx.Err()) {
 			logErrStack(err)
@@ -334,7 +301,7 @@ func (h *hbtc) subWsChannel(market string, channel string) error {
 		logErrStack(err)
 		return err
 	}
-	err = h.ws.Write(frame)
+	err = h.ws.Subscribe(frame)
 	if err != nil {
 		if errors.Is(err, net.ErrClosed) {
 			err = errors.New("context canceled")
@@ -355,14 +322,7 @@ func (h *hbtc) readWs(ctx context.Context) error {
 		cfgLookup[k] = v
 	}
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, h.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, h.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, h.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, h.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, h.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, h.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	for {
 		select {
@@ -449,49 +409,44 @@ func (h *hbtc) processWs(ctx context.Context, wr *wsRespHbtc, cd *commitData) er
 		}
 		ticker.Price = price
 
+		high, err := strconv.ParseFloat(wr.Data.High, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		ticker.High = high
+
+		low, err := strconv.ParseFloat(wr.Data.Low, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		ticker.Low = low
+
+		volume, err := strconv.ParseFloat(wr.Data.Volume, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		ticker.Volume = volume
+
 		// Time sent is in milliseconds.
 		ticker.Timestamp = time.Unix(0, wr.Data.Time*int64(time.Millisecond)).UTC()
 
 		key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 		val := h.cfgMap[key]
-		if val.terStr {
-			cd.terTickersCount++
-			cd.terTickers = append(cd.terTickers, ticker)
-			if cd.terTickersCount == h.connCfg.Terminal.TickerCommitBuf {
-				select {
-				case h.wsTerTickers <- cd.terTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTickersCount = 0
-				cd.terTickers = nil
-			}
+		ticker.Base = val.base
+		ticker.Quote = val.quote
+		if cd.filterTicker(&ticker, key, val.tickFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTickersCount++
-			cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-			if cd.mysqlTickersCount == h.connCfg.MySQL.TickerCommitBuf {
-				select {
-				case h.wsMysqlTickers <- cd.mysqlTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTickersCount = 0
-				cd.mysqlTickers = nil
-			}
+		if !ticker.IsBadTick {
+			ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+			alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+			arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 		}
-		if val.esStr {
-			cd.esTickersCount++
-			cd.esTickers = append(cd.esTickers, ticker)
-			if cd.esTickersCount == h.connCfg.ES.TickerCommitBuf {
-				select {
-				case h.wsEsTickers <- cd.esTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTickersCount = 0
-				cd.esTickers = nil
-			}
+		if err := cd.wsTicker(ctx, key, &val, ticker); err != nil {
+			return err
 		}
 	case "trade":
 		trade := storage.Trade{}
@@ -531,141 +486,47 @@ func (h *hbtc) processWs(ctx context.Context, wr *wsRespHbtc, cd *commitData) er
 
 		key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 		val := h.cfgMap[key]
-		if val.terStr {
-			cd.terTradesCount++
-			cd.terTrades = append(cd.terTrades, trade)
-			if cd.terTradesCount == h.connCfg.Terminal.TradeCommitBuf {
-				select {
-				case h.wsTerTrades <- cd.terTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTradesCount = 0
-				cd.terTrades = nil
-			}
-		}
-		if val.mysqlStr {
-			cd.mysqlTradesCount++
-			cd.mysqlTrades = append(cd.mysqlTrades, trade)
-			if cd.mysqlTradesCount == h.connCfg.MySQL.TradeCommitBuf {
-				select {
-				case h.wsMysqlTrades <- cd.mysqlTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTradesCount = 0
-				cd.mysqlTrades = nil
-			}
-		}
-		if val.esStr {
-			cd.esTradesCount++
-			cd.esTrades = append(cd.esTrades, trade)
-			if cd.esTradesCount == h.connCfg.ES.TradeCommitBuf {
-				select {
-				case h.wsEsTrades <- cd.esTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTradesCount = 0
-				cd.esTrades = nil
-			}
+		if filterTradeRules(&trade, val.tradeFilter) {
+			return nil
 		}
-	}
-	return nil
-}
-
-func (h *hbtc) wsTickersToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-h.wsTerTickers:
-			h.ter.CommitTickers(data)
-		case <-ctx.Done():
-			return ctx.Err()
+		trade.Base = val.base
+		trade.Quote = val.quote
+		if cd.filterTrade(&trade, key, val.tickFilter) {
+			return nil
 		}
-	}
-}
-
-func (h *hbtc) wsTradesToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-h.wsTerTrades:
-			h.ter.CommitTrades(data)
-		case <-ctx.Done():
-			return ctx.Err()
+		if !trade.IsBadTick {
+			trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+			alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+			arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
 		}
-	}
-}
-
-func (h *hbtc) wsTickersToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-h.wsMysqlTickers:
-			err := h.mysql.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+		if err := cd.wsTrade(ctx, key, &val, trade); err != nil {
+			return err
 		}
-	}
-}
 
-func (h *hbtc) wsTradesToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-h.wsMysqlTrades:
-			err := h.mysql.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Candles are built from the trades, if configured.
+		for _, candle := range cd.addCandleTrade(trade, val.candleIntervals) {
+			if err := cd.wsAggregate(ctx, &val, "candle", candle); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	}
-}
 
-func (h *hbtc) wsTickersToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-h.wsEsTickers:
-			err := h.es.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Rolling average prices are calculated from the trades, if configured.
+		for _, avgPrice := range cd.addAvgPriceTrade(trade, val.avgPriceWindows) {
+			if err := cd.wsAggregate(ctx, &val, "avg_price", avgPrice); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	}
-}
 
-func (h *hbtc) wsTradesToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-h.wsEsTrades:
-			err := h.es.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+		// Market stats are aggregated from the trades, if configured.
+		if err := h.marketStats.add(ctx, trade); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 func (h *hbtc) connectRest() error {
-	rest, err := connector.GetREST()
+	rest, err := connector.GetREST("hbtc")
 	if err != nil {
 		logErrStack(err)
 		return err
@@ -681,23 +542,18 @@ func (h *hbtc) connectRest() error {
 // then sends it to different storage systems for commit through go channels.
 func (h *hbtc) processREST(ctx context.Context, mktID string, mktCommitName string, channel string, interval int) error {
 	var (
-		req *http.Request
-		q   url.Values
-		err error
+		req            *http.Request
+		q              url.Values
+		cursor         connector.TradeCursor
+		err            error
+		lastInstrument storage.Instrument
 	)
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, h.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, h.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, h.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, h.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, h.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, h.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	switch channel {
 	case "ticker":
-		req, err = h.rest.Request(ctx, "GET", config.HbtcRESTBaseURL+"openapi/quote/v1/ticker/price")
+		req, err = h.rest.Request(ctx, "GET", config.HbtcRESTBaseURL+"openapi/quote/v1/ticker/24hr")
 		if err != nil {
 			if !errors.Is(err, ctx.Err()) {
 				logErrStack(err)
@@ -718,13 +574,21 @@ func (h *hbtc) processREST(ctx context.Context, mktID string, mktCommitName stri
 		q.Add("symbol", mktID)
 
 		// Querying for 100 trades.
-		// If the configured interval gap is big, then maybe it will not return all the trades
-		// and if the gap is too small, maybe it will return duplicate ones.
+		// Only the latest trades are returned by the endpoint, so the ones received in the earlier poll are skipped.
+		// If the configured interval gap is big, then maybe it will not return all the trades.
 		// Better to use websocket.
 		q.Add("limit", strconv.Itoa(100))
+	case "instrument":
+		req, err = h.rest.Request(ctx, "GET", config.HbtcRESTBaseURL+"openapi/v1/brokerInfo")
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
 	}
 
-	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	tick := connector.NewPollTicker("hbtc", time.Duration(interval)*time.Second)
 	defer tick.Stop()
 	for {
 		select {
@@ -741,7 +605,7 @@ func (h *hbtc) processREST(ctx context.Context, mktID string, mktCommitName stri
 					return err
 				}
 
-				rr := restRespHbtc{}
+				rr := restRespTickerHbtc{}
 				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
 					logErrStack(err)
 					resp.Body.Close()
@@ -755,54 +619,63 @@ func (h *hbtc) processREST(ctx context.Context, mktID string, mktCommitName stri
 					return err
 				}
 
+				bestBid, err := strconv.ParseFloat(rr.BestBid, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				bestAsk, err := strconv.ParseFloat(rr.BestAsk, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				volume, err := strconv.ParseFloat(rr.Volume, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				high, err := strconv.ParseFloat(rr.High, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				low, err := strconv.ParseFloat(rr.Low, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
 				ticker := storage.Ticker{
 					Exchange:      "hbtc",
 					MktID:         mktID,
 					MktCommitName: mktCommitName,
 					Price:         price,
+					BestBid:       bestBid,
+					BestAsk:       bestAsk,
+					Volume:        volume,
+					High:          high,
+					Low:           low,
 					Timestamp:     time.Now().UTC(),
 				}
 
 				key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 				val := h.cfgMap[key]
-				if val.terStr {
-					cd.terTickersCount++
-					cd.terTickers = append(cd.terTickers, ticker)
-					if cd.terTickersCount == h.connCfg.Terminal.TickerCommitBuf {
-						h.ter.CommitTickers(cd.terTickers)
-						cd.terTickersCount = 0
-						cd.terTickers = nil
-					}
+				ticker.Base = val.base
+				ticker.Quote = val.quote
+				if cd.filterTicker(&ticker, key, val.tickFilter) {
+					continue
 				}
-				if val.mysqlStr {
-					cd.mysqlTickersCount++
-					cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-					if cd.mysqlTickersCount == h.connCfg.MySQL.TickerCommitBuf {
-						err := h.mysql.CommitTickers(ctx, cd.mysqlTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.mysqlTickersCount = 0
-						cd.mysqlTickers = nil
-					}
+				if !ticker.IsBadTick {
+					ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+					alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+					arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 				}
-				if val.esStr {
-					cd.esTickersCount++
-					cd.esTickers = append(cd.esTickers, ticker)
-					if cd.esTickersCount == h.connCfg.ES.TickerCommitBuf {
-						err := h.es.CommitTickers(ctx, cd.esTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.esTickersCount = 0
-						cd.esTickers = nil
-					}
+				if err := cd.restTicker(ctx, &val, ticker); err != nil {
+					return err
 				}
 			case "trade":
 				req.URL.RawQuery = q.Encode()
@@ -856,48 +729,105 @@ func (h *hbtc) processREST(ctx context.Context, mktID string, mktCommitName stri
 						Timestamp:     timestamp,
 					}
 
+					if !cursor.New(restTradeKey(&trade), trade.Timestamp) {
+						continue
+					}
+
 					key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 					val := h.cfgMap[key]
-					if val.terStr {
-						cd.terTradesCount++
-						cd.terTrades = append(cd.terTrades, trade)
-						if cd.terTradesCount == h.connCfg.Terminal.TradeCommitBuf {
-							h.ter.CommitTrades(cd.terTrades)
-							cd.terTradesCount = 0
-							cd.terTrades = nil
-						}
+					if filterTradeRules(&trade, val.tradeFilter) {
+						continue
+					}
+					trade.Base = val.base
+					trade.Quote = val.quote
+					if cd.filterTrade(&trade, key, val.tickFilter) {
+						continue
+					}
+					if !trade.IsBadTick {
+						trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+						alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+						arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
+					}
+					if err := cd.restTrade(ctx, &val, trade); err != nil {
+						return err
+					}
+				}
+				cursor.Next(len(rr))
+			case "instrument":
+				resp, err := h.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
+					}
+					return err
+				}
+
+				rr := restInstrumentRespHbtc{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				// Exchange returns all the markets, so the configured one is picked.
+				var symbol restInstrumentSymbolHbtc
+				found := false
+				for _, s := range rr.Symbols {
+					if s.Symbol == mktID {
+						symbol = s
+						found = true
+						break
 					}
-					if val.mysqlStr {
-						cd.mysqlTradesCount++
-						cd.mysqlTrades = append(cd.mysqlTrades, trade)
-						if cd.mysqlTradesCount == h.connCfg.MySQL.TradeCommitBuf {
-							err := h.mysql.CommitTrades(ctx, cd.mysqlTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.mysqlTradesCount = 0
-							cd.mysqlTrades = nil
-						}
+				}
+				if !found {
+					err = errors.New("market info is not returned by exchange")
+					logErrStack(err)
+					return err
+				}
+
+				var tickSize, lotSize float64
+				for _, filter := range symbol.Filters {
+					switch filter.FilterType {
+					case "PRICE_FILTER":
+						tickSize, err = strconv.ParseFloat(filter.TickSize, 64)
+					case "LOT_SIZE":
+						lotSize, err = strconv.ParseFloat(filter.StepSize, 64)
 					}
-					if val.esStr {
-						cd.esTradesCount++
-						cd.esTrades = append(cd.esTrades, trade)
-						if cd.esTradesCount == h.connCfg.ES.TradeCommitBuf {
-							err := h.es.CommitTrades(ctx, cd.esTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.esTradesCount = 0
-							cd.esTrades = nil
-						}
+					if err != nil {
+						logErrStack(err)
+						return err
 					}
 				}
+
+				status := strings.ToLower(symbol.Status)
+				if symbol.Status == "TRADING" {
+					status = "trading"
+				}
+
+				instrument := storage.Instrument{
+					Exchange:       "hbtc",
+					MktID:          mktID,
+					MktCommitName:  mktCommitName,
+					TickSize:       tickSize,
+					LotSize:        lotSize,
+					PricePrecision: precision(tickSize),
+					SizePrecision:  precision(lotSize),
+					Status:         status,
+				}
+
+				// Only the changes are stored, first one being the metadata at the start.
+				if instrument == lastInstrument {
+					continue
+				}
+				lastInstrument = instrument
+				instrument.Timestamp = time.Now().UTC()
+
+				key := cfgLookupKey{market: instrument.MktID, channel: "instrument"}
+				val := h.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "instrument", instrument); err != nil {
+					return err
+				}
 			}
 
 		// Return, if there is any error from another function or exchange.
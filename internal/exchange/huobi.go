@@ -2,8 +2,8 @@ package exchange
 
 import (
 	"context"
-	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
@@ -12,9 +12,12 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/arbitrage"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
 	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -22,59 +25,18 @@ import (
 
 // StartHuobi is for starting huobi exchange functions.
 func StartHuobi(appCtx context.Context, markets []config.Market, retry *config.Retry, connCfg *config.Connection) error {
-
-	// If any error occurs or connection is lost, retry the exchange functions with a time gap till it reaches
-	// a configured number of retry.
-	// Retry counter will be reset back to zero if the elapsed time since the last retry is greater than the configured one.
-	var retryCount int
-	lastRetryTime := time.Now()
-
-	for {
-		err := newHuobi(appCtx, markets, connCfg)
-		if err != nil {
-			log.Error().Err(err).Str("exchange", "huobi").Msg("error occurred")
-			if retry.Number == 0 {
-				return errors.New("not able to connect huobi exchange. please check the log for details")
-			}
-			if retry.ResetSec == 0 || time.Since(lastRetryTime).Seconds() < float64(retry.ResetSec) {
-				retryCount++
-			} else {
-				retryCount = 1
-			}
-			lastRetryTime = time.Now()
-			if retryCount > retry.Number {
-				return fmt.Errorf("not able to connect huobi exchange even after %v retry. please check the log for details", retry.Number)
-			}
-
-			log.Error().Str("exchange", "huobi").Int("retry", retryCount).Msg(fmt.Sprintf("retrying functions in %v seconds", retry.GapSec))
-			tick := time.NewTicker(time.Duration(retry.GapSec) * time.Second)
-			select {
-			case <-tick.C:
-				tick.Stop()
-
-			// Return, if there is any error from another exchange.
-			case <-appCtx.Done():
-				log.Error().Str("exchange", "huobi").Msg("ctx canceled, return from StartHuobi")
-				return appCtx.Err()
-			}
-		}
-	}
+	return supervisor.Run(appCtx, "huobi", retry, func() error {
+		return newHuobi(appCtx, markets, connCfg)
+	})
 }
 
 type huobi struct {
-	ws             connector.Websocket
-	rest           *connector.REST
-	connCfg        *config.Connection
-	cfgMap         map[cfgLookupKey]cfgLookupVal
-	ter            *storage.Terminal
-	es             *storage.ElasticSearch
-	mysql          *storage.MySQL
-	wsTerTickers   chan []storage.Ticker
-	wsTerTrades    chan []storage.Trade
-	wsMysqlTickers chan []storage.Ticker
-	wsMysqlTrades  chan []storage.Trade
-	wsEsTickers    chan []storage.Ticker
-	wsEsTrades     chan []storage.Trade
+	ws          connector.Websocket
+	rest        *connector.REST
+	connCfg     *config.Connection
+	cfgMap      map[cfgLookupKey]cfgLookupVal
+	strs        strCommits
+	marketStats *marketStats
 }
 
 type respHuobi struct {
@@ -89,8 +51,25 @@ type respHuobi struct {
 	mktCommitName string
 }
 
+type restInstrumentRespHuobi struct {
+	Status string                    `json:"status"`
+	Data   []restInstrumentDataHuobi `json:"data"`
+}
+
+type restInstrumentDataHuobi struct {
+	Symbol          string `json:"symbol"`
+	State           string `json:"state"`
+	PricePrecision  int    `json:"price-precision"`
+	AmountPrecision int    `json:"amount-precision"`
+}
+
 type respTickHuobi struct {
 	TickerPrice float64         `json:"close"`
+	High        float64         `json:"high"`
+	Low         float64         `json:"low"`
+	Volume      float64         `json:"amount"`
+	Bid         []float64       `json:"bid"`
+	Ask         []float64       `json:"ask"`
 	TradeData   []respDataHuobi `json:"data"`
 }
 
@@ -114,6 +93,7 @@ func newHuobi(appCtx context.Context, markets []config.Market, connCfg *config.C
 	if err != nil {
 		return err
 	}
+	h.marketStats = newMarketStats("huobi", h.cfgMap)
 
 	var (
 		wsCount   int
@@ -139,30 +119,22 @@ func newHuobi(appCtx context.Context, markets []config.Market, connCfg *config.C
 						return h.readWs(ctx)
 					})
 
-					if h.ter != nil {
+					if h.marketStats != nil {
 						huobiErrGroup.Go(func() error {
-							return h.wsTickersToTerminal(ctx)
-						})
-						huobiErrGroup.Go(func() error {
-							return h.wsTradesToTerminal(ctx)
+							return h.marketStats.run(ctx)
 						})
 					}
 
-					if h.mysql != nil {
-						huobiErrGroup.Go(func() error {
-							return h.wsTickersToMySQL(ctx)
-						})
+					for _, str := range h.strs {
+						str := str
 						huobiErrGroup.Go(func() error {
-							return h.wsTradesToMySQL(ctx)
+							return str.wsTickers(ctx)
 						})
-					}
-
-					if h.es != nil {
 						huobiErrGroup.Go(func() error {
-							return h.wsTickersToES(ctx)
+							return str.wsTrades(ctx)
 						})
 						huobiErrGroup.Go(func() error {
-							return h.wsTradesToES(ctx)
+							return str.wsRecords(ctx)
 						})
 					}
 				}
@@ -210,6 +182,7 @@ func (h *huobi) cfgLookup(markets []config.Market) error {
 
 	// Configurations flat map is prepared for easy lookup later in the app.
 	h.cfgMap = make(map[cfgLookupKey]cfgLookupVal)
+	h.strs = make(strCommits)
 	for _, market := range markets {
 		var marketCommitName string
 		if market.CommitName != "" {
@@ -221,31 +194,14 @@ func (h *huobi) cfgLookup(markets []config.Market) error {
 			key := cfgLookupKey{market: market.ID, channel: info.Channel}
 			val := cfgLookupVal{}
 			val.wsConsiderIntSec = info.WsConsiderIntSec
-			for _, str := range info.Storages {
-				switch str {
-				case "terminal":
-					val.terStr = true
-					if h.ter == nil {
-						h.ter = storage.GetTerminal()
-						h.wsTerTickers = make(chan []storage.Ticker, 1)
-						h.wsTerTrades = make(chan []storage.Trade, 1)
-					}
-				case "mysql":
-					val.mysqlStr = true
-					if h.mysql == nil {
-						h.mysql = storage.GetMySQL()
-						h.wsMysqlTickers = make(chan []storage.Ticker, 1)
-						h.wsMysqlTrades = make(chan []storage.Trade, 1)
-					}
-				case "elastic_search":
-					val.esStr = true
-					if h.es == nil {
-						h.es = storage.GetElasticSearch()
-						h.wsEsTickers = make(chan []storage.Ticker, 1)
-						h.wsEsTrades = make(chan []storage.Trade, 1)
-					}
-				}
-			}
+			val.strConsiderIntSec = info.StrConsiderIntSec
+			val.strs = h.strs.lookup(info.Storages)
+			val.candleIntervals = candleIntervals(info.CandleIntervals)
+			val.avgPriceWindows = candleIntervals(info.AvgPriceWindows)
+			val.statsInterval = time.Duration(info.StatsIntervalSec) * time.Second
+			val.tickFilter = newTickFilter(info.TickFilter)
+			val.base, val.quote = marketAssets(market)
+			val.tradeFilter = info.TradeFilter
 			val.mktCommitName = marketCommitName
 			h.cfgMap[key] = val
 		}
@@ -254,7 +210,7 @@ func (h *huobi) cfgLookup(markets []config.Market) error {
 }
 
 func (h *huobi) connectWs(ctx context.Context) error {
-	ws, err := connector.NewWebsocket(ctx, &h.connCfg.WS, config.HuobiWebsocketURL)
+	ws, err := connector.NewWebsocket(ctx, &h.connCfg.WS, "huobi", config.HuobiWebsocketURL)
 	if err != nil {
 		if !errors.Is(err, ctx.Err()) {
 			logErrStack(err)
@@ -312,7 +268,7 @@ func (h *huobi) subWsChannel(market string, channel string) error {
 		logErrStack(err)
 		return err
 	}
-	err = h.ws.Write(frame)
+	err = h.ws.Subscribe(frame)
 	if err != nil {
 		if errors.Is(err, net.ErrClosed) {
 			err = errors.New("context canceled")
@@ -333,14 +289,7 @@ func (h *huobi) readWs(ctx context.Context) error {
 		cfgLookup[k] = v
 	}
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, h.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, h.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, h.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, h.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, h.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, h.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	for {
 		select {
@@ -434,50 +383,27 @@ func (h *huobi) processWs(ctx context.Context, wr *respHuobi, cd *commitData) er
 		ticker.MktID = wr.market
 		ticker.MktCommitName = wr.mktCommitName
 		ticker.Price = wr.Tick.TickerPrice
+		ticker.High = wr.Tick.High
+		ticker.Low = wr.Tick.Low
+		ticker.Volume = wr.Tick.Volume
 
 		// Time sent is in milliseconds.
 		ticker.Timestamp = time.Unix(0, wr.Time*int64(time.Millisecond)).UTC()
 
 		key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 		val := h.cfgMap[key]
-		if val.terStr {
-			cd.terTickersCount++
-			cd.terTickers = append(cd.terTickers, ticker)
-			if cd.terTickersCount == h.connCfg.Terminal.TickerCommitBuf {
-				select {
-				case h.wsTerTickers <- cd.terTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTickersCount = 0
-				cd.terTickers = nil
-			}
+		ticker.Base = val.base
+		ticker.Quote = val.quote
+		if cd.filterTicker(&ticker, key, val.tickFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTickersCount++
-			cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-			if cd.mysqlTickersCount == h.connCfg.MySQL.TickerCommitBuf {
-				select {
-				case h.wsMysqlTickers <- cd.mysqlTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTickersCount = 0
-				cd.mysqlTickers = nil
-			}
+		if !ticker.IsBadTick {
+			ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+			alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+			arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 		}
-		if val.esStr {
-			cd.esTickersCount++
-			cd.esTickers = append(cd.esTickers, ticker)
-			if cd.esTickersCount == h.connCfg.ES.TickerCommitBuf {
-				select {
-				case h.wsEsTickers <- cd.esTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTickersCount = 0
-				cd.esTickers = nil
-			}
+		if err := cd.wsTicker(ctx, key, &val, ticker); err != nil {
+			return err
 		}
 	case "trade":
 		for _, data := range wr.Tick.TradeData {
@@ -495,142 +421,48 @@ func (h *huobi) processWs(ctx context.Context, wr *respHuobi, cd *commitData) er
 
 			key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 			val := h.cfgMap[key]
-			if val.terStr {
-				cd.terTradesCount++
-				cd.terTrades = append(cd.terTrades, trade)
-				if cd.terTradesCount == h.connCfg.Terminal.TradeCommitBuf {
-					select {
-					case h.wsTerTrades <- cd.terTrades:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-					cd.terTradesCount = 0
-					cd.terTrades = nil
-				}
+			if filterTradeRules(&trade, val.tradeFilter) {
+				continue
 			}
-			if val.mysqlStr {
-				cd.mysqlTradesCount++
-				cd.mysqlTrades = append(cd.mysqlTrades, trade)
-				if cd.mysqlTradesCount == h.connCfg.MySQL.TradeCommitBuf {
-					select {
-					case h.wsMysqlTrades <- cd.mysqlTrades:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-					cd.mysqlTradesCount = 0
-					cd.mysqlTrades = nil
-				}
+			trade.Base = val.base
+			trade.Quote = val.quote
+			if cd.filterTrade(&trade, key, val.tickFilter) {
+				continue
 			}
-			if val.esStr {
-				cd.esTradesCount++
-				cd.esTrades = append(cd.esTrades, trade)
-				if cd.esTradesCount == h.connCfg.ES.TradeCommitBuf {
-					select {
-					case h.wsEsTrades <- cd.esTrades:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-					cd.esTradesCount = 0
-					cd.esTrades = nil
-				}
+			if !trade.IsBadTick {
+				trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+				alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+				arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
 			}
-		}
-	}
-	return nil
-}
-
-func (h *huobi) wsTickersToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-h.wsTerTickers:
-			h.ter.CommitTickers(data)
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
-
-func (h *huobi) wsTradesToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-h.wsTerTrades:
-			h.ter.CommitTrades(data)
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
-
-func (h *huobi) wsTickersToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-h.wsMysqlTickers:
-			err := h.mysql.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+			if err := cd.wsTrade(ctx, key, &val, trade); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
 
-func (h *huobi) wsTradesToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-h.wsMysqlTrades:
-			err := h.mysql.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
+			// Candles are built from the trades, if configured.
+			for _, candle := range cd.addCandleTrade(trade, val.candleIntervals) {
+				if err := cd.wsAggregate(ctx, &val, "candle", candle); err != nil {
+					return err
 				}
-				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
 
-func (h *huobi) wsTickersToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-h.wsEsTickers:
-			err := h.es.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
+			// Rolling average prices are calculated from the trades, if configured.
+			for _, avgPrice := range cd.addAvgPriceTrade(trade, val.avgPriceWindows) {
+				if err := cd.wsAggregate(ctx, &val, "avg_price", avgPrice); err != nil {
+					return err
 				}
-				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
 
-func (h *huobi) wsTradesToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-h.wsEsTrades:
-			err := h.es.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+			// Market stats are aggregated from the trades, if configured.
+			if err := h.marketStats.add(ctx, trade); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
 	}
+	return nil
 }
 
 func (h *huobi) connectRest() error {
-	rest, err := connector.GetREST()
+	rest, err := connector.GetREST("huobi")
 	if err != nil {
 		logErrStack(err)
 		return err
@@ -646,19 +478,14 @@ func (h *huobi) connectRest() error {
 // then sends it to different storage systems for commit through go channels.
 func (h *huobi) processREST(ctx context.Context, mktID string, mktCommitName string, channel string, interval int) error {
 	var (
-		req *http.Request
-		q   url.Values
-		err error
+		req            *http.Request
+		q              url.Values
+		cursor         connector.TradeCursor
+		err            error
+		lastInstrument storage.Instrument
 	)
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, h.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, h.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, h.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, h.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, h.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, h.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	switch channel {
 	case "ticker":
@@ -683,13 +510,21 @@ func (h *huobi) processREST(ctx context.Context, mktID string, mktCommitName str
 		q.Add("symbol", mktID)
 
 		// Querying for 100 trades.
-		// If the configured interval gap is big, then maybe it will not return all the trades
-		// and if the gap is too small, maybe it will return duplicate ones.
+		// Only the latest trades are returned by the endpoint, so the ones received in the earlier poll are skipped.
+		// If the configured interval gap is big, then maybe it will not return all the trades.
 		// Better to use websocket.
 		q.Add("size", strconv.Itoa(100))
+	case "instrument":
+		req, err = h.rest.Request(ctx, "GET", config.HuobiRESTBaseURL+"v1/common/symbols")
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
 	}
 
-	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	tick := connector.NewPollTicker("huobi", time.Duration(interval)*time.Second)
 	defer tick.Stop()
 	for {
 		select {
@@ -719,49 +554,34 @@ func (h *huobi) processREST(ctx context.Context, mktID string, mktCommitName str
 					MktID:         mktID,
 					MktCommitName: mktCommitName,
 					Price:         rr.Tick.TickerPrice,
+					High:          rr.Tick.High,
+					Low:           rr.Tick.Low,
+					Volume:        rr.Tick.Volume,
 					Timestamp:     time.Now().UTC(),
 				}
 
+				// Best bid and ask are sent as [price, size] pairs.
+				if len(rr.Tick.Bid) > 0 {
+					ticker.BestBid = rr.Tick.Bid[0]
+				}
+				if len(rr.Tick.Ask) > 0 {
+					ticker.BestAsk = rr.Tick.Ask[0]
+				}
+
 				key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 				val := h.cfgMap[key]
-				if val.terStr {
-					cd.terTickersCount++
-					cd.terTickers = append(cd.terTickers, ticker)
-					if cd.terTickersCount == h.connCfg.Terminal.TickerCommitBuf {
-						h.ter.CommitTickers(cd.terTickers)
-						cd.terTickersCount = 0
-						cd.terTickers = nil
-					}
+				ticker.Base = val.base
+				ticker.Quote = val.quote
+				if cd.filterTicker(&ticker, key, val.tickFilter) {
+					continue
 				}
-				if val.mysqlStr {
-					cd.mysqlTickersCount++
-					cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-					if cd.mysqlTickersCount == h.connCfg.MySQL.TickerCommitBuf {
-						err := h.mysql.CommitTickers(ctx, cd.mysqlTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.mysqlTickersCount = 0
-						cd.mysqlTickers = nil
-					}
+				if !ticker.IsBadTick {
+					ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+					alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+					arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 				}
-				if val.esStr {
-					cd.esTickersCount++
-					cd.esTickers = append(cd.esTickers, ticker)
-					if cd.esTickersCount == h.connCfg.ES.TickerCommitBuf {
-						err := h.es.CommitTickers(ctx, cd.esTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.esTickersCount = 0
-						cd.esTickers = nil
-					}
+				if err := cd.restTicker(ctx, &val, ticker); err != nil {
+					return err
 				}
 			case "trade":
 				req.URL.RawQuery = q.Encode()
@@ -800,48 +620,98 @@ func (h *huobi) processREST(ctx context.Context, mktID string, mktCommitName str
 							Timestamp:     timestamp,
 						}
 
+						if !cursor.New(restTradeKey(&trade), trade.Timestamp) {
+							continue
+						}
+
 						key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 						val := h.cfgMap[key]
-						if val.terStr {
-							cd.terTradesCount++
-							cd.terTrades = append(cd.terTrades, trade)
-							if cd.terTradesCount == h.connCfg.Terminal.TradeCommitBuf {
-								h.ter.CommitTrades(cd.terTrades)
-								cd.terTradesCount = 0
-								cd.terTrades = nil
-							}
+						if filterTradeRules(&trade, val.tradeFilter) {
+							continue
 						}
-						if val.mysqlStr {
-							cd.mysqlTradesCount++
-							cd.mysqlTrades = append(cd.mysqlTrades, trade)
-							if cd.mysqlTradesCount == h.connCfg.MySQL.TradeCommitBuf {
-								err := h.mysql.CommitTrades(ctx, cd.mysqlTrades)
-								if err != nil {
-									if !errors.Is(err, ctx.Err()) {
-										logErrStack(err)
-									}
-									return err
-								}
-								cd.mysqlTradesCount = 0
-								cd.mysqlTrades = nil
-							}
+						trade.Base = val.base
+						trade.Quote = val.quote
+						if cd.filterTrade(&trade, key, val.tickFilter) {
+							continue
 						}
-						if val.esStr {
-							cd.esTradesCount++
-							cd.esTrades = append(cd.esTrades, trade)
-							if cd.esTradesCount == h.connCfg.ES.TradeCommitBuf {
-								err := h.es.CommitTrades(ctx, cd.esTrades)
-								if err != nil {
-									if !errors.Is(err, ctx.Err()) {
-										logErrStack(err)
-									}
-									return err
-								}
-								cd.esTradesCount = 0
-								cd.esTrades = nil
-							}
+						if !trade.IsBadTick {
+							trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+							alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+							arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
 						}
+						if err := cd.restTrade(ctx, &val, trade); err != nil {
+							return err
+						}
+					}
+				}
+				cursor.Next(len(rr.RESTTradeData))
+			case "instrument":
+				resp, err := h.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
 					}
+					return err
+				}
+
+				rr := restInstrumentRespHuobi{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				// Exchange returns all the markets, so the configured one is picked.
+				var symbol restInstrumentDataHuobi
+				found := false
+				for _, s := range rr.Data {
+					if s.Symbol == mktID {
+						symbol = s
+						found = true
+						break
+					}
+				}
+				if !found {
+					err = errors.New("market info is not returned by exchange")
+					logErrStack(err)
+					return err
+				}
+
+				// Exchange specific status values are converted to a common format.
+				var status string
+				switch symbol.State {
+				case "online":
+					status = "trading"
+				case "offline", "suspend":
+					status = "halted"
+				default:
+					status = symbol.State
+				}
+
+				// Exchange gives only the precision, so increments are derived from it.
+				instrument := storage.Instrument{
+					Exchange:       "huobi",
+					MktID:          mktID,
+					MktCommitName:  mktCommitName,
+					TickSize:       math.Pow10(-symbol.PricePrecision),
+					LotSize:        math.Pow10(-symbol.AmountPrecision),
+					PricePrecision: symbol.PricePrecision,
+					SizePrecision:  symbol.AmountPrecision,
+					Status:         status,
+				}
+
+				// Only the changes are stored, first one being the metadata at the start.
+				if instrument == lastInstrument {
+					continue
+				}
+				lastInstrument = instrument
+				instrument.Timestamp = time.Now().UTC()
+
+				key := cfgLookupKey{market: instrument.MktID, channel: "instrument"}
+				val := h.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "instrument", instrument); err != nil {
+					return err
 				}
 			}
 
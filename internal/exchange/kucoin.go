@@ -2,7 +2,6 @@ package exchange
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -12,9 +11,12 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/arbitrage"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
 	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -22,61 +24,21 @@ import (
 
 // StartKucoin is for starting kucoin exchange functions.
 func StartKucoin(appCtx context.Context, markets []config.Market, retry *config.Retry, connCfg *config.Connection) error {
-
-	// If any error occurs or connection is lost, retry the exchange functions with a time gap till it reaches
-	// a configured number of retry.
-	// Retry counter will be reset back to zero if the elapsed time since the last retry is greater than the configured one.
-	var retryCount int
-	lastRetryTime := time.Now()
-
-	for {
-		err := newKucoin(appCtx, markets, connCfg)
-		if err != nil {
-			log.Error().Err(err).Str("exchange", "kucoin").Msg("error occurred")
-			if retry.Number == 0 {
-				return errors.New("not able to connect kucoin exchange. please check the log for details")
-			}
-			if retry.ResetSec == 0 || time.Since(lastRetryTime).Seconds() < float64(retry.ResetSec) {
-				retryCount++
-			} else {
-				retryCount = 1
-			}
-			lastRetryTime = time.Now()
-			if retryCount > retry.Number {
-				return fmt.Errorf("not able to connect kucoin exchange even after %v retry. please check the log for details", retry.Number)
-			}
-
-			log.Error().Str("exchange", "kucoin").Int("retry", retryCount).Msg(fmt.Sprintf("retrying functions in %v seconds", retry.GapSec))
-			tick := time.NewTicker(time.Duration(retry.GapSec) * time.Second)
-			select {
-			case <-tick.C:
-				tick.Stop()
-
-			// Return, if there is any error from another exchange.
-			case <-appCtx.Done():
-				log.Error().Str("exchange", "kucoin").Msg("ctx canceled, return from StartKucoin")
-				return appCtx.Err()
-			}
-		}
-	}
+	return supervisor.Run(appCtx, "kucoin", retry, func() error {
+		return newKucoin(appCtx, markets, connCfg)
+	})
 }
 
 type kucoin struct {
-	ws             connector.Websocket
-	rest           *connector.REST
-	connCfg        *config.Connection
-	cfgMap         map[cfgLookupKey]cfgLookupVal
-	channelIds     map[int][2]string
-	ter            *storage.Terminal
-	es             *storage.ElasticSearch
-	mysql          *storage.MySQL
-	wsTerTickers   chan []storage.Ticker
-	wsTerTrades    chan []storage.Trade
-	wsMysqlTickers chan []storage.Ticker
-	wsMysqlTrades  chan []storage.Trade
-	wsEsTickers    chan []storage.Ticker
-	wsEsTrades     chan []storage.Trade
-	wsPingIntSec   uint64
+	ws           connector.Websocket
+	rest         *connector.REST
+	connCfg      *config.Connection
+	cfgMap       map[cfgLookupKey]cfgLookupVal
+	strs         strCommits
+	marketStats  *marketStats
+	candleCheck  *candleCheck
+	channelIds   map[int][2]string
+	wsPingIntSec uint64
 }
 
 type wsSubKucoin struct {
@@ -100,14 +62,49 @@ type restRespKucoin struct {
 	Data []respDataKucoin `json:"data"`
 }
 
+type restBookRespKucoin struct {
+	Data restBookDataKucoin `json:"data"`
+}
+
+type restBookDataKucoin struct {
+	Bids [][]string `json:"bids"`
+	Asks [][]string `json:"asks"`
+}
+
+type restInstrumentRespKucoin struct {
+	Data []restInstrumentDataKucoin `json:"data"`
+}
+
+type restInstrumentDataKucoin struct {
+	Symbol         string `json:"symbol"`
+	BaseIncrement  string `json:"baseIncrement"`
+	PriceIncrement string `json:"priceIncrement"`
+	EnableTrading  bool   `json:"enableTrading"`
+}
+
 type respDataKucoin struct {
-	TradeID string      `json:"tradeId"`
-	Side    string      `json:"side"`
-	Size    string      `json:"size"`
-	Price   string      `json:"price"`
-	Time    interface{} `json:"time"`
+	TradeID     string      `json:"tradeId"`
+	Side        string      `json:"side"`
+	Size        string      `json:"size"`
+	Price       string      `json:"price"`
+	BestBid     string      `json:"bestBid"`
+	BestAsk     string      `json:"bestAsk"`
+	Time        interface{} `json:"time"`
+	BestBidSize string      `json:"bestBidSize"`
+	BestAskSize string      `json:"bestAskSize"`
+	Bids        []string    `json:"bids"`
+	Asks        []string    `json:"asks"`
+	Timestamp   int64       `json:"timestamp"`
 }
 
+// kucoinWsRenewAfter is the time after which the websocket connection is renewed with a new token,
+// ahead of its 24 hours validity, after which the connection is closed by the exchange.
+// On a failure, renewal is retried after kucoinWsRenewRetry till the connection is closed.
+const (
+	kucoinWsRenewAfter = 23 * time.Hour
+	kucoinWsRenewRetry = time.Minute
+)
+
 type wsConnectRespKucoin struct {
 	Code string `json:"code"`
 	Data struct {
@@ -131,11 +128,11 @@ func newKucoin(appCtx context.Context, markets []config.Market, connCfg *config.
 	if err != nil {
 		return err
 	}
+	k.marketStats = newMarketStats("kucoin", k.cfgMap)
 
 	var (
 		wsCount   int
 		restCount int
-		threshold int
 	)
 
 	for _, market := range markets {
@@ -157,34 +154,36 @@ func newKucoin(appCtx context.Context, markets []config.Market, connCfg *config.
 						return k.pingWs(ctx)
 					})
 
+					kucoinErrGroup.Go(func() error {
+						return k.renewWs(ctx)
+					})
+
 					kucoinErrGroup.Go(func() error {
 						return k.readWs(ctx)
 					})
 
-					if k.ter != nil {
-						kucoinErrGroup.Go(func() error {
-							return k.wsTickersToTerminal(ctx)
-						})
+					if k.marketStats != nil {
 						kucoinErrGroup.Go(func() error {
-							return k.wsTradesToTerminal(ctx)
+							return k.marketStats.run(ctx)
 						})
 					}
 
-					if k.mysql != nil {
+					for _, str := range k.strs {
+						str := str
 						kucoinErrGroup.Go(func() error {
-							return k.wsTickersToMySQL(ctx)
+							return str.wsTickers(ctx)
 						})
 						kucoinErrGroup.Go(func() error {
-							return k.wsTradesToMySQL(ctx)
+							return str.wsTrades(ctx)
 						})
-					}
-
-					if k.es != nil {
 						kucoinErrGroup.Go(func() error {
-							return k.wsTickersToES(ctx)
+							return str.wsRecords(ctx)
 						})
+					}
+
+					if k.candleCheck != nil {
 						kucoinErrGroup.Go(func() error {
-							return k.wsTradesToES(ctx)
+							return k.candleCheck.run(ctx)
 						})
 					}
 				}
@@ -198,15 +197,8 @@ func newKucoin(appCtx context.Context, markets []config.Market, connCfg *config.
 
 				wsCount++
 
-				// Maximum messages sent to a websocket connection per 10 sec is 100.
-				// So on a safer side, this will wait for 20 sec before proceeding once it reaches ~90% of the limit.
-				// (including 1 ping message so 90-1)
-				threshold++
-				if threshold == 89 {
-					log.Debug().Str("exchange", "kucoin").Int("count", threshold).Msg("subscribe threshold reached, waiting 20 sec")
-					time.Sleep(20 * time.Second)
-					threshold = 0
-				}
+				// Maximum messages sent to a websocket connection per 10 sec is 100,
+				// which is honoured by the rate limiter of the websocket connector.
 
 			case "rest":
 				if restCount == 0 {
@@ -246,6 +238,7 @@ func (k *kucoin) cfgLookup(markets []config.Market) error {
 
 	// Configurations flat map is prepared for easy lookup later in the app.
 	k.cfgMap = make(map[cfgLookupKey]cfgLookupVal)
+	k.strs = make(strCommits)
 	k.channelIds = make(map[int][2]string)
 	for _, market := range markets {
 		var marketCommitName string
@@ -258,31 +251,21 @@ func (k *kucoin) cfgLookup(markets []config.Market) error {
 			key := cfgLookupKey{market: market.ID, channel: info.Channel}
 			val := cfgLookupVal{}
 			val.wsConsiderIntSec = info.WsConsiderIntSec
-			for _, str := range info.Storages {
-				switch str {
-				case "terminal":
-					val.terStr = true
-					if k.ter == nil {
-						k.ter = storage.GetTerminal()
-						k.wsTerTickers = make(chan []storage.Ticker, 1)
-						k.wsTerTrades = make(chan []storage.Trade, 1)
-					}
-				case "mysql":
-					val.mysqlStr = true
-					if k.mysql == nil {
-						k.mysql = storage.GetMySQL()
-						k.wsMysqlTickers = make(chan []storage.Ticker, 1)
-						k.wsMysqlTrades = make(chan []storage.Trade, 1)
-					}
-				case "elastic_search":
-					val.esStr = true
-					if k.es == nil {
-						k.es = storage.GetElasticSearch()
-						k.wsEsTickers = make(chan []storage.Ticker, 1)
-						k.wsEsTrades = make(chan []storage.Trade, 1)
-					}
+			val.strConsiderIntSec = info.StrConsiderIntSec
+			val.strs = k.strs.lookup(info.Storages)
+			val.candleIntervals = candleIntervals(info.CandleIntervals)
+			if info.CandleValidation != nil {
+				val.candleValidation = info.CandleValidation
+				if k.candleCheck == nil {
+					k.candleCheck = newCandleCheck("kucoin")
 				}
 			}
+			val.avgPriceWindows = candleIntervals(info.AvgPriceWindows)
+			val.statsInterval = time.Duration(info.StatsIntervalSec) * time.Second
+			val.tickFilter = newTickFilter(info.TickFilter)
+			val.base, val.quote = marketAssets(market)
+			val.tradeFilter = info.TradeFilter
+			val.bookLevels = bookLevels(info.BookLevels)
 
 			// Channel id is used to identify channel in subscribe success message of websocket server.
 			id++
@@ -297,32 +280,13 @@ func (k *kucoin) cfgLookup(markets []config.Market) error {
 }
 
 func (k *kucoin) connectWs(ctx context.Context) error {
-
-	// Do a REST POST request to get the websocket server details.
-	resp, err := http.Post(config.KucoinRESTBaseURL+"bullet-public", "", nil)
+	r, err := k.wsServer(ctx)
 	if err != nil {
-		if !errors.Is(err, ctx.Err()) {
-			logErrStack(err)
-		}
-		return err
-	}
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("code : %v, status : %v", resp.StatusCode, resp.Status)
-	}
-
-	r := wsConnectRespKucoin{}
-	if err = jsoniter.NewDecoder(resp.Body).Decode(&r); err != nil {
-		logErrStack(err)
-		resp.Body.Close()
 		return err
 	}
-	resp.Body.Close()
-	if r.Code != "200000" || len(r.Data.Instanceservers) < 1 {
-		return errors.New("not able to get websocket server details")
-	}
 
 	// Connect to websocket.
-	ws, err := connector.NewWebsocket(ctx, &k.connCfg.WS, r.Data.Instanceservers[0].Endpoint+"?token="+r.Data.Token)
+	ws, err := connector.NewWebsocket(ctx, &k.connCfg.WS, "kucoin", r.Data.Instanceservers[0].Endpoint+"?token="+r.Data.Token)
 	if err != nil {
 		if !errors.Is(err, ctx.Err()) {
 			logErrStack(err)
@@ -343,26 +307,93 @@ func (k *kucoin) connectWs(ctx context.Context) error {
 		}
 		return err
 	}
+	if err = k.checkWelcome(frame); err != nil {
+		return err
+	}
+	k.wsPingIntSec = uint64(r.Data.Instanceservers[0].PingintervalMilli) / 1000
+	log.Info().Str("exchange", "kucoin").Msg("websocket connected")
+	return nil
+}
+
+// wsServer does a REST POST request to get the websocket server details, along with a new token to connect.
+func (k *kucoin) wsServer(ctx context.Context) (wsConnectRespKucoin, error) {
+	r := wsConnectRespKucoin{}
+	rest, err := connector.GetREST("kucoin")
+	if err != nil {
+		logErrStack(err)
+		return r, err
+	}
+	req, err := rest.Request(ctx, "POST", config.KucoinRESTBaseURL+"bullet-public")
+	if err != nil {
+		logErrStack(err)
+		return r, err
+	}
+	resp, err := rest.Do(req)
+	if err != nil {
+		if !errors.Is(err, ctx.Err()) {
+			logErrStack(err)
+		}
+		return r, err
+	}
+
+	if err = jsoniter.NewDecoder(resp.Body).Decode(&r); err != nil {
+		logErrStack(err)
+		resp.Body.Close()
+		return r, err
+	}
+	resp.Body.Close()
+	if r.Code != "200000" || len(r.Data.Instanceservers) < 1 {
+		return r, errors.New("not able to get websocket server details")
+	}
+	return r, nil
+}
+
+// checkWelcome checks the first frame of the websocket connection, which should be the welcome message.
+func (k *kucoin) checkWelcome(frame []byte) error {
 	if len(frame) == 0 {
 		return errors.New("not able to connect websocket server")
 	}
 
 	wr := respKucoin{}
-	err = jsoniter.Unmarshal(frame, &wr)
+	err := jsoniter.Unmarshal(frame, &wr)
 	if err != nil {
 		logErrStack(err)
 		return err
 	}
-
-	if wr.Type == "welcome" {
-		k.wsPingIntSec = uint64(r.Data.Instanceservers[0].PingintervalMilli) / 1000
-		log.Info().Str("exchange", "kucoin").Msg("websocket connected")
-	} else {
+	if wr.Type != "welcome" {
 		return errors.New("not able to connect websocket server")
 	}
 	return nil
 }
 
+// renewWs renews the websocket connection with a new token before the current one expires,
+// instead of letting the exchange close the connection, which restarts all the exchange functions.
+// New connection is subscribed to all the channels before replacing the current one, so no data is missed.
+func (k *kucoin) renewWs(ctx context.Context) error {
+	timer := time.NewTimer(kucoinWsRenewAfter)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			r, err := k.wsServer(ctx)
+			if err == nil {
+				err = k.ws.Renew(r.Data.Instanceservers[0].Endpoint+"?token="+r.Data.Token, k.checkWelcome)
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Warn().Str("exchange", "kucoin").Err(err).Dur("retry_after", kucoinWsRenewRetry).Msg("websocket renewal failed")
+				timer.Reset(kucoinWsRenewRetry)
+				continue
+			}
+			timer.Reset(kucoinWsRenewAfter)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 // closeWsConnOnError closes websocket connection if there is any error in app context.
 // This will unblock all read and writes on websocket.
 func (k *kucoin) closeWsConnOnError(ctx context.Context) error {
@@ -412,6 +443,8 @@ func (k *kucoin) subWsChannel(market string, channel string, id int) error {
 		channel = "/market/ticker:" + market
 	case "trade":
 		channel = "/market/match:" + market
+	case "bbo":
+		channel = "/spotMarket/level1:" + market
 	}
 	sub := wsSubKucoin{
 		ID:             id,
@@ -425,7 +458,7 @@ func (k *kucoin) subWsChannel(market string, channel string, id int) error {
 		logErrStack(err)
 		return err
 	}
-	err = k.ws.Write(frame)
+	err = k.ws.Subscribe(frame)
 	if err != nil {
 		if errors.Is(err, net.ErrClosed) {
 			err = errors.New("context canceled")
@@ -446,14 +479,7 @@ func (k *kucoin) readWs(ctx context.Context) error {
 		cfgLookup[k] = v
 	}
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, k.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, k.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, k.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, k.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, k.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, k.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	for {
 		select {
@@ -496,15 +522,18 @@ func (k *kucoin) readWs(ctx context.Context) error {
 				if len(s) < 2 {
 					continue
 				}
-				if s[0] == "/market/ticker" {
+				switch s[0] {
+				case "/market/ticker":
 					wr.Topic = "ticker"
-				} else {
+				case "/spotMarket/level1":
+					wr.Topic = "bbo"
+				default:
 					wr.Topic = "trade"
 				}
 
 				// Consider frame only in configured interval, otherwise ignore it.
 				switch wr.Topic {
-				case "ticker", "trade":
+				case "ticker", "trade", "bbo":
 					key := cfgLookupKey{market: s[1], channel: wr.Topic}
 					val := cfgLookup[key]
 					if val.wsConsiderIntSec == 0 || time.Since(val.wsLastUpdated).Seconds() >= float64(val.wsConsiderIntSec) {
@@ -548,48 +577,83 @@ func (k *kucoin) processWs(ctx context.Context, wr *respKucoin, cd *commitData)
 			return err
 		}
 		ticker.Price = price
+
+		bestBid, err := strconv.ParseFloat(wr.Data.BestBid, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		ticker.BestBid = bestBid
+
+		bestAsk, err := strconv.ParseFloat(wr.Data.BestAsk, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		ticker.BestAsk = bestAsk
 		ticker.Timestamp = time.Now().UTC()
 
 		key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 		val := k.cfgMap[key]
-		if val.terStr {
-			cd.terTickersCount++
-			cd.terTickers = append(cd.terTickers, ticker)
-			if cd.terTickersCount == k.connCfg.Terminal.TickerCommitBuf {
-				select {
-				case k.wsTerTickers <- cd.terTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTickersCount = 0
-				cd.terTickers = nil
-			}
+		ticker.Base = val.base
+		ticker.Quote = val.quote
+		if cd.filterTicker(&ticker, key, val.tickFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTickersCount++
-			cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-			if cd.mysqlTickersCount == k.connCfg.MySQL.TickerCommitBuf {
-				select {
-				case k.wsMysqlTickers <- cd.mysqlTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTickersCount = 0
-				cd.mysqlTickers = nil
-			}
+		if !ticker.IsBadTick {
+			ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+			alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+			arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 		}
-		if val.esStr {
-			cd.esTickersCount++
-			cd.esTickers = append(cd.esTickers, ticker)
-			if cd.esTickersCount == k.connCfg.ES.TickerCommitBuf {
-				select {
-				case k.wsEsTickers <- cd.esTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTickersCount = 0
-				cd.esTickers = nil
-			}
+		if err := cd.wsTicker(ctx, key, &val, ticker); err != nil {
+			return err
+		}
+	case "bbo":
+		bbo := storage.BBO{}
+		bbo.Exchange = "kucoin"
+		bbo.MktID = wr.mktID
+		bbo.MktCommitName = wr.mktCommitName
+
+		// Best bid and ask are sent as [price, size] string pairs.
+		if len(wr.Data.Bids) < 2 || len(wr.Data.Asks) < 2 {
+			return nil
+		}
+
+		bidPrice, err := strconv.ParseFloat(wr.Data.Bids[0], 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		bbo.BidPrice = bidPrice
+
+		bidSize, err := strconv.ParseFloat(wr.Data.Bids[1], 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		bbo.BidSize = bidSize
+
+		askPrice, err := strconv.ParseFloat(wr.Data.Asks[0], 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		bbo.AskPrice = askPrice
+
+		askSize, err := strconv.ParseFloat(wr.Data.Asks[1], 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		bbo.AskSize = askSize
+
+		// Time sent is in milliseconds.
+		bbo.Timestamp = time.Unix(0, wr.Data.Timestamp*int64(time.Millisecond)).UTC()
+
+		key := cfgLookupKey{market: bbo.MktID, channel: "bbo"}
+		val := k.cfgMap[key]
+		if err := cd.wsRecord(ctx, key, &val, "bbo", bbo); err != nil {
+			return err
 		}
 	case "trade":
 		trade := storage.Trade{}
@@ -628,141 +692,48 @@ func (k *kucoin) processWs(ctx context.Context, wr *respKucoin, cd *commitData)
 
 		key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 		val := k.cfgMap[key]
-		if val.terStr {
-			cd.terTradesCount++
-			cd.terTrades = append(cd.terTrades, trade)
-			if cd.terTradesCount == k.connCfg.Terminal.TradeCommitBuf {
-				select {
-				case k.wsTerTrades <- cd.terTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTradesCount = 0
-				cd.terTrades = nil
-			}
+		if filterTradeRules(&trade, val.tradeFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTradesCount++
-			cd.mysqlTrades = append(cd.mysqlTrades, trade)
-			if cd.mysqlTradesCount == k.connCfg.MySQL.TradeCommitBuf {
-				select {
-				case k.wsMysqlTrades <- cd.mysqlTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTradesCount = 0
-				cd.mysqlTrades = nil
-			}
-		}
-		if val.esStr {
-			cd.esTradesCount++
-			cd.esTrades = append(cd.esTrades, trade)
-			if cd.esTradesCount == k.connCfg.ES.TradeCommitBuf {
-				select {
-				case k.wsEsTrades <- cd.esTrades:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTradesCount = 0
-				cd.esTrades = nil
-			}
+		trade.Base = val.base
+		trade.Quote = val.quote
+		if cd.filterTrade(&trade, key, val.tickFilter) {
+			return nil
 		}
-	}
-	return nil
-}
-
-func (k *kucoin) wsTickersToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-k.wsTerTickers:
-			k.ter.CommitTickers(data)
-		case <-ctx.Done():
-			return ctx.Err()
+		if !trade.IsBadTick {
+			trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+			alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+			arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
 		}
-	}
-}
-
-func (k *kucoin) wsTradesToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-k.wsTerTrades:
-			k.ter.CommitTrades(data)
-		case <-ctx.Done():
-			return ctx.Err()
+		if err := cd.wsTrade(ctx, key, &val, trade); err != nil {
+			return err
 		}
-	}
-}
 
-func (k *kucoin) wsTickersToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-k.wsMysqlTickers:
-			err := k.mysql.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Candles are built from the trades, if configured.
+		for _, candle := range cd.addCandleTrade(trade, val.candleIntervals) {
+			if err := cd.wsAggregate(ctx, &val, "candle", candle); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
+			k.candleCheck.add(candle, val.candleValidation)
 		}
-	}
-}
 
-func (k *kucoin) wsTradesToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-k.wsMysqlTrades:
-			err := k.mysql.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+		// Rolling average prices are calculated from the trades, if configured.
+		for _, avgPrice := range cd.addAvgPriceTrade(trade, val.avgPriceWindows) {
+			if err := cd.wsAggregate(ctx, &val, "avg_price", avgPrice); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	}
-}
 
-func (k *kucoin) wsTickersToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-k.wsEsTickers:
-			err := k.es.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
-
-func (k *kucoin) wsTradesToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-k.wsEsTrades:
-			err := k.es.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
-				return err
-			}
-		case <-ctx.Done():
-			return ctx.Err()
+		// Market stats are aggregated from the trades, if configured.
+		if err := k.marketStats.add(ctx, trade); err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 func (k *kucoin) connectRest() error {
-	rest, err := connector.GetREST()
+	rest, err := connector.GetREST("kucoin")
 	if err != nil {
 		logErrStack(err)
 		return err
@@ -778,19 +749,14 @@ func (k *kucoin) connectRest() error {
 // then sends it to different storage systems for commit through go channels.
 func (k *kucoin) processREST(ctx context.Context, mktID string, mktCommitName string, channel string, interval int) error {
 	var (
-		req *http.Request
-		q   url.Values
-		err error
+		req            *http.Request
+		q              url.Values
+		cursor         connector.TradeCursor
+		err            error
+		lastInstrument storage.Instrument
 	)
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, k.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, k.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, k.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, k.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, k.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, k.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	switch channel {
 	case "ticker":
@@ -803,6 +769,16 @@ func (k *kucoin) processREST(ctx context.Context, mktID string, mktCommitName st
 		}
 		q = req.URL.Query()
 		q.Add("symbol", mktID)
+	case "bbo":
+		req, err = k.rest.Request(ctx, "GET", config.KucoinRESTBaseURL+"market/orderbook/level1")
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
+		q = req.URL.Query()
+		q.Add("symbol", mktID)
 	case "trade":
 		req, err = k.rest.Request(ctx, "GET", config.KucoinRESTBaseURL+"market/histories")
 		if err != nil {
@@ -815,12 +791,36 @@ func (k *kucoin) processREST(ctx context.Context, mktID string, mktCommitName st
 		q.Add("symbol", mktID)
 
 		// Returns 100 trades.
-		// If the configured interval gap is big, then maybe it will not return all the trades
-		// and if the gap is too small, maybe it will return duplicate ones.
+		// Only the latest trades are returned by the endpoint, so the ones received in the earlier poll are skipped.
+		// If the configured interval gap is big, then maybe it will not return all the trades.
 		// Better to use websocket.
+	case "instrument":
+		req, err = k.rest.Request(ctx, "GET", config.KucoinRESTBaseURL+"symbols")
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
+	case "book_metric":
+
+		// Partial order book is available only with 20 or 100 levels.
+		endpoint := "market/orderbook/level2_20"
+		if maxBookLevel(k.cfgMap[cfgLookupKey{market: mktID, channel: "book_metric"}].bookLevels) > 20 {
+			endpoint = "market/orderbook/level2_100"
+		}
+		req, err = k.rest.Request(ctx, "GET", config.KucoinRESTBaseURL+endpoint)
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
+		q = req.URL.Query()
+		q.Add("symbol", mktID)
 	}
 
-	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	tick := connector.NewPollTicker("kucoin", time.Duration(interval)*time.Second)
 	defer tick.Stop()
 	for {
 		select {
@@ -851,54 +851,100 @@ func (k *kucoin) processREST(ctx context.Context, mktID string, mktCommitName st
 					return err
 				}
 
+				bestBid, err := strconv.ParseFloat(rr.Data.BestBid, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				bestAsk, err := strconv.ParseFloat(rr.Data.BestAsk, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
 				ticker := storage.Ticker{
 					Exchange:      "kucoin",
 					MktID:         mktID,
 					MktCommitName: mktCommitName,
 					Price:         price,
+					BestBid:       bestBid,
+					BestAsk:       bestAsk,
 					Timestamp:     time.Now().UTC(),
 				}
 
 				key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 				val := k.cfgMap[key]
-				if val.terStr {
-					cd.terTickersCount++
-					cd.terTickers = append(cd.terTickers, ticker)
-					if cd.terTickersCount == k.connCfg.Terminal.TickerCommitBuf {
-						k.ter.CommitTickers(cd.terTickers)
-						cd.terTickersCount = 0
-						cd.terTickers = nil
-					}
+				ticker.Base = val.base
+				ticker.Quote = val.quote
+				if cd.filterTicker(&ticker, key, val.tickFilter) {
+					continue
 				}
-				if val.mysqlStr {
-					cd.mysqlTickersCount++
-					cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-					if cd.mysqlTickersCount == k.connCfg.MySQL.TickerCommitBuf {
-						err := k.mysql.CommitTickers(ctx, cd.mysqlTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.mysqlTickersCount = 0
-						cd.mysqlTickers = nil
-					}
+				if !ticker.IsBadTick {
+					ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+					alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+					arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
+				}
+				if err := cd.restTicker(ctx, &val, ticker); err != nil {
+					return err
 				}
-				if val.esStr {
-					cd.esTickersCount++
-					cd.esTickers = append(cd.esTickers, ticker)
-					if cd.esTickersCount == k.connCfg.ES.TickerCommitBuf {
-						err := k.es.CommitTickers(ctx, cd.esTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.esTickersCount = 0
-						cd.esTickers = nil
+			case "bbo":
+				req.URL.RawQuery = q.Encode()
+				resp, err := k.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
 					}
+					return err
+				}
+
+				rr := respKucoin{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				bidPrice, err := strconv.ParseFloat(rr.Data.BestBid, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				bidSize, err := strconv.ParseFloat(rr.Data.BestBidSize, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				askPrice, err := strconv.ParseFloat(rr.Data.BestAsk, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				askSize, err := strconv.ParseFloat(rr.Data.BestAskSize, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				bbo := storage.BBO{
+					Exchange:      "kucoin",
+					MktID:         mktID,
+					MktCommitName: mktCommitName,
+					BidPrice:      bidPrice,
+					BidSize:       bidSize,
+					AskPrice:      askPrice,
+					AskSize:       askSize,
+					Timestamp:     time.Now().UTC(),
+				}
+
+				key := cfgLookupKey{market: bbo.MktID, channel: "bbo"}
+				val := k.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "bbo", bbo); err != nil {
+					return err
 				}
 			case "trade":
 				req.URL.RawQuery = q.Encode()
@@ -950,46 +996,147 @@ func (k *kucoin) processREST(ctx context.Context, mktID string, mktCommitName st
 						Timestamp:     time.Unix(0, int64(t)*int64(time.Nanosecond)).UTC(),
 					}
 
+					if !cursor.New(restTradeKey(&trade), trade.Timestamp) {
+						continue
+					}
+
 					key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 					val := k.cfgMap[key]
-					if val.terStr {
-						cd.terTradesCount++
-						cd.terTrades = append(cd.terTrades, trade)
-						if cd.terTradesCount == k.connCfg.Terminal.TradeCommitBuf {
-							k.ter.CommitTrades(cd.terTrades)
-							cd.terTradesCount = 0
-							cd.terTrades = nil
-						}
+					if filterTradeRules(&trade, val.tradeFilter) {
+						continue
+					}
+					trade.Base = val.base
+					trade.Quote = val.quote
+					if cd.filterTrade(&trade, key, val.tickFilter) {
+						continue
+					}
+					if !trade.IsBadTick {
+						trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+						alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+						arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
+					}
+					if err := cd.restTrade(ctx, &val, trade); err != nil {
+						return err
+					}
+				}
+				cursor.Next(len(rr.Data))
+			case "instrument":
+				resp, err := k.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
 					}
-					if val.mysqlStr {
-						cd.mysqlTradesCount++
-						cd.mysqlTrades = append(cd.mysqlTrades, trade)
-						if cd.mysqlTradesCount == k.connCfg.MySQL.TradeCommitBuf {
-							err := k.mysql.CommitTrades(ctx, cd.mysqlTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.mysqlTradesCount = 0
-							cd.mysqlTrades = nil
-						}
+					return err
+				}
+
+				rr := restInstrumentRespKucoin{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				// Exchange returns all the markets, so the configured one is picked.
+				var symbol restInstrumentDataKucoin
+				found := false
+				for _, s := range rr.Data {
+					if s.Symbol == mktID {
+						symbol = s
+						found = true
+						break
 					}
-					if val.esStr {
-						cd.esTradesCount++
-						cd.esTrades = append(cd.esTrades, trade)
-						if cd.esTradesCount == k.connCfg.ES.TradeCommitBuf {
-							err := k.es.CommitTrades(ctx, cd.esTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.esTradesCount = 0
-							cd.esTrades = nil
-						}
+				}
+				if !found {
+					err = errors.New("market info is not returned by exchange")
+					logErrStack(err)
+					return err
+				}
+
+				tickSize, err := strconv.ParseFloat(symbol.PriceIncrement, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				lotSize, err := strconv.ParseFloat(symbol.BaseIncrement, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				status := "halted"
+				if symbol.EnableTrading {
+					status = "trading"
+				}
+
+				instrument := storage.Instrument{
+					Exchange:       "kucoin",
+					MktID:          mktID,
+					MktCommitName:  mktCommitName,
+					TickSize:       tickSize,
+					LotSize:        lotSize,
+					PricePrecision: precision(tickSize),
+					SizePrecision:  precision(lotSize),
+					Status:         status,
+				}
+
+				// Only the changes are stored, first one being the metadata at the start.
+				if instrument == lastInstrument {
+					continue
+				}
+				lastInstrument = instrument
+				instrument.Timestamp = time.Now().UTC()
+
+				key := cfgLookupKey{market: instrument.MktID, channel: "instrument"}
+				val := k.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "instrument", instrument); err != nil {
+					return err
+				}
+			case "book_metric":
+				req.URL.RawQuery = q.Encode()
+				resp, err := k.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
+					}
+					return err
+				}
+
+				rr := restBookRespKucoin{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				key := cfgLookupKey{market: mktID, channel: "book_metric"}
+				val := k.cfgMap[key]
+				depth := maxBookLevel(val.bookLevels)
+
+				bids, err := parseBookSide(rr.Data.Bids, depth)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				asks, err := parseBookSide(rr.Data.Asks, depth)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				base := storage.BookMetric{
+					Exchange:      "kucoin",
+					MktID:         mktID,
+					MktCommitName: mktCommitName,
+					Timestamp:     time.Now().UTC(),
+				}
+
+				for _, bookMetric := range bookMetrics(base, bids, asks, val.bookLevels) {
+					if err := cd.restRecord(ctx, &val, "book_metric", bookMetric); err != nil {
+						return err
 					}
 				}
 			}
@@ -0,0 +1,130 @@
+package exchange
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+)
+
+// marketStatsCloseDelay is the time after the end of an interval, after which its stats are closed,
+// so that the trades received a bit late, because of the network or the exchange, are still considered.
+const marketStatsCloseDelay = 2 * time.Second
+
+// marketStats aggregates the market stats from the websocket trades of the markets of an exchange.
+// Stats of each interval are closed and stored on a timer, after the end of the interval,
+// so they are stored on time even for the quiet markets and also for the intervals without any trade, as zero stats.
+// Trades are added by the websocket reader and the stats are closed by a separate go routine, so it is guarded by the mutex.
+type marketStats struct {
+	mu      sync.Mutex
+	markets map[string]*marketStatsMarket
+	cd      commitData
+}
+
+// marketStatsMarket holds the open stats of a market along with its config.
+type marketStatsMarket struct {
+	interval time.Duration
+	val      cfgLookupVal
+	open     storage.MarketStats
+}
+
+// newMarketStats returns the market stats aggregator of the markets of the exchange having the stats interval,
+// nil if there is none.
+func newMarketStats(exchName string, cfgMap map[cfgLookupKey]cfgLookupVal) *marketStats {
+	m := &marketStats{markets: make(map[string]*marketStatsMarket)}
+	start := time.Now()
+	for key, val := range cfgMap {
+		if key.channel != "trade" || val.statsInterval == 0 {
+			continue
+		}
+		m.markets[key.market] = &marketStatsMarket{
+			interval: val.statsInterval,
+			val:      val,
+			open: storage.MarketStats{
+				Exchange:      exchName,
+				MktID:         key.market,
+				MktCommitName: val.mktCommitName,
+				Interval:      intervalName(val.statsInterval),
+				Timestamp:     start.Truncate(val.statsInterval).UTC(),
+			},
+		}
+	}
+	if len(m.markets) == 0 {
+		return nil
+	}
+	return m
+}
+
+// add adds the trade to the open stats of the trade market.
+// Trades of the intervals which are already closed are ignored, same as the ones too far in the future,
+// so that a bad timestamp does not make the stats of all the intervals till then to be stored.
+// A trade of a later interval, e.g. if the exchange clock is a bit ahead of the app one, closes the open stats.
+func (m *marketStats) add(ctx context.Context, trade storage.Trade) error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mkt, ok := m.markets[trade.MktID]
+	if !ok {
+		return nil
+	}
+	start := trade.Timestamp.Truncate(mkt.interval)
+	if start.Before(mkt.open.Timestamp) || start.After(time.Now().Add(marketStatsCloseDelay)) {
+		return nil
+	}
+	if err := m.close(ctx, mkt, start); err != nil {
+		return err
+	}
+	mkt.open.TradeCount++
+	mkt.open.Notional += trade.Price * trade.Size
+	switch trade.Side {
+	case "buy":
+		mkt.open.BuyVolume += trade.Size
+	case "sell":
+		mkt.open.SellVolume += trade.Size
+	}
+	return nil
+}
+
+// run closes the stats of the markets at the end of each interval, till the context is cancelled.
+// Intervals are of whole seconds, so they are checked every second.
+func (m *marketStats) run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.mu.Lock()
+			for _, mkt := range m.markets {
+				if err := m.close(ctx, mkt, now.Add(-marketStatsCloseDelay)); err != nil {
+					m.mu.Unlock()
+					return err
+				}
+			}
+			m.mu.Unlock()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// close stores the open stats of the market and the ones of the following intervals, empty,
+// till the interval containing the time is the open one.
+// It should be called with the mutex held.
+func (m *marketStats) close(ctx context.Context, mkt *marketStatsMarket, until time.Time) error {
+	for !mkt.open.Timestamp.Add(mkt.interval).After(until) {
+		if err := m.cd.wsAggregate(ctx, &mkt.val, "market_stats", mkt.open); err != nil {
+			return err
+		}
+		mkt.open = storage.MarketStats{
+			Exchange:      mkt.open.Exchange,
+			MktID:         mkt.open.MktID,
+			MktCommitName: mkt.open.MktCommitName,
+			Interval:      mkt.open.Interval,
+			Timestamp:     mkt.open.Timestamp.Add(mkt.interval),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package exchange
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+)
+
+// statsStorage is a storage committing the market stats, which are sent for commit on each record.
+type statsStorage struct{}
+
+func (statsStorage) CommitTickers(_ context.Context, _ []storage.Ticker) error { return nil }
+
+func (statsStorage) CommitTrades(_ context.Context, _ []storage.Trade) error { return nil }
+
+func (statsStorage) CommitMarketStats(_ context.Context, _ []storage.MarketStats) error { return nil }
+
+// TestMarketStats tests the stats of the market stored for each closed interval, including the empty ones,
+// and that they are not built without a stats interval configured.
+func TestMarketStats(t *testing.T) {
+	stats := func(start time.Duration, count int64, buy, sell, notional float64) storage.MarketStats {
+		return storage.MarketStats{
+			Exchange:      "test",
+			MktID:         "BTC-USDT",
+			MktCommitName: "BTC/USDT",
+			Interval:      "1m",
+			TradeCount:    count,
+			BuyVolume:     buy,
+			SellVolume:    sell,
+			Notional:      notional,
+			Timestamp:     testStart.Add(start),
+		}
+	}
+	tests := []struct {
+		name   string
+		trades []storage.Trade
+		until  time.Duration
+		want   []storage.MarketStats
+	}{
+		{
+			name:   "open interval not stored",
+			trades: []storage.Trade{testTrade(10*time.Second, "buy", 1, 100)},
+			until:  59 * time.Second,
+		},
+		{
+			name: "trades of interval",
+			trades: []storage.Trade{
+				testTrade(10*time.Second, "buy", 1, 100),
+				testTrade(20*time.Second, "sell", 2, 101),
+				testTrade(30*time.Second, "buy", 0.5, 102),
+			},
+			until: time.Minute,
+			want:  []storage.MarketStats{stats(0, 3, 1.5, 2, 353)},
+		},
+		{
+			name:  "empty intervals",
+			until: 3 * time.Minute,
+			want:  []storage.MarketStats{stats(0, 0, 0, 0, 0), stats(time.Minute, 0, 0, 0, 0), stats(2*time.Minute, 0, 0, 0, 0)},
+		},
+		{
+			name: "closed by trade of later interval",
+			trades: []storage.Trade{
+				testTrade(10*time.Second, "buy", 1, 100),
+				testTrade(2*time.Minute+5*time.Second, "sell", 1, 100),
+			},
+			want: []storage.MarketStats{stats(0, 1, 1, 0, 100), stats(time.Minute, 0, 0, 0, 0)},
+		},
+		{
+			name: "late trade ignored",
+			trades: []storage.Trade{
+				testTrade(time.Minute+5*time.Second, "buy", 1, 100),
+				testTrade(10*time.Second, "buy", 1, 200),
+			},
+			until: 2 * time.Minute,
+			want:  []storage.MarketStats{stats(0, 0, 0, 0, 0), stats(time.Minute, 1, 1, 0, 100)},
+		},
+		{
+			name: "other market ignored",
+			trades: []storage.Trade{
+				{Exchange: "test", MktID: "ETH-USDT", Side: "buy", Size: 1, Price: 10, Timestamp: testStart.Add(time.Second)},
+			},
+			until: time.Minute,
+			want:  []storage.MarketStats{stats(0, 0, 0, 0, 0)},
+		},
+		{
+			name: "future trade ignored",
+			trades: []storage.Trade{
+				{Exchange: "test", MktID: "BTC-USDT", Side: "buy", Size: 1, Price: 10, Timestamp: time.Now().Add(time.Hour)},
+			},
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		str := &strCommit{
+			Registered: &storage.Registered{
+				Name:             "test",
+				Storage:          statsStorage{},
+				RecordCommitBufs: map[string]int{"market_stats": 1},
+			},
+			records:    make(chan recordBatch, 16),
+			recordBufs: make(map[string][]interface{}),
+		}
+		m := newMarketStats("test", map[cfgLookupKey]cfgLookupVal{
+			{market: "BTC-USDT", channel: "trade"}:  {mktCommitName: "BTC/USDT", statsInterval: time.Minute, strs: []*strCommit{str}},
+			{market: "BTC-USDT", channel: "ticker"}: {mktCommitName: "BTC/USDT", strs: []*strCommit{str}},
+		})
+		mkt := m.markets["BTC-USDT"]
+		mkt.open.Timestamp = testStart
+		for _, trade := range tt.trades {
+			if err := m.add(ctx, trade); err != nil {
+				t.Log("ERROR : " + err.Error())
+				t.FailNow()
+			}
+		}
+		if tt.until > 0 {
+			if err := m.close(ctx, mkt, testStart.Add(tt.until)); err != nil {
+				t.Log("ERROR : " + err.Error())
+				t.FailNow()
+			}
+		}
+
+		var got []storage.MarketStats
+		close(str.records)
+		for batch := range str.records {
+			for _, record := range batch.data {
+				got = append(got, record.(storage.MarketStats))
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Logf("ERROR : %s : stored stats %+v, expected %+v", tt.name, got, tt.want)
+			t.Error("FAILURE : market stats")
+		}
+	}
+
+	m := newMarketStats("test", map[cfgLookupKey]cfgLookupVal{
+		{market: "BTC-USDT", channel: "ticker"}: {},
+		{market: "BTC-USDT", channel: "trade"}:  {},
+	})
+	if m != nil {
+		t.Log("ERROR : market stats built without a stats interval")
+		t.Error("FAILURE : market stats")
+	}
+	if err := m.add(ctx, testTrade(0, "buy", 1, 100)); err != nil {
+		t.Log("ERROR : add to nil market stats returned", err)
+		t.Error("FAILURE : market stats")
+	}
+}
@@ -2,8 +2,8 @@ package exchange
 
 import (
 	"context"
-	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
@@ -11,9 +11,12 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/arbitrage"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
 	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/milkywaybrain/cryptogalaxy/internal/supervisor"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -21,60 +24,19 @@ import (
 
 // StartProbit is for starting probit exchange functions.
 func StartProbit(appCtx context.Context, markets []config.Market, retry *config.Retry, connCfg *config.Connection) error {
-
-	// If any error occurs or connection is lost, retry the exchange functions with a time gap till it reaches
-	// a configured number of retry.
-	// Retry counter will be reset back to zero if the elapsed time since the last retry is greater than the configured one.
-	var retryCount int
-	lastRetryTime := time.Now()
-
-	for {
-		err := newProbit(appCtx, markets, connCfg)
-		if err != nil {
-			log.Error().Err(err).Str("exchange", "probit").Msg("error occurred")
-			if retry.Number == 0 {
-				return errors.New("not able to connect probit exchange. please check the log for details")
-			}
-			if retry.ResetSec == 0 || time.Since(lastRetryTime).Seconds() < float64(retry.ResetSec) {
-				retryCount++
-			} else {
-				retryCount = 1
-			}
-			lastRetryTime = time.Now()
-			if retryCount > retry.Number {
-				return fmt.Errorf("not able to connect probit exchange even after %v retry. please check the log for details", retry.Number)
-			}
-
-			log.Error().Str("exchange", "probit").Int("retry", retryCount).Msg(fmt.Sprintf("retrying functions in %v seconds", retry.GapSec))
-			tick := time.NewTicker(time.Duration(retry.GapSec) * time.Second)
-			select {
-			case <-tick.C:
-				tick.Stop()
-
-			// Return, if there is any error from another exchange.
-			case <-appCtx.Done():
-				log.Error().Str("exchange", "probit").Msg("ctx canceled, return from StartProbit")
-				return appCtx.Err()
-			}
-		}
-	}
+	return supervisor.Run(appCtx, "probit", retry, func() error {
+		return newProbit(appCtx, markets, connCfg)
+	})
 }
 
 type probit struct {
-	ws             connector.Websocket
-	rest           *connector.REST
-	connCfg        *config.Connection
-	cfgMap         map[cfgLookupKey]cfgLookupVal
-	channelIds     map[int][2]string
-	ter            *storage.Terminal
-	es             *storage.ElasticSearch
-	mysql          *storage.MySQL
-	wsTerTickers   chan []storage.Ticker
-	wsTerTrades    chan []storage.Trade
-	wsMysqlTickers chan []storage.Ticker
-	wsMysqlTrades  chan []storage.Trade
-	wsEsTickers    chan []storage.Ticker
-	wsEsTrades     chan []storage.Trade
+	ws          connector.Websocket
+	rest        *connector.REST
+	connCfg     *config.Connection
+	cfgMap      map[cfgLookupKey]cfgLookupVal
+	strs        strCommits
+	marketStats *marketStats
+	channelIds  map[int][2]string
 }
 
 type wsSubProbit struct {
@@ -102,10 +64,24 @@ type respDataProbit struct {
 	Side        string    `json:"side"`
 	Quantity    string    `json:"quantity"`
 	TickerPrice string    `json:"last"`
+	High        string    `json:"high"`
+	Low         string    `json:"low"`
+	Volume      string    `json:"base_volume"`
 	TradePrice  string    `json:"price"`
 	Time        time.Time `json:"time"`
 }
 
+type restInstrumentRespProbit struct {
+	Data []restInstrumentDataProbit `json:"data"`
+}
+
+type restInstrumentDataProbit struct {
+	ID                string `json:"id"`
+	PriceIncrement    string `json:"price_increment"`
+	QuantityPrecision int    `json:"quantity_precision"`
+	Closed            bool   `json:"closed"`
+}
+
 func newProbit(appCtx context.Context, markets []config.Market, connCfg *config.Connection) error {
 
 	// If any exchange function fails, force all the other functions to stop and return.
@@ -117,6 +93,7 @@ func newProbit(appCtx context.Context, markets []config.Market, connCfg *config.
 	if err != nil {
 		return err
 	}
+	p.marketStats = newMarketStats("probit", p.cfgMap)
 
 	var (
 		wsCount   int
@@ -142,30 +119,22 @@ func newProbit(appCtx context.Context, markets []config.Market, connCfg *config.
 						return p.readWs(ctx)
 					})
 
-					if p.ter != nil {
-						probitErrGroup.Go(func() error {
-							return p.wsTickersToTerminal(ctx)
-						})
+					if p.marketStats != nil {
 						probitErrGroup.Go(func() error {
-							return p.wsTradesToTerminal(ctx)
+							return p.marketStats.run(ctx)
 						})
 					}
 
-					if p.mysql != nil {
+					for _, str := range p.strs {
+						str := str
 						probitErrGroup.Go(func() error {
-							return p.wsTickersToMySQL(ctx)
+							return str.wsTickers(ctx)
 						})
 						probitErrGroup.Go(func() error {
-							return p.wsTradesToMySQL(ctx)
+							return str.wsTrades(ctx)
 						})
-					}
-
-					if p.es != nil {
 						probitErrGroup.Go(func() error {
-							return p.wsTickersToES(ctx)
-						})
-						probitErrGroup.Go(func() error {
-							return p.wsTradesToES(ctx)
+							return str.wsRecords(ctx)
 						})
 					}
 				}
@@ -212,6 +181,7 @@ func (p *probit) cfgLookup(markets []config.Market) error {
 
 	// Configurations flat map is prepared for easy lookup later in the app.
 	p.cfgMap = make(map[cfgLookupKey]cfgLookupVal)
+	p.strs = make(strCommits)
 	p.channelIds = make(map[int][2]string)
 	for _, market := range markets {
 		var mktCommitName string
@@ -224,31 +194,14 @@ func (p *probit) cfgLookup(markets []config.Market) error {
 			key := cfgLookupKey{market: market.ID, channel: info.Channel}
 			val := cfgLookupVal{}
 			val.wsConsiderIntSec = info.WsConsiderIntSec
-			for _, str := range info.Storages {
-				switch str {
-				case "terminal":
-					val.terStr = true
-					if p.ter == nil {
-						p.ter = storage.GetTerminal()
-						p.wsTerTickers = make(chan []storage.Ticker, 1)
-						p.wsTerTrades = make(chan []storage.Trade, 1)
-					}
-				case "mysql":
-					val.mysqlStr = true
-					if p.mysql == nil {
-						p.mysql = storage.GetMySQL()
-						p.wsMysqlTickers = make(chan []storage.Ticker, 1)
-						p.wsMysqlTrades = make(chan []storage.Trade, 1)
-					}
-				case "elastic_search":
-					val.esStr = true
-					if p.es == nil {
-						p.es = storage.GetElasticSearch()
-						p.wsEsTickers = make(chan []storage.Ticker, 1)
-						p.wsEsTrades = make(chan []storage.Trade, 1)
-					}
-				}
-			}
+			val.strConsiderIntSec = info.StrConsiderIntSec
+			val.strs = p.strs.lookup(info.Storages)
+			val.candleIntervals = candleIntervals(info.CandleIntervals)
+			val.avgPriceWindows = candleIntervals(info.AvgPriceWindows)
+			val.statsInterval = time.Duration(info.StatsIntervalSec) * time.Second
+			val.tickFilter = newTickFilter(info.TickFilter)
+			val.base, val.quote = marketAssets(market)
+			val.tradeFilter = info.TradeFilter
 			val.mktCommitName = mktCommitName
 			p.cfgMap[key] = val
 		}
@@ -257,7 +210,7 @@ func (p *probit) cfgLookup(markets []config.Market) error {
 }
 
 func (p *probit) connectWs(ctx context.Context) error {
-	ws, err := connector.NewWebsocket(ctx, &p.connCfg.WS, config.ProbitWebsocketURL)
+	ws, err := connector.NewWebsocket(ctx, &p.connCfg.WS, "probit", config.ProbitWebsocketURL)
 	if err != nil {
 		if !errors.Is(err, ctx.Err()) {
 			logErrStack(err)
@@ -297,7 +250,7 @@ func (p *probit) subWsChannel(market string, channel string) error {
 		logErrStack(err)
 		return err
 	}
-	err = p.ws.Write(frame)
+	err = p.ws.Subscribe(frame)
 	if err != nil {
 		if errors.Is(err, net.ErrClosed) {
 			err = errors.New("context canceled")
@@ -318,14 +271,7 @@ func (p *probit) readWs(ctx context.Context) error {
 		cfgLookup[k] = v
 	}
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, p.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, p.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, p.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, p.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, p.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, p.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	log.Debug().Str("exchange", "probit").Str("func", "readWs").Msg("unlike other exchanges probit does not send channel subscribed success message")
 
@@ -426,48 +372,43 @@ func (p *probit) processWs(ctx context.Context, wr *wsRespProbit, cd *commitData
 		}
 		ticker.Price = price
 
+		high, err := strconv.ParseFloat(wr.TickerData.High, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		ticker.High = high
+
+		low, err := strconv.ParseFloat(wr.TickerData.Low, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		ticker.Low = low
+
+		volume, err := strconv.ParseFloat(wr.TickerData.Volume, 64)
+		if err != nil {
+			logErrStack(err)
+			return err
+		}
+		ticker.Volume = volume
+
 		ticker.Timestamp = wr.TickerData.Time
 
 		key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 		val := p.cfgMap[key]
-		if val.terStr {
-			cd.terTickersCount++
-			cd.terTickers = append(cd.terTickers, ticker)
-			if cd.terTickersCount == p.connCfg.Terminal.TickerCommitBuf {
-				select {
-				case p.wsTerTickers <- cd.terTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.terTickersCount = 0
-				cd.terTickers = nil
-			}
+		ticker.Base = val.base
+		ticker.Quote = val.quote
+		if cd.filterTicker(&ticker, key, val.tickFilter) {
+			return nil
 		}
-		if val.mysqlStr {
-			cd.mysqlTickersCount++
-			cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-			if cd.mysqlTickersCount == p.connCfg.MySQL.TickerCommitBuf {
-				select {
-				case p.wsMysqlTickers <- cd.mysqlTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.mysqlTickersCount = 0
-				cd.mysqlTickers = nil
-			}
+		if !ticker.IsBadTick {
+			ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+			alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+			arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 		}
-		if val.esStr {
-			cd.esTickersCount++
-			cd.esTickers = append(cd.esTickers, ticker)
-			if cd.esTickersCount == p.connCfg.ES.TickerCommitBuf {
-				select {
-				case p.wsEsTickers <- cd.esTickers:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				cd.esTickersCount = 0
-				cd.esTickers = nil
-			}
+		if err := cd.wsTicker(ctx, key, &val, ticker); err != nil {
+			return err
 		}
 	case "trade":
 		for _, data := range wr.TradeData {
@@ -495,142 +436,48 @@ func (p *probit) processWs(ctx context.Context, wr *wsRespProbit, cd *commitData
 
 			key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 			val := p.cfgMap[key]
-			if val.terStr {
-				cd.terTradesCount++
-				cd.terTrades = append(cd.terTrades, trade)
-				if cd.terTradesCount == p.connCfg.Terminal.TradeCommitBuf {
-					select {
-					case p.wsTerTrades <- cd.terTrades:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-					cd.terTradesCount = 0
-					cd.terTrades = nil
-				}
+			if filterTradeRules(&trade, val.tradeFilter) {
+				continue
 			}
-			if val.mysqlStr {
-				cd.mysqlTradesCount++
-				cd.mysqlTrades = append(cd.mysqlTrades, trade)
-				if cd.mysqlTradesCount == p.connCfg.MySQL.TradeCommitBuf {
-					select {
-					case p.wsMysqlTrades <- cd.mysqlTrades:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-					cd.mysqlTradesCount = 0
-					cd.mysqlTrades = nil
-				}
+			trade.Base = val.base
+			trade.Quote = val.quote
+			if cd.filterTrade(&trade, key, val.tickFilter) {
+				continue
 			}
-			if val.esStr {
-				cd.esTradesCount++
-				cd.esTrades = append(cd.esTrades, trade)
-				if cd.esTradesCount == p.connCfg.ES.TradeCommitBuf {
-					select {
-					case p.wsEsTrades <- cd.esTrades:
-					case <-ctx.Done():
-						return ctx.Err()
-					}
-					cd.esTradesCount = 0
-					cd.esTrades = nil
-				}
+			if !trade.IsBadTick {
+				trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+				alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+				arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
 			}
-		}
-	}
-	return nil
-}
-
-func (p *probit) wsTickersToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-p.wsTerTickers:
-			p.ter.CommitTickers(data)
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
-
-func (p *probit) wsTradesToTerminal(ctx context.Context) error {
-	for {
-		select {
-		case data := <-p.wsTerTrades:
-			p.ter.CommitTrades(data)
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
-
-func (p *probit) wsTickersToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-p.wsMysqlTickers:
-			err := p.mysql.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+			if err := cd.wsTrade(ctx, key, &val, trade); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
 
-func (p *probit) wsTradesToMySQL(ctx context.Context) error {
-	for {
-		select {
-		case data := <-p.wsMysqlTrades:
-			err := p.mysql.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
+			// Candles are built from the trades, if configured.
+			for _, candle := range cd.addCandleTrade(trade, val.candleIntervals) {
+				if err := cd.wsAggregate(ctx, &val, "candle", candle); err != nil {
+					return err
 				}
-				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
 
-func (p *probit) wsTickersToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-p.wsEsTickers:
-			err := p.es.CommitTickers(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
+			// Rolling average prices are calculated from the trades, if configured.
+			for _, avgPrice := range cd.addAvgPriceTrade(trade, val.avgPriceWindows) {
+				if err := cd.wsAggregate(ctx, &val, "avg_price", avgPrice); err != nil {
+					return err
 				}
-				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
-		}
-	}
-}
 
-func (p *probit) wsTradesToES(ctx context.Context) error {
-	for {
-		select {
-		case data := <-p.wsEsTrades:
-			err := p.es.CommitTrades(ctx, data)
-			if err != nil {
-				if !errors.Is(err, ctx.Err()) {
-					logErrStack(err)
-				}
+			// Market stats are aggregated from the trades, if configured.
+			if err := p.marketStats.add(ctx, trade); err != nil {
 				return err
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
 	}
+	return nil
 }
 
 func (p *probit) connectRest() error {
-	rest, err := connector.GetREST()
+	rest, err := connector.GetREST("probit")
 	if err != nil {
 		logErrStack(err)
 		return err
@@ -646,21 +493,16 @@ func (p *probit) connectRest() error {
 // then sends it to different storage systems for commit through go channels.
 func (p *probit) processREST(ctx context.Context, mktID string, mktCommitName string, channel string, interval int) error {
 	var (
-		req *http.Request
-		q   url.Values
-		err error
+		req            *http.Request
+		q              url.Values
+		cursor         connector.TradeCursor
+		err            error
+		lastInstrument storage.Instrument
 	)
 
 	const timeFormat = "2006-01-02T15:04:05.999Z"
 
-	cd := commitData{
-		terTickers:   make([]storage.Ticker, 0, p.connCfg.Terminal.TickerCommitBuf),
-		terTrades:    make([]storage.Trade, 0, p.connCfg.Terminal.TradeCommitBuf),
-		mysqlTickers: make([]storage.Ticker, 0, p.connCfg.MySQL.TickerCommitBuf),
-		mysqlTrades:  make([]storage.Trade, 0, p.connCfg.MySQL.TradeCommitBuf),
-		esTickers:    make([]storage.Ticker, 0, p.connCfg.ES.TickerCommitBuf),
-		esTrades:     make([]storage.Trade, 0, p.connCfg.ES.TradeCommitBuf),
-	}
+	cd := commitData{}
 
 	switch channel {
 	case "ticker":
@@ -685,13 +527,21 @@ func (p *probit) processREST(ctx context.Context, mktID string, mktCommitName st
 		q.Add("market_id", mktID)
 
 		// Querying for 100 trades.
-		// If the configured interval gap is big, then maybe it will not return all the trades
-		// and if the gap is too small, maybe it will return duplicate ones.
+		// Only the latest trades are returned by the endpoint, so the ones received in the earlier poll are skipped.
+		// If the configured interval gap is big, then maybe it will not return all the trades.
 		// Better to use websocket.
 		q.Add("limit", strconv.Itoa(100))
+	case "instrument":
+		req, err = p.rest.Request(ctx, "GET", config.ProbitRESTBaseURL+"market")
+		if err != nil {
+			if !errors.Is(err, ctx.Err()) {
+				logErrStack(err)
+			}
+			return err
+		}
 	}
 
-	tick := time.NewTicker(time.Duration(interval) * time.Second)
+	tick := connector.NewPollTicker("probit", time.Duration(interval)*time.Second)
 	defer tick.Stop()
 	for {
 		select {
@@ -724,54 +574,49 @@ func (p *probit) processREST(ctx context.Context, mktID string, mktCommitName st
 					return err
 				}
 
+				high, err := strconv.ParseFloat(r.High, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				low, err := strconv.ParseFloat(r.Low, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				volume, err := strconv.ParseFloat(r.Volume, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
 				ticker := storage.Ticker{
 					Exchange:      "probit",
 					MktID:         mktID,
 					MktCommitName: mktCommitName,
 					Price:         price,
+					High:          high,
+					Low:           low,
+					Volume:        volume,
 					Timestamp:     time.Now().UTC(),
 				}
 
 				key := cfgLookupKey{market: ticker.MktID, channel: "ticker"}
 				val := p.cfgMap[key]
-				if val.terStr {
-					cd.terTickersCount++
-					cd.terTickers = append(cd.terTickers, ticker)
-					if cd.terTickersCount == p.connCfg.Terminal.TickerCommitBuf {
-						p.ter.CommitTickers(cd.terTickers)
-						cd.terTickersCount = 0
-						cd.terTickers = nil
-					}
+				ticker.Base = val.base
+				ticker.Quote = val.quote
+				if cd.filterTicker(&ticker, key, val.tickFilter) {
+					continue
 				}
-				if val.mysqlStr {
-					cd.mysqlTickersCount++
-					cd.mysqlTickers = append(cd.mysqlTickers, ticker)
-					if cd.mysqlTickersCount == p.connCfg.MySQL.TickerCommitBuf {
-						err := p.mysql.CommitTickers(ctx, cd.mysqlTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.mysqlTickersCount = 0
-						cd.mysqlTickers = nil
-					}
+				if !ticker.IsBadTick {
+					ticker.PriceUSD = usdPrice(ticker.Exchange, ticker.MktID, ticker.Price)
+					alert.Observe(ticker.Exchange, ticker.MktID, ticker.Price, ticker.Timestamp)
+					arbitrage.Observe(ticker.Exchange, ticker.Base, ticker.Quote, ticker.Price, ticker.Timestamp)
 				}
-				if val.esStr {
-					cd.esTickersCount++
-					cd.esTickers = append(cd.esTickers, ticker)
-					if cd.esTickersCount == p.connCfg.ES.TickerCommitBuf {
-						err := p.es.CommitTickers(ctx, cd.esTickers)
-						if err != nil {
-							if !errors.Is(err, ctx.Err()) {
-								logErrStack(err)
-							}
-							return err
-						}
-						cd.esTickersCount = 0
-						cd.esTickers = nil
-					}
+				if err := cd.restTicker(ctx, &val, ticker); err != nil {
+					return err
 				}
 			case "trade":
 
@@ -825,48 +670,97 @@ func (p *probit) processREST(ctx context.Context, mktID string, mktCommitName st
 						Timestamp:     r.Time,
 					}
 
+					if !cursor.New(restTradeKey(&trade), trade.Timestamp) {
+						continue
+					}
+
 					key := cfgLookupKey{market: trade.MktID, channel: "trade"}
 					val := p.cfgMap[key]
-					if val.terStr {
-						cd.terTradesCount++
-						cd.terTrades = append(cd.terTrades, trade)
-						if cd.terTradesCount == p.connCfg.Terminal.TradeCommitBuf {
-							p.ter.CommitTrades(cd.terTrades)
-							cd.terTradesCount = 0
-							cd.terTrades = nil
-						}
+					if filterTradeRules(&trade, val.tradeFilter) {
+						continue
+					}
+					trade.Base = val.base
+					trade.Quote = val.quote
+					if cd.filterTrade(&trade, key, val.tickFilter) {
+						continue
 					}
-					if val.mysqlStr {
-						cd.mysqlTradesCount++
-						cd.mysqlTrades = append(cd.mysqlTrades, trade)
-						if cd.mysqlTradesCount == p.connCfg.MySQL.TradeCommitBuf {
-							err := p.mysql.CommitTrades(ctx, cd.mysqlTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.mysqlTradesCount = 0
-							cd.mysqlTrades = nil
-						}
+					if !trade.IsBadTick {
+						trade.PriceUSD = usdPrice(trade.Exchange, trade.MktID, trade.Price)
+						alert.Observe(trade.Exchange, trade.MktID, trade.Price, trade.Timestamp)
+						arbitrage.Observe(trade.Exchange, trade.Base, trade.Quote, trade.Price, trade.Timestamp)
 					}
-					if val.esStr {
-						cd.esTradesCount++
-						cd.esTrades = append(cd.esTrades, trade)
-						if cd.esTradesCount == p.connCfg.ES.TradeCommitBuf {
-							err := p.es.CommitTrades(ctx, cd.esTrades)
-							if err != nil {
-								if !errors.Is(err, ctx.Err()) {
-									logErrStack(err)
-								}
-								return err
-							}
-							cd.esTradesCount = 0
-							cd.esTrades = nil
-						}
+					if err := cd.restTrade(ctx, &val, trade); err != nil {
+						return err
 					}
 				}
+				cursor.Next(len(rr.Data))
+			case "instrument":
+				resp, err := p.rest.Do(req)
+				if err != nil {
+					if !errors.Is(err, ctx.Err()) {
+						logErrStack(err)
+					}
+					return err
+				}
+
+				rr := restInstrumentRespProbit{}
+				if err = jsoniter.NewDecoder(resp.Body).Decode(&rr); err != nil {
+					logErrStack(err)
+					resp.Body.Close()
+					return err
+				}
+				resp.Body.Close()
+
+				// Exchange returns all the markets, so the configured one is picked.
+				var market restInstrumentDataProbit
+				found := false
+				for _, m := range rr.Data {
+					if m.ID == mktID {
+						market = m
+						found = true
+						break
+					}
+				}
+				if !found {
+					err = errors.New("market info is not returned by exchange")
+					logErrStack(err)
+					return err
+				}
+
+				tickSize, err := strconv.ParseFloat(market.PriceIncrement, 64)
+				if err != nil {
+					logErrStack(err)
+					return err
+				}
+
+				status := "trading"
+				if market.Closed {
+					status = "halted"
+				}
+
+				instrument := storage.Instrument{
+					Exchange:       "probit",
+					MktID:          mktID,
+					MktCommitName:  mktCommitName,
+					TickSize:       tickSize,
+					LotSize:        math.Pow10(-market.QuantityPrecision),
+					PricePrecision: precision(tickSize),
+					SizePrecision:  market.QuantityPrecision,
+					Status:         status,
+				}
+
+				// Only the changes are stored, first one being the metadata at the start.
+				if instrument == lastInstrument {
+					continue
+				}
+				lastInstrument = instrument
+				instrument.Timestamp = time.Now().UTC()
+
+				key := cfgLookupKey{market: instrument.MktID, channel: "instrument"}
+				val := p.cfgMap[key]
+				if err := cd.restRecord(ctx, &val, "instrument", instrument); err != nil {
+					return err
+				}
 			}
 
 		// Return, if there is any error from another function or exchange.
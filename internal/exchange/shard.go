@@ -0,0 +1,46 @@
+package exchange
+
+import "github.com/milkywaybrain/cryptogalaxy/internal/config"
+
+// wsMaxSubscriptions is the max number of channel subscriptions allowed by the exchanges on a websocket connection,
+// which is used if not configured.
+var wsMaxSubscriptions = map[string]int{
+	"binance": 1024,
+	"kucoin":  300,
+}
+
+// ShardMarkets splits the markets of the exchange into shards, each having at most the given number of websocket
+// channel subscriptions, or the limit of the exchange if it is 0.
+// Each shard is to be started as a separate exchange, with its own websocket connection and reader / ping functions,
+// so that the subscriptions are not limited by a single connection.
+// All the channels of a market are kept in the same shard, and the channels of REST connector are not counted.
+// It returns all the markets as a single shard if there is no limit.
+func ShardMarkets(exchName string, markets []config.Market, maxSubs int) [][]config.Market {
+	if maxSubs == 0 {
+		maxSubs = wsMaxSubscriptions[exchName]
+	}
+	if maxSubs == 0 {
+		return [][]config.Market{markets}
+	}
+	var (
+		shards [][]config.Market
+		shard  []config.Market
+		subs   int
+	)
+	for _, market := range markets {
+		var count int
+		for _, info := range market.Info {
+			if info.Connector == "websocket" {
+				count++
+			}
+		}
+		if subs > 0 && subs+count > maxSubs {
+			shards = append(shards, shard)
+			shard = nil
+			subs = 0
+		}
+		shard = append(shard, market)
+		subs += count
+	}
+	return append(shards, shard)
+}
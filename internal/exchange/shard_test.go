@@ -0,0 +1,58 @@
+package exchange
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// TestShardMarkets tests the split of the markets into websocket connections as per the subscription limit,
+// counting only the websocket channels and keeping the channels of a market together.
+func TestShardMarkets(t *testing.T) {
+	type market struct {
+		id       string
+		ws, rest int
+	}
+	tests := []struct {
+		name     string
+		exchange string
+		markets  []market
+		maxSubs  int
+		want     [][]string
+	}{
+		{"no limit", "ftx", []market{{"A", 2, 0}, {"B", 2, 0}}, 0, [][]string{{"A", "B"}}},
+		{"within limit", "ftx", []market{{"A", 2, 0}, {"B", 2, 0}}, 4, [][]string{{"A", "B"}}},
+		{"split at limit", "ftx", []market{{"A", 2, 0}, {"B", 2, 0}, {"C", 1, 0}}, 3, [][]string{{"A"}, {"B", "C"}}},
+		{"channels of a market kept together", "ftx", []market{{"A", 1, 0}, {"B", 3, 0}}, 2, [][]string{{"A"}, {"B"}}},
+		{"rest channels not counted", "ftx", []market{{"A", 1, 3}, {"B", 1, 3}}, 2, [][]string{{"A", "B"}}},
+		{"only rest channels", "ftx", []market{{"A", 0, 2}, {"B", 0, 2}}, 1, [][]string{{"A", "B"}}},
+		{"exchange limit", "kucoin", []market{{"A", 200, 0}, {"B", 100, 0}, {"C", 1, 0}}, 0, [][]string{{"A", "B"}, {"C"}}},
+		{"configured limit over exchange one", "kucoin", []market{{"A", 200, 0}, {"B", 100, 0}}, 200, [][]string{{"A"}, {"B"}}},
+	}
+	for _, tt := range tests {
+		var markets []config.Market
+		for _, m := range tt.markets {
+			market := config.Market{ID: m.id}
+			for i := 0; i < m.ws; i++ {
+				market.Info = append(market.Info, config.Info{Connector: "websocket"})
+			}
+			for i := 0; i < m.rest; i++ {
+				market.Info = append(market.Info, config.Info{Connector: "rest"})
+			}
+			markets = append(markets, market)
+		}
+		var got [][]string
+		for _, shard := range ShardMarkets(tt.exchange, markets, tt.maxSubs) {
+			var ids []string
+			for _, market := range shard {
+				ids = append(ids, market.ID)
+			}
+			got = append(got, ids)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Log("ERROR : "+tt.name+" : shards", got, "expected", tt.want)
+			t.Error("FAILURE : market sharding")
+		}
+	}
+}
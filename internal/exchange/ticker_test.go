@@ -0,0 +1,181 @@
+package exchange
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+)
+
+// TestWsTicker tests the best bid, best ask, volume, high and low of the websocket ticker frames of the exchanges.
+// Binance frames are decoded with the same type for ticker and trade, in which best bid and ask keys of ticker
+// are the numeric order ids of trade, so the trade frame is also checked.
+func TestWsTicker(t *testing.T) {
+	tests := []struct {
+		exchange string
+		market   string
+		frame    string
+
+		// Process decodes the frame as the exchange websocket reader does and processes it.
+		process func(ctx context.Context, cfgMap map[cfgLookupKey]cfgLookupVal, frame []byte, cd *commitData) error
+		want    storage.Ticker
+		trade   float64
+	}{
+		{
+			exchange: "binance",
+			market:   "BTCUSDT",
+			frame: `{"e":"24hrTicker","E":1622541600000,"s":"BTCUSDT","c":"36000.50","b":"36000.40","B":"1.2",` +
+				`"a":"36000.60","A":"0.8","v":"50000.5","h":"37000.00","l":"35000.00","C":1622541600000,"L":12345}`,
+			process: func(ctx context.Context, cfgMap map[cfgLookupKey]cfgLookupVal, frame []byte, cd *commitData) error {
+				wr := wsRespBinance{}
+				if err := jsoniter.Unmarshal(frame, &wr); err != nil {
+					return err
+				}
+				wr.Event = "ticker"
+				wr.mktCommitName = "BTC/USDT"
+				return (&binance{cfgMap: cfgMap}).processWs(ctx, &wr, cd)
+			},
+			want: storage.Ticker{
+				Price: 36000.5, BestBid: 36000.4, BestAsk: 36000.6, Volume: 50000.5, High: 37000, Low: 35000,
+				Timestamp: time.Unix(1622541600, 0).UTC(),
+			},
+		},
+		{
+			exchange: "binance",
+			market:   "BTCUSDT",
+			frame:    `{"e":"trade","E":1622541600000,"s":"BTCUSDT","t":12345,"p":"36000.50","q":"0.5","b":88,"a":50,"T":1622541600000,"m":true,"M":true}`,
+			process: func(ctx context.Context, cfgMap map[cfgLookupKey]cfgLookupVal, frame []byte, cd *commitData) error {
+				wr := wsRespBinance{}
+				if err := jsoniter.Unmarshal(frame, &wr); err != nil {
+					return err
+				}
+				wr.mktCommitName = "BTC/USDT"
+				return (&binance{cfgMap: cfgMap}).processWs(ctx, &wr, cd)
+			},
+			trade: 36000.5,
+		},
+		{
+			exchange: "coinbase-pro",
+			market:   "BTC-USD",
+			frame: `{"type":"ticker","product_id":"BTC-USD","price":"36000.50","best_bid":"36000.40","best_ask":"36000.60",` +
+				`"volume_24h":"12000.25","high_24h":"37000.00","low_24h":"35000.00","time":"2021-06-01T10:00:00.000000Z"}`,
+			process: func(ctx context.Context, cfgMap map[cfgLookupKey]cfgLookupVal, frame []byte, cd *commitData) error {
+				wr := respCoinPro{}
+				if err := jsoniter.Unmarshal(frame, &wr); err != nil {
+					return err
+				}
+				wr.mktCommitName = "BTC/USDT"
+				return (&coinbasePro{cfgMap: cfgMap}).processWs(ctx, &wr, cd)
+			},
+			want: storage.Ticker{
+				Price: 36000.5, BestBid: 36000.4, BestAsk: 36000.6, Volume: 12000.25, High: 37000, Low: 35000,
+				Timestamp: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			exchange: "gateio",
+			market:   "BTC_USDT",
+			frame: `{"time":1622541600,"channel":"spot.tickers","result":{"currency_pair":"BTC_USDT","last":"36000.5",` +
+				`"highest_bid":"36000.4","lowest_ask":"36000.6","base_volume":"8000.75","high_24h":"37000","low_24h":"35000"}}`,
+			process: func(ctx context.Context, cfgMap map[cfgLookupKey]cfgLookupVal, frame []byte, cd *commitData) error {
+				wr := wsRespGateio{}
+				if err := jsoniter.Unmarshal(frame, &wr); err != nil {
+					return err
+				}
+				wr.Channel = "ticker"
+				wr.mktCommitName = "BTC/USDT"
+				return (&gateio{cfgMap: cfgMap}).processWs(ctx, &wr, cd)
+			},
+			want: storage.Ticker{
+				Price: 36000.5, BestBid: 36000.4, BestAsk: 36000.6, Volume: 8000.75, High: 37000, Low: 35000,
+				Timestamp: time.Unix(1622541600, 0).UTC(),
+			},
+		},
+		{
+			exchange: "ftx",
+			market:   "BTC/USD",
+			frame:    `{"channel":"ticker","market":"BTC/USD","type":"update","data":{"bid":36000.4,"ask":36000.6,"last":36000.5,"time":1622541600.5}}`,
+			process: func(ctx context.Context, cfgMap map[cfgLookupKey]cfgLookupVal, frame []byte, cd *commitData) error {
+				wr := wsRespFtx{}
+				if err := jsoniter.Unmarshal(frame, &wr); err != nil {
+					return err
+				}
+				wr.mktCommitName = "BTC/USDT"
+				return (&ftx{cfgMap: cfgMap}).processWs(ctx, &wr, cd)
+			},
+			want: storage.Ticker{
+				Price: 36000.5, BestBid: 36000.4, BestAsk: 36000.6,
+				Timestamp: time.Unix(1622541600, 5e8).UTC(),
+			},
+		},
+		{
+			exchange: "bybit",
+			market:   "BTCUSD",
+			frame: `{"topic":"instrument_info.100ms.BTCUSD","type":"snapshot","data":{"index_price_e4":"360005000",` +
+				`"bid1_price_e4":"360004000","ask1_price_e4":"360006000","high_price_24h_e4":"370000000",` +
+				`"low_price_24h_e4":"350000000","volume_24h_e8":"150000000000"}}`,
+			process: func(ctx context.Context, cfgMap map[cfgLookupKey]cfgLookupVal, frame []byte, cd *commitData) error {
+				wr := wsRespBybit{}
+				if err := jsoniter.Unmarshal(frame, &wr); err != nil {
+					return err
+				}
+				wr.Topic = "ticker"
+				wr.mktID = "BTCUSD"
+				wr.mktCommitName = "BTC/USDT"
+				return (&bybit{cfgMap: cfgMap, lastTickers: make(map[string]storage.Ticker)}).processWs(ctx, &wr, cd)
+			},
+			want: storage.Ticker{Price: 36000.5, BestBid: 36000.4, BestAsk: 36000.6, Volume: 1500, High: 37000, Low: 35000},
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		str := &strCommit{
+			Registered: &storage.Registered{Name: "test", Storage: &orderStorage{}, TickerCommitBuf: 10, TradeCommitBuf: 10},
+			shards: []*commitShard{{
+				tickers: make(chan []storage.Ticker, 1),
+				trades:  make(chan []storage.Trade, 1),
+			}},
+			workers: 1,
+		}
+		cfgMap := map[cfgLookupKey]cfgLookupVal{
+			{market: tt.market, channel: "ticker"}: {mktCommitName: "BTC/USDT", strs: []*strCommit{str}},
+			{market: tt.market, channel: "trade"}:  {mktCommitName: "BTC/USDT", strs: []*strCommit{str}},
+		}
+		if err := tt.process(ctx, cfgMap, []byte(tt.frame), &commitData{}); err != nil {
+			t.Log("ERROR : " + tt.exchange + " : " + err.Error())
+			t.Error("FAILURE : " + tt.exchange + " websocket ticker")
+			continue
+		}
+
+		shard := str.shards[0]
+		if tt.trade > 0 {
+			if len(shard.tradeBuf) != 1 || shard.tradeBuf[0].Price != tt.trade || len(shard.tickerBuf) != 0 {
+				t.Logf("ERROR : %s : trades %+v, tickers %+v, expected a trade of price %v", tt.exchange, shard.tradeBuf, shard.tickerBuf, tt.trade)
+				t.Error("FAILURE : " + tt.exchange + " websocket trade")
+			}
+			continue
+		}
+		if len(shard.tickerBuf) != 1 {
+			t.Log("ERROR : "+tt.exchange+" :", len(shard.tickerBuf), "tickers, expected 1")
+			t.Error("FAILURE : " + tt.exchange + " websocket ticker")
+			continue
+		}
+		got := shard.tickerBuf[0]
+		want := tt.want
+		want.Exchange = tt.exchange
+		want.MktID = tt.market
+		want.MktCommitName = "BTC/USDT"
+
+		// Exchanges not sending the time get the receive time.
+		if want.Timestamp.IsZero() {
+			want.Timestamp = got.Timestamp
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Logf("ERROR : %s : ticker %+v, expected %+v", tt.exchange, got, want)
+			t.Error("FAILURE : " + tt.exchange + " websocket ticker")
+		}
+	}
+}
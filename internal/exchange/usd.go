@@ -0,0 +1,88 @@
+package exchange
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// usdMarket identifies an exchange market for USD conversion.
+type usdMarket struct {
+	exchange string
+	market   string
+}
+
+// usdConversion tells how the market prices are converted to USD.
+type usdConversion struct {
+	ref      usdMarket
+	invert   bool
+	identity bool
+}
+
+// usdRefs holds the configured conversions and the last prices of the reference markets.
+// Conversions and reference markets are set once before starting the exchanges,
+// only the prices are updated afterwards from all the exchange goroutines.
+var usdRefs struct {
+	conversions map[usdMarket]usdConversion
+	refMarkets  map[usdMarket]bool
+	mu          sync.RWMutex
+	prices      map[usdMarket]float64
+}
+
+// InitUSDReferences prepares the USD conversions of the markets from the config.
+func InitUSDReferences(exchanges []config.Exchange) {
+	usdRefs.conversions = make(map[usdMarket]usdConversion)
+	usdRefs.refMarkets = make(map[usdMarket]bool)
+	usdRefs.prices = make(map[usdMarket]float64)
+	for _, exch := range exchanges {
+		for _, market := range exch.Markets {
+			if market.USDReference == nil {
+				continue
+			}
+			key := usdMarket{exchange: exch.Name, market: strings.ToUpper(market.ID)}
+
+			// Market which is already quoted in USD has the same price.
+			if strings.EqualFold(market.USDReference.Market, "USD") {
+				usdRefs.conversions[key] = usdConversion{identity: true}
+				continue
+			}
+			refExch := market.USDReference.Exchange
+			if refExch == "" {
+				refExch = exch.Name
+			}
+			ref := usdMarket{exchange: refExch, market: strings.ToUpper(market.USDReference.Market)}
+			usdRefs.conversions[key] = usdConversion{ref: ref, invert: market.USDReference.Invert}
+			usdRefs.refMarkets[ref] = true
+		}
+	}
+}
+
+// usdPrice records the price if the market is a reference one and
+// converts the price to USD using the last price of the configured reference market.
+// It returns 0 if the market has no reference or price of the reference is not received yet.
+func usdPrice(exchange string, market string, price float64) float64 {
+	key := usdMarket{exchange: exchange, market: strings.ToUpper(market)}
+	if usdRefs.refMarkets[key] {
+		usdRefs.mu.Lock()
+		usdRefs.prices[key] = price
+		usdRefs.mu.Unlock()
+	}
+	conv, ok := usdRefs.conversions[key]
+	if !ok {
+		return 0
+	}
+	if conv.identity {
+		return price
+	}
+	usdRefs.mu.RLock()
+	refPrice := usdRefs.prices[conv.ref]
+	usdRefs.mu.RUnlock()
+	if refPrice == 0 {
+		return 0
+	}
+	if conv.invert {
+		return price / refPrice
+	}
+	return price * refPrice
+}
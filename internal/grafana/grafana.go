@@ -0,0 +1,180 @@
+package grafana
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// Datasource names used in the generated dashboard and provisioning file.
+const (
+	PrometheusDatasource = "cryptogalaxy-prometheus"
+	MySQLDatasource      = "cryptogalaxy-mysql"
+)
+
+// Export generates grafana dashboard JSON and datasource provisioning YAML into the output directory.
+// Dashboard panels are matched to the prometheus metrics and mysql schema of the app.
+func Export(cfg *config.Config, outDir string) error {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+
+	dashboard, err := jsoniter.MarshalIndent(newDashboard(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filepath.Join(outDir, "cryptogalaxy-dashboard.json"), dashboard, 0644); err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(filepath.Join(outDir, "cryptogalaxy-datasources.yaml"), []byte(datasources(cfg)), 0644); err != nil {
+		return err
+	}
+	return nil
+}
+
+// datasources returns grafana provisioning YAML for prometheus and mysql datasources.
+func datasources(cfg *config.Config) string {
+	// Mysql URL in config is in go driver DSN format, e.g. @tcp(127.0.0.1:3306).
+	mysqlURL := cfg.Connection.MySQL.URL
+	if i := strings.Index(mysqlURL, "("); i != -1 && strings.HasSuffix(mysqlURL, ")") {
+		mysqlURL = mysqlURL[i+1 : len(mysqlURL)-1]
+	}
+	if mysqlURL == "" {
+		mysqlURL = "127.0.0.1:3306"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("apiVersion: 1\n\ndatasources:\n")
+
+	// Prometheus server scraping the app metrics endpoint is expected to run on its default port.
+	sb.WriteString(fmt.Sprintf("  - name: %s\n    uid: %s\n    type: prometheus\n    access: proxy\n    url: http://localhost:9090\n", PrometheusDatasource, PrometheusDatasource))
+	sb.WriteString(fmt.Sprintf("  - name: %s\n    uid: %s\n    type: mysql\n    url: %s\n    database: %s\n    user: %s\n", MySQLDatasource, MySQLDatasource, mysqlURL, cfg.Connection.MySQL.Schema, cfg.Connection.MySQL.User))
+	sb.WriteString(fmt.Sprintf("    secureJsonData:\n      password: %q\n", cfg.Connection.MySQL.Password))
+	return sb.String()
+}
+
+type dashboard struct {
+	Title         string     `json:"title"`
+	UID           string     `json:"uid"`
+	Tags          []string   `json:"tags"`
+	Timezone      string     `json:"timezone"`
+	Refresh       string     `json:"refresh"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Time          timeRange  `json:"time"`
+	Templating    templating `json:"templating"`
+	Panels        []panel    `json:"panels"`
+}
+
+type timeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type templating struct {
+	List []variable `json:"list"`
+}
+
+type variable struct {
+	Name       string     `json:"name"`
+	Label      string     `json:"label"`
+	Type       string     `json:"type"`
+	Datasource datasource `json:"datasource"`
+	Query      string     `json:"query"`
+	Multi      bool       `json:"multi"`
+	IncludeAll bool       `json:"includeAll"`
+	Refresh    int        `json:"refresh"`
+}
+
+type panel struct {
+	ID         int        `json:"id"`
+	Title      string     `json:"title"`
+	Type       string     `json:"type"`
+	Datasource datasource `json:"datasource"`
+	GridPos    gridPos    `json:"gridPos"`
+	Targets    []target   `json:"targets"`
+}
+
+type datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type gridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr,omitempty"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	RawSQL       string `json:"rawSql,omitempty"`
+	RawQuery     bool   `json:"rawQuery,omitempty"`
+	Format       string `json:"format,omitempty"`
+}
+
+var (
+	promDS  = datasource{Type: "prometheus", UID: PrometheusDatasource}
+	mysqlDS = datasource{Type: "mysql", UID: MySQLDatasource}
+)
+
+// newDashboard builds the dashboard with price, throughput and health panels.
+func newDashboard() dashboard {
+	sqlPanel := func(id int, title string, typ string, pos gridPos, format string, query string) panel {
+		return panel{
+			ID:         id,
+			Title:      title,
+			Type:       typ,
+			Datasource: mysqlDS,
+			GridPos:    pos,
+			Targets:    []target{{RefID: "A", RawSQL: query, RawQuery: true, Format: format}},
+		}
+	}
+	promPanel := func(id int, title string, pos gridPos, expr string, legend string) panel {
+		return panel{
+			ID:         id,
+			Title:      title,
+			Type:       "timeseries",
+			Datasource: promDS,
+			GridPos:    pos,
+			Targets:    []target{{RefID: "A", Expr: expr, LegendFormat: legend}},
+		}
+	}
+
+	return dashboard{
+		Title:         "Cryptogalaxy",
+		UID:           "cryptogalaxy",
+		Tags:          []string{"cryptogalaxy"},
+		Timezone:      "utc",
+		Refresh:       "30s",
+		SchemaVersion: 30,
+		Time:          timeRange{From: "now-6h", To: "now"},
+		Templating: templating{List: []variable{
+			{Name: "exchange", Label: "Exchange", Type: "query", Datasource: mysqlDS, Query: "SELECT DISTINCT exchange FROM ticker", Multi: true, IncludeAll: true, Refresh: 1},
+			{Name: "market", Label: "Market", Type: "query", Datasource: mysqlDS, Query: "SELECT DISTINCT market FROM ticker WHERE exchange IN ($exchange)", Multi: true, IncludeAll: true, Refresh: 1},
+		}},
+		Panels: []panel{
+			sqlPanel(1, "Ticker price", "timeseries", gridPos{H: 9, W: 24, X: 0, Y: 0}, "time_series",
+				"SELECT timestamp AS time, CONCAT(exchange, ' ', market) AS metric, price AS value FROM ticker WHERE $__timeFilter(timestamp) AND exchange IN ($exchange) AND market IN ($market) ORDER BY timestamp"),
+			sqlPanel(2, "Trades per minute", "timeseries", gridPos{H: 8, W: 12, X: 0, Y: 9}, "time_series",
+				"SELECT $__timeGroupAlias(timestamp, 1m), CONCAT(exchange, ' ', market) AS metric, COUNT(*) AS value FROM trade WHERE $__timeFilter(timestamp) AND exchange IN ($exchange) AND market IN ($market) GROUP BY 1, 2 ORDER BY 1"),
+			sqlPanel(3, "Traded volume per minute", "timeseries", gridPos{H: 8, W: 12, X: 12, Y: 9}, "time_series",
+				"SELECT $__timeGroupAlias(timestamp, 1m), CONCAT(exchange, ' ', market) AS metric, SUM(size) AS value FROM trade WHERE $__timeFilter(timestamp) AND exchange IN ($exchange) AND market IN ($market) GROUP BY 1, 2 ORDER BY 1"),
+			promPanel(4, "Websocket received bytes per second", gridPos{H: 8, W: 12, X: 0, Y: 17},
+				"sum by (exchange) (rate(cryptogalaxy_websocket_received_bytes_total[5m]))", "{{exchange}}"),
+			promPanel(5, "REST received bytes per second", gridPos{H: 8, W: 12, X: 12, Y: 17},
+				"sum by (host) (rate(cryptogalaxy_rest_received_bytes_total[5m]))", "{{host}}"),
+			sqlPanel(6, "Last received data", "table", gridPos{H: 8, W: 24, X: 0, Y: 25}, "table",
+				"SELECT 'ticker' AS channel, exchange, market, MAX(timestamp) AS last_timestamp, TIMESTAMPDIFF(SECOND, MAX(timestamp), UTC_TIMESTAMP()) AS lag_sec FROM ticker WHERE exchange IN ($exchange) AND market IN ($market) GROUP BY exchange, market "+
+					"UNION ALL SELECT 'trade' AS channel, exchange, market, MAX(timestamp) AS last_timestamp, TIMESTAMPDIFF(SECOND, MAX(timestamp), UTC_TIMESTAMP()) AS lag_sec FROM trade WHERE exchange IN ($exchange) AND market IN ($market) GROUP BY exchange, market "+
+					"ORDER BY lag_sec DESC"),
+		},
+	}
+}
@@ -0,0 +1,333 @@
+package importer
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
+	"github.com/pkg/errors"
+)
+
+// Supported dataset sources.
+const (
+	SourceBinanceVision = "binance-vision"
+	SourceKaiko         = "kaiko"
+)
+
+// Options holds the values of a single import run.
+type Options struct {
+	Source   string
+	File     string
+	Channel  string
+	Exchange string
+	Market   string
+	Storages []string
+}
+
+// committer commits a batch of imported trades to a storage.
+type committer struct {
+	bufSize int
+	buf     []storage.Trade
+	commit  func(context.Context, []storage.Trade) error
+}
+
+// Import reads historical trades from the dataset file, converts them to a common trade store format
+// and commits them to the given storages in batches of configured commit buffer size.
+// It returns the number of imported trades.
+func Import(ctx context.Context, cfg *config.Config, opts Options) (int, error) {
+	if opts.Channel == "" {
+		opts.Channel = "trade"
+	}
+	switch opts.Source {
+	case SourceBinanceVision:
+		if opts.Channel != "trade" && opts.Channel != "agg_trade" {
+			return 0, errors.New("binance-vision import supports only trade and agg_trade channels")
+		}
+		if opts.Market == "" {
+			return 0, errors.New("market is required for binance-vision import")
+		}
+		if opts.Exchange == "" {
+			opts.Exchange = "binance"
+		}
+	case SourceKaiko:
+		if opts.Channel != "trade" {
+			return 0, errors.New("kaiko import supports only trade channel")
+		}
+	default:
+		return 0, errors.New("source should be binance-vision or kaiko")
+	}
+
+	committers, err := newCommitters(cfg, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	r, closeFn, err := openCSV(opts.File)
+	if err != nil {
+		return 0, err
+	}
+	defer closeFn()
+
+	var count int
+	header := true
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+
+		// Some of the files have header row and some do not, so first row is skipped only if it is not a record.
+		if header {
+			header = false
+			if _, err := strconv.ParseUint(rec[0], 10, 64); err != nil {
+				continue
+			}
+		}
+
+		var trade storage.Trade
+		if opts.Source == SourceBinanceVision {
+			trade, err = binanceVisionTrade(rec, opts)
+		} else {
+			trade, err = kaikoTrade(rec, opts)
+		}
+		if err != nil {
+			return count, errors.Wrapf(err, "record %d", count+1)
+		}
+
+		for _, c := range committers {
+			c.buf = append(c.buf, trade)
+			if len(c.buf) == c.bufSize {
+				if err := c.commit(ctx, c.buf); err != nil {
+					return count, err
+				}
+				c.buf = make([]storage.Trade, 0, c.bufSize)
+			}
+		}
+		count++
+
+		if ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+	}
+
+	// Commit the remaining trades which did not fill the buffer.
+	for _, c := range committers {
+		if len(c.buf) > 0 {
+			if err := c.commit(ctx, c.buf); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, nil
+}
+
+// newCommitters connects to the given storages and prepares commit function for the channel.
+func newCommitters(cfg *config.Config, opts Options) ([]*committer, error) {
+	if len(opts.Storages) == 0 {
+		return nil, errors.New("at least one storage is required")
+	}
+	aggTrade := opts.Channel == "agg_trade"
+	var committers []*committer
+	for _, str := range opts.Storages {
+		switch str {
+		case "terminal":
+			ter := storage.InitTerminal(os.Stdout)
+			c := committer{bufSize: cfg.Connection.Terminal.TradeCommitBuf, commit: ter.CommitTrades}
+			if aggTrade {
+				c.bufSize = cfg.Connection.Terminal.AggTradeCommitBuf
+				c.commit = ter.CommitAggTrades
+			}
+			committers = append(committers, &c)
+		case "mysql":
+			mysql, err := storage.InitMySQL(&cfg.Connection.MySQL)
+			if err != nil {
+				return nil, errors.Wrap(err, "mysql connection")
+			}
+			c := committer{bufSize: cfg.Connection.MySQL.TradeCommitBuf, commit: mysql.CommitTrades}
+			if aggTrade {
+				c.bufSize = cfg.Connection.MySQL.AggTradeCommitBuf
+				c.commit = mysql.CommitAggTrades
+			}
+			committers = append(committers, &c)
+		case "elastic_search":
+			es, err := storage.InitElasticSearch(&cfg.Connection.ES)
+			if err != nil {
+				return nil, errors.Wrap(err, "elastic search connection")
+			}
+			c := committer{bufSize: cfg.Connection.ES.TradeCommitBuf, commit: es.CommitTrades}
+			if aggTrade {
+				c.bufSize = cfg.Connection.ES.AggTradeCommitBuf
+				c.commit = es.CommitAggTrades
+			}
+			committers = append(committers, &c)
+		default:
+			return nil, errors.Errorf("storage %s is not supported for import", str)
+		}
+	}
+	for _, c := range committers {
+		if c.bufSize < 1 {
+			c.bufSize = 1
+		}
+		c.buf = make([]storage.Trade, 0, c.bufSize)
+	}
+	return committers, nil
+}
+
+// openCSV opens the CSV file directly or the first CSV file inside the zip archive,
+// which is the format of Binance Vision downloads.
+func openCSV(path string) (*csv.Reader, func(), error) {
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, f := range zr.File {
+			if !strings.EqualFold(filepath.Ext(f.Name), ".csv") {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				zr.Close()
+				return nil, nil, err
+			}
+			return newCSVReader(rc), func() {
+				rc.Close()
+				zr.Close()
+			}, nil
+		}
+		zr.Close()
+		return nil, nil, errors.New("no csv file found in the zip archive")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newCSVReader(f), func() { f.Close() }, nil
+}
+
+func newCSVReader(r io.Reader) *csv.Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	return cr
+}
+
+// binanceVisionTrade converts Binance Vision trades or aggTrades CSV record.
+// trades : id, price, qty, quote_qty, time, is_buyer_maker, is_best_match
+// aggTrades : agg_trade_id, price, qty, first_trade_id, last_trade_id, time, is_buyer_maker, is_best_match
+func binanceVisionTrade(rec []string, opts Options) (storage.Trade, error) {
+	timeIdx, makerIdx := 4, 5
+	if opts.Channel == "agg_trade" {
+		timeIdx, makerIdx = 5, 6
+	}
+	if len(rec) <= makerIdx {
+		return storage.Trade{}, errors.New("not enough fields in the record")
+	}
+
+	price, err := strconv.ParseFloat(rec[1], 64)
+	if err != nil {
+		return storage.Trade{}, err
+	}
+	size, err := strconv.ParseFloat(rec[2], 64)
+	if err != nil {
+		return storage.Trade{}, err
+	}
+	ts, err := strconv.ParseInt(rec[timeIdx], 10, 64)
+	if err != nil {
+		return storage.Trade{}, err
+	}
+	maker, err := strconv.ParseBool(rec[makerIdx])
+	if err != nil {
+		return storage.Trade{}, err
+	}
+
+	// Time is in milliseconds for older files and microseconds for the newer spot ones.
+	var timestamp time.Time
+	if ts > 1e14 {
+		timestamp = time.Unix(0, ts*int64(time.Microsecond)).UTC()
+	} else {
+		timestamp = time.Unix(0, ts*int64(time.Millisecond)).UTC()
+	}
+
+	// Side is set in the same way as for the live binance trades.
+	side := "sell"
+	if maker {
+		side = "buy"
+	}
+
+	return storage.Trade{
+		Exchange:      opts.Exchange,
+		MktID:         strings.ToUpper(opts.Market),
+		MktCommitName: opts.Market,
+		TradeID:       rec[0],
+		Side:          side,
+		Size:          size,
+		Price:         price,
+		IsBuyerMaker:  maker,
+		Timestamp:     timestamp,
+	}, nil
+}
+
+// kaikoTrade converts Kaiko trades CSV export record.
+// id, exchange, symbol, date, price, amount, sell
+func kaikoTrade(rec []string, opts Options) (storage.Trade, error) {
+	if len(rec) < 7 {
+		return storage.Trade{}, errors.New("not enough fields in the record")
+	}
+
+	ts, err := strconv.ParseInt(rec[3], 10, 64)
+	if err != nil {
+		return storage.Trade{}, err
+	}
+	price, err := strconv.ParseFloat(rec[4], 64)
+	if err != nil {
+		return storage.Trade{}, err
+	}
+	size, err := strconv.ParseFloat(rec[5], 64)
+	if err != nil {
+		return storage.Trade{}, err
+	}
+
+	// Sell flag is of the taker, empty if the exchange does not give the side.
+	var side string
+	var maker bool
+	switch strings.ToLower(rec[6]) {
+	case "true":
+		side = "sell"
+		maker = true
+	case "false":
+		side = "buy"
+	}
+
+	exchange := opts.Exchange
+	if exchange == "" {
+		exchange = rec[1]
+	}
+	market := opts.Market
+	if market == "" {
+		market = rec[2]
+	}
+
+	return storage.Trade{
+		Exchange:      exchange,
+		MktID:         rec[2],
+		MktCommitName: market,
+		TradeID:       rec[0],
+		Side:          side,
+		Size:          size,
+		Price:         price,
+		IsBuyerMaker:  maker,
+		Timestamp:     time.Unix(0, ts*int64(time.Millisecond)).UTC(),
+	}, nil
+}
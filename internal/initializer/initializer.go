@@ -3,14 +3,18 @@ package initializer
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/milkywaybrain/cryptogalaxy/internal/alert"
+	"github.com/milkywaybrain/cryptogalaxy/internal/arbitrage"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
 	"github.com/milkywaybrain/cryptogalaxy/internal/connector"
 	"github.com/milkywaybrain/cryptogalaxy/internal/exchange"
+	"github.com/milkywaybrain/cryptogalaxy/internal/metrics"
 	"github.com/milkywaybrain/cryptogalaxy/internal/storage"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -19,6 +23,40 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
+// tickerTradeStorages are the storages which support only ticker and trade data.
+var tickerTradeStorages = map[string]bool{
+	"timescale":        true,
+	"clickhouse":       true,
+	"questdb":          true,
+	"redis":            true,
+	"sqlite":           true,
+	"parquet":          true,
+	"file":             true,
+	"s3":               true,
+	"bigquery":         true,
+	"kinesis":          true,
+	"mqtt":             true,
+	"cassandra":        true,
+	"tdengine":         true,
+	"remote_write":     true,
+	"event_hubs":       true,
+	"snowflake":        true,
+	"delta":            true,
+	"redis_timeseries": true,
+	"cratedb":          true,
+	"opensearch":       true,
+	"timestream":       true,
+	"grpc":             true,
+	"zeromq":           true,
+	"ws_server":        true,
+}
+
+// tickerStorages are the storages which support only ticker data.
+var tickerStorages = map[string]bool{
+	"remote_write":     true,
+	"redis_timeseries": true,
+}
+
 // Start will initialize various required systems and then execute the app.
 func Start(mainCtx context.Context, cfg *config.Config) error {
 
@@ -52,58 +90,864 @@ func Start(mainCtx context.Context, cfg *config.Config) error {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
 
-	fileLogger := zerolog.New(logFile).With().Timestamp().Logger()
+	// Logs are also written to stderr in case of terminal JSONL output, as the stdout is for the records only.
+	var logOut io.Writer = logFile
+	if cfg.Connection.Terminal.Format == "jsonl" {
+		logOut = zerolog.MultiLevelWriter(logFile, os.Stderr)
+	}
+	fileLogger := zerolog.New(logOut).With().Timestamp().Logger()
 	log.Logger = fileLogger
 	log.Info().Msg("logger setup is done")
 
 	// Establish connections to different storage systems, connectors and
 	// also validate few user defined config values.
 	var (
-		restConn bool
-		terStr   bool
-		sqlStr   bool
-		esStr    bool
+		restConn       bool
+		terStr         bool
+		sqlStr         bool
+		esStr          bool
+		udsStr         bool
+		timescaleStr   bool
+		clickHouseStr  bool
+		questDBStr     bool
+		redisStr       bool
+		sqliteStr      bool
+		parquetStr     bool
+		fileStr        bool
+		s3Str          bool
+		bigQueryStr    bool
+		kinesisStr     bool
+		mqttStr        bool
+		cassandraStr   bool
+		tdengineStr    bool
+		remoteWriteStr bool
+		eventHubsStr   bool
+		snowflakeStr   bool
+		deltaStr       bool
+		redisTSStr     bool
+		crateDBStr     bool
+		openSearchStr  bool
+		timestreamStr  bool
+		grpcStr        bool
+		zeroMQStr      bool
+		wsServerStr    bool
 	)
+	connectStorage := func(str string) error {
+		switch str {
+		case "terminal":
+			if !terStr {
+				if cfg.Connection.Terminal.TUIRefreshIntSec < 0 {
+					err = errors.New("terminal tui_refresh_interval_sec should not be negative")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				switch cfg.Connection.Terminal.Format {
+				case "", "text":
+				case "jsonl":
+					if cfg.Connection.Terminal.TUI {
+						err = errors.New("terminal tui can not be used with jsonl format")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+				default:
+					err = errors.Errorf("terminal format %s is not supported, it should be text or jsonl", cfg.Connection.Terminal.Format)
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				ter := storage.InitTerminal(os.Stdout)
+				if cfg.Connection.Terminal.Format == "jsonl" {
+					ter.EnableJSONL()
+				}
+				if cfg.Connection.Terminal.TUI {
+					ter.EnableTUI(cfg.Connection.Terminal.TUIRefreshIntSec)
+				}
+				terStr = true
+				storage.Register("terminal", storage.GetTerminal(), cfg.Connection.Terminal.TickerCommitBuf, cfg.Connection.Terminal.TradeCommitBuf)
+				storage.SetRecordCommitBuffers("terminal", map[string]int{
+					"mark_price":     cfg.Connection.Terminal.MarkPriceCommitBuf,
+					"bbo":            cfg.Connection.Terminal.BBOCommitBuf,
+					"block_trade":    cfg.Connection.Terminal.BlockTradeCommitBuf,
+					"trading_status": cfg.Connection.Terminal.TradingStatusCommitBuf,
+					"agg_trade":      cfg.Connection.Terminal.AggTradeCommitBuf,
+					"orderflow":      cfg.Connection.Terminal.OrderFlowCommitBuf,
+					"instrument":     cfg.Connection.Terminal.InstrumentCommitBuf,
+					"candle":         cfg.Connection.Terminal.CandleCommitBuf,
+					"avg_price":      cfg.Connection.Terminal.AvgPriceCommitBuf,
+					"book_metric":    cfg.Connection.Terminal.BookMetricCommitBuf,
+					"market_stats":   cfg.Connection.Terminal.MarketStatsCommitBuf,
+				})
+				log.Info().Msg("terminal connected")
+			}
+		case "mysql":
+			if !sqlStr {
+				switch cfg.Connection.MySQL.TimestampPrecision {
+				case "", "ms", "us":
+				case "ns":
+					err = errors.New("mysql supports timestamp precision only upto us")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				default:
+					err = errors.New("mysql timestamp_precision should be ms or us")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				switch cfg.Connection.MySQL.Partition {
+				case "", "day", "month":
+				default:
+					err = errors.New("mysql partition should be day or month")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				if cfg.Connection.MySQL.PartitionAhead < 0 || cfg.Connection.MySQL.PartitionRetention < 0 {
+					err = errors.New("mysql partition_ahead and partition_retention should not be negative")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				if cfg.Connection.MySQL.Migrate && (len(cfg.Connection.MySQL.Names.Tables) > 0 || len(cfg.Connection.MySQL.Names.Fields) > 0) {
+					err = errors.New("mysql migrate can not be used with the custom table or field names")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				if cfg.Connection.MySQL.CreateSchema && (!cfg.Connection.MySQL.Migrate || cfg.Connection.MySQL.Schema == "") {
+					err = errors.New("mysql create_schema should be used with migrate and schema set, to create its tables as well")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				_, err = storage.InitMySQL(&cfg.Connection.MySQL)
+				if err != nil {
+					err = errors.Wrap(err, "mysql connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				if cfg.Connection.MySQL.Migrate {
+					err = storage.GetMySQL().Migrate(context.Background())
+					if err != nil {
+						err = errors.Wrap(err, "mysql migration")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					log.Info().Msg("mysql schema migrated")
+				}
+				sqlStr = true
+				storage.Register("mysql", storage.GetMySQL(), cfg.Connection.MySQL.TickerCommitBuf, cfg.Connection.MySQL.TradeCommitBuf)
+				storage.SetRecordCommitBuffers("mysql", map[string]int{
+					"mark_price":     cfg.Connection.MySQL.MarkPriceCommitBuf,
+					"bbo":            cfg.Connection.MySQL.BBOCommitBuf,
+					"block_trade":    cfg.Connection.MySQL.BlockTradeCommitBuf,
+					"trading_status": cfg.Connection.MySQL.TradingStatusCommitBuf,
+					"agg_trade":      cfg.Connection.MySQL.AggTradeCommitBuf,
+					"instrument":     cfg.Connection.MySQL.InstrumentCommitBuf,
+					"candle":         cfg.Connection.MySQL.CandleCommitBuf,
+					"avg_price":      cfg.Connection.MySQL.AvgPriceCommitBuf,
+					"book_metric":    cfg.Connection.MySQL.BookMetricCommitBuf,
+					"market_stats":   cfg.Connection.MySQL.MarketStatsCommitBuf,
+				})
+				log.Info().Msg("mysql connected")
+			}
+		case "elastic_search":
+			if !esStr {
+				switch cfg.Connection.ES.IndexSuffix {
+				case "", "day", "month":
+				default:
+					err = errors.New("elastic search index_suffix should be day or month")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				if cfg.Connection.ES.ILMDeleteAfterDays < 0 || cfg.Connection.ES.BulkWorkers < 0 || cfg.Connection.ES.BulkFlushSizeKB < 0 {
+					err = errors.New("elastic search ilm_delete_after_days, bulk_workers and bulk_flush_size_kb should not be negative")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				if len(cfg.Connection.ES.Addresses) > 0 && cfg.Connection.ES.CloudID != "" {
+					err = errors.New("elastic search addresses and cloud_id should not be set together")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				if cfg.Connection.ES.AWSSigV4 && (cfg.Connection.ES.AWSRegion == "" || cfg.Connection.ES.Username != "" || cfg.Connection.ES.APIKey != "") {
+					err = errors.New("elastic search aws_sigv4 needs aws_region and should not be set with username or api_key")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				_, err = storage.InitElasticSearch(&cfg.Connection.ES)
+				if err != nil {
+					err = errors.Wrap(err, "elastic search connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				if cfg.Connection.ES.IndexSuffix != "" || cfg.Connection.ES.CreateIndices {
+					err = storage.GetElasticSearch().SetupIndices(context.Background())
+					if err != nil {
+						err = errors.Wrap(err, "elastic search index setup")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					log.Info().Msg("elastic search indices set up")
+				}
+				esStr = true
+				storage.Register("elastic_search", storage.GetElasticSearch(), cfg.Connection.ES.TickerCommitBuf, cfg.Connection.ES.TradeCommitBuf)
+				storage.SetRecordCommitBuffers("elastic_search", map[string]int{
+					"mark_price":     cfg.Connection.ES.MarkPriceCommitBuf,
+					"bbo":            cfg.Connection.ES.BBOCommitBuf,
+					"block_trade":    cfg.Connection.ES.BlockTradeCommitBuf,
+					"trading_status": cfg.Connection.ES.TradingStatusCommitBuf,
+					"agg_trade":      cfg.Connection.ES.AggTradeCommitBuf,
+					"orderflow":      cfg.Connection.ES.OrderFlowCommitBuf,
+					"instrument":     cfg.Connection.ES.InstrumentCommitBuf,
+					"candle":         cfg.Connection.ES.CandleCommitBuf,
+					"avg_price":      cfg.Connection.ES.AvgPriceCommitBuf,
+					"book_metric":    cfg.Connection.ES.BookMetricCommitBuf,
+					"market_stats":   cfg.Connection.ES.MarketStatsCommitBuf,
+				})
+				log.Info().Msg("elastic search connected")
+			}
+		case "uds":
+			if !udsStr {
+				_, err = storage.InitUDS(&cfg.Connection.UDS)
+				if err != nil {
+					err = errors.Wrap(err, "unix domain socket listen")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				udsStr = true
+				storage.Register("uds", storage.GetUDS(), cfg.Connection.UDS.TickerCommitBuf, cfg.Connection.UDS.TradeCommitBuf)
+				storage.SetRecordCommitBuffers("uds", map[string]int{
+					"mark_price":     cfg.Connection.UDS.MarkPriceCommitBuf,
+					"bbo":            cfg.Connection.UDS.BBOCommitBuf,
+					"block_trade":    cfg.Connection.UDS.BlockTradeCommitBuf,
+					"trading_status": cfg.Connection.UDS.TradingStatusCommitBuf,
+					"agg_trade":      cfg.Connection.UDS.AggTradeCommitBuf,
+					"orderflow":      cfg.Connection.UDS.OrderFlowCommitBuf,
+					"instrument":     cfg.Connection.UDS.InstrumentCommitBuf,
+					"candle":         cfg.Connection.UDS.CandleCommitBuf,
+					"avg_price":      cfg.Connection.UDS.AvgPriceCommitBuf,
+					"book_metric":    cfg.Connection.UDS.BookMetricCommitBuf,
+					"market_stats":   cfg.Connection.UDS.MarketStatsCommitBuf,
+				})
+				log.Info().Msg("unix domain socket listening")
+			}
+		case "timescale":
+			if !timescaleStr {
+				_, err = storage.InitTimescale(&cfg.Connection.Timescale)
+				if err != nil {
+					err = errors.Wrap(err, "timescale connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				timescaleStr = true
+				storage.Register("timescale", storage.GetTimescale(), cfg.Connection.Timescale.TickerCommitBuf, cfg.Connection.Timescale.TradeCommitBuf)
+				log.Info().Msg("timescale connected")
+			}
+		case "clickhouse":
+			if !clickHouseStr {
+				_, err = storage.InitClickHouse(&cfg.Connection.ClickHouse)
+				if err != nil {
+					err = errors.Wrap(err, "clickhouse connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				clickHouseStr = true
+				storage.Register("clickhouse", storage.GetClickHouse(), cfg.Connection.ClickHouse.TickerCommitBuf, cfg.Connection.ClickHouse.TradeCommitBuf)
+				log.Info().Msg("clickhouse connected")
+			}
+		case "questdb":
+			if !questDBStr {
+				_, err = storage.InitQuestDB(&cfg.Connection.QuestDB)
+				if err != nil {
+					err = errors.Wrap(err, "questdb connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				questDBStr = true
+				storage.Register("questdb", storage.GetQuestDB(), cfg.Connection.QuestDB.TickerCommitBuf, cfg.Connection.QuestDB.TradeCommitBuf)
+				log.Info().Msg("questdb connected")
+			}
+		case "redis":
+			if !redisStr {
+				_, err = storage.InitRedis(&cfg.Connection.Redis)
+				if err != nil {
+					err = errors.Wrap(err, "redis connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				redisStr = true
+				storage.Register("redis", storage.GetRedis(), cfg.Connection.Redis.TickerCommitBuf, cfg.Connection.Redis.TradeCommitBuf)
+				log.Info().Msg("redis connected")
+			}
+		case "sqlite":
+			if !sqliteStr {
+				switch strings.ToUpper(cfg.Connection.SQLite.Synchronous) {
+				case "", "OFF", "NORMAL", "FULL", "EXTRA":
+				default:
+					err = errors.New("sqlite synchronous should be OFF, NORMAL, FULL or EXTRA")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				_, err = storage.InitSQLite(&cfg.Connection.SQLite)
+				if err != nil {
+					err = errors.Wrap(err, "sqlite connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				sqliteStr = true
+				storage.Register("sqlite", storage.GetSQLite(), cfg.Connection.SQLite.TickerCommitBuf, cfg.Connection.SQLite.TradeCommitBuf)
+				log.Info().Msg("sqlite connected")
+			}
+		case "parquet":
+			if !parquetStr {
+				_, err = storage.InitParquet(&cfg.Connection.Parquet)
+				if err != nil {
+					err = errors.Wrap(err, "parquet files")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				parquetStr = true
+				storage.Register("parquet", storage.GetParquet(), cfg.Connection.Parquet.TickerCommitBuf, cfg.Connection.Parquet.TradeCommitBuf)
+				log.Info().Msg("parquet files ready")
+			}
+		case "file":
+			if !fileStr {
+				_, err = storage.InitFile(&cfg.Connection.File)
+				if err != nil {
+					err = errors.Wrap(err, "flat files")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				fileStr = true
+				storage.Register("file", storage.GetFile(), cfg.Connection.File.TickerCommitBuf, cfg.Connection.File.TradeCommitBuf)
+				log.Info().Msg("flat files ready")
+			}
+		case "s3":
+			if !s3Str {
+				if cfg.Connection.S3.Bucket == "" {
+					err = errors.New("s3 bucket should be set")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				if cfg.Connection.S3.PartSizeMB != 0 && cfg.Connection.S3.PartSizeMB < 5 {
+					err = errors.New("s3 part_size_mb should be at least 5")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				_, err = storage.InitS3(&cfg.Connection.S3)
+				if err != nil {
+					err = errors.Wrap(err, "s3 session")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				s3Str = true
+				storage.Register("s3", storage.GetS3(), cfg.Connection.S3.TickerCommitBuf, cfg.Connection.S3.TradeCommitBuf)
+				log.Info().Msg("s3 uploader ready")
+			}
+		case "bigquery":
+			if !bigQueryStr {
+				if cfg.Connection.BigQuery.ProjectID == "" || cfg.Connection.BigQuery.Dataset == "" {
+					err = errors.New("bigquery project_id and dataset should be set")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				_, err = storage.InitBigQuery(&cfg.Connection.BigQuery)
+				if err != nil {
+					err = errors.Wrap(err, "bigquery connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				bigQueryStr = true
+				storage.Register("bigquery", storage.GetBigQuery(), cfg.Connection.BigQuery.TickerCommitBuf, cfg.Connection.BigQuery.TradeCommitBuf)
+				log.Info().Msg("bigquery connected")
+			}
+		case "kinesis":
+			if !kinesisStr {
+				_, err = storage.InitKinesis(&cfg.Connection.Kinesis)
+				if err != nil {
+					err = errors.Wrap(err, "kinesis connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				kinesisStr = true
+				storage.Register("kinesis", storage.GetKinesis(), cfg.Connection.Kinesis.TickerCommitBuf, cfg.Connection.Kinesis.TradeCommitBuf)
+				log.Info().Msg("kinesis connected")
+			}
+		case "mqtt":
+			if !mqttStr {
+				if cfg.Connection.MQTT.QoS > 2 {
+					err = errors.New("mqtt qos should be 0, 1 or 2")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				_, err = storage.InitMQTT(&cfg.Connection.MQTT)
+				if err != nil {
+					err = errors.Wrap(err, "mqtt connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				mqttStr = true
+				storage.Register("mqtt", storage.GetMQTT(), cfg.Connection.MQTT.TickerCommitBuf, cfg.Connection.MQTT.TradeCommitBuf)
+				log.Info().Msg("mqtt connected")
+			}
+		case "cassandra":
+			if !cassandraStr {
+				_, err = storage.InitCassandra(&cfg.Connection.Cassandra)
+				if err != nil {
+					err = errors.Wrap(err, "cassandra connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				cassandraStr = true
+				storage.Register("cassandra", storage.GetCassandra(), cfg.Connection.Cassandra.TickerCommitBuf, cfg.Connection.Cassandra.TradeCommitBuf)
+				log.Info().Msg("cassandra connected")
+			}
+		case "tdengine":
+			if !tdengineStr {
+				_, err = storage.InitTDengine(&cfg.Connection.TDengine)
+				if err != nil {
+					err = errors.Wrap(err, "tdengine connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				tdengineStr = true
+				storage.Register("tdengine", storage.GetTDengine(), cfg.Connection.TDengine.TickerCommitBuf, cfg.Connection.TDengine.TradeCommitBuf)
+				log.Info().Msg("tdengine connected")
+			}
+		case "remote_write":
+			if !remoteWriteStr {
+				if cfg.Connection.RemoteWrite.URL == "" {
+					err = errors.New("remote_write URL is required")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				_, err = storage.InitRemoteWrite(&cfg.Connection.RemoteWrite)
+				if err != nil {
+					err = errors.Wrap(err, "remote_write connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				remoteWriteStr = true
+				storage.Register("remote_write", storage.GetRemoteWrite(), cfg.Connection.RemoteWrite.TickerCommitBuf, 0)
+				log.Info().Msg("remote_write connected")
+			}
+		case "event_hubs":
+			if !eventHubsStr {
+				if cfg.Connection.EventHubs.ConnectionString == "" {
+					err = errors.New("event_hubs connection_string is required")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				_, err = storage.InitEventHubs(&cfg.Connection.EventHubs)
+				if err != nil {
+					err = errors.Wrap(err, "event_hubs connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				eventHubsStr = true
+				storage.Register("event_hubs", storage.GetEventHubs(), cfg.Connection.EventHubs.TickerCommitBuf, cfg.Connection.EventHubs.TradeCommitBuf)
+				log.Info().Msg("event_hubs connected")
+			}
+		case "snowflake":
+			if !snowflakeStr {
+				if cfg.Connection.Snowflake.Account == "" {
+					err = errors.New("snowflake account is required")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				_, err = storage.InitSnowflake(&cfg.Connection.Snowflake)
+				if err != nil {
+					err = errors.Wrap(err, "snowflake connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				snowflakeStr = true
+				storage.Register("snowflake", storage.GetSnowflake(), cfg.Connection.Snowflake.TickerCommitBuf, cfg.Connection.Snowflake.TradeCommitBuf)
+				log.Info().Msg("snowflake connected")
+			}
+		case "delta":
+			if !deltaStr {
+				if cfg.Connection.Delta.Bucket == "" {
+					err = errors.New("delta bucket should be set")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				_, err = storage.InitDelta(&cfg.Connection.Delta)
+				if err != nil {
+					err = errors.Wrap(err, "delta tables")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				deltaStr = true
+				storage.Register("delta", storage.GetDelta(), cfg.Connection.Delta.TickerCommitBuf, cfg.Connection.Delta.TradeCommitBuf)
+				log.Info().Msg("delta tables ready")
+			}
+		case "redis_timeseries":
+			if !redisTSStr {
+				_, err = storage.InitRedisTimeSeries(&cfg.Connection.RedisTS)
+				if err != nil {
+					err = errors.Wrap(err, "redis timeseries connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				redisTSStr = true
+				storage.Register("redis_timeseries", storage.GetRedisTimeSeries(), cfg.Connection.RedisTS.TickerCommitBuf, 0)
+				log.Info().Msg("redis timeseries connected")
+			}
+		case "cratedb":
+			if !crateDBStr {
+				_, err = storage.InitCrateDB(&cfg.Connection.CrateDB)
+				if err != nil {
+					err = errors.Wrap(err, "cratedb connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				crateDBStr = true
+				storage.Register("cratedb", storage.GetCrateDB(), cfg.Connection.CrateDB.TickerCommitBuf, cfg.Connection.CrateDB.TradeCommitBuf)
+				log.Info().Msg("cratedb connected")
+			}
+		case "opensearch":
+			if !openSearchStr {
+				_, err = storage.InitOpenSearch(&cfg.Connection.OpenSearch)
+				if err != nil {
+					err = errors.Wrap(err, "opensearch connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				openSearchStr = true
+				storage.Register("opensearch", storage.GetOpenSearch(), cfg.Connection.OpenSearch.TickerCommitBuf, cfg.Connection.OpenSearch.TradeCommitBuf)
+				log.Info().Msg("opensearch connected")
+			}
+		case "timestream":
+			if !timestreamStr {
+				if cfg.Connection.Timestream.Database == "" {
+					err = errors.New("timestream database should be set")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				_, err = storage.InitTimestream(&cfg.Connection.Timestream)
+				if err != nil {
+					err = errors.Wrap(err, "timestream connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				timestreamStr = true
+				storage.Register("timestream", storage.GetTimestream(), cfg.Connection.Timestream.TickerCommitBuf, cfg.Connection.Timestream.TradeCommitBuf)
+				log.Info().Msg("timestream connected")
+			}
+		case "grpc":
+			if !grpcStr {
+				if cfg.Connection.GRPC.Address == "" {
+					err = errors.New("grpc address should be set")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				_, err = storage.InitGRPC(&cfg.Connection.GRPC)
+				if err != nil {
+					err = errors.Wrap(err, "grpc connection")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				grpcStr = true
+				storage.Register("grpc", storage.GetGRPC(), cfg.Connection.GRPC.TickerCommitBuf, cfg.Connection.GRPC.TradeCommitBuf)
+				log.Info().Msg("grpc connected")
+			}
+		case "zeromq":
+			if !zeroMQStr {
+				if cfg.Connection.ZeroMQ.Endpoint == "" {
+					err = errors.New("zeromq endpoint should be set")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				_, err = storage.InitZeroMQ(&cfg.Connection.ZeroMQ)
+				if err != nil {
+					err = errors.Wrap(err, "zeromq publisher")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				zeroMQStr = true
+				storage.Register("zeromq", storage.GetZeroMQ(), cfg.Connection.ZeroMQ.TickerCommitBuf, cfg.Connection.ZeroMQ.TradeCommitBuf)
+				log.Info().Msg("zeromq publisher ready")
+			}
+		case "ws_server":
+			if !wsServerStr {
+				_, err = storage.InitWSServer(&cfg.Connection.WSServer)
+				if err != nil {
+					err = errors.Wrap(err, "websocket server listen")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				wsServerStr = true
+				storage.Register("ws_server", storage.GetWSServer(), cfg.Connection.WSServer.TickerCommitBuf, cfg.Connection.WSServer.TradeCommitBuf)
+				log.Info().Msg("websocket server listening")
+			}
+		default:
+			name := strings.TrimPrefix(str, storage.PluginPrefix)
+			if name == str || storage.GetPlugin(name) != nil {
+				break
+			}
+			var pluginCfg *config.Plugin
+			for i := range cfg.Connection.Plugins {
+				if cfg.Connection.Plugins[i].Name == name {
+					pluginCfg = &cfg.Connection.Plugins[i]
+				}
+			}
+			if pluginCfg == nil {
+				err = errors.Errorf("plugin %s should be configured in connection plugins", name)
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+			if (pluginCfg.Path == "") == (pluginCfg.Address == "") {
+				err = errors.Errorf("plugin %s should have either path or address set", name)
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+			_, err = storage.InitPlugin(pluginCfg)
+			if err != nil {
+				err = errors.Wrap(err, "plugin connection")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+			storage.Register(str, storage.GetPlugin(name), pluginCfg.TickerCommitBuf, pluginCfg.TradeCommitBuf)
+			log.Info().Str("plugin", name).Msg("plugin connected")
+		}
+		return nil
+	}
+	restCfg := cfg.Connection.REST
+	if restCfg.DialTimeoutSec < 0 || restCfg.TLSHandshakeTimeoutSec < 0 || restCfg.ResponseHeaderTimeoutSec < 0 || restCfg.IdleConnTimeoutSec < 0 {
+		err = errors.New("rest dial_timeout_sec, tls_handshake_timeout_sec, response_header_timeout_sec and idle_conn_timeout_sec should not be negative")
+		log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+		return err
+	}
+	if restCfg.BreakerFailures < 0 || restCfg.BreakerOpenSec < 0 {
+		err = errors.New("rest breaker_failures and breaker_open_sec should not be negative")
+		log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+		return err
+	}
+	if err = connector.SetProxy("", &cfg.Connection.Proxy); err != nil {
+		log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+		return err
+	}
+	if err = connector.SetTLS("", &cfg.Connection.TLS); err != nil {
+		log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+		return err
+	}
+	if err = connector.SetHeaders("", cfg.Connection.Headers); err != nil {
+		log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+		return err
+	}
 	for _, exch := range cfg.Exchanges {
+		exchMod, ok := exchange.GetExchange(exch.Name)
+		if !ok {
+			err = errors.Errorf("%s exchange is not supported", exch.Name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if exch.Retry.JitterPercent < 0 || exch.Retry.JitterPercent > 100 {
+			err = errors.New("retry jitter_percent should be between 0 and 100")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if exch.Websocket.ReconnectAttempts < 0 || exch.Websocket.ReconnectGapSec < 0 || exch.Websocket.MaxSubscriptions < 0 || exch.Websocket.MessagesPer10Sec < 0 {
+			err = errors.New("websocket reconnect_attempts, reconnect_gap_sec, max_subscriptions and messages_per_10_sec should not be negative")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if exch.Websocket.FrameDecoder != "" && !connector.IsFrameDecoder(exch.Websocket.FrameDecoder) {
+			err = errors.Errorf("websocket frame_decoder %s is not supported", exch.Websocket.FrameDecoder)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if exch.REST.RequestsPerSec < 0 || exch.REST.MaxConcurrentRequests < 0 {
+			err = errors.New("rest requests_per_sec and max_concurrent_requests should not be negative")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if exch.REST.JitterPercent < 0 || exch.REST.JitterPercent > 100 {
+			err = errors.New("rest jitter_percent should be between 0 and 100")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		exchWS := exch.Websocket
+		connector.SetExchangeWS(exch.Name, &exchWS)
+		exchREST := exch.REST
+		connector.SetExchangeREST(exch.Name, &exchREST)
+		if err = connector.SetProxy(exch.Name, &exch.Proxy); err != nil {
+			err = errors.Wrapf(err, "%s exchange", exch.Name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if err = connector.SetTLS(exch.Name, &exch.TLS); err != nil {
+			err = errors.Wrapf(err, "%s exchange", exch.Name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if err = connector.SetHeaders(exch.Name, exch.Headers); err != nil {
+			err = errors.Wrapf(err, "%s exchange", exch.Name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if err = connector.SetEndpoints(exch.Name, &exch.Endpoints); err != nil {
+			err = errors.Wrapf(err, "%s exchange", exch.Name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
 		for _, market := range exch.Markets {
 			for _, info := range market.Info {
 				for _, str := range info.Storages {
-					switch str {
-					case "terminal":
-						if !terStr {
-							_ = storage.InitTerminal(os.Stdout)
-							terStr = true
-							log.Info().Msg("terminal connected")
+					if tickerStorages[str] && info.Channel != "ticker" {
+						err = errors.Errorf("%s storage is supported only for ticker channel", str)
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					if (tickerTradeStorages[str] || strings.HasPrefix(str, storage.PluginPrefix)) && info.Channel != "ticker" && info.Channel != "trade" {
+						err = errors.Errorf("%s storage is supported only for ticker and trade channels", str)
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					if err = connectStorage(str); err != nil {
+						return err
+					}
+				}
+				if !exchMod.Supports(info.Channel, info.Connector) {
+					if names := exchange.ChannelExchanges(info.Channel, info.Connector); len(names) > 0 {
+						err = errors.Errorf("%s channel is supported through %s connector only for %s exchanges", info.Channel, info.Connector, strings.Join(names, ", "))
+					} else {
+						err = errors.Errorf("%s channel is not supported through %s connector", info.Channel, info.Connector)
+					}
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				if info.Channel == "orderflow" {
+					for _, str := range info.Storages {
+						if str == "mysql" {
+							err = errors.New("orderflow channel is supported only for terminal, elastic_search and uds storages")
+							log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+							return err
+						}
+					}
+				}
+				if len(info.BookLevels) > 0 {
+					if info.Channel != "book_metric" {
+						err = errors.New("book_levels is supported only for book_metric channel")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					for _, level := range info.BookLevels {
+						if level < 1 || level > 100 {
+							err = errors.Errorf("book level %d should be between 1 and 100", level)
+							log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+							return err
+						}
+					}
+				}
+				if len(info.CandleIntervals) > 0 {
+					if info.Channel != "trade" || info.Connector != "websocket" {
+						err = errors.New("candle_intervals is supported only for trade channel through websocket connector")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					for _, interval := range info.CandleIntervals {
+						d, err := time.ParseDuration(interval)
+						if err != nil || d < time.Second || d%time.Second != 0 || (24*time.Hour)%d != 0 {
+							err = errors.Errorf("candle interval %s should be of whole seconds which divides a day, e.g. 1s, 1m, 5m", interval)
+							log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+							return err
 						}
-					case "mysql":
-						if !sqlStr {
-							_, err = storage.InitMySQL(&cfg.Connection.MySQL)
-							if err != nil {
-								err = errors.Wrap(err, "mysql connection")
-								log.Error().Stack().Err(errors.WithStack(err)).Msg("")
-								return err
-							}
-							sqlStr = true
-							log.Info().Msg("mysql connected")
+					}
+				}
+				if info.CandleValidation != nil {
+					if len(info.CandleIntervals) == 0 || !exchange.CandleValidationSupported(exch.Name) {
+						err = errors.New("candle_validation is supported only along with candle_intervals for binance and kucoin exchanges")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					if info.CandleValidation.TolerancePercent < 0 || info.CandleValidation.VolumeTolerancePercent < 0 || info.CandleValidation.DelaySec < 0 {
+						err = errors.New("candle_validation tolerance_percent, volume_tolerance_percent and delay_sec should not be negative")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+				}
+				if len(info.AvgPriceWindows) > 0 {
+					if info.Channel != "trade" || info.Connector != "websocket" {
+						err = errors.New("avg_price_windows is supported only for trade channel through websocket connector")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					for _, window := range info.AvgPriceWindows {
+						d, err := time.ParseDuration(window)
+						if err != nil || d < time.Second || d%time.Second != 0 {
+							err = errors.Errorf("average price window %s should be of whole seconds, e.g. 30s, 1m, 15m", window)
+							log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+							return err
 						}
-					case "elastic_search":
-						if !esStr {
-							_, err = storage.InitElasticSearch(&cfg.Connection.ES)
-							if err != nil {
-								err = errors.Wrap(err, "elastic search connection")
-								log.Error().Stack().Err(errors.WithStack(err)).Msg("")
-								return err
-							}
-							esStr = true
-							log.Info().Msg("elastic search connected")
+					}
+				}
+				if info.StatsIntervalSec != 0 && (info.StatsIntervalSec < 0 || info.Channel != "trade" || info.Connector != "websocket") {
+					err = errors.New("stats_interval_sec should be greater than zero and is supported only for trade channel through websocket connector")
+					log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+					return err
+				}
+				for str, intSec := range info.StrConsiderIntSec {
+					if info.Connector != "websocket" {
+						err = errors.New("storage_consider_interval_sec is supported only for websocket connector")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					var found bool
+					for _, s := range info.Storages {
+						if s == str {
+							found = true
 						}
 					}
+					if !found || intSec < 0 {
+						err = errors.Errorf("storage_consider_interval_sec of %s should be of a configured storage and not negative", str)
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
 				}
-				if info.Connector == "rest" {
+				if info.TickFilter != nil {
+					if info.Channel != "ticker" && info.Channel != "trade" {
+						err = errors.New("tick_filter is supported only for ticker and trade channels")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					if info.TickFilter.DeviationPercent < 0 || info.TickFilter.Window < 0 {
+						err = errors.New("tick_filter deviation_percent and window should not be negative")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					if info.TickFilter.Action != "" && info.TickFilter.Action != "flag" && info.TickFilter.Action != "drop" {
+						err = errors.New("tick_filter action should be flag or drop")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+				}
+				if info.TradeFilter != nil {
+					if info.Channel != "trade" {
+						err = errors.New("trade_filter is supported only for trade channel")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					if info.TradeFilter.Side != "" && info.TradeFilter.Side != "buy" && info.TradeFilter.Side != "sell" {
+						err = errors.New("trade_filter side should be buy or sell")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					if info.TradeFilter.MinSize < 0 || info.TradeFilter.MinPrice < 0 || info.TradeFilter.MaxPrice < 0 {
+						err = errors.New("trade_filter min_size, min_price and max_price should not be negative")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+					if info.TradeFilter.MaxPrice > 0 && info.TradeFilter.MaxPrice < info.TradeFilter.MinPrice {
+						err = errors.New("trade_filter max_price should not be less than min_price")
+						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+						return err
+					}
+				}
+
+				// Websocket server details of some exchanges, like kucoin, and the klines for the candle validation are also fetched through REST API.
+				if info.Connector == "rest" || exchMod.RESTForWebsocket || info.CandleValidation != nil {
 					if !restConn {
 						_ = connector.InitREST(&cfg.Connection.REST)
 						restConn = true
 					}
+				}
+				if info.Connector == "rest" {
 					if info.RESTPingIntSec < 1 {
 						err = errors.New("rest_ping_interval_sec should be greater than zero")
 						log.Error().Stack().Err(errors.WithStack(err)).Msg("")
@@ -114,66 +958,635 @@ func Start(mainCtx context.Context, cfg *config.Config) error {
 		}
 	}
 
+	// Connect the fx rate storages, if enabled.
+	if cfg.FX.Enabled {
+		if cfg.FX.URL == "" || len(cfg.FX.Currencies) == 0 {
+			err = errors.New("fx url and currencies should not be empty")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if cfg.FX.RefreshIntSec < 1 {
+			err = errors.New("fx refresh_interval_sec should be greater than zero")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		for _, str := range cfg.FX.Storages {
+			if tickerTradeStorages[str] || strings.HasPrefix(str, storage.PluginPrefix) {
+				err = errors.Errorf("%s storage is supported only for ticker and trade channels", str)
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+			if err = connectStorage(str); err != nil {
+				return err
+			}
+		}
+		if !restConn {
+			_ = connector.InitREST(&cfg.Connection.REST)
+			restConn = true
+		}
+	}
+
+	// Connect the coin reference data storages, if enabled.
+	if cfg.CoinGecko.Enabled {
+		if len(cfg.CoinGecko.Coins) == 0 {
+			err = errors.New("coingecko coins should not be empty")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if len(cfg.CoinGecko.Coins) > 250 {
+			err = errors.New("coingecko coins should not be more than 250")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if cfg.CoinGecko.RefreshIntSec < 1 {
+			err = errors.New("coingecko refresh_interval_sec should be greater than zero")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if cfg.CoinGecko.URL == "" {
+			cfg.CoinGecko.URL = config.CoinGeckoRESTBaseURL
+		}
+		for _, str := range cfg.CoinGecko.Storages {
+			if tickerTradeStorages[str] || strings.HasPrefix(str, storage.PluginPrefix) {
+				err = errors.Errorf("%s storage is supported only for ticker and trade channels", str)
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+			if err = connectStorage(str); err != nil {
+				return err
+			}
+		}
+		if !restConn {
+			_ = connector.InitREST(&cfg.Connection.REST)
+			restConn = true
+		}
+	}
+
+	// Reference market of the USD conversion should be one of the configured ticker or trade markets,
+	// or one of the fx currencies, otherwise its price is never received.
+	for _, exch := range cfg.Exchanges {
+		for _, market := range exch.Markets {
+			ref := market.USDReference
+			if ref == nil || strings.EqualFold(ref.Market, "USD") {
+				continue
+			}
+			refExch := ref.Exchange
+			if refExch == "" {
+				refExch = exch.Name
+			}
+			var found bool
+			if refExch == "fx" && cfg.FX.Enabled {
+				for _, cur := range cfg.FX.Currencies {
+					if strings.EqualFold(cur, ref.Market) {
+						found = true
+					}
+				}
+			}
+			for _, e := range cfg.Exchanges {
+				if e.Name != refExch {
+					continue
+				}
+				for _, m := range e.Markets {
+					if !strings.EqualFold(m.ID, ref.Market) {
+						continue
+					}
+					for _, info := range m.Info {
+						if info.Channel == "ticker" || info.Channel == "trade" {
+							found = true
+						}
+					}
+				}
+			}
+			if !found {
+				err = errors.Errorf("usd_reference market %s of exchange %s should be configured with ticker or trade channel or as fx currency", ref.Market, refExch)
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+		}
+	}
+	exchange.InitUSDReferences(cfg.Exchanges)
+
+	// Prepare price anomaly alert rules, if enabled.
+	if cfg.Alert.Enabled {
+		if cfg.Alert.WebhookURL == "" {
+			err = errors.New("alert webhook_url should not be empty")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		for _, rule := range cfg.Alert.Rules {
+			if rule.Exchange == "" || rule.Market == "" {
+				err = errors.New("alert rule exchange and market should not be empty")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+			if rule.MovePercent < 0 || rule.DeviationPercent < 0 || rule.WindowSec < 0 {
+				err = errors.New("alert rule move_percent, deviation_percent and window_sec should not be negative")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+			if rule.DeviationPercent > 0 && (rule.CompareExchange == "" || rule.CompareExchange == rule.Exchange) {
+				err = errors.New("alert rule compare_exchange should be a different exchange for deviation_percent")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+		}
+		alert.Init(&cfg.Alert)
+	}
+
+	// Prepare cross exchange spread rules, if enabled.
+	if cfg.Arbitrage.Enabled {
+		if cfg.Arbitrage.MaxAgeSec < 0 || cfg.Arbitrage.CooldownSec < 0 {
+			err = errors.New("arbitrage max_price_age_sec and cooldown_sec should not be negative")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		for _, rule := range cfg.Arbitrage.Rules {
+			if rule.Base == "" || rule.Quote == "" {
+				err = errors.New("arbitrage rule base and quote should not be empty")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+			if len(rule.Exchanges) < 2 {
+				err = errors.New("arbitrage rule should have at least two exchanges")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+			if rule.ThresholdPercent <= 0 {
+				err = errors.New("arbitrage rule threshold_percent should be greater than zero")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+			if rule.Alert && !cfg.Alert.Enabled {
+				err = errors.New("alert should be enabled for arbitrage rule alert")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+		}
+		for _, str := range cfg.Arbitrage.Storages {
+			if tickerTradeStorages[str] || strings.HasPrefix(str, storage.PluginPrefix) {
+				err = errors.Errorf("%s storage is supported only for ticker and trade channels", str)
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+			if err = connectStorage(str); err != nil {
+				return err
+			}
+		}
+		arbitrage.Init(&cfg.Arbitrage)
+	}
+
+	// Connect the fallback storages of the connected storages.
+	// Fallback is connected only if the primary is, as it is not needed otherwise.
+	for name, failover := range cfg.Connection.Failover {
+		if failover.Storage == "" || failover.Storage == name || failover.CheckIntSec < 0 {
+			err = errors.Errorf("storage_failover of %s should have a different storage set and not negative values", name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if tickerStorages[failover.Storage] {
+			err = errors.Errorf("storage_failover of %s can not be %s, as it supports only ticker channel", name, failover.Storage)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if storage.Lookup(name) == nil {
+			continue
+		}
+		if err = connectStorage(failover.Storage); err != nil {
+			return err
+		}
+		if storage.Lookup(failover.Storage) == nil {
+			err = errors.Errorf("storage_failover of %s can not be %s, as it is not a ticker and trade storage", name, failover.Storage)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		failover := failover
+		storage.SetFailover(name, &failover)
+	}
+
+	// Set the commit retry policies of the connected storages.
+	for name, retry := range cfg.Connection.Retry {
+		if retry.Number < 0 || retry.GapSec < 0 || retry.MaxGapSec < 0 || retry.BackoffMultiplier < 0 {
+			err = errors.Errorf("storage_retry of %s should not have negative values", name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		retry := retry
+		if err = storage.SetRetry(name, &retry); err != nil {
+			err = errors.Wrap(err, "storage dead-letter")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+	}
+
+	// Enable the write-ahead buffers of the connected storages.
+	var wals []*storage.Registered
+	for name, wal := range cfg.Connection.WAL {
+		if wal.Dir == "" || wal.ReplayIntSec < 0 || wal.MaxSizeMB < 0 {
+			err = errors.Errorf("storage_wal of %s should have dir set and not negative values", name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		wal := wal
+		reg, err := storage.SetWAL(name, &wal)
+		if err != nil {
+			err = errors.Wrap(err, "storage wal")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if reg != nil {
+			wals = append(wals, reg)
+		}
+	}
+
+	// Set the flush intervals of the connected storages.
+	for name, intSec := range cfg.Connection.FlushIntSec {
+		if intSec < 0 {
+			err = errors.Errorf("storage_flush_interval_sec of %s should not be negative", name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		storage.SetFlushInterval(name, intSec)
+	}
+
+	// Set the commit workers of the connected storages.
+	for name, workers := range cfg.Connection.CommitWorkers {
+		if workers < 0 {
+			err = errors.Errorf("storage_commit_workers of %s should not be negative", name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		storage.SetCommitWorkers(name, workers)
+	}
+
+	// Set the commit order of the connected storages.
+	for name, ordered := range cfg.Connection.Ordered {
+		storage.SetOrdered(name, ordered)
+	}
+
+	// Set the backpressure policies of the connected storages.
+	for name, policy := range cfg.Connection.Backpressure {
+		switch policy {
+		case "block", "drop_oldest", "drop_newest":
+		default:
+			err = errors.Errorf("storage_backpressure of %s should be block, drop_oldest or drop_newest, not %s", name, policy)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		storage.SetBackpressure(name, policy)
+	}
+
+	// Set the channel buffer sizes of the connected storages.
+	for name, size := range cfg.Connection.ChannelBuf {
+		if size < 0 {
+			err = errors.Errorf("storage_channel_buffer of %s should not be negative", name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		storage.SetChannelBuffer(name, size)
+	}
+
+	// Check the retention of the connected storages, which are deleting their own old data.
+	type retention struct {
+		name   string
+		pruner storage.Pruner
+		cfg    config.StorageRetention
+	}
+	var retentions []retention
+	for name, ret := range cfg.Connection.Retention {
+		if ret.IntervalMin < 0 {
+			err = errors.Errorf("storage_retention interval_min of %s should not be negative", name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		for channel, hours := range ret.MaxAgeHours {
+			if hours <= 0 {
+				err = errors.Errorf("storage_retention max_age_hours of %s %s should be greater than 0", name, channel)
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+		}
+		reg := storage.Lookup(name)
+		if reg == nil {
+			continue
+		}
+		pruner, ok := reg.Storage.(storage.Pruner)
+		if !ok {
+			err = errors.Errorf("storage_retention is not supported for %s", name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		retentions = append(retentions, retention{name: name, pruner: pruner, cfg: ret})
+	}
+
+	// Check the compaction of the connected storages, which are compacting their own old raw data into candles.
+	type compaction struct {
+		name      string
+		compactor storage.Compactor
+		cfg       config.StorageCompaction
+	}
+	var compactions []compaction
+	for name, comp := range cfg.Connection.Compaction {
+		if comp.IntervalMin < 0 {
+			err = errors.Errorf("storage_compaction interval_min of %s should not be negative", name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if comp.AfterDays <= 0 {
+			err = errors.Errorf("storage_compaction after_days of %s should be greater than 0", name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		if len(comp.Channels) == 0 {
+			err = errors.Errorf("storage_compaction channels of %s should not be empty", name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		for _, channel := range comp.Channels {
+			if channel != "ticker" && channel != "trade" {
+				err = errors.Errorf("storage_compaction channel of %s should be ticker or trade, not %s", name, channel)
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+				return err
+			}
+		}
+		reg := storage.Lookup(name)
+		if reg == nil {
+			continue
+		}
+		compactor, ok := reg.Storage.(storage.Compactor)
+		if !ok {
+			err = errors.Errorf("storage_compaction is not supported for %s", name)
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		compactions = append(compactions, compaction{name: name, compactor: compactor, cfg: comp})
+	}
+
+	// Archive raw websocket frames, if enabled.
+	// It is initialized before starting the exchanges, so that the websocket connections pick it up.
+	if cfg.RawArchive.Enabled {
+		if cfg.RawArchive.Dir == "" {
+			err = errors.New("raw_archive dir should be set")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		_, err = storage.InitRawArchive(&cfg.RawArchive)
+		if err != nil {
+			err = errors.Wrap(err, "raw archive")
+			log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			return err
+		}
+		log.Info().Msg("raw archive ready")
+	}
+
 	// Start each exchange function. If any exchange fails after retry, force all the other exchanges to stop and
 	// exit the app.
 	appErrGroup, appCtx := errgroup.WithContext(mainCtx)
 
+	// Expose app metrics, if enabled.
+	if cfg.Metrics.Enabled {
+		if cfg.Metrics.Path == "" {
+			cfg.Metrics.Path = "/metrics"
+		}
+		if cfg.Metrics.Latency {
+			metrics.EnableLatency()
+		}
+		appErrGroup.Go(func() error {
+			err := metrics.Serve(appCtx, &cfg.Metrics)
+			if err != nil && !errors.Is(err, appCtx.Err()) {
+				err = errors.Wrap(err, "metrics server")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			}
+			return err
+		})
+		log.Info().Str("address", cfg.Metrics.Address).Msg("metrics server started")
+	}
+
+	// Post price anomaly alerts, if enabled.
+	if cfg.Alert.Enabled {
+		appErrGroup.Go(func() error {
+			err := alert.Serve(appCtx)
+			if err != nil && !errors.Is(err, appCtx.Err()) {
+				err = errors.Wrap(err, "alert webhook")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			}
+			return err
+		})
+		log.Info().Msg("alert webhook started")
+	}
+
+	// Commit cross exchange spreads, if enabled.
+	if cfg.Arbitrage.Enabled {
+		appErrGroup.Go(func() error {
+			err := arbitrage.Serve(appCtx)
+			if err != nil && !errors.Is(err, appCtx.Err()) {
+				err = errors.Wrap(err, "arbitrage monitor")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			}
+			return err
+		})
+	}
+
+	// Maintain the mysql table partitions, if enabled.
+	if sqlStr && cfg.Connection.MySQL.Partition != "" {
+		appErrGroup.Go(func() error {
+			err := storage.GetMySQL().ServePartitions(appCtx)
+			if err != nil && !errors.Is(err, appCtx.Err()) {
+				err = errors.Wrap(err, "mysql partition")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			}
+			return err
+		})
+	}
+
+	// Upload buffered s3 objects at the end of each interval.
+	if s3Str {
+		appErrGroup.Go(func() error {
+			err := storage.GetS3().Serve(appCtx)
+			if err != nil && !errors.Is(err, appCtx.Err()) {
+				err = errors.Wrap(err, "s3 upload")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			}
+			return err
+		})
+	}
+
+	// Commit buffered delta lake data files at every commit interval.
+	if deltaStr {
+		appErrGroup.Go(func() error {
+			err := storage.GetDelta().Serve(appCtx)
+			if err != nil && !errors.Is(err, appCtx.Err()) {
+				err = errors.Wrap(err, "delta commit")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			}
+			return err
+		})
+	}
+
+	// Accept websocket broadcast clients.
+	if wsServerStr {
+		appErrGroup.Go(func() error {
+			err := storage.GetWSServer().Serve(appCtx)
+			if err != nil && !errors.Is(err, appCtx.Err()) {
+				err = errors.Wrap(err, "websocket server")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			}
+			return err
+		})
+	}
+
+	// Replay the batches spooled while the storages were down.
+	for _, reg := range wals {
+		reg := reg
+		appErrGroup.Go(func() error {
+			err := reg.WAL.Serve(appCtx, reg.Storage)
+			if err != nil && !errors.Is(err, appCtx.Err()) {
+				err = errors.Wrapf(err, "%s wal replay", reg.Name)
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			}
+			return err
+		})
+	}
+
+	// Delete the data older than the retention.
+	for _, ret := range retentions {
+		ret := ret
+		appErrGroup.Go(func() error {
+			err := storage.ServeRetention(appCtx, ret.pruner, &ret.cfg)
+			if err != nil && !errors.Is(err, appCtx.Err()) {
+				err = errors.Wrapf(err, "%s retention", ret.name)
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			}
+			return err
+		})
+	}
+
+	// Redraw the terminal table at every refresh interval, if enabled.
+	if terStr && cfg.Connection.Terminal.TUI {
+		appErrGroup.Go(func() error {
+			err := storage.GetTerminal().Serve(appCtx)
+			if err != nil && !errors.Is(err, appCtx.Err()) {
+				err = errors.Wrap(err, "terminal tui")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			}
+			return err
+		})
+	}
+
+	// Compact the raw data older than the configured days into candles.
+	for _, comp := range compactions {
+		comp := comp
+		appErrGroup.Go(func() error {
+			err := storage.ServeCompaction(appCtx, comp.compactor, &comp.cfg)
+			if err != nil && !errors.Is(err, appCtx.Err()) {
+				err = errors.Wrapf(err, "%s compaction", comp.name)
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			}
+			return err
+		})
+	}
+
+	// Flush buffered raw frames at every flush interval.
+	if cfg.RawArchive.Enabled {
+		appErrGroup.Go(func() error {
+			err := storage.GetRawArchive().Serve(appCtx)
+			if err != nil && !errors.Is(err, appCtx.Err()) {
+				err = errors.Wrap(err, "raw archive flush")
+				log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+			}
+			return err
+		})
+	}
+
+	// Fetch fiat exchange rates, if enabled.
+	if cfg.FX.Enabled {
+		appErrGroup.Go(func() error {
+			return exchange.StartFX(appCtx, &cfg.FX)
+		})
+	}
+
+	// Fetch coin reference data, if enabled.
+	if cfg.CoinGecko.Enabled {
+		appErrGroup.Go(func() error {
+			return exchange.StartCoinGecko(appCtx, &cfg.CoinGecko)
+		})
+	}
+
 	for _, exch := range cfg.Exchanges {
-		markets := exch.Markets
-		retry := exch.Retry
-		switch exch.Name {
-		case "ftx":
-			appErrGroup.Go(func() error {
-				return exchange.StartFtx(appCtx, markets, &retry, &cfg.Connection)
-			})
-		case "coinbase-pro":
-			appErrGroup.Go(func() error {
-				return exchange.StartCoinbasePro(appCtx, markets, &retry, &cfg.Connection)
-			})
-		case "binance":
-			appErrGroup.Go(func() error {
-				return exchange.StartBinance(appCtx, markets, &retry, &cfg.Connection)
-			})
-		case "bitfinex":
-			appErrGroup.Go(func() error {
-				return exchange.StartBitfinex(appCtx, markets, &retry, &cfg.Connection)
-			})
-		case "hbtc":
-			appErrGroup.Go(func() error {
-				return exchange.StartHbtc(appCtx, markets, &retry, &cfg.Connection)
-			})
-		case "huobi":
-			appErrGroup.Go(func() error {
-				return exchange.StartHuobi(appCtx, markets, &retry, &cfg.Connection)
-			})
-		case "gateio":
-			appErrGroup.Go(func() error {
-				return exchange.StartGateio(appCtx, markets, &retry, &cfg.Connection)
-			})
-		case "kucoin":
-			appErrGroup.Go(func() error {
-				return exchange.StartKucoin(appCtx, markets, &retry, &cfg.Connection)
-			})
-		case "bitstamp":
-			appErrGroup.Go(func() error {
-				return exchange.StartBitstamp(appCtx, markets, &retry, &cfg.Connection)
-			})
-		case "bybit":
-			appErrGroup.Go(func() error {
-				return exchange.StartBybit(appCtx, markets, &retry, &cfg.Connection)
-			})
-		case "probit":
-			appErrGroup.Go(func() error {
-				return exchange.StartProbit(appCtx, markets, &retry, &cfg.Connection)
-			})
-		case "gemini":
+		exchMod, _ := exchange.GetExchange(exch.Name)
+		start := exchMod.Start
+		shards := exchange.ShardMarkets(exch.Name, exch.Markets, exch.Websocket.MaxSubscriptions)
+		if len(shards) > 1 {
+			log.Info().Str("exchange", exch.Name).Int("shards", len(shards)).Msg("markets sharded across websocket connections")
+		}
+		for _, markets := range shards {
+			markets := markets
+			retry := exch.Retry
 			appErrGroup.Go(func() error {
-				return exchange.StartGemini(appCtx, markets, &retry, &cfg.Connection)
+				return start(appCtx, markets, &retry, &cfg.Connection)
 			})
 		}
 	}
 
 	err = appErrGroup.Wait()
+
+	// Parquet files are readable only after writing the footer, so all the open files are closed before exit.
+	// Same for flat files, to end the gzip stream.
+	if parquetStr {
+		if closeErr := storage.GetParquet().Close(); closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "parquet files close")
+			log.Error().Stack().Err(errors.WithStack(closeErr)).Msg("")
+		}
+	}
+	if fileStr {
+		if closeErr := storage.GetFile().Close(); closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "flat files close")
+			log.Error().Stack().Err(errors.WithStack(closeErr)).Msg("")
+		}
+	}
+
+	// Remaining buffered s3 objects are uploaded, as the app context is already cancelled, a new one is used.
+	if s3Str {
+		if closeErr := storage.GetS3().Close(context.Background()); closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "s3 upload")
+			log.Error().Stack().Err(errors.WithStack(closeErr)).Msg("")
+		}
+	}
+	if deltaStr {
+		if closeErr := storage.GetDelta().Close(context.Background()); closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "delta commit")
+			log.Error().Stack().Err(errors.WithStack(closeErr)).Msg("")
+		}
+	}
+	// Stream is closed, so that the service knows all the records are sent.
+	if grpcStr {
+		if closeErr := storage.GetGRPC().Close(); closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "grpc stream close")
+			log.Error().Stack().Err(errors.WithStack(closeErr)).Msg("")
+		}
+	}
+	if zeroMQStr {
+		if closeErr := storage.GetZeroMQ().Close(); closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "zeromq socket close")
+			log.Error().Stack().Err(errors.WithStack(closeErr)).Msg("")
+		}
+	}
+	// Plugin processes started by the app are stopped.
+	for _, pluginCfg := range cfg.Connection.Plugins {
+		plugin := storage.GetPlugin(pluginCfg.Name)
+		if plugin == nil {
+			continue
+		}
+		if closeErr := plugin.Close(); closeErr != nil {
+			closeErr = errors.Wrapf(closeErr, "plugin %s close", pluginCfg.Name)
+			log.Error().Stack().Err(errors.WithStack(closeErr)).Msg("")
+		}
+	}
+	if cfg.RawArchive.Enabled {
+		if closeErr := storage.GetRawArchive().Close(); closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "raw archive close")
+			log.Error().Stack().Err(errors.WithStack(closeErr)).Msg("")
+		}
+	}
 	if err != nil {
 		log.Error().Msg("exiting the app")
 		return err
@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// WsReceivedBytes counts bytes received per exchange websocket connection.
+	WsReceivedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cryptogalaxy",
+		Subsystem: "websocket",
+		Name:      "received_bytes_total",
+		Help:      "Total number of bytes received from exchange websocket connections.",
+	}, []string{"exchange", "url"})
+
+	// WsReconnects counts in place reconnects per exchange websocket connection.
+	WsReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cryptogalaxy",
+		Subsystem: "websocket",
+		Name:      "reconnects_total",
+		Help:      "Total number of in place reconnects of exchange websocket connections.",
+	}, []string{"exchange", "url"})
+
+	// WsStaleConns counts exchange websocket connections found stale by the read timeout.
+	WsStaleConns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cryptogalaxy",
+		Subsystem: "websocket",
+		Name:      "stale_connections_total",
+		Help:      "Total number of exchange websocket connections without any frame received within the read timeout.",
+	}, []string{"exchange", "url"})
+
+	// WsOversizedMessages counts messages larger than the max size received per exchange websocket connection.
+	WsOversizedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cryptogalaxy",
+		Subsystem: "websocket",
+		Name:      "oversized_messages_total",
+		Help:      "Total number of messages larger than the max size received on exchange websocket connections.",
+	}, []string{"exchange", "url"})
+
+	// EndpointUp is the health of the default and alternative endpoints of the exchanges.
+	EndpointUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cryptogalaxy",
+		Subsystem: "endpoint",
+		Name:      "up",
+		Help:      "Whether the last connection to the exchange endpoint succeeded (1) or failed (0).",
+	}, []string{"exchange", "type", "host"})
+
+	// RESTCircuitOpen is the state of the circuit breaker of the exchange REST hosts.
+	RESTCircuitOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cryptogalaxy",
+		Subsystem: "rest",
+		Name:      "circuit_open",
+		Help:      "Whether the circuit breaker of the exchange REST host is open (1) or closed (0).",
+	}, []string{"host"})
+
+	// RESTBackoffs counts REST requests backed off on a throttling or server side error per exchange REST host.
+	RESTBackoffs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cryptogalaxy",
+		Subsystem: "rest",
+		Name:      "backoffs_total",
+		Help:      "Total number of REST requests backed off on a throttling or server side error of the exchange REST host.",
+	}, []string{"host", "code"})
+
+	// RESTReceivedBytes counts response body bytes received per exchange REST endpoint.
+	RESTReceivedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cryptogalaxy",
+		Subsystem: "rest",
+		Name:      "received_bytes_total",
+		Help:      "Total number of response body bytes received from exchange REST endpoints.",
+	}, []string{"host", "path"})
+
+	// FilteredTrades counts trades excluded from storages by the configured trade filter.
+	FilteredTrades = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cryptogalaxy",
+		Subsystem: "trade",
+		Name:      "filtered_total",
+		Help:      "Total number of trades excluded from storages by the trade filter.",
+	}, []string{"exchange", "market", "reason"})
+
+	// DroppedRecords counts records dropped by the backpressure policy of a storage which can not keep up.
+	DroppedRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cryptogalaxy",
+		Subsystem: "storage",
+		Name:      "dropped_total",
+		Help:      "Total number of records dropped by the storage backpressure policy.",
+	}, []string{"storage", "exchange", "channel"})
+
+	// CandleValidations counts the candles built from the trades validated against the klines of the exchange,
+	// by the result, which is match, divergence or missing if the exchange has no kline for the candle.
+	CandleValidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cryptogalaxy",
+		Subsystem: "candle",
+		Name:      "validations_total",
+		Help:      "Total number of candles built from the trades validated against the klines of the exchange.",
+	}, []string{"exchange", "market", "interval", "result"})
+
+	// TradeReceiveLatency observes the time from the exchange timestamp of a trade till it is received by the app.
+	TradeReceiveLatency = promauto.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace:  "cryptogalaxy",
+		Subsystem:  "trade",
+		Name:       "receive_latency_seconds",
+		Help:       "Time from the exchange timestamp of the trades till they are received by the app.",
+		Objectives: latencyObjectives,
+	}, []string{"exchange", "market"})
+
+	// TradeCommitLatency observes the time from the exchange timestamp of a trade till it is committed to a storage.
+	TradeCommitLatency = promauto.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace:  "cryptogalaxy",
+		Subsystem:  "trade",
+		Name:       "commit_latency_seconds",
+		Help:       "Time from the exchange timestamp of the trades till they are committed to the storage.",
+		Objectives: latencyObjectives,
+	}, []string{"storage", "exchange", "market"})
+)
+
+// latencyObjectives are the percentiles of the latency summaries along with their allowed error.
+var latencyObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+
+// latency tells whether the trade latencies are observed.
+// It is set only while starting the app, before any exchange is started,
+// so it is not guarded for concurrent access.
+var latency bool
+
+// EnableLatency enables observing the trade latencies, which are not observed by default
+// as the summaries of all the markets and storages cost some memory and CPU for each trade.
+func EnableLatency() {
+	latency = true
+}
+
+// ObserveTradeReceive observes the latency of the trade received now.
+func ObserveTradeReceive(exchange string, market string, timestamp time.Time) {
+	if latency {
+		TradeReceiveLatency.WithLabelValues(exchange, market).Observe(time.Since(timestamp).Seconds())
+	}
+}
+
+// ObserveTradeCommit observes the latency of the trade committed to the storage at the given time.
+func ObserveTradeCommit(storage string, exchange string, market string, timestamp time.Time, committedAt time.Time) {
+	if latency {
+		TradeCommitLatency.WithLabelValues(storage, exchange, market).Observe(committedAt.Sub(timestamp).Seconds())
+	}
+}
+
+// Serve exposes metrics in prometheus format over http till the app context is canceled.
+func Serve(appCtx context.Context, cfg *config.Metrics) error {
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, promhttp.Handler())
+	srv := &http.Server{
+		Addr:              cfg.Address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-appCtx.Done():
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+		return appCtx.Err()
+	}
+}
@@ -0,0 +1,153 @@
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"go/format"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+//go:embed templates/*.tmpl templates/testdata/*.tmpl
+var templates embed.FS
+
+var validName = regexp.MustCompile(`^[a-z][a-z0-9-]*[a-z0-9]$`)
+
+// exchangeData holds the values substituted in the exchange module template.
+type exchangeData struct {
+	Name  string
+	Type  string
+	Camel string
+	Recv  string
+}
+
+// GenerateExchange creates a new exchange module in the repository root directory with
+// the same websocket, REST, buffering and storage plumbing as the existing ones,
+// along with its unit test and the websocket message fixtures used by it,
+// and registers it in the config URLs and the exchange table, which the initializer validates and starts the exchanges from.
+// Exchange specific parts of the module are marked with TODO comments.
+// It returns the paths of the created and modified files.
+func GenerateExchange(dir string, name string) ([]string, error) {
+	if !validName.MatchString(name) {
+		return nil, errors.New("exchange name should contain only lowercase letters, digits and hyphens, e.g. coinbase-pro")
+	}
+
+	data := exchangeData{Name: name}
+	for _, part := range strings.Split(name, "-") {
+		if part == "" {
+			continue
+		}
+		data.Type += part
+		data.Camel += strings.ToUpper(part[:1]) + part[1:]
+	}
+
+	// Receiver is the first letter of the exchange, as in the other modules,
+	// except for the ones which conflict with the local variable names used in the functions.
+	data.Recv = data.Type[:1]
+	if strings.ContainsAny(data.Recv, "qrivk") {
+		data.Recv = "x"
+	}
+
+	exchDir := filepath.Join(dir, "internal", "exchange")
+	exchPath := filepath.Join(exchDir, data.Type+".go")
+	cfgPath := filepath.Join(dir, "internal", "config", "config.go")
+	tablePath := filepath.Join(exchDir, "exchanges.go")
+
+	if _, err := os.Stat(exchPath); err == nil {
+		return nil, errors.Errorf("exchange module %s already exists", exchPath)
+	}
+
+	// Generated files by their template, Go source ones are formatted.
+	files := []struct {
+		path string
+		tmpl string
+	}{
+		{exchPath, "templates/exchange.go.tmpl"},
+		{filepath.Join(exchDir, data.Type+"_test.go"), "templates/exchange_test.go.tmpl"},
+		{filepath.Join(exchDir, "testdata", data.Type, "ws_ticker.json"), "templates/testdata/ws_ticker.json.tmpl"},
+		{filepath.Join(exchDir, "testdata", data.Type, "ws_trade.json"), "templates/testdata/ws_trade.json.tmpl"},
+	}
+	srcs := make([][]byte, len(files))
+	for i, f := range files {
+		tmpl, err := template.ParseFS(templates, f.tmpl)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse template %s", f.tmpl)
+		}
+		var buf bytes.Buffer
+		if err = tmpl.Execute(&buf, data); err != nil {
+			return nil, errors.Wrapf(err, "execute template %s", f.tmpl)
+		}
+		srcs[i] = buf.Bytes()
+		if strings.HasSuffix(f.path, ".go") {
+			if srcs[i], err = format.Source(srcs[i]); err != nil {
+				return nil, errors.Wrapf(err, "format %s", f.path)
+			}
+		}
+	}
+
+	// Both the files are patched in memory first, so that nothing is written if any of the anchors is missing.
+	cfgSrc, err := os.ReadFile(cfgPath)
+	if err != nil {
+		return nil, err
+	}
+	urls := "\t// " + data.Camel + "WebsocketURL is the " + name + " exchange websocket url.\n" +
+		"\t" + data.Camel + "WebsocketURL = \"wss://TODO\"\n" +
+		"\t// " + data.Camel + "RESTBaseURL is the " + name + " exchange base REST url.\n" +
+		"\t" + data.Camel + "RESTBaseURL = \"https://TODO/\"\n"
+	cfgSrc, err = insertBefore(cfgSrc, ")\n\n// Config contains config values", urls)
+	if err != nil {
+		return nil, errors.Wrap(err, "add exchange urls to config")
+	}
+
+	tableSrc, err := os.ReadFile(tablePath)
+	if err != nil {
+		return nil, err
+	}
+	entry := "\t\"" + name + "\": {\n" +
+		"\t\tStart: Start" + data.Camel + ",\n" +
+		"\t\t// TODO: add the connectors supporting each of the channels other than ticker and trade, if any.\n" +
+		"\t\tChannels: map[string][]string{},\n" +
+		"\t},\n"
+	tableSrc, err = insertBefore(tableSrc, "}\n\n// RegisterExchange adds", entry)
+	if err != nil {
+		return nil, errors.Wrap(err, "add exchange to exchange table")
+	}
+	if tableSrc, err = format.Source(tableSrc); err != nil {
+		return nil, errors.Wrap(err, "format exchange table")
+	}
+
+	paths := make([]string, 0, len(files)+2)
+	for i, f := range files {
+		if err = os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			return nil, err
+		}
+		if err = os.WriteFile(f.path, srcs[i], 0644); err != nil {
+			return nil, err
+		}
+		paths = append(paths, f.path)
+	}
+	if err = os.WriteFile(cfgPath, cfgSrc, 0644); err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(tablePath, tableSrc, 0644); err != nil {
+		return nil, err
+	}
+	return append(paths, cfgPath, tablePath), nil
+}
+
+// insertBefore adds the text before the only occurrence of the anchor in the source.
+func insertBefore(src []byte, anchor string, text string) ([]byte, error) {
+	if bytes.Count(src, []byte(anchor)) != 1 {
+		return nil, errors.Errorf("anchor %q not found", anchor)
+	}
+	i := bytes.Index(src, []byte(anchor))
+	out := make([]byte, 0, len(src)+len(text))
+	out = append(out, src[:i]...)
+	out = append(out, text...)
+	return append(out, src[i:]...), nil
+}
@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// BigQuery is for connecting and appending data to bigquery tables over the storage write API.
+type BigQuery struct {
+	Cfg    *config.BigQuery
+	client *managedwriter.Client
+	ticker *bqTable
+	trade  *bqTable
+}
+
+var bigQuery BigQuery
+
+// bqTable is a table along with its default write stream and the row message descriptor.
+type bqTable struct {
+	stream *managedwriter.ManagedStream
+	md     protoreflect.MessageDescriptor
+}
+
+// bqTickerSchema and bqTradeSchema are the table schemas, row values are set in the same order.
+var (
+	bqTickerSchema = bigquery.Schema{
+		{Name: "exchange", Type: bigquery.StringFieldType, Required: true},
+		{Name: "market", Type: bigquery.StringFieldType, Required: true},
+		{Name: "base", Type: bigquery.StringFieldType, Required: true},
+		{Name: "quote", Type: bigquery.StringFieldType, Required: true},
+		{Name: "price", Type: bigquery.FloatFieldType, Required: true},
+		{Name: "best_bid", Type: bigquery.FloatFieldType, Required: true},
+		{Name: "best_ask", Type: bigquery.FloatFieldType, Required: true},
+		{Name: "volume", Type: bigquery.FloatFieldType, Required: true},
+		{Name: "high", Type: bigquery.FloatFieldType, Required: true},
+		{Name: "low", Type: bigquery.FloatFieldType, Required: true},
+		{Name: "price_usd", Type: bigquery.FloatFieldType, Required: true},
+		{Name: "is_bad_tick", Type: bigquery.BooleanFieldType, Required: true},
+		{Name: "timestamp", Type: bigquery.TimestampFieldType, Required: true},
+		{Name: "created_at", Type: bigquery.TimestampFieldType, Required: true},
+	}
+	bqTradeSchema = bigquery.Schema{
+		{Name: "exchange", Type: bigquery.StringFieldType, Required: true},
+		{Name: "market", Type: bigquery.StringFieldType, Required: true},
+		{Name: "base", Type: bigquery.StringFieldType, Required: true},
+		{Name: "quote", Type: bigquery.StringFieldType, Required: true},
+		{Name: "trade_id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "side", Type: bigquery.StringFieldType, Required: true},
+		{Name: "size", Type: bigquery.FloatFieldType, Required: true},
+		{Name: "price", Type: bigquery.FloatFieldType, Required: true},
+		{Name: "is_buyer_maker", Type: bigquery.BooleanFieldType, Required: true},
+		{Name: "price_usd", Type: bigquery.FloatFieldType, Required: true},
+		{Name: "is_bad_tick", Type: bigquery.BooleanFieldType, Required: true},
+		{Name: "timestamp", Type: bigquery.TimestampFieldType, Required: true},
+		{Name: "created_at", Type: bigquery.TimestampFieldType, Required: true},
+	}
+)
+
+// InitBigQuery initializes bigquery connection with configured values,
+// creates the ticker and trade tables, if they do not exist already, and opens their default write streams.
+func InitBigQuery(cfg *config.BigQuery) (*BigQuery, error) {
+	if bigQuery.client == nil {
+		var opts []option.ClientOption
+		if cfg.CredentialsFile != "" {
+			opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+		}
+
+		var ctx context.Context
+		if cfg.ReqTimeoutSec > 0 {
+			timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReqTimeoutSec)*time.Second)
+			ctx = timeoutCtx
+			defer cancel()
+		} else {
+			ctx = context.Background()
+		}
+		bqClient, err := bigquery.NewClient(ctx, cfg.ProjectID, opts...)
+		if err != nil {
+			return nil, err
+		}
+		defer bqClient.Close()
+
+		// Write streams are long lived, so they are not bound to the init timeout.
+		client, err := managedwriter.NewClient(context.Background(), cfg.ProjectID, opts...)
+		if err != nil {
+			return nil, err
+		}
+		tickerTable := cfg.TickerTable
+		if tickerTable == "" {
+			tickerTable = "ticker"
+		}
+		tradeTable := cfg.TradeTable
+		if tradeTable == "" {
+			tradeTable = "trade"
+		}
+		ticker, err := bqPrepareTable(ctx, bqClient, client, cfg, tickerTable, bqTickerSchema)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		trade, err := bqPrepareTable(ctx, bqClient, client, cfg, tradeTable, bqTradeSchema)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		bigQuery = BigQuery{
+			Cfg:    cfg,
+			client: client,
+			ticker: ticker,
+			trade:  trade,
+		}
+	}
+	return &bigQuery, nil
+}
+
+// bqPrepareTable creates the table partitioned by day on timestamp and clustered by exchange and market, if it does not exist,
+// and opens the default write stream of it with the row descriptor derived from the schema.
+func bqPrepareTable(ctx context.Context, bqClient *bigquery.Client, client *managedwriter.Client, cfg *config.BigQuery, name string, schema bigquery.Schema) (*bqTable, error) {
+	table := bqClient.Dataset(cfg.Dataset).Table(name)
+	if _, err := table.Metadata(ctx); err != nil {
+		var apiErr *googleapi.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != http.StatusNotFound {
+			return nil, err
+		}
+		err = table.Create(ctx, &bigquery.TableMetadata{
+			Schema: schema,
+			TimePartitioning: &bigquery.TimePartitioning{
+				Type:  bigquery.DayPartitioningType,
+				Field: "timestamp",
+			},
+			Clustering: &bigquery.Clustering{
+				Fields: []string{"exchange", "market"},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	storageSchema, err := adapt.BQSchemaToStorageTableSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	descriptor, err := adapt.StorageSchemaToProto2Descriptor(storageSchema, "root")
+	if err != nil {
+		return nil, err
+	}
+	md, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, errors.New("bigquery row descriptor is not a message descriptor")
+	}
+	dp, err := adapt.NormalizeDescriptor(md)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := client.NewManagedStream(context.Background(),
+		managedwriter.WithDestinationTable(fmt.Sprintf("projects/%s/datasets/%s/tables/%s", cfg.ProjectID, cfg.Dataset, name)),
+		managedwriter.WithType(managedwriter.DefaultStream),
+		managedwriter.WithSchemaDescriptor(dp),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &bqTable{
+		stream: stream,
+		md:     md,
+	}, nil
+}
+
+// GetBigQuery returns already prepared bigquery instance.
+func GetBigQuery() *BigQuery {
+	return &bigQuery
+}
+
+// CommitTickers batch appends input ticker data to bigquery.
+func (b *BigQuery) CommitTickers(appCtx context.Context, data []Ticker) error {
+	rows := make([][]byte, 0, len(data))
+	now := time.Now()
+	for _, ticker := range data {
+		row, err := b.ticker.row(
+			protoreflect.ValueOfString(ticker.Exchange),
+			protoreflect.ValueOfString(ticker.MktCommitName),
+			protoreflect.ValueOfString(ticker.Base),
+			protoreflect.ValueOfString(ticker.Quote),
+			protoreflect.ValueOfFloat64(ticker.Price),
+			protoreflect.ValueOfFloat64(ticker.BestBid),
+			protoreflect.ValueOfFloat64(ticker.BestAsk),
+			protoreflect.ValueOfFloat64(ticker.Volume),
+			protoreflect.ValueOfFloat64(ticker.High),
+			protoreflect.ValueOfFloat64(ticker.Low),
+			protoreflect.ValueOfFloat64(ticker.PriceUSD),
+			protoreflect.ValueOfBool(ticker.IsBadTick),
+			bqTimestamp(ticker.Timestamp),
+			bqTimestamp(now),
+		)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+	return b.append(appCtx, b.ticker, rows)
+}
+
+// CommitTrades batch appends input trade data to bigquery.
+func (b *BigQuery) CommitTrades(appCtx context.Context, data []Trade) error {
+	rows := make([][]byte, 0, len(data))
+	now := time.Now()
+	for _, trade := range data {
+		row, err := b.trade.row(
+			protoreflect.ValueOfString(trade.Exchange),
+			protoreflect.ValueOfString(trade.MktCommitName),
+			protoreflect.ValueOfString(trade.Base),
+			protoreflect.ValueOfString(trade.Quote),
+			protoreflect.ValueOfString(trade.TradeID),
+			protoreflect.ValueOfString(trade.Side),
+			protoreflect.ValueOfFloat64(trade.Size),
+			protoreflect.ValueOfFloat64(trade.Price),
+			protoreflect.ValueOfBool(trade.IsBuyerMaker),
+			protoreflect.ValueOfFloat64(trade.PriceUSD),
+			protoreflect.ValueOfBool(trade.IsBadTick),
+			bqTimestamp(trade.Timestamp),
+			bqTimestamp(now),
+		)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+	return b.append(appCtx, b.trade, rows)
+}
+
+// append sends the rows to the default stream of the table and waits for the result,
+// so that the error is known before the next batch.
+func (b *BigQuery) append(appCtx context.Context, table *bqTable, rows [][]byte) error {
+	var ctx context.Context
+	if b.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(b.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = appCtx
+	}
+	result, err := table.stream.AppendRows(ctx, rows)
+	if err != nil {
+		return err
+	}
+	_, err = result.GetResult(ctx)
+	return err
+}
+
+// row serializes the values as a row message, values being in the order of the table schema.
+func (t *bqTable) row(values ...protoreflect.Value) ([]byte, error) {
+	msg := dynamicpb.NewMessage(t.md)
+	fields := t.md.Fields()
+	for i, v := range values {
+		msg.Set(fields.Get(i), v)
+	}
+	return proto.Marshal(msg)
+}
+
+// bqTimestamp converts the time to microseconds since epoch, as expected for the timestamp column.
+func bqTimestamp(ts time.Time) protoreflect.Value {
+	return protoreflect.ValueOfInt64(ts.UnixNano() / int64(time.Microsecond))
+}
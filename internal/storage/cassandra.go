@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// Cassandra is for connecting and inserting data to cassandra or scylladb.
+type Cassandra struct {
+	Session *gocql.Session
+	Cfg     *config.Cassandra
+}
+
+var cassandra Cassandra
+
+// cassandraTables are the tables created while connecting, if they do not exist already.
+// Data of a market is partitioned by the time bucket, so that the partitions do not grow unbounded.
+var cassandraTables = []string{
+	`CREATE TABLE IF NOT EXISTS ticker (
+		exchange text,
+		market text,
+		bucket text,
+		timestamp timestamp,
+		base text,
+		quote text,
+		price double,
+		best_bid double,
+		best_ask double,
+		volume double,
+		high double,
+		low double,
+		price_usd double,
+		is_bad_tick boolean,
+		created_at timestamp,
+		PRIMARY KEY ((exchange, market, bucket), timestamp)
+	) WITH CLUSTERING ORDER BY (timestamp DESC)`,
+	`CREATE TABLE IF NOT EXISTS trade (
+		exchange text,
+		market text,
+		bucket text,
+		timestamp timestamp,
+		trade_id text,
+		base text,
+		quote text,
+		side text,
+		size double,
+		price double,
+		is_buyer_maker boolean,
+		price_usd double,
+		is_bad_tick boolean,
+		created_at timestamp,
+		PRIMARY KEY ((exchange, market, bucket), timestamp, trade_id)
+	) WITH CLUSTERING ORDER BY (timestamp DESC, trade_id ASC)`,
+}
+
+// InitCassandra initializes cassandra connection with configured values
+// and creates the ticker and trade tables in the keyspace.
+func InitCassandra(cfg *config.Cassandra) (*Cassandra, error) {
+	if cassandra.Session == nil {
+		switch cfg.Bucket {
+		case "", "day", "hour":
+		default:
+			return nil, errors.New("cassandra bucket should be day or hour")
+		}
+		cluster := gocql.NewCluster(cfg.Hosts...)
+		cluster.Keyspace = cfg.Keyspace
+		if cfg.Username != "" {
+			cluster.Authenticator = gocql.PasswordAuthenticator{
+				Username: cfg.Username,
+				Password: cfg.Password,
+			}
+		}
+		if cfg.Consistency != "" {
+			consistency, err := gocql.ParseConsistencyWrapper(strings.ToUpper(cfg.Consistency))
+			if err != nil {
+				return nil, err
+			}
+			cluster.Consistency = consistency
+		}
+		if cfg.ReqTimeoutSec > 0 {
+			cluster.Timeout = time.Duration(cfg.ReqTimeoutSec) * time.Second
+			cluster.ConnectTimeout = time.Duration(cfg.ReqTimeoutSec) * time.Second
+		}
+		if cfg.LocalDC != "" {
+			cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.DCAwareRoundRobinPolicy(cfg.LocalDC))
+		} else {
+			cluster.PoolConfig.HostSelectionPolicy = gocql.TokenAwareHostPolicy(gocql.RoundRobinHostPolicy())
+		}
+		session, err := cluster.CreateSession()
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range cassandraTables {
+			if err = session.Query(table).Exec(); err != nil {
+				session.Close()
+				return nil, err
+			}
+		}
+		cassandra = Cassandra{
+			Session: session,
+			Cfg:     cfg,
+		}
+	}
+	return &cassandra, nil
+}
+
+// GetCassandra returns already prepared cassandra instance.
+func GetCassandra() *Cassandra {
+	return &cassandra
+}
+
+// bucket returns the time bucket of the partition key.
+func (c *Cassandra) bucket(ts time.Time) string {
+	if c.Cfg.Bucket == "hour" {
+		return ts.UTC().Format("2006-01-02T15")
+	}
+	return ts.UTC().Format("2006-01-02")
+}
+
+// CommitTickers batch inserts input ticker data to cassandra.
+// Rows are grouped in an unlogged batch per partition, so that each batch is written by a single replica set.
+func (c *Cassandra) CommitTickers(appCtx context.Context, data []Ticker) error {
+	ctx, cancel := c.ctx(appCtx)
+	defer cancel()
+	now := time.Now().UTC()
+	var keys []string
+	batches := make(map[string]*gocql.Batch)
+	for _, ticker := range data {
+		bucket := c.bucket(ticker.Timestamp)
+		key := ticker.Exchange + "/" + ticker.MktCommitName + "/" + bucket
+		b, ok := batches[key]
+		if !ok {
+			b = c.Session.NewBatch(gocql.UnloggedBatch).WithContext(ctx)
+			batches[key] = b
+			keys = append(keys, key)
+		}
+		b.Query("INSERT INTO ticker(exchange, market, bucket, timestamp, base, quote, price, best_bid, best_ask, volume, high, low, price_usd, is_bad_tick, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			ticker.Exchange, ticker.MktCommitName, bucket, ticker.Timestamp, ticker.Base, ticker.Quote, ticker.Price, ticker.BestBid, ticker.BestAsk, ticker.Volume, ticker.High, ticker.Low, ticker.PriceUSD, ticker.IsBadTick, now)
+	}
+	for _, key := range keys {
+		if err := c.Session.ExecuteBatch(batches[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CommitTrades batch inserts input trade data to cassandra.
+// Rows are grouped in an unlogged batch per partition, so that each batch is written by a single replica set.
+func (c *Cassandra) CommitTrades(appCtx context.Context, data []Trade) error {
+	ctx, cancel := c.ctx(appCtx)
+	defer cancel()
+	now := time.Now().UTC()
+	var keys []string
+	batches := make(map[string]*gocql.Batch)
+	for _, trade := range data {
+		bucket := c.bucket(trade.Timestamp)
+		key := trade.Exchange + "/" + trade.MktCommitName + "/" + bucket
+		b, ok := batches[key]
+		if !ok {
+			b = c.Session.NewBatch(gocql.UnloggedBatch).WithContext(ctx)
+			batches[key] = b
+			keys = append(keys, key)
+		}
+		b.Query("INSERT INTO trade(exchange, market, bucket, timestamp, trade_id, base, quote, side, size, price, is_buyer_maker, price_usd, is_bad_tick, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			trade.Exchange, trade.MktCommitName, bucket, trade.Timestamp, trade.TradeID, trade.Base, trade.Quote, trade.Side, trade.Size, trade.Price, trade.IsBuyerMaker, trade.PriceUSD, trade.IsBadTick, now)
+	}
+	for _, key := range keys {
+		if err := c.Session.ExecuteBatch(batches[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ctx returns the context for the insert with the configured timeout.
+func (c *Cassandra) ctx(appCtx context.Context) (context.Context, context.CancelFunc) {
+	if c.Cfg.ReqTimeoutSec > 0 {
+		return context.WithTimeout(appCtx, time.Duration(c.Cfg.ReqTimeoutSec)*time.Second)
+	}
+	return context.WithCancel(appCtx)
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strconv"
+	"time"
+
+	// ClickHouse driver uses the native protocol and sends the prepared rows of a transaction as a columnar block.
+	_ "github.com/ClickHouse/clickhouse-go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// ClickHouse is for connecting and inserting data to clickhouse.
+type ClickHouse struct {
+	DB  *sql.DB
+	Cfg *config.ClickHouse
+}
+
+var clickHouse ClickHouse
+
+// InitClickHouse initializes clickhouse connection with configured values.
+func InitClickHouse(cfg *config.ClickHouse) (*ClickHouse, error) {
+	if clickHouse.DB == nil {
+		q := url.Values{}
+		q.Set("username", cfg.User)
+		q.Set("password", cfg.Password)
+		q.Set("database", cfg.Schema)
+		if cfg.ReqTimeoutSec > 0 {
+			q.Set("read_timeout", strconv.Itoa(cfg.ReqTimeoutSec))
+			q.Set("write_timeout", strconv.Itoa(cfg.ReqTimeoutSec))
+		}
+		if cfg.Compress {
+			q.Set("compress", "true")
+		}
+		db, err := sql.Open("clickhouse", "tcp://"+cfg.URL+"?"+q.Encode())
+		if err != nil {
+			return nil, err
+		}
+		db.SetConnMaxLifetime(time.Second * time.Duration(cfg.ConnMaxLifetimeSec))
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+
+		var ctx context.Context
+		if cfg.ReqTimeoutSec > 0 {
+			timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReqTimeoutSec)*time.Second)
+			ctx = timeoutCtx
+			defer cancel()
+		} else {
+			ctx = context.Background()
+		}
+		err = db.PingContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		clickHouse = ClickHouse{
+			DB:  db,
+			Cfg: cfg,
+		}
+	}
+	return &clickHouse, nil
+}
+
+// GetClickHouse returns already prepared clickhouse instance.
+func GetClickHouse() *ClickHouse {
+	return &clickHouse
+}
+
+// CommitTickers batch inserts input ticker data to clickhouse.
+// All the rows of the transaction are sent as a single columnar block.
+func (c *ClickHouse) CommitTickers(appCtx context.Context, data []Ticker) error {
+	ctx, cancel := c.ctx(appCtx)
+	defer cancel()
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO ticker(exchange, market, base, quote, price, best_bid, best_ask, volume, high, low, price_usd, is_bad_tick, timestamp, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	now := time.Now().UTC()
+	for _, ticker := range data {
+		_, err = stmt.ExecContext(ctx, ticker.Exchange, ticker.MktCommitName, ticker.Base, ticker.Quote, ticker.Price, ticker.BestBid, ticker.BestAsk, ticker.Volume, ticker.High, ticker.Low, ticker.PriceUSD, clickHouseBool(ticker.IsBadTick), ticker.Timestamp.UTC(), now)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CommitTrades batch inserts input trade data to clickhouse.
+// All the rows of the transaction are sent as a single columnar block.
+func (c *ClickHouse) CommitTrades(appCtx context.Context, data []Trade) error {
+	ctx, cancel := c.ctx(appCtx)
+	defer cancel()
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO trade(exchange, market, base, quote, trade_id, side, size, price, is_buyer_maker, price_usd, is_bad_tick, timestamp, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	now := time.Now().UTC()
+	for _, trade := range data {
+		_, err = stmt.ExecContext(ctx, trade.Exchange, trade.MktCommitName, trade.Base, trade.Quote, trade.TradeID, trade.Side, trade.Size, trade.Price, clickHouseBool(trade.IsBuyerMaker), trade.PriceUSD, clickHouseBool(trade.IsBadTick), trade.Timestamp.UTC(), now)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ctx returns the context for the insert with the configured timeout.
+func (c *ClickHouse) ctx(appCtx context.Context) (context.Context, context.CancelFunc) {
+	if c.Cfg.ReqTimeoutSec > 0 {
+		return context.WithTimeout(appCtx, time.Duration(c.Cfg.ReqTimeoutSec)*time.Second)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// clickHouseBool converts the bool to UInt8 column value.
+func clickHouseBool(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// Compactor is a storage which can compact its raw ticker or trade data older than the given time
+// into minute candles, optionally deleting the raw data compacted,
+// so that the storage stays bounded while the history is still usable.
+type Compactor interface {
+	Compact(ctx context.Context, channel string, before time.Time, deleteRaw bool) error
+}
+
+// Default values, if not configured.
+const compactionIntervalMin = 60
+
+// ServeCompaction compacts the data of the channels older than the configured days at start
+// and then at every compaction interval, till the app context is cancelled.
+func ServeCompaction(appCtx context.Context, compactor Compactor, cfg *config.StorageCompaction) error {
+	if err := compact(appCtx, compactor, cfg); err != nil {
+		return err
+	}
+	interval := cfg.IntervalMin
+	if interval == 0 {
+		interval = compactionIntervalMin
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := compact(appCtx, compactor, cfg); err != nil {
+				return err
+			}
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+	}
+}
+
+// compact compacts the data of all the configured channels till the start of the minute,
+// so that a minute is never compacted partially.
+func compact(ctx context.Context, compactor Compactor, cfg *config.StorageCompaction) error {
+	before := time.Now().UTC().AddDate(0, 0, -cfg.AfterDays).Truncate(time.Minute)
+	for _, channel := range cfg.Channels {
+		if err := compactor.Compact(ctx, channel, before, cfg.DeleteRaw); err != nil {
+			return fmt.Errorf("%s compaction : %w", channel, err)
+		}
+	}
+	return nil
+}
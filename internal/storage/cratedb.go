@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// CrateDB is for connecting and inserting data to cratedb through postgres wire protocol.
+type CrateDB struct {
+	DB  *sql.DB
+	Cfg *config.CrateDB
+}
+
+var crateDB CrateDB
+
+// Default values, if not configured.
+const (
+	crateDBSchema    = "doc"
+	crateDBPartition = "month"
+	crateDBShards    = 4
+	crateDBReplicas  = "0-1"
+)
+
+// CrateDB accepts ISO 8601 strings for timestamp with time zone columns.
+const crateDBTimestamp = "2006-01-02T15:04:05.999999Z07:00"
+
+// crateDBColumns are the columns of the tables created while connecting, if they do not exist already.
+// Tables are partitioned by a generated column of the timestamp truncated to the configured partition,
+// so that old partitions can be dropped or snapshotted as a whole.
+var crateDBColumns = map[string]string{
+	"ticker": `exchange text NOT NULL,
+		market text NOT NULL,
+		base text NOT NULL,
+		quote text NOT NULL,
+		price double precision NOT NULL,
+		best_bid double precision NOT NULL,
+		best_ask double precision NOT NULL,
+		volume double precision NOT NULL,
+		high double precision NOT NULL,
+		low double precision NOT NULL,
+		price_usd double precision NOT NULL,
+		is_bad_tick boolean NOT NULL,
+		"timestamp" timestamp with time zone NOT NULL,
+		created_at timestamp with time zone NOT NULL`,
+	"trade": `exchange text NOT NULL,
+		market text NOT NULL,
+		base text NOT NULL,
+		quote text NOT NULL,
+		trade_id text NOT NULL,
+		side text NOT NULL,
+		size double precision NOT NULL,
+		price double precision NOT NULL,
+		is_buyer_maker boolean NOT NULL,
+		price_usd double precision NOT NULL,
+		is_bad_tick boolean NOT NULL,
+		"timestamp" timestamp with time zone NOT NULL,
+		created_at timestamp with time zone NOT NULL`,
+}
+
+// InitCrateDB initializes cratedb connection with configured values
+// and creates the partitioned ticker and trade tables, if they do not exist already.
+func InitCrateDB(cfg *config.CrateDB) (*CrateDB, error) {
+	if crateDB.DB == nil {
+		switch cfg.Partition {
+		case "", "day", "week", "month", "year":
+		default:
+			return nil, errors.New("cratedb partition should be day, week, month or year")
+		}
+		sslMode := cfg.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(cfg.User, cfg.Password),
+			Host:     cfg.URL,
+			Path:     crateDBSchema,
+			RawQuery: "sslmode=" + url.QueryEscape(sslMode),
+		}
+		db, err := sql.Open("postgres", dsn.String())
+		if err != nil {
+			return nil, err
+		}
+		db.SetConnMaxLifetime(time.Second * time.Duration(cfg.ConnMaxLifetimeSec))
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+
+		var ctx context.Context
+		if cfg.ReqTimeoutSec > 0 {
+			timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReqTimeoutSec)*time.Second)
+			ctx = timeoutCtx
+			defer cancel()
+		} else {
+			ctx = context.Background()
+		}
+		err = db.PingContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c := &CrateDB{
+			DB:  db,
+			Cfg: cfg,
+		}
+		if err = c.createTables(ctx); err != nil {
+			return nil, err
+		}
+		crateDB = *c
+	}
+	return &crateDB, nil
+}
+
+// createTables creates the tables partitioned by the configured interval.
+// Sharding and replication are applied only when the table is created,
+// existing tables are left as they are.
+func (c *CrateDB) createTables(ctx context.Context) error {
+	partition := c.Cfg.Partition
+	if partition == "" {
+		partition = crateDBPartition
+	}
+	shards := c.Cfg.Shards
+	if shards == 0 {
+		shards = crateDBShards
+	}
+	replicas := c.Cfg.Replicas
+	if replicas == "" {
+		replicas = crateDBReplicas
+	}
+	for _, table := range []string{"ticker", "trade"} {
+		stmt := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		%s,
+		part timestamp with time zone GENERATED ALWAYS AS date_trunc('%s', "timestamp")
+	) CLUSTERED INTO %d SHARDS PARTITIONED BY (part) WITH (number_of_replicas = '%s')`, c.table(table), crateDBColumns[table], partition, shards, replicas)
+		if _, err := c.DB.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCrateDB returns already prepared cratedb instance.
+func GetCrateDB() *CrateDB {
+	return &crateDB
+}
+
+// table returns the table name qualified with the configured schema.
+func (c *CrateDB) table(name string) string {
+	schema := c.Cfg.Schema
+	if schema == "" {
+		schema = crateDBSchema
+	}
+	return `"` + schema + `".` + name
+}
+
+// timestamp formats the time to cratedb UTC timestamp.
+func (c *CrateDB) timestamp(ts time.Time) string {
+	return ts.UTC().Format(crateDBTimestamp)
+}
+
+// CommitTickers batch inserts input ticker data to database with a single multi row insert.
+func (c *CrateDB) CommitTickers(appCtx context.Context, data []Ticker) error {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO " + c.table("ticker") + `(exchange, market, base, quote, price, best_bid, best_ask, volume, high, low, price_usd, is_bad_tick, "timestamp", created_at) VALUES `)
+	now := c.timestamp(time.Now())
+	for i, ticker := range data {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(fmt.Sprintf("('%v', '%v', '%v', '%v', %v, %v, %v, %v, %v, %v, %v, %v, '%v', '%v')", ticker.Exchange, ticker.MktCommitName, ticker.Base, ticker.Quote, ticker.Price, ticker.BestBid, ticker.BestAsk, ticker.Volume, ticker.High, ticker.Low, ticker.PriceUSD, ticker.IsBadTick, c.timestamp(ticker.Timestamp), now))
+	}
+	return c.exec(appCtx, sb.String())
+}
+
+// CommitTrades batch inserts input trade data to database with a single multi row insert.
+func (c *CrateDB) CommitTrades(appCtx context.Context, data []Trade) error {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO " + c.table("trade") + `(exchange, market, base, quote, trade_id, side, size, price, is_buyer_maker, price_usd, is_bad_tick, "timestamp", created_at) VALUES `)
+	now := c.timestamp(time.Now())
+	for i, trade := range data {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(fmt.Sprintf("('%v', '%v', '%v', '%v', '%v', '%v', %v, %v, %v, %v, %v, '%v', '%v')", trade.Exchange, trade.MktCommitName, trade.Base, trade.Quote, trade.TradeID, trade.Side, trade.Size, trade.Price, trade.IsBuyerMaker, trade.PriceUSD, trade.IsBadTick, c.timestamp(trade.Timestamp), now))
+	}
+	return c.exec(appCtx, sb.String())
+}
+
+func (c *CrateDB) exec(appCtx context.Context, query string) error {
+	var ctx context.Context
+	if c.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(c.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = appCtx
+	}
+	_, err := c.DB.ExecContext(ctx, query)
+	return err
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// DeadLetter is for keeping the batches which a storage failed to commit even after all the retries,
+// so that the exchange keeps running and the data can be committed manually later.
+// Each batch is appended as a line to <dir>/<storage>_<channel>_dead_letter.jsonl.
+type DeadLetter struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+// deadLetterRecord is a line of the dead-letter file.
+type deadLetterRecord struct {
+	Storage  string      `json:"storage"`
+	Channel  string      `json:"channel"`
+	Error    string      `json:"error"`
+	FailedAt time.Time   `json:"failed_at"`
+	Data     interface{} `json:"data"`
+}
+
+// NewDeadLetter creates the dead-letter directory, if not exists.
+func NewDeadLetter(dir string) (*DeadLetter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DeadLetter{Dir: dir}, nil
+}
+
+// WriteTickers appends the failed ticker batch of the storage.
+func (d *DeadLetter) WriteTickers(str string, commitErr error, data []Ticker) error {
+	return d.write(str, "ticker", commitErr, data)
+}
+
+// WriteTrades appends the failed trade batch of the storage.
+func (d *DeadLetter) WriteTrades(str string, commitErr error, data []Trade) error {
+	return d.write(str, "trade", commitErr, data)
+}
+
+// WriteRecords appends the failed batch of the record channel of the storage, other than ticker and trade.
+func (d *DeadLetter) WriteRecords(str string, channel string, commitErr error, data []interface{}) error {
+	return d.write(str, channel, commitErr, data)
+}
+
+func (d *DeadLetter) write(str string, channel string, commitErr error, data interface{}) error {
+	line, err := jsoniter.Marshal(deadLetterRecord{
+		Storage:  str,
+		Channel:  channel,
+		Error:    commitErr.Error(),
+		FailedAt: time.Now().UTC(),
+		Data:     data,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Plugin storage names have a colon, which is not allowed in file names on all the systems.
+	name := strings.ReplaceAll(str, ":", "_") + "_" + channel + "_dead_letter.jsonl"
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	file, err := os.OpenFile(filepath.Join(d.Dir, name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if _, err = w.Write(line); err != nil {
+		file.Close()
+		return err
+	}
+	if err = w.WriteByte('\n'); err != nil {
+		file.Close()
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,463 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Delta is for writing data as parquet files to s3 compatible storage and committing them to delta lake tables.
+// There is one table per channel, partitioned by exchange and date,
+// so that it can be queried by Spark, Trino or any other delta lake reader.
+type Delta struct {
+	Cfg      *config.Delta
+	client   *s3.S3
+	files    map[string]*deltaFile
+	versions map[string]int64
+	mu       sync.Mutex
+}
+
+var delta Delta
+
+// Default values, if not configured.
+const (
+	deltaCommitIntervalMin = 15
+	deltaMaxRetries        = 3
+)
+
+// deltaFile is a parquet data file being buffered in memory for a table partition.
+type deltaFile struct {
+	channel  string
+	exchange string
+	date     string
+	buf      bytes.Buffer
+	pw       *writer.ParquetWriter
+	openedAt time.Time
+}
+
+// deltaAction is a single line of the delta lake transaction log.
+type deltaAction struct {
+	Protocol   *deltaProtocol `json:"protocol,omitempty"`
+	MetaData   *deltaMetaData `json:"metaData,omitempty"`
+	Add        *deltaAdd      `json:"add,omitempty"`
+	CommitInfo *deltaCommit   `json:"commitInfo,omitempty"`
+}
+
+type deltaProtocol struct {
+	MinReaderVersion int `json:"minReaderVersion"`
+	MinWriterVersion int `json:"minWriterVersion"`
+}
+
+type deltaMetaData struct {
+	ID               string            `json:"id"`
+	Format           deltaFormat       `json:"format"`
+	SchemaString     string            `json:"schemaString"`
+	PartitionColumns []string          `json:"partitionColumns"`
+	Configuration    map[string]string `json:"configuration"`
+	CreatedTime      int64             `json:"createdTime"`
+}
+
+type deltaFormat struct {
+	Provider string            `json:"provider"`
+	Options  map[string]string `json:"options"`
+}
+
+type deltaAdd struct {
+	Path             string            `json:"path"`
+	PartitionValues  map[string]string `json:"partitionValues"`
+	Size             int64             `json:"size"`
+	ModificationTime int64             `json:"modificationTime"`
+	DataChange       bool              `json:"dataChange"`
+}
+
+type deltaCommit struct {
+	Timestamp  int64  `json:"timestamp"`
+	Operation  string `json:"operation"`
+	EngineInfo string `json:"engineInfo"`
+}
+
+// deltaColumns are the columns of the tables, in the order of the parquet schema, with delta lake types.
+// Partition columns exchange and date are not written to the data files, they are in the log.
+var deltaColumns = map[string][][2]string{
+	"ticker": {
+		{"market", "string"}, {"base", "string"}, {"quote", "string"}, {"price", "double"},
+		{"best_bid", "double"}, {"best_ask", "double"}, {"volume", "double"}, {"high", "double"},
+		{"low", "double"}, {"price_usd", "double"}, {"is_bad_tick", "boolean"},
+		{"timestamp", "timestamp"}, {"created_at", "timestamp"},
+	},
+	"trade": {
+		{"market", "string"}, {"base", "string"}, {"quote", "string"}, {"trade_id", "string"},
+		{"side", "string"}, {"size", "double"}, {"price", "double"}, {"is_buyer_maker", "boolean"},
+		{"price_usd", "double"}, {"is_bad_tick", "boolean"},
+		{"timestamp", "timestamp"}, {"created_at", "timestamp"},
+	},
+}
+
+type deltaTicker struct {
+	Market    string  `parquet:"name=market, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Base      string  `parquet:"name=base, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Quote     string  `parquet:"name=quote, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Price     float64 `parquet:"name=price, type=DOUBLE"`
+	BestBid   float64 `parquet:"name=best_bid, type=DOUBLE"`
+	BestAsk   float64 `parquet:"name=best_ask, type=DOUBLE"`
+	Volume    float64 `parquet:"name=volume, type=DOUBLE"`
+	High      float64 `parquet:"name=high, type=DOUBLE"`
+	Low       float64 `parquet:"name=low, type=DOUBLE"`
+	PriceUSD  float64 `parquet:"name=price_usd, type=DOUBLE"`
+	BadTick   bool    `parquet:"name=is_bad_tick, type=BOOLEAN"`
+	Timestamp int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	CreatedAt int64   `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+}
+
+type deltaTrade struct {
+	Market     string  `parquet:"name=market, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Base       string  `parquet:"name=base, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Quote      string  `parquet:"name=quote, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	TradeID    string  `parquet:"name=trade_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Side       string  `parquet:"name=side, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Size       float64 `parquet:"name=size, type=DOUBLE"`
+	Price      float64 `parquet:"name=price, type=DOUBLE"`
+	BuyerMaker bool    `parquet:"name=is_buyer_maker, type=BOOLEAN"`
+	PriceUSD   float64 `parquet:"name=price_usd, type=DOUBLE"`
+	BadTick    bool    `parquet:"name=is_bad_tick, type=BOOLEAN"`
+	Timestamp  int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	CreatedAt  int64   `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+}
+
+// InitDelta initializes s3 client with configured values
+// and reads the latest committed version of the ticker and trade tables, if they exist already.
+func InitDelta(cfg *config.Delta) (*Delta, error) {
+	if delta.Cfg == nil {
+		maxRetries := cfg.MaxRetries
+		if maxRetries == 0 {
+			maxRetries = deltaMaxRetries
+		}
+		awsCfg := aws.NewConfig().
+			WithRegion(cfg.Region).
+			WithS3ForcePathStyle(cfg.ForcePathStyle).
+			WithMaxRetries(maxRetries)
+		if cfg.Endpoint != "" {
+			awsCfg = awsCfg.WithEndpoint(cfg.Endpoint)
+		}
+		if cfg.AccessKeyID != "" {
+			awsCfg = awsCfg.WithCredentials(credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, ""))
+		}
+		sess, err := session.NewSession(awsCfg)
+		if err != nil {
+			return nil, err
+		}
+		client := s3.New(sess)
+
+		var ctx context.Context
+		if cfg.ReqTimeoutSec > 0 {
+			timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReqTimeoutSec)*time.Second)
+			ctx = timeoutCtx
+			defer cancel()
+		} else {
+			ctx = context.Background()
+		}
+		versions := make(map[string]int64)
+		for channel := range deltaColumns {
+			version, err := deltaLatestVersion(ctx, client, cfg, channel)
+			if err != nil {
+				return nil, err
+			}
+			versions[channel] = version
+		}
+		delta = Delta{
+			Cfg:      cfg,
+			client:   client,
+			files:    make(map[string]*deltaFile),
+			versions: versions,
+		}
+	}
+	return &delta, nil
+}
+
+// GetDelta returns already prepared delta instance.
+func GetDelta() *Delta {
+	return &delta
+}
+
+// CommitTickers buffers input ticker data to the data files of the table partitions.
+func (d *Delta) CommitTickers(appCtx context.Context, data []Ticker) error {
+	now := time.Now().UTC()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if appCtx.Err() != nil {
+		return appCtx.Err()
+	}
+	for _, ticker := range data {
+		f, err := d.file("ticker", ticker.Exchange, ticker.Timestamp, new(deltaTicker), now)
+		if err != nil {
+			return err
+		}
+		err = f.pw.Write(&deltaTicker{
+			Market:    ticker.MktCommitName,
+			Base:      ticker.Base,
+			Quote:     ticker.Quote,
+			Price:     ticker.Price,
+			BestBid:   ticker.BestBid,
+			BestAsk:   ticker.BestAsk,
+			Volume:    ticker.Volume,
+			High:      ticker.High,
+			Low:       ticker.Low,
+			PriceUSD:  ticker.PriceUSD,
+			BadTick:   ticker.IsBadTick,
+			Timestamp: ticker.Timestamp.UnixNano() / int64(time.Microsecond),
+			CreatedAt: now.UnixNano() / int64(time.Microsecond),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CommitTrades buffers input trade data to the data files of the table partitions.
+func (d *Delta) CommitTrades(appCtx context.Context, data []Trade) error {
+	now := time.Now().UTC()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if appCtx.Err() != nil {
+		return appCtx.Err()
+	}
+	for _, trade := range data {
+		f, err := d.file("trade", trade.Exchange, trade.Timestamp, new(deltaTrade), now)
+		if err != nil {
+			return err
+		}
+		err = f.pw.Write(&deltaTrade{
+			Market:     trade.MktCommitName,
+			Base:       trade.Base,
+			Quote:      trade.Quote,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			BuyerMaker: trade.IsBuyerMaker,
+			PriceUSD:   trade.PriceUSD,
+			BadTick:    trade.IsBadTick,
+			Timestamp:  trade.Timestamp.UnixNano() / int64(time.Microsecond),
+			CreatedAt:  now.UnixNano() / int64(time.Microsecond),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// file returns the buffered data file of the table partition, creating it if needed.
+func (d *Delta) file(channel string, exchange string, timestamp time.Time, schema interface{}, now time.Time) (*deltaFile, error) {
+	date := timestamp.UTC().Format("2006-01-02")
+	key := channel + "/" + exchange + "/" + date
+	f := d.files[key]
+	if f == nil {
+		f = &deltaFile{
+			channel:  channel,
+			exchange: exchange,
+			date:     date,
+			openedAt: now,
+		}
+		pw, err := writer.NewParquetWriterFromWriter(&f.buf, schema, 1)
+		if err != nil {
+			return nil, err
+		}
+		pw.CompressionType = parquet.CompressionCodec_SNAPPY
+		f.pw = pw
+		d.files[key] = f
+	}
+	return f, nil
+}
+
+// Serve commits the buffered data files to the tables at every commit interval.
+func (d *Delta) Serve(appCtx context.Context) error {
+	interval := d.Cfg.CommitIntervalMin
+	if interval == 0 {
+		interval = deltaCommitIntervalMin
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.commit(appCtx); err != nil {
+				return err
+			}
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+	}
+}
+
+// Close commits all the buffered data files.
+// It is called at the app exit, so the context passed is not the cancelled app context.
+func (d *Delta) Close(ctx context.Context) error {
+	return d.commit(ctx)
+}
+
+// commit uploads the buffered data files and then writes a new version to the log of each table,
+// adding those files. Data files are not visible to the readers until the log entry is written,
+// so a failed upload never leaves a partial commit behind.
+func (d *Delta) commit(appCtx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var ctx context.Context
+	if d.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(d.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = appCtx
+	}
+
+	adds := make(map[string][]deltaAction)
+	for key, f := range d.files {
+		delete(d.files, key)
+		if err := f.pw.WriteStop(); err != nil {
+			return err
+		}
+		path := fmt.Sprintf("exchange=%s/date=%s/part-%s-%s.snappy.parquet", f.exchange, f.date, f.openedAt.Format("20060102T150405"), randomID())
+		_, err := d.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(d.Cfg.Bucket),
+			Key:         aws.String(deltaTablePath(d.Cfg, f.channel) + path),
+			Body:        bytes.NewReader(f.buf.Bytes()),
+			ContentType: aws.String("application/vnd.apache.parquet"),
+		})
+		if err != nil {
+			return err
+		}
+		adds[f.channel] = append(adds[f.channel], deltaAction{Add: &deltaAdd{
+			Path:             path,
+			PartitionValues:  map[string]string{"exchange": f.exchange, "date": f.date},
+			Size:             int64(f.buf.Len()),
+			ModificationTime: time.Now().UnixNano() / int64(time.Millisecond),
+			DataChange:       true,
+		}})
+	}
+
+	for channel, actions := range adds {
+		now := time.Now().UnixNano() / int64(time.Millisecond)
+		version := d.versions[channel] + 1
+		if version == 0 {
+			schema, err := deltaSchema(channel)
+			if err != nil {
+				return err
+			}
+			actions = append([]deltaAction{
+				{Protocol: &deltaProtocol{MinReaderVersion: 1, MinWriterVersion: 2}},
+				{MetaData: &deltaMetaData{
+					ID:               randomID(),
+					Format:           deltaFormat{Provider: "parquet", Options: map[string]string{}},
+					SchemaString:     schema,
+					PartitionColumns: []string{"exchange", "date"},
+					Configuration:    map[string]string{},
+					CreatedTime:      now,
+				}},
+			}, actions...)
+		}
+		actions = append(actions, deltaAction{CommitInfo: &deltaCommit{
+			Timestamp:  now,
+			Operation:  "WRITE",
+			EngineInfo: "cryptogalaxy",
+		}})
+		var buf bytes.Buffer
+		for _, action := range actions {
+			line, err := jsoniter.Marshal(action)
+			if err != nil {
+				return err
+			}
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+		_, err := d.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(d.Cfg.Bucket),
+			Key:         aws.String(fmt.Sprintf("%s_delta_log/%020d.json", deltaTablePath(d.Cfg, channel), version)),
+			Body:        bytes.NewReader(buf.Bytes()),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			return err
+		}
+		d.versions[channel] = version
+	}
+	return nil
+}
+
+// deltaLatestVersion returns the latest version in the log of the table, -1 if the table does not exist yet.
+func deltaLatestVersion(ctx context.Context, client *s3.S3, cfg *config.Delta, channel string) (int64, error) {
+	version := int64(-1)
+	prefix := deltaTablePath(cfg, channel) + "_delta_log/"
+	err := client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(cfg.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			name := strings.TrimPrefix(aws.StringValue(obj.Key), prefix)
+			if !strings.HasSuffix(name, ".json") {
+				continue
+			}
+			v, err := strconv.ParseInt(strings.TrimSuffix(name, ".json"), 10, 64)
+			if err == nil && v > version {
+				version = v
+			}
+		}
+		return true
+	})
+	return version, err
+}
+
+// deltaTablePath returns the object key prefix of the channel table, ending with a slash.
+func deltaTablePath(cfg *config.Delta, channel string) string {
+	return strings.Trim(cfg.Path+"/"+channel, "/") + "/"
+}
+
+// deltaSchema returns the spark struct schema of the channel table, as required in the table metadata.
+func deltaSchema(channel string) (string, error) {
+	type field struct {
+		Name     string            `json:"name"`
+		Type     string            `json:"type"`
+		Nullable bool              `json:"nullable"`
+		Metadata map[string]string `json:"metadata"`
+	}
+	fields := []field{
+		{Name: "exchange", Type: "string", Nullable: true, Metadata: map[string]string{}},
+		{Name: "date", Type: "date", Nullable: true, Metadata: map[string]string{}},
+	}
+	for _, col := range deltaColumns[channel] {
+		fields = append(fields, field{Name: col[0], Type: col[1], Nullable: true, Metadata: map[string]string{}})
+	}
+	schema, err := jsoniter.Marshal(struct {
+		Type   string  `json:"type"`
+		Fields []field `json:"fields"`
+	}{
+		Type:   "struct",
+		Fields: fields,
+	})
+	return string(schema), err
+}
+
+// randomID returns a random uuid v4 string.
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"time"
 
@@ -14,26 +13,45 @@ import (
 )
 
 // ElasticSearch is for connecting and indexing data to elastic search.
+// Bulk requests in flight are limited by workers, if configured.
+// Documents are encoded by json, which renames the fields as per the configured names.
 type ElasticSearch struct {
 	ES        *elasticsearch.Client
 	IndexName string
 	Cfg       *config.ES
+	json      jsoniter.API
+	workers   chan struct{}
 }
 
 var elasticSearch ElasticSearch
 
 // InitElasticSearch initializes elastic search connection with configured values.
+// Authentication is either basic, API key or AWS SigV4 signing, and TLS is configured for the https addresses.
 func InitElasticSearch(cfg *config.ES) (*ElasticSearch, error) {
 	if elasticSearch.ES == nil {
 		t := http.DefaultTransport.(*http.Transport).Clone()
 		t.MaxIdleConns = cfg.MaxIdleConns
 		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+		tlsCfg, err := esTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig = tlsCfg
 		esCfg := elasticsearch.Config{
 			Addresses: cfg.Addresses,
+			CloudID:   cfg.CloudID,
+			APIKey:    cfg.APIKey,
 			Username:  cfg.Username,
 			Password:  cfg.Password,
 			Transport: t,
 		}
+		if cfg.AWSSigV4 {
+			signer, err := newESSigV4Transport(t, cfg.AWSRegion)
+			if err != nil {
+				return nil, err
+			}
+			esCfg.Transport = signer
+		}
 		es, err := elasticsearch.NewClient(esCfg)
 		if err != nil {
 			return nil, err
@@ -46,15 +64,27 @@ func InitElasticSearch(cfg *config.ES) (*ElasticSearch, error) {
 		} else {
 			ctx = context.Background()
 		}
-		_, err = es.Ping(es.Ping.WithContext(ctx))
+		resp, err := es.Ping(es.Ping.WithContext(ctx))
 		if err != nil {
 			return nil, err
 		}
+		resp.Body.Close()
+		if resp.IsError() {
+			return nil, fmt.Errorf("code : %v, status : %v", resp.StatusCode, resp.Status())
+		}
 		elasticSearch = ElasticSearch{
 			ES:        es,
 			IndexName: cfg.IndexName,
 			Cfg:       cfg,
 		}
+		if cfg.BulkWorkers > 0 {
+			elasticSearch.workers = make(chan struct{}, cfg.BulkWorkers)
+		}
+		elasticSearch.json = jsoniter.ConfigDefault
+		if len(cfg.Names.Fields) > 0 {
+			elasticSearch.json = jsoniter.Config{EscapeHTML: true}.Froze()
+			elasticSearch.json.RegisterExtension(&esFieldNames{names: cfg.Names.Fields})
+		}
 	}
 	return &elasticSearch, nil
 }
@@ -64,33 +94,93 @@ func GetElasticSearch() *ElasticSearch {
 	return &elasticSearch
 }
 
-// esData holds either ticker or trade data which will be sent to elastic search
+// esData holds either ticker, trade, mark price, bbo, trading status or order flow data which will be sent to elastic search
 type esData struct {
-	Channel   string    `json:"channel"`
-	Exchange  string    `json:"exchange"`
-	Market    string    `json:"market"`
-	TradeID   string    `json:"trade_id"`
-	Side      string    `json:"side"`
-	Size      float64   `json:"size"`
-	Price     float64   `json:"price"`
-	Timestamp time.Time `json:"timestamp"`
-	CreatedAt time.Time `json:"created_at"`
+	Channel        string    `json:"channel"`
+	Exchange       string    `json:"exchange"`
+	Market         string    `json:"market"`
+	Base           string    `json:"base"`
+	Quote          string    `json:"quote"`
+	TradeID        string    `json:"trade_id"`
+	Side           string    `json:"side"`
+	Size           float64   `json:"size"`
+	Price          float64   `json:"price"`
+	PriceUSD       float64   `json:"price_usd"`
+	BadTick        bool      `json:"is_bad_tick"`
+	BuyerMaker     bool      `json:"is_buyer_maker"`
+	BestBid        float64   `json:"best_bid"`
+	BestAsk        float64   `json:"best_ask"`
+	Volume         float64   `json:"volume"`
+	High           float64   `json:"high"`
+	Low            float64   `json:"low"`
+	MarkPrice      float64   `json:"mark_price"`
+	IndexPrice     float64   `json:"index_price"`
+	Basis          float64   `json:"basis"`
+	BidPrice       float64   `json:"bid_price"`
+	BidSize        float64   `json:"bid_size"`
+	AskPrice       float64   `json:"ask_price"`
+	AskSize        float64   `json:"ask_size"`
+	Status         string    `json:"status"`
+	TickSize       float64   `json:"tick_size"`
+	LotSize        float64   `json:"lot_size"`
+	PricePrecision int       `json:"price_precision"`
+	SizePrecision  int       `json:"size_precision"`
+	Interval       string    `json:"interval"`
+	Open           float64   `json:"open"`
+	Close          float64   `json:"close"`
+	Window         string    `json:"window"`
+	VWAP           float64   `json:"vwap"`
+	TWAP           float64   `json:"twap"`
+	Levels         int       `json:"levels"`
+	Spread         float64   `json:"spread"`
+	MidPrice       float64   `json:"mid_price"`
+	BidDepth       float64   `json:"bid_depth"`
+	AskDepth       float64   `json:"ask_depth"`
+	Imbalance      float64   `json:"imbalance"`
+	TradeCount     int64     `json:"trade_count"`
+	BuyVolume      float64   `json:"buy_volume"`
+	SellVolume     float64   `json:"sell_volume"`
+	Notional       float64   `json:"notional"`
+	MarketCap      float64   `json:"market_cap"`
+	Rank           int       `json:"rank"`
+	Supply         float64   `json:"circulating_supply"`
+	BuyExchange    string    `json:"buy_exchange"`
+	BuyPrice       float64   `json:"buy_price"`
+	SellExchange   string    `json:"sell_exchange"`
+	SellPrice      float64   `json:"sell_price"`
+	SpreadPercent  float64   `json:"spread_percent"`
+	Event          string    `json:"event"`
+	OrderID        string    `json:"order_id"`
+	TakerOrderID   string    `json:"taker_order_id"`
+	Reason         string    `json:"reason"`
+	Sequence       uint64    `json:"sequence"`
+	Timestamp      time.Time `json:"timestamp"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
 // CommitTickers batch inserts input ticker data to elastic search.
 func (e *ElasticSearch) CommitTickers(appCtx context.Context, data []Ticker) error {
 	var buf bytes.Buffer
 	for _, ticker := range data {
-		meta := []byte(fmt.Sprintf(`{"create":{}}%s`, "\n"))
 		ed := esData{
 			Channel:   "ticker",
 			Exchange:  ticker.Exchange,
 			Market:    ticker.MktCommitName,
+			Base:      ticker.Base,
+			Quote:     ticker.Quote,
 			Price:     ticker.Price,
+			BestBid:   ticker.BestBid,
+			BestAsk:   ticker.BestAsk,
+			Volume:    ticker.Volume,
+			High:      ticker.High,
+			Low:       ticker.Low,
+			PriceUSD:  ticker.PriceUSD,
+			BadTick:   ticker.IsBadTick,
 			Timestamp: ticker.Timestamp,
 			CreatedAt: time.Now().UTC(),
 		}
-		esBytes, err := jsoniter.Marshal(ed)
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
 		if err != nil {
 			return err
 		}
@@ -99,36 +189,103 @@ func (e *ElasticSearch) CommitTickers(appCtx context.Context, data []Ticker) err
 		buf.Write(meta)
 		buf.Write(esBytes)
 	}
-	var ctx context.Context
-	if e.Cfg.ReqTimeoutSec > 0 {
-		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(e.Cfg.ReqTimeoutSec)*time.Second)
-		ctx = timeoutCtx
-		defer cancel()
-	} else {
-		ctx = context.Background()
-	}
-	resp, err := e.ES.Bulk(bytes.NewReader(buf.Bytes()), e.ES.Bulk.WithIndex(e.IndexName), e.ES.Bulk.WithContext(ctx))
-	if err != nil {
-		return err
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitTrades batch inserts input trade data to elastic search.
+func (e *ElasticSearch) CommitTrades(appCtx context.Context, data []Trade) error {
+	var buf bytes.Buffer
+	for _, trade := range data {
+		ed := esData{
+			Channel:    "trade",
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			Base:       trade.Base,
+			Quote:      trade.Quote,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			BuyerMaker: trade.IsBuyerMaker,
+			PriceUSD:   trade.PriceUSD,
+			BadTick:    trade.IsBadTick,
+			Timestamp:  trade.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("code : %v, status : %v", resp.StatusCode, resp.Status())
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitMarkPrices batch inserts input mark price data to elastic search.
+func (e *ElasticSearch) CommitMarkPrices(appCtx context.Context, data []MarkPrice) error {
+	var buf bytes.Buffer
+	for _, markPrice := range data {
+		ed := esData{
+			Channel:    "mark_price",
+			Exchange:   markPrice.Exchange,
+			Market:     markPrice.MktCommitName,
+			MarkPrice:  markPrice.MarkPrice,
+			IndexPrice: markPrice.IndexPrice,
+			Basis:      markPrice.Basis,
+			Timestamp:  markPrice.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
 	}
-	_, err = io.Copy(io.Discard, resp.Body)
-	if err != nil {
-		return err
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitBBOs batch inserts input best bid and offer data to elastic search.
+func (e *ElasticSearch) CommitBBOs(appCtx context.Context, data []BBO) error {
+	var buf bytes.Buffer
+	for _, bbo := range data {
+		ed := esData{
+			Channel:   "bbo",
+			Exchange:  bbo.Exchange,
+			Market:    bbo.MktCommitName,
+			BidPrice:  bbo.BidPrice,
+			BidSize:   bbo.BidSize,
+			AskPrice:  bbo.AskPrice,
+			AskSize:   bbo.AskSize,
+			Timestamp: bbo.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
 	}
-	return nil
+	return e.bulk(appCtx, buf.Bytes())
 }
 
-// CommitTrades batch inserts input trade data to elastic search.
-func (e *ElasticSearch) CommitTrades(appCtx context.Context, data []Trade) error {
+// CommitBlockTrades batch inserts input block trade data to elastic search.
+func (e *ElasticSearch) CommitBlockTrades(appCtx context.Context, data []Trade) error {
 	var buf bytes.Buffer
 	for _, trade := range data {
-		meta := []byte(fmt.Sprintf(`{"create":{}}%s`, "\n"))
 		ed := esData{
-			Channel:   "trade",
+			Channel:   "block_trade",
 			Exchange:  trade.Exchange,
 			Market:    trade.MktCommitName,
 			TradeID:   trade.TradeID,
@@ -138,7 +295,154 @@ func (e *ElasticSearch) CommitTrades(appCtx context.Context, data []Trade) error
 			Timestamp: trade.Timestamp,
 			CreatedAt: time.Now().UTC(),
 		}
-		esBytes, err := jsoniter.Marshal(ed)
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
+	}
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitTradingStatuses batch inserts input trading status data to elastic search.
+func (e *ElasticSearch) CommitTradingStatuses(appCtx context.Context, data []TradingStatus) error {
+	var buf bytes.Buffer
+	for _, tradingStatus := range data {
+		ed := esData{
+			Channel:   "trading_status",
+			Exchange:  tradingStatus.Exchange,
+			Market:    tradingStatus.MktCommitName,
+			Status:    tradingStatus.Status,
+			Timestamp: tradingStatus.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
+	}
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitAggTrades batch inserts input aggregated trade data to elastic search.
+func (e *ElasticSearch) CommitAggTrades(appCtx context.Context, data []Trade) error {
+	var buf bytes.Buffer
+	for _, trade := range data {
+		ed := esData{
+			Channel:    "agg_trade",
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			BuyerMaker: trade.IsBuyerMaker,
+			Timestamp:  trade.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
+	}
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitOrderFlows batch inserts input order flow data to elastic search.
+func (e *ElasticSearch) CommitOrderFlows(appCtx context.Context, data []OrderFlow) error {
+	var buf bytes.Buffer
+	for _, orderFlow := range data {
+		ed := esData{
+			Channel:      "orderflow",
+			Exchange:     orderFlow.Exchange,
+			Market:       orderFlow.MktCommitName,
+			Event:        orderFlow.Event,
+			OrderID:      orderFlow.OrderID,
+			TakerOrderID: orderFlow.TakerOrderID,
+			TradeID:      orderFlow.TradeID,
+			Side:         orderFlow.Side,
+			Size:         orderFlow.Size,
+			Price:        orderFlow.Price,
+			Reason:       orderFlow.Reason,
+			Sequence:     orderFlow.Sequence,
+			Timestamp:    orderFlow.Timestamp,
+			CreatedAt:    time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
+	}
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitInstruments batch inserts input instrument data to elastic search.
+func (e *ElasticSearch) CommitInstruments(appCtx context.Context, data []Instrument) error {
+	var buf bytes.Buffer
+	for _, instrument := range data {
+		ed := esData{
+			Channel:        "instrument",
+			Exchange:       instrument.Exchange,
+			Market:         instrument.MktCommitName,
+			TickSize:       instrument.TickSize,
+			LotSize:        instrument.LotSize,
+			PricePrecision: instrument.PricePrecision,
+			SizePrecision:  instrument.SizePrecision,
+			Status:         instrument.Status,
+			Timestamp:      instrument.Timestamp,
+			CreatedAt:      time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
+	}
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitCandles batch inserts input candle data to elastic search.
+func (e *ElasticSearch) CommitCandles(appCtx context.Context, data []Candle) error {
+	var buf bytes.Buffer
+	for _, candle := range data {
+		ed := esData{
+			Channel:   "candle",
+			Exchange:  candle.Exchange,
+			Market:    candle.MktCommitName,
+			Interval:  candle.Interval,
+			Open:      candle.Open,
+			High:      candle.High,
+			Low:       candle.Low,
+			Close:     candle.Close,
+			Volume:    candle.Volume,
+			Timestamp: candle.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
 		if err != nil {
 			return err
 		}
@@ -147,25 +451,175 @@ func (e *ElasticSearch) CommitTrades(appCtx context.Context, data []Trade) error
 		buf.Write(meta)
 		buf.Write(esBytes)
 	}
-	var ctx context.Context
-	if e.Cfg.ReqTimeoutSec > 0 {
-		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(e.Cfg.ReqTimeoutSec)*time.Second)
-		ctx = timeoutCtx
-		defer cancel()
-	} else {
-		ctx = context.Background()
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitAvgPrices batch inserts input average price data to elastic search.
+func (e *ElasticSearch) CommitAvgPrices(appCtx context.Context, data []AvgPrice) error {
+	var buf bytes.Buffer
+	for _, avgPrice := range data {
+		ed := esData{
+			Channel:   "avg_price",
+			Exchange:  avgPrice.Exchange,
+			Market:    avgPrice.MktCommitName,
+			Window:    avgPrice.Window,
+			VWAP:      avgPrice.VWAP,
+			TWAP:      avgPrice.TWAP,
+			Timestamp: avgPrice.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
+	}
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitBookMetrics batch inserts input book metric data to elastic search.
+func (e *ElasticSearch) CommitBookMetrics(appCtx context.Context, data []BookMetric) error {
+	var buf bytes.Buffer
+	for _, bookMetric := range data {
+		ed := esData{
+			Channel:   "book_metric",
+			Exchange:  bookMetric.Exchange,
+			Market:    bookMetric.MktCommitName,
+			Levels:    bookMetric.Levels,
+			Spread:    bookMetric.Spread,
+			MidPrice:  bookMetric.MidPrice,
+			BidDepth:  bookMetric.BidDepth,
+			AskDepth:  bookMetric.AskDepth,
+			Imbalance: bookMetric.Imbalance,
+			Timestamp: bookMetric.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
+	}
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitMarketStats batch inserts input market stats data to elastic search.
+func (e *ElasticSearch) CommitMarketStats(appCtx context.Context, data []MarketStats) error {
+	var buf bytes.Buffer
+	for _, marketStats := range data {
+		ed := esData{
+			Channel:    "market_stats",
+			Exchange:   marketStats.Exchange,
+			Market:     marketStats.MktCommitName,
+			Interval:   marketStats.Interval,
+			TradeCount: marketStats.TradeCount,
+			BuyVolume:  marketStats.BuyVolume,
+			SellVolume: marketStats.SellVolume,
+			Notional:   marketStats.Notional,
+			Timestamp:  marketStats.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
 	}
-	resp, err := e.ES.Bulk(bytes.NewReader(buf.Bytes()), e.ES.Bulk.WithIndex(e.IndexName), e.ES.Bulk.WithContext(ctx))
-	if err != nil {
-		return err
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitFXRates batch inserts input fx rate data to elastic search.
+func (e *ElasticSearch) CommitFXRates(appCtx context.Context, data []FXRate) error {
+	var buf bytes.Buffer
+	for _, fxRate := range data {
+		ed := esData{
+			Channel:   "fx_rate",
+			Exchange:  "fx",
+			Market:    fxRate.Currency + "/USD",
+			Price:     fxRate.Rate,
+			Timestamp: fxRate.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("code : %v, status : %v", resp.StatusCode, resp.Status())
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitCoinInfos batch inserts input coin info data to elastic search.
+func (e *ElasticSearch) CommitCoinInfos(appCtx context.Context, data []CoinInfo) error {
+	var buf bytes.Buffer
+	for _, coinInfo := range data {
+		ed := esData{
+			Channel:   "coin_info",
+			Exchange:  "coingecko",
+			Market:    coinInfo.CoinID,
+			Base:      coinInfo.Base,
+			MarketCap: coinInfo.MarketCap,
+			Rank:      coinInfo.Rank,
+			Supply:    coinInfo.CirculatingSupply,
+			Timestamp: coinInfo.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
 	}
-	_, err = io.Copy(io.Discard, resp.Body)
-	if err != nil {
-		return err
+	return e.bulk(appCtx, buf.Bytes())
+}
+
+// CommitArbitrageSpreads batch inserts input arbitrage spread data to elastic search.
+func (e *ElasticSearch) CommitArbitrageSpreads(appCtx context.Context, data []ArbitrageSpread) error {
+	var buf bytes.Buffer
+	for _, arbitrageSpread := range data {
+		ed := esData{
+			Channel:       "arbitrage_spread",
+			Exchange:      "arbitrage",
+			Market:        arbitrageSpread.Base + "/" + arbitrageSpread.Quote,
+			Base:          arbitrageSpread.Base,
+			Quote:         arbitrageSpread.Quote,
+			BuyExchange:   arbitrageSpread.BuyExchange,
+			BuyPrice:      arbitrageSpread.BuyPrice,
+			SellExchange:  arbitrageSpread.SellExchange,
+			SellPrice:     arbitrageSpread.SellPrice,
+			SpreadPercent: arbitrageSpread.SpreadPercent,
+			Timestamp:     arbitrageSpread.Timestamp,
+			CreatedAt:     time.Now().UTC(),
+		}
+		meta := e.meta(&ed)
+		esBytes, err := e.json.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		esBytes = append(esBytes, "\n"...)
+		buf.Grow(len(meta) + len(esBytes))
+		buf.Write(meta)
+		buf.Write(esBytes)
 	}
-	return nil
+	return e.bulk(appCtx, buf.Bytes())
 }
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/tlsconfig"
+)
+
+// esTLSConfig returns the TLS config of the elastic search connection, for the clusters with self-signed
+// or private CA certificates and the ones requiring client certificates.
+func esTLSConfig(cfg *config.ES) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CACertFile != "" {
+		pem, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in elastic search ca_cert_file %s", cfg.CACertFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	if err := tlsconfig.Apply(tlsCfg, cfg.MinTLSVersion, cfg.PinnedKeys); err != nil {
+		return nil, err
+	}
+	return tlsCfg, nil
+}
+
+// esSigV4Transport signs the requests with AWS SigV4 before sending them,
+// for AWS hosted elastic search domains with IAM access policy.
+type esSigV4Transport struct {
+	base   http.RoundTripper
+	signer *v4.Signer
+	region string
+}
+
+// newESSigV4Transport returns the signing transport over the base one.
+// Credentials are taken from the default AWS credential chain.
+func newESSigV4Transport(base http.RoundTripper, region string) (*esSigV4Transport, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(region)},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &esSigV4Transport{
+		base:   base,
+		signer: v4.NewSigner(sess.Config.Credentials),
+		region: region,
+	}, nil
+}
+
+// RoundTrip signs a copy of the request, as the signature covers the body which should be read fully,
+// and sends it through the base transport.
+func (t *esSigV4Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	signed := req.Clone(req.Context())
+	if _, err := t.signer.Sign(signed, bytes.NewReader(body), "es", t.region, time.Now()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(signed)
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	jsoniter "github.com/json-iterator/go"
+	"golang.org/x/sync/errgroup"
+)
+
+// esGzipWriters are reused across the bulk requests, as allocating a gzip writer is costly.
+var esGzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// bulk indexes the NDJSON body of create actions.
+// Body bigger than the flush size is split into multiple bulk requests, which are sent concurrently.
+func (e *ElasticSearch) bulk(appCtx context.Context, body []byte) error {
+	chunks := e.chunks(body)
+	if len(chunks) == 1 {
+		return e.send(appCtx, chunks[0])
+	}
+	g, ctx := errgroup.WithContext(appCtx)
+	for _, chunk := range chunks {
+		chunk := chunk
+		g.Go(func() error {
+			return e.send(ctx, chunk)
+		})
+	}
+	return g.Wait()
+}
+
+// chunks splits the body at the document boundaries, so that each chunk is at most of the flush size,
+// unless a single document is bigger than it.
+// Each document is two lines, the action and the source.
+func (e *ElasticSearch) chunks(body []byte) [][]byte {
+	limit := e.Cfg.BulkFlushSizeKB * 1024
+	if limit <= 0 || len(body) <= limit {
+		return [][]byte{body}
+	}
+	var (
+		chunks [][]byte
+		start  int
+		end    int
+		lines  int
+	)
+	for i, b := range body {
+		if b != '\n' {
+			continue
+		}
+		lines++
+		if lines%2 != 0 {
+			continue
+		}
+		if i+1-start > limit && end > start {
+			chunks = append(chunks, body[start:end])
+			start = end
+		}
+		end = i + 1
+	}
+	if end > start {
+		chunks = append(chunks, body[start:end])
+	}
+	return chunks
+}
+
+// send makes a bulk request, waiting for a free worker first, if the workers are configured.
+func (e *ElasticSearch) send(appCtx context.Context, body []byte) error {
+	if e.workers != nil {
+		select {
+		case e.workers <- struct{}{}:
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+		defer func() {
+			<-e.workers
+		}()
+	}
+
+	opts := []func(*esapi.BulkRequest){e.ES.Bulk.WithIndex(e.IndexName)}
+	if e.Cfg.Compress {
+		gz, err := esGzip(body)
+		if err != nil {
+			return err
+		}
+		body = gz
+		opts = append(opts, e.ES.Bulk.WithHeader(map[string]string{"Content-Encoding": "gzip"}))
+	}
+
+	var ctx context.Context
+	if e.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(e.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	opts = append(opts, e.ES.Bulk.WithContext(ctx))
+	resp, err := e.ES.Bulk(bytes.NewReader(body), opts...)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("code : %v, status : %v", resp.StatusCode, resp.Status())
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return esBulkError(respBody)
+}
+
+// esBulkItem is the result of a document in the bulk response.
+type esBulkItem struct {
+	Status int `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// esBulkResponse is the part of the bulk response needed for the failed documents.
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []struct {
+		Create *esBulkItem `json:"create"`
+		Index  *esBulkItem `json:"index"`
+	} `json:"items"`
+}
+
+// esBulkError returns an error if any of the documents failed, as elastic search responds
+// with success to the bulk request even then. The whole batch is failed, so that it is retried,
+// instead of leaving a part of it indexed.
+// Successful documents are duplicated on the retry, unless the deterministic ids are enabled.
+func esBulkError(body []byte) error {
+
+	// Flag is checked first to avoid decoding all the items of the successful response.
+	if !jsoniter.Get(body, "errors").ToBool() {
+		return nil
+	}
+	var resp esBulkResponse
+	if err := jsoniter.Unmarshal(body, &resp); err != nil {
+		return err
+	}
+	var (
+		failed int
+		first  *esBulkItem
+	)
+	for _, action := range resp.Items {
+		item := action.Create
+		if item == nil {
+			item = action.Index
+		}
+		if item == nil || item.Error == nil {
+			continue
+		}
+		failed++
+		if first == nil {
+			first = item
+		}
+	}
+	if first == nil {
+		return errors.New("bulk request has errors")
+	}
+	return fmt.Errorf("bulk request : %d of %d documents failed, status : %v, type : %v, reason : %v", failed, len(resp.Items), first.Status, first.Error.Type, first.Error.Reason)
+}
+
+// esGzip returns the gzip compressed body.
+func esGzip(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(body) / 4)
+	w := esGzipWriters.Get().(*gzip.Writer)
+	defer esGzipWriters.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,345 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	_ "embed" // For the index template mappings.
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// esMappings are the field mappings of the index template, same as scripts/elastic_search_schema.json.
+// New fields should be added to both.
+//
+//go:embed templates/elastic_search_mappings.json
+var esMappings []byte
+
+// esCreateMeta is the bulk action line of a document indexed to the default index of the request.
+var esCreateMeta = []byte(`{"create":{}}` + "\n")
+
+// esTemplatePriority is above the priority of the built-in templates of elastic search (100),
+// so that the index name patterns like logs-* do not conflict with it.
+const esTemplatePriority = 200
+
+// esTemplate is the body of the index template request.
+type esTemplate struct {
+	IndexPatterns []string `json:"index_patterns"`
+	Priority      int      `json:"priority"`
+	Template      struct {
+		Settings struct {
+			LifecycleName string `json:"index.lifecycle.name,omitempty"`
+		} `json:"settings"`
+		Mappings jsoniter.RawMessage `json:"mappings"`
+	} `json:"template"`
+}
+
+// esPolicy is the body of the ILM policy request.
+type esPolicy struct {
+	Policy struct {
+		Phases struct {
+			Hot    *esPhase `json:"hot,omitempty"`
+			Delete *esPhase `json:"delete,omitempty"`
+		} `json:"phases"`
+	} `json:"policy"`
+}
+
+type esPhase struct {
+	MinAge  string    `json:"min_age,omitempty"`
+	Actions esActions `json:"actions"`
+}
+
+type esActions struct {
+	Delete *struct{} `json:"delete,omitempty"`
+}
+
+// SetupIndices creates the ILM policy, if retention is configured, and the index template
+// matching the date suffixed indices, or the indices themselves without the suffix,
+// so that each new index gets the mappings and the policy on creation.
+// Both are updated in place if they already exist.
+// If create indices is configured, the indices without the suffix are created if they do not exist,
+// and the mappings of the existing indices are updated, so that the fields of new record types are added to them.
+func (e *ElasticSearch) SetupIndices(ctx context.Context) error {
+	var template esTemplate
+	template.IndexPatterns = e.indexPatterns()
+	template.Priority = esTemplatePriority
+	mappings, err := e.mappings()
+	if err != nil {
+		return err
+	}
+	template.Template.Mappings = mappings
+	if e.Cfg.ILMDeleteAfterDays > 0 && e.Cfg.IndexSuffix != "" {
+		var policy esPolicy
+		policy.Policy.Phases.Hot = &esPhase{Actions: esActions{}}
+		policy.Policy.Phases.Delete = &esPhase{
+			MinAge:  fmt.Sprintf("%dd", e.Cfg.ILMDeleteAfterDays),
+			Actions: esActions{Delete: &struct{}{}},
+		}
+		body, err := jsoniter.Marshal(policy)
+		if err != nil {
+			return err
+		}
+		resp, err := e.ES.ILM.PutLifecycle(e.policyName(), e.ES.ILM.PutLifecycle.WithBody(bytes.NewReader(body)), e.ES.ILM.PutLifecycle.WithContext(ctx))
+		if err = esCheck(resp, err); err != nil {
+			return fmt.Errorf("ilm policy : %w", err)
+		}
+		template.Template.Settings.LifecycleName = e.policyName()
+	}
+
+	body, err := jsoniter.Marshal(template)
+	if err != nil {
+		return err
+	}
+	resp, err := e.ES.Indices.PutIndexTemplate(e.IndexName, bytes.NewReader(body), e.ES.Indices.PutIndexTemplate.WithContext(ctx))
+	if err = esCheck(resp, err); err != nil {
+		return fmt.Errorf("index template : %w", err)
+	}
+
+	if !e.Cfg.CreateIndices {
+		return nil
+	}
+	if e.Cfg.IndexSuffix == "" {
+		for _, index := range template.IndexPatterns {
+			if err = e.createIndex(ctx, index); err != nil {
+				return fmt.Errorf("index %s : %w", index, err)
+			}
+		}
+	}
+	resp, err = e.ES.Indices.PutMapping(bytes.NewReader(mappings),
+		e.ES.Indices.PutMapping.WithIndex(template.IndexPatterns...),
+		e.ES.Indices.PutMapping.WithAllowNoIndices(true),
+		e.ES.Indices.PutMapping.WithContext(ctx))
+	if err = esCheck(resp, err); err != nil {
+		return fmt.Errorf("index mappings : %w", err)
+	}
+	return nil
+}
+
+// indexPatterns returns the index name patterns of the index template,
+// the date suffixed indices if the suffix is configured, otherwise the indices themselves.
+func (e *ElasticSearch) indexPatterns() []string {
+	suffix := ""
+	if e.Cfg.IndexSuffix != "" {
+		suffix = "-*"
+	}
+	patterns := []string{e.IndexName + suffix}
+	for _, index := range e.Cfg.Names.Tables {
+		patterns = append(patterns, index+suffix)
+	}
+	return patterns
+}
+
+// createIndex creates the index, if it does not exist, which then gets the mappings from the index template.
+// Index created by another app instance in between is not an error.
+func (e *ElasticSearch) createIndex(ctx context.Context, index string) error {
+	resp, err := e.ES.Indices.Exists([]string{index}, e.ES.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	resp, err = e.ES.Indices.Create(index, e.ES.Indices.Create.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if jsoniter.Get(body, "error", "type").ToString() == "resource_already_exists_exception" {
+			return nil
+		}
+		return fmt.Errorf("code : %v, status : %v", resp.StatusCode, string(body))
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+// meta returns the bulk action line of the document.
+// With deterministic ids, the document is indexed with its id, so that a batch committed again
+// after a retry or a restart overwrites the documents instead of duplicating them.
+func (e *ElasticSearch) meta(ed *esData) []byte {
+	index := e.index(ed)
+	if index == "" && !e.Cfg.DeterministicIDs {
+		return esCreateMeta
+	}
+
+	var meta strings.Builder
+	if e.Cfg.DeterministicIDs {
+		meta.WriteString(`{"index":{"_id":"`)
+		meta.WriteString(esDocID(ed))
+		meta.WriteString(`"`)
+	} else {
+		meta.WriteString(`{"create":{`)
+	}
+	if index != "" {
+		if e.Cfg.DeterministicIDs {
+			meta.WriteString(",")
+		}
+		meta.WriteString(`"_index":"`)
+		meta.WriteString(index)
+		meta.WriteString(`"`)
+	}
+	meta.WriteString("}}\n")
+	return []byte(meta.String())
+}
+
+// index returns the index of the document, empty if it is the default one of the request.
+// Channel can have its own index configured, instead of the index name.
+// If the index suffix is configured, the document goes to the index of its day or month,
+// e.g. cryptogalaxy-2021.12.31 or cryptogalaxy-2021.12.
+func (e *ElasticSearch) index(ed *esData) string {
+	index, custom := e.Cfg.Names.Tables[ed.Channel]
+	if !custom {
+		index = e.IndexName
+	}
+	switch e.Cfg.IndexSuffix {
+	case "day":
+		return index + "-" + ed.Timestamp.UTC().Format("2006.01.02")
+	case "month":
+		return index + "-" + ed.Timestamp.UTC().Format("2006.01")
+	}
+	if custom {
+		return index
+	}
+	return ""
+}
+
+// esDocID returns the id of the document derived from the fields identifying it,
+// trade id for the trades and timestamp for the rest.
+// Fields not applicable to the channel are empty, so they do not change the id.
+func esDocID(ed *esData) string {
+	key := ed.TradeID
+	if key == "" {
+		key = ed.Timestamp.UTC().Format(time.RFC3339Nano)
+	}
+	h := sha1.New()
+	for _, field := range []string{ed.Channel, ed.Exchange, ed.Market, ed.Interval, ed.Window, ed.OrderID, ed.Event, strconv.FormatUint(ed.Sequence, 10), key} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// mappings returns the field mappings of the index template, with the configured field names.
+func (e *ElasticSearch) mappings() (jsoniter.RawMessage, error) {
+	if len(e.Cfg.Names.Fields) == 0 {
+		return esMappings, nil
+	}
+
+	// Standard library is used for the maps, as they are not the hot path.
+	var mappings struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(esMappings, &mappings); err != nil {
+		return nil, err
+	}
+	for name, custom := range e.Cfg.Names.Fields {
+		if prop, ok := mappings.Properties[name]; ok {
+			delete(mappings.Properties, name)
+			mappings.Properties[custom] = prop
+		}
+	}
+	return json.Marshal(mappings)
+}
+
+// esFieldNames renames the fields of the documents as per the configured names,
+// for the json encoder of the elastic search instance.
+type esFieldNames struct {
+	jsoniter.DummyExtension
+	names map[string]string
+}
+
+// UpdateStructDescriptor changes the encoded names of the document fields.
+func (x *esFieldNames) UpdateStructDescriptor(desc *jsoniter.StructDescriptor) {
+	if desc.Type.Type1() != reflect.TypeOf(esData{}) {
+		return
+	}
+	for _, binding := range desc.Fields {
+		if len(binding.ToNames) == 0 {
+			continue
+		}
+		if custom, ok := x.names[binding.ToNames[0]]; ok {
+			binding.ToNames = []string{custom}
+			binding.FromNames = []string{custom}
+		}
+	}
+}
+
+// Prune deletes the documents of the channel with timestamp older than the given time,
+// from the index of the channel, including all its date suffixed indices.
+// Version conflicts with the documents indexed meanwhile are ignored, as they are newer anyway.
+func (e *ElasticSearch) Prune(ctx context.Context, channel string, before time.Time) error {
+	index, custom := e.Cfg.Names.Tables[channel]
+	if !custom {
+		index = e.IndexName
+	}
+	if e.Cfg.IndexSuffix != "" {
+		index += "-*"
+	}
+	var query esPruneQuery
+	query.Query.Bool.Filter = []map[string]interface{}{
+		{"term": map[string]string{e.fieldName("channel"): channel}},
+		{"range": map[string]map[string]string{e.fieldName("timestamp"): {"lt": before.UTC().Format(time.RFC3339Nano)}}},
+	}
+
+	// Standard library is used for the maps, as they are not the hot path.
+	body, err := json.Marshal(query)
+	if err != nil {
+		return err
+	}
+	resp, err := e.ES.DeleteByQuery([]string{index}, bytes.NewReader(body),
+		e.ES.DeleteByQuery.WithConflicts("proceed"),
+		e.ES.DeleteByQuery.WithAllowNoIndices(true),
+		e.ES.DeleteByQuery.WithContext(ctx))
+	return esCheck(resp, err)
+}
+
+// esPruneQuery is the body of the delete by query request for the retention.
+type esPruneQuery struct {
+	Query struct {
+		Bool struct {
+			Filter []map[string]interface{} `json:"filter"`
+		} `json:"bool"`
+	} `json:"query"`
+}
+
+// fieldName returns the configured name of the document field, if it is overridden.
+func (e *ElasticSearch) fieldName(name string) string {
+	if custom, ok := e.Cfg.Names.Fields[name]; ok {
+		return custom
+	}
+	return name
+}
+
+// policyName returns the name of the ILM policy of the indices.
+func (e *ElasticSearch) policyName() string {
+	return e.IndexName + "-policy"
+}
+
+// esCheck returns the error of the elastic search request, if any, after reading the response fully.
+func esCheck(resp *esapi.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return fmt.Errorf("code : %v, status : %v", resp.StatusCode, resp.String())
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	eventhub "github.com/Azure/azure-event-hubs-go/v3"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// EventHubs is for connecting and sending data to azure event hubs over AMQP.
+type EventHubs struct {
+	Hub *eventhub.Hub
+	Cfg *config.EventHubs
+}
+
+var eventHubs EventHubs
+
+// InitEventHubs initializes event hubs connection with configured values and checks the hub.
+func InitEventHubs(cfg *config.EventHubs) (*EventHubs, error) {
+	if eventHubs.Hub == nil {
+		connStr := cfg.ConnectionString
+		if cfg.HubName != "" && !strings.Contains(connStr, "EntityPath=") {
+			connStr = strings.TrimSuffix(connStr, ";") + ";EntityPath=" + cfg.HubName
+		}
+		var opts []eventhub.HubOption
+		if cfg.WebSocket {
+			opts = append(opts, eventhub.HubWithWebSocketConnection())
+		}
+		if cfg.MaxRetries > 0 {
+			opts = append(opts, eventhub.HubWithSenderMaxRetryCount(cfg.MaxRetries))
+		}
+		hub, err := eventhub.NewHubFromConnectionString(connStr, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		var ctx context.Context
+		if cfg.ReqTimeoutSec > 0 {
+			timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReqTimeoutSec)*time.Second)
+			ctx = timeoutCtx
+			defer cancel()
+		} else {
+			ctx = context.Background()
+		}
+		_, err = hub.GetRuntimeInformation(ctx)
+		if err != nil {
+			_ = hub.Close(context.Background())
+			return nil, err
+		}
+		eventHubs = EventHubs{
+			Hub: hub,
+			Cfg: cfg,
+		}
+	}
+	return &eventHubs, nil
+}
+
+// GetEventHubs returns already prepared event hubs instance.
+func GetEventHubs() *EventHubs {
+	return &eventHubs
+}
+
+// CommitTickers batch sends input ticker data to event hubs.
+func (e *EventHubs) CommitTickers(appCtx context.Context, data []Ticker) error {
+	events := make([]*eventhub.Event, 0, len(data))
+	for _, ticker := range data {
+		ed := esData{
+			Channel:   "ticker",
+			Exchange:  ticker.Exchange,
+			Market:    ticker.MktCommitName,
+			Base:      ticker.Base,
+			Quote:     ticker.Quote,
+			Price:     ticker.Price,
+			PriceUSD:  ticker.PriceUSD,
+			BadTick:   ticker.IsBadTick,
+			BestBid:   ticker.BestBid,
+			BestAsk:   ticker.BestAsk,
+			Volume:    ticker.Volume,
+			High:      ticker.High,
+			Low:       ticker.Low,
+			Timestamp: ticker.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		value, err := jsoniter.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		events = append(events, eventHubsEvent(ticker.Exchange+"/"+ticker.MktCommitName, value))
+	}
+	return e.send(appCtx, events)
+}
+
+// CommitTrades batch sends input trade data to event hubs.
+func (e *EventHubs) CommitTrades(appCtx context.Context, data []Trade) error {
+	events := make([]*eventhub.Event, 0, len(data))
+	for _, trade := range data {
+		ed := esData{
+			Channel:    "trade",
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			Base:       trade.Base,
+			Quote:      trade.Quote,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			PriceUSD:   trade.PriceUSD,
+			BadTick:    trade.IsBadTick,
+			BuyerMaker: trade.IsBuyerMaker,
+			Timestamp:  trade.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		value, err := jsoniter.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		events = append(events, eventHubsEvent(trade.Exchange+"/"+trade.MktCommitName, value))
+	}
+	return e.send(appCtx, events)
+}
+
+// send sends the events in batches, one or more per partition key,
+// so that all the data of a market lands on the same partition in order.
+func (e *EventHubs) send(appCtx context.Context, events []*eventhub.Event) error {
+	var ctx context.Context
+	if e.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(e.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = appCtx
+	}
+	return e.Hub.SendBatch(ctx, eventhub.NewEventBatchIterator(events...))
+}
+
+func eventHubsEvent(key string, data []byte) *eventhub.Event {
+	event := eventhub.NewEvent(data)
+	event.PartitionKey = &key
+	return event
+}
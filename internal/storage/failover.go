@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// Failover is the fallback storage of a primary one, to which the data is committed while the primary is failing,
+// so that the data keeps flowing during its outage, e.g. a database maintenance window.
+// Primary is tried again at every check interval, and the commits switch back to it once it succeeds.
+type Failover struct {
+	Fallback *Registered
+	checkInt time.Duration
+	mu       sync.Mutex
+	active   bool
+	checkAt  time.Time
+}
+
+// Default values, if not configured.
+const failoverCheckIntSec = 30
+
+// SetFailover sets the fallback storage of the registered primary storage.
+// Both the storages should be registered already.
+func SetFailover(name string, cfg *config.StorageFailover) {
+	reg := registry[name]
+	fallback := registry[cfg.Storage]
+	if reg == nil || fallback == nil {
+		return
+	}
+	interval := cfg.CheckIntSec
+	if interval == 0 {
+		interval = failoverCheckIntSec
+	}
+	reg.Failover = &Failover{
+		Fallback: fallback,
+		checkInt: time.Duration(interval) * time.Second,
+	}
+}
+
+// Active returns whether the data should be committed to the fallback storage, instead of the primary.
+// It is true after a failure of the primary till the next check.
+// While there are batches of the primary spooled to its WAL, it stays true,
+// as the WAL replay is then the one checking the primary.
+func (f *Failover) Active(walPending bool) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.active && (walPending || time.Now().Before(f.checkAt))
+}
+
+// Fail switches to the fallback storage till the next check.
+// It returns true if the primary was not failing before.
+func (f *Failover) Fail() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switched := !f.active
+	f.active = true
+	f.checkAt = time.Now().Add(f.checkInt)
+	return switched
+}
+
+// Recover switches back to the primary storage.
+// It returns true if the primary was failing before.
+func (f *Failover) Recover() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switched := f.active
+	f.active = false
+	return switched
+}
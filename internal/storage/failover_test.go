@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFailover tests the switch to the fallback storage on failure, the check of the primary one
+// after the interval, unless the WAL is still pending, and the switch back on recovery.
+func TestFailover(t *testing.T) {
+	type step struct {
+		action     string // fail, recover or active
+		walPending bool
+		want       bool
+	}
+	tests := []struct {
+		name     string
+		checkInt time.Duration
+		steps    []step
+	}{
+		{"primary by default", time.Minute, []step{{"active", false, false}, {"active", true, false}}},
+		{"fallback after failure", time.Minute, []step{{"fail", false, true}, {"active", false, true}, {"fail", false, false}, {"active", false, true}}},
+		{
+			"primary after recovery", time.Minute,
+			[]step{{"fail", false, true}, {"recover", false, true}, {"active", false, false}, {"active", true, false}, {"recover", false, false}},
+		},
+		{"primary checked after interval", 0, []step{{"fail", false, true}, {"active", false, false}, {"fail", false, false}}},
+		{"fallback while wal pending", 0, []step{{"fail", false, true}, {"active", true, true}, {"active", false, false}}},
+	}
+	for _, tt := range tests {
+		f := &Failover{checkInt: tt.checkInt}
+		for i, s := range tt.steps {
+			var got bool
+			switch s.action {
+			case "fail":
+				got = f.Fail()
+			case "recover":
+				got = f.Recover()
+			case "active":
+				got = f.Active(s.walPending)
+			}
+			if got != s.want {
+				t.Log("ERROR : "+tt.name+" : step", i, s.action, "returned", got, "expected", s.want)
+				t.Error("FAILURE : storage failover")
+			}
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// File is for writing data to flat CSV or JSONL files, rotated by time or size.
+type File struct {
+	Cfg   *config.File
+	files map[string]*flatFile
+	mu    sync.Mutex
+}
+
+var fileStore File
+
+// Default values, if not configured.
+const (
+	fileLayout            = "{exchange}/{channel}/{date}"
+	fileRotateIntervalMin = 60
+)
+
+var (
+	fileTickerHeader = []string{"exchange", "market", "base", "quote", "price", "best_bid", "best_ask", "volume", "high", "low", "price_usd", "is_bad_tick", "timestamp", "created_at"}
+	fileTradeHeader  = []string{"exchange", "market", "base", "quote", "trade_id", "side", "size", "price", "is_buyer_maker", "price_usd", "is_bad_tick", "timestamp", "created_at"}
+)
+
+// flatFile is a file open for writing an exchange channel data.
+type flatFile struct {
+	file   *os.File
+	w      *fileCounter
+	gz     *gzip.Writer
+	buf    *bufio.Writer
+	csv    *csv.Writer
+	period time.Time
+}
+
+// fileCounter counts the bytes written to the file, used for rotation by size.
+type fileCounter struct {
+	f *os.File
+	n int64
+}
+
+func (c *fileCounter) Write(p []byte) (int, error) {
+	n, err := c.f.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// InitFile initializes flat file writing with configured values.
+func InitFile(cfg *config.File) (*File, error) {
+	if fileStore.Cfg == nil {
+		switch cfg.Format {
+		case "", "csv", "jsonl":
+		default:
+			return nil, errors.New("file format should be csv or jsonl")
+		}
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			return nil, err
+		}
+		fileStore = File{
+			Cfg:   cfg,
+			files: make(map[string]*flatFile),
+		}
+	}
+	return &fileStore, nil
+}
+
+// GetFile returns already prepared file instance.
+func GetFile() *File {
+	return &fileStore
+}
+
+// CommitTickers writes input ticker data to files of the exchanges.
+func (f *File) CommitTickers(appCtx context.Context, data []Ticker) error {
+	now := time.Now().UTC()
+	recs := make(map[string][]interface{})
+	var exchanges []string
+	for _, ticker := range data {
+		if _, ok := recs[ticker.Exchange]; !ok {
+			exchanges = append(exchanges, ticker.Exchange)
+		}
+		var rec interface{}
+		if f.Cfg.Format == "jsonl" {
+			rec = &esData{
+				Channel:   "ticker",
+				Exchange:  ticker.Exchange,
+				Market:    ticker.MktCommitName,
+				Base:      ticker.Base,
+				Quote:     ticker.Quote,
+				Price:     ticker.Price,
+				PriceUSD:  ticker.PriceUSD,
+				BadTick:   ticker.IsBadTick,
+				BestBid:   ticker.BestBid,
+				BestAsk:   ticker.BestAsk,
+				Volume:    ticker.Volume,
+				High:      ticker.High,
+				Low:       ticker.Low,
+				Timestamp: ticker.Timestamp,
+				CreatedAt: now,
+			}
+		} else {
+			rec = []string{
+				ticker.Exchange,
+				ticker.MktCommitName,
+				ticker.Base,
+				ticker.Quote,
+				fileFloat(ticker.Price),
+				fileFloat(ticker.BestBid),
+				fileFloat(ticker.BestAsk),
+				fileFloat(ticker.Volume),
+				fileFloat(ticker.High),
+				fileFloat(ticker.Low),
+				fileFloat(ticker.PriceUSD),
+				strconv.FormatBool(ticker.IsBadTick),
+				ticker.Timestamp.UTC().Format(time.RFC3339Nano),
+				now.Format(time.RFC3339Nano),
+			}
+		}
+		recs[ticker.Exchange] = append(recs[ticker.Exchange], rec)
+	}
+	for _, exchange := range exchanges {
+		if err := f.write(appCtx, exchange, "ticker", fileTickerHeader, recs[exchange], now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CommitTrades writes input trade data to files of the exchanges.
+func (f *File) CommitTrades(appCtx context.Context, data []Trade) error {
+	now := time.Now().UTC()
+	recs := make(map[string][]interface{})
+	var exchanges []string
+	for _, trade := range data {
+		if _, ok := recs[trade.Exchange]; !ok {
+			exchanges = append(exchanges, trade.Exchange)
+		}
+		var rec interface{}
+		if f.Cfg.Format == "jsonl" {
+			rec = &esData{
+				Channel:    "trade",
+				Exchange:   trade.Exchange,
+				Market:     trade.MktCommitName,
+				Base:       trade.Base,
+				Quote:      trade.Quote,
+				TradeID:    trade.TradeID,
+				Side:       trade.Side,
+				Size:       trade.Size,
+				Price:      trade.Price,
+				PriceUSD:   trade.PriceUSD,
+				BadTick:    trade.IsBadTick,
+				BuyerMaker: trade.IsBuyerMaker,
+				Timestamp:  trade.Timestamp,
+				CreatedAt:  now,
+			}
+		} else {
+			rec = []string{
+				trade.Exchange,
+				trade.MktCommitName,
+				trade.Base,
+				trade.Quote,
+				trade.TradeID,
+				trade.Side,
+				fileFloat(trade.Size),
+				fileFloat(trade.Price),
+				strconv.FormatBool(trade.IsBuyerMaker),
+				fileFloat(trade.PriceUSD),
+				strconv.FormatBool(trade.IsBadTick),
+				trade.Timestamp.UTC().Format(time.RFC3339Nano),
+				now.Format(time.RFC3339Nano),
+			}
+		}
+		recs[trade.Exchange] = append(recs[trade.Exchange], rec)
+	}
+	for _, exchange := range exchanges {
+		if err := f.write(appCtx, exchange, "trade", fileTradeHeader, recs[exchange], now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write appends the records to the open file of the exchange channel and flushes them,
+// so that the file can be read or tailed while being written.
+// File is rotated before writing, if the rotation interval is over,
+// and after writing, if it reached the maximum file size.
+func (f *File) write(appCtx context.Context, exchange string, channel string, header []string, recs []interface{}, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if appCtx.Err() != nil {
+		return appCtx.Err()
+	}
+	key := exchange + "/" + channel
+	ff := f.files[key]
+	period := f.period(now)
+	if ff != nil && !ff.period.Equal(period) {
+		delete(f.files, key)
+		if err := ff.close(); err != nil {
+			return err
+		}
+		ff = nil
+	}
+	if ff == nil {
+		var err error
+		ff, err = f.create(exchange, channel, header, period, now)
+		if err != nil {
+			return err
+		}
+		f.files[key] = ff
+	}
+	for _, rec := range recs {
+		if ff.csv != nil {
+			if err := ff.csv.Write(rec.([]string)); err != nil {
+				return err
+			}
+			continue
+		}
+		line, err := jsoniter.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if _, err = ff.buf.Write(line); err != nil {
+			return err
+		}
+		if err = ff.buf.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	if err := ff.flush(); err != nil {
+		return err
+	}
+	if f.Cfg.MaxFileSizeMB > 0 && ff.w.n >= int64(f.Cfg.MaxFileSizeMB)*1024*1024 {
+		delete(f.files, key)
+		if err := ff.close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// period returns the start of the rotation interval of the time.
+func (f *File) period(now time.Time) time.Time {
+	interval := f.Cfg.RotateIntervalMin
+	if interval == 0 {
+		interval = fileRotateIntervalMin
+	}
+	return now.Truncate(time.Duration(interval) * time.Minute)
+}
+
+// create opens a new file of the exchange channel under the directory layout,
+// named with the exchange, channel and the time at which it is opened.
+// CSV files start with the header row.
+func (f *File) create(exchange string, channel string, header []string, period time.Time, now time.Time) (*flatFile, error) {
+	layout := f.Cfg.Layout
+	if layout == "" {
+		layout = fileLayout
+	}
+	layout = strings.NewReplacer(
+		"{exchange}", exchange,
+		"{channel}", channel,
+		"{date}", period.Format("2006-01-02"),
+		"{hour}", period.Format("15"),
+	).Replace(layout)
+	dir := filepath.Join(f.Cfg.Dir, filepath.FromSlash(layout))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	ext := ".csv"
+	if f.Cfg.Format == "jsonl" {
+		ext = ".jsonl"
+	}
+	if f.Cfg.Gzip {
+		ext += ".gz"
+	}
+	name := exchange + "_" + channel + "_" + now.Format("20060102T150405")
+	path := filepath.Join(dir, name+ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s_%d%s", name, i, ext))
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	ff := &flatFile{
+		file:   file,
+		w:      &fileCounter{f: file},
+		period: period,
+	}
+	var w io.Writer = ff.w
+	if f.Cfg.Gzip {
+		ff.gz = gzip.NewWriter(ff.w)
+		w = ff.gz
+	}
+	ff.buf = bufio.NewWriter(w)
+	if f.Cfg.Format != "jsonl" {
+		ff.csv = csv.NewWriter(ff.buf)
+		if err = ff.csv.Write(header); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return ff, nil
+}
+
+// flush writes out the buffered data, through the gzip writer if configured.
+func (ff *flatFile) flush() error {
+	if ff.csv != nil {
+		ff.csv.Flush()
+		if err := ff.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if err := ff.buf.Flush(); err != nil {
+		return err
+	}
+	if ff.gz != nil {
+		return ff.gz.Flush()
+	}
+	return nil
+}
+
+// close flushes the remaining data, ends the gzip stream if configured and closes the file.
+func (ff *flatFile) close() error {
+	if err := ff.flush(); err != nil {
+		ff.file.Close()
+		return err
+	}
+	if ff.gz != nil {
+		if err := ff.gz.Close(); err != nil {
+			ff.file.Close()
+			return err
+		}
+	}
+	return ff.file.Close()
+}
+
+// Close closes all the open files.
+// It is called at the app exit.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var closeErr error
+	for key, ff := range f.files {
+		delete(f.files, key)
+		if err := ff.close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
+
+// fileName matches the names of the files created by the app, <exchange>_<channel>_<time>[_<n>].<ext>,
+// with the channel as the submatch.
+var fileName = regexp.MustCompile(`^[^_]+_(.+)_\d{8}T\d{6}(_\d+)?\.`)
+
+// Prune deletes the files of the channel last written before the given time.
+// Files open for writing are skipped, and directories left empty are removed.
+func (f *File) Prune(ctx context.Context, channel string, before time.Time) error {
+	open := make(map[string]bool)
+	f.mu.Lock()
+	for _, ff := range f.files {
+		open[ff.file.Name()] = true
+	}
+	f.mu.Unlock()
+
+	dirs := make(map[string]bool)
+	err := filepath.WalkDir(f.Cfg.Dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if entry.IsDir() || open[path] {
+			return nil
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil || match[1] != channel {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Before(before) {
+			return nil
+		}
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+		dirs[filepath.Dir(path)] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Removing a directory fails if it is not empty, so the error is ignored.
+	// Parents emptied by it are removed too, up to the base directory.
+	for dir := range dirs {
+		for dir != filepath.Clean(f.Cfg.Dir) && os.Remove(dir) == nil {
+			dir = filepath.Dir(dir)
+		}
+	}
+	return nil
+}
+
+func fileFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
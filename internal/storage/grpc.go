@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// GRPC is for pushing data to a user provided service over a client side gRPC stream.
+// Messages are of the contract in examples/grpc/sink.proto, encoded here without generated code,
+// so that the service can be implemented in any language from the same file.
+type GRPC struct {
+	Cfg    *config.GRPC
+	conn   *grpc.ClientConn
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+	mu     sync.Mutex
+}
+
+var grpcStore GRPC
+
+// Default method, if not configured.
+const grpcMethod = "/cryptogalaxy.v1.Sink/Stream"
+
+// grpcCodec passes the already encoded protobuf messages as they are.
+// It is named proto, so that the service sees a standard protobuf content type.
+type grpcCodec struct{}
+
+func (grpcCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("grpc : unexpected message type %T", v)
+	}
+	return *b, nil
+}
+
+func (grpcCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("grpc : unexpected message type %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (grpcCodec) Name() string {
+	return "proto"
+}
+
+// InitGRPC initializes gRPC connection with configured values and opens the stream.
+func InitGRPC(cfg *config.GRPC) (*GRPC, error) {
+	if grpcStore.conn == nil {
+		opts := []grpc.DialOption{
+			grpc.WithBlock(),
+			grpc.WithDefaultCallOptions(grpc.ForceCodec(grpcCodec{})),
+		}
+		if cfg.TLS {
+			tlsCfg := &tls.Config{
+				ServerName:         cfg.ServerName,
+				InsecureSkipVerify: cfg.InsecureSkipVerify,
+			}
+			if cfg.CACertFile != "" {
+				pool, err := tlsconfig.CAPool(cfg.CACertFile)
+				if err != nil {
+					return nil, err
+				}
+				tlsCfg.RootCAs = pool
+			}
+			if err := tlsconfig.Apply(tlsCfg, cfg.MinTLSVersion, cfg.PinnedKeys); err != nil {
+				return nil, err
+			}
+			opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
+		} else {
+			opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		}
+
+		var ctx context.Context
+		if cfg.ReqTimeoutSec > 0 {
+			timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReqTimeoutSec)*time.Second)
+			ctx = timeoutCtx
+			defer cancel()
+		} else {
+			ctx = context.Background()
+		}
+		conn, err := grpc.DialContext(ctx, cfg.Address, opts...)
+		if err != nil {
+			return nil, err
+		}
+		grpcStore.Cfg = cfg
+		grpcStore.conn = conn
+		if err = grpcStore.open(); err != nil {
+			conn.Close()
+			grpcStore.conn = nil
+			return nil, err
+		}
+	}
+	return &grpcStore, nil
+}
+
+// GetGRPC returns already prepared gRPC instance.
+func GetGRPC() *GRPC {
+	return &grpcStore
+}
+
+// open starts a new client stream with the configured metadata.
+// Stream is not bound to the app context, so that it can be closed gracefully at the app exit.
+func (g *GRPC) open() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	if len(g.Cfg.Metadata) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(g.Cfg.Metadata))
+	}
+	method := g.Cfg.Method
+	if method == "" {
+		method = grpcMethod
+	}
+	stream, err := g.conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true}, method)
+	if err != nil {
+		cancel()
+		return err
+	}
+	g.stream = stream
+	g.cancel = cancel
+	return nil
+}
+
+// CommitTickers sends input ticker data to the stream.
+func (g *GRPC) CommitTickers(appCtx context.Context, data []Ticker) error {
+	msgs := make([][]byte, 0, len(data))
+	now := time.Now().UTC().UnixNano()
+	for _, ticker := range data {
+		var rec []byte
+		rec = protowire.AppendTag(rec, 1, protowire.BytesType)
+		rec = protowire.AppendBytes(rec, grpcTicker(&ticker, now))
+		msgs = append(msgs, rec)
+	}
+	return g.send(appCtx, msgs)
+}
+
+// CommitTrades sends input trade data to the stream.
+func (g *GRPC) CommitTrades(appCtx context.Context, data []Trade) error {
+	msgs := make([][]byte, 0, len(data))
+	now := time.Now().UTC().UnixNano()
+	for _, trade := range data {
+		var rec []byte
+		rec = protowire.AppendTag(rec, 2, protowire.BytesType)
+		rec = protowire.AppendBytes(rec, grpcTrade(&trade, now))
+		msgs = append(msgs, rec)
+	}
+	return g.send(appCtx, msgs)
+}
+
+// send writes the records to the stream.
+// If the stream is found broken, for example by a service restart, a new one is opened and the batch is sent once more.
+// Records already sent on the broken stream may or may not have been received by the service.
+func (g *GRPC) send(appCtx context.Context, msgs [][]byte) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if appCtx.Err() != nil {
+		return appCtx.Err()
+	}
+	if g.stream != nil {
+		err := g.sendMsgs(msgs)
+		if err == nil {
+			return nil
+		}
+		g.cancel()
+		g.stream = nil
+	}
+	if err := g.open(); err != nil {
+		return err
+	}
+	if err := g.sendMsgs(msgs); err != nil {
+		g.cancel()
+		g.stream = nil
+		return err
+	}
+	return nil
+}
+
+func (g *GRPC) sendMsgs(msgs [][]byte) error {
+	for i := range msgs {
+		if err := g.stream.SendMsg(&msgs[i]); err != nil {
+			// Actual status of the stream is returned only by receiving.
+			var ack []byte
+			if recvErr := g.stream.RecvMsg(&ack); recvErr != nil {
+				return recvErr
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Close ends the stream, waits for the acknowledgement of the service and closes the connection.
+func (g *GRPC) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var closeErr error
+	if g.stream != nil {
+		if err := g.stream.CloseSend(); err != nil {
+			closeErr = err
+		}
+		var ack []byte
+		if err := g.stream.RecvMsg(&ack); err != nil && closeErr == nil {
+			closeErr = err
+		}
+		g.cancel()
+		g.stream = nil
+	}
+	if err := g.conn.Close(); err != nil && !errors.Is(err, context.Canceled) && closeErr == nil {
+		closeErr = err
+	}
+	return closeErr
+}
+
+// grpcTicker encodes the ticker as the Ticker message of the contract.
+func grpcTicker(ticker *Ticker, now int64) []byte {
+	var msg []byte
+	msg = grpcAppendString(msg, 1, ticker.Exchange)
+	msg = grpcAppendString(msg, 2, ticker.MktCommitName)
+	msg = grpcAppendString(msg, 3, ticker.Base)
+	msg = grpcAppendString(msg, 4, ticker.Quote)
+	msg = grpcAppendDouble(msg, 5, ticker.Price)
+	msg = grpcAppendDouble(msg, 6, ticker.BestBid)
+	msg = grpcAppendDouble(msg, 7, ticker.BestAsk)
+	msg = grpcAppendDouble(msg, 8, ticker.Volume)
+	msg = grpcAppendDouble(msg, 9, ticker.High)
+	msg = grpcAppendDouble(msg, 10, ticker.Low)
+	msg = grpcAppendDouble(msg, 11, ticker.PriceUSD)
+	msg = grpcAppendBool(msg, 12, ticker.IsBadTick)
+	msg = grpcAppendInt64(msg, 13, ticker.Timestamp.UnixNano())
+	msg = grpcAppendInt64(msg, 14, now)
+	return msg
+}
+
+// grpcTrade encodes the trade as the Trade message of the contract.
+func grpcTrade(trade *Trade, now int64) []byte {
+	var msg []byte
+	msg = grpcAppendString(msg, 1, trade.Exchange)
+	msg = grpcAppendString(msg, 2, trade.MktCommitName)
+	msg = grpcAppendString(msg, 3, trade.Base)
+	msg = grpcAppendString(msg, 4, trade.Quote)
+	msg = grpcAppendString(msg, 5, trade.TradeID)
+	msg = grpcAppendString(msg, 6, trade.Side)
+	msg = grpcAppendDouble(msg, 7, trade.Size)
+	msg = grpcAppendDouble(msg, 8, trade.Price)
+	msg = grpcAppendBool(msg, 9, trade.IsBuyerMaker)
+	msg = grpcAppendDouble(msg, 10, trade.PriceUSD)
+	msg = grpcAppendBool(msg, 11, trade.IsBadTick)
+	msg = grpcAppendInt64(msg, 12, trade.Timestamp.UnixNano())
+	msg = grpcAppendInt64(msg, 13, now)
+	return msg
+}
+
+func grpcAppendString(b []byte, num protowire.Number, v string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func grpcAppendDouble(b []byte, num protowire.Number, v float64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func grpcAppendBool(b []byte, num protowire.Number, v bool) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(v))
+}
+
+func grpcAppendInt64(b []byte, num protowire.Number, v int64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
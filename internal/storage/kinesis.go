@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Kinesis is for connecting and putting data to kinesis data stream.
+type Kinesis struct {
+	Client *kinesis.Kinesis
+	Cfg    *config.Kinesis
+}
+
+var kinesisStore Kinesis
+
+// Limits of a PutRecords request and of an aggregated record.
+const (
+	kinesisMaxRecords     = 500
+	kinesisMaxBytes       = 5 * 1024 * 1024
+	kinesisMaxRecordBytes = 1024 * 1024
+	kinesisAggBytes       = 50 * 1024
+	kinesisMaxRetries     = 5
+	kinesisBackoffBase    = 100 * time.Millisecond
+	kinesisBackoffMax     = 5 * time.Second
+)
+
+// kinesisAggMagic starts each record aggregated in the KPL format, so that the consumers using KCL
+// or the deaggregation libraries could extract the user records.
+var kinesisAggMagic = []byte{0xF3, 0x89, 0x9A, 0xC2}
+
+// kinesisRecord is a user record of a partition key.
+type kinesisRecord struct {
+	key  string
+	data []byte
+}
+
+// InitKinesis initializes kinesis client with configured values and checks the stream.
+func InitKinesis(cfg *config.Kinesis) (*Kinesis, error) {
+	if kinesisStore.Client == nil {
+		awsCfg := aws.NewConfig().WithRegion(cfg.Region)
+		if cfg.Endpoint != "" {
+			awsCfg = awsCfg.WithEndpoint(cfg.Endpoint)
+		}
+		if cfg.AccessKeyID != "" {
+			awsCfg = awsCfg.WithCredentials(credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, ""))
+		}
+		sess, err := session.NewSession(awsCfg)
+		if err != nil {
+			return nil, err
+		}
+		client := kinesis.New(sess)
+
+		var ctx context.Context
+		if cfg.ReqTimeoutSec > 0 {
+			timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReqTimeoutSec)*time.Second)
+			ctx = timeoutCtx
+			defer cancel()
+		} else {
+			ctx = context.Background()
+		}
+		_, err = client.DescribeStreamSummaryWithContext(ctx, &kinesis.DescribeStreamSummaryInput{
+			StreamName: aws.String(cfg.StreamName),
+		})
+		if err != nil {
+			return nil, err
+		}
+		kinesisStore = Kinesis{
+			Client: client,
+			Cfg:    cfg,
+		}
+	}
+	return &kinesisStore, nil
+}
+
+// GetKinesis returns already prepared kinesis instance.
+func GetKinesis() *Kinesis {
+	return &kinesisStore
+}
+
+// CommitTickers batch puts input ticker data to kinesis.
+func (k *Kinesis) CommitTickers(appCtx context.Context, data []Ticker) error {
+	recs := make([]kinesisRecord, 0, len(data))
+	for _, ticker := range data {
+		kd := esData{
+			Channel:   "ticker",
+			Exchange:  ticker.Exchange,
+			Market:    ticker.MktCommitName,
+			Base:      ticker.Base,
+			Quote:     ticker.Quote,
+			Price:     ticker.Price,
+			PriceUSD:  ticker.PriceUSD,
+			BadTick:   ticker.IsBadTick,
+			BestBid:   ticker.BestBid,
+			BestAsk:   ticker.BestAsk,
+			Volume:    ticker.Volume,
+			High:      ticker.High,
+			Low:       ticker.Low,
+			Timestamp: ticker.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		value, err := jsoniter.Marshal(kd)
+		if err != nil {
+			return err
+		}
+		recs = append(recs, kinesisRecord{key: ticker.Exchange + "/" + ticker.MktCommitName, data: value})
+	}
+	return k.put(appCtx, recs)
+}
+
+// CommitTrades batch puts input trade data to kinesis.
+func (k *Kinesis) CommitTrades(appCtx context.Context, data []Trade) error {
+	recs := make([]kinesisRecord, 0, len(data))
+	for _, trade := range data {
+		kd := esData{
+			Channel:    "trade",
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			Base:       trade.Base,
+			Quote:      trade.Quote,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			PriceUSD:   trade.PriceUSD,
+			BadTick:    trade.IsBadTick,
+			BuyerMaker: trade.IsBuyerMaker,
+			Timestamp:  trade.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		value, err := jsoniter.Marshal(kd)
+		if err != nil {
+			return err
+		}
+		recs = append(recs, kinesisRecord{key: trade.Exchange + "/" + trade.MktCommitName, data: value})
+	}
+	return k.put(appCtx, recs)
+}
+
+// put sends the records, aggregated per partition key if configured, in as few PutRecords requests as possible.
+func (k *Kinesis) put(appCtx context.Context, recs []kinesisRecord) error {
+	if k.Cfg.Aggregate {
+		var err error
+		recs, err = kinesisAggregate(recs)
+		if err != nil {
+			return err
+		}
+	}
+	var entries []*kinesis.PutRecordsRequestEntry
+	var size int
+	for _, rec := range recs {
+		recSize := len(rec.data) + len(rec.key)
+		if len(entries) == kinesisMaxRecords || (len(entries) > 0 && size+recSize > kinesisMaxBytes) {
+			if err := k.putRecords(appCtx, entries); err != nil {
+				return err
+			}
+			entries = nil
+			size = 0
+		}
+		entries = append(entries, &kinesis.PutRecordsRequestEntry{
+			Data:         rec.data,
+			PartitionKey: aws.String(rec.key),
+		})
+		size += recSize
+	}
+	if len(entries) > 0 {
+		return k.putRecords(appCtx, entries)
+	}
+	return nil
+}
+
+// putRecords sends the entries and retries the failed ones with exponential backoff.
+// Records are failed partially mostly when the shard throughput is exceeded,
+// so only those are sent again, keeping the successful ones out.
+func (k *Kinesis) putRecords(appCtx context.Context, entries []*kinesis.PutRecordsRequestEntry) error {
+	maxRetries := k.Cfg.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = kinesisMaxRetries
+	}
+	backoff := kinesisBackoffBase
+	for i := 0; ; i++ {
+		out, err := k.putRecordsReq(appCtx, entries)
+		if err != nil {
+			return err
+		}
+		if aws.Int64Value(out.FailedRecordCount) == 0 {
+			return nil
+		}
+		var failed []*kinesis.PutRecordsRequestEntry
+		var errCode, errMsg string
+		for j, res := range out.Records {
+			if res.ErrorCode != nil {
+				failed = append(failed, entries[j])
+				errCode = aws.StringValue(res.ErrorCode)
+				errMsg = aws.StringValue(res.ErrorMessage)
+			}
+		}
+		if i == maxRetries {
+			return fmt.Errorf("kinesis put failed for %d records after %d retries : %s %s", len(failed), maxRetries, errCode, errMsg)
+		}
+		entries = failed
+		select {
+		case <-time.After(backoff):
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+		backoff *= 2
+		if backoff > kinesisBackoffMax {
+			backoff = kinesisBackoffMax
+		}
+	}
+}
+
+func (k *Kinesis) putRecordsReq(appCtx context.Context, entries []*kinesis.PutRecordsRequestEntry) (*kinesis.PutRecordsOutput, error) {
+	var ctx context.Context
+	if k.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(k.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = appCtx
+	}
+	return k.Client.PutRecordsWithContext(ctx, &kinesis.PutRecordsInput{
+		StreamName: aws.String(k.Cfg.StreamName),
+		Records:    entries,
+	})
+}
+
+// kinesisAggregate packs the user records of each partition key into KPL aggregated records,
+// each of them up to the aggregation size, which reduces the number of records billed and put to the shards.
+// Size of the aggregated record is counted as encoded before adding each user record, so a new one is started
+// before the size is crossed. Only a user record which does not fit in a record by itself fails the batch.
+func kinesisAggregate(recs []kinesisRecord) ([]kinesisRecord, error) {
+	var keys []string
+	grouped := make(map[string][][]byte)
+	for _, rec := range recs {
+		if _, ok := grouped[rec.key]; !ok {
+			keys = append(keys, rec.key)
+		}
+		grouped[rec.key] = append(grouped[rec.key], rec.data)
+	}
+	agg := make([]kinesisRecord, 0, len(keys))
+	for _, key := range keys {
+		var datas [][]byte
+		base := len(kinesisAggMagic) + protowire.SizeTag(1) + protowire.SizeBytes(len(key)) + md5.Size
+		size := base
+		for _, data := range grouped[key] {
+			entrySize := kinesisAggEntrySize(data)
+			if base+entrySize+len(key) > kinesisMaxRecordBytes {
+				return nil, errors.New("kinesis aggregated record is larger than 1MB")
+			}
+			if len(datas) > 0 && size+entrySize > kinesisAggBytes {
+				agg = append(agg, kinesisRecord{key: key, data: kinesisAggRecord(key, datas)})
+				datas = nil
+				size = base
+			}
+			datas = append(datas, data)
+			size += entrySize
+		}
+		agg = append(agg, kinesisRecord{key: key, data: kinesisAggRecord(key, datas)})
+	}
+	return agg, nil
+}
+
+// kinesisAggEntrySize returns the size of the user record encoded in the aggregated record.
+func kinesisAggEntrySize(data []byte) int {
+	rec := protowire.SizeTag(1) + protowire.SizeVarint(0) + protowire.SizeTag(3) + protowire.SizeBytes(len(data))
+	return protowire.SizeTag(3) + protowire.SizeBytes(rec)
+}
+
+// kinesisAggRecord encodes the user records as AggregatedRecord protobuf message
+// with the only partition key in the table, followed by its md5 checksum.
+func kinesisAggRecord(key string, datas [][]byte) []byte {
+	var msg []byte
+	msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+	msg = protowire.AppendString(msg, key)
+	for _, data := range datas {
+		var rec []byte
+		rec = protowire.AppendTag(rec, 1, protowire.VarintType)
+		rec = protowire.AppendVarint(rec, 0)
+		rec = protowire.AppendTag(rec, 3, protowire.BytesType)
+		rec = protowire.AppendBytes(rec, data)
+		msg = protowire.AppendTag(msg, 3, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, rec)
+	}
+	sum := md5.Sum(msg)
+	out := make([]byte, 0, len(kinesisAggMagic)+len(msg)+len(sum))
+	out = append(out, kinesisAggMagic...)
+	out = append(out, msg...)
+	return append(out, sum[:]...)
+}
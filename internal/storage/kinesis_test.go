@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestKinesisAggregate tests that the user records of a partition key are split into aggregated records
+// within the aggregation size, and that a user record not fitting in a record by itself fails the batch.
+func TestKinesisAggregate(t *testing.T) {
+	tests := []struct {
+		name    string
+		sizes   []int
+		want    int
+		wantErr bool
+	}{
+		{"single record", []int{100}, 1, false},
+		{"within aggregation size", []int{1000, 1000, 1000}, 1, false},
+		{"split at aggregation size", []int{20 * 1024, 20 * 1024, 20 * 1024}, 2, false},
+		{"exact aggregation size", []int{kinesisAggBytes / 2, kinesisAggBytes / 2}, 2, false},
+		{"record over aggregation size alone", []int{100, kinesisAggBytes, 100}, 3, false},
+		{"record over max record size", []int{100, kinesisMaxRecordBytes}, 0, true},
+	}
+	for _, tt := range tests {
+		var recs []kinesisRecord
+		for _, size := range tt.sizes {
+			recs = append(recs, kinesisRecord{key: "binance/BTC-USDT", data: bytes.Repeat([]byte("a"), size)})
+		}
+		agg, err := kinesisAggregate(recs)
+		if (err != nil) != tt.wantErr {
+			t.Log("ERROR : "+tt.name+" : aggregate returned", err, ", expected error", tt.wantErr)
+			t.Error("FAILURE : kinesis aggregation")
+			continue
+		}
+		if len(agg) != tt.want {
+			t.Log("ERROR : "+tt.name+" :", len(agg), "aggregated records, expected", tt.want)
+			t.Error("FAILURE : kinesis aggregation")
+		}
+		for _, rec := range agg {
+			if len(rec.data)+len(rec.key) > kinesisMaxRecordBytes {
+				t.Log("ERROR : "+tt.name+" : aggregated record of", len(rec.data), "bytes")
+				t.Error("FAILURE : kinesis aggregation")
+			}
+		}
+	}
+}
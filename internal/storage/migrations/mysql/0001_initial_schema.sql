@@ -0,0 +1,206 @@
+-- Initial schema of scripts/mysql_schema.sql.
+-- Tables are created only if not exist, so that the databases created by the script are migrated as well.
+
+CREATE TABLE IF NOT EXISTS `ticker` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `exchange` varchar(32) NOT NULL,
+  `market` varchar(32) NOT NULL,
+  `base` varchar(16) NOT NULL DEFAULT '',
+  `quote` varchar(16) NOT NULL DEFAULT '',
+  `price` decimal(64,8) NOT NULL,
+  `best_bid` decimal(64,8) NOT NULL DEFAULT 0,
+  `best_ask` decimal(64,8) NOT NULL DEFAULT 0,
+  `volume` decimal(64,8) NOT NULL DEFAULT 0,
+  `high` decimal(64,8) NOT NULL DEFAULT 0,
+  `low` decimal(64,8) NOT NULL DEFAULT 0,
+  `price_usd` decimal(64,8) NOT NULL DEFAULT 0,
+  `is_bad_tick` tinyint(1) NOT NULL DEFAULT 0,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `trade` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `exchange` varchar(32) NOT NULL,
+  `market` varchar(32) NOT NULL,
+  `base` varchar(16) NOT NULL DEFAULT '',
+  `quote` varchar(16) NOT NULL DEFAULT '',
+  `trade_id` varchar(64) NULL,
+  `side` varchar(8) NOT NULL,
+  `size` decimal(64,8) NOT NULL,
+  `price` decimal(64,8) NOT NULL,
+  `is_buyer_maker` tinyint(1) NOT NULL DEFAULT 0,
+  `price_usd` decimal(64,8) NOT NULL DEFAULT 0,
+  `is_bad_tick` tinyint(1) NOT NULL DEFAULT 0,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `mark_price` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `exchange` varchar(32) NOT NULL,
+  `market` varchar(32) NOT NULL,
+  `mark_price` decimal(64,8) NOT NULL,
+  `index_price` decimal(64,8) NOT NULL,
+  `basis` decimal(64,8) NOT NULL,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `bbo` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `exchange` varchar(32) NOT NULL,
+  `market` varchar(32) NOT NULL,
+  `bid_price` decimal(64,8) NOT NULL,
+  `bid_size` decimal(64,8) NOT NULL,
+  `ask_price` decimal(64,8) NOT NULL,
+  `ask_size` decimal(64,8) NOT NULL,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `block_trade` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `exchange` varchar(32) NOT NULL,
+  `market` varchar(32) NOT NULL,
+  `trade_id` varchar(64) NULL,
+  `side` varchar(8) NOT NULL,
+  `size` decimal(64,8) NOT NULL,
+  `price` decimal(64,8) NOT NULL,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `trading_status` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `exchange` varchar(32) NOT NULL,
+  `market` varchar(32) NOT NULL,
+  `status` varchar(32) NOT NULL,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `agg_trade` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `exchange` varchar(32) NOT NULL,
+  `market` varchar(32) NOT NULL,
+  `trade_id` varchar(64) NULL,
+  `side` varchar(8) NOT NULL,
+  `size` decimal(64,8) NOT NULL,
+  `price` decimal(64,8) NOT NULL,
+  `is_buyer_maker` tinyint(1) NOT NULL DEFAULT 0,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `instrument` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `exchange` varchar(32) NOT NULL,
+  `market` varchar(32) NOT NULL,
+  `tick_size` double NOT NULL,
+  `lot_size` double NOT NULL,
+  `price_precision` int NOT NULL,
+  `size_precision` int NOT NULL,
+  `status` varchar(32) NOT NULL,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `candle` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `exchange` varchar(32) NOT NULL,
+  `market` varchar(32) NOT NULL,
+  `interval` varchar(8) NOT NULL,
+  `open` double NOT NULL,
+  `high` double NOT NULL,
+  `low` double NOT NULL,
+  `close` double NOT NULL,
+  `volume` double NOT NULL,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `avg_price` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `exchange` varchar(32) NOT NULL,
+  `market` varchar(32) NOT NULL,
+  `window_size` varchar(8) NOT NULL,
+  `vwap` double NOT NULL,
+  `twap` double NOT NULL,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `book_metric` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `exchange` varchar(32) NOT NULL,
+  `market` varchar(32) NOT NULL,
+  `levels` int NOT NULL,
+  `spread` decimal(64,8) NOT NULL,
+  `mid_price` decimal(64,8) NOT NULL,
+  `bid_depth` decimal(64,8) NOT NULL,
+  `ask_depth` decimal(64,8) NOT NULL,
+  `imbalance` decimal(64,8) NOT NULL,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `market_stats` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `exchange` varchar(32) NOT NULL,
+  `market` varchar(32) NOT NULL,
+  `interval` varchar(8) NOT NULL,
+  `trade_count` bigint unsigned NOT NULL,
+  `buy_volume` decimal(64,8) NOT NULL,
+  `sell_volume` decimal(64,8) NOT NULL,
+  `notional` decimal(64,8) NOT NULL,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `fx_rate` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `currency` varchar(8) NOT NULL,
+  `rate` decimal(64,12) NOT NULL,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `coin_info` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `base` varchar(16) NOT NULL,
+  `coin_id` varchar(64) NOT NULL,
+  `market_cap` decimal(64,2) NOT NULL,
+  `market_cap_rank` int NOT NULL,
+  `circulating_supply` decimal(64,8) NOT NULL,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `arbitrage_spread` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `base` varchar(16) NOT NULL,
+  `quote` varchar(16) NOT NULL,
+  `buy_exchange` varchar(32) NOT NULL,
+  `buy_price` decimal(64,8) NOT NULL,
+  `sell_exchange` varchar(32) NOT NULL,
+  `sell_price` decimal(64,8) NOT NULL,
+  `spread_percent` decimal(64,8) NOT NULL,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,8 @@
+-- Unique key on trades, so that the trades received again, e.g. after a reconnect or by overlapping REST polls,
+-- are not inserted twice. Timestamp is part of it, as mysql needs the partition key in all the unique keys.
+-- Trades without id are stored as NULL, which never conflicts, instead of an empty string.
+-- Duplicate trades already in the table should be removed before this migration, otherwise it fails.
+
+UPDATE `trade` SET `trade_id` = NULL WHERE `trade_id` = '';
+
+ALTER TABLE `trade` ADD UNIQUE KEY `uk_trade` (`exchange`, `market`, `trade_id`, `timestamp`);
@@ -0,0 +1,24 @@
+-- Minute candles compacted from the raw tickers and trades by the compaction job, source being the raw channel.
+-- Timestamp keys on the raw tables keep the compaction and retention from scanning the whole table.
+
+CREATE TABLE IF NOT EXISTS `compacted_candle` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `exchange` varchar(32) NOT NULL,
+  `market` varchar(32) NOT NULL,
+  `source` varchar(8) NOT NULL,
+  `open` decimal(64,8) NOT NULL,
+  `high` decimal(64,8) NOT NULL,
+  `low` decimal(64,8) NOT NULL,
+  `close` decimal(64,8) NOT NULL,
+  `volume` decimal(64,8) NOT NULL DEFAULT 0,
+  `tick_count` int unsigned NOT NULL,
+  `timestamp` timestamp(3) NOT NULL,
+  `created_at` timestamp(3) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_compacted_candle` (`exchange`, `market`, `source`, `timestamp`),
+  KEY `idx_compacted_candle_source` (`source`, `timestamp`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+ALTER TABLE `ticker` ADD KEY `idx_ticker_timestamp` (`timestamp`);
+
+ALTER TABLE `trade` ADD KEY `idx_trade_timestamp` (`timestamp`);
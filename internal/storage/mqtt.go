@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// MQTT is for connecting and publishing data to mqtt broker.
+type MQTT struct {
+	Client mqtt.Client
+	Cfg    *config.MQTT
+}
+
+var mqttStore MQTT
+
+// Default topic, if not configured.
+const mqttTopic = "cryptogalaxy/{exchange}/{market}/{channel}"
+
+// InitMQTT initializes mqtt broker connection with configured values.
+// Client reconnects by itself if the connection is lost.
+func InitMQTT(cfg *config.MQTT) (*MQTT, error) {
+	if mqttStore.Client == nil {
+		opts := mqtt.NewClientOptions().
+			AddBroker(cfg.URL).
+			SetClientID(cfg.ClientID).
+			SetUsername(cfg.Username).
+			SetPassword(cfg.Password).
+			SetAutoReconnect(true).
+			SetConnectTimeout(time.Duration(cfg.ReqTimeoutSec) * time.Second)
+		client := mqtt.NewClient(opts)
+		token := client.Connect()
+		if err := mqttWait(token, cfg.ReqTimeoutSec); err != nil {
+			return nil, err
+		}
+		mqttStore = MQTT{
+			Client: client,
+			Cfg:    cfg,
+		}
+	}
+	return &mqttStore, nil
+}
+
+// GetMQTT returns already prepared mqtt instance.
+func GetMQTT() *MQTT {
+	return &mqttStore
+}
+
+// CommitTickers publishes input ticker data to mqtt topics.
+func (m *MQTT) CommitTickers(appCtx context.Context, data []Ticker) error {
+	tokens := make([]mqtt.Token, 0, len(data))
+	for _, ticker := range data {
+		md := esData{
+			Channel:   "ticker",
+			Exchange:  ticker.Exchange,
+			Market:    ticker.MktCommitName,
+			Base:      ticker.Base,
+			Quote:     ticker.Quote,
+			Price:     ticker.Price,
+			PriceUSD:  ticker.PriceUSD,
+			BadTick:   ticker.IsBadTick,
+			BestBid:   ticker.BestBid,
+			BestAsk:   ticker.BestAsk,
+			Volume:    ticker.Volume,
+			High:      ticker.High,
+			Low:       ticker.Low,
+			Timestamp: ticker.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		payload, err := jsoniter.Marshal(md)
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, m.Client.Publish(m.topic("ticker", ticker.Exchange, ticker.MktCommitName), m.Cfg.QoS, m.Cfg.Retain, payload))
+	}
+	return m.wait(appCtx, tokens)
+}
+
+// CommitTrades publishes input trade data to mqtt topics.
+func (m *MQTT) CommitTrades(appCtx context.Context, data []Trade) error {
+	tokens := make([]mqtt.Token, 0, len(data))
+	for _, trade := range data {
+		md := esData{
+			Channel:    "trade",
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			Base:       trade.Base,
+			Quote:      trade.Quote,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			PriceUSD:   trade.PriceUSD,
+			BadTick:    trade.IsBadTick,
+			BuyerMaker: trade.IsBuyerMaker,
+			Timestamp:  trade.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		payload, err := jsoniter.Marshal(md)
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, m.Client.Publish(m.topic("trade", trade.Exchange, trade.MktCommitName), m.Cfg.QoS, m.Cfg.Retain, payload))
+	}
+	return m.wait(appCtx, tokens)
+}
+
+// topic returns the topic with the placeholders replaced.
+func (m *MQTT) topic(channel string, exchange string, market string) string {
+	topic := m.Cfg.Topic
+	if topic == "" {
+		topic = mqttTopic
+	}
+	return strings.NewReplacer("{exchange}", exchange, "{market}", market, "{channel}", channel).Replace(topic)
+}
+
+// wait waits for all the publishes of the batch to complete,
+// which for QoS 1 and 2 is the acknowledgement by the broker.
+func (m *MQTT) wait(appCtx context.Context, tokens []mqtt.Token) error {
+	for _, token := range tokens {
+		if appCtx.Err() != nil {
+			return appCtx.Err()
+		}
+		if err := mqttWait(token, m.Cfg.ReqTimeoutSec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mqttWait(token mqtt.Token, timeoutSec int) error {
+	if timeoutSec > 0 {
+		if !token.WaitTimeout(time.Duration(timeoutSec) * time.Second) {
+			return errors.New("mqtt request timed out")
+		}
+	} else {
+		token.Wait()
+	}
+	return token.Error()
+}
@@ -2,35 +2,91 @@ package storage
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"fmt"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/milkywaybrain/cryptogalaxy/internal/tlsconfig"
 )
 
 // MySQL is for connecting and inserting data to mysql.
 type MySQL struct {
-	DB  *sql.DB
-	Cfg *config.MySQL
+	DB       *sql.DB
+	Cfg      *config.MySQL
+	tsFormat string
+	stmts    map[string]*sql.Stmt
+	stmtsMu  sync.Mutex
 }
 
 var mysql MySQL
 
 // Go time gives Z00:00, mysql timestamp needs +00:00 for UTC.
-const mysqlTimestamp = "2006-01-02T15:04:05.999+00:00"
+// Fraction part is set as per the configured timestamp precision.
+const (
+	mysqlTimestampMs = "2006-01-02T15:04:05.999+00:00"
+	mysqlTimestampUs = "2006-01-02T15:04:05.999999+00:00"
+)
+
+// A prepared statement can have at most 65535 placeholders in mysql, bigger batches are inserted in chunks.
+// Statements are prepared once for each number of rows and reused, the cache is limited
+// as partially filled batches, e.g. by the flush interval, can be of any size.
+const (
+	mysqlMaxPlaceholders = 65535
+	mysqlStmtCacheSize   = 32
+)
+
+// Columns of the high volume tables inserted through the prepared statements.
+var (
+	mysqlTickerCols = []string{"exchange", "market", "base", "quote", "price", "best_bid", "best_ask", "volume", "high", "low", "price_usd", "is_bad_tick", "timestamp", "created_at"}
+	mysqlTradeCols  = []string{"exchange", "market", "base", "quote", "trade_id", "side", "size", "price", "is_buyer_maker", "price_usd", "is_bad_tick", "timestamp", "created_at"}
+)
 
 // InitMySQL initializes mysql connection with configured values.
 func InitMySQL(cfg *config.MySQL) (*MySQL, error) {
 	if mysql.DB == nil {
 		dataSourceName := cfg.User + ":" + cfg.Password + cfg.URL + "/" + cfg.Schema
+
+		// Session time zone decides how the UTC timestamps are converted for DATETIME columns
+		// and also how the TIMESTAMP columns are displayed.
+		var params []string
+		if cfg.Timezone != "" {
+			params = append(params, "time_zone="+url.QueryEscape("'"+cfg.Timezone+"'"))
+		}
+		if cfg.TLS {
+			tlsCfg, err := mysqlTLSConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			if err = mysqldriver.RegisterTLSConfig(mysqlTLSConfigName, tlsCfg); err != nil {
+				return nil, err
+			}
+			params = append(params, "tls="+mysqlTLSConfigName)
+		}
+		var query string
+		if len(params) > 0 {
+			query = "?" + strings.Join(params, "&")
+		}
+		if cfg.CreateSchema {
+			if err := mysqlCreateSchema(cfg, cfg.User+":"+cfg.Password+cfg.URL+"/"+query); err != nil {
+				return nil, err
+			}
+		}
 		db, err := sql.Open("mysql",
-			dataSourceName)
+			dataSourceName+query)
 		if err != nil {
 			return nil, err
 		}
 		db.SetConnMaxLifetime(time.Second * time.Duration(cfg.ConnMaxLifetimeSec))
+		db.SetConnMaxIdleTime(time.Second * time.Duration(cfg.ConnMaxIdleTimeSec))
 		db.SetMaxOpenConns(cfg.MaxOpenConns)
 		db.SetMaxIdleConns(cfg.MaxIdleConns)
 
@@ -47,27 +103,260 @@ func InitMySQL(cfg *config.MySQL) (*MySQL, error) {
 			return nil, err
 		}
 		mysql = MySQL{
-			DB:  db,
-			Cfg: cfg,
+			DB:       db,
+			Cfg:      cfg,
+			tsFormat: mysqlTimestampMs,
+			stmts:    make(map[string]*sql.Stmt),
+		}
+		if cfg.TimestampPrecision == "us" {
+			mysql.tsFormat = mysqlTimestampUs
 		}
 	}
 	return &mysql, nil
 }
 
+// mysqlCreateSchema creates the schema, if it does not exist, through a connection without any default schema,
+// as the connection to a schema which does not exist fails.
+func mysqlCreateSchema(cfg *config.MySQL, dataSourceName string) error {
+	db, err := sql.Open("mysql", dataSourceName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var ctx context.Context
+	if cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err = db.ExecContext(ctx, "CREATE DATABASE IF NOT EXISTS `"+cfg.Schema+"` CHARACTER SET utf8mb4")
+	return err
+}
+
+// mysqlTLSConfigName is the name by which the TLS config is registered to the driver.
+const mysqlTLSConfigName = "cryptogalaxy"
+
+// mysqlTLSConfig returns the TLS config of the connection, with the CA certificate to verify the server,
+// e.g. of a managed MySQL, the client certificate, the minimum TLS version and the pinned keys, if configured.
+func mysqlTLSConfig(cfg *config.MySQL) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CACertFile != "" {
+		pem, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in mysql ca_cert_file %s", cfg.CACertFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	if err := tlsconfig.Apply(tlsCfg, cfg.MinTLSVersion, cfg.PinnedKeys); err != nil {
+		return nil, err
+	}
+	return tlsCfg, nil
+}
+
 // GetMySQL returns already prepared mysql instance.
 func GetMySQL() *MySQL {
 	return &mysql
 }
 
+// timestamp formats the time to mysql UTC timestamp with configured precision.
+func (m *MySQL) timestamp(t time.Time) string {
+	return t.UTC().Format(m.tsFormat)
+}
+
 // CommitTickers batch inserts input ticker data to database.
 func (m *MySQL) CommitTickers(appCtx context.Context, data []Ticker) error {
+	args := make([]interface{}, 0, len(data)*len(mysqlTickerCols))
+	now := m.timestamp(time.Now())
+	for _, ticker := range data {
+		args = append(args, ticker.Exchange, ticker.MktCommitName, ticker.Base, ticker.Quote, ticker.Price, ticker.BestBid, ticker.BestAsk, ticker.Volume, ticker.High, ticker.Low, ticker.PriceUSD, ticker.IsBadTick, m.timestamp(ticker.Timestamp), now)
+	}
+	return m.insert(appCtx, "ticker", mysqlTickerCols, args)
+}
+
+// CommitTrades batch inserts input trade data to database.
+// Trades already inserted, as per the unique key of the exchange, market, trade id and timestamp, are skipped.
+func (m *MySQL) CommitTrades(appCtx context.Context, data []Trade) error {
+	args := make([]interface{}, 0, len(data)*len(mysqlTradeCols))
+	now := m.timestamp(time.Now())
+	for _, trade := range data {
+
+		// Trades without id are inserted as NULL, so that they never conflict in the unique key.
+		var tradeID interface{}
+		if trade.TradeID != "" {
+			tradeID = trade.TradeID
+		}
+		args = append(args, trade.Exchange, trade.MktCommitName, trade.Base, trade.Quote, tradeID, trade.Side, trade.Size, trade.Price, trade.IsBuyerMaker, trade.PriceUSD, trade.IsBadTick, m.timestamp(trade.Timestamp), now)
+	}
+	return m.insert(appCtx, "trade", mysqlTradeCols, args)
+}
+
+// insert executes multi row insert statements of the values, in chunks within the placeholder limit.
+// A single statement is already atomic, multiple chunks are inserted in a transaction,
+// so that a failure in between does not leave a part of the batch inserted.
+func (m *MySQL) insert(appCtx context.Context, table string, cols []string, args []interface{}) (err error) {
+	var ctx context.Context
+	if m.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(m.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	rows := len(args) / len(cols)
+	maxRows := mysqlMaxPlaceholders / len(cols)
+	var tx *sql.Tx
+	if rows > maxRows {
+		tx, err = m.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				_ = tx.Rollback()
+				return
+			}
+			err = tx.Commit()
+		}()
+	}
+	for start := 0; start < rows; start += maxRows {
+		end := start + maxRows
+		if end > rows {
+			end = rows
+		}
+		chunk := args[start*len(cols) : end*len(cols)]
+		stmt, err := m.stmt(ctx, table, cols, end-start)
+		if err != nil {
+			return err
+		}
+		switch {
+		case stmt != nil && tx != nil:
+			_, err = tx.StmtContext(ctx, stmt).ExecContext(ctx, chunk...)
+		case stmt != nil:
+			_, err = stmt.ExecContext(ctx, chunk...)
+		case tx != nil:
+			_, err = tx.ExecContext(ctx, m.insertQuery(table, cols, end-start), chunk...)
+		default:
+			_, err = m.DB.ExecContext(ctx, m.insertQuery(table, cols, end-start), chunk...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stmt returns the prepared insert statement of the table for the number of rows.
+// It returns nil if the cache is full, then the statement is prepared only for the single execution.
+func (m *MySQL) stmt(ctx context.Context, table string, cols []string, rows int) (*sql.Stmt, error) {
+	key := table + ":" + strconv.Itoa(rows)
+	m.stmtsMu.Lock()
+	defer m.stmtsMu.Unlock()
+	if stmt, ok := m.stmts[key]; ok {
+		return stmt, nil
+	}
+	if len(m.stmts) >= mysqlStmtCacheSize {
+		return nil, nil
+	}
+	stmt, err := m.DB.PrepareContext(ctx, m.insertQuery(table, cols, rows))
+	if err != nil {
+		return nil, err
+	}
+	m.stmts[key] = stmt
+	return stmt, nil
+}
+
+// mysqlPruneBatch is the number of rows deleted by a statement for the retention,
+// so that a big delete does not hold the locks and grow the undo log for long.
+const mysqlPruneBatch = 10000
+
+// Prune deletes the rows of the channel table older than the given time, in batches.
+func (m *MySQL) Prune(ctx context.Context, channel string, before time.Time) error {
+	query := "DELETE FROM `" + m.tableName(channel) + "` WHERE `" + m.fieldName("timestamp") + "` < ? LIMIT " + strconv.Itoa(mysqlPruneBatch)
+	for {
+		res, err := m.DB.ExecContext(ctx, query, m.timestamp(before))
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n < mysqlPruneBatch {
+			return nil
+		}
+	}
+}
+
+// insertQuery returns the multi row insert query with placeholders for the number of rows.
+// Rows conflicting with a unique key are skipped, without ignoring any other error as INSERT IGNORE does.
+// No-op update is of the first column, as the custom schema may not have the id column.
+func (m *MySQL) insertQuery(table string, cols []string, rows int) string {
+	row := "(" + strings.Repeat("?, ", len(cols)-1) + "?)"
+	var sb strings.Builder
+	sb.Grow(len(table) + len(cols)*16 + rows*(len(row)+1))
+	sb.WriteString(m.insertInto(table, cols...))
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(row)
+	}
+	first := "`" + m.fieldName(cols[0]) + "`"
+	sb.WriteString(" ON DUPLICATE KEY UPDATE " + first + " = " + first)
+	return sb.String()
+}
+
+// insertInto returns the start of the insert query till VALUES, with the configured table and column names.
+func (m *MySQL) insertInto(table string, cols ...string) string {
+	fields := make([]string, len(cols))
+	for i, col := range cols {
+		fields[i] = "`" + m.fieldName(col) + "`"
+	}
+	return "INSERT INTO `" + m.tableName(table) + "`(" + strings.Join(fields, ", ") + ") VALUES "
+}
+
+// tableName returns the configured name of the table, if it is overridden.
+func (m *MySQL) tableName(name string) string {
+	if custom, ok := m.Cfg.Names.Tables[name]; ok {
+		return custom
+	}
+	return name
+}
+
+// fieldName returns the configured name of the column, if it is overridden.
+func (m *MySQL) fieldName(name string) string {
+	if custom, ok := m.Cfg.Names.Fields[name]; ok {
+		return custom
+	}
+	return name
+}
+
+// CommitMarkPrices batch inserts input mark price data to database.
+func (m *MySQL) CommitMarkPrices(appCtx context.Context, data []MarkPrice) error {
 	var sb strings.Builder
-	sb.WriteString("INSERT INTO ticker(exchange, market, price, timestamp, created_at) VALUES ")
-	for i, ticker := range data {
+	sb.WriteString(m.insertInto("mark_price", "exchange", "market", "mark_price", "index_price", "basis", "timestamp", "created_at"))
+	for i, markPrice := range data {
 		if i == 0 {
-			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", %v, \"%v\", \"%v\")", ticker.Exchange, ticker.MktCommitName, ticker.Price, ticker.Timestamp.Format(mysqlTimestamp), time.Now().UTC().Format(mysqlTimestamp)))
+			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", %v, %v, %v, \"%v\", \"%v\")", markPrice.Exchange, markPrice.MktCommitName, markPrice.MarkPrice, markPrice.IndexPrice, markPrice.Basis, m.timestamp(markPrice.Timestamp), m.timestamp(time.Now())))
 		} else {
-			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", %v, \"%v\", \"%v\")", ticker.Exchange, ticker.MktCommitName, ticker.Price, ticker.Timestamp.Format(mysqlTimestamp), time.Now().UTC().Format(mysqlTimestamp)))
+			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", %v, %v, %v, \"%v\", \"%v\")", markPrice.Exchange, markPrice.MktCommitName, markPrice.MarkPrice, markPrice.IndexPrice, markPrice.Basis, m.timestamp(markPrice.Timestamp), m.timestamp(time.Now())))
 		}
 	}
 	var ctx context.Context
@@ -85,15 +374,301 @@ func (m *MySQL) CommitTickers(appCtx context.Context, data []Ticker) error {
 	return nil
 }
 
-// CommitTrades batch inserts input trade data to database.
-func (m *MySQL) CommitTrades(appCtx context.Context, data []Trade) error {
+// CommitBBOs batch inserts input best bid and offer data to database.
+func (m *MySQL) CommitBBOs(appCtx context.Context, data []BBO) error {
+	var sb strings.Builder
+	sb.WriteString(m.insertInto("bbo", "exchange", "market", "bid_price", "bid_size", "ask_price", "ask_size", "timestamp", "created_at"))
+	for i, bbo := range data {
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", %v, %v, %v, %v, \"%v\", \"%v\")", bbo.Exchange, bbo.MktCommitName, bbo.BidPrice, bbo.BidSize, bbo.AskPrice, bbo.AskSize, m.timestamp(bbo.Timestamp), m.timestamp(time.Now())))
+		} else {
+			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", %v, %v, %v, %v, \"%v\", \"%v\")", bbo.Exchange, bbo.MktCommitName, bbo.BidPrice, bbo.BidSize, bbo.AskPrice, bbo.AskSize, m.timestamp(bbo.Timestamp), m.timestamp(time.Now())))
+		}
+	}
+	var ctx context.Context
+	if m.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(m.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err := m.DB.ExecContext(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitBlockTrades batch inserts input block trade data to database.
+func (m *MySQL) CommitBlockTrades(appCtx context.Context, data []Trade) error {
+	var sb strings.Builder
+	sb.WriteString(m.insertInto("block_trade", "exchange", "market", "trade_id", "side", "size", "price", "timestamp", "created_at"))
+	for i, trade := range data {
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", \"%v\", \"%v\", %v, %v, \"%v\", \"%v\")", trade.Exchange, trade.MktCommitName, trade.TradeID, trade.Side, trade.Size, trade.Price, m.timestamp(trade.Timestamp), m.timestamp(time.Now())))
+		} else {
+			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", \"%v\", \"%v\", %v, %v, \"%v\", \"%v\")", trade.Exchange, trade.MktCommitName, trade.TradeID, trade.Side, trade.Size, trade.Price, m.timestamp(trade.Timestamp), m.timestamp(time.Now())))
+		}
+	}
+	var ctx context.Context
+	if m.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(m.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err := m.DB.ExecContext(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitTradingStatuses batch inserts input trading status data to database.
+func (m *MySQL) CommitTradingStatuses(appCtx context.Context, data []TradingStatus) error {
+	var sb strings.Builder
+	sb.WriteString(m.insertInto("trading_status", "exchange", "market", "status", "timestamp", "created_at"))
+	for i, tradingStatus := range data {
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", \"%v\", \"%v\", \"%v\")", tradingStatus.Exchange, tradingStatus.MktCommitName, tradingStatus.Status, m.timestamp(tradingStatus.Timestamp), m.timestamp(time.Now())))
+		} else {
+			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", \"%v\", \"%v\", \"%v\")", tradingStatus.Exchange, tradingStatus.MktCommitName, tradingStatus.Status, m.timestamp(tradingStatus.Timestamp), m.timestamp(time.Now())))
+		}
+	}
+	var ctx context.Context
+	if m.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(m.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err := m.DB.ExecContext(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitAggTrades batch inserts input aggregated trade data to database.
+func (m *MySQL) CommitAggTrades(appCtx context.Context, data []Trade) error {
 	var sb strings.Builder
-	sb.WriteString("INSERT INTO trade(exchange, market, trade_id, side, size, price, timestamp, created_at) VALUES ")
+	sb.WriteString(m.insertInto("agg_trade", "exchange", "market", "trade_id", "side", "size", "price", "is_buyer_maker", "timestamp", "created_at"))
 	for i, trade := range data {
 		if i == 0 {
-			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", \"%v\", \"%v\", %v, %v, \"%v\", \"%v\")", trade.Exchange, trade.MktCommitName, trade.TradeID, trade.Side, trade.Size, trade.Price, trade.Timestamp.Format(mysqlTimestamp), time.Now().UTC().Format(mysqlTimestamp)))
+			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", \"%v\", \"%v\", %v, %v, %v, \"%v\", \"%v\")", trade.Exchange, trade.MktCommitName, trade.TradeID, trade.Side, trade.Size, trade.Price, trade.IsBuyerMaker, m.timestamp(trade.Timestamp), m.timestamp(time.Now())))
+		} else {
+			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", \"%v\", \"%v\", %v, %v, %v, \"%v\", \"%v\")", trade.Exchange, trade.MktCommitName, trade.TradeID, trade.Side, trade.Size, trade.Price, trade.IsBuyerMaker, m.timestamp(trade.Timestamp), m.timestamp(time.Now())))
+		}
+	}
+	var ctx context.Context
+	if m.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(m.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err := m.DB.ExecContext(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitInstruments batch inserts input instrument data to database.
+func (m *MySQL) CommitInstruments(appCtx context.Context, data []Instrument) error {
+	var sb strings.Builder
+	sb.WriteString(m.insertInto("instrument", "exchange", "market", "tick_size", "lot_size", "price_precision", "size_precision", "status", "timestamp", "created_at"))
+	for i, instrument := range data {
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", %v, %v, %v, %v, \"%v\", \"%v\", \"%v\")", instrument.Exchange, instrument.MktCommitName, instrument.TickSize, instrument.LotSize, instrument.PricePrecision, instrument.SizePrecision, instrument.Status, m.timestamp(instrument.Timestamp), m.timestamp(time.Now())))
+		} else {
+			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", %v, %v, %v, %v, \"%v\", \"%v\", \"%v\")", instrument.Exchange, instrument.MktCommitName, instrument.TickSize, instrument.LotSize, instrument.PricePrecision, instrument.SizePrecision, instrument.Status, m.timestamp(instrument.Timestamp), m.timestamp(time.Now())))
+		}
+	}
+	var ctx context.Context
+	if m.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(m.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err := m.DB.ExecContext(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitCandles batch inserts input candle data to database.
+func (m *MySQL) CommitCandles(appCtx context.Context, data []Candle) error {
+	var sb strings.Builder
+	sb.WriteString(m.insertInto("candle", "exchange", "market", "interval", "open", "high", "low", "close", "volume", "timestamp", "created_at"))
+	for i, candle := range data {
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", \"%v\", %v, %v, %v, %v, %v, \"%v\", \"%v\")", candle.Exchange, candle.MktCommitName, candle.Interval, candle.Open, candle.High, candle.Low, candle.Close, candle.Volume, m.timestamp(candle.Timestamp), m.timestamp(time.Now())))
+		} else {
+			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", \"%v\", %v, %v, %v, %v, %v, \"%v\", \"%v\")", candle.Exchange, candle.MktCommitName, candle.Interval, candle.Open, candle.High, candle.Low, candle.Close, candle.Volume, m.timestamp(candle.Timestamp), m.timestamp(time.Now())))
+		}
+	}
+	var ctx context.Context
+	if m.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(m.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err := m.DB.ExecContext(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitAvgPrices batch inserts input average price data to database.
+func (m *MySQL) CommitAvgPrices(appCtx context.Context, data []AvgPrice) error {
+	var sb strings.Builder
+	sb.WriteString(m.insertInto("avg_price", "exchange", "market", "window_size", "vwap", "twap", "timestamp", "created_at"))
+	for i, avgPrice := range data {
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", \"%v\", %v, %v, \"%v\", \"%v\")", avgPrice.Exchange, avgPrice.MktCommitName, avgPrice.Window, avgPrice.VWAP, avgPrice.TWAP, m.timestamp(avgPrice.Timestamp), m.timestamp(time.Now())))
+		} else {
+			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", \"%v\", %v, %v, \"%v\", \"%v\")", avgPrice.Exchange, avgPrice.MktCommitName, avgPrice.Window, avgPrice.VWAP, avgPrice.TWAP, m.timestamp(avgPrice.Timestamp), m.timestamp(time.Now())))
+		}
+	}
+	var ctx context.Context
+	if m.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(m.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err := m.DB.ExecContext(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitBookMetrics batch inserts input book metric data to database.
+func (m *MySQL) CommitBookMetrics(appCtx context.Context, data []BookMetric) error {
+	var sb strings.Builder
+	sb.WriteString(m.insertInto("book_metric", "exchange", "market", "levels", "spread", "mid_price", "bid_depth", "ask_depth", "imbalance", "timestamp", "created_at"))
+	for i, bookMetric := range data {
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", %v, %v, %v, %v, %v, %v, \"%v\", \"%v\")", bookMetric.Exchange, bookMetric.MktCommitName, bookMetric.Levels, bookMetric.Spread, bookMetric.MidPrice, bookMetric.BidDepth, bookMetric.AskDepth, bookMetric.Imbalance, m.timestamp(bookMetric.Timestamp), m.timestamp(time.Now())))
+		} else {
+			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", %v, %v, %v, %v, %v, %v, \"%v\", \"%v\")", bookMetric.Exchange, bookMetric.MktCommitName, bookMetric.Levels, bookMetric.Spread, bookMetric.MidPrice, bookMetric.BidDepth, bookMetric.AskDepth, bookMetric.Imbalance, m.timestamp(bookMetric.Timestamp), m.timestamp(time.Now())))
+		}
+	}
+	var ctx context.Context
+	if m.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(m.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err := m.DB.ExecContext(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitMarketStats batch inserts input market stats data to database.
+func (m *MySQL) CommitMarketStats(appCtx context.Context, data []MarketStats) error {
+	var sb strings.Builder
+	sb.WriteString(m.insertInto("market_stats", "exchange", "market", "interval", "trade_count", "buy_volume", "sell_volume", "notional", "timestamp", "created_at"))
+	for i, marketStats := range data {
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", \"%v\", %v, %v, %v, %v, \"%v\", \"%v\")", marketStats.Exchange, marketStats.MktCommitName, marketStats.Interval, marketStats.TradeCount, marketStats.BuyVolume, marketStats.SellVolume, marketStats.Notional, m.timestamp(marketStats.Timestamp), m.timestamp(time.Now())))
+		} else {
+			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", \"%v\", %v, %v, %v, %v, \"%v\", \"%v\")", marketStats.Exchange, marketStats.MktCommitName, marketStats.Interval, marketStats.TradeCount, marketStats.BuyVolume, marketStats.SellVolume, marketStats.Notional, m.timestamp(marketStats.Timestamp), m.timestamp(time.Now())))
+		}
+	}
+	var ctx context.Context
+	if m.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(m.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err := m.DB.ExecContext(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitFXRates batch inserts input fx rate data to database.
+func (m *MySQL) CommitFXRates(appCtx context.Context, data []FXRate) error {
+	var sb strings.Builder
+	sb.WriteString(m.insertInto("fx_rate", "currency", "rate", "timestamp", "created_at"))
+	for i, fxRate := range data {
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf("(\"%v\", %v, \"%v\", \"%v\")", fxRate.Currency, fxRate.Rate, m.timestamp(fxRate.Timestamp), m.timestamp(time.Now())))
+		} else {
+			sb.WriteString(fmt.Sprintf(",(\"%v\", %v, \"%v\", \"%v\")", fxRate.Currency, fxRate.Rate, m.timestamp(fxRate.Timestamp), m.timestamp(time.Now())))
+		}
+	}
+	var ctx context.Context
+	if m.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(m.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err := m.DB.ExecContext(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitCoinInfos batch inserts input coin info data to database.
+func (m *MySQL) CommitCoinInfos(appCtx context.Context, data []CoinInfo) error {
+	var sb strings.Builder
+	sb.WriteString(m.insertInto("coin_info", "base", "coin_id", "market_cap", "market_cap_rank", "circulating_supply", "timestamp", "created_at"))
+	for i, coinInfo := range data {
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", %v, %v, %v, \"%v\", \"%v\")", coinInfo.Base, coinInfo.CoinID, coinInfo.MarketCap, coinInfo.Rank, coinInfo.CirculatingSupply, m.timestamp(coinInfo.Timestamp), m.timestamp(time.Now())))
+		} else {
+			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", %v, %v, %v, \"%v\", \"%v\")", coinInfo.Base, coinInfo.CoinID, coinInfo.MarketCap, coinInfo.Rank, coinInfo.CirculatingSupply, m.timestamp(coinInfo.Timestamp), m.timestamp(time.Now())))
+		}
+	}
+	var ctx context.Context
+	if m.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(m.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err := m.DB.ExecContext(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitArbitrageSpreads batch inserts input arbitrage spread data to database.
+func (m *MySQL) CommitArbitrageSpreads(appCtx context.Context, data []ArbitrageSpread) error {
+	var sb strings.Builder
+	sb.WriteString(m.insertInto("arbitrage_spread", "base", "quote", "buy_exchange", "buy_price", "sell_exchange", "sell_price", "spread_percent", "timestamp", "created_at"))
+	for i, arbitrageSpread := range data {
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf("(\"%v\", \"%v\", \"%v\", %v, \"%v\", %v, %v, \"%v\", \"%v\")", arbitrageSpread.Base, arbitrageSpread.Quote, arbitrageSpread.BuyExchange, arbitrageSpread.BuyPrice, arbitrageSpread.SellExchange, arbitrageSpread.SellPrice, arbitrageSpread.SpreadPercent, m.timestamp(arbitrageSpread.Timestamp), m.timestamp(time.Now())))
 		} else {
-			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", \"%v\", \"%v\", %v, %v, \"%v\", \"%v\")", trade.Exchange, trade.MktCommitName, trade.TradeID, trade.Side, trade.Size, trade.Price, trade.Timestamp.Format(mysqlTimestamp), time.Now().UTC().Format(mysqlTimestamp)))
+			sb.WriteString(fmt.Sprintf(",(\"%v\", \"%v\", \"%v\", %v, \"%v\", %v, %v, \"%v\", \"%v\")", arbitrageSpread.Base, arbitrageSpread.Quote, arbitrageSpread.BuyExchange, arbitrageSpread.BuyPrice, arbitrageSpread.SellExchange, arbitrageSpread.SellPrice, arbitrageSpread.SpreadPercent, m.timestamp(arbitrageSpread.Timestamp), m.timestamp(time.Now())))
 		}
 	}
 	var ctx context.Context
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// TestMySQLInsertQuery tests the multi-row insert query, ignoring the rows already stored by the unique key.
+func TestMySQLInsertQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		names config.Names
+		table string
+		cols  []string
+		rows  int
+		want  string
+	}{
+		{
+			name:  "single row",
+			table: "ticker",
+			cols:  []string{"exchange", "price"},
+			rows:  1,
+			want:  "INSERT INTO `ticker`(`exchange`, `price`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `exchange` = `exchange`",
+		},
+		{
+			name:  "multiple rows",
+			table: "trade",
+			cols:  []string{"exchange", "trade_id", "price"},
+			rows:  3,
+			want:  "INSERT INTO `trade`(`exchange`, `trade_id`, `price`) VALUES (?, ?, ?),(?, ?, ?),(?, ?, ?) ON DUPLICATE KEY UPDATE `exchange` = `exchange`",
+		},
+		{
+			name:  "single column",
+			table: "ticker",
+			cols:  []string{"price"},
+			rows:  2,
+			want:  "INSERT INTO `ticker`(`price`) VALUES (?),(?) ON DUPLICATE KEY UPDATE `price` = `price`",
+		},
+		{
+			name: "custom names",
+			names: config.Names{
+				Tables: map[string]string{"ticker": "tickers"},
+				Fields: map[string]string{"exchange": "venue", "price": "last_price"},
+			},
+			table: "ticker",
+			cols:  []string{"exchange", "market", "price"},
+			rows:  1,
+			want:  "INSERT INTO `tickers`(`venue`, `market`, `last_price`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `venue` = `venue`",
+		},
+	}
+	for _, tt := range tests {
+		m := &MySQL{Cfg: &config.MySQL{Names: tt.names}}
+		if got := m.insertQuery(tt.table, tt.cols, tt.rows); got != tt.want {
+			t.Log("ERROR : " + tt.name + " : query " + got + ", expected " + tt.want)
+			t.Error("FAILURE : mysql insert query")
+		}
+	}
+}
+
+// mysqlTestDriver is a database/sql driver recording the transactions and the number of rows of each insert,
+// failing the insert of the failExec count, if set.
+type mysqlTestDriver struct {
+	mu       sync.Mutex
+	calls    []string
+	execs    int
+	failExec int
+}
+
+var mysqlTest = &mysqlTestDriver{}
+
+func init() {
+	sql.Register("mysqltest", mysqlTest)
+}
+
+func (d *mysqlTestDriver) reset(failExec int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls = nil
+	d.execs = 0
+	d.failExec = failExec
+}
+
+func (d *mysqlTestDriver) record(call string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls = append(d.calls, call)
+}
+
+func (d *mysqlTestDriver) Open(_ string) (driver.Conn, error) { return mysqlTestConn{d}, nil }
+
+type mysqlTestConn struct{ d *mysqlTestDriver }
+
+func (c mysqlTestConn) Prepare(query string) (driver.Stmt, error) {
+	return mysqlTestStmt{d: c.d, rows: strings.Count(query, "(?")}, nil
+}
+
+func (c mysqlTestConn) Close() error { return nil }
+
+func (c mysqlTestConn) Begin() (driver.Tx, error) {
+	c.d.record("begin")
+	return mysqlTestTx{c.d}, nil
+}
+
+type mysqlTestStmt struct {
+	d    *mysqlTestDriver
+	rows int
+}
+
+func (s mysqlTestStmt) Close() error { return nil }
+
+func (s mysqlTestStmt) NumInput() int { return -1 }
+
+func (s mysqlTestStmt) Exec(_ []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	s.d.execs++
+	fail := s.d.execs == s.d.failExec
+	s.d.mu.Unlock()
+	if fail {
+		s.d.record("insert " + strconv.Itoa(s.rows) + " failed")
+		return nil, errors.New("deadlock found")
+	}
+	s.d.record("insert " + strconv.Itoa(s.rows))
+	return driver.RowsAffected(s.rows), nil
+}
+
+func (s mysqlTestStmt) Query(_ []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+type mysqlTestTx struct{ d *mysqlTestDriver }
+
+func (tx mysqlTestTx) Commit() error {
+	tx.d.record("commit")
+	return nil
+}
+
+func (tx mysqlTestTx) Rollback() error {
+	tx.d.record("rollback")
+	return nil
+}
+
+// TestMySQLInsert tests the split of the batch into the multi-row inserts within the placeholder limit,
+// committed in a single transaction, and the cache of the prepared insert statements.
+func TestMySQLInsert(t *testing.T) {
+	tests := []struct {
+		name     string
+		tickers  int
+		trades   int
+		failExec int
+		want     []string
+		wantErr  bool
+	}{
+		{"single row", 1, 0, 0, []string{"insert 1"}, false},
+		{"max rows in one statement", 0, 5041, 0, []string{"insert 5041"}, false},
+		{"one row over max in transaction", 0, 5042, 0, []string{"begin", "insert 5041", "insert 1", "commit"}, false},
+		{"chunks in transaction", 10000, 0, 0, []string{"begin", "insert 4681", "insert 4681", "insert 638", "commit"}, false},
+		{"failed chunk rolls back", 10000, 0, 2, []string{"begin", "insert 4681", "insert 4681 failed", "rollback"}, true},
+		{"failed single statement", 10, 0, 1, []string{"insert 10 failed"}, true},
+	}
+	db, err := sql.Open("mysqltest", "")
+	if err != nil {
+		t.Log("ERROR : " + err.Error())
+		t.FailNow()
+	}
+	defer db.Close()
+	ctx := context.Background()
+	for _, tt := range tests {
+		m := &MySQL{DB: db, Cfg: &config.MySQL{}, tsFormat: mysqlTimestampMs, stmts: make(map[string]*sql.Stmt)}
+		mysqlTest.reset(tt.failExec)
+		if tt.tickers > 0 {
+			err = m.CommitTickers(ctx, make([]Ticker, tt.tickers))
+		} else {
+			err = m.CommitTrades(ctx, make([]Trade, tt.trades))
+		}
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(mysqlTest.calls, tt.want) {
+			t.Log("ERROR : "+tt.name+" : calls", mysqlTest.calls, "with error", err, ", expected", tt.want)
+			t.Error("FAILURE : mysql batch insert")
+		}
+	}
+
+	// Same number of rows reuses the statement, each other one is cached till the cache is full.
+	m := &MySQL{DB: db, Cfg: &config.MySQL{}, tsFormat: mysqlTimestampMs, stmts: make(map[string]*sql.Stmt)}
+	mysqlTest.reset(0)
+	for _, rows := range []int{1, 1, 2, 1, 2} {
+		if err = m.CommitTrades(ctx, make([]Trade, rows)); err != nil {
+			t.Log("ERROR : " + err.Error())
+			t.FailNow()
+		}
+	}
+	if len(m.stmts) != 2 {
+		t.Log("ERROR : cached statements", len(m.stmts), "expected 2")
+		t.Error("FAILURE : mysql statement cache")
+	}
+	for rows := 3; rows <= mysqlStmtCacheSize+5; rows++ {
+		if err = m.CommitTrades(ctx, make([]Trade, rows)); err != nil {
+			t.Log("ERROR : " + err.Error())
+			t.FailNow()
+		}
+	}
+	if len(m.stmts) != mysqlStmtCacheSize || len(mysqlTest.calls) != mysqlStmtCacheSize+8 {
+		t.Log("ERROR : cached statements", len(m.stmts), "inserts", len(mysqlTest.calls),
+			"expected", mysqlStmtCacheSize, mysqlStmtCacheSize+8)
+		t.Error("FAILURE : mysql statement cache")
+	}
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// mysqlCompactWindow is the range of the raw data compacted by a statement,
+// so that a statement does not read the whole history at once.
+const mysqlCompactWindow = time.Hour
+
+// Compact inserts the minute candles of the raw ticker or trade data older than the given time
+// into the compacted_candle table, with the raw channel as the source. Bad ticks are not considered.
+// It starts after the last compacted minute of the channel, so that each run compacts only the new data.
+// Candles are upserted, so a window compacted again after a failure in between is not duplicated.
+// Raw data is deleted, if asked, only after all of it is compacted.
+func (m *MySQL) Compact(ctx context.Context, channel string, before time.Time, deleteRaw bool) error {
+	if channel != "ticker" && channel != "trade" {
+		return fmt.Errorf("no compaction for %s channel", channel)
+	}
+
+	var last sql.NullFloat64
+	err := m.DB.QueryRowContext(ctx, "SELECT UNIX_TIMESTAMP(MAX(`"+m.fieldName("timestamp")+"`)) FROM `"+m.tableName("compacted_candle")+"` "+
+		"WHERE `"+m.fieldName("source")+"` = ?", channel).Scan(&last)
+	if err != nil {
+		return err
+	}
+	var from time.Time
+	if last.Valid {
+		from = mysqlUnixTime(last.Float64).Add(time.Minute)
+	}
+	start, err := m.nextRaw(ctx, channel, from)
+	if err != nil {
+		return err
+	}
+
+	query := m.compactQuery(channel)
+	for !start.IsZero() && start.Before(before) {
+		end := start.Add(mysqlCompactWindow)
+		if end.After(before) {
+			end = before
+		}
+		_, err = m.DB.ExecContext(ctx, query, channel, m.timestamp(time.Now()), m.timestamp(start), m.timestamp(end))
+		if err != nil {
+			return err
+		}
+
+		// Windows without any data are skipped to the next raw data, as there may be long gaps in it.
+		start, err = m.nextRaw(ctx, channel, end)
+		if err != nil {
+			return err
+		}
+	}
+
+	if deleteRaw {
+		return m.Prune(ctx, channel, before)
+	}
+	return nil
+}
+
+// nextRaw returns the start of the minute of the first raw data from the given time,
+// or from the beginning if it is zero. It returns zero if there is not any.
+func (m *MySQL) nextRaw(ctx context.Context, channel string, from time.Time) (time.Time, error) {
+	query := "SELECT UNIX_TIMESTAMP(MIN(`" + m.fieldName("timestamp") + "`)) FROM `" + m.tableName(channel) + "`"
+	var args []interface{}
+	if !from.IsZero() {
+		query += " WHERE `" + m.fieldName("timestamp") + "` >= ?"
+		args = append(args, m.timestamp(from))
+	}
+	var next sql.NullFloat64
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&next)
+	if err != nil || !next.Valid {
+		return time.Time{}, err
+	}
+	return mysqlUnixTime(next.Float64).Truncate(time.Minute), nil
+}
+
+// compactQuery returns the query compacting a window of the raw table into the minute candles.
+// Open and close are the first and last prices of the minute in the order of timestamp.
+// Volume is only of the trades, as the ticker volume is of the last 24 hours.
+// Minute is truncated in the session time zone, which is the same in which it is inserted back.
+func (m *MySQL) compactQuery(channel string) string {
+	f := func(name string) string {
+		return "`" + m.fieldName(name) + "`"
+	}
+	minute := "DATE_FORMAT(" + f("timestamp") + ", '%Y-%m-%d %H:%i:00')"
+	volume := "0"
+	if channel == "trade" {
+		volume = "SUM(" + f("size") + ")"
+	}
+	cols := []string{"exchange", "market", "source", "open", "high", "low", "close", "volume", "tick_count", "timestamp", "created_at"}
+	fields := make([]string, len(cols))
+	updates := make([]string, 0, len(cols))
+	for i, col := range cols {
+		fields[i] = f(col)
+		if i > 2 && col != "timestamp" {
+			updates = append(updates, f(col)+" = VALUES("+f(col)+")")
+		}
+	}
+	return "INSERT INTO `" + m.tableName("compacted_candle") + "` (" + strings.Join(fields, ", ") + ") " +
+		"SELECT " + f("exchange") + ", " + f("market") + ", ?, " +
+		"CAST(SUBSTRING_INDEX(GROUP_CONCAT(" + f("price") + " ORDER BY " + f("timestamp") + ", " + f("id") + "), ',', 1) AS DECIMAL(64,8)), " +
+		"MAX(" + f("price") + "), MIN(" + f("price") + "), " +
+		"CAST(SUBSTRING_INDEX(GROUP_CONCAT(" + f("price") + " ORDER BY " + f("timestamp") + " DESC, " + f("id") + " DESC), ',', 1) AS DECIMAL(64,8)), " +
+		volume + ", COUNT(*), " + minute + ", ? " +
+		"FROM `" + m.tableName(channel) + "` " +
+		"WHERE " + f("timestamp") + " >= ? AND " + f("timestamp") + " < ? AND " + f("is_bad_tick") + " = 0 " +
+		"GROUP BY " + f("exchange") + ", " + f("market") + ", " + minute + " " +
+		"ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+}
+
+// mysqlUnixTime converts the fractional unix seconds returned by UNIX_TIMESTAMP to time, rounded to milliseconds.
+func mysqlUnixTime(sec float64) time.Time {
+	return time.Unix(0, int64(math.Round(sec*1000))*int64(time.Millisecond)).UTC()
+}
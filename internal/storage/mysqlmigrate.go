@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mysqlMigrations are the versioned schema changes of mysql, named <version>_<description>.sql.
+// New record types and column additions are added as a new file with the next version,
+// existing files should never be changed once released.
+//
+//go:embed migrations/mysql/*.sql
+var mysqlMigrations embed.FS
+
+// mysqlMigration is a schema change to be applied.
+type mysqlMigration struct {
+	version int
+	name    string
+	stmts   []string
+}
+
+// Lock is held by the app instance applying the migrations, so that the others wait for it,
+// instead of applying the same migrations concurrently.
+const (
+	mysqlMigrateLock        = "cryptogalaxy_migrate"
+	mysqlMigrateLockWaitSec = 60
+)
+
+// Migrate applies the migrations not yet applied to the schema, in the order of version.
+// Applied versions are recorded in schema_migrations table.
+// As DDL statements are not transactional in mysql, a migration failed in between should be fixed manually
+// before starting the app again.
+func (m *MySQL) Migrate(ctx context.Context) error {
+	migrations, err := loadMySQLMigrations()
+	if err != nil {
+		return err
+	}
+
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked int
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", mysqlMigrateLock, mysqlMigrateLockWaitSec).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if locked != 1 {
+		return fmt.Errorf("mysql migration lock not acquired in %d seconds", mysqlMigrateLockWaitSec)
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", mysqlMigrateLock)
+	}()
+
+	_, err = conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS `schema_migrations` ("+
+		"`version` int NOT NULL, "+
+		"`name` varchar(255) NOT NULL, "+
+		"`applied_at` timestamp(3) NOT NULL, "+
+		"PRIMARY KEY (`version`))")
+	if err != nil {
+		return err
+	}
+	applied := make(map[int]bool)
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var version int
+		if err = rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, mig := range migrations {
+		if applied[mig.version] {
+			continue
+		}
+		for _, stmt := range mig.stmts {
+			if _, err = conn.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("mysql migration %s : %w", mig.name, err)
+			}
+		}
+		_, err = conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			mig.version, mig.name, time.Now().UTC().Format(m.tsFormat))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadMySQLMigrations reads the embedded migrations sorted by version.
+func loadMySQLMigrations() ([]mysqlMigration, error) {
+	files, err := fs.Glob(mysqlMigrations, "migrations/mysql/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]mysqlMigration, 0, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".sql")
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("mysql migration %s : name should start with the version", name)
+		}
+		data, err := mysqlMigrations.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, mysqlMigration{
+			version: version,
+			name:    name,
+			stmts:   mysqlStatements(string(data)),
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// mysqlStatements splits the migration file into statements, as the driver executes only one at a time.
+// Comment lines are removed, statements should end with a semicolon at the end of the line.
+func mysqlStatements(sql string) []string {
+	var (
+		stmts []string
+		stmt  strings.Builder
+	)
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(stmt.String()), ";"))
+			stmt.Reset()
+		}
+	}
+	if strings.TrimSpace(stmt.String()) != "" {
+		stmts = append(stmts, strings.TrimSpace(stmt.String()))
+	}
+	return stmts
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// mysqlPartitionTables are the tables partitioned by time, as they get most of the data.
+var mysqlPartitionTables = []string{"ticker", "trade"}
+
+// Default values, if not configured.
+const (
+	mysqlPartitionAhead       = 3
+	mysqlPartitionIntervalMin = 60
+)
+
+// ServePartitions maintains the time based partitions of the ticker and trade tables
+// at start and then at every hour, till the app context is cancelled.
+// Partitions are created ahead of time, so that inserts never fall outside of them,
+// and the ones older than the retention are dropped.
+func (m *MySQL) ServePartitions(appCtx context.Context) error {
+	if err := m.partition(appCtx); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(mysqlPartitionIntervalMin * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.partition(appCtx); err != nil {
+				return err
+			}
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+	}
+}
+
+// partition maintains the partitions of all the tables.
+func (m *MySQL) partition(ctx context.Context) error {
+	now := time.Now().UTC()
+	for _, table := range mysqlPartitionTables {
+		if err := m.partitionTable(ctx, table, now); err != nil {
+			return fmt.Errorf("mysql %s table partition : %w", table, err)
+		}
+	}
+	return nil
+}
+
+// mysqlPartition is an existing partition of a table.
+type mysqlPartition struct {
+	name string
+	less int64
+}
+
+func (m *MySQL) partitionTable(ctx context.Context, table string, now time.Time) error {
+	table = m.tableName(table)
+	existing, err := m.partitions(ctx, table)
+	if err != nil {
+		return err
+	}
+
+	ahead := m.Cfg.PartitionAhead
+	if ahead == 0 {
+		ahead = mysqlPartitionAhead
+	}
+	start := m.periodStart(now)
+	var defs []string
+	var last int64
+	if len(existing) > 0 {
+		last = existing[len(existing)-1].less
+	}
+	for i := 0; i <= ahead; i++ {
+		period := m.nextPeriod(start, i)
+		less := m.nextPeriod(period, 1).Unix()
+		if less <= last {
+			continue
+		}
+		defs = append(defs, fmt.Sprintf("PARTITION %s VALUES LESS THAN (%d)", m.partitionName(period), less))
+	}
+
+	// Unpartitioned table is converted first. Partition key should be part of the primary key in mysql,
+	// so it is changed to include the timestamp. Existing rows all go to the first partition.
+	// Fractional seconds are floored, as partitioning function should return an integer.
+	if len(existing) == 0 {
+		id, ts := m.fieldName("id"), m.fieldName("timestamp")
+		query := "ALTER TABLE `" + table + "` DROP PRIMARY KEY, ADD PRIMARY KEY (`" + id + "`, `" + ts + "`) " +
+			"PARTITION BY RANGE (FLOOR(UNIX_TIMESTAMP(`" + ts + "`))) (" + strings.Join(defs, ", ") + ")"
+		if _, err = m.DB.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	} else if len(defs) > 0 {
+		if _, err = m.DB.ExecContext(ctx, "ALTER TABLE `"+table+"` ADD PARTITION ("+strings.Join(defs, ", ")+")"); err != nil {
+			return err
+		}
+	}
+
+	if m.Cfg.PartitionRetention <= 0 || len(existing) == 0 {
+		return nil
+	}
+	oldest := m.nextPeriod(start, -m.Cfg.PartitionRetention+1).Unix()
+	var drops []string
+	for _, p := range existing {
+		if p.less <= oldest {
+			drops = append(drops, p.name)
+		}
+	}
+
+	// At least one partition should remain in a partitioned table.
+	if len(drops) > 0 && len(drops) == len(existing) && len(defs) == 0 {
+		drops = drops[:len(drops)-1]
+	}
+	if len(drops) > 0 {
+		if _, err = m.DB.ExecContext(ctx, "ALTER TABLE `"+table+"` DROP PARTITION "+strings.Join(drops, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partitions returns the existing partitions of the table sorted by their upper bound.
+// It is empty if the table is not partitioned.
+func (m *MySQL) partitions(ctx context.Context, table string) ([]mysqlPartition, error) {
+	rows, err := m.DB.QueryContext(ctx, "SELECT PARTITION_NAME, PARTITION_DESCRIPTION FROM information_schema.PARTITIONS "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL ORDER BY PARTITION_ORDINAL_POSITION", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var parts []mysqlPartition
+	for rows.Next() {
+		var (
+			name string
+			desc sql.NullString
+		)
+		if err = rows.Scan(&name, &desc); err != nil {
+			return nil, err
+		}
+		var less int64
+		if _, err = fmt.Sscan(desc.String, &less); err != nil {
+			return nil, fmt.Errorf("partition %s is not of a time range : %w", name, err)
+		}
+		parts = append(parts, mysqlPartition{name: name, less: less})
+	}
+	return parts, rows.Err()
+}
+
+// periodStart returns the start of the day or the month of the time, as per the configured partition.
+func (m *MySQL) periodStart(t time.Time) time.Time {
+	if m.Cfg.Partition == "month" {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// nextPeriod returns the start of the nth period from the given start.
+func (m *MySQL) nextPeriod(start time.Time, n int) time.Time {
+	if m.Cfg.Partition == "month" {
+		return start.AddDate(0, n, 0)
+	}
+	return start.AddDate(0, 0, n)
+}
+
+// partitionName returns the name of the partition of the period, e.g. p20211231 or p202112.
+func (m *MySQL) partitionName(period time.Time) string {
+	if m.Cfg.Partition == "month" {
+		return period.Format("p200601")
+	}
+	return period.Format("p20060102")
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/opensearch-project/opensearch-go"
+	awssigner "github.com/opensearch-project/opensearch-go/signer/aws"
+)
+
+// OpenSearch is for connecting and indexing data to opensearch.
+type OpenSearch struct {
+	OS        *opensearch.Client
+	IndexName string
+	Cfg       *config.OpenSearch
+}
+
+var openSearch OpenSearch
+
+// InitOpenSearch initializes opensearch connection with configured values.
+// Requests are signed with AWS SigV4, if configured, for AWS OpenSearch Service domains with IAM access policy.
+func InitOpenSearch(cfg *config.OpenSearch) (*OpenSearch, error) {
+	if openSearch.OS == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.MaxIdleConns = cfg.MaxIdleConns
+		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+		osCfg := opensearch.Config{
+			Addresses: cfg.Addresses,
+			Username:  cfg.Username,
+			Password:  cfg.Password,
+			Transport: t,
+		}
+		if cfg.AWSSigV4 {
+			signer, err := awssigner.NewSigner(session.Options{
+				Config:            aws.Config{Region: aws.String(cfg.AWSRegion)},
+				SharedConfigState: session.SharedConfigEnable,
+			})
+			if err != nil {
+				return nil, err
+			}
+			osCfg.Signer = signer
+		}
+		client, err := opensearch.NewClient(osCfg)
+		if err != nil {
+			return nil, err
+		}
+		var ctx context.Context
+		if cfg.ReqTimeoutSec > 0 {
+			timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReqTimeoutSec)*time.Second)
+			ctx = timeoutCtx
+			defer cancel()
+		} else {
+			ctx = context.Background()
+		}
+		resp, err := client.Ping(client.Ping.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.IsError() {
+			return nil, fmt.Errorf("code : %v, status : %v", resp.StatusCode, resp.Status())
+		}
+		openSearch = OpenSearch{
+			OS:        client,
+			IndexName: cfg.IndexName,
+			Cfg:       cfg,
+		}
+	}
+	return &openSearch, nil
+}
+
+// GetOpenSearch returns already prepared opensearch instance.
+func GetOpenSearch() *OpenSearch {
+	return &openSearch
+}
+
+// CommitTickers batch inserts input ticker data to opensearch.
+// Documents are the same as of elastic search, so that the same index mappings and dashboards can be used.
+func (o *OpenSearch) CommitTickers(appCtx context.Context, data []Ticker) error {
+	var buf bytes.Buffer
+	for _, ticker := range data {
+		meta := []byte(fmt.Sprintf(`{"create":{}}%s`, "\n"))
+		ed := esData{
+			Channel:   "ticker",
+			Exchange:  ticker.Exchange,
+			Market:    ticker.MktCommitName,
+			Base:      ticker.Base,
+			Quote:     ticker.Quote,
+			Price:     ticker.Price,
+			BestBid:   ticker.BestBid,
+			BestAsk:   ticker.BestAsk,
+			Volume:    ticker.Volume,
+			High:      ticker.High,
+			Low:       ticker.Low,
+			PriceUSD:  ticker.PriceUSD,
+			BadTick:   ticker.IsBadTick,
+			Timestamp: ticker.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		osBytes, err := jsoniter.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		osBytes = append(osBytes, "\n"...)
+		buf.Grow(len(meta) + len(osBytes))
+		buf.Write(meta)
+		buf.Write(osBytes)
+	}
+	return o.bulk(appCtx, &buf)
+}
+
+// CommitTrades batch inserts input trade data to opensearch.
+func (o *OpenSearch) CommitTrades(appCtx context.Context, data []Trade) error {
+	var buf bytes.Buffer
+	for _, trade := range data {
+		meta := []byte(fmt.Sprintf(`{"create":{}}%s`, "\n"))
+		ed := esData{
+			Channel:    "trade",
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			Base:       trade.Base,
+			Quote:      trade.Quote,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			BuyerMaker: trade.IsBuyerMaker,
+			PriceUSD:   trade.PriceUSD,
+			BadTick:    trade.IsBadTick,
+			Timestamp:  trade.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		osBytes, err := jsoniter.Marshal(ed)
+		if err != nil {
+			return err
+		}
+		osBytes = append(osBytes, "\n"...)
+		buf.Grow(len(meta) + len(osBytes))
+		buf.Write(meta)
+		buf.Write(osBytes)
+	}
+	return o.bulk(appCtx, &buf)
+}
+
+// bulk sends the bulk request body to the configured index.
+func (o *OpenSearch) bulk(appCtx context.Context, buf *bytes.Buffer) error {
+	var ctx context.Context
+	if o.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(o.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = appCtx
+	}
+	resp, err := o.OS.Bulk(bytes.NewReader(buf.Bytes()), o.OS.Bulk.WithIndex(o.IndexName), o.OS.Bulk.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("code : %v, status : %v", resp.StatusCode, resp.Status())
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Parquet is for writing data to parquet files, rotated by time or size.
+type Parquet struct {
+	Cfg   *config.Parquet
+	files map[string]*parquetFile
+	codec parquet.CompressionCodec
+	mu    sync.Mutex
+}
+
+var parquetStore Parquet
+
+// Default values, if not configured.
+const (
+	parquetRotateIntervalMin = 60
+	parquetRowGroupSize      = 16 * 1024 * 1024
+)
+
+// parquetFile is a file open for writing an exchange channel data.
+type parquetFile struct {
+	path   string
+	file   *os.File
+	w      *parquetCounter
+	pw     *writer.ParquetWriter
+	period time.Time
+}
+
+// parquetCounter counts the bytes written to the file, used for rotation by size.
+type parquetCounter struct {
+	f *os.File
+	n int64
+}
+
+func (c *parquetCounter) Write(p []byte) (int, error) {
+	n, err := c.f.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type parquetTicker struct {
+	Exchange  string  `parquet:"name=exchange, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Market    string  `parquet:"name=market, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Base      string  `parquet:"name=base, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Quote     string  `parquet:"name=quote, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Price     float64 `parquet:"name=price, type=DOUBLE"`
+	BestBid   float64 `parquet:"name=best_bid, type=DOUBLE"`
+	BestAsk   float64 `parquet:"name=best_ask, type=DOUBLE"`
+	Volume    float64 `parquet:"name=volume, type=DOUBLE"`
+	High      float64 `parquet:"name=high, type=DOUBLE"`
+	Low       float64 `parquet:"name=low, type=DOUBLE"`
+	PriceUSD  float64 `parquet:"name=price_usd, type=DOUBLE"`
+	BadTick   bool    `parquet:"name=is_bad_tick, type=BOOLEAN"`
+	Timestamp int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	CreatedAt int64   `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+}
+
+type parquetTrade struct {
+	Exchange   string  `parquet:"name=exchange, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Market     string  `parquet:"name=market, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Base       string  `parquet:"name=base, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Quote      string  `parquet:"name=quote, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	TradeID    string  `parquet:"name=trade_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Side       string  `parquet:"name=side, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Size       float64 `parquet:"name=size, type=DOUBLE"`
+	Price      float64 `parquet:"name=price, type=DOUBLE"`
+	BuyerMaker bool    `parquet:"name=is_buyer_maker, type=BOOLEAN"`
+	PriceUSD   float64 `parquet:"name=price_usd, type=DOUBLE"`
+	BadTick    bool    `parquet:"name=is_bad_tick, type=BOOLEAN"`
+	Timestamp  int64   `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	CreatedAt  int64   `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+}
+
+// InitParquet initializes parquet file writing with configured values.
+func InitParquet(cfg *config.Parquet) (*Parquet, error) {
+	if parquetStore.Cfg == nil {
+		var codec parquet.CompressionCodec
+		switch strings.ToLower(cfg.Compression) {
+		case "", "snappy":
+			codec = parquet.CompressionCodec_SNAPPY
+		case "gzip":
+			codec = parquet.CompressionCodec_GZIP
+		case "zstd":
+			codec = parquet.CompressionCodec_ZSTD
+		case "none":
+			codec = parquet.CompressionCodec_UNCOMPRESSED
+		default:
+			return nil, errors.New("parquet compression should be snappy, gzip, zstd or none")
+		}
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			return nil, err
+		}
+		parquetStore = Parquet{
+			Cfg:   cfg,
+			files: make(map[string]*parquetFile),
+			codec: codec,
+		}
+	}
+	return &parquetStore, nil
+}
+
+// GetParquet returns already prepared parquet instance.
+func GetParquet() *Parquet {
+	return &parquetStore
+}
+
+// CommitTickers writes input ticker data to parquet files of the exchanges.
+func (p *Parquet) CommitTickers(appCtx context.Context, data []Ticker) error {
+	now := time.Now().UTC()
+	recs := make(map[string][]interface{})
+	var exchanges []string
+	for _, ticker := range data {
+		if _, ok := recs[ticker.Exchange]; !ok {
+			exchanges = append(exchanges, ticker.Exchange)
+		}
+		recs[ticker.Exchange] = append(recs[ticker.Exchange], &parquetTicker{
+			Exchange:  ticker.Exchange,
+			Market:    ticker.MktCommitName,
+			Base:      ticker.Base,
+			Quote:     ticker.Quote,
+			Price:     ticker.Price,
+			BestBid:   ticker.BestBid,
+			BestAsk:   ticker.BestAsk,
+			Volume:    ticker.Volume,
+			High:      ticker.High,
+			Low:       ticker.Low,
+			PriceUSD:  ticker.PriceUSD,
+			BadTick:   ticker.IsBadTick,
+			Timestamp: ticker.Timestamp.UnixNano() / int64(time.Microsecond),
+			CreatedAt: now.UnixNano() / int64(time.Microsecond),
+		})
+	}
+	for _, exchange := range exchanges {
+		if err := p.write(appCtx, exchange, "ticker", new(parquetTicker), recs[exchange], now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CommitTrades writes input trade data to parquet files of the exchanges.
+func (p *Parquet) CommitTrades(appCtx context.Context, data []Trade) error {
+	now := time.Now().UTC()
+	recs := make(map[string][]interface{})
+	var exchanges []string
+	for _, trade := range data {
+		if _, ok := recs[trade.Exchange]; !ok {
+			exchanges = append(exchanges, trade.Exchange)
+		}
+		recs[trade.Exchange] = append(recs[trade.Exchange], &parquetTrade{
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			Base:       trade.Base,
+			Quote:      trade.Quote,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			BuyerMaker: trade.IsBuyerMaker,
+			PriceUSD:   trade.PriceUSD,
+			BadTick:    trade.IsBadTick,
+			Timestamp:  trade.Timestamp.UnixNano() / int64(time.Microsecond),
+			CreatedAt:  now.UnixNano() / int64(time.Microsecond),
+		})
+	}
+	for _, exchange := range exchanges {
+		if err := p.write(appCtx, exchange, "trade", new(parquetTrade), recs[exchange], now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write appends the records to the open file of the exchange channel.
+// File is rotated before writing, if the rotation interval is over,
+// and after writing, if it reached the maximum file size.
+func (p *Parquet) write(appCtx context.Context, exchange string, channel string, schema interface{}, recs []interface{}, now time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if appCtx.Err() != nil {
+		return appCtx.Err()
+	}
+	key := exchange + "/" + channel
+	f := p.files[key]
+	period := p.period(now)
+	if f != nil && !f.period.Equal(period) {
+		delete(p.files, key)
+		if err := f.close(); err != nil {
+			return err
+		}
+		f = nil
+	}
+	if f == nil {
+		var err error
+		f, err = p.create(exchange, channel, schema, period, now)
+		if err != nil {
+			return err
+		}
+		p.files[key] = f
+	}
+	for _, rec := range recs {
+		if err := f.pw.Write(rec); err != nil {
+			return err
+		}
+	}
+	if p.Cfg.MaxFileSizeMB > 0 && f.w.n+f.pw.ObjsSize >= int64(p.Cfg.MaxFileSizeMB)*1024*1024 {
+		delete(p.files, key)
+		if err := f.close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// period returns the start of the rotation interval of the time.
+func (p *Parquet) period(now time.Time) time.Time {
+	interval := p.Cfg.RotateIntervalMin
+	if interval == 0 {
+		interval = parquetRotateIntervalMin
+	}
+	return now.Truncate(time.Duration(interval) * time.Minute)
+}
+
+// create opens a new file of the exchange channel,
+// named with the exchange, channel and the time at which it is opened, under dir/exchange/channel.
+// Data is written to a file with .tmp suffix, which is renamed once the file is closed with the footer,
+// so that any file with .parquet extension is always complete for reading.
+func (p *Parquet) create(exchange string, channel string, schema interface{}, period time.Time, now time.Time) (*parquetFile, error) {
+	dir := filepath.Join(p.Cfg.Dir, exchange, channel)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	name := exchange + "_" + channel + "_" + now.Format("20060102T150405")
+	path := filepath.Join(dir, name+".parquet")
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s_%d.parquet", name, i))
+	}
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	w := &parquetCounter{f: file}
+	pw, err := writer.NewParquetWriterFromWriter(w, schema, 1)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	pw.RowGroupSize = parquetRowGroupSize
+	pw.CompressionType = p.codec
+	return &parquetFile{
+		path:   path,
+		file:   file,
+		w:      w,
+		pw:     pw,
+		period: period,
+	}, nil
+}
+
+// close writes the footer and renames the file to its final name.
+func (f *parquetFile) close() error {
+	if err := f.pw.WriteStop(); err != nil {
+		f.file.Close()
+		return err
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.path+".tmp", f.path)
+}
+
+// Close closes all the open files, so that they are complete for reading.
+// It is called at the app exit.
+func (p *Parquet) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var closeErr error
+	for key, f := range p.files {
+		delete(p.files, key)
+		if err := f.close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
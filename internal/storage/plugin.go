@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Plugin is for committing data to an external storage process over gRPC,
+// so that proprietary sinks can be added without changing the app.
+// The process implements the Plugin service of the contract in examples/grpc/plugin.proto,
+// and is either started by the app from the configured binary or already running at the configured address.
+type Plugin struct {
+	Cfg  *config.Plugin
+	cmd  *exec.Cmd
+	conn *grpc.ClientConn
+}
+
+var (
+	plugins   = make(map[string]*Plugin)
+	pluginsMu sync.Mutex
+)
+
+// PluginPrefix is the prefix of the plugin storage names in the exchange config, e.g. plugin:my_sink.
+const PluginPrefix = "plugin:"
+
+// Default values, if not configured.
+const (
+	pluginMethod          = "/cryptogalaxy.v1.Plugin/Commit"
+	pluginStartTimeoutSec = 10
+)
+
+// InitPlugin starts the plugin process, if a binary path is configured, and connects to it.
+// The started process should print the address it listens on, e.g. 127.0.0.1:50051 or unix:///tmp/sink.sock,
+// as the first line of its standard output.
+func InitPlugin(cfg *config.Plugin) (*Plugin, error) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if p, ok := plugins[cfg.Name]; ok {
+		return p, nil
+	}
+	p := &Plugin{Cfg: cfg}
+
+	timeout := cfg.StartTimeoutSec
+	if timeout == 0 {
+		timeout = pluginStartTimeoutSec
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	address := cfg.Address
+	if cfg.Path != "" {
+		var err error
+		address, err = p.start(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	conn, err := grpc.DialContext(ctx, address,
+		grpc.WithBlock(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(grpcCodec{})),
+	)
+	if err != nil {
+		p.stop()
+		return nil, err
+	}
+	p.conn = conn
+	plugins[cfg.Name] = p
+	return p, nil
+}
+
+// GetPlugin returns already prepared plugin instance of the name.
+func GetPlugin(name string) *Plugin {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	return plugins[name]
+}
+
+// start runs the plugin binary and reads the address it listens on.
+// Standard error of the process is passed through to the app's, so that its failures are visible.
+func (p *Plugin) start(ctx context.Context) (string, error) {
+	cmd := exec.Command(p.Cfg.Path, p.Cfg.Args...)
+	cmd.Env = append(os.Environ(), "CRYPTOGALAXY_PLUGIN_NAME="+p.Cfg.Name)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err = cmd.Start(); err != nil {
+		return "", err
+	}
+	p.cmd = cmd
+
+	type handshake struct {
+		address string
+		err     error
+	}
+	hsCh := make(chan handshake, 1)
+	go func() {
+		rd := bufio.NewReader(stdout)
+		line, err := rd.ReadString('\n')
+		hsCh <- handshake{strings.TrimSpace(line), err}
+
+		// Rest of the output is not used, but it should be read for the process not to block on writing.
+		_, _ = io.Copy(io.Discard, rd)
+	}()
+	select {
+	case hs := <-hsCh:
+		if hs.address == "" {
+			p.stop()
+			return "", fmt.Errorf("plugin %s : address not received from the process : %v", p.Cfg.Name, hs.err)
+		}
+		return hs.address, nil
+	case <-ctx.Done():
+		p.stop()
+		return "", fmt.Errorf("plugin %s : address not received from the process : %w", p.Cfg.Name, ctx.Err())
+	}
+}
+
+// CommitTickers sends input ticker data to the plugin in a single batch.
+func (p *Plugin) CommitTickers(appCtx context.Context, data []Ticker) error {
+	var batch []byte
+	now := time.Now().UTC().UnixNano()
+	for _, ticker := range data {
+		batch = protowire.AppendTag(batch, 1, protowire.BytesType)
+		batch = protowire.AppendBytes(batch, grpcTicker(&ticker, now))
+	}
+	return p.commit(appCtx, batch)
+}
+
+// CommitTrades sends input trade data to the plugin in a single batch.
+func (p *Plugin) CommitTrades(appCtx context.Context, data []Trade) error {
+	var batch []byte
+	now := time.Now().UTC().UnixNano()
+	for _, trade := range data {
+		batch = protowire.AppendTag(batch, 2, protowire.BytesType)
+		batch = protowire.AppendBytes(batch, grpcTrade(&trade, now))
+	}
+	return p.commit(appCtx, batch)
+}
+
+// commit calls the Commit rpc with the encoded batch.
+// Batch is considered committed only if the plugin replies without an error.
+func (p *Plugin) commit(appCtx context.Context, batch []byte) error {
+	ctx := appCtx
+	if p.Cfg.ReqTimeoutSec > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(appCtx, time.Duration(p.Cfg.ReqTimeoutSec)*time.Second)
+		defer cancel()
+	}
+	var ack []byte
+	if err := p.conn.Invoke(ctx, pluginMethod, &batch, &ack); err != nil {
+		return fmt.Errorf("plugin %s : %w", p.Cfg.Name, err)
+	}
+	return nil
+}
+
+// stop interrupts the started process and waits a while for it to exit, before killing it.
+func (p *Plugin) stop() {
+	if p.cmd == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		_ = p.cmd.Wait()
+		close(done)
+	}()
+	_ = p.cmd.Process.Signal(os.Interrupt)
+	select {
+	case <-done:
+	case <-time.After(pluginStartTimeoutSec * time.Second):
+		_ = p.cmd.Process.Kill()
+		<-done
+	}
+	p.cmd = nil
+}
+
+// Close closes the connection and stops the process, if started by the app.
+// It is called at the app exit.
+func (p *Plugin) Close() error {
+	err := p.conn.Close()
+	p.stop()
+	return err
+}
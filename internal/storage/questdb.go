@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// QuestDB is for connecting and sending data to questdb over InfluxDB line protocol.
+type QuestDB struct {
+	Cfg  *config.QuestDB
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+var questDB QuestDB
+
+// ilpEscaper escapes the table, tag (symbol) keys and values of a line.
+var ilpEscaper = strings.NewReplacer(" ", "\\ ", ",", "\\,", "=", "\\=", "\n", "\\n")
+
+// ilpStrEscaper escapes the string field values of a line.
+var ilpStrEscaper = strings.NewReplacer("\"", "\\\"", "\\", "\\\\", "\n", "\\n")
+
+// InitQuestDB initializes questdb line protocol TCP connection with configured values.
+func InitQuestDB(cfg *config.QuestDB) (*QuestDB, error) {
+	if questDB.Cfg == nil {
+		questDB.Cfg = cfg
+		if err := questDB.connect(); err != nil {
+			questDB.Cfg = nil
+			return nil, err
+		}
+	}
+	return &questDB, nil
+}
+
+// GetQuestDB returns already prepared questdb instance.
+func GetQuestDB() *QuestDB {
+	return &questDB
+}
+
+func (q *QuestDB) connect() error {
+	conn, err := net.DialTimeout("tcp", q.Cfg.URL, time.Duration(q.Cfg.ReqTimeoutSec)*time.Second)
+	if err != nil {
+		return err
+	}
+	q.conn = conn
+	return nil
+}
+
+// CommitTickers batch sends input ticker data to questdb.
+func (q *QuestDB) CommitTickers(appCtx context.Context, data []Ticker) error {
+	var buf bytes.Buffer
+	now := time.Now()
+	for _, ticker := range data {
+		ilpTags(&buf, "ticker", ticker.Exchange, ticker.MktCommitName, ticker.Base, ticker.Quote)
+		buf.WriteString(" price=")
+		ilpFloat(&buf, ticker.Price)
+		buf.WriteString(",best_bid=")
+		ilpFloat(&buf, ticker.BestBid)
+		buf.WriteString(",best_ask=")
+		ilpFloat(&buf, ticker.BestAsk)
+		buf.WriteString(",volume=")
+		ilpFloat(&buf, ticker.Volume)
+		buf.WriteString(",high=")
+		ilpFloat(&buf, ticker.High)
+		buf.WriteString(",low=")
+		ilpFloat(&buf, ticker.Low)
+		buf.WriteString(",price_usd=")
+		ilpFloat(&buf, ticker.PriceUSD)
+		buf.WriteString(",is_bad_tick=")
+		buf.WriteString(strconv.FormatBool(ticker.IsBadTick))
+		ilpTimestamps(&buf, ticker.Timestamp, now)
+	}
+	return q.write(appCtx, buf.Bytes())
+}
+
+// CommitTrades batch sends input trade data to questdb.
+func (q *QuestDB) CommitTrades(appCtx context.Context, data []Trade) error {
+	var buf bytes.Buffer
+	now := time.Now()
+	for _, trade := range data {
+		ilpTags(&buf, "trade", trade.Exchange, trade.MktCommitName, trade.Base, trade.Quote)
+		if trade.Side != "" {
+			buf.WriteString(",side=")
+			buf.WriteString(ilpEscaper.Replace(trade.Side))
+		}
+		buf.WriteString(" trade_id=\"")
+		buf.WriteString(ilpStrEscaper.Replace(trade.TradeID))
+		buf.WriteString("\",size=")
+		ilpFloat(&buf, trade.Size)
+		buf.WriteString(",price=")
+		ilpFloat(&buf, trade.Price)
+		buf.WriteString(",is_buyer_maker=")
+		buf.WriteString(strconv.FormatBool(trade.IsBuyerMaker))
+		buf.WriteString(",price_usd=")
+		ilpFloat(&buf, trade.PriceUSD)
+		buf.WriteString(",is_bad_tick=")
+		buf.WriteString(strconv.FormatBool(trade.IsBadTick))
+		ilpTimestamps(&buf, trade.Timestamp, now)
+	}
+	return q.write(appCtx, buf.Bytes())
+}
+
+// write sends the lines of the batch in one go.
+// Line protocol over TCP has no response, so a broken connection is known only on the next write.
+// In that case the connection is established again and the batch is sent once more,
+// any further error is returned.
+func (q *QuestDB) write(appCtx context.Context, lines []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if appCtx.Err() != nil {
+		return appCtx.Err()
+	}
+	if q.conn != nil {
+		if err := q.writeConn(lines); err == nil {
+			return nil
+		}
+		q.conn.Close()
+		q.conn = nil
+	}
+	if err := q.connect(); err != nil {
+		return err
+	}
+	if err := q.writeConn(lines); err != nil {
+		q.conn.Close()
+		q.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (q *QuestDB) writeConn(lines []byte) error {
+	if q.Cfg.ReqTimeoutSec > 0 {
+		if err := q.conn.SetWriteDeadline(time.Now().Add(time.Duration(q.Cfg.ReqTimeoutSec) * time.Second)); err != nil {
+			return err
+		}
+	}
+	_, err := q.conn.Write(lines)
+	return err
+}
+
+// ilpTags writes the table name and the common symbol columns of a line.
+func ilpTags(buf *bytes.Buffer, table string, exchange string, market string, base string, quote string) {
+	buf.WriteString(table)
+	buf.WriteString(",exchange=")
+	buf.WriteString(ilpEscaper.Replace(exchange))
+	buf.WriteString(",market=")
+	buf.WriteString(ilpEscaper.Replace(market))
+	if base != "" {
+		buf.WriteString(",base=")
+		buf.WriteString(ilpEscaper.Replace(base))
+	}
+	if quote != "" {
+		buf.WriteString(",quote=")
+		buf.WriteString(ilpEscaper.Replace(quote))
+	}
+}
+
+func ilpFloat(buf *bytes.Buffer, f float64) {
+	buf.WriteString(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// ilpTimestamps writes the created_at field in microseconds and the designated timestamp of the line in nanoseconds.
+func ilpTimestamps(buf *bytes.Buffer, timestamp time.Time, createdAt time.Time) {
+	buf.WriteString(",created_at=")
+	buf.WriteString(strconv.FormatInt(createdAt.UnixNano()/int64(time.Microsecond), 10))
+	buf.WriteString("t ")
+	buf.WriteString(strconv.FormatInt(timestamp.UnixNano(), 10))
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// RawArchive is for archiving the websocket frames as received from the exchanges, before any parsing,
+// so that the data can be parsed once more later, e.g. after fixing a bug or adding a new field.
+// Frames are written to gzip compressed JSONL files per exchange, rotated by time or size.
+type RawArchive struct {
+	Cfg   *config.RawArchive
+	files map[string]*rawArchiveFile
+	mu    sync.Mutex
+}
+
+var rawArchive RawArchive
+
+// Default values, if not configured.
+const (
+	rawArchiveRotateIntervalMin = 60
+	rawArchiveFlushIntervalSec  = 10
+)
+
+// rawArchiveFile is a file open for writing the frames of an exchange.
+type rawArchiveFile struct {
+	file   *os.File
+	w      *fileCounter
+	gz     *gzip.Writer
+	buf    *bufio.Writer
+	period time.Time
+}
+
+// rawArchiveRecord is a line of the archive file.
+// Frame is kept as a string, as not all the frames are valid JSON, e.g. plain text pings.
+type rawArchiveRecord struct {
+	ReceivedAt time.Time `json:"received_at"`
+	URL        string    `json:"url"`
+	Frame      string    `json:"frame"`
+}
+
+// InitRawArchive initializes raw frame archiving with configured values.
+func InitRawArchive(cfg *config.RawArchive) (*RawArchive, error) {
+	if rawArchive.Cfg == nil {
+		if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+			return nil, err
+		}
+		rawArchive = RawArchive{
+			Cfg:   cfg,
+			files: make(map[string]*rawArchiveFile),
+		}
+	}
+	return &rawArchive, nil
+}
+
+// GetRawArchive returns already prepared raw archive instance.
+// It returns nil, if archiving is not enabled.
+func GetRawArchive() *RawArchive {
+	if rawArchive.Cfg == nil {
+		return nil
+	}
+	return &rawArchive
+}
+
+// Write appends the frame to the open file of the exchange.
+// Frames are buffered in memory and flushed to the file by Serve at every flush interval,
+// as flushing the gzip stream for each frame would defeat the compression.
+func (r *RawArchive) Write(exchange string, url string, receivedAt time.Time, frame []byte) error {
+	line, err := jsoniter.Marshal(rawArchiveRecord{
+		ReceivedAt: receivedAt.UTC(),
+		URL:        url,
+		Frame:      string(frame),
+	})
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	af := r.files[exchange]
+	period := r.period(receivedAt)
+	if af != nil && !af.period.Equal(period) {
+		delete(r.files, exchange)
+		if err = af.close(); err != nil {
+			return err
+		}
+		af = nil
+	}
+	if af == nil {
+		af, err = r.create(exchange, period, receivedAt)
+		if err != nil {
+			return err
+		}
+		r.files[exchange] = af
+	}
+	if _, err = af.buf.Write(line); err != nil {
+		return err
+	}
+	if err = af.buf.WriteByte('\n'); err != nil {
+		return err
+	}
+	if r.Cfg.MaxFileSizeMB > 0 && af.w.n >= int64(r.Cfg.MaxFileSizeMB)*1024*1024 {
+		delete(r.files, exchange)
+		if err = af.close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Serve flushes the buffered frames of all the open files at every flush interval.
+func (r *RawArchive) Serve(appCtx context.Context) error {
+	interval := r.Cfg.FlushIntervalSec
+	if interval == 0 {
+		interval = rawArchiveFlushIntervalSec
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.flush(); err != nil {
+				return err
+			}
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+	}
+}
+
+func (r *RawArchive) flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, af := range r.files {
+		if err := af.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// period returns the start of the rotation interval of the time.
+func (r *RawArchive) period(t time.Time) time.Time {
+	interval := r.Cfg.RotateIntervalMin
+	if interval == 0 {
+		interval = rawArchiveRotateIntervalMin
+	}
+	return t.UTC().Truncate(time.Duration(interval) * time.Minute)
+}
+
+// create opens a new file of the exchange under <dir>/<exchange>/<date>,
+// named with the exchange and the time at which it is opened.
+func (r *RawArchive) create(exchange string, period time.Time, now time.Time) (*rawArchiveFile, error) {
+	dir := filepath.Join(r.Cfg.Dir, exchange, period.Format("2006-01-02"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	name := exchange + "_raw_" + now.UTC().Format("20060102T150405")
+	path := filepath.Join(dir, name+".jsonl.gz")
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s_%d.jsonl.gz", name, i))
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	af := &rawArchiveFile{
+		file:   file,
+		w:      &fileCounter{f: file},
+		period: period,
+	}
+	af.gz = gzip.NewWriter(af.w)
+	af.buf = bufio.NewWriter(af.gz)
+	return af, nil
+}
+
+func (af *rawArchiveFile) flush() error {
+	if err := af.buf.Flush(); err != nil {
+		return err
+	}
+	return af.gz.Flush()
+}
+
+// close flushes the remaining frames, ends the gzip stream and closes the file.
+func (af *rawArchiveFile) close() error {
+	if err := af.buf.Flush(); err != nil {
+		af.file.Close()
+		return err
+	}
+	if err := af.gz.Close(); err != nil {
+		af.file.Close()
+		return err
+	}
+	return af.file.Close()
+}
+
+// Close closes all the open files.
+// It is called at the app exit.
+func (r *RawArchive) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var closeErr error
+	for exchange, af := range r.files {
+		delete(r.files, exchange)
+		if err := af.close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
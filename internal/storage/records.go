@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"context"
+)
+
+// MarkPriceCommitter is a storage to which the mark price data of the exchanges is also committed.
+type MarkPriceCommitter interface {
+	CommitMarkPrices(appCtx context.Context, data []MarkPrice) error
+}
+
+// BBOCommitter is a storage to which the best bid and offer data of the exchanges is also committed.
+type BBOCommitter interface {
+	CommitBBOs(appCtx context.Context, data []BBO) error
+}
+
+// BlockTradeCommitter is a storage to which the block trade data of the exchanges is also committed.
+type BlockTradeCommitter interface {
+	CommitBlockTrades(appCtx context.Context, data []Trade) error
+}
+
+// TradingStatusCommitter is a storage to which the trading status data of the exchanges is also committed.
+type TradingStatusCommitter interface {
+	CommitTradingStatuses(appCtx context.Context, data []TradingStatus) error
+}
+
+// AggTradeCommitter is a storage to which the aggregate trade data of the exchanges is also committed.
+type AggTradeCommitter interface {
+	CommitAggTrades(appCtx context.Context, data []Trade) error
+}
+
+// OrderFlowCommitter is a storage to which the order flow data of the exchanges is also committed.
+type OrderFlowCommitter interface {
+	CommitOrderFlows(appCtx context.Context, data []OrderFlow) error
+}
+
+// InstrumentCommitter is a storage to which the instrument data of the exchanges is also committed.
+type InstrumentCommitter interface {
+	CommitInstruments(appCtx context.Context, data []Instrument) error
+}
+
+// CandleCommitter is a storage to which the candles built from the trades are also committed.
+type CandleCommitter interface {
+	CommitCandles(appCtx context.Context, data []Candle) error
+}
+
+// AvgPriceCommitter is a storage to which the average prices calculated from the trades are also committed.
+type AvgPriceCommitter interface {
+	CommitAvgPrices(appCtx context.Context, data []AvgPrice) error
+}
+
+// BookMetricCommitter is a storage to which the order book metric data of the exchanges is also committed.
+type BookMetricCommitter interface {
+	CommitBookMetrics(appCtx context.Context, data []BookMetric) error
+}
+
+// MarketStatsCommitter is a storage to which the market stats aggregated from the trades are also committed.
+type MarketStatsCommitter interface {
+	CommitMarketStats(appCtx context.Context, data []MarketStats) error
+}
+
+// recordCommitters commit a batch of the record channel, other than ticker and trade,
+// to the storage implementing the committer of its record type.
+// Records are passed as interface values, as the exchanges buffer all the record channels the same way.
+var recordCommitters = map[string]struct {
+	commits func(str Storage) bool
+	commit  func(appCtx context.Context, str Storage, data []interface{}) error
+}{
+	"mark_price": {
+		commits: func(str Storage) bool { _, ok := str.(MarkPriceCommitter); return ok },
+		commit: func(appCtx context.Context, str Storage, data []interface{}) error {
+			records := make([]MarkPrice, len(data))
+			for i := range data {
+				records[i] = data[i].(MarkPrice)
+			}
+			return str.(MarkPriceCommitter).CommitMarkPrices(appCtx, records)
+		},
+	},
+	"bbo": {
+		commits: func(str Storage) bool { _, ok := str.(BBOCommitter); return ok },
+		commit: func(appCtx context.Context, str Storage, data []interface{}) error {
+			records := make([]BBO, len(data))
+			for i := range data {
+				records[i] = data[i].(BBO)
+			}
+			return str.(BBOCommitter).CommitBBOs(appCtx, records)
+		},
+	},
+	"block_trade": {
+		commits: func(str Storage) bool { _, ok := str.(BlockTradeCommitter); return ok },
+		commit: func(appCtx context.Context, str Storage, data []interface{}) error {
+			records := make([]Trade, len(data))
+			for i := range data {
+				records[i] = data[i].(Trade)
+			}
+			return str.(BlockTradeCommitter).CommitBlockTrades(appCtx, records)
+		},
+	},
+	"trading_status": {
+		commits: func(str Storage) bool { _, ok := str.(TradingStatusCommitter); return ok },
+		commit: func(appCtx context.Context, str Storage, data []interface{}) error {
+			records := make([]TradingStatus, len(data))
+			for i := range data {
+				records[i] = data[i].(TradingStatus)
+			}
+			return str.(TradingStatusCommitter).CommitTradingStatuses(appCtx, records)
+		},
+	},
+	"agg_trade": {
+		commits: func(str Storage) bool { _, ok := str.(AggTradeCommitter); return ok },
+		commit: func(appCtx context.Context, str Storage, data []interface{}) error {
+			records := make([]Trade, len(data))
+			for i := range data {
+				records[i] = data[i].(Trade)
+			}
+			return str.(AggTradeCommitter).CommitAggTrades(appCtx, records)
+		},
+	},
+	"orderflow": {
+		commits: func(str Storage) bool { _, ok := str.(OrderFlowCommitter); return ok },
+		commit: func(appCtx context.Context, str Storage, data []interface{}) error {
+			records := make([]OrderFlow, len(data))
+			for i := range data {
+				records[i] = data[i].(OrderFlow)
+			}
+			return str.(OrderFlowCommitter).CommitOrderFlows(appCtx, records)
+		},
+	},
+	"instrument": {
+		commits: func(str Storage) bool { _, ok := str.(InstrumentCommitter); return ok },
+		commit: func(appCtx context.Context, str Storage, data []interface{}) error {
+			records := make([]Instrument, len(data))
+			for i := range data {
+				records[i] = data[i].(Instrument)
+			}
+			return str.(InstrumentCommitter).CommitInstruments(appCtx, records)
+		},
+	},
+	"candle": {
+		commits: func(str Storage) bool { _, ok := str.(CandleCommitter); return ok },
+		commit: func(appCtx context.Context, str Storage, data []interface{}) error {
+			records := make([]Candle, len(data))
+			for i := range data {
+				records[i] = data[i].(Candle)
+			}
+			return str.(CandleCommitter).CommitCandles(appCtx, records)
+		},
+	},
+	"avg_price": {
+		commits: func(str Storage) bool { _, ok := str.(AvgPriceCommitter); return ok },
+		commit: func(appCtx context.Context, str Storage, data []interface{}) error {
+			records := make([]AvgPrice, len(data))
+			for i := range data {
+				records[i] = data[i].(AvgPrice)
+			}
+			return str.(AvgPriceCommitter).CommitAvgPrices(appCtx, records)
+		},
+	},
+	"book_metric": {
+		commits: func(str Storage) bool { _, ok := str.(BookMetricCommitter); return ok },
+		commit: func(appCtx context.Context, str Storage, data []interface{}) error {
+			records := make([]BookMetric, len(data))
+			for i := range data {
+				records[i] = data[i].(BookMetric)
+			}
+			return str.(BookMetricCommitter).CommitBookMetrics(appCtx, records)
+		},
+	},
+	"market_stats": {
+		commits: func(str Storage) bool { _, ok := str.(MarketStatsCommitter); return ok },
+		commit: func(appCtx context.Context, str Storage, data []interface{}) error {
+			records := make([]MarketStats, len(data))
+			for i := range data {
+				records[i] = data[i].(MarketStats)
+			}
+			return str.(MarketStatsCommitter).CommitMarketStats(appCtx, records)
+		},
+	},
+}
+
+// CommitsRecords tells whether the storage implements the committer of the record channel.
+func CommitsRecords(str Storage, channel string) bool {
+	c, ok := recordCommitters[channel]
+	return ok && c.commits(str)
+}
+
+// CommitRecords commits the batch of the record channel to the storage.
+// Batch is skipped if the storage does not implement the committer of the record channel.
+func CommitRecords(appCtx context.Context, str Storage, channel string, data []interface{}) error {
+	c, ok := recordCommitters[channel]
+	if !ok || !c.commits(str) {
+		return nil
+	}
+	return c.commit(appCtx, str, data)
+}
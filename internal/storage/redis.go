@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// Redis is for connecting and adding data to redis streams.
+type Redis struct {
+	Cfg  *config.Redis
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex
+}
+
+var redis Redis
+
+// Default stream names, if not configured.
+const (
+	redisTickerStream = "cryptogalaxy:ticker"
+	redisTradeStream  = "cryptogalaxy:trade"
+)
+
+// redisEntry is a stream and its entry values in the order of the batch.
+type redisEntry struct {
+	stream string
+	values [][]byte
+}
+
+// InitRedis initializes redis connection with configured values.
+func InitRedis(cfg *config.Redis) (*Redis, error) {
+	if redis.Cfg == nil {
+		redis.Cfg = cfg
+		if err := redis.connect(); err != nil {
+			redis.Cfg = nil
+			return nil, err
+		}
+	}
+	return &redis, nil
+}
+
+// GetRedis returns already prepared redis instance.
+func GetRedis() *Redis {
+	return &redis
+}
+
+// connect establishes the connection, authenticates and selects the database, if configured.
+func (r *Redis) connect() error {
+	conn, err := net.DialTimeout("tcp", r.Cfg.URL, time.Duration(r.Cfg.ReqTimeoutSec)*time.Second)
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+	r.r = bufio.NewReader(conn)
+	var cmds [][]string
+	if r.Cfg.Password != "" {
+		if r.Cfg.User != "" {
+			cmds = append(cmds, []string{"AUTH", r.Cfg.User, r.Cfg.Password})
+		} else {
+			cmds = append(cmds, []string{"AUTH", r.Cfg.Password})
+		}
+	}
+	if r.Cfg.DB > 0 {
+		cmds = append(cmds, []string{"SELECT", strconv.Itoa(r.Cfg.DB)})
+	}
+	cmds = append(cmds, []string{"PING"})
+	var buf bytes.Buffer
+	for _, cmd := range cmds {
+		args := make([][]byte, len(cmd))
+		for i, a := range cmd {
+			args[i] = []byte(a)
+		}
+		writeRESP(&buf, args)
+	}
+	if err = r.do(buf.Bytes(), len(cmds)); err != nil {
+		r.conn.Close()
+		r.conn = nil
+		return err
+	}
+	return nil
+}
+
+// CommitTickers batch adds input ticker data to redis streams.
+func (r *Redis) CommitTickers(appCtx context.Context, data []Ticker) error {
+	var entries []*redisEntry
+	for _, ticker := range data {
+		rd := esData{
+			Channel:   "ticker",
+			Exchange:  ticker.Exchange,
+			Market:    ticker.MktCommitName,
+			Base:      ticker.Base,
+			Quote:     ticker.Quote,
+			Price:     ticker.Price,
+			PriceUSD:  ticker.PriceUSD,
+			BadTick:   ticker.IsBadTick,
+			BestBid:   ticker.BestBid,
+			BestAsk:   ticker.BestAsk,
+			Volume:    ticker.Volume,
+			High:      ticker.High,
+			Low:       ticker.Low,
+			Timestamp: ticker.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		value, err := jsoniter.Marshal(rd)
+		if err != nil {
+			return err
+		}
+		entries = r.addEntry(entries, r.stream(r.Cfg.TickerStream, redisTickerStream, ticker.Exchange, ticker.MktCommitName), value)
+	}
+	return r.xadd(appCtx, entries)
+}
+
+// CommitTrades batch adds input trade data to redis streams.
+func (r *Redis) CommitTrades(appCtx context.Context, data []Trade) error {
+	var entries []*redisEntry
+	for _, trade := range data {
+		rd := esData{
+			Channel:    "trade",
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			Base:       trade.Base,
+			Quote:      trade.Quote,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			PriceUSD:   trade.PriceUSD,
+			BadTick:    trade.IsBadTick,
+			BuyerMaker: trade.IsBuyerMaker,
+			Timestamp:  trade.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		value, err := jsoniter.Marshal(rd)
+		if err != nil {
+			return err
+		}
+		entries = r.addEntry(entries, r.stream(r.Cfg.TradeStream, redisTradeStream, trade.Exchange, trade.MktCommitName), value)
+	}
+	return r.xadd(appCtx, entries)
+}
+
+// stream returns the stream name with the exchange and market placeholders replaced.
+func (r *Redis) stream(name string, def string, exchange string, market string) string {
+	if name == "" {
+		name = def
+	}
+	if strings.Contains(name, "{") {
+		name = strings.NewReplacer("{exchange}", exchange, "{market}", market).Replace(name)
+	}
+	return name
+}
+
+// addEntry groups the value under its stream, keeping the order of the streams as in the batch.
+func (r *Redis) addEntry(entries []*redisEntry, stream string, value []byte) []*redisEntry {
+	for _, e := range entries {
+		if e.stream == stream {
+			e.values = append(e.values, value)
+			return entries
+		}
+	}
+	return append(entries, &redisEntry{stream: stream, values: [][]byte{value}})
+}
+
+// xadd sends XADD commands of the batch pipelined.
+// Each record is added as a separate stream entry with the JSON in data field, or if batch entry is configured,
+// all the records of a stream are added as a single entry with the JSON array in data field.
+// If the connection is found broken, it is established again and the batch is sent once more.
+func (r *Redis) xadd(appCtx context.Context, entries []*redisEntry) error {
+	var buf bytes.Buffer
+	var count int
+	for _, e := range entries {
+		if r.Cfg.BatchEntry {
+			value := make([]byte, 0, 2+len(e.values)*256)
+			value = append(value, '[')
+			for i, v := range e.values {
+				if i > 0 {
+					value = append(value, ',')
+				}
+				value = append(value, v...)
+			}
+			value = append(value, ']')
+			writeRESP(&buf, r.xaddArgs(e.stream, value))
+			count++
+			continue
+		}
+		for _, v := range e.values {
+			writeRESP(&buf, r.xaddArgs(e.stream, v))
+			count++
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if appCtx.Err() != nil {
+		return appCtx.Err()
+	}
+	if r.conn != nil {
+		err := r.do(buf.Bytes(), count)
+		if err == nil {
+			return nil
+		}
+		var re redisError
+		if errors.As(err, &re) {
+			return err
+		}
+		r.conn.Close()
+		r.conn = nil
+	}
+	if err := r.connect(); err != nil {
+		return err
+	}
+	err := r.do(buf.Bytes(), count)
+	if err != nil {
+		var re redisError
+		if !errors.As(err, &re) {
+			r.conn.Close()
+			r.conn = nil
+		}
+	}
+	return err
+}
+
+func (r *Redis) xaddArgs(stream string, value []byte) [][]byte {
+	args := [][]byte{[]byte("XADD"), []byte(stream)}
+	if r.Cfg.MaxLen > 0 {
+		args = append(args, []byte("MAXLEN"), []byte("~"), []byte(strconv.FormatInt(r.Cfg.MaxLen, 10)))
+	}
+	return append(args, []byte("*"), []byte("data"), value)
+}
+
+// redisError is the error reply of a command.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis : " + string(e)
+}
+
+// do writes the pipelined commands and reads all of their replies.
+// First error reply is returned after reading all the replies, so that the connection stays in sync.
+func (r *Redis) do(cmds []byte, count int) error {
+	if r.Cfg.ReqTimeoutSec > 0 {
+		if err := r.conn.SetDeadline(time.Now().Add(time.Duration(r.Cfg.ReqTimeoutSec) * time.Second)); err != nil {
+			return err
+		}
+	}
+	if _, err := r.conn.Write(cmds); err != nil {
+		return err
+	}
+	var replyErr error
+	for i := 0; i < count; i++ {
+		if err := readRESP(r.r); err != nil {
+			var re redisError
+			if !errors.As(err, &re) {
+				return err
+			}
+			if replyErr == nil {
+				replyErr = err
+			}
+		}
+	}
+	return replyErr
+}
+
+// writeRESP writes the command as an array of bulk strings.
+func writeRESP(buf *bytes.Buffer, args [][]byte) {
+	buf.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		buf.WriteString("$" + strconv.Itoa(len(a)) + "\r\n")
+		buf.Write(a)
+		buf.WriteString("\r\n")
+	}
+}
+
+// readRESP reads and discards a reply, returning error reply as redisError.
+func readRESP(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if len(line) < 3 {
+		return fmt.Errorf("redis : invalid reply %q", line)
+	}
+	body := line[1 : len(line)-2]
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return redisError(body)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return nil
+		}
+		_, err = io.CopyN(io.Discard, r, int64(n+2))
+		return err
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err = readRESP(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("redis : invalid reply %q", line)
+}
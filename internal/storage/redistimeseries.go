@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// RedisTimeSeries is for connecting and adding ticker data to redis time series.
+// Each field of a market ticker is a separate series, labeled with exchange, market and field,
+// so that it can be queried for a recent window or over many markets with TS.MRANGE filters.
+type RedisTimeSeries struct {
+	Cfg  *config.RedisTimeSeries
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex
+}
+
+var redisTimeSeries RedisTimeSeries
+
+// Default values, if not configured.
+const (
+	redisTimeSeriesPrefix = "cryptogalaxy"
+)
+
+// redisTimeSeriesFields are the ticker fields which can be added as series.
+var redisTimeSeriesFields = map[string]func(*Ticker) float64{
+	"price":     func(t *Ticker) float64 { return t.Price },
+	"price_usd": func(t *Ticker) float64 { return t.PriceUSD },
+	"best_bid":  func(t *Ticker) float64 { return t.BestBid },
+	"best_ask":  func(t *Ticker) float64 { return t.BestAsk },
+	"volume":    func(t *Ticker) float64 { return t.Volume },
+	"high":      func(t *Ticker) float64 { return t.High },
+	"low":       func(t *Ticker) float64 { return t.Low },
+}
+
+// InitRedisTimeSeries initializes redis connection with configured values.
+func InitRedisTimeSeries(cfg *config.RedisTimeSeries) (*RedisTimeSeries, error) {
+	if redisTimeSeries.Cfg == nil {
+		for _, field := range cfg.Fields {
+			if _, ok := redisTimeSeriesFields[field]; !ok {
+				return nil, errors.New("redis_timeseries fields should be of price, price_usd, best_bid, best_ask, volume, high or low")
+			}
+		}
+		redisTimeSeries.Cfg = cfg
+		if err := redisTimeSeries.connect(); err != nil {
+			redisTimeSeries.Cfg = nil
+			return nil, err
+		}
+	}
+	return &redisTimeSeries, nil
+}
+
+// GetRedisTimeSeries returns already prepared redis time series instance.
+func GetRedisTimeSeries() *RedisTimeSeries {
+	return &redisTimeSeries
+}
+
+// connect establishes the connection, authenticates and selects the database, if configured.
+func (r *RedisTimeSeries) connect() error {
+	conn, err := net.DialTimeout("tcp", r.Cfg.URL, time.Duration(r.Cfg.ReqTimeoutSec)*time.Second)
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+	r.r = bufio.NewReader(conn)
+	var buf bytes.Buffer
+	count := 1
+	if r.Cfg.Password != "" {
+		if r.Cfg.User != "" {
+			writeRESP(&buf, [][]byte{[]byte("AUTH"), []byte(r.Cfg.User), []byte(r.Cfg.Password)})
+		} else {
+			writeRESP(&buf, [][]byte{[]byte("AUTH"), []byte(r.Cfg.Password)})
+		}
+		count++
+	}
+	if r.Cfg.DB > 0 {
+		writeRESP(&buf, [][]byte{[]byte("SELECT"), []byte(strconv.Itoa(r.Cfg.DB))})
+		count++
+	}
+	writeRESP(&buf, [][]byte{[]byte("PING")})
+	if err = r.do(buf.Bytes(), count); err != nil {
+		r.conn.Close()
+		r.conn = nil
+		return err
+	}
+	return nil
+}
+
+// CommitTickers adds input ticker data to the series of the markets with TS.ADD commands pipelined.
+// A series is created with the labels and retention on its first sample.
+// A sample with the same timestamp as the last one of the series replaces it.
+func (r *RedisTimeSeries) CommitTickers(appCtx context.Context, data []Ticker) error {
+	prefix := r.Cfg.KeyPrefix
+	if prefix == "" {
+		prefix = redisTimeSeriesPrefix
+	}
+	fields := r.Cfg.Fields
+	if len(fields) == 0 {
+		fields = []string{"price"}
+	}
+	retention := []byte(strconv.FormatInt(int64(r.Cfg.RetentionSec)*1000, 10))
+	var buf bytes.Buffer
+	var count int
+	for i := range data {
+		ticker := &data[i]
+		ts := []byte(strconv.FormatInt(ticker.Timestamp.UnixNano()/int64(time.Millisecond), 10))
+		for _, field := range fields {
+			value := redisTimeSeriesFields[field](ticker)
+			writeRESP(&buf, [][]byte{
+				[]byte("TS.ADD"),
+				[]byte(prefix + ":" + ticker.Exchange + ":" + ticker.MktCommitName + ":" + field),
+				ts,
+				[]byte(strconv.FormatFloat(value, 'f', -1, 64)),
+				[]byte("RETENTION"), retention,
+				[]byte("ON_DUPLICATE"), []byte("LAST"),
+				[]byte("LABELS"),
+				[]byte("exchange"), []byte(ticker.Exchange),
+				[]byte("market"), []byte(ticker.MktCommitName),
+				[]byte("base"), []byte(ticker.Base),
+				[]byte("quote"), []byte(ticker.Quote),
+				[]byte("field"), []byte(field),
+			})
+			count++
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if appCtx.Err() != nil {
+		return appCtx.Err()
+	}
+	if r.conn != nil {
+		err := r.do(buf.Bytes(), count)
+		if err == nil {
+			return nil
+		}
+		var re redisError
+		if errors.As(err, &re) {
+			return err
+		}
+		r.conn.Close()
+		r.conn = nil
+	}
+	if err := r.connect(); err != nil {
+		return err
+	}
+	err := r.do(buf.Bytes(), count)
+	if err != nil {
+		var re redisError
+		if !errors.As(err, &re) {
+			r.conn.Close()
+			r.conn = nil
+		}
+	}
+	return err
+}
+
+// CommitTrades is only to satisfy the Storage interface, trade channel is not supported for redis time series.
+func (r *RedisTimeSeries) CommitTrades(_ context.Context, _ []Trade) error {
+	return errors.New("redis_timeseries storage supports only ticker channel")
+}
+
+// do writes the pipelined commands and reads all of their replies.
+// First error reply is returned after reading all the replies, so that the connection stays in sync.
+func (r *RedisTimeSeries) do(cmds []byte, count int) error {
+	if r.Cfg.ReqTimeoutSec > 0 {
+		if err := r.conn.SetDeadline(time.Now().Add(time.Duration(r.Cfg.ReqTimeoutSec) * time.Second)); err != nil {
+			return err
+		}
+	}
+	if _, err := r.conn.Write(cmds); err != nil {
+		return err
+	}
+	var replyErr error
+	for i := 0; i < count; i++ {
+		if err := readRESP(r.r); err != nil {
+			var re redisError
+			if !errors.As(err, &re) {
+				return err
+			}
+			if replyErr == nil {
+				replyErr = err
+			}
+		}
+	}
+	return replyErr
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// Storage is a storage system to which the ticker and trade data of the exchanges is committed.
+type Storage interface {
+	CommitTickers(appCtx context.Context, data []Ticker) error
+	CommitTrades(appCtx context.Context, data []Trade) error
+}
+
+// Registered is a storage registered by its config name, along with the number of records
+// to be buffered in memory before each commit.
+// Retry and DeadLetter are set only if retry is configured for the storage, WAL only if it is enabled.
+// FlushIntSec is the interval at which the buffered data is committed even if the buffer is not full, 0 if not set.
+// CommitWorkers is the number of go routines committing the buffered websocket data of an exchange, 0 if not set.
+// Ordered tells whether the markets are split among the commit workers, so that the records of a market keep their order.
+// Backpressure is the policy for the buffered websocket data when the storage can not keep up, empty for block.
+// ChannelBuf is the number of buffered websocket batches of an exchange which can wait for commit, 0 if not set.
+// Failover is set only if a fallback storage is configured for the storage.
+// RecordCommitBufs are the commit buffer sizes of the other record channels, like bbo or candle, by the channel name.
+type Registered struct {
+	Name             string
+	Storage          Storage
+	TickerCommitBuf  int
+	TradeCommitBuf   int
+	RecordCommitBufs map[string]int
+	FlushIntSec      int
+	CommitWorkers    int
+	Ordered          bool
+	Backpressure     string
+	ChannelBuf       int
+	Retry            *config.StorageRetry
+	DeadLetter       *DeadLetter
+	WAL              *WAL
+	Failover         *Failover
+}
+
+// registry holds the connected storages.
+// Storages are registered only while starting the app, before any exchange is started,
+// so it is not guarded for concurrent access.
+var registry = make(map[string]*Registered)
+
+// Register adds the connected storage to the registry under its config name,
+// so that the exchanges commit the ticker and trade data to it, if configured for the market channel.
+func Register(name string, str Storage, tickerCommitBuf int, tradeCommitBuf int) {
+	registry[name] = &Registered{
+		Name:            name,
+		Storage:         str,
+		TickerCommitBuf: tickerCommitBuf,
+		TradeCommitBuf:  tradeCommitBuf,
+	}
+}
+
+// SetRecordCommitBuffers sets the commit buffer sizes of the record channels of the registered storage,
+// other than ticker and trade, which are committed only if the storage implements their committer.
+func SetRecordCommitBuffers(name string, bufs map[string]int) {
+	if reg := registry[name]; reg != nil {
+		reg.RecordCommitBufs = bufs
+	}
+}
+
+// RecordCommitBuf returns the commit buffer size of the record channel.
+// Channels without a configured size are buffered same as the trades.
+func (r *Registered) RecordCommitBuf(channel string) int {
+	if size := r.RecordCommitBufs[channel]; size > 0 {
+		return size
+	}
+	if r.TradeCommitBuf > 0 {
+		return r.TradeCommitBuf
+	}
+	return 1
+}
+
+// SetRetry sets the retry policy of the registered storage.
+// Batches failed even after the retries are written to the dead-letter directory, if configured,
+// instead of failing the exchange.
+func SetRetry(name string, cfg *config.StorageRetry) error {
+	reg := registry[name]
+	if reg == nil {
+		return nil
+	}
+	reg.Retry = cfg
+	if cfg.DeadLetterDir != "" {
+		dl, err := NewDeadLetter(cfg.DeadLetterDir)
+		if err != nil {
+			return err
+		}
+		reg.DeadLetter = dl
+	}
+	return nil
+}
+
+// SetFlushInterval sets the interval at which the buffered data of the registered storage is committed,
+// so that the data of low volume markets does not stay in memory till the buffer is full.
+func SetFlushInterval(name string, intervalSec int) {
+	if reg := registry[name]; reg != nil {
+		reg.FlushIntSec = intervalSec
+	}
+}
+
+// SetCommitWorkers sets the number of go routines committing the buffered websocket data of the registered storage
+// for each exchange, so that the batches are committed in parallel instead of waiting for the previous commit.
+func SetCommitWorkers(name string, workers int) {
+	if reg := registry[name]; reg != nil {
+		reg.CommitWorkers = workers
+	}
+}
+
+// SetOrdered makes the commit workers of the registered storage commit the markets of an exchange split among them,
+// each market always by the same worker, so that the records of a market are committed in order.
+func SetOrdered(name string, ordered bool) {
+	if reg := registry[name]; reg != nil {
+		reg.Ordered = ordered
+	}
+}
+
+// SetBackpressure sets the policy of the registered storage for the buffered websocket data,
+// when the previous batches are still waiting for commit.
+// Block waits for the commit, which also stalls the websocket reader of the exchange,
+// drop_oldest drops the oldest batch waiting for commit and drop_newest drops the new batch.
+func SetBackpressure(name string, policy string) {
+	if reg := registry[name]; reg != nil {
+		reg.Backpressure = policy
+	}
+}
+
+// SetChannelBuffer sets the number of buffered websocket batches of the registered storage which can wait for commit
+// for each exchange, so that a burst of data or a slow commit does not stall the websocket reader right away.
+func SetChannelBuffer(name string, size int) {
+	if reg := registry[name]; reg != nil {
+		reg.ChannelBuf = size
+	}
+}
+
+// SetWAL enables the on-disk write-ahead buffer of the registered storage
+// and returns it, so that the spooled batches can be replayed.
+func SetWAL(name string, cfg *config.StorageWAL) (*Registered, error) {
+	reg := registry[name]
+	if reg == nil {
+		return nil, nil
+	}
+	wal, err := NewWAL(name, cfg)
+	if err != nil {
+		return nil, err
+	}
+	reg.WAL = wal
+	return reg, nil
+}
+
+// Lookup returns the registered storage of the name, nil if it is not registered.
+func Lookup(name string) *Registered {
+	return registry[name]
+}
@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWrite is for pushing ticker prices as metrics to prometheus remote write endpoint,
+// which is supported by prometheus itself, victoriametrics, mimir, cortex and thanos receive.
+type RemoteWrite struct {
+	Client *http.Client
+	Cfg    *config.RemoteWrite
+
+	// lastTs is the last sample timestamp pushed for each series.
+	lastTs map[string]int64
+	mu     sync.Mutex
+}
+
+var remoteWrite RemoteWrite
+
+// Defaults, if not configured.
+const (
+	remoteWritePrefix     = "cryptogalaxy"
+	remoteWriteMaxRetries = 3
+	remoteWriteBackoff    = 500 * time.Millisecond
+)
+
+// remoteWriteSeries is a time series of the request with its labels sorted by name.
+type remoteWriteSeries struct {
+	labels  [][2]string
+	samples []remoteWriteSample
+}
+
+type remoteWriteSample struct {
+	value float64
+	ts    int64
+}
+
+// InitRemoteWrite initializes prometheus remote write client with configured values.
+func InitRemoteWrite(cfg *config.RemoteWrite) (*RemoteWrite, error) {
+	if remoteWrite.Client == nil {
+		remoteWrite.Client = &http.Client{
+			Timeout: time.Duration(cfg.ReqTimeoutSec) * time.Second,
+		}
+		remoteWrite.Cfg = cfg
+		remoteWrite.lastTs = make(map[string]int64)
+	}
+	return &remoteWrite, nil
+}
+
+// GetRemoteWrite returns already prepared prometheus remote write instance.
+func GetRemoteWrite() *RemoteWrite {
+	return &remoteWrite
+}
+
+// CommitTickers pushes input ticker data as price and price_usd samples, labeled with exchange and market.
+//
+// Prometheus rejects the samples out of order or with the same timestamp as the last one of a series,
+// so those are dropped here keeping only the latest price of each millisecond.
+func (r *RemoteWrite) CommitTickers(appCtx context.Context, data []Ticker) error {
+	prefix := r.Cfg.MetricPrefix
+	if prefix == "" {
+		prefix = remoteWritePrefix
+	}
+	var keys []string
+	series := make(map[string]*remoteWriteSeries)
+	add := func(name string, ticker *Ticker, value float64) {
+		key := name + "/" + ticker.Exchange + "/" + ticker.MktCommitName
+		s, ok := series[key]
+		if !ok {
+			s = &remoteWriteSeries{labels: r.labels(name, ticker.Exchange, ticker.MktCommitName)}
+			series[key] = s
+			keys = append(keys, key)
+		}
+		ts := ticker.Timestamp.UnixNano() / int64(time.Millisecond)
+		if n := len(s.samples); n > 0 && s.samples[n-1].ts >= ts {
+			if s.samples[n-1].ts == ts {
+				s.samples[n-1].value = value
+			}
+			return
+		}
+		s.samples = append(s.samples, remoteWriteSample{value: value, ts: ts})
+	}
+	for i := range data {
+		ticker := &data[i]
+		add(prefix+"_ticker_price", ticker, ticker.Price)
+		if ticker.PriceUSD > 0 {
+			add(prefix+"_ticker_price_usd", ticker, ticker.PriceUSD)
+		}
+	}
+
+	var req []byte
+	r.mu.Lock()
+	for _, key := range keys {
+		s := series[key]
+		if last, ok := r.lastTs[key]; ok {
+			i := 0
+			for i < len(s.samples) && s.samples[i].ts <= last {
+				i++
+			}
+			s.samples = s.samples[i:]
+		}
+		if len(s.samples) == 0 {
+			continue
+		}
+		r.lastTs[key] = s.samples[len(s.samples)-1].ts
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, s.encode())
+	}
+	r.mu.Unlock()
+	if len(req) == 0 {
+		return nil
+	}
+	return r.push(appCtx, snappy.Encode(nil, req))
+}
+
+// CommitTrades is only to satisfy the Storage interface, trade channel is not supported for remote write.
+func (r *RemoteWrite) CommitTrades(_ context.Context, _ []Trade) error {
+	return errors.New("remote_write storage supports only ticker channel")
+}
+
+// labels returns the labels of the series, including the configured ones, sorted by name.
+func (r *RemoteWrite) labels(name string, exchange string, market string) [][2]string {
+	labels := [][2]string{{"__name__", name}, {"exchange", exchange}, {"market", market}}
+	for k, v := range r.Cfg.Labels {
+		if k != "__name__" && k != "exchange" && k != "market" {
+			labels = append(labels, [2]string{k, v})
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+	return labels
+}
+
+// encode encodes the series as TimeSeries protobuf message.
+func (s *remoteWriteSeries) encode() []byte {
+	var msg []byte
+	for _, l := range s.labels {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, l[0])
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, l[1])
+		msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, label)
+	}
+	for _, sample := range s.samples {
+		var smp []byte
+		smp = protowire.AppendTag(smp, 1, protowire.Fixed64Type)
+		smp = protowire.AppendFixed64(smp, math.Float64bits(sample.value))
+		smp = protowire.AppendTag(smp, 2, protowire.VarintType)
+		smp = protowire.AppendVarint(smp, uint64(sample.ts))
+		msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, smp)
+	}
+	return msg
+}
+
+// push sends the compressed write request, retrying on server errors and rate limiting.
+// Other client errors mean the request is not going to be accepted, so those are returned right away.
+func (r *RemoteWrite) push(appCtx context.Context, body []byte) error {
+	maxRetries := r.Cfg.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = remoteWriteMaxRetries
+	}
+	backoff := remoteWriteBackoff
+	for i := 0; ; i++ {
+		retry, err := r.pushReq(appCtx, body)
+		if err == nil || !retry || i == maxRetries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (r *RemoteWrite) pushReq(appCtx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(appCtx, http.MethodPost, r.Cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if r.Cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Cfg.BearerToken)
+	} else if r.Cfg.Username != "" {
+		req.SetBasicAuth(r.Cfg.Username, r.Cfg.Password)
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote write : status %d, %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests, err
+}
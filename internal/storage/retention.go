@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// Pruner is a storage which can delete its own data of a channel older than the given time,
+// so that the retention is kept by the app without any external cleanup jobs.
+type Pruner interface {
+	Prune(ctx context.Context, channel string, before time.Time) error
+}
+
+// Default values, if not configured.
+const retentionIntervalMin = 60
+
+// ServeRetention deletes the data of the channels older than their max age at start
+// and then at every retention interval, till the app context is cancelled.
+func ServeRetention(appCtx context.Context, pruner Pruner, cfg *config.StorageRetention) error {
+	if err := prune(appCtx, pruner, cfg); err != nil {
+		return err
+	}
+	interval := cfg.IntervalMin
+	if interval == 0 {
+		interval = retentionIntervalMin
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := prune(appCtx, pruner, cfg); err != nil {
+				return err
+			}
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+	}
+}
+
+// prune deletes the data of all the configured channels.
+func prune(ctx context.Context, pruner Pruner, cfg *config.StorageRetention) error {
+	now := time.Now().UTC()
+	for channel, hours := range cfg.MaxAgeHours {
+		if err := pruner.Prune(ctx, channel, now.Add(-time.Duration(hours)*time.Hour)); err != nil {
+			return fmt.Errorf("%s retention : %w", channel, err)
+		}
+	}
+	return nil
+}
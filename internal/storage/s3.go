@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// S3 is for buffering data and uploading it as compressed objects to s3 compatible storage.
+type S3 struct {
+	Cfg      *config.S3
+	uploader *s3manager.Uploader
+	objects  map[string]*s3Object
+	mu       sync.Mutex
+}
+
+var s3Store S3
+
+// Default values, if not configured.
+const (
+	s3Layout            = "{exchange}/{channel}/{date}/{hour}"
+	s3UploadIntervalMin = 60
+	s3PartSizeMB        = 5
+	s3MaxRetries        = 3
+)
+
+// s3Object is an object being buffered in memory for an exchange channel.
+type s3Object struct {
+	exchange string
+	channel  string
+	buf      bytes.Buffer
+	gz       *gzip.Writer
+	pw       *writer.ParquetWriter
+	period   time.Time
+	openedAt time.Time
+}
+
+// InitS3 initializes s3 uploader with configured values.
+func InitS3(cfg *config.S3) (*S3, error) {
+	if s3Store.Cfg == nil {
+		switch cfg.Format {
+		case "", "jsonl", "parquet":
+		default:
+			return nil, errors.New("s3 format should be jsonl or parquet")
+		}
+		maxRetries := cfg.MaxRetries
+		if maxRetries == 0 {
+			maxRetries = s3MaxRetries
+		}
+		awsCfg := aws.NewConfig().
+			WithRegion(cfg.Region).
+			WithS3ForcePathStyle(cfg.ForcePathStyle).
+			WithMaxRetries(maxRetries)
+		if cfg.Endpoint != "" {
+			awsCfg = awsCfg.WithEndpoint(cfg.Endpoint)
+		}
+		if cfg.AccessKeyID != "" {
+			awsCfg = awsCfg.WithCredentials(credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, ""))
+		}
+		sess, err := session.NewSession(awsCfg)
+		if err != nil {
+			return nil, err
+		}
+		partSize := cfg.PartSizeMB
+		if partSize == 0 {
+			partSize = s3PartSizeMB
+		}
+		uploader := s3manager.NewUploader(sess, func(u *s3manager.Uploader) {
+			u.PartSize = int64(partSize) * 1024 * 1024
+		})
+		s3Store = S3{
+			Cfg:      cfg,
+			uploader: uploader,
+			objects:  make(map[string]*s3Object),
+		}
+	}
+	return &s3Store, nil
+}
+
+// GetS3 returns already prepared s3 instance.
+func GetS3() *S3 {
+	return &s3Store
+}
+
+// CommitTickers buffers input ticker data to objects of the exchanges.
+func (s *S3) CommitTickers(appCtx context.Context, data []Ticker) error {
+	now := time.Now().UTC()
+	recs := make(map[string][]interface{})
+	var exchanges []string
+	for _, ticker := range data {
+		if _, ok := recs[ticker.Exchange]; !ok {
+			exchanges = append(exchanges, ticker.Exchange)
+		}
+		var rec interface{}
+		if s.Cfg.Format == "parquet" {
+			rec = &parquetTicker{
+				Exchange:  ticker.Exchange,
+				Market:    ticker.MktCommitName,
+				Base:      ticker.Base,
+				Quote:     ticker.Quote,
+				Price:     ticker.Price,
+				BestBid:   ticker.BestBid,
+				BestAsk:   ticker.BestAsk,
+				Volume:    ticker.Volume,
+				High:      ticker.High,
+				Low:       ticker.Low,
+				PriceUSD:  ticker.PriceUSD,
+				BadTick:   ticker.IsBadTick,
+				Timestamp: ticker.Timestamp.UnixNano() / int64(time.Microsecond),
+				CreatedAt: now.UnixNano() / int64(time.Microsecond),
+			}
+		} else {
+			rec = &esData{
+				Channel:   "ticker",
+				Exchange:  ticker.Exchange,
+				Market:    ticker.MktCommitName,
+				Base:      ticker.Base,
+				Quote:     ticker.Quote,
+				Price:     ticker.Price,
+				PriceUSD:  ticker.PriceUSD,
+				BadTick:   ticker.IsBadTick,
+				BestBid:   ticker.BestBid,
+				BestAsk:   ticker.BestAsk,
+				Volume:    ticker.Volume,
+				High:      ticker.High,
+				Low:       ticker.Low,
+				Timestamp: ticker.Timestamp,
+				CreatedAt: now,
+			}
+		}
+		recs[ticker.Exchange] = append(recs[ticker.Exchange], rec)
+	}
+	for _, exchange := range exchanges {
+		if err := s.write(appCtx, exchange, "ticker", new(parquetTicker), recs[exchange], now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CommitTrades buffers input trade data to objects of the exchanges.
+func (s *S3) CommitTrades(appCtx context.Context, data []Trade) error {
+	now := time.Now().UTC()
+	recs := make(map[string][]interface{})
+	var exchanges []string
+	for _, trade := range data {
+		if _, ok := recs[trade.Exchange]; !ok {
+			exchanges = append(exchanges, trade.Exchange)
+		}
+		var rec interface{}
+		if s.Cfg.Format == "parquet" {
+			rec = &parquetTrade{
+				Exchange:   trade.Exchange,
+				Market:     trade.MktCommitName,
+				Base:       trade.Base,
+				Quote:      trade.Quote,
+				TradeID:    trade.TradeID,
+				Side:       trade.Side,
+				Size:       trade.Size,
+				Price:      trade.Price,
+				BuyerMaker: trade.IsBuyerMaker,
+				PriceUSD:   trade.PriceUSD,
+				BadTick:    trade.IsBadTick,
+				Timestamp:  trade.Timestamp.UnixNano() / int64(time.Microsecond),
+				CreatedAt:  now.UnixNano() / int64(time.Microsecond),
+			}
+		} else {
+			rec = &esData{
+				Channel:    "trade",
+				Exchange:   trade.Exchange,
+				Market:     trade.MktCommitName,
+				Base:       trade.Base,
+				Quote:      trade.Quote,
+				TradeID:    trade.TradeID,
+				Side:       trade.Side,
+				Size:       trade.Size,
+				Price:      trade.Price,
+				PriceUSD:   trade.PriceUSD,
+				BadTick:    trade.IsBadTick,
+				BuyerMaker: trade.IsBuyerMaker,
+				Timestamp:  trade.Timestamp,
+				CreatedAt:  now,
+			}
+		}
+		recs[trade.Exchange] = append(recs[trade.Exchange], rec)
+	}
+	for _, exchange := range exchanges {
+		if err := s.write(appCtx, exchange, "trade", new(parquetTrade), recs[exchange], now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write appends the records to the buffered object of the exchange channel.
+// If the object reached the maximum size, it is uploaded right away.
+func (s *S3) write(appCtx context.Context, exchange string, channel string, schema interface{}, recs []interface{}, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if appCtx.Err() != nil {
+		return appCtx.Err()
+	}
+	key := exchange + "/" + channel
+	obj := s.objects[key]
+	if obj == nil {
+		obj = &s3Object{
+			exchange: exchange,
+			channel:  channel,
+			period:   s.period(now),
+			openedAt: now,
+		}
+		if s.Cfg.Format == "parquet" {
+			pw, err := writer.NewParquetWriterFromWriter(&obj.buf, schema, 1)
+			if err != nil {
+				return err
+			}
+			pw.CompressionType = parquet.CompressionCodec_SNAPPY
+			obj.pw = pw
+		} else {
+			obj.gz = gzip.NewWriter(&obj.buf)
+		}
+		s.objects[key] = obj
+	}
+	for _, rec := range recs {
+		if obj.pw != nil {
+			if err := obj.pw.Write(rec); err != nil {
+				return err
+			}
+			continue
+		}
+		line, err := jsoniter.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+		if _, err = obj.gz.Write(line); err != nil {
+			return err
+		}
+	}
+	if s.Cfg.MaxObjectSizeMB > 0 {
+		size := int64(obj.buf.Len())
+		if obj.pw != nil {
+			size += obj.pw.ObjsSize
+		}
+		if size >= int64(s.Cfg.MaxObjectSizeMB)*1024*1024 {
+			delete(s.objects, key)
+			return s.upload(appCtx, obj)
+		}
+	}
+	return nil
+}
+
+// period returns the start of the upload interval of the time.
+func (s *S3) period(now time.Time) time.Time {
+	interval := s.Cfg.UploadIntervalMin
+	if interval == 0 {
+		interval = s3UploadIntervalMin
+	}
+	return now.Truncate(time.Duration(interval) * time.Minute)
+}
+
+// Serve uploads the buffered objects once their upload interval is over.
+// It is checked every few seconds, so the objects are uploaded shortly after the interval ends
+// even if there is no new data.
+func (s *S3) Serve(appCtx context.Context) error {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			period := s.period(time.Now().UTC())
+			s.mu.Lock()
+			for key, obj := range s.objects {
+				if obj.period.Equal(period) {
+					continue
+				}
+				delete(s.objects, key)
+				if err := s.upload(appCtx, obj); err != nil {
+					s.mu.Unlock()
+					return err
+				}
+			}
+			s.mu.Unlock()
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+	}
+}
+
+// upload finishes the object and uploads it under the key layout.
+// Uploader sends the object in parts, if it is larger than the part size,
+// and retries the failed requests up to the configured max retries.
+func (s *S3) upload(appCtx context.Context, obj *s3Object) error {
+	ext := ".jsonl.gz"
+	contentType := "application/x-ndjson"
+	if obj.pw != nil {
+		if err := obj.pw.WriteStop(); err != nil {
+			return err
+		}
+		ext = ".parquet"
+		contentType = "application/vnd.apache.parquet"
+	} else if err := obj.gz.Close(); err != nil {
+		return err
+	}
+	layout := s.Cfg.Layout
+	if layout == "" {
+		layout = s3Layout
+	}
+	key := strings.NewReplacer(
+		"{exchange}", obj.exchange,
+		"{channel}", obj.channel,
+		"{date}", obj.period.Format("2006-01-02"),
+		"{hour}", obj.period.Format("15"),
+	).Replace(layout)
+	key = strings.Trim(s.Cfg.Prefix+"/"+key, "/") + "/" + obj.exchange + "_" + obj.channel + "_" + obj.openedAt.Format("20060102T150405") + ext
+	input := &s3manager.UploadInput{
+		Bucket:      aws.String(s.Cfg.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(obj.buf.Bytes()),
+		ContentType: aws.String(contentType),
+	}
+
+	var ctx context.Context
+	if s.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(s.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = appCtx
+	}
+	_, err := s.uploader.UploadWithContext(ctx, input)
+	return err
+}
+
+// Close uploads all the buffered objects.
+// It is called at the app exit, so the context passed is not the cancelled app context.
+func (s *S3) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var closeErr error
+	for key, obj := range s.objects {
+		delete(s.objects, key)
+		if err := s.upload(ctx, obj); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
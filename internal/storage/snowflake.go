@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	sf "github.com/snowflakedb/gosnowflake"
+)
+
+// Snowflake is for connecting and inserting data to snowflake warehouse.
+type Snowflake struct {
+	DB  *sql.DB
+	Cfg *config.Snowflake
+}
+
+var snowflake Snowflake
+
+// Timestamps are written as text, which snowflake converts to the column type on copy.
+const snowflakeTimestamp = "2006-01-02 15:04:05.999999"
+
+// snowflakeFileSeq is the sequence of the files uploaded to the table stages.
+var snowflakeFileSeq uint64
+
+// snowflakeTables are the tables created while connecting, if they do not exist already.
+var snowflakeTables = []string{
+	`CREATE TABLE IF NOT EXISTS ticker (
+		exchange varchar(32) NOT NULL,
+		market varchar(32) NOT NULL,
+		base varchar(16) NOT NULL,
+		quote varchar(16) NOT NULL,
+		price double NOT NULL,
+		best_bid double NOT NULL,
+		best_ask double NOT NULL,
+		volume double NOT NULL,
+		high double NOT NULL,
+		low double NOT NULL,
+		price_usd double NOT NULL,
+		is_bad_tick boolean NOT NULL,
+		timestamp timestamp_ntz NOT NULL,
+		created_at timestamp_ntz NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS trade (
+		exchange varchar(32) NOT NULL,
+		market varchar(32) NOT NULL,
+		base varchar(16) NOT NULL,
+		quote varchar(16) NOT NULL,
+		trade_id varchar(64) NOT NULL,
+		side varchar(8) NOT NULL,
+		size double NOT NULL,
+		price double NOT NULL,
+		is_buyer_maker boolean NOT NULL,
+		price_usd double NOT NULL,
+		is_bad_tick boolean NOT NULL,
+		timestamp timestamp_ntz NOT NULL,
+		created_at timestamp_ntz NOT NULL
+	)`,
+}
+
+// InitSnowflake initializes snowflake connection with configured values
+// and creates the ticker and trade tables, if they do not exist already.
+func InitSnowflake(cfg *config.Snowflake) (*Snowflake, error) {
+	if snowflake.DB == nil {
+		dsn, err := sf.DSN(&sf.Config{
+			Account:     cfg.Account,
+			User:        cfg.User,
+			Password:    cfg.Password,
+			Database:    cfg.Database,
+			Schema:      cfg.Schema,
+			Warehouse:   cfg.Warehouse,
+			Role:        cfg.Role,
+			Application: "cryptogalaxy",
+		})
+		if err != nil {
+			return nil, err
+		}
+		db, err := sql.Open("snowflake", dsn)
+		if err != nil {
+			return nil, err
+		}
+
+		var ctx context.Context
+		if cfg.ReqTimeoutSec > 0 {
+			timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReqTimeoutSec)*time.Second)
+			ctx = timeoutCtx
+			defer cancel()
+		} else {
+			ctx = context.Background()
+		}
+		err = db.PingContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range snowflakeTables {
+			if _, err = db.ExecContext(ctx, table); err != nil {
+				return nil, err
+			}
+		}
+		snowflake = Snowflake{
+			DB:  db,
+			Cfg: cfg,
+		}
+	}
+	return &snowflake, nil
+}
+
+// GetSnowflake returns already prepared snowflake instance.
+func GetSnowflake() *Snowflake {
+	return &snowflake
+}
+
+// CommitTickers batch inserts input ticker data to snowflake.
+// Batch is uploaded as a csv file to the stage of the table and copied into it.
+func (s *Snowflake) CommitTickers(appCtx context.Context, data []Ticker) error {
+	rows := make([][]string, len(data))
+	now := time.Now().UTC().Format(snowflakeTimestamp)
+	for i, ticker := range data {
+		rows[i] = []string{
+			ticker.Exchange,
+			ticker.MktCommitName,
+			ticker.Base,
+			ticker.Quote,
+			strconv.FormatFloat(ticker.Price, 'f', -1, 64),
+			strconv.FormatFloat(ticker.BestBid, 'f', -1, 64),
+			strconv.FormatFloat(ticker.BestAsk, 'f', -1, 64),
+			strconv.FormatFloat(ticker.Volume, 'f', -1, 64),
+			strconv.FormatFloat(ticker.High, 'f', -1, 64),
+			strconv.FormatFloat(ticker.Low, 'f', -1, 64),
+			strconv.FormatFloat(ticker.PriceUSD, 'f', -1, 64),
+			strconv.FormatBool(ticker.IsBadTick),
+			ticker.Timestamp.UTC().Format(snowflakeTimestamp),
+			now,
+		}
+	}
+	return s.copyInto(appCtx, "ticker", "exchange, market, base, quote, price, best_bid, best_ask, volume, high, low, price_usd, is_bad_tick, timestamp, created_at", rows)
+}
+
+// CommitTrades batch inserts input trade data to snowflake.
+// Batch is uploaded as a csv file to the stage of the table and copied into it, same as tickers.
+func (s *Snowflake) CommitTrades(appCtx context.Context, data []Trade) error {
+	rows := make([][]string, len(data))
+	now := time.Now().UTC().Format(snowflakeTimestamp)
+	for i, trade := range data {
+		rows[i] = []string{
+			trade.Exchange,
+			trade.MktCommitName,
+			trade.Base,
+			trade.Quote,
+			trade.TradeID,
+			trade.Side,
+			strconv.FormatFloat(trade.Size, 'f', -1, 64),
+			strconv.FormatFloat(trade.Price, 'f', -1, 64),
+			strconv.FormatBool(trade.IsBuyerMaker),
+			strconv.FormatFloat(trade.PriceUSD, 'f', -1, 64),
+			strconv.FormatBool(trade.IsBadTick),
+			trade.Timestamp.UTC().Format(snowflakeTimestamp),
+			now,
+		}
+	}
+	return s.copyInto(appCtx, "trade", "exchange, market, base, quote, trade_id, side, size, price, is_buyer_maker, price_usd, is_bad_tick, timestamp, created_at", rows)
+}
+
+// copyInto uploads the rows as a gzipped csv file to the table stage and copies it into the table.
+// File is given a unique name, as the commit workers upload to the same stage concurrently,
+// and it is purged from the stage once copied. A file left by a failed copy is not copied again by the later ones,
+// which copy only their own file.
+func (s *Snowflake) copyInto(appCtx context.Context, table string, cols string, rows [][]string) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := csv.NewWriter(gz)
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	file := fmt.Sprintf("%s_%d_%d.csv.gz", table, time.Now().UnixNano(), atomic.AddUint64(&snowflakeFileSeq, 1))
+
+	var ctx context.Context
+	if s.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(s.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = appCtx
+	}
+
+	// Path of the PUT command is only used as the name of the file, which is read from the stream.
+	put := fmt.Sprintf("PUT 'file:///tmp/%s' @%%%s SOURCE_COMPRESSION=GZIP AUTO_COMPRESS=FALSE", file, table)
+	if _, err := s.DB.ExecContext(sf.WithFileStream(ctx, &buf), put); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(ctx, fmt.Sprintf("COPY INTO %s(%s) FROM @%%%s FILES=('%s') FILE_FORMAT=(TYPE=CSV FIELD_OPTIONALLY_ENCLOSED_BY='\"') PURGE=TRUE", table, cols, table, file))
+	return err
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	// SQLite driver is a pure go translation of the database engine, so the app can still be built without cgo.
+	_ "modernc.org/sqlite"
+)
+
+// SQLite is for connecting and inserting data to sqlite database file.
+type SQLite struct {
+	DB  *sql.DB
+	Cfg *config.SQLite
+}
+
+var sqlite SQLite
+
+// sqliteTables are the tables created while connecting, if they do not exist already.
+var sqliteTables = []string{
+	`CREATE TABLE IF NOT EXISTS ticker (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		exchange TEXT NOT NULL,
+		market TEXT NOT NULL,
+		base TEXT NOT NULL,
+		quote TEXT NOT NULL,
+		price REAL NOT NULL,
+		best_bid REAL NOT NULL,
+		best_ask REAL NOT NULL,
+		volume REAL NOT NULL,
+		high REAL NOT NULL,
+		low REAL NOT NULL,
+		price_usd REAL NOT NULL,
+		is_bad_tick INTEGER NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS trade (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		exchange TEXT NOT NULL,
+		market TEXT NOT NULL,
+		base TEXT NOT NULL,
+		quote TEXT NOT NULL,
+		trade_id TEXT NOT NULL,
+		side TEXT NOT NULL,
+		size REAL NOT NULL,
+		price REAL NOT NULL,
+		is_buyer_maker INTEGER NOT NULL,
+		price_usd REAL NOT NULL,
+		is_bad_tick INTEGER NOT NULL,
+		timestamp TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+}
+
+// InitSQLite opens the sqlite database file in WAL mode with configured values
+// and creates the ticker and trade tables.
+func InitSQLite(cfg *config.SQLite) (*SQLite, error) {
+	if sqlite.DB == nil {
+		synchronous := cfg.Synchronous
+		if synchronous == "" {
+			synchronous = "NORMAL"
+		}
+		q := url.Values{}
+		q.Add("_pragma", "journal_mode(WAL)")
+		q.Add("_pragma", "synchronous("+synchronous+")")
+		q.Add("_pragma", "busy_timeout("+strconv.Itoa(cfg.ReqTimeoutSec*1000)+")")
+		q.Set("_time_format", "sqlite")
+		db, err := sql.Open("sqlite", "file:"+cfg.FilePath+"?"+q.Encode())
+		if err != nil {
+			return nil, err
+		}
+
+		// SQLite allows only one writer at a time, so a single connection avoids busy errors between
+		// the ticker and trade commits.
+		db.SetMaxOpenConns(1)
+
+		var ctx context.Context
+		if cfg.ReqTimeoutSec > 0 {
+			timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReqTimeoutSec)*time.Second)
+			ctx = timeoutCtx
+			defer cancel()
+		} else {
+			ctx = context.Background()
+		}
+		err = db.PingContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range sqliteTables {
+			if _, err = db.ExecContext(ctx, table); err != nil {
+				return nil, err
+			}
+		}
+		sqlite = SQLite{
+			DB:  db,
+			Cfg: cfg,
+		}
+	}
+	return &sqlite, nil
+}
+
+// GetSQLite returns already prepared sqlite instance.
+func GetSQLite() *SQLite {
+	return &sqlite
+}
+
+// CommitTickers batch inserts input ticker data to sqlite in a single transaction.
+func (s *SQLite) CommitTickers(appCtx context.Context, data []Ticker) error {
+	ctx, cancel := s.ctx(appCtx)
+	defer cancel()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO ticker(exchange, market, base, quote, price, best_bid, best_ask, volume, high, low, price_usd, is_bad_tick, timestamp, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	now := time.Now().UTC()
+	for _, ticker := range data {
+		_, err = stmt.ExecContext(ctx, ticker.Exchange, ticker.MktCommitName, ticker.Base, ticker.Quote, ticker.Price, ticker.BestBid, ticker.BestAsk, ticker.Volume, ticker.High, ticker.Low, ticker.PriceUSD, ticker.IsBadTick, ticker.Timestamp.UTC(), now)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CommitTrades batch inserts input trade data to sqlite in a single transaction.
+func (s *SQLite) CommitTrades(appCtx context.Context, data []Trade) error {
+	ctx, cancel := s.ctx(appCtx)
+	defer cancel()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO trade(exchange, market, base, quote, trade_id, side, size, price, is_buyer_maker, price_usd, is_bad_tick, timestamp, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	now := time.Now().UTC()
+	for _, trade := range data {
+		_, err = stmt.ExecContext(ctx, trade.Exchange, trade.MktCommitName, trade.Base, trade.Quote, trade.TradeID, trade.Side, trade.Size, trade.Price, trade.IsBuyerMaker, trade.PriceUSD, trade.IsBadTick, trade.Timestamp.UTC(), now)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// sqlitePruneBatch is the number of rows deleted in a transaction for the retention,
+// so that the commits are not blocked for long by the single writer lock.
+const sqlitePruneBatch = 10000
+
+// Prune deletes the rows of the channel table older than the given time, in batches.
+// Only ticker and trade tables exist in sqlite.
+func (s *SQLite) Prune(ctx context.Context, channel string, before time.Time) error {
+	if channel != "ticker" && channel != "trade" {
+		return fmt.Errorf("no sqlite table for %s channel", channel)
+	}
+	query := "DELETE FROM " + channel + " WHERE id IN (SELECT id FROM " + channel + " WHERE timestamp < ? LIMIT " + strconv.Itoa(sqlitePruneBatch) + ")"
+	for {
+		res, err := s.DB.ExecContext(ctx, query, before.UTC())
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n < sqlitePruneBatch {
+			return nil
+		}
+	}
+}
+
+// ctx returns the context for the insert with the configured timeout.
+func (s *SQLite) ctx(appCtx context.Context) (context.Context, context.CancelFunc) {
+	if s.Cfg.ReqTimeoutSec > 0 {
+		return context.WithTimeout(appCtx, time.Duration(s.Cfg.ReqTimeoutSec)*time.Second)
+	}
+	return context.WithCancel(context.Background())
+}
@@ -11,6 +11,15 @@ type Ticker struct {
 	MktID         string
 	MktCommitName string
 	Price         float64
+	BestBid       float64
+	BestAsk       float64
+	Volume        float64
+	High          float64
+	Low           float64
+	Base          string
+	Quote         string
+	PriceUSD      float64
+	IsBadTick     bool
 	Timestamp     time.Time
 }
 
@@ -24,5 +33,163 @@ type Trade struct {
 	Side          string
 	Size          float64
 	Price         float64
+	IsBuyerMaker  bool
+	Base          string
+	Quote         string
+	PriceUSD      float64
+	IsBadTick     bool
+	Timestamp     time.Time
+}
+
+// MarkPrice represents final form of market mark price info received from exchange
+// ready to store.
+type MarkPrice struct {
+	Exchange      string
+	MktID         string
+	MktCommitName string
+	MarkPrice     float64
+	IndexPrice    float64
+	Basis         float64
+	Timestamp     time.Time
+}
+
+// BBO represents final form of market best bid and offer info received from exchange
+// ready to store.
+type BBO struct {
+	Exchange      string
+	MktID         string
+	MktCommitName string
+	BidPrice      float64
+	BidSize       float64
+	AskPrice      float64
+	AskSize       float64
+	Timestamp     time.Time
+}
+
+// TradingStatus represents final form of market trading status change received from exchange
+// ready to store.
+type TradingStatus struct {
+	Exchange      string
+	MktID         string
+	MktCommitName string
+	Status        string
+	Timestamp     time.Time
+}
+
+// Candle represents final form of OHLCV candle built from the trades of the market
+// ready to store.
+type Candle struct {
+	Exchange      string
+	MktID         string
+	MktCommitName string
+	Interval      string
+	Open          float64
+	High          float64
+	Low           float64
+	Close         float64
+	Volume        float64
+	Timestamp     time.Time
+}
+
+// AvgPrice represents final form of rolling volume weighted (VWAP) and time weighted (TWAP) average prices
+// calculated from the trades of the market ready to store.
+type AvgPrice struct {
+	Exchange      string
+	MktID         string
+	MktCommitName string
+	Window        string
+	VWAP          float64
+	TWAP          float64
+	Timestamp     time.Time
+}
+
+// MarketStats represents final form of trade count, buy volume, sell volume and notional (price * size)
+// aggregated from the trades of the market over an interval ready to store.
+type MarketStats struct {
+	Exchange      string
+	MktID         string
+	MktCommitName string
+	Interval      string
+	TradeCount    int64
+	BuyVolume     float64
+	SellVolume    float64
+	Notional      float64
+	Timestamp     time.Time
+}
+
+// ArbitrageSpread represents final form of spread between the lowest and the highest price of a market
+// across exchanges, ready to store.
+type ArbitrageSpread struct {
+	Base          string
+	Quote         string
+	BuyExchange   string
+	BuyPrice      float64
+	SellExchange  string
+	SellPrice     float64
+	SpreadPercent float64
+	Timestamp     time.Time
+}
+
+// CoinInfo represents final form of coin reference data, market cap and circulating supply in USD terms, ready to store.
+type CoinInfo struct {
+	Base              string
+	CoinID            string
+	MarketCap         float64
+	Rank              int
+	CirculatingSupply float64
+	Timestamp         time.Time
+}
+
+// FXRate represents final form of fiat exchange rate, USD value of a unit of the currency, ready to store.
+type FXRate struct {
+	Currency  string
+	Rate      float64
+	Timestamp time.Time
+}
+
+// BookMetric represents final form of bid-ask spread, mid price and depth imbalance
+// calculated from the order book of the market up to the configured levels ready to store.
+type BookMetric struct {
+	Exchange      string
+	MktID         string
+	MktCommitName string
+	Levels        int
+	Spread        float64
+	MidPrice      float64
+	BidDepth      float64
+	AskDepth      float64
+	Imbalance     float64
+	Timestamp     time.Time
+}
+
+// Instrument represents final form of market metadata received from exchange
+// ready to store.
+type Instrument struct {
+	Exchange       string
+	MktID          string
+	MktCommitName  string
+	TickSize       float64
+	LotSize        float64
+	PricePrecision int
+	SizePrecision  int
+	Status         string
+	Timestamp      time.Time
+}
+
+// OrderFlow represents final form of market order level (L3) event received from exchange
+// ready to store.
+type OrderFlow struct {
+	Exchange      string
+	MktID         string
+	MktCommitName string
+	Event         string
+	OrderID       string
+	TakerOrderID  string
+	TradeID       string
+	Side          string
+	Size          float64
+	Price         float64
+	Reason        string
+	Sequence      uint64
 	Timestamp     time.Time
 }
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// TDengine is for connecting and inserting data to tdengine over its REST API.
+type TDengine struct {
+	Client *http.Client
+	Cfg    *config.TDengine
+
+	// lastTs is the last timestamp inserted to each sub table.
+	lastTs map[string]int64
+	mu     sync.Mutex
+}
+
+var tdengine TDengine
+
+// tdengineStables are the super tables created while connecting, if they do not exist already.
+// Each exchange market gets its own sub table, created automatically with the tags at first insert.
+var tdengineStables = []string{
+	"CREATE STABLE IF NOT EXISTS ticker (ts TIMESTAMP, price DOUBLE, best_bid DOUBLE, best_ask DOUBLE, volume DOUBLE, high DOUBLE, low DOUBLE, price_usd DOUBLE, is_bad_tick BOOL, created_at TIMESTAMP) TAGS (exchange BINARY(32), market BINARY(32), base BINARY(16), quote BINARY(16))",
+	"CREATE STABLE IF NOT EXISTS trade (ts TIMESTAMP, trade_id BINARY(64), side BINARY(8), size DOUBLE, price DOUBLE, is_buyer_maker BOOL, price_usd DOUBLE, is_bad_tick BOOL, created_at TIMESTAMP) TAGS (exchange BINARY(32), market BINARY(32), base BINARY(16), quote BINARY(16))",
+}
+
+// tdengineResp is the response of the REST API,
+// status is used by the version 2 and code by the version 3.
+type tdengineResp struct {
+	Status string `json:"status"`
+	Code   int    `json:"code"`
+	Desc   string `json:"desc"`
+}
+
+// tdengineMaxSQLLen is the size up to which the rows are sent in a single statement,
+// kept under the default max SQL length of the version 2.
+const tdengineMaxSQLLen = 64000
+
+// tdengineEscaper escapes the string values.
+var tdengineEscaper = strings.NewReplacer("\\", "\\\\", "'", "\\'")
+
+// InitTDengine initializes tdengine connection with configured values,
+// creates the database in microsecond precision and the super tables, if they do not exist already.
+func InitTDengine(cfg *config.TDengine) (*TDengine, error) {
+	if tdengine.Client == nil {
+		tdengine.Client = &http.Client{
+			Timeout: time.Duration(cfg.ReqTimeoutSec) * time.Second,
+		}
+		tdengine.Cfg = cfg
+		tdengine.lastTs = make(map[string]int64)
+		ctx := context.Background()
+		err := tdengine.exec(ctx, "CREATE DATABASE IF NOT EXISTS "+cfg.Database+" PRECISION 'us'")
+		for i := 0; err == nil && i < len(tdengineStables); i++ {
+			err = tdengine.exec(ctx, strings.Replace(tdengineStables[i], "EXISTS ", "EXISTS "+cfg.Database+".", 1))
+		}
+		if err != nil {
+			tdengine.Client = nil
+			return nil, err
+		}
+	}
+	return &tdengine, nil
+}
+
+// GetTDengine returns already prepared tdengine instance.
+func GetTDengine() *TDengine {
+	return &tdengine
+}
+
+// CommitTickers batch inserts input ticker data to tdengine, rows of all the sub tables together.
+func (t *TDengine) CommitTickers(appCtx context.Context, data []Ticker) error {
+	rows := make([]string, 0, len(data))
+	now := time.Now().UnixNano() / int64(time.Microsecond)
+	t.mu.Lock()
+	for _, ticker := range data {
+		table := t.table("ticker", ticker.Exchange, ticker.MktCommitName)
+		rows = append(rows, fmt.Sprintf(" %s USING %s.ticker TAGS ('%s', '%s', '%s', '%s') VALUES (%d, %v, %v, %v, %v, %v, %v, %v, %v, %d)",
+			table, t.Cfg.Database, tdengineEscaper.Replace(ticker.Exchange), tdengineEscaper.Replace(ticker.MktCommitName), tdengineEscaper.Replace(ticker.Base), tdengineEscaper.Replace(ticker.Quote),
+			t.ts(table, ticker.Timestamp), ticker.Price, ticker.BestBid, ticker.BestAsk, ticker.Volume, ticker.High, ticker.Low, ticker.PriceUSD, ticker.IsBadTick, now))
+	}
+	t.mu.Unlock()
+	return t.insert(appCtx, rows)
+}
+
+// CommitTrades batch inserts input trade data to tdengine, rows of all the sub tables together.
+func (t *TDengine) CommitTrades(appCtx context.Context, data []Trade) error {
+	rows := make([]string, 0, len(data))
+	now := time.Now().UnixNano() / int64(time.Microsecond)
+	t.mu.Lock()
+	for _, trade := range data {
+		table := t.table("trade", trade.Exchange, trade.MktCommitName)
+		rows = append(rows, fmt.Sprintf(" %s USING %s.trade TAGS ('%s', '%s', '%s', '%s') VALUES (%d, '%s', '%s', %v, %v, %v, %v, %v, %d)",
+			table, t.Cfg.Database, tdengineEscaper.Replace(trade.Exchange), tdengineEscaper.Replace(trade.MktCommitName), tdengineEscaper.Replace(trade.Base), tdengineEscaper.Replace(trade.Quote),
+			t.ts(table, trade.Timestamp), tdengineEscaper.Replace(trade.TradeID), tdengineEscaper.Replace(trade.Side), trade.Size, trade.Price, trade.IsBuyerMaker, trade.PriceUSD, trade.IsBadTick, now))
+	}
+	t.mu.Unlock()
+	return t.insert(appCtx, rows)
+}
+
+// insert sends the rows in as few statements as the max SQL length allows.
+func (t *TDengine) insert(appCtx context.Context, rows []string) error {
+	var sb strings.Builder
+	for _, row := range rows {
+		if sb.Len() > 0 && sb.Len()+len(row) > tdengineMaxSQLLen {
+			if err := t.exec(appCtx, sb.String()); err != nil {
+				return err
+			}
+			sb.Reset()
+		}
+		if sb.Len() == 0 {
+			sb.WriteString("INSERT INTO")
+		}
+		sb.WriteString(row)
+	}
+	if sb.Len() > 0 {
+		return t.exec(appCtx, sb.String())
+	}
+	return nil
+}
+
+// table returns the sub table name of the exchange market, qualified with the database.
+func (t *TDengine) table(channel string, exchange string, market string) string {
+	name := []byte(channel + "_" + exchange + "_" + market)
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '_':
+		case c >= 'A' && c <= 'Z':
+			name[i] = c + 'a' - 'A'
+		default:
+			name[i] = '_'
+		}
+	}
+	return t.Cfg.Database + "." + string(name)
+}
+
+// ts returns the timestamp in microseconds for the sub table.
+// Timestamp is the primary key of a sub table in tdengine, so rows with the same timestamp would overwrite each other,
+// which is common for trades in exchange milliseconds. To keep all of them, a timestamp not after the last one
+// of the sub table is moved to a microsecond after it.
+func (t *TDengine) ts(table string, timestamp time.Time) int64 {
+	ts := timestamp.UnixNano() / int64(time.Microsecond)
+	if last, ok := t.lastTs[table]; ok && ts <= last {
+		ts = last + 1
+	}
+	t.lastTs[table] = ts
+	return ts
+}
+
+// exec sends the SQL statement to REST API.
+func (t *TDengine) exec(ctx context.Context, sql string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(t.Cfg.URL, "/")+"/rest/sql", bytes.NewBufferString(sql))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.Cfg.User, t.Cfg.Password)
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var tr tdengineResp
+	if err = jsoniter.Unmarshal(body, &tr); err != nil {
+		return fmt.Errorf("tdengine : status %d, %s", resp.StatusCode, string(body))
+	}
+	if tr.Status == "error" || tr.Code != 0 || resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("tdengine : status %d, code %d, %s", resp.StatusCode, tr.Code, tr.Desc)
+	}
+	return nil
+}
@@ -1,13 +1,18 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"sync"
 )
 
 // Terminal is for displaying data on terminal.
 type Terminal struct {
-	out io.Writer
+	out   io.Writer
+	tui   *terminalTUI
+	jsonl bool
+	mu    sync.Mutex
 }
 
 var terminal Terminal
@@ -32,15 +37,294 @@ func GetTerminal() *Terminal {
 }
 
 // CommitTickers batch outputs input ticker data to terminal.
-func (t *Terminal) CommitTickers(data []Ticker) {
+// It never fails, error is returned only to satisfy the Storage interface.
+func (t *Terminal) CommitTickers(_ context.Context, data []Ticker) error {
+	if t.jsonl {
+		t.commitTickersJSONL(data)
+		return nil
+	}
+	if t.tui != nil {
+		t.tui.recordTickers(data)
+		return nil
+	}
 	for _, ticker := range data {
-		fmt.Fprintf(t.out, "%-15s%-15s%-15s%20f%20s\n\n", "Ticker", ticker.Exchange, ticker.MktCommitName, ticker.Price, ticker.Timestamp.Local().Format(TerminalTimestamp))
+		fmt.Fprintf(t.out, "%-15s%-15s%-15s%20f%20f%20f%20f%20f%20f%20s\n\n", "Ticker", ticker.Exchange, ticker.MktCommitName, ticker.Price, ticker.BestBid, ticker.BestAsk, ticker.Volume, ticker.High, ticker.Low, ticker.Timestamp.Local().Format(TerminalTimestamp))
 	}
+	return nil
 }
 
 // CommitTrades batch outputs input trade data to terminal.
-func (t *Terminal) CommitTrades(data []Trade) {
+// It never fails, error is returned only to satisfy the Storage interface.
+func (t *Terminal) CommitTrades(_ context.Context, data []Trade) error {
+	if t.jsonl {
+		t.commitTradesJSONL(data)
+		return nil
+	}
+	if t.tui != nil {
+		t.tui.recordTrades(data)
+		return nil
+	}
 	for _, trade := range data {
 		fmt.Fprintf(t.out, "%-15s%-15s%-5s%20f%20f%20s\n\n", "Trade", trade.Exchange, trade.MktCommitName, trade.Size, trade.Price, trade.Timestamp.Local().Format(TerminalTimestamp))
 	}
+	return nil
+}
+
+// CommitMarkPrices batch outputs input mark price data to terminal.
+// It never fails, error is returned only to satisfy the committer interface.
+func (t *Terminal) CommitMarkPrices(_ context.Context, data []MarkPrice) error {
+	if t.jsonl {
+		t.commitMarkPricesJSONL(data)
+		return nil
+	}
+	if t.tui != nil {
+		for _, markPrice := range data {
+			t.tui.record(markPrice.Exchange, markPrice.MktCommitName, nil)
+		}
+		return nil
+	}
+	for _, markPrice := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-15s%20f%20f%20f%20s\n\n", "MarkPrice", markPrice.Exchange, markPrice.MktCommitName, markPrice.MarkPrice, markPrice.IndexPrice, markPrice.Basis, markPrice.Timestamp.Local().Format(TerminalTimestamp))
+	}
+	return nil
+}
+
+// CommitBBOs batch outputs input best bid and offer data to terminal.
+// It never fails, error is returned only to satisfy the committer interface.
+func (t *Terminal) CommitBBOs(_ context.Context, data []BBO) error {
+	if t.jsonl {
+		t.commitBBOsJSONL(data)
+		return nil
+	}
+	if t.tui != nil {
+		for _, bbo := range data {
+			t.tui.record(bbo.Exchange, bbo.MktCommitName, nil)
+		}
+		return nil
+	}
+	for _, bbo := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-15s%20f%20f%20f%20f%20s\n\n", "BBO", bbo.Exchange, bbo.MktCommitName, bbo.BidPrice, bbo.BidSize, bbo.AskPrice, bbo.AskSize, bbo.Timestamp.Local().Format(TerminalTimestamp))
+	}
+	return nil
+}
+
+// CommitBlockTrades batch outputs input block trade data to terminal.
+// It never fails, error is returned only to satisfy the committer interface.
+func (t *Terminal) CommitBlockTrades(_ context.Context, data []Trade) error {
+	if t.jsonl {
+		t.commitBlockTradesJSONL(data)
+		return nil
+	}
+	if t.tui != nil {
+		for _, trade := range data {
+			t.tui.record(trade.Exchange, trade.MktCommitName, nil)
+		}
+		return nil
+	}
+	for _, trade := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-5s%20f%20f%20s\n\n", "BlockTrade", trade.Exchange, trade.MktCommitName, trade.Size, trade.Price, trade.Timestamp.Local().Format(TerminalTimestamp))
+	}
+	return nil
+}
+
+// CommitTradingStatuses batch outputs input trading status data to terminal.
+// It never fails, error is returned only to satisfy the committer interface.
+func (t *Terminal) CommitTradingStatuses(_ context.Context, data []TradingStatus) error {
+	if t.jsonl {
+		t.commitTradingStatusesJSONL(data)
+		return nil
+	}
+	if t.tui != nil {
+		for _, tradingStatus := range data {
+			t.tui.record(tradingStatus.Exchange, tradingStatus.MktCommitName, nil)
+		}
+		return nil
+	}
+	for _, tradingStatus := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-15s%20s%20s\n\n", "TradingStatus", tradingStatus.Exchange, tradingStatus.MktCommitName, tradingStatus.Status, tradingStatus.Timestamp.Local().Format(TerminalTimestamp))
+	}
+	return nil
+}
+
+// CommitAggTrades batch outputs input aggregated trade data to terminal.
+// It never fails, error is returned only to satisfy the committer interface.
+func (t *Terminal) CommitAggTrades(_ context.Context, data []Trade) error {
+	if t.jsonl {
+		t.commitAggTradesJSONL(data)
+		return nil
+	}
+	if t.tui != nil {
+		for _, trade := range data {
+			t.tui.record(trade.Exchange, trade.MktCommitName, nil)
+		}
+		return nil
+	}
+	for _, trade := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-5s%20f%20f%20s\n\n", "AggTrade", trade.Exchange, trade.MktCommitName, trade.Size, trade.Price, trade.Timestamp.Local().Format(TerminalTimestamp))
+	}
+	return nil
+}
+
+// CommitOrderFlows batch outputs input order flow data to terminal.
+// It never fails, error is returned only to satisfy the committer interface.
+func (t *Terminal) CommitOrderFlows(_ context.Context, data []OrderFlow) error {
+	if t.jsonl {
+		t.commitOrderFlowsJSONL(data)
+		return nil
+	}
+	if t.tui != nil {
+		for _, orderFlow := range data {
+			t.tui.record(orderFlow.Exchange, orderFlow.MktCommitName, nil)
+		}
+		return nil
+	}
+	for _, orderFlow := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-15s%-10s%40s%20f%20f%20s\n\n", "OrderFlow", orderFlow.Exchange, orderFlow.MktCommitName, orderFlow.Event, orderFlow.OrderID, orderFlow.Size, orderFlow.Price, orderFlow.Timestamp.Local().Format(TerminalTimestamp))
+	}
+	return nil
+}
+
+// CommitInstruments batch outputs input instrument data to terminal.
+// It never fails, error is returned only to satisfy the committer interface.
+func (t *Terminal) CommitInstruments(_ context.Context, data []Instrument) error {
+	if t.jsonl {
+		t.commitInstrumentsJSONL(data)
+		return nil
+	}
+	if t.tui != nil {
+		for _, instrument := range data {
+			t.tui.record(instrument.Exchange, instrument.MktCommitName, nil)
+		}
+		return nil
+	}
+	for _, instrument := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-15s%20f%20f%10d%10d%20s%20s\n\n", "Instrument", instrument.Exchange, instrument.MktCommitName, instrument.TickSize, instrument.LotSize, instrument.PricePrecision, instrument.SizePrecision, instrument.Status, instrument.Timestamp.Local().Format(TerminalTimestamp))
+	}
+	return nil
+}
+
+// CommitCandles batch outputs input candle data to terminal.
+// It never fails, error is returned only to satisfy the committer interface.
+func (t *Terminal) CommitCandles(_ context.Context, data []Candle) error {
+	if t.jsonl {
+		t.commitCandlesJSONL(data)
+		return nil
+	}
+	if t.tui != nil {
+		for _, candle := range data {
+			t.tui.record(candle.Exchange, candle.MktCommitName, nil)
+		}
+		return nil
+	}
+	for _, candle := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-15s%-5s%20f%20f%20f%20f%20f%20s\n\n", "Candle", candle.Exchange, candle.MktCommitName, candle.Interval, candle.Open, candle.High, candle.Low, candle.Close, candle.Volume, candle.Timestamp.Local().Format(TerminalTimestamp))
+	}
+	return nil
+}
+
+// CommitAvgPrices batch outputs input average price data to terminal.
+// It never fails, error is returned only to satisfy the committer interface.
+func (t *Terminal) CommitAvgPrices(_ context.Context, data []AvgPrice) error {
+	if t.jsonl {
+		t.commitAvgPricesJSONL(data)
+		return nil
+	}
+	if t.tui != nil {
+		for _, avgPrice := range data {
+			t.tui.record(avgPrice.Exchange, avgPrice.MktCommitName, nil)
+		}
+		return nil
+	}
+	for _, avgPrice := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-15s%-5s%20f%20f%20s\n\n", "AvgPrice", avgPrice.Exchange, avgPrice.MktCommitName, avgPrice.Window, avgPrice.VWAP, avgPrice.TWAP, avgPrice.Timestamp.Local().Format(TerminalTimestamp))
+	}
+	return nil
+}
+
+// CommitBookMetrics batch outputs input book metric data to terminal.
+// It never fails, error is returned only to satisfy the committer interface.
+func (t *Terminal) CommitBookMetrics(_ context.Context, data []BookMetric) error {
+	if t.jsonl {
+		t.commitBookMetricsJSONL(data)
+		return nil
+	}
+	if t.tui != nil {
+		for _, bookMetric := range data {
+			t.tui.record(bookMetric.Exchange, bookMetric.MktCommitName, nil)
+		}
+		return nil
+	}
+	for _, bookMetric := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-15s%5d%20f%20f%20f%20f%20f%20s\n\n", "BookMetric", bookMetric.Exchange, bookMetric.MktCommitName, bookMetric.Levels, bookMetric.Spread, bookMetric.MidPrice, bookMetric.BidDepth, bookMetric.AskDepth, bookMetric.Imbalance, bookMetric.Timestamp.Local().Format(TerminalTimestamp))
+	}
+	return nil
+}
+
+// CommitMarketStats batch outputs input market stats data to terminal.
+// It never fails, error is returned only to satisfy the committer interface.
+func (t *Terminal) CommitMarketStats(_ context.Context, data []MarketStats) error {
+	if t.jsonl {
+		t.commitMarketStatsJSONL(data)
+		return nil
+	}
+	if t.tui != nil {
+		for _, marketStats := range data {
+			t.tui.record(marketStats.Exchange, marketStats.MktCommitName, nil)
+		}
+		return nil
+	}
+	for _, marketStats := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-15s%-5s%10d%20f%20f%20f%20s\n\n", "MarketStats", marketStats.Exchange, marketStats.MktCommitName, marketStats.Interval, marketStats.TradeCount, marketStats.BuyVolume, marketStats.SellVolume, marketStats.Notional, marketStats.Timestamp.Local().Format(TerminalTimestamp))
+	}
+	return nil
+}
+
+// CommitFXRates batch outputs input fx rate data to terminal.
+func (t *Terminal) CommitFXRates(data []FXRate) {
+	if t.jsonl {
+		t.commitFXRatesJSONL(data)
+		return
+	}
+	if t.tui != nil {
+		for i := range data {
+			fxRate := &data[i]
+			t.tui.record("fx", fxRate.Currency+"/USD", func(row *terminalRow) {
+				row.price = fxRate.Rate
+			})
+		}
+		return
+	}
+	for _, fxRate := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-15s%20f%20s\n\n", "FXRate", "fx", fxRate.Currency+"/USD", fxRate.Rate, fxRate.Timestamp.Local().Format(TerminalTimestamp))
+	}
+}
+
+// CommitCoinInfos batch outputs input coin info data to terminal.
+// It is not shown in the TUI, as it is not of any market.
+func (t *Terminal) CommitCoinInfos(data []CoinInfo) {
+	if t.jsonl {
+		t.commitCoinInfosJSONL(data)
+		return
+	}
+	if t.tui != nil {
+		return
+	}
+	for _, coinInfo := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-15s%20f%5d%20f%20s\n\n", "CoinInfo", coinInfo.Base, coinInfo.CoinID, coinInfo.MarketCap, coinInfo.Rank, coinInfo.CirculatingSupply, coinInfo.Timestamp.Local().Format(TerminalTimestamp))
+	}
+}
+
+// CommitArbitrageSpreads batch outputs input arbitrage spread data to terminal.
+// It is not shown in the TUI, as it is not of any market.
+func (t *Terminal) CommitArbitrageSpreads(data []ArbitrageSpread) {
+	if t.jsonl {
+		t.commitArbitrageSpreadsJSONL(data)
+		return
+	}
+	if t.tui != nil {
+		return
+	}
+	for _, arbitrageSpread := range data {
+		fmt.Fprintf(t.out, "%-15s%-15s%-15s%20f%-15s%20f%20f%20s\n\n", "Arbitrage", arbitrageSpread.Base+"/"+arbitrageSpread.Quote, arbitrageSpread.BuyExchange, arbitrageSpread.BuyPrice, arbitrageSpread.SellExchange, arbitrageSpread.SellPrice, arbitrageSpread.SpreadPercent, arbitrageSpread.Timestamp.Local().Format(TerminalTimestamp))
+	}
 }
@@ -0,0 +1,369 @@
+package storage
+
+import (
+	"bytes"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// EnableJSONL switches the terminal to output a JSON record per line, in the same format as the unix domain socket one,
+// instead of the text, so that the output can be piped into jq or any other process, or shipped by a log agent.
+// It should be called before any data is committed.
+func (t *Terminal) EnableJSONL() {
+	t.jsonl = true
+}
+
+// write outputs the records at once, so that the lines of concurrent commits are never interleaved.
+// Output errors are ignored, same as the text output.
+func (t *Terminal) write(records []byte) {
+	t.mu.Lock()
+	_, _ = t.out.Write(records)
+	t.mu.Unlock()
+}
+
+// commitTickersJSONL outputs input ticker data to terminal as JSON lines.
+func (t *Terminal) commitTickersJSONL(data []Ticker) {
+	var buf bytes.Buffer
+	for _, ticker := range data {
+		td := esData{
+			Channel:   "ticker",
+			Exchange:  ticker.Exchange,
+			Market:    ticker.MktCommitName,
+			Base:      ticker.Base,
+			Quote:     ticker.Quote,
+			Price:     ticker.Price,
+			BestBid:   ticker.BestBid,
+			BestAsk:   ticker.BestAsk,
+			Volume:    ticker.Volume,
+			High:      ticker.High,
+			Low:       ticker.Low,
+			PriceUSD:  ticker.PriceUSD,
+			BadTick:   ticker.IsBadTick,
+			Timestamp: ticker.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitTradesJSONL outputs input trade data to terminal as JSON lines.
+func (t *Terminal) commitTradesJSONL(data []Trade) {
+	var buf bytes.Buffer
+	for _, trade := range data {
+		td := esData{
+			Channel:    "trade",
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			Base:       trade.Base,
+			Quote:      trade.Quote,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			BuyerMaker: trade.IsBuyerMaker,
+			PriceUSD:   trade.PriceUSD,
+			BadTick:    trade.IsBadTick,
+			Timestamp:  trade.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitMarkPricesJSONL outputs input mark price data to terminal as JSON lines.
+func (t *Terminal) commitMarkPricesJSONL(data []MarkPrice) {
+	var buf bytes.Buffer
+	for _, markPrice := range data {
+		td := esData{
+			Channel:    "mark_price",
+			Exchange:   markPrice.Exchange,
+			Market:     markPrice.MktCommitName,
+			MarkPrice:  markPrice.MarkPrice,
+			IndexPrice: markPrice.IndexPrice,
+			Basis:      markPrice.Basis,
+			Timestamp:  markPrice.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitBBOsJSONL outputs input best bid and offer data to terminal as JSON lines.
+func (t *Terminal) commitBBOsJSONL(data []BBO) {
+	var buf bytes.Buffer
+	for _, bbo := range data {
+		td := esData{
+			Channel:   "bbo",
+			Exchange:  bbo.Exchange,
+			Market:    bbo.MktCommitName,
+			BidPrice:  bbo.BidPrice,
+			BidSize:   bbo.BidSize,
+			AskPrice:  bbo.AskPrice,
+			AskSize:   bbo.AskSize,
+			Timestamp: bbo.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitBlockTradesJSONL outputs input block trade data to terminal as JSON lines.
+func (t *Terminal) commitBlockTradesJSONL(data []Trade) {
+	var buf bytes.Buffer
+	for _, trade := range data {
+		td := esData{
+			Channel:   "block_trade",
+			Exchange:  trade.Exchange,
+			Market:    trade.MktCommitName,
+			TradeID:   trade.TradeID,
+			Side:      trade.Side,
+			Size:      trade.Size,
+			Price:     trade.Price,
+			Timestamp: trade.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitTradingStatusesJSONL outputs input trading status data to terminal as JSON lines.
+func (t *Terminal) commitTradingStatusesJSONL(data []TradingStatus) {
+	var buf bytes.Buffer
+	for _, tradingStatus := range data {
+		td := esData{
+			Channel:   "trading_status",
+			Exchange:  tradingStatus.Exchange,
+			Market:    tradingStatus.MktCommitName,
+			Status:    tradingStatus.Status,
+			Timestamp: tradingStatus.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitAggTradesJSONL outputs input aggregated trade data to terminal as JSON lines.
+func (t *Terminal) commitAggTradesJSONL(data []Trade) {
+	var buf bytes.Buffer
+	for _, trade := range data {
+		td := esData{
+			Channel:    "agg_trade",
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			BuyerMaker: trade.IsBuyerMaker,
+			Timestamp:  trade.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitOrderFlowsJSONL outputs input order flow data to terminal as JSON lines.
+func (t *Terminal) commitOrderFlowsJSONL(data []OrderFlow) {
+	var buf bytes.Buffer
+	for _, orderFlow := range data {
+		td := esData{
+			Channel:      "orderflow",
+			Exchange:     orderFlow.Exchange,
+			Market:       orderFlow.MktCommitName,
+			Event:        orderFlow.Event,
+			OrderID:      orderFlow.OrderID,
+			TakerOrderID: orderFlow.TakerOrderID,
+			TradeID:      orderFlow.TradeID,
+			Side:         orderFlow.Side,
+			Size:         orderFlow.Size,
+			Price:        orderFlow.Price,
+			Reason:       orderFlow.Reason,
+			Sequence:     orderFlow.Sequence,
+			Timestamp:    orderFlow.Timestamp,
+			CreatedAt:    time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitInstrumentsJSONL outputs input instrument data to terminal as JSON lines.
+func (t *Terminal) commitInstrumentsJSONL(data []Instrument) {
+	var buf bytes.Buffer
+	for _, instrument := range data {
+		td := esData{
+			Channel:        "instrument",
+			Exchange:       instrument.Exchange,
+			Market:         instrument.MktCommitName,
+			TickSize:       instrument.TickSize,
+			LotSize:        instrument.LotSize,
+			PricePrecision: instrument.PricePrecision,
+			SizePrecision:  instrument.SizePrecision,
+			Status:         instrument.Status,
+			Timestamp:      instrument.Timestamp,
+			CreatedAt:      time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitCandlesJSONL outputs input candle data to terminal as JSON lines.
+func (t *Terminal) commitCandlesJSONL(data []Candle) {
+	var buf bytes.Buffer
+	for _, candle := range data {
+		td := esData{
+			Channel:   "candle",
+			Exchange:  candle.Exchange,
+			Market:    candle.MktCommitName,
+			Interval:  candle.Interval,
+			Open:      candle.Open,
+			High:      candle.High,
+			Low:       candle.Low,
+			Close:     candle.Close,
+			Volume:    candle.Volume,
+			Timestamp: candle.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitAvgPricesJSONL outputs input average price data to terminal as JSON lines.
+func (t *Terminal) commitAvgPricesJSONL(data []AvgPrice) {
+	var buf bytes.Buffer
+	for _, avgPrice := range data {
+		td := esData{
+			Channel:   "avg_price",
+			Exchange:  avgPrice.Exchange,
+			Market:    avgPrice.MktCommitName,
+			Window:    avgPrice.Window,
+			VWAP:      avgPrice.VWAP,
+			TWAP:      avgPrice.TWAP,
+			Timestamp: avgPrice.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitBookMetricsJSONL outputs input book metric data to terminal as JSON lines.
+func (t *Terminal) commitBookMetricsJSONL(data []BookMetric) {
+	var buf bytes.Buffer
+	for _, bookMetric := range data {
+		td := esData{
+			Channel:   "book_metric",
+			Exchange:  bookMetric.Exchange,
+			Market:    bookMetric.MktCommitName,
+			Levels:    bookMetric.Levels,
+			Spread:    bookMetric.Spread,
+			MidPrice:  bookMetric.MidPrice,
+			BidDepth:  bookMetric.BidDepth,
+			AskDepth:  bookMetric.AskDepth,
+			Imbalance: bookMetric.Imbalance,
+			Timestamp: bookMetric.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitMarketStatsJSONL outputs input market stats data to terminal as JSON lines.
+func (t *Terminal) commitMarketStatsJSONL(data []MarketStats) {
+	var buf bytes.Buffer
+	for _, marketStats := range data {
+		td := esData{
+			Channel:    "market_stats",
+			Exchange:   marketStats.Exchange,
+			Market:     marketStats.MktCommitName,
+			Interval:   marketStats.Interval,
+			TradeCount: marketStats.TradeCount,
+			BuyVolume:  marketStats.BuyVolume,
+			SellVolume: marketStats.SellVolume,
+			Notional:   marketStats.Notional,
+			Timestamp:  marketStats.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitFXRatesJSONL outputs input fx rate data to terminal as JSON lines.
+func (t *Terminal) commitFXRatesJSONL(data []FXRate) {
+	var buf bytes.Buffer
+	for _, fxRate := range data {
+		td := esData{
+			Channel:   "fx_rate",
+			Exchange:  "fx",
+			Market:    fxRate.Currency + "/USD",
+			Price:     fxRate.Rate,
+			Timestamp: fxRate.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitCoinInfosJSONL outputs input coin info data to terminal as JSON lines.
+func (t *Terminal) commitCoinInfosJSONL(data []CoinInfo) {
+	var buf bytes.Buffer
+	for _, coinInfo := range data {
+		td := esData{
+			Channel:   "coin_info",
+			Exchange:  "coingecko",
+			Market:    coinInfo.CoinID,
+			Base:      coinInfo.Base,
+			MarketCap: coinInfo.MarketCap,
+			Rank:      coinInfo.Rank,
+			Supply:    coinInfo.CirculatingSupply,
+			Timestamp: coinInfo.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// commitArbitrageSpreadsJSONL outputs input arbitrage spread data to terminal as JSON lines.
+func (t *Terminal) commitArbitrageSpreadsJSONL(data []ArbitrageSpread) {
+	var buf bytes.Buffer
+	for _, arbitrageSpread := range data {
+		td := esData{
+			Channel:       "arbitrage_spread",
+			Exchange:      "arbitrage",
+			Market:        arbitrageSpread.Base + "/" + arbitrageSpread.Quote,
+			Base:          arbitrageSpread.Base,
+			Quote:         arbitrageSpread.Quote,
+			BuyExchange:   arbitrageSpread.BuyExchange,
+			BuyPrice:      arbitrageSpread.BuyPrice,
+			SellExchange:  arbitrageSpread.SellExchange,
+			SellPrice:     arbitrageSpread.SellPrice,
+			SpreadPercent: arbitrageSpread.SpreadPercent,
+			Timestamp:     arbitrageSpread.Timestamp,
+			CreatedAt:     time.Now().UTC(),
+		}
+		writeTerminalRecord(&buf, &td)
+	}
+	t.write(buf.Bytes())
+}
+
+// writeTerminalRecord appends JSON record to the buffer as a line.
+// Record is always marshalled, so the error is not checked.
+func writeTerminalRecord(buf *bytes.Buffer, td *esData) {
+	record, _ := jsoniter.Marshal(td)
+	buf.Write(record)
+	buf.WriteByte('\n')
+}
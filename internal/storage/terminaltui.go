@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default values, if not configured.
+const terminalTUIRefreshSec = 1
+
+// terminalTUI keeps the latest state of each market, which is redrawn in place as a table
+// instead of printing every data point.
+type terminalTUI struct {
+	refresh time.Duration
+	mu      sync.Mutex
+	rows    map[terminalKey]*terminalRow
+	drawn   time.Time
+}
+
+type terminalKey struct {
+	exchange string
+	market   string
+}
+
+type terminalRow struct {
+	price      float64
+	tradeSize  float64
+	tradePrice float64
+	traded     bool
+	count      int
+	rate       float64
+	updated    time.Time
+}
+
+// EnableTUI switches the terminal to display a table with a row per market, redrawn at every refresh interval
+// by Serve, instead of printing the data.
+// It should be called before any data is committed.
+func (t *Terminal) EnableTUI(refreshSec int) {
+	if refreshSec == 0 {
+		refreshSec = terminalTUIRefreshSec
+	}
+	t.tui = &terminalTUI{
+		refresh: time.Duration(refreshSec) * time.Second,
+		rows:    make(map[terminalKey]*terminalRow),
+		drawn:   time.Now(),
+	}
+}
+
+// Serve redraws the table at every refresh interval, till the app context is cancelled.
+// It returns immediately if the TUI is not enabled.
+func (t *Terminal) Serve(appCtx context.Context) error {
+	if t.tui == nil {
+		return nil
+	}
+	ticker := time.NewTicker(t.tui.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := t.out.Write(t.tui.draw(time.Now())); err != nil {
+				return err
+			}
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+	}
+}
+
+// record updates the row of the market with a data point received,
+// along with its price or trade, if any.
+func (tui *terminalTUI) record(exchange, market string, update func(row *terminalRow)) {
+	tui.mu.Lock()
+	defer tui.mu.Unlock()
+	key := terminalKey{exchange: exchange, market: market}
+	row, ok := tui.rows[key]
+	if !ok {
+		row = &terminalRow{}
+		tui.rows[key] = row
+	}
+	row.count++
+	row.updated = time.Now()
+	if update != nil {
+		update(row)
+	}
+}
+
+// draw returns the whole screen of the table, which clears the terminal before it.
+// Message rate is of the data points received since the last draw.
+// Whole screen is written at once, so that the terminal does not flicker in between.
+func (tui *terminalTUI) draw(now time.Time) []byte {
+	tui.mu.Lock()
+	defer tui.mu.Unlock()
+	elapsed := now.Sub(tui.drawn).Seconds()
+	tui.drawn = now
+
+	keys := make([]terminalKey, 0, len(tui.rows))
+	for key := range tui.rows {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].exchange != keys[j].exchange {
+			return keys[i].exchange < keys[j].exchange
+		}
+		return keys[i].market < keys[j].market
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString("\033[H\033[2J")
+	fmt.Fprintf(&buf, "%-15s%-15s%20s%20s%20s%12s%10s\n", "Exchange", "Market", "Price", "Trade Price", "Trade Size", "Msg/s", "Age")
+	for _, key := range keys {
+		row := tui.rows[key]
+		if elapsed > 0 {
+			row.rate = float64(row.count) / elapsed
+		}
+		row.count = 0
+		price := "-"
+		if row.price != 0 {
+			price = fmt.Sprintf("%f", row.price)
+		}
+		tradePrice, tradeSize := "-", "-"
+		if row.traded {
+			tradePrice = fmt.Sprintf("%f", row.tradePrice)
+			tradeSize = fmt.Sprintf("%f", row.tradeSize)
+		}
+		age := now.Sub(row.updated).Truncate(100 * time.Millisecond)
+		fmt.Fprintf(&buf, "%-15s%-15s%20s%20s%20s%12.1f%10s\n", key.exchange, key.market, price, tradePrice, tradeSize, row.rate, age)
+	}
+	fmt.Fprintf(&buf, "\n%d markets, updated at %s\n", len(keys), now.Local().Format(TerminalTimestamp))
+	return buf.Bytes()
+}
+
+// recordTickers updates the last price of the markets.
+func (tui *terminalTUI) recordTickers(data []Ticker) {
+	for i := range data {
+		ticker := &data[i]
+		tui.record(ticker.Exchange, ticker.MktCommitName, func(row *terminalRow) {
+			row.price = ticker.Price
+		})
+	}
+}
+
+// recordTrades updates the last trade of the markets.
+func (tui *terminalTUI) recordTrades(data []Trade) {
+	for i := range data {
+		trade := &data[i]
+		tui.record(trade.Exchange, trade.MktCommitName, func(row *terminalRow) {
+			row.tradePrice = trade.Price
+			row.tradeSize = trade.Size
+			row.traded = true
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	// Postgres driver is used by the timescale database.
+	_ "github.com/lib/pq"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// Timescale is for connecting and inserting data to timescale database.
+type Timescale struct {
+	DB  *sql.DB
+	Cfg *config.Timescale
+}
+
+var timescale Timescale
+
+// Postgres timestamptz accepts the time zone offset, so UTC is kept as Z.
+const timescaleTimestamp = "2006-01-02T15:04:05.999999Z07:00"
+
+// timescaleTables are the hypertables created while connecting, if they do not exist already.
+var timescaleTables = []string{
+	`CREATE TABLE IF NOT EXISTS ticker (
+		exchange varchar(32) NOT NULL,
+		market varchar(32) NOT NULL,
+		base varchar(16) NOT NULL,
+		quote varchar(16) NOT NULL,
+		price double precision NOT NULL,
+		best_bid double precision NOT NULL,
+		best_ask double precision NOT NULL,
+		volume double precision NOT NULL,
+		high double precision NOT NULL,
+		low double precision NOT NULL,
+		price_usd double precision NOT NULL,
+		is_bad_tick boolean NOT NULL,
+		timestamp timestamptz NOT NULL,
+		created_at timestamptz NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS trade (
+		exchange varchar(32) NOT NULL,
+		market varchar(32) NOT NULL,
+		base varchar(16) NOT NULL,
+		quote varchar(16) NOT NULL,
+		trade_id varchar(64) NOT NULL,
+		side varchar(8) NOT NULL,
+		size double precision NOT NULL,
+		price double precision NOT NULL,
+		is_buyer_maker boolean NOT NULL,
+		price_usd double precision NOT NULL,
+		is_bad_tick boolean NOT NULL,
+		timestamp timestamptz NOT NULL,
+		created_at timestamptz NOT NULL
+	)`,
+}
+
+// InitTimescale initializes timescale database connection with configured values
+// and prepares the ticker and trade hypertables along with the compression policies.
+func InitTimescale(cfg *config.Timescale) (*Timescale, error) {
+	if timescale.DB == nil {
+		sslMode := cfg.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(cfg.User, cfg.Password),
+			Host:     cfg.URL,
+			Path:     cfg.Schema,
+			RawQuery: "sslmode=" + url.QueryEscape(sslMode),
+		}
+		db, err := sql.Open("postgres", dsn.String())
+		if err != nil {
+			return nil, err
+		}
+		db.SetConnMaxLifetime(time.Second * time.Duration(cfg.ConnMaxLifetimeSec))
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+
+		var ctx context.Context
+		if cfg.ReqTimeoutSec > 0 {
+			timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReqTimeoutSec)*time.Second)
+			ctx = timeoutCtx
+			defer cancel()
+		} else {
+			ctx = context.Background()
+		}
+		err = db.PingContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err = createHypertables(ctx, db, cfg); err != nil {
+			return nil, err
+		}
+		timescale = Timescale{
+			DB:  db,
+			Cfg: cfg,
+		}
+	}
+	return &timescale, nil
+}
+
+// createHypertables creates the tables, converts them to hypertables partitioned by the timestamp
+// and adds the compression policies, if configured.
+// All the statements are idempotent, so that the app can be restarted with the same database.
+func createHypertables(ctx context.Context, db *sql.DB, cfg *config.Timescale) error {
+	chunkInterval := cfg.ChunkIntervalHours
+	if chunkInterval == 0 {
+		chunkInterval = 24
+	}
+	for i, table := range []string{"ticker", "trade"} {
+		if _, err := db.ExecContext(ctx, timescaleTables[i]); err != nil {
+			return err
+		}
+		stmt := fmt.Sprintf("SELECT create_hypertable('%s', 'timestamp', chunk_time_interval => INTERVAL '%d hours', if_not_exists => TRUE)", table, chunkInterval)
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+		if cfg.CompressAfterHours > 0 {
+			stmt = fmt.Sprintf("ALTER TABLE %s SET (timescaledb.compress, timescaledb.compress_segmentby = 'exchange, market')", table)
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+			stmt = fmt.Sprintf("SELECT add_compression_policy('%s', INTERVAL '%d hours', if_not_exists => TRUE)", table, cfg.CompressAfterHours)
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetTimescale returns already prepared timescale instance.
+func GetTimescale() *Timescale {
+	return &timescale
+}
+
+// timestamp formats the time to postgres UTC timestamp.
+func (t *Timescale) timestamp(ts time.Time) string {
+	return ts.UTC().Format(timescaleTimestamp)
+}
+
+// CommitTickers batch inserts input ticker data to database.
+func (t *Timescale) CommitTickers(appCtx context.Context, data []Ticker) error {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO ticker(exchange, market, base, quote, price, best_bid, best_ask, volume, high, low, price_usd, is_bad_tick, timestamp, created_at) VALUES ")
+	for i, ticker := range data {
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf("('%v', '%v', '%v', '%v', %v, %v, %v, %v, %v, %v, %v, %v, '%v', '%v')", ticker.Exchange, ticker.MktCommitName, ticker.Base, ticker.Quote, ticker.Price, ticker.BestBid, ticker.BestAsk, ticker.Volume, ticker.High, ticker.Low, ticker.PriceUSD, ticker.IsBadTick, t.timestamp(ticker.Timestamp), t.timestamp(time.Now())))
+		} else {
+			sb.WriteString(fmt.Sprintf(",('%v', '%v', '%v', '%v', %v, %v, %v, %v, %v, %v, %v, %v, '%v', '%v')", ticker.Exchange, ticker.MktCommitName, ticker.Base, ticker.Quote, ticker.Price, ticker.BestBid, ticker.BestAsk, ticker.Volume, ticker.High, ticker.Low, ticker.PriceUSD, ticker.IsBadTick, t.timestamp(ticker.Timestamp), t.timestamp(time.Now())))
+		}
+	}
+	var ctx context.Context
+	if t.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(t.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err := t.DB.ExecContext(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CommitTrades batch inserts input trade data to database.
+func (t *Timescale) CommitTrades(appCtx context.Context, data []Trade) error {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO trade(exchange, market, base, quote, trade_id, side, size, price, is_buyer_maker, price_usd, is_bad_tick, timestamp, created_at) VALUES ")
+	for i, trade := range data {
+		if i == 0 {
+			sb.WriteString(fmt.Sprintf("('%v', '%v', '%v', '%v', '%v', '%v', %v, %v, %v, %v, %v, '%v', '%v')", trade.Exchange, trade.MktCommitName, trade.Base, trade.Quote, trade.TradeID, trade.Side, trade.Size, trade.Price, trade.IsBuyerMaker, trade.PriceUSD, trade.IsBadTick, t.timestamp(trade.Timestamp), t.timestamp(time.Now())))
+		} else {
+			sb.WriteString(fmt.Sprintf(",('%v', '%v', '%v', '%v', '%v', '%v', %v, %v, %v, %v, %v, '%v', '%v')", trade.Exchange, trade.MktCommitName, trade.Base, trade.Quote, trade.TradeID, trade.Side, trade.Size, trade.Price, trade.IsBuyerMaker, trade.PriceUSD, trade.IsBadTick, t.timestamp(trade.Timestamp), t.timestamp(time.Now())))
+		}
+	}
+	var ctx context.Context
+	if t.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(t.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = context.Background()
+	}
+	_, err := t.DB.ExecContext(ctx, sb.String())
+	if err != nil {
+		return err
+	}
+	return nil
+}
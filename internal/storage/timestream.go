@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/timestreamwrite"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// Timestream is for connecting and writing data to amazon timestream.
+type Timestream struct {
+	Client *timestreamwrite.TimestreamWrite
+	Cfg    *config.Timestream
+}
+
+var timestream Timestream
+
+// Limits and default values, if not configured.
+const (
+	timestreamMaxRecords         = 100
+	timestreamMemoryRetentionHrs = 24
+	timestreamMagneticRetentionD = 365
+)
+
+// InitTimestream initializes timestream write client with configured values
+// and creates the database and the ticker and trade tables, if they do not exist already.
+// For existing tables, retention is updated to the configured values.
+func InitTimestream(cfg *config.Timestream) (*Timestream, error) {
+	if timestream.Client == nil {
+		awsCfg := aws.NewConfig().WithRegion(cfg.Region)
+		if cfg.MaxRetries > 0 {
+			awsCfg = awsCfg.WithMaxRetries(cfg.MaxRetries)
+		}
+		if cfg.AccessKeyID != "" {
+			awsCfg = awsCfg.WithCredentials(credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, ""))
+		}
+		sess, err := session.NewSession(awsCfg)
+		if err != nil {
+			return nil, err
+		}
+		client := timestreamwrite.New(sess)
+
+		var ctx context.Context
+		if cfg.ReqTimeoutSec > 0 {
+			timeoutCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReqTimeoutSec)*time.Second)
+			ctx = timeoutCtx
+			defer cancel()
+		} else {
+			ctx = context.Background()
+		}
+		var conflict *timestreamwrite.ConflictException
+		_, err = client.CreateDatabaseWithContext(ctx, &timestreamwrite.CreateDatabaseInput{
+			DatabaseName: aws.String(cfg.Database),
+		})
+		if err != nil && !errors.As(err, &conflict) {
+			return nil, err
+		}
+
+		memory := cfg.MemoryRetentionHours
+		if memory == 0 {
+			memory = timestreamMemoryRetentionHrs
+		}
+		magnetic := cfg.MagneticRetentionDays
+		if magnetic == 0 {
+			magnetic = timestreamMagneticRetentionD
+		}
+		retention := &timestreamwrite.RetentionProperties{
+			MemoryStoreRetentionPeriodInHours:  aws.Int64(int64(memory)),
+			MagneticStoreRetentionPeriodInDays: aws.Int64(int64(magnetic)),
+		}
+		for _, table := range []string{"ticker", "trade"} {
+			_, err = client.CreateTableWithContext(ctx, &timestreamwrite.CreateTableInput{
+				DatabaseName:        aws.String(cfg.Database),
+				TableName:           aws.String(table),
+				RetentionProperties: retention,
+			})
+			if err != nil {
+				if !errors.As(err, &conflict) {
+					return nil, err
+				}
+				_, err = client.UpdateTableWithContext(ctx, &timestreamwrite.UpdateTableInput{
+					DatabaseName:        aws.String(cfg.Database),
+					TableName:           aws.String(table),
+					RetentionProperties: retention,
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		timestream = Timestream{
+			Client: client,
+			Cfg:    cfg,
+		}
+	}
+	return &timestream, nil
+}
+
+// GetTimestream returns already prepared timestream instance.
+func GetTimestream() *Timestream {
+	return &timestream
+}
+
+// CommitTickers batch writes input ticker data to timestream.
+// Each ticker is a single multi measure record with all the ticker fields, dimensioned by exchange and market.
+func (t *Timestream) CommitTickers(appCtx context.Context, data []Ticker) error {
+	records := make([]*timestreamwrite.Record, 0, len(data))
+	for _, ticker := range data {
+		records = append(records, &timestreamwrite.Record{
+			Dimensions: []*timestreamwrite.Dimension{
+				{Name: aws.String("exchange"), Value: aws.String(ticker.Exchange)},
+				{Name: aws.String("market"), Value: aws.String(ticker.MktCommitName)},
+				{Name: aws.String("base"), Value: aws.String(ticker.Base)},
+				{Name: aws.String("quote"), Value: aws.String(ticker.Quote)},
+			},
+			MeasureName:      aws.String("ticker"),
+			MeasureValueType: aws.String(timestreamwrite.MeasureValueTypeMulti),
+			MeasureValues: []*timestreamwrite.MeasureValue{
+				timestreamDouble("price", ticker.Price),
+				timestreamDouble("best_bid", ticker.BestBid),
+				timestreamDouble("best_ask", ticker.BestAsk),
+				timestreamDouble("volume", ticker.Volume),
+				timestreamDouble("high", ticker.High),
+				timestreamDouble("low", ticker.Low),
+				timestreamDouble("price_usd", ticker.PriceUSD),
+				timestreamBool("is_bad_tick", ticker.IsBadTick),
+			},
+			Time:     aws.String(strconv.FormatInt(ticker.Timestamp.UnixNano()/int64(time.Millisecond), 10)),
+			TimeUnit: aws.String(timestreamwrite.TimeUnitMilliseconds),
+		})
+	}
+	return t.write(appCtx, "ticker", records)
+}
+
+// CommitTrades batch writes input trade data to timestream.
+// Trade id is a dimension, as timestream rejects the records of a series with the same time,
+// which is common for the trades.
+func (t *Timestream) CommitTrades(appCtx context.Context, data []Trade) error {
+	records := make([]*timestreamwrite.Record, 0, len(data))
+	for _, trade := range data {
+		records = append(records, &timestreamwrite.Record{
+			Dimensions: []*timestreamwrite.Dimension{
+				{Name: aws.String("exchange"), Value: aws.String(trade.Exchange)},
+				{Name: aws.String("market"), Value: aws.String(trade.MktCommitName)},
+				{Name: aws.String("base"), Value: aws.String(trade.Base)},
+				{Name: aws.String("quote"), Value: aws.String(trade.Quote)},
+				{Name: aws.String("trade_id"), Value: aws.String(trade.TradeID)},
+			},
+			MeasureName:      aws.String("trade"),
+			MeasureValueType: aws.String(timestreamwrite.MeasureValueTypeMulti),
+			MeasureValues: []*timestreamwrite.MeasureValue{
+				{Name: aws.String("side"), Value: aws.String(trade.Side), Type: aws.String(timestreamwrite.MeasureValueTypeVarchar)},
+				timestreamDouble("size", trade.Size),
+				timestreamDouble("price", trade.Price),
+				timestreamBool("is_buyer_maker", trade.IsBuyerMaker),
+				timestreamDouble("price_usd", trade.PriceUSD),
+				timestreamBool("is_bad_tick", trade.IsBadTick),
+			},
+			Time:     aws.String(strconv.FormatInt(trade.Timestamp.UnixNano()/int64(time.Millisecond), 10)),
+			TimeUnit: aws.String(timestreamwrite.TimeUnitMilliseconds),
+		})
+	}
+	return t.write(appCtx, "trade", records)
+}
+
+// write sends the records to the table in WriteRecords requests of maximum allowed records each.
+func (t *Timestream) write(appCtx context.Context, table string, records []*timestreamwrite.Record) error {
+	var ctx context.Context
+	if t.Cfg.ReqTimeoutSec > 0 {
+		timeoutCtx, cancel := context.WithTimeout(appCtx, time.Duration(t.Cfg.ReqTimeoutSec)*time.Second)
+		ctx = timeoutCtx
+		defer cancel()
+	} else {
+		ctx = appCtx
+	}
+	for start := 0; start < len(records); start += timestreamMaxRecords {
+		end := start + timestreamMaxRecords
+		if end > len(records) {
+			end = len(records)
+		}
+		_, err := t.Client.WriteRecordsWithContext(ctx, &timestreamwrite.WriteRecordsInput{
+			DatabaseName: aws.String(t.Cfg.Database),
+			TableName:    aws.String(table),
+			Records:      records[start:end],
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func timestreamDouble(name string, value float64) *timestreamwrite.MeasureValue {
+	return &timestreamwrite.MeasureValue{
+		Name:  aws.String(name),
+		Value: aws.String(strconv.FormatFloat(value, 'f', -1, 64)),
+		Type:  aws.String(timestreamwrite.MeasureValueTypeDouble),
+	}
+}
+
+func timestreamBool(name string, value bool) *timestreamwrite.MeasureValue {
+	return &timestreamwrite.MeasureValue{
+		Name:  aws.String(name),
+		Value: aws.String(strconv.FormatBool(value)),
+		Type:  aws.String(timestreamwrite.MeasureValueTypeBoolean),
+	}
+}
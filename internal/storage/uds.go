@@ -0,0 +1,483 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// UDS is for publishing data to local consumers through unix domain socket.
+// Each record is sent as a 4 byte big endian length prefix followed by the JSON record,
+// which has the same format as Elasticsearch document.
+type UDS struct {
+	Listener net.Listener
+	Cfg      *config.UDS
+	mu       sync.Mutex
+	clients  map[net.Conn]struct{}
+}
+
+var uds UDS
+
+// InitUDS starts listening on the configured unix domain socket path.
+func InitUDS(cfg *config.UDS) (*UDS, error) {
+	if uds.Listener == nil {
+
+		// Socket file left by the previous run has to be removed before listening again.
+		if err := os.Remove(cfg.SocketPath); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		l, err := net.Listen("unix", cfg.SocketPath)
+		if err != nil {
+			return nil, err
+		}
+		uds = UDS{
+			Listener: l,
+			Cfg:      cfg,
+			clients:  make(map[net.Conn]struct{}),
+		}
+		go uds.accept()
+	}
+	return &uds, nil
+}
+
+// GetUDS returns already prepared unix domain socket instance.
+func GetUDS() *UDS {
+	return &uds
+}
+
+// accept registers every new consumer connection till the listener is closed.
+func (u *UDS) accept() {
+	for {
+		conn, err := u.Listener.Accept()
+		if err != nil {
+			return
+		}
+		u.mu.Lock()
+		u.clients[conn] = struct{}{}
+		u.mu.Unlock()
+	}
+}
+
+// CommitTickers batch sends input ticker data to unix domain socket consumers.
+func (u *UDS) CommitTickers(_ context.Context, data []Ticker) error {
+	var buf bytes.Buffer
+	for _, ticker := range data {
+		ud := esData{
+			Channel:   "ticker",
+			Exchange:  ticker.Exchange,
+			Market:    ticker.MktCommitName,
+			Base:      ticker.Base,
+			Quote:     ticker.Quote,
+			Price:     ticker.Price,
+			BestBid:   ticker.BestBid,
+			BestAsk:   ticker.BestAsk,
+			Volume:    ticker.Volume,
+			High:      ticker.High,
+			Low:       ticker.Low,
+			PriceUSD:  ticker.PriceUSD,
+			BadTick:   ticker.IsBadTick,
+			Timestamp: ticker.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitTrades batch sends input trade data to unix domain socket consumers.
+func (u *UDS) CommitTrades(_ context.Context, data []Trade) error {
+	var buf bytes.Buffer
+	for _, trade := range data {
+		ud := esData{
+			Channel:    "trade",
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			Base:       trade.Base,
+			Quote:      trade.Quote,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			BuyerMaker: trade.IsBuyerMaker,
+			PriceUSD:   trade.PriceUSD,
+			BadTick:    trade.IsBadTick,
+			Timestamp:  trade.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitMarkPrices batch sends input mark price data to unix domain socket consumers.
+func (u *UDS) CommitMarkPrices(_ context.Context, data []MarkPrice) error {
+	var buf bytes.Buffer
+	for _, markPrice := range data {
+		ud := esData{
+			Channel:    "mark_price",
+			Exchange:   markPrice.Exchange,
+			Market:     markPrice.MktCommitName,
+			MarkPrice:  markPrice.MarkPrice,
+			IndexPrice: markPrice.IndexPrice,
+			Basis:      markPrice.Basis,
+			Timestamp:  markPrice.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitBBOs batch sends input best bid and offer data to unix domain socket consumers.
+func (u *UDS) CommitBBOs(_ context.Context, data []BBO) error {
+	var buf bytes.Buffer
+	for _, bbo := range data {
+		ud := esData{
+			Channel:   "bbo",
+			Exchange:  bbo.Exchange,
+			Market:    bbo.MktCommitName,
+			BidPrice:  bbo.BidPrice,
+			BidSize:   bbo.BidSize,
+			AskPrice:  bbo.AskPrice,
+			AskSize:   bbo.AskSize,
+			Timestamp: bbo.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitBlockTrades batch sends input block trade data to unix domain socket consumers.
+func (u *UDS) CommitBlockTrades(_ context.Context, data []Trade) error {
+	var buf bytes.Buffer
+	for _, trade := range data {
+		ud := esData{
+			Channel:   "block_trade",
+			Exchange:  trade.Exchange,
+			Market:    trade.MktCommitName,
+			TradeID:   trade.TradeID,
+			Side:      trade.Side,
+			Size:      trade.Size,
+			Price:     trade.Price,
+			Timestamp: trade.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitTradingStatuses batch sends input trading status data to unix domain socket consumers.
+func (u *UDS) CommitTradingStatuses(_ context.Context, data []TradingStatus) error {
+	var buf bytes.Buffer
+	for _, tradingStatus := range data {
+		ud := esData{
+			Channel:   "trading_status",
+			Exchange:  tradingStatus.Exchange,
+			Market:    tradingStatus.MktCommitName,
+			Status:    tradingStatus.Status,
+			Timestamp: tradingStatus.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitAggTrades batch sends input aggregated trade data to unix domain socket consumers.
+func (u *UDS) CommitAggTrades(_ context.Context, data []Trade) error {
+	var buf bytes.Buffer
+	for _, trade := range data {
+		ud := esData{
+			Channel:    "agg_trade",
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			BuyerMaker: trade.IsBuyerMaker,
+			Timestamp:  trade.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitOrderFlows batch sends input order flow data to unix domain socket consumers.
+func (u *UDS) CommitOrderFlows(_ context.Context, data []OrderFlow) error {
+	var buf bytes.Buffer
+	for _, orderFlow := range data {
+		ud := esData{
+			Channel:      "orderflow",
+			Exchange:     orderFlow.Exchange,
+			Market:       orderFlow.MktCommitName,
+			Event:        orderFlow.Event,
+			OrderID:      orderFlow.OrderID,
+			TakerOrderID: orderFlow.TakerOrderID,
+			TradeID:      orderFlow.TradeID,
+			Side:         orderFlow.Side,
+			Size:         orderFlow.Size,
+			Price:        orderFlow.Price,
+			Reason:       orderFlow.Reason,
+			Sequence:     orderFlow.Sequence,
+			Timestamp:    orderFlow.Timestamp,
+			CreatedAt:    time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitInstruments batch sends input instrument data to unix domain socket consumers.
+func (u *UDS) CommitInstruments(_ context.Context, data []Instrument) error {
+	var buf bytes.Buffer
+	for _, instrument := range data {
+		ud := esData{
+			Channel:        "instrument",
+			Exchange:       instrument.Exchange,
+			Market:         instrument.MktCommitName,
+			TickSize:       instrument.TickSize,
+			LotSize:        instrument.LotSize,
+			PricePrecision: instrument.PricePrecision,
+			SizePrecision:  instrument.SizePrecision,
+			Status:         instrument.Status,
+			Timestamp:      instrument.Timestamp,
+			CreatedAt:      time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitCandles batch sends input candle data to unix domain socket consumers.
+func (u *UDS) CommitCandles(_ context.Context, data []Candle) error {
+	var buf bytes.Buffer
+	for _, candle := range data {
+		ud := esData{
+			Channel:   "candle",
+			Exchange:  candle.Exchange,
+			Market:    candle.MktCommitName,
+			Interval:  candle.Interval,
+			Open:      candle.Open,
+			High:      candle.High,
+			Low:       candle.Low,
+			Close:     candle.Close,
+			Volume:    candle.Volume,
+			Timestamp: candle.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitAvgPrices batch sends input average price data to unix domain socket consumers.
+func (u *UDS) CommitAvgPrices(_ context.Context, data []AvgPrice) error {
+	var buf bytes.Buffer
+	for _, avgPrice := range data {
+		ud := esData{
+			Channel:   "avg_price",
+			Exchange:  avgPrice.Exchange,
+			Market:    avgPrice.MktCommitName,
+			Window:    avgPrice.Window,
+			VWAP:      avgPrice.VWAP,
+			TWAP:      avgPrice.TWAP,
+			Timestamp: avgPrice.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitBookMetrics batch sends input book metric data to unix domain socket consumers.
+func (u *UDS) CommitBookMetrics(_ context.Context, data []BookMetric) error {
+	var buf bytes.Buffer
+	for _, bookMetric := range data {
+		ud := esData{
+			Channel:   "book_metric",
+			Exchange:  bookMetric.Exchange,
+			Market:    bookMetric.MktCommitName,
+			Levels:    bookMetric.Levels,
+			Spread:    bookMetric.Spread,
+			MidPrice:  bookMetric.MidPrice,
+			BidDepth:  bookMetric.BidDepth,
+			AskDepth:  bookMetric.AskDepth,
+			Imbalance: bookMetric.Imbalance,
+			Timestamp: bookMetric.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitMarketStats batch sends input market stats data to unix domain socket consumers.
+func (u *UDS) CommitMarketStats(_ context.Context, data []MarketStats) error {
+	var buf bytes.Buffer
+	for _, marketStats := range data {
+		ud := esData{
+			Channel:    "market_stats",
+			Exchange:   marketStats.Exchange,
+			Market:     marketStats.MktCommitName,
+			Interval:   marketStats.Interval,
+			TradeCount: marketStats.TradeCount,
+			BuyVolume:  marketStats.BuyVolume,
+			SellVolume: marketStats.SellVolume,
+			Notional:   marketStats.Notional,
+			Timestamp:  marketStats.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitFXRates batch sends input fx rate data to unix domain socket consumers.
+func (u *UDS) CommitFXRates(_ context.Context, data []FXRate) error {
+	var buf bytes.Buffer
+	for _, fxRate := range data {
+		ud := esData{
+			Channel:   "fx_rate",
+			Exchange:  "fx",
+			Market:    fxRate.Currency + "/USD",
+			Price:     fxRate.Rate,
+			Timestamp: fxRate.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitCoinInfos batch sends input coin info data to unix domain socket consumers.
+func (u *UDS) CommitCoinInfos(_ context.Context, data []CoinInfo) error {
+	var buf bytes.Buffer
+	for _, coinInfo := range data {
+		ud := esData{
+			Channel:   "coin_info",
+			Exchange:  "coingecko",
+			Market:    coinInfo.CoinID,
+			Base:      coinInfo.Base,
+			MarketCap: coinInfo.MarketCap,
+			Rank:      coinInfo.Rank,
+			Supply:    coinInfo.CirculatingSupply,
+			Timestamp: coinInfo.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// CommitArbitrageSpreads batch sends input arbitrage spread data to unix domain socket consumers.
+func (u *UDS) CommitArbitrageSpreads(_ context.Context, data []ArbitrageSpread) error {
+	var buf bytes.Buffer
+	for _, arbitrageSpread := range data {
+		ud := esData{
+			Channel:       "arbitrage_spread",
+			Exchange:      "arbitrage",
+			Market:        arbitrageSpread.Base + "/" + arbitrageSpread.Quote,
+			Base:          arbitrageSpread.Base,
+			Quote:         arbitrageSpread.Quote,
+			BuyExchange:   arbitrageSpread.BuyExchange,
+			BuyPrice:      arbitrageSpread.BuyPrice,
+			SellExchange:  arbitrageSpread.SellExchange,
+			SellPrice:     arbitrageSpread.SellPrice,
+			SpreadPercent: arbitrageSpread.SpreadPercent,
+			Timestamp:     arbitrageSpread.Timestamp,
+			CreatedAt:     time.Now().UTC(),
+		}
+		if err := writeUDSRecord(&buf, &ud); err != nil {
+			return err
+		}
+	}
+	u.send(buf.Bytes())
+	return nil
+}
+
+// writeUDSRecord appends length prefixed JSON record to the buffer.
+func writeUDSRecord(buf *bytes.Buffer, ud *esData) error {
+	record, err := jsoniter.Marshal(ud)
+	if err != nil {
+		return err
+	}
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], uint32(len(record)))
+	buf.Grow(len(prefix) + len(record))
+	buf.Write(prefix[:])
+	buf.Write(record)
+	return nil
+}
+
+// send writes the records to all the connected consumers.
+// Consumer which fails to read within the write timeout is disconnected,
+// so that a slow or dead consumer never blocks the app.
+func (u *UDS) send(records []byte) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for conn := range u.clients {
+		if u.Cfg.WriteTimeoutSec > 0 {
+			_ = conn.SetWriteDeadline(time.Now().Add(time.Duration(u.Cfg.WriteTimeoutSec) * time.Second))
+		}
+		if _, err := conn.Write(records); err != nil {
+			conn.Close()
+			delete(u.clients, conn)
+		}
+	}
+}
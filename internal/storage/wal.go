@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// WAL is an on-disk write-ahead buffer of a storage.
+// Batches which the storage failed to commit are spooled to it and replayed in order once the storage recovers,
+// so that a storage outage does not lose the data or restart the exchanges.
+// Each batch is a file named <sequence>_<channel>.json in the directory of the storage.
+type WAL struct {
+	Cfg   *config.StorageWAL
+	dir   string
+	seq   uint64
+	files []string
+	size  int64
+	mu    sync.Mutex
+}
+
+// ErrWALFull is returned when spooling a batch would exceed the max size of the WAL.
+var ErrWALFull = errors.New("wal is full")
+
+// Default values, if not configured.
+const walReplayIntervalSec = 5
+
+// walBatch is the content of a WAL file.
+type walBatch struct {
+	Tickers []Ticker `json:"tickers,omitempty"`
+	Trades  []Trade  `json:"trades,omitempty"`
+}
+
+// NewWAL creates the WAL directory of the storage, if not exists, and picks up the batches
+// left by the previous run of the app, so that they are replayed first.
+func NewWAL(str string, cfg *config.StorageWAL) (*WAL, error) {
+	// Plugin storage names have a colon, which is not allowed in file names on all the systems.
+	dir := filepath.Join(cfg.Dir, strings.ReplaceAll(str, ":", "_"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	w := WAL{Cfg: cfg, dir: dir}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.SplitN(name, "_", 2)[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		w.files = append(w.files, name)
+		w.size += info.Size()
+		if seq > w.seq {
+			w.seq = seq
+		}
+	}
+	sort.Strings(w.files)
+	return &w, nil
+}
+
+// Pending returns whether there are batches yet to be replayed.
+// New batches should be spooled, instead of committed directly, while it is true to keep the order.
+func (w *WAL) Pending() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.files) > 0
+}
+
+// AppendTickers spools the ticker batch.
+func (w *WAL) AppendTickers(data []Ticker) error {
+	return w.append("ticker", walBatch{Tickers: data})
+}
+
+// AppendTrades spools the trade batch.
+func (w *WAL) AppendTrades(data []Trade) error {
+	return w.append("trade", walBatch{Trades: data})
+}
+
+// append writes the batch to a temporary file first and renames it,
+// so that a crash while writing does not leave a partial batch to be replayed.
+func (w *WAL) append(channel string, batch walBatch) error {
+	data, err := jsoniter.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.Cfg.MaxSizeMB > 0 && w.size+int64(len(data)) > int64(w.Cfg.MaxSizeMB)*1024*1024 {
+		return ErrWALFull
+	}
+
+	// Zero padded sequence keeps the file names sorted in the order of writing.
+	name := fmt.Sprintf("%020d_%s.json", w.seq+1, channel)
+	tmp := filepath.Join(w.dir, name+".tmp")
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, filepath.Join(w.dir, name)); err != nil {
+		return err
+	}
+	w.seq++
+	w.files = append(w.files, name)
+	w.size += int64(len(data))
+	return nil
+}
+
+// Serve replays the spooled batches to the storage at every replay interval, till the app context is cancelled.
+func (w *WAL) Serve(appCtx context.Context, str Storage) error {
+	interval := w.Cfg.ReplayIntSec
+	if interval == 0 {
+		interval = walReplayIntervalSec
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.replay(appCtx, str); err != nil {
+				return err
+			}
+		case <-appCtx.Done():
+			return appCtx.Err()
+		}
+	}
+}
+
+// replay commits the spooled batches in order, removing each after it is committed.
+// It stops at the first commit failure, as the storage is likely still down, and continues at the next interval.
+// Only the failures of the WAL itself are returned.
+func (w *WAL) replay(appCtx context.Context, str Storage) error {
+	for {
+		w.mu.Lock()
+		if len(w.files) == 0 {
+			w.mu.Unlock()
+			return nil
+		}
+		name := w.files[0]
+		w.mu.Unlock()
+
+		path := filepath.Join(w.dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var batch walBatch
+		if err = jsoniter.Unmarshal(data, &batch); err != nil {
+
+			// Batch which can never be replayed is set aside, so that it does not block the rest.
+			if err = os.Rename(path, path+".corrupt"); err != nil {
+				return err
+			}
+		} else {
+			if len(batch.Tickers) > 0 {
+				err = str.CommitTickers(appCtx, batch.Tickers)
+			} else if len(batch.Trades) > 0 {
+				err = str.CommitTrades(appCtx, batch.Trades)
+			}
+			if err != nil {
+				return nil
+			}
+			if err = os.Remove(path); err != nil {
+				return err
+			}
+		}
+
+		w.mu.Lock()
+		w.files = w.files[1:]
+		w.size -= int64(len(data))
+		w.mu.Unlock()
+	}
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// walStorage records the committed batches, failing the commits while fail is set.
+type walStorage struct {
+	fail    bool
+	commits []string
+}
+
+func (s *walStorage) CommitTickers(_ context.Context, data []Ticker) error {
+	if s.fail {
+		return errors.New("storage down")
+	}
+	for _, ticker := range data {
+		s.commits = append(s.commits, "ticker "+ticker.MktID)
+	}
+	return nil
+}
+
+func (s *walStorage) CommitTrades(_ context.Context, data []Trade) error {
+	if s.fail {
+		return errors.New("storage down")
+	}
+	for _, trade := range data {
+		s.commits = append(s.commits, "trade "+trade.MktID)
+	}
+	return nil
+}
+
+// TestWALReplay tests the replay of the spooled batches in the order of append, including the ones
+// left by the previous run, and that they are kept on commit failure.
+func TestWALReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		existed map[string]string
+		appends []string
+		fail    bool
+		commits []string
+		files   []string
+		pending bool
+	}{
+		{
+			name:    "in order of append",
+			appends: []string{"ticker A", "trade B", "ticker C"},
+			commits: []string{"ticker A", "trade B", "ticker C"},
+		},
+		{
+			name:    "kept on commit failure",
+			appends: []string{"ticker A", "trade B"},
+			fail:    true,
+			files:   []string{"00000000000000000001_ticker.json", "00000000000000000002_trade.json"},
+			pending: true,
+		},
+		{
+			name: "left by previous run",
+			existed: map[string]string{
+				"00000000000000000007_trade.json":     `{"trades":[{"MktID":"X"}]}`,
+				"00000000000000000003_ticker.json":    `{"tickers":[{"MktID":"W"}]}`,
+				"00000000000000000009_trade.json.tmp": `{"trades":[{"MktID":"partial"}]}`,
+				"notes.txt":                           "not a batch",
+			},
+			appends: []string{"ticker A"},
+			commits: []string{"ticker W", "trade X", "ticker A"},
+			files:   []string{"00000000000000000009_trade.json.tmp", "notes.txt"},
+		},
+		{
+			name:    "corrupt file set aside",
+			existed: map[string]string{"00000000000000000001_trade.json": `{"trades":[{"MktID"`},
+			appends: []string{"trade A"},
+			commits: []string{"trade A"},
+			files:   []string{"00000000000000000001_trade.json.corrupt"},
+		},
+	}
+	for _, tt := range tests {
+		cfg := &config.StorageWAL{Dir: t.TempDir()}
+		dir := filepath.Join(cfg.Dir, "plugin_test")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Log("ERROR : " + err.Error())
+			t.FailNow()
+		}
+		for name, content := range tt.existed {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Log("ERROR : " + err.Error())
+				t.FailNow()
+			}
+		}
+		w, err := NewWAL("plugin:test", cfg)
+		if err != nil {
+			t.Log("ERROR : " + err.Error())
+			t.FailNow()
+		}
+		for _, batch := range tt.appends {
+			parts := strings.SplitN(batch, " ", 2)
+			if parts[0] == "ticker" {
+				err = w.AppendTickers([]Ticker{{MktID: parts[1]}})
+			} else {
+				err = w.AppendTrades([]Trade{{MktID: parts[1]}})
+			}
+			if err != nil {
+				t.Log("ERROR : " + err.Error())
+				t.FailNow()
+			}
+		}
+
+		str := &walStorage{fail: tt.fail}
+		if err = w.replay(context.Background(), str); err != nil {
+			t.Log("ERROR : " + err.Error())
+			t.FailNow()
+		}
+		entries, err := os.ReadDir(w.dir)
+		if err != nil {
+			t.Log("ERROR : " + err.Error())
+			t.FailNow()
+		}
+		var files []string
+		for _, entry := range entries {
+			files = append(files, entry.Name())
+		}
+		sort.Strings(files)
+		if !reflect.DeepEqual(str.commits, tt.commits) || !reflect.DeepEqual(files, tt.files) || w.Pending() != tt.pending {
+			t.Log("ERROR : "+tt.name+" : commits", str.commits, "files", files, "pending", w.Pending(),
+				"expected", tt.commits, tt.files, tt.pending)
+			t.Error("FAILURE : wal replay")
+		}
+	}
+
+	// Replay resumes from the first kept batch once the storage is back.
+	w, err := NewWAL("test", &config.StorageWAL{Dir: t.TempDir()})
+	if err != nil {
+		t.Log("ERROR : " + err.Error())
+		t.FailNow()
+	}
+	str := &walStorage{fail: true}
+	for _, id := range []string{"A", "B", "C"} {
+		if err = w.AppendTrades([]Trade{{MktID: id}}); err != nil {
+			t.Log("ERROR : " + err.Error())
+			t.FailNow()
+		}
+		if err = w.replay(context.Background(), str); err != nil {
+			t.Log("ERROR : " + err.Error())
+			t.FailNow()
+		}
+		str.fail = id != "B"
+	}
+	if want := []string{"trade A", "trade B", "trade C"}; !reflect.DeepEqual(str.commits, want) || w.size != 0 {
+		t.Log("ERROR : commits after failure", str.commits, "size", w.size, "expected", want, 0)
+		t.Error("FAILURE : wal replay")
+	}
+}
+
+// TestWALFull tests that the append fails once the max size is reached,
+// counting the batches left by the previous run, and succeeds again after the replay frees the space.
+func TestWALFull(t *testing.T) {
+	cfg := &config.StorageWAL{Dir: t.TempDir(), MaxSizeMB: 1}
+	dir := filepath.Join(cfg.Dir, "test")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Log("ERROR : " + err.Error())
+		t.FailNow()
+	}
+	left := `{"trades":[{"MktID":"` + strings.Repeat("A", 1024*1024) + `"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "00000000000000000001_trade.json"), []byte(left), 0644); err != nil {
+		t.Log("ERROR : " + err.Error())
+		t.FailNow()
+	}
+	w, err := NewWAL("test", cfg)
+	if err != nil {
+		t.Log("ERROR : " + err.Error())
+		t.FailNow()
+	}
+	if err = w.AppendTrades([]Trade{{MktID: "B", Timestamp: time.Now()}}); !errors.Is(err, ErrWALFull) {
+		t.Log("ERROR : append to full wal returned", err)
+		t.Error("FAILURE : wal max size")
+	}
+
+	if err = w.replay(context.Background(), &walStorage{}); err != nil {
+		t.Log("ERROR : " + err.Error())
+		t.FailNow()
+	}
+	if err = w.AppendTrades([]Trade{{MktID: "B", Timestamp: time.Now()}}); err != nil {
+		t.Log("ERROR : append after replay returned", err)
+		t.Error("FAILURE : wal max size")
+	}
+	if w.seq != 2 {
+		t.Log("ERROR : sequence", w.seq, "expected 2 continuing the left one")
+		t.Error("FAILURE : wal max size")
+	}
+}
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// WSServer is for re-broadcasting data to the clients connected to a websocket server run by the app.
+// Each record is sent as a text frame with the JSON record, which has the same format as Elasticsearch document.
+type WSServer struct {
+	Listener net.Listener
+	Cfg      *config.WSServer
+	mu       sync.Mutex
+	clients  map[*wsServerClient]struct{}
+}
+
+var wsServer WSServer
+
+// wsServerClient is a connected client with its subscription filter.
+// Empty filter list matches all the values.
+type wsServerClient struct {
+	conn      net.Conn
+	channels  map[string]bool
+	exchanges map[string]bool
+	markets   map[string]bool
+	mu        sync.Mutex
+}
+
+// wsServerFilter is the subscription message a client can send any time to replace its filter.
+type wsServerFilter struct {
+	Channels  []string `json:"channels"`
+	Exchanges []string `json:"exchanges"`
+	Markets   []string `json:"markets"`
+}
+
+// wsServerRecord is an encoded record with the values it is filtered by.
+type wsServerRecord struct {
+	channel  string
+	exchange string
+	market   string
+	data     []byte
+}
+
+// InitWSServer starts listening on the configured address.
+// Clients are accepted only after the server is started by Serve.
+func InitWSServer(cfg *config.WSServer) (*WSServer, error) {
+	if wsServer.Listener == nil {
+		l, err := net.Listen("tcp", cfg.Address)
+		if err != nil {
+			return nil, err
+		}
+		wsServer = WSServer{
+			Listener: l,
+			Cfg:      cfg,
+			clients:  make(map[*wsServerClient]struct{}),
+		}
+	}
+	return &wsServer, nil
+}
+
+// GetWSServer returns already prepared websocket server instance.
+func GetWSServer() *WSServer {
+	return &wsServer
+}
+
+// Serve accepts the websocket clients till the app context is cancelled.
+func (w *WSServer) Serve(appCtx context.Context) error {
+	path := w.Cfg.Path
+	if path == "" {
+		path = "/"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, w.handle)
+	srv := &http.Server{Handler: mux}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(w.Listener)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-appCtx.Done():
+		srv.Close()
+		w.mu.Lock()
+		for c := range w.clients {
+			c.conn.Close()
+			delete(w.clients, c)
+		}
+		w.mu.Unlock()
+		return appCtx.Err()
+	}
+}
+
+// handle upgrades the request to websocket and registers the client.
+// Initial filter can be given as comma separated query parameters,
+// e.g. ?channels=trade&exchanges=binance,kucoin&markets=BTC-USDT.
+func (w *WSServer) handle(rw http.ResponseWriter, r *http.Request) {
+	conn, _, _, err := ws.UpgradeHTTP(r, rw)
+	if err != nil {
+		return
+	}
+	q := r.URL.Query()
+	c := &wsServerClient{conn: conn}
+	c.setFilter(&wsServerFilter{
+		Channels:  wsServerSplit(q.Get("channels")),
+		Exchanges: wsServerSplit(q.Get("exchanges")),
+		Markets:   wsServerSplit(q.Get("markets")),
+	})
+	w.mu.Lock()
+	if w.Cfg.MaxClients > 0 && len(w.clients) >= w.Cfg.MaxClients {
+		w.mu.Unlock()
+		_ = wsutil.WriteServerMessage(conn, ws.OpClose, ws.NewCloseFrameBody(ws.StatusPolicyViolation, "too many clients"))
+		conn.Close()
+		return
+	}
+	w.clients[c] = struct{}{}
+	w.mu.Unlock()
+	go w.read(c)
+}
+
+// read handles the control frames and the filter messages of the client till it disconnects.
+func (w *WSServer) read(c *wsServerClient) {
+	defer w.remove(c)
+	rd := wsutil.Reader{
+		Source:    c.conn,
+		State:     ws.StateServerSide,
+		CheckUTF8: true,
+		OnIntermediate: func(hdr ws.Header, r io.Reader) error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return wsutil.ControlFrameHandler(c.conn, ws.StateServerSide)(hdr, r)
+		},
+	}
+	for {
+		hdr, err := rd.NextFrame()
+		if err != nil {
+			return
+		}
+		if hdr.OpCode.IsControl() {
+			if err = rd.OnIntermediate(hdr, &rd); err != nil {
+				return
+			}
+			continue
+		}
+		data, err := io.ReadAll(&rd)
+		if err != nil {
+			return
+		}
+		if hdr.OpCode != ws.OpText {
+			continue
+		}
+		var filter wsServerFilter
+		if err = jsoniter.Unmarshal(data, &filter); err != nil {
+			continue
+		}
+		c.setFilter(&filter)
+	}
+}
+
+func (w *WSServer) remove(c *wsServerClient) {
+	w.mu.Lock()
+	delete(w.clients, c)
+	w.mu.Unlock()
+	c.conn.Close()
+}
+
+// setFilter replaces the subscription filter of the client.
+func (c *wsServerClient) setFilter(f *wsServerFilter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.channels = wsServerSet(f.Channels)
+	c.exchanges = wsServerSet(f.Exchanges)
+	c.markets = wsServerSet(f.Markets)
+}
+
+// matches returns whether the record passes the subscription filter of the client.
+// It is called with the client lock held.
+func (c *wsServerClient) matches(rec *wsServerRecord) bool {
+	return (len(c.channels) == 0 || c.channels[rec.channel]) &&
+		(len(c.exchanges) == 0 || c.exchanges[rec.exchange]) &&
+		(len(c.markets) == 0 || c.markets[rec.market])
+}
+
+// CommitTickers batch sends input ticker data to the subscribed websocket clients.
+func (w *WSServer) CommitTickers(_ context.Context, data []Ticker) error {
+	recs := make([]wsServerRecord, 0, len(data))
+	for _, ticker := range data {
+		wd := esData{
+			Channel:   "ticker",
+			Exchange:  ticker.Exchange,
+			Market:    ticker.MktCommitName,
+			Base:      ticker.Base,
+			Quote:     ticker.Quote,
+			Price:     ticker.Price,
+			BestBid:   ticker.BestBid,
+			BestAsk:   ticker.BestAsk,
+			Volume:    ticker.Volume,
+			High:      ticker.High,
+			Low:       ticker.Low,
+			PriceUSD:  ticker.PriceUSD,
+			BadTick:   ticker.IsBadTick,
+			Timestamp: ticker.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		value, err := jsoniter.Marshal(wd)
+		if err != nil {
+			return err
+		}
+		recs = append(recs, wsServerRecord{channel: "ticker", exchange: ticker.Exchange, market: ticker.MktCommitName, data: value})
+	}
+	w.send(recs)
+	return nil
+}
+
+// CommitTrades batch sends input trade data to the subscribed websocket clients.
+func (w *WSServer) CommitTrades(_ context.Context, data []Trade) error {
+	recs := make([]wsServerRecord, 0, len(data))
+	for _, trade := range data {
+		wd := esData{
+			Channel:    "trade",
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			Base:       trade.Base,
+			Quote:      trade.Quote,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			BuyerMaker: trade.IsBuyerMaker,
+			PriceUSD:   trade.PriceUSD,
+			BadTick:    trade.IsBadTick,
+			Timestamp:  trade.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		value, err := jsoniter.Marshal(wd)
+		if err != nil {
+			return err
+		}
+		recs = append(recs, wsServerRecord{channel: "trade", exchange: trade.Exchange, market: trade.MktCommitName, data: value})
+	}
+	w.send(recs)
+	return nil
+}
+
+// send writes the records to all the clients subscribed to them.
+// Clients not able to keep up within the write timeout are disconnected, so that they do not slow down the others.
+func (w *WSServer) send(recs []wsServerRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for c := range w.clients {
+		if err := w.write(c, recs); err != nil {
+			c.conn.Close()
+			delete(w.clients, c)
+		}
+	}
+}
+
+func (w *WSServer) write(c *wsServerClient, recs []wsServerRecord) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if w.Cfg.WriteTimeoutSec > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(time.Duration(w.Cfg.WriteTimeoutSec) * time.Second))
+	}
+	for i := range recs {
+		if !c.matches(&recs[i]) {
+			continue
+		}
+		if err := wsutil.WriteServerText(c.conn, recs[i].data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func wsServerSplit(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func wsServerSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
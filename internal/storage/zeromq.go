@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// ZeroMQ is for publishing data on a zeromq PUB socket.
+// Each record is a two frame message, the topic <channel>.<exchange>.<market>, e.g. ticker.binance.BTC-USDT,
+// followed by the JSON of the record, so that the subscribers can filter by the topic prefix.
+type ZeroMQ struct {
+	Cfg *config.ZeroMQ
+	pub zmq4.Socket
+	mu  sync.Mutex
+}
+
+var zeroMQ ZeroMQ
+
+// InitZeroMQ initializes zeromq PUB socket with configured values.
+// Socket is bound to the endpoint, or connected to it if configured, for example to a XSUB proxy.
+func InitZeroMQ(cfg *config.ZeroMQ) (*ZeroMQ, error) {
+	if zeroMQ.pub == nil {
+		pub := zmq4.NewPub(context.Background(), zmq4.WithDialerTimeout(time.Duration(cfg.ReqTimeoutSec)*time.Second))
+		var err error
+		if cfg.Connect {
+			err = pub.Dial(cfg.Endpoint)
+		} else {
+			err = pub.Listen(cfg.Endpoint)
+		}
+		if err != nil {
+			pub.Close()
+			return nil, err
+		}
+		zeroMQ.Cfg = cfg
+		zeroMQ.pub = pub
+	}
+	return &zeroMQ, nil
+}
+
+// GetZeroMQ returns already prepared zeromq instance.
+func GetZeroMQ() *ZeroMQ {
+	return &zeroMQ
+}
+
+// CommitTickers publishes input ticker data.
+func (z *ZeroMQ) CommitTickers(appCtx context.Context, data []Ticker) error {
+	msgs := make([]zmq4.Msg, 0, len(data))
+	for _, ticker := range data {
+		zd := esData{
+			Channel:   "ticker",
+			Exchange:  ticker.Exchange,
+			Market:    ticker.MktCommitName,
+			Base:      ticker.Base,
+			Quote:     ticker.Quote,
+			Price:     ticker.Price,
+			PriceUSD:  ticker.PriceUSD,
+			BadTick:   ticker.IsBadTick,
+			BestBid:   ticker.BestBid,
+			BestAsk:   ticker.BestAsk,
+			Volume:    ticker.Volume,
+			High:      ticker.High,
+			Low:       ticker.Low,
+			Timestamp: ticker.Timestamp,
+			CreatedAt: time.Now().UTC(),
+		}
+		value, err := jsoniter.Marshal(zd)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, zmq4.NewMsgFrom(z.topic("ticker", ticker.Exchange, ticker.MktCommitName), value))
+	}
+	return z.send(appCtx, msgs)
+}
+
+// CommitTrades publishes input trade data.
+func (z *ZeroMQ) CommitTrades(appCtx context.Context, data []Trade) error {
+	msgs := make([]zmq4.Msg, 0, len(data))
+	for _, trade := range data {
+		zd := esData{
+			Channel:    "trade",
+			Exchange:   trade.Exchange,
+			Market:     trade.MktCommitName,
+			Base:       trade.Base,
+			Quote:      trade.Quote,
+			TradeID:    trade.TradeID,
+			Side:       trade.Side,
+			Size:       trade.Size,
+			Price:      trade.Price,
+			PriceUSD:   trade.PriceUSD,
+			BadTick:    trade.IsBadTick,
+			BuyerMaker: trade.IsBuyerMaker,
+			Timestamp:  trade.Timestamp,
+			CreatedAt:  time.Now().UTC(),
+		}
+		value, err := jsoniter.Marshal(zd)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, zmq4.NewMsgFrom(z.topic("trade", trade.Exchange, trade.MktCommitName), value))
+	}
+	return z.send(appCtx, msgs)
+}
+
+// topic returns the topic frame of the record, prefixed with the configured topic prefix.
+func (z *ZeroMQ) topic(channel string, exchange string, market string) []byte {
+	return []byte(z.Cfg.TopicPrefix + channel + "." + exchange + "." + market)
+}
+
+// send publishes the messages in order.
+// PUB socket drops the messages if there are no subscribers, it is not an error.
+func (z *ZeroMQ) send(appCtx context.Context, msgs []zmq4.Msg) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if appCtx.Err() != nil {
+		return appCtx.Err()
+	}
+	for _, msg := range msgs {
+		if err := z.pub.Send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the socket.
+func (z *ZeroMQ) Close() error {
+	return z.pub.Close()
+}
@@ -0,0 +1,147 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Event represents a supervisor notification sent to the configured notify url.
+type Event struct {
+	Exchange string    `json:"exchange"`
+	Type     string    `json:"type"`
+	Retry    int       `json:"retry"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+}
+
+// Event types sent in notifications.
+const (
+	EventRetry       = "retry"
+	EventQuarantine  = "quarantine"
+	EventFailed      = "failed"
+	notifyTimeoutSec = 10
+)
+
+// Run executes the exchange functions and restarts them on error as per the configured retry policy.
+//
+// If any error occurs or connection is lost, the functions are retried with a time gap till it reaches
+// a configured number of retry.
+// Retry counter will be reset back to zero if the elapsed time since the last retry is greater than the configured one.
+// Once the retry number is exhausted, exchange is either quarantined for the configured time and started afresh
+// or the error is returned, which makes the app to exit.
+func Run(appCtx context.Context, exchName string, retry *config.Retry, fn func() error) error {
+	var retryCount int
+	lastRetryTime := time.Now()
+
+	for {
+		err := fn()
+		if err == nil {
+			continue
+		}
+		log.Error().Err(err).Str("exchange", exchName).Msg("error occurred")
+
+		if retry.ResetSec == 0 || time.Since(lastRetryTime).Seconds() < float64(retry.ResetSec) {
+			retryCount++
+		} else {
+			retryCount = 1
+		}
+		lastRetryTime = time.Now()
+
+		var gap time.Duration
+		if retryCount > retry.Number {
+			if retry.QuarantineSec == 0 {
+				notify(appCtx, retry.NotifyURL, Event{Exchange: exchName, Type: EventFailed, Retry: retryCount - 1, Error: err.Error()})
+				if retry.Number == 0 {
+					return fmt.Errorf("not able to connect %s exchange. please check the log for details", exchName)
+				}
+				return fmt.Errorf("not able to connect %s exchange even after %v retry. please check the log for details", exchName, retry.Number)
+			}
+			notify(appCtx, retry.NotifyURL, Event{Exchange: exchName, Type: EventQuarantine, Retry: retryCount - 1, Error: err.Error()})
+			log.Error().Str("exchange", exchName).Msg(fmt.Sprintf("quarantined, restarting functions in %v seconds", retry.QuarantineSec))
+			gap = time.Duration(retry.QuarantineSec) * time.Second
+			retryCount = 0
+		} else {
+			notify(appCtx, retry.NotifyURL, Event{Exchange: exchName, Type: EventRetry, Retry: retryCount, Error: err.Error()})
+			gap = Gap(retry, retryCount)
+			log.Error().Str("exchange", exchName).Int("retry", retryCount).Msg(fmt.Sprintf("retrying functions in %v seconds", gap.Seconds()))
+		}
+
+		tick := time.NewTicker(gap)
+		select {
+		case <-tick.C:
+			tick.Stop()
+
+		// Return, if there is any error from another exchange.
+		case <-appCtx.Done():
+			tick.Stop()
+			log.Error().Str("exchange", exchName).Msg("ctx canceled, return from supervisor")
+			return appCtx.Err()
+		}
+	}
+}
+
+// Gap returns the time gap to wait before the given retry.
+//
+// Gap is multiplied by the configured backoff multiplier for each consecutive retry, capped by the max gap
+// and then randomly spread by the jitter percent on both sides.
+func Gap(retry *config.Retry, retryCount int) time.Duration {
+	gapSec := float64(retry.GapSec)
+	if retry.BackoffMultiplier > 1 && retryCount > 1 {
+		gapSec *= math.Pow(retry.BackoffMultiplier, float64(retryCount-1))
+	}
+	if retry.MaxGapSec > 0 && gapSec > float64(retry.MaxGapSec) {
+		gapSec = float64(retry.MaxGapSec)
+	}
+	if retry.JitterPercent > 0 {
+		spread := gapSec * float64(retry.JitterPercent) / 100
+		gapSec += spread * (2*rand.Float64() - 1)
+	}
+	if gapSec < 0 {
+		gapSec = 0
+	}
+	return time.Duration(gapSec * float64(time.Second))
+}
+
+// notify posts the event to the configured url.
+// Failure in notification is only logged as it should not affect the exchange functions.
+func notify(ctx context.Context, url string, event Event) {
+	if url == "" {
+		return
+	}
+	event.Time = time.Now().UTC()
+	body, err := jsoniter.Marshal(event)
+	if err != nil {
+		log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeoutSec*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		log.Error().Stack().Err(errors.WithStack(err)).Msg("")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if !errors.Is(err, ctx.Err()) {
+			log.Error().Stack().Err(errors.WithStack(err)).Str("exchange", event.Exchange).Msg("notification failed")
+		}
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Error().Str("exchange", event.Exchange).Str("status", resp.Status).Msg("notification failed")
+	}
+}
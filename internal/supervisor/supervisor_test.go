@@ -0,0 +1,40 @@
+package supervisor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/milkywaybrain/cryptogalaxy/internal/config"
+)
+
+// TestGap tests the gap before the retry, backed off by the multiplier, capped by the max gap
+// and spread by the jitter.
+func TestGap(t *testing.T) {
+	tests := []struct {
+		name       string
+		retry      config.Retry
+		retryCount int
+		min        time.Duration
+		max        time.Duration
+	}{
+		{"fixed gap", config.Retry{GapSec: 30}, 5, 30 * time.Second, 30 * time.Second},
+		{"no gap", config.Retry{}, 3, 0, 0},
+		{"first retry not backed off", config.Retry{GapSec: 10, BackoffMultiplier: 2}, 1, 10 * time.Second, 10 * time.Second},
+		{"backoff", config.Retry{GapSec: 10, BackoffMultiplier: 2}, 4, 80 * time.Second, 80 * time.Second},
+		{"multiplier of one ignored", config.Retry{GapSec: 10, BackoffMultiplier: 1}, 4, 10 * time.Second, 10 * time.Second},
+		{"max gap", config.Retry{GapSec: 10, BackoffMultiplier: 2, MaxGapSec: 60}, 10, 60 * time.Second, 60 * time.Second},
+		{"max gap over gap", config.Retry{GapSec: 90, MaxGapSec: 60}, 1, 60 * time.Second, 60 * time.Second},
+		{"jitter", config.Retry{GapSec: 100, JitterPercent: 20}, 1, 80 * time.Second, 120 * time.Second},
+		{"jitter after max gap", config.Retry{GapSec: 10, BackoffMultiplier: 3, MaxGapSec: 50, JitterPercent: 10}, 5, 45 * time.Second, 55 * time.Second},
+		{"jitter not negative", config.Retry{GapSec: 1, JitterPercent: 200}, 1, 0, 3 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if got := Gap(&tt.retry, tt.retryCount); got < tt.min || got > tt.max {
+				t.Log("ERROR : "+tt.name+" : gap", got, "expected between", tt.min, "and", tt.max)
+				t.Error("FAILURE : retry gap")
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package tlsconfig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// versions are the names of the TLS versions allowed in the config.
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Version returns the TLS version of the name, e.g. 1.2.
+// It returns 0 if the name is empty, for the default minimum version of crypto/tls.
+func Version(name string) (uint16, error) {
+	if name == "" {
+		return 0, nil
+	}
+	v, ok := versions[name]
+	if !ok {
+		return 0, fmt.Errorf("tls version should be one of 1.0, 1.1, 1.2 or 1.3, not %s", name)
+	}
+	return v, nil
+}
+
+// CAPool returns the system certificate pool along with the certificates of the CA bundle file,
+// so that the servers signed by a private CA, e.g. of a TLS intercepting proxy, are trusted
+// without distrusting the public ones.
+func CAPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in ca file %s", file)
+	}
+	return pool, nil
+}
+
+// Apply sets the minimum TLS version and the pinned public keys to the TLS config.
+func Apply(tlsCfg *tls.Config, minVersion string, pinnedKeys []string) error {
+	v, err := Version(minVersion)
+	if err != nil {
+		return err
+	}
+	tlsCfg.MinVersion = v
+	return Pin(tlsCfg, pinnedKeys)
+}
+
+// Pin makes the TLS config accept the server only if its certificate chain has one of the public keys,
+// each given as the base64 encoded SHA-256 hash of the subject public key info,
+// same as the one taken by curl --pinnedpubkey.
+// It is checked after the usual verification of the chain, so it also applies with InsecureSkipVerify,
+// e.g. for a self-signed certificate, which is then trusted only by its key.
+func Pin(tlsCfg *tls.Config, pinnedKeys []string) error {
+	if len(pinnedKeys) == 0 {
+		return nil
+	}
+	pins := make([][]byte, 0, len(pinnedKeys))
+	for _, key := range pinnedKeys {
+		pin, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(pin) != sha256.Size {
+			return fmt.Errorf("pinned key %s should be a base64 encoded sha256 hash", key)
+		}
+		pins = append(pins, pin)
+	}
+	tlsCfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		for _, cert := range cs.PeerCertificates {
+			hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if bytes.Equal(hash[:], pin) {
+					return nil
+				}
+			}
+		}
+		return errors.New("none of the server certificates has a pinned public key")
+	}
+	return nil
+}
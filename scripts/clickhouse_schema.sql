@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS ticker (
+  exchange LowCardinality(String),
+  market LowCardinality(String),
+  base LowCardinality(String),
+  quote LowCardinality(String),
+  price Float64,
+  best_bid Float64,
+  best_ask Float64,
+  volume Float64,
+  high Float64,
+  low Float64,
+  price_usd Float64,
+  is_bad_tick UInt8,
+  timestamp DateTime64(3, 'UTC'),
+  created_at DateTime64(3, 'UTC')
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (exchange, market, timestamp);
+
+CREATE TABLE IF NOT EXISTS trade (
+  exchange LowCardinality(String),
+  market LowCardinality(String),
+  base LowCardinality(String),
+  quote LowCardinality(String),
+  trade_id String,
+  side LowCardinality(String),
+  size Float64,
+  price Float64,
+  is_buyer_maker UInt8,
+  price_usd Float64,
+  is_bad_tick UInt8,
+  timestamp DateTime64(3, 'UTC'),
+  created_at DateTime64(3, 'UTC')
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (exchange, market, timestamp);
@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS ticker (
+  exchange varchar(32) NOT NULL,
+  market varchar(32) NOT NULL,
+  base varchar(16) NOT NULL,
+  quote varchar(16) NOT NULL,
+  price double precision NOT NULL,
+  best_bid double precision NOT NULL,
+  best_ask double precision NOT NULL,
+  volume double precision NOT NULL,
+  high double precision NOT NULL,
+  low double precision NOT NULL,
+  price_usd double precision NOT NULL,
+  is_bad_tick boolean NOT NULL,
+  timestamp timestamptz NOT NULL,
+  created_at timestamptz NOT NULL
+);
+
+SELECT create_hypertable('ticker', 'timestamp', chunk_time_interval => INTERVAL '24 hours', if_not_exists => TRUE);
+
+CREATE TABLE IF NOT EXISTS trade (
+  exchange varchar(32) NOT NULL,
+  market varchar(32) NOT NULL,
+  base varchar(16) NOT NULL,
+  quote varchar(16) NOT NULL,
+  trade_id varchar(64) NOT NULL,
+  side varchar(8) NOT NULL,
+  size double precision NOT NULL,
+  price double precision NOT NULL,
+  is_buyer_maker boolean NOT NULL,
+  price_usd double precision NOT NULL,
+  is_bad_tick boolean NOT NULL,
+  timestamp timestamptz NOT NULL,
+  created_at timestamptz NOT NULL
+);
+
+SELECT create_hypertable('trade', 'timestamp', chunk_time_interval => INTERVAL '24 hours', if_not_exists => TRUE);
+
+-- Optional compression of the chunks older than 7 days.
+ALTER TABLE ticker SET (timescaledb.compress, timescaledb.compress_segmentby = 'exchange, market');
+SELECT add_compression_policy('ticker', INTERVAL '168 hours', if_not_exists => TRUE);
+
+ALTER TABLE trade SET (timescaledb.compress, timescaledb.compress_segmentby = 'exchange, market');
+SELECT add_compression_policy('trade', INTERVAL '168 hours', if_not_exists => TRUE);